@@ -67,7 +67,7 @@ func (r *GuestbookReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	c, err := controller.New("guestbook-controller", mgr, controller.Options{Reconciler: r})
+	c, err := r.Reconciler.NewController("guestbook-controller", mgr, controller.Options{Reconciler: r})
 	if err != nil {
 		return err
 	}
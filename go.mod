@@ -5,10 +5,18 @@ go 1.15
 require (
 	github.com/blang/semver/v4 v4.0.0
 	github.com/evanphx/json-patch/v5 v5.1.0
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-git/go-git/v5 v5.1.0
 	github.com/go-logr/logr v0.3.0
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
+	github.com/google/go-jsonnet v0.17.0
+	github.com/googleapis/gnostic v0.5.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/prometheus/client_golang v1.7.1
+	github.com/spf13/cobra v1.1.1
+	go.opentelemetry.io/otel v0.20.0
+	go.opentelemetry.io/otel/sdk v0.20.0
+	go.opentelemetry.io/otel/trace v0.20.0
 	golang.org/x/crypto v0.0.0-20201002170205-7f63de1d35b0
 	golang.org/x/tools v0.0.0-20200714190737-9048b464a08d
 	k8s.io/api v0.20.1
@@ -16,6 +24,7 @@ require (
 	k8s.io/cli-runtime v0.20.1
 	k8s.io/client-go v0.20.1
 	k8s.io/klog v1.0.0
+	k8s.io/kube-openapi v0.0.0-20201113171705-d219536bb9fd
 	k8s.io/kubectl v0.20.1
 	sigs.k8s.io/cli-utils v0.16.0
 	sigs.k8s.io/controller-runtime v0.8.0
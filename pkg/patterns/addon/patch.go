@@ -33,7 +33,7 @@ import (
 // ApplyPatches is an ObjectTransform to apply Patches specified on the Addon object to the manifest
 // This transform requires the DeclarativeObject to implement addonsv1alpha1.Patchable
 func ApplyPatches(ctx context.Context, object declarative.DeclarativeObject, objects *manifest.Objects) error {
-	log := log.Log
+	log := log.FromContext(ctx)
 
 	var patches []*unstructured.Unstructured
 
@@ -40,6 +40,10 @@ type CommonSpec struct {
 	// Channel specifies a channel that can be used to resolve a specific addon, eg: stable
 	// It will be ignored if Version is specified
 	Channel string `json:"channel,omitempty"`
+	// ServiceAccountName is the ServiceAccount the manifest is applied as, with WithImpersonation
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// Paused stops the manifest being applied, with WithPause
+	Paused bool `json:"paused,omitempty"`
 }
 
 //go:generate go run ../../../../../../vendor/k8s.io/code-generator/cmd/deepcopy-gen/main.go -O zz_generated.deepcopy -i ./... -h ../../../../../../hack/boilerplate.go.txt
@@ -50,6 +54,24 @@ type CommonStatus struct {
 	Healthy bool     `json:"healthy"`
 	Errors  []string `json:"errors,omitempty"`
 	Phase   string   `json:"phase,omitempty"`
+	// Conditions are the Ready, Reconciling and Stalled conditions maintained by the reconciler
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// DeployedVersion is the version last applied, maintained by the reconciler with WithVersionPolicies,
+	// WithMigration or WithReconcileStatus
+	DeployedVersion string `json:"deployedVersion,omitempty"`
+	// LastReconcileTime is when the addon was last reconciled, maintained by the reconciler with WithReconcileStatus
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+	// LastSuccessfulApplyTime is when the manifest was last applied without errors, maintained by the reconciler
+	// with WithReconcileStatus
+	LastSuccessfulApplyTime *metav1.Time `json:"lastSuccessfulApplyTime,omitempty"`
+	// LastError is the error of the last reconcile, if it failed, maintained by the reconciler with WithReconcileStatus
+	LastError string `json:"lastError,omitempty"`
+	// ConsecutiveFailureCount is the number of reconciles that have failed since the last one to succeed,
+	// maintained by the reconciler with WithReconcileStatus
+	ConsecutiveFailureCount int64 `json:"consecutiveFailureCount,omitempty"`
+	// AvailableVersion is the latest version of the channel when it is newer than the version pinned in the spec,
+	// maintained by the channel poller of the upgrades package
+	AvailableVersion string `json:"availableVersion,omitempty"`
 }
 
 // Patchable is a trait for addon CRDs that expose a raw set of Patches to be
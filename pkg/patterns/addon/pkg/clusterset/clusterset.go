@@ -0,0 +1,214 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+The clusterset package provides a controller instantiating an addon for each
+Cluster API Cluster matching a selector, similar to a ClusterResourceSet.
+The addons are applied to the workload clusters with declarative.WithRemoteClusters.
+*/
+package clusterset
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+)
+
+// ClusterLabel is set on the addons created for a Cluster to the name of the Cluster
+const ClusterLabel = "addons.k8s.io/cluster"
+
+// DefaultClusterGVK is the kind of the Cluster API Clusters watched, unless Options.ClusterGVK is set
+var DefaultClusterGVK = schema.GroupVersionKind{Group: "cluster.x-k8s.io", Version: "v1alpha3", Kind: "Cluster"}
+
+// clusterRecheckInterval is how often we check whether the control plane of a Cluster is reachable
+var clusterRecheckInterval = 30 * time.Second
+
+// Options configures the addons created for Clusters
+type Options struct {
+	// Selector selects the Clusters the addon is created for, all Clusters if nil
+	Selector labels.Selector
+	// ClusterGVK is the kind of the Clusters, DefaultClusterGVK if empty
+	ClusterGVK schema.GroupVersionKind
+	// Prototype is an empty addon object, such as &api.Dashboard{}
+	Prototype declarative.DeclarativeObject
+	// Template returns the addon object for a Cluster, typically setting spec.clusterName to the name of the Cluster.
+	// The addon is named after the Cluster, in its namespace, unless Template sets its name.
+	Template func(ctx context.Context, cluster *unstructured.Unstructured) (declarative.DeclarativeObject, error)
+	// RateLimiter rate limits the workqueue of the controller, the controller-runtime default if nil
+	RateLimiter ratelimiter.RateLimiter
+}
+
+// Reconciler creates an addon for each Cluster matching the selector once its control plane is reachable, and
+// deletes the addon when the Cluster no longer matches.  The addons are owned by their Cluster, so they are
+// garbage collected when it is deleted.  Addons are only created: changes to existing addons are kept.
+type Reconciler struct {
+	client  client.Client
+	options Options
+
+	// reachable checks whether the API server of the cluster with the kubeconfig can be reached
+	reachable func(ctx context.Context, kubeconfig []byte) error
+}
+
+// Add creates a controller managing the addons of the Clusters matching the selector
+func Add(mgr manager.Manager, name string, options Options) error {
+	if options.Prototype == nil || options.Template == nil {
+		return fmt.Errorf("Prototype and Template must be set")
+	}
+	if options.ClusterGVK.Empty() {
+		options.ClusterGVK = DefaultClusterGVK
+	}
+	if options.Selector == nil {
+		options.Selector = labels.Everything()
+	}
+	r := &Reconciler{client: mgr.GetClient(), options: options, reachable: serverReachable}
+
+	c, err := controller.New(name, mgr, controller.Options{Reconciler: r, RateLimiter: options.RateLimiter})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Clusters
+	if err := c.Watch(&source.Kind{Type: r.newCluster()}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+
+	// Watch for changes to the addons, so deleted addons are recreated
+	return c.Watch(&source.Kind{Type: options.Prototype}, &handler.EnqueueRequestForOwner{
+		OwnerType:    r.newCluster(),
+		IsController: true,
+	})
+}
+
+func (r *Reconciler) newCluster() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(r.options.ClusterGVK)
+	return u
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	log := log.FromContext(ctx).WithValues("cluster", request.NamespacedName.String())
+
+	cluster := r.newCluster()
+	if err := r.client.Get(ctx, request.NamespacedName, cluster); err != nil {
+		// Addons of deleted Clusters are garbage collected
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if cluster.GetDeletionTimestamp() != nil {
+		return reconcile.Result{}, nil
+	}
+
+	addon, err := r.options.Template(ctx, cluster)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error building addon for cluster %s: %v", request.NamespacedName, err)
+	}
+	if addon.GetName() == "" {
+		addon.SetName(cluster.GetName())
+	}
+	addon.SetNamespace(cluster.GetNamespace())
+
+	existing := r.options.Prototype.DeepCopyObject().(declarative.DeclarativeObject)
+	err = r.client.Get(ctx, types.NamespacedName{Namespace: addon.GetNamespace(), Name: addon.GetName()}, existing)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return reconcile.Result{}, fmt.Errorf("error getting addon: %v", err)
+	}
+	found := err == nil
+
+	if !r.options.Selector.Matches(labels.Set(cluster.GetLabels())) {
+		if found && metav1.IsControlledBy(existing, cluster) {
+			log.WithValues("addon", existing.GetName()).Info("cluster no longer selected, deleting addon")
+			if err := r.client.Delete(ctx, existing); err != nil && !apierrors.IsNotFound(err) {
+				return reconcile.Result{}, fmt.Errorf("error deleting addon: %v", err)
+			}
+		}
+		return reconcile.Result{}, nil
+	}
+	if found {
+		return reconcile.Result{}, nil
+	}
+
+	if ready, reason := r.clusterReady(ctx, cluster); !ready {
+		log.WithValues("reason", reason).Info("waiting for the control plane of the cluster")
+		return reconcile.Result{RequeueAfter: clusterRecheckInterval}, nil
+	}
+
+	addonLabels := addon.GetLabels()
+	if addonLabels == nil {
+		addonLabels = make(map[string]string)
+	}
+	addonLabels[ClusterLabel] = cluster.GetName()
+	addon.SetLabels(addonLabels)
+	if err := controllerutil.SetControllerReference(cluster, addon, r.client.Scheme()); err != nil {
+		return reconcile.Result{}, err
+	}
+	log.WithValues("addon", addon.GetName()).Info("creating addon for cluster")
+	if err := r.client.Create(ctx, addon); err != nil {
+		return reconcile.Result{}, fmt.Errorf("error creating addon: %v", err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// clusterReady returns true if the control plane of the cluster is ready and reachable with its kubeconfig, or
+// why not
+func (r *Reconciler) clusterReady(ctx context.Context, cluster *unstructured.Unstructured) (bool, string) {
+	if ready, _, _ := unstructured.NestedBool(cluster.Object, "status", "controlPlaneReady"); !ready {
+		return false, "control plane not ready"
+	}
+
+	secret := &corev1.Secret{}
+	name := types.NamespacedName{Namespace: cluster.GetNamespace(), Name: cluster.GetName() + "-kubeconfig"}
+	if err := r.client.Get(ctx, name, secret); err != nil {
+		return false, fmt.Sprintf("kubeconfig secret %s not found: %v", name, err)
+	}
+	if err := r.reachable(ctx, secret.Data[declarative.DefaultKubeconfigKey]); err != nil {
+		return false, fmt.Sprintf("control plane not reachable: %v", err)
+	}
+	return true, ""
+}
+
+// serverReachable checks whether the API server of the cluster with the kubeconfig responds
+func serverReachable(ctx context.Context, kubeconfig []byte) error {
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	config.Timeout = 10 * time.Second
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	_, err = discoveryClient.ServerVersion()
+	return err
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterset
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+)
+
+var guestbookGVK = schema.GroupVersionKind{Group: "addons.example.org", Version: "v1alpha1", Kind: "Guestbook"}
+
+func newGuestbook() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(guestbookGVK)
+	return u
+}
+
+func TestReconcile(t *testing.T) {
+	cluster := func(env string, controlPlaneReady bool) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(DefaultClusterGVK)
+		u.SetNamespace("fleet")
+		u.SetName("workload")
+		u.SetUID("cluster-uid")
+		u.SetLabels(map[string]string{"env": env})
+		u.Object["status"] = map[string]interface{}{"controlPlaneReady": controlPlaneReady}
+		return u
+	}
+	ownedGuestbook := func() *unstructured.Unstructured {
+		u := newGuestbook()
+		u.SetNamespace("fleet")
+		u.SetName("workload")
+		controller := true
+		u.SetOwnerReferences([]metav1.OwnerReference{{
+			APIVersion: DefaultClusterGVK.GroupVersion().String(),
+			Kind:       "Cluster",
+			Name:       "workload",
+			UID:        "cluster-uid",
+			Controller: &controller,
+		}})
+		return u
+	}
+	kubeconfig := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fleet", Name: "workload-kubeconfig"},
+		Data:       map[string][]byte{declarative.DefaultKubeconfigKey: []byte("kubeconfig")},
+	}
+
+	tests := []struct {
+		name          string
+		objects       []client.Object
+		unreachable   bool
+		expectAddon   bool
+		expectRequeue bool
+	}{
+		{
+			name:          "control plane not ready",
+			objects:       []client.Object{cluster("prod", false), kubeconfig},
+			expectRequeue: true,
+		},
+		{
+			name:          "control plane not reachable",
+			objects:       []client.Object{cluster("prod", true), kubeconfig},
+			unreachable:   true,
+			expectRequeue: true,
+		},
+		{
+			name:        "ready",
+			objects:     []client.Object{cluster("prod", true), kubeconfig},
+			expectAddon: true,
+		},
+		{
+			name:    "not selected",
+			objects: []client.Object{cluster("dev", true), kubeconfig, ownedGuestbook()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			scheme := runtime.NewScheme()
+			corev1.AddToScheme(scheme)
+			scheme.AddKnownTypeWithName(DefaultClusterGVK, &unstructured.Unstructured{})
+			scheme.AddKnownTypeWithName(guestbookGVK, &unstructured.Unstructured{})
+
+			r := &Reconciler{
+				client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.objects...).Build(),
+				options: Options{
+					Selector:   labels.SelectorFromSet(labels.Set{"env": "prod"}),
+					ClusterGVK: DefaultClusterGVK,
+					Prototype:  newGuestbook(),
+					Template: func(ctx context.Context, cluster *unstructured.Unstructured) (declarative.DeclarativeObject, error) {
+						addon := newGuestbook()
+						addon.Object["spec"] = map[string]interface{}{"clusterName": cluster.GetName()}
+						return addon, nil
+					},
+				},
+				reachable: func(ctx context.Context, kubeconfig []byte) error {
+					if test.unreachable {
+						return errors.New("connection refused")
+					}
+					return nil
+				},
+			}
+
+			result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "fleet", Name: "workload"}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if requeue := result.RequeueAfter != 0; requeue != test.expectRequeue {
+				t.Errorf("expected requeue %v, got %v", test.expectRequeue, result)
+			}
+
+			addon := newGuestbook()
+			err = r.client.Get(ctx, types.NamespacedName{Namespace: "fleet", Name: "workload"}, addon)
+			if found := !apierrors.IsNotFound(err); found != test.expectAddon {
+				t.Fatalf("expected addon %v, got %v", test.expectAddon, err)
+			}
+			if !test.expectAddon {
+				return
+			}
+			if addon.GetLabels()[ClusterLabel] != "workload" {
+				t.Errorf("expected the cluster label, got %v", addon.GetLabels())
+			}
+			if ref := metav1.GetControllerOf(addon); ref == nil || ref.UID != "cluster-uid" {
+				t.Errorf("expected the addon to be controlled by the cluster, got %v", addon.GetOwnerReferences())
+			}
+			if name, _, _ := unstructured.NestedString(addon.Object, "spec", "clusterName"); name != "workload" {
+				t.Errorf("expected the addon to target the cluster, got %q", name)
+			}
+		})
+	}
+}
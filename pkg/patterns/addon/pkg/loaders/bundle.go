@@ -0,0 +1,278 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+	"sigs.k8s.io/yaml"
+)
+
+// BundleChecksumsFile is the file of a bundle listing the SHA-256 checksum of every other file, in the format of
+// sha256sum
+const BundleChecksumsFile = "SHA256SUMS"
+
+// BundleRepository is a Repository backed by a bundle: a tar.gz file of a channels directory, as read by
+// FSRepository, with the checksums of its files in BundleChecksumsFile.  A single file holding the channels and
+// every version of the packages can be baked into the operator image or mounted, for air-gapped clusters.
+type BundleRepository struct {
+	path string
+
+	// mutex protects files, which is only set once the bundle has been read and verified, so that failures are
+	// retried, eg when the bundle is mounted after the operator starts
+	mutex sync.Mutex
+	files map[string][]byte
+}
+
+var _ Repository = &BundleRepository{}
+
+// NewBundleRepository is the constructor for a BundleRepository reading the bundle file at path.  The bundle is
+// read and its checksums verified on first use, and read again on later uses until it is read successfully.
+func NewBundleRepository(path string) *BundleRepository {
+	return &BundleRepository{path: path}
+}
+
+// isBundle returns true if channel is the path of a bundle file
+func isBundle(channel string) bool {
+	return strings.HasSuffix(channel, ".tar.gz") || strings.HasSuffix(channel, ".tgz")
+}
+
+func (r *BundleRepository) load() (map[string][]byte, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.files != nil {
+		return r.files, nil
+	}
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening bundle: %v", err)
+	}
+	defer f.Close()
+	files, err := readBundle(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading bundle %s: %w", r.path, err)
+	}
+	r.files = files
+	return files, nil
+}
+
+// readBundle returns the files of the bundle read from in, by path, once their checksums are verified
+func readBundle(in io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid path %q", header.Name)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", name, err)
+		}
+		files[name] = b
+	}
+
+	sums, found := files[BundleChecksumsFile]
+	if !found {
+		return nil, fmt.Errorf("%s not found", BundleChecksumsFile)
+	}
+	delete(files, BundleChecksumsFile)
+	checked := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line in %s: %q", BundleChecksumsFile, line)
+		}
+		name := path.Clean(strings.TrimPrefix(fields[1], "*"))
+		b, found := files[name]
+		if !found {
+			return nil, fmt.Errorf("%s lists %s, which is not in the bundle", BundleChecksumsFile, name)
+		}
+		if checksum(b) != fields[0] {
+			return nil, fmt.Errorf("checksum mismatch for %s", name)
+		}
+		checked[name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", BundleChecksumsFile, err)
+	}
+	for name := range files {
+		if !checked[name] {
+			return nil, fmt.Errorf("%s has no checksum", name)
+		}
+	}
+	return files, nil
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *BundleRepository) LoadChannel(ctx context.Context, name string) (*Channel, error) {
+	if !allowedChannelName(name) {
+		return nil, declarative.NewTerminalError("InvalidChannel", fmt.Errorf("invalid channel name: %q", name))
+	}
+
+	log := log.FromContext(ctx)
+	log.WithValues("channel", name).WithValues("bundle", r.path).Info("loading channel")
+
+	files, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	b, found := files[name]
+	if !found {
+		return nil, fmt.Errorf("channel %q not found in bundle %s", name, r.path)
+	}
+
+	channel := &Channel{}
+	if err := yaml.Unmarshal(b, channel); err != nil {
+		return nil, fmt.Errorf("error parsing channel %s: %v", name, err)
+	}
+
+	return channel, nil
+}
+
+func (r *BundleRepository) LoadManifest(ctx context.Context, packageName string, id string) (map[string]string, error) {
+	if !allowedManifestId(packageName) {
+		return nil, declarative.NewTerminalError("InvalidPackage", fmt.Errorf("invalid package name: %q", packageName))
+	}
+
+	if !allowedManifestId(id) {
+		return nil, declarative.NewTerminalError("InvalidVersion", fmt.Errorf("invalid manifest id: %q", id))
+	}
+
+	log := log.FromContext(ctx)
+	log.WithValues("package", packageName).Info("loading package")
+
+	files, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Join("packages", packageName, id)
+	result := make(map[string]string)
+	for name, b := range files {
+		// Like FSRepository, only the files of the directory of the version are loaded, not subdirectories
+		if path.Dir(name) != dir {
+			continue
+		}
+		result[path.Join(r.path, name)] = string(b)
+	}
+	if len(result) == 0 {
+		return nil, declarative.NewTerminalError("VersionNotFound", fmt.Errorf("version %q of %q not found in %s", id, packageName, r.path))
+	}
+
+	return result, nil
+}
+
+// WriteBundle writes a bundle of the channels directory dir to w, for use with BundleRepository.  The bundle is
+// reproducible: the files are in order, with no timestamps or owners.
+func WriteBundle(w io.Writer, dir string) error {
+	files := make(map[string][]byte)
+	var names []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == BundleChecksumsFile {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[name] = b
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading channels directory %s: %v", dir, err)
+	}
+	sort.Strings(names)
+
+	var sums bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&sums, "%s  %s\n", checksum(files[name]), name)
+	}
+	files[BundleChecksumsFile] = sums.Bytes()
+	names = append(names, BundleChecksumsFile)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		b := files[name]
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing %s: %v", name, err)
+		}
+		if _, err := tw.Write(b); err != nil {
+			return fmt.Errorf("error writing %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBundleRepository(t *testing.T) {
+	channelsDir := t.TempDir()
+	files := map[string]string{
+		"stable":                                 "manifests:\n- version: 1.2.3\n",
+		"packages/guestbook/1.2.3/manifest.yaml": "kind: Deployment\n",
+		"packages/guestbook/1.2.3/extra/ignored": "kind: Service\n",
+	}
+	for name, contents := range files {
+		p := filepath.Join(channelsDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	var bundle bytes.Buffer
+	if err := WriteBundle(&bundle, channelsDir); err != nil {
+		t.Fatalf("error writing bundle: %v", err)
+	}
+	var again bytes.Buffer
+	if err := WriteBundle(&again, channelsDir); err != nil {
+		t.Fatalf("error writing bundle: %v", err)
+	}
+	if !bytes.Equal(bundle.Bytes(), again.Bytes()) {
+		t.Errorf("expected bundles to be reproducible")
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "channels.tar.gz")
+	if err := ioutil.WriteFile(bundlePath, bundle.Bytes(), 0644); err != nil {
+		t.Fatalf("error writing bundle: %v", err)
+	}
+
+	loader, err := NewManifestLoader(bundlePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	object := &unstructured.Unstructured{}
+	object.SetKind("Guestbook")
+	manifest, err := loader.ResolveManifest(context.Background(), object)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(manifest) != 1 || manifest[filepath.Join(bundlePath, "packages/guestbook/1.2.3/manifest.yaml")] != "kind: Deployment\n" {
+		t.Errorf("unexpected manifest %v", manifest)
+	}
+
+	if err := unstructured.SetNestedField(object.Object, "9.9.9", "spec", "version"); err != nil {
+		t.Fatalf("error setting version: %v", err)
+	}
+	if _, err := loader.ResolveManifest(context.Background(), object); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected version not found, got %v", err)
+	}
+
+	if _, err := NewBundleRepository(bundlePath).LoadManifest(context.Background(), "../guestbook", "1.2.3"); err == nil || !strings.Contains(err.Error(), `invalid package name: "../guestbook"`) {
+		t.Errorf("expected the invalid package name in the error, got %v", err)
+	}
+
+	// Failures to read the bundle are retried, eg until it is mounted
+	mountedPath := filepath.Join(t.TempDir(), "channels.tar.gz")
+	repo := NewBundleRepository(mountedPath)
+	if _, err := repo.LoadChannel(context.Background(), "stable"); err == nil {
+		t.Fatalf("expected an error for a missing bundle")
+	}
+	if err := ioutil.WriteFile(mountedPath, bundle.Bytes(), 0644); err != nil {
+		t.Fatalf("error writing bundle: %v", err)
+	}
+	if _, err := repo.LoadChannel(context.Background(), "stable"); err != nil {
+		t.Errorf("expected the bundle to be read once it exists, got %v", err)
+	}
+}
+
+func TestReadBundle_Checksums(t *testing.T) {
+	writeTarGz := func(files map[string]string) *bytes.Buffer {
+		var b bytes.Buffer
+		gz := gzip.NewWriter(&b)
+		tw := tar.NewWriter(gz)
+		for name, contents := range files {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}); err != nil {
+				t.Fatalf("error writing header: %v", err)
+			}
+			if _, err := tw.Write([]byte(contents)); err != nil {
+				t.Fatalf("error writing file: %v", err)
+			}
+		}
+		tw.Close()
+		gz.Close()
+		return &b
+	}
+	sum := checksum([]byte("manifests: []\n"))
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"stable": "manifests: []\n", BundleChecksumsFile: sum + "  stable\n"},
+		},
+		{
+			name:    "no checksums",
+			files:   map[string]string{"stable": "manifests: []\n"},
+			wantErr: "SHA256SUMS not found",
+		},
+		{
+			name:    "modified file",
+			files:   map[string]string{"stable": "manifests: [{version: 6.6.6}]\n", BundleChecksumsFile: sum + "  stable\n"},
+			wantErr: "checksum mismatch for stable",
+		},
+		{
+			name:    "unlisted file",
+			files:   map[string]string{"stable": "manifests: []\n", "beta": "", BundleChecksumsFile: sum + "  stable\n"},
+			wantErr: "beta has no checksum",
+		},
+		{
+			name:    "path traversal",
+			files:   map[string]string{"../stable": "manifests: []\n"},
+			wantErr: "invalid path",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readBundle(writeTarGz(test.files))
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("unexpected error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
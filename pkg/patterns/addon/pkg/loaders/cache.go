@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+const (
+	// manifestCacheSize is the number of manifests kept by the manifestCache of a remote Repository
+	manifestCacheSize = 32
+	// manifestCacheTTL is how long the manifestCache of a remote Repository keeps a manifest
+	manifestCacheTTL = time.Hour
+)
+
+// manifestCache is a Repository that remembers the manifests loaded from a remote Repository,
+// so they are only downloaded once.  The manifests for a version are assumed not to change;
+// channels are always reloaded so that new versions are picked up.  The manifests of the
+// least recently used versions are dropped beyond the size of the cache, and every manifest
+// expires after the TTL of the cache.
+type manifestCache struct {
+	Repository
+
+	manifests *cache.LRUExpireCache
+	ttl       time.Duration
+}
+
+var _ Repository = &manifestCache{}
+
+func newManifestCache(repo Repository, size int, ttl time.Duration) *manifestCache {
+	return &manifestCache{
+		Repository: repo,
+		manifests:  cache.NewLRUExpireCache(size),
+		ttl:        ttl,
+	}
+}
+
+func (c *manifestCache) LoadManifest(ctx context.Context, packageName string, id string) (map[string]string, error) {
+	key := packageName + "/" + id
+
+	if cached, found := c.manifests.Get(key); found {
+		return copyManifest(cached.(map[string]string)), nil
+	}
+
+	manifest, err := c.Repository.LoadManifest(ctx, packageName, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.manifests.Add(key, copyManifest(manifest), c.ttl)
+	return manifest, nil
+}
+
+func copyManifest(manifest map[string]string) map[string]string {
+	out := make(map[string]string, len(manifest))
+	for k, v := range manifest {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type countingRepository struct {
+	loads int
+}
+
+func (r *countingRepository) LoadChannel(ctx context.Context, name string) (*Channel, error) {
+	return &Channel{}, nil
+}
+
+func (r *countingRepository) LoadManifest(ctx context.Context, packageName string, id string) (map[string]string, error) {
+	r.loads++
+	return map[string]string{"manifest.yaml": packageName + "@" + id}, nil
+}
+
+func TestManifestCache(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepository{}
+	c := newManifestCache(repo, 2, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		m, err := c.LoadManifest(ctx, "nginx", "1.2.3")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if m["manifest.yaml"] != "nginx@1.2.3" {
+			t.Fatalf("unexpected manifest %v", m)
+		}
+		// Callers may modify the manifest they are returned
+		m["manifest.yaml"] = "modified"
+	}
+	if repo.loads != 1 {
+		t.Errorf("expected manifest to be loaded once, loaded %d times", repo.loads)
+	}
+
+	if _, err := c.LoadManifest(ctx, "nginx", "1.2.4"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.loads != 2 {
+		t.Errorf("expected new version to be loaded, loaded %d times", repo.loads)
+	}
+
+	// The least recently used version is dropped beyond the size of the cache
+	for _, id := range []string{"1.2.5", "1.2.3"} {
+		if _, err := c.LoadManifest(ctx, "nginx", id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if repo.loads != 4 {
+		t.Errorf("expected the least recently used version to be reloaded, loaded %d times", repo.loads)
+	}
+}
+
+func TestManifestCacheExpires(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepository{}
+	c := newManifestCache(repo, 2, time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.LoadManifest(ctx, "nginx", "1.2.3"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if repo.loads != 2 {
+		t.Errorf("expected the expired manifest to be reloaded, loaded %d times", repo.loads)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Component is a package composed into the manifest of a CompositeManifestLoader
+type Component struct {
+	// Package is the name of the package
+	Package string
+	// Channel is the channel the version of the package is resolved from, stable if empty
+	Channel string
+	// Version returns the version of the package to deploy for object, or "" for the latest version of the
+	// channel.  The latest version of the channel is deployed if Version is nil.
+	Version func(object runtime.Object) (string, error)
+}
+
+// CompositeManifestLoader is a ManifestController composing the manifests of several packages, eg an
+// observability addon composed of the prometheus and grafana packages, with the version of each package resolved
+// separately
+type CompositeManifestLoader struct {
+	repo       Repository
+	components []Component
+}
+
+// NewCompositeManifestLoader returns a CompositeManifestLoader of components, loaded from the channel directory
+// or URL channel as by NewManifestLoader
+func NewCompositeManifestLoader(channel string, components ...Component) (*CompositeManifestLoader, error) {
+	if len(components) == 0 {
+		return nil, fmt.Errorf("a composite manifest needs at least one component")
+	}
+	seen := make(map[string]bool)
+	for _, component := range components {
+		if component.Package == "" {
+			return nil, fmt.Errorf("components must name a package")
+		}
+		if seen[component.Package] {
+			return nil, fmt.Errorf("package %q is composed more than once", component.Package)
+		}
+		seen[component.Package] = true
+	}
+	return &CompositeManifestLoader{repo: newRepository(channel), components: components}, nil
+}
+
+// ResolveManifest returns the files of the manifests of all the components for object, merged.  Jsonnet files are
+// evaluated with the other files of their package.
+func (c *CompositeManifestLoader) ResolveManifest(ctx context.Context, object runtime.Object) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, component := range c.components {
+		files, err := c.resolveComponent(ctx, object, component)
+		if err != nil {
+			return nil, fmt.Errorf("error loading package %q: %w", component.Package, err)
+		}
+		for p, contents := range files {
+			if _, found := result[p]; found {
+				return nil, fmt.Errorf("file %s is in more than one package", p)
+			}
+			result[p] = contents
+		}
+	}
+	return result, nil
+}
+
+// ResolveVersions returns the version of each package deployed for object, by package name
+func (c *CompositeManifestLoader) ResolveVersions(ctx context.Context, object runtime.Object) (map[string]string, error) {
+	versions := make(map[string]string)
+	for _, component := range c.components {
+		version, err := c.resolveComponentVersion(ctx, object, component)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving version of package %q: %w", component.Package, err)
+		}
+		versions[component.Package] = version
+	}
+	return versions, nil
+}
+
+func (c *CompositeManifestLoader) resolveComponent(ctx context.Context, object runtime.Object, component Component) (map[string]string, error) {
+	version, err := c.resolveComponentVersion(ctx, object, component)
+	if err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).WithValues("package", component.Package).WithValues("version", version).V(1).Info("composing package")
+	files, err := c.repo.LoadManifest(ctx, component.Package, version)
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifest: %w", err)
+	}
+	return evaluateJsonnet(ctx, object, files)
+}
+
+func (c *CompositeManifestLoader) resolveComponentVersion(ctx context.Context, object runtime.Object, component Component) (string, error) {
+	var version string
+	if component.Version != nil {
+		v, err := component.Version(object)
+		if err != nil {
+			return "", err
+		}
+		version = v
+	}
+	return resolvePackageVersion(ctx, c.repo, component.Package, component.Channel, version)
+}
+
+// VersionFromSpec returns a Component.Version reading the version from the field of the object at fields, eg
+// VersionFromSpec("spec", "prometheus", "version"), or "" if the field isn't set
+func VersionFromSpec(fields ...string) func(object runtime.Object) (string, error) {
+	return func(object runtime.Object) (string, error) {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+		if err != nil {
+			return "", err
+		}
+		version, _, err := unstructured.NestedString(u, fields...)
+		if err != nil {
+			return "", fmt.Errorf("error reading version: %v", err)
+		}
+		return version, nil
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCompositeManifestLoader(t *testing.T) {
+	baseDir := t.TempDir()
+	files := map[string]string{
+		"stable": "manifests:\n- name: prometheus\n  version: 2.0.0\n- name: grafana\n  version: 7.0.0\n- name: grafana\n  version: 8.0.0\n",
+		"packages/prometheus/2.0.0/manifest.yaml": "kind: StatefulSet\n",
+		"packages/grafana/7.0.0/manifest.yaml":    "kind: Deployment\n",
+		"packages/grafana/8.0.0/manifest.yaml":    "kind: Deployment\nmetadata:\n  name: grafana-8\n",
+	}
+	for name, contents := range files {
+		p := filepath.Join(baseDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	loader, err := NewCompositeManifestLoader(baseDir,
+		Component{Package: "prometheus"},
+		Component{Package: "grafana", Version: VersionFromSpec("spec", "grafana", "version")},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	object := &unstructured.Unstructured{}
+	object.SetKind("Observability")
+	if err := unstructured.SetNestedField(object.Object, "7.0.0", "spec", "grafana", "version"); err != nil {
+		t.Fatalf("error setting version: %v", err)
+	}
+
+	manifest, err := loader.ResolveManifest(ctx, object)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		filepath.Join(baseDir, "packages/prometheus/2.0.0/manifest.yaml"): "kind: StatefulSet\n",
+		filepath.Join(baseDir, "packages/grafana/7.0.0/manifest.yaml"):    "kind: Deployment\n",
+	}
+	if !reflect.DeepEqual(manifest, expected) {
+		t.Errorf("unexpected manifest %v, expected %v", manifest, expected)
+	}
+
+	// Without a version in the spec, the latest version of the channel is used
+	unstructured.RemoveNestedField(object.Object, "spec", "grafana")
+	versions, err := loader.ResolveVersions(ctx, object)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string]string{"prometheus": "2.0.0", "grafana": "8.0.0"}; !reflect.DeepEqual(versions, expected) {
+		t.Errorf("unexpected versions %v, expected %v", versions, expected)
+	}
+
+	if _, err := NewCompositeManifestLoader(baseDir, Component{Package: "grafana"}, Component{Package: "grafana"}); err == nil {
+		t.Errorf("expected an error composing a package twice")
+	}
+}
@@ -35,6 +35,9 @@ func init() {
 	flag.StringVar(&FlagChannel, "channel", FlagChannel, "location of channel to use")
 }
 
+// TeardownPackageSuffix is appended to the name of a package to find its teardown manifest
+const TeardownPackageSuffix = "-teardown"
+
 type ManifestLoader struct {
 	repo Repository
 }
@@ -42,23 +45,146 @@ type ManifestLoader struct {
 // NewManifestLoader provides a Repository that resolves versions based on an Addon object
 // and loads manifests from the filesystem.
 func NewManifestLoader(channel string) (*ManifestLoader, error) {
+	return &ManifestLoader{repo: newRepository(channel)}, nil
+}
+
+// newRepository returns the Repository for channel: a URL served over HTTP(S), a git repository, a bundle file or a
+// directory
+func newRepository(channel string) Repository {
 	if strings.HasPrefix(channel, "http://") || strings.HasPrefix(channel, "https://") {
-		repo := NewHTTPRepository(channel)
-		return &ManifestLoader{repo: repo}, nil
+		return newManifestCache(NewHTTPRepository(channel), manifestCacheSize, manifestCacheTTL)
 	}
 
 	if strings.Contains(channel, "git//") || strings.Contains(channel, ".git") {
-		repo := NewGitRepository(channel)
-		return &ManifestLoader{repo: repo}, nil
+		return newManifestCache(NewGitRepository(channel), manifestCacheSize, manifestCacheTTL)
 	}
 
-	repo := NewFSRepository(channel)
-	return &ManifestLoader{repo: repo}, nil
+	if isBundle(channel) {
+		return NewBundleRepository(channel)
+	}
+
+	return NewFSRepository(channel)
 }
 
 func (c *ManifestLoader) ResolveManifest(ctx context.Context, object runtime.Object) (map[string]string, error) {
-	log := log.Log
+	componentName, id, err := c.resolveVersion(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.repo.LoadManifest(ctx, componentName, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifest: %w", err)
+	}
 
+	return evaluateJsonnet(ctx, object, s)
+}
+
+// ResolveTeardownManifest loads the teardown manifest for object, for use with declarative.WithTeardownManifest.
+// The teardown manifest is the same version of the package named <component>-teardown, eg
+// packages/dashboard-teardown/1.2.0/manifest.yaml in a filesystem channel.
+func (c *ManifestLoader) ResolveTeardownManifest(ctx context.Context, object runtime.Object) (map[string]string, error) {
+	componentName, id, err := c.resolveVersion(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.repo.LoadManifest(ctx, componentName+TeardownPackageSuffix, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading teardown manifest: %w", err)
+	}
+
+	return evaluateJsonnet(ctx, object, s)
+}
+
+// MinKubernetesVersion returns the minKubernetesVersion of the version of object in its channel, so that
+// status.NewKubernetesVersionCheck can check the cluster is recent enough for it.  It returns "" if the channel
+// doesn't list the version or doesn't set its minKubernetesVersion.
+func (c *ManifestLoader) MinKubernetesVersion(ctx context.Context, object runtime.Object) (string, error) {
+	version, err := c.VersionMetadata(ctx, object)
+	if err != nil || version == nil {
+		return "", err
+	}
+	return version.MinKubernetesVersion, nil
+}
+
+// VersionMetadata returns the entry of the version of object in its channel, with the requirements and deprecation
+// of the version.  It returns nil if the channel doesn't list the version, or if spec.version is set and the
+// channel can't be loaded, as versions set in the spec can be loaded without a channel.
+func (c *ManifestLoader) VersionMetadata(ctx context.Context, object runtime.Object) (*Version, error) {
+	spec, err := utils.GetCommonSpec(object)
+	if err != nil {
+		return nil, err
+	}
+	componentName, err := utils.GetCommonName(object)
+	if err != nil {
+		return nil, err
+	}
+	channelName := spec.Channel
+	if channelName == "" {
+		channelName = "stable"
+	}
+
+	channel, err := c.repo.LoadChannel(ctx, channelName)
+	if err != nil {
+		if spec.Version != "" {
+			log.FromContext(ctx).WithValues("channel", channelName).V(1).Info("channel not loaded, version has no metadata", "error", err.Error())
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if spec.Version != "" {
+		return channel.Find(componentName, spec.Version), nil
+	}
+	return channel.Latest(componentName)
+}
+
+// ResolveVersion returns the version of the manifest for object: spec.version if set, otherwise the latest version
+// of its channel
+func (c *ManifestLoader) ResolveVersion(ctx context.Context, object runtime.Object) (string, error) {
+	_, id, err := c.resolveVersion(ctx, object)
+	return id, err
+}
+
+// LatestVersion returns the latest version of the channel of object, spec.channel or stable, whether or not
+// spec.version pins another version
+func (c *ManifestLoader) LatestVersion(ctx context.Context, object runtime.Object) (string, error) {
+	spec, err := utils.GetCommonSpec(object)
+	if err != nil {
+		return "", err
+	}
+	componentName, err := utils.GetCommonName(object)
+	if err != nil {
+		return "", err
+	}
+	return resolvePackageVersion(ctx, c.repo, componentName, spec.Channel, "")
+}
+
+// ValidateVersion returns an error if the channel or version set in the spec of object doesn't exist, so that
+// webhooks can reject them.  The channel must exist if set, and the version, set or resolved from the channel,
+// must be loadable.
+func (c *ManifestLoader) ValidateVersion(ctx context.Context, object runtime.Object) error {
+	spec, err := utils.GetCommonSpec(object)
+	if err != nil {
+		return err
+	}
+	if spec.Channel != "" {
+		if _, err := c.repo.LoadChannel(ctx, spec.Channel); err != nil {
+			return fmt.Errorf("channel %q not found: %w", spec.Channel, err)
+		}
+	}
+	componentName, id, err := c.resolveVersion(ctx, object)
+	if err != nil {
+		return err
+	}
+	if _, err := c.repo.LoadManifest(ctx, componentName, id); err != nil {
+		return fmt.Errorf("version %q of %q not found: %w", id, componentName, err)
+	}
+	return nil
+}
+
+// resolveVersion returns the package name and version of the manifest for object, resolving the version from
+// the channel if spec.version isn't set
+func (c *ManifestLoader) resolveVersion(ctx context.Context, object runtime.Object) (string, string, error) {
 	var (
 		channelName   string
 		version       string
@@ -67,51 +193,52 @@ func (c *ManifestLoader) ResolveManifest(ctx context.Context, object runtime.Obj
 
 	spec, err := utils.GetCommonSpec(object)
 	if err != nil {
-		return nil, err
+		return "", "", err
 	}
 	version = spec.Version
 	channelName = spec.Channel
 
 	componentName, err = utils.GetCommonName(object)
 	if err != nil {
-		return nil, err
+		return "", "", err
 	}
 
-	// TODO: We should actually do id (1.1.2-aws or 1.1.1-nginx). But maybe YAGNI
-	id := version
-
-	if id == "" {
-		// TODO: Put channel in spec
-		if channelName == "" {
-			channelName = "stable"
-		}
-
-		channel, err := c.repo.LoadChannel(ctx, channelName)
-		if err != nil {
-			return nil, err
-		}
-
-		version, err := channel.Latest(componentName)
-		if err != nil {
-			return nil, err
-		}
-
-		// TODO: We should probably copy the kubelet componentconfig
+	id, err := resolvePackageVersion(ctx, c.repo, componentName, channelName, version)
+	if err != nil {
+		return "", "", err
+	}
+	return componentName, id, nil
+}
 
-		if version == nil {
-			return nil, fmt.Errorf("could not find latest version in channel %q", channelName)
-		}
-		id = version.Version
+// resolvePackageVersion returns version if set, otherwise the latest version of componentName in the channel
+// channelName of repo, or stable if channelName is empty
+func resolvePackageVersion(ctx context.Context, repo Repository, componentName string, channelName string, version string) (string, error) {
+	log := log.FromContext(ctx)
 
-		log.WithValues("channel", channelName).WithValues("version", id).Info("resolved version from channel")
-	} else {
+	// TODO: We should actually do id (1.1.2-aws or 1.1.1-nginx). But maybe YAGNI
+	if version != "" {
 		log.WithValues("version", version).Info("using specified version")
+		return version, nil
+	}
+
+	if channelName == "" {
+		channelName = "stable"
 	}
-	s := make(map[string]string)
-	s, err = c.repo.LoadManifest(ctx, componentName, id)
+	channel, err := repo.LoadChannel(ctx, channelName)
 	if err != nil {
-		return nil, fmt.Errorf("error loading manifest: %v", err)
+		return "", err
 	}
 
-	return s, nil
+	latest, err := channel.Latest(componentName)
+	if err != nil {
+		return "", err
+	}
+
+	// TODO: We should probably copy the kubelet componentconfig
+
+	if latest == nil {
+		return "", fmt.Errorf("could not find latest version in channel %q", channelName)
+	}
+	log.WithValues("channel", channelName).WithValues("version", latest.Version).Info("resolved version from channel")
+	return latest.Version, nil
 }
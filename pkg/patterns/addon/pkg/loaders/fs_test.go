@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestManifestLoader_ResolveTeardownManifest(t *testing.T) {
+	baseDir := t.TempDir()
+	files := map[string]string{
+		"packages/guestbook/1.2.3/manifest.yaml":          "kind: Deployment\n",
+		"packages/guestbook-teardown/1.2.3/manifest.yaml": "kind: Job\n",
+	}
+	for name, contents := range files {
+		p := filepath.Join(baseDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	loader, err := NewManifestLoader(baseDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	object := &unstructured.Unstructured{}
+	object.SetKind("Guestbook")
+	if err := unstructured.SetNestedField(object.Object, "1.2.3", "spec", "version"); err != nil {
+		t.Fatalf("error setting version: %v", err)
+	}
+
+	ctx := context.Background()
+	manifest, err := loader.ResolveManifest(ctx, object)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(manifest) != 1 || manifest[filepath.Join(baseDir, "packages/guestbook/1.2.3/manifest.yaml")] != "kind: Deployment\n" {
+		t.Errorf("unexpected manifest %v", manifest)
+	}
+
+	teardown, err := loader.ResolveTeardownManifest(ctx, object)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(teardown) != 1 || teardown[filepath.Join(baseDir, "packages/guestbook-teardown/1.2.3/manifest.yaml")] != "kind: Job\n" {
+		t.Errorf("unexpected teardown manifest %v", teardown)
+	}
+}
+
+func TestManifestLoader_MinKubernetesVersion(t *testing.T) {
+	baseDir := t.TempDir()
+	channel := `manifests:
+- version: 1.2.3
+  minKubernetesVersion: "1.19"
+- version: 1.3.0
+  minKubernetesVersion: "1.21"
+- version: 1.1.0
+`
+	if err := ioutil.WriteFile(filepath.Join(baseDir, "stable"), []byte(channel), 0644); err != nil {
+		t.Fatalf("error writing channel: %v", err)
+	}
+	loader, err := NewManifestLoader(baseDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, test := range []struct {
+		version string
+		want    string
+	}{
+		{version: "", want: "1.21"},
+		{version: "1.2.3", want: "1.19"},
+		{version: "1.1.0", want: ""},
+		{version: "2.0.0", want: ""},
+	} {
+		object := &unstructured.Unstructured{}
+		object.SetKind("Guestbook")
+		if test.version != "" {
+			if err := unstructured.SetNestedField(object.Object, test.version, "spec", "version"); err != nil {
+				t.Fatalf("error setting version: %v", err)
+			}
+		}
+
+		got, err := loader.MinKubernetesVersion(context.Background(), object)
+		if err != nil {
+			t.Errorf("version %q: unexpected error: %v", test.version, err)
+		} else if got != test.want {
+			t.Errorf("version %q: got minimum Kubernetes version %q, want %q", test.version, got, test.want)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"golang.org/x/crypto/ssh"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
 	"sigs.k8s.io/yaml"
 )
 
@@ -33,10 +34,10 @@ func NewGitRepository(baseurl string) *GitRepository {
 
 func (r *GitRepository) LoadChannel(ctx context.Context, name string) (*Channel, error) {
 	if !allowedChannelName(name) {
-		return nil, fmt.Errorf("invalid channel name: %q", name)
+		return nil, declarative.NewTerminalError("InvalidChannel", fmt.Errorf("invalid channel name: %q", name))
 	}
 
-	log := log.Log
+	log := log.FromContext(ctx)
 	log.WithValues("baseURL", r.baseURL).Info("loading channel")
 	log.WithValues("baseURL", r.baseURL).Info("cloning git repository")
 
@@ -59,14 +60,14 @@ func (r *GitRepository) LoadChannel(ctx context.Context, name string) (*Channel,
 
 func (r *GitRepository) LoadManifest(ctx context.Context, packageName string, id string) (map[string]string, error) {
 	if !allowedManifestId(packageName) {
-		return nil, fmt.Errorf("invalid package name: %q", id)
+		return nil, declarative.NewTerminalError("InvalidPackage", fmt.Errorf("invalid package name: %q", packageName))
 	}
 
 	if !allowedManifestId(id) {
-		return nil, fmt.Errorf("invalid manifest id: %q", id)
+		return nil, declarative.NewTerminalError("InvalidVersion", fmt.Errorf("invalid manifest id: %q", id))
 	}
 
-	log := log.Log
+	log := log.FromContext(ctx)
 	log.WithValues("package", packageName).Info("loading package")
 
 	var filePath string
@@ -23,13 +23,20 @@ import (
 	"net/http"
 	"strings"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
 	"sigs.k8s.io/yaml"
 )
 
 // HTTPRepository supports loading from http / https
 type HTTPRepository struct {
 	baseURL string
+
+	// Client makes the requests, http.DefaultClient if nil.  Set it to authenticate requests or trust the
+	// certificate of the server, eg with the client of a test server.
+	Client *http.Client
 }
 
 var _ Repository = &HTTPRepository{}
@@ -43,14 +50,14 @@ func NewHTTPRepository(baseURL string) *HTTPRepository {
 
 func (r *HTTPRepository) LoadChannel(ctx context.Context, name string) (*Channel, error) {
 	if !allowedChannelName(name) {
-		return nil, fmt.Errorf("invalid channel name: %q", name)
+		return nil, declarative.NewTerminalError("InvalidChannel", fmt.Errorf("invalid channel name: %q", name))
 	}
 
-	log := log.Log
+	log := log.FromContext(ctx)
 	log.WithValues("channel", name).WithValues("baseURL", r.baseURL).Info("loading channel")
 
 	p := r.makeURL(name)
-	b, err := r.readURL(p)
+	b, err := r.readURL(ctx, p)
 	if err != nil {
 		log.WithValues("path", p).Error(err, "error reading channel")
 		return nil, fmt.Errorf("error reading channel %s: %v", p, err)
@@ -66,18 +73,18 @@ func (r *HTTPRepository) LoadChannel(ctx context.Context, name string) (*Channel
 
 func (r *HTTPRepository) LoadManifest(ctx context.Context, packageName string, id string) (map[string]string, error) {
 	if !allowedManifestId(packageName) {
-		return nil, fmt.Errorf("invalid package name: %q", id)
+		return nil, declarative.NewTerminalError("InvalidPackage", fmt.Errorf("invalid package name: %q", packageName))
 	}
 
 	if !allowedManifestId(id) {
-		return nil, fmt.Errorf("invalid manifest id: %q", id)
+		return nil, declarative.NewTerminalError("InvalidVersion", fmt.Errorf("invalid manifest id: %q", id))
 	}
 
-	log := log.Log
+	log := log.FromContext(ctx)
 	log.WithValues("package", packageName).Info("loading package")
 
 	p := r.makeURL("packages", packageName, id, "manifest.yaml")
-	b, err := r.readURL(p)
+	b, err := r.readURL(ctx, p)
 	if err != nil {
 		return nil, fmt.Errorf("error reading package %s: %v", p, err)
 	}
@@ -99,14 +106,19 @@ func (r *HTTPRepository) makeURL(paths ...string) string {
 	return u
 }
 
-// readURL tries to fetch the specified url
-func (r *HTTPRepository) readURL(url string) ([]byte, error) {
-	log.Log.WithValues("url", url).Info("doing HTTP request")
-	req, err := http.NewRequest("GET", url, nil)
+// readURL tries to fetch the specified url, propagating the trace context of ctx so the request can be traced
+func (r *HTTPRepository) readURL(ctx context.Context, url string) ([]byte, error) {
+	log.FromContext(ctx).WithValues("url", url).Info("doing HTTP request")
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	response, err := http.DefaultClient.Do(req)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req)
 	if response != nil {
 		defer response.Body.Close()
 	}
@@ -0,0 +1,162 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	jsonnetExtension   = ".jsonnet"
+	libsonnetExtension = ".libsonnet"
+)
+
+// evaluateJsonnet renders any .jsonnet files in the manifest into YAML.
+//
+// If the top-level value of a .jsonnet file is a function, it is called with
+// the spec of the object as the "spec" argument.  The full object is also
+// available to all files as the external variable "cr".
+// .libsonnet files can be imported by name, but are not included in the result.
+func evaluateJsonnet(ctx context.Context, object runtime.Object, files map[string]string) (map[string]string, error) {
+	hasJsonnet := false
+	for p := range files {
+		if isJsonnet(p) {
+			hasJsonnet = true
+			break
+		}
+	}
+	if !hasJsonnet {
+		return files, nil
+	}
+
+	log := log.FromContext(ctx)
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return nil, fmt.Errorf("error converting object to unstructured: %v", err)
+	}
+	crJSON, err := json.Marshal(u)
+	if err != nil {
+		return nil, fmt.Errorf("error converting object to json: %v", err)
+	}
+	spec := u["spec"]
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("error converting spec to json: %v", err)
+	}
+
+	importer := &jsonnet.MemoryImporter{Data: map[string]jsonnet.Contents{}}
+	for p, contents := range files {
+		if isJsonnet(p) || strings.HasSuffix(p, libsonnetExtension) {
+			importer.Data[filepath.Base(p)] = jsonnet.MakeContents(contents)
+		}
+	}
+
+	result := make(map[string]string)
+	for p, contents := range files {
+		if strings.HasSuffix(p, libsonnetExtension) {
+			continue
+		}
+		if !isJsonnet(p) {
+			result[p] = contents
+			continue
+		}
+
+		log.WithValues("path", p).Info("evaluating jsonnet")
+
+		vm := jsonnet.MakeVM()
+		vm.Importer(importer)
+		vm.ExtCode("cr", string(crJSON))
+		vm.TLACode("spec", string(specJSON))
+
+		out, err := vm.EvaluateSnippet(filepath.Base(p), contents)
+		if err != nil {
+			return nil, fmt.Errorf("error evaluating jsonnet %s: %v", p, err)
+		}
+
+		manifest, err := jsonnetOutputToYAML(out)
+		if err != nil {
+			return nil, fmt.Errorf("error converting jsonnet output of %s to yaml: %v", p, err)
+		}
+		result[strings.TrimSuffix(p, jsonnetExtension)+".yaml"] = manifest
+	}
+
+	return result, nil
+}
+
+func isJsonnet(p string) bool {
+	return strings.HasSuffix(p, jsonnetExtension)
+}
+
+// jsonnetOutputToYAML converts the json produced by a jsonnet program to a multi-document yaml manifest.
+//
+// The output can be a single object (with a kind), a list of objects,
+// or a map of objects keyed by an arbitrary name, as commonly produced by jsonnet libraries.
+func jsonnetOutputToYAML(out string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		return "", err
+	}
+
+	var docs []interface{}
+	switch t := v.(type) {
+	case []interface{}:
+		docs = t
+	case map[string]interface{}:
+		if _, ok := t["kind"]; ok {
+			docs = []interface{}{t}
+		} else {
+			var keys []string
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				docs = append(docs, t[k])
+			}
+		}
+	default:
+		return "", fmt.Errorf("unexpected jsonnet output type %T", v)
+	}
+
+	var b bytes.Buffer
+	for i, doc := range docs {
+		if i != 0 {
+			b.WriteString("---\n")
+		}
+		y, err := yaml.Marshal(doc)
+		if err != nil {
+			return "", err
+		}
+		b.Write(y)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestEvaluateJsonnet(t *testing.T) {
+	cr := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "addons.example.org/v1alpha1",
+			"kind":       "Dashboard",
+			"metadata": map[string]interface{}{
+				"name":      "dashboard",
+				"namespace": "kube-system",
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(2),
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string]string
+	}{
+		{
+			name: "yaml is passed through",
+			files: map[string]string{
+				"manifest.yaml": "kind: ConfigMap\n",
+			},
+			expected: map[string]string{
+				"manifest.yaml": "kind: ConfigMap\n",
+			},
+		},
+		{
+			name: "top-level function receives spec",
+			files: map[string]string{
+				"deployment.jsonnet": `function(spec) { apiVersion: "apps/v1", kind: "Deployment", spec: { replicas: spec.replicas } }`,
+			},
+			expected: map[string]string{
+				"deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 2\n",
+			},
+		},
+		{
+			name: "cr external variable and libsonnet import",
+			files: map[string]string{
+				"lib.libsonnet": `{ cm(name):: { apiVersion: "v1", kind: "ConfigMap", metadata: { name: name } } }`,
+				"objects.jsonnet": `local lib = import "lib.libsonnet";
+local cr = std.extVar("cr");
+{ b: lib.cm(cr.metadata.name + "-b"), a: lib.cm(cr.metadata.name + "-a") }`,
+			},
+			expected: map[string]string{
+				"objects.yaml": strings.Join([]string{
+					"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: dashboard-a\n",
+					"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: dashboard-b\n",
+				}, "---\n"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := evaluateJsonnet(context.Background(), cr, test.files)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(actual) != len(test.expected) {
+				t.Fatalf("expected %d files, got %d: %v", len(test.expected), len(actual), actual)
+			}
+			for k, v := range test.expected {
+				if actual[k] != v {
+					t.Errorf("unexpected output for %s, expected:\n%s\ngot:\n%s", k, v, actual[k])
+				}
+			}
+		})
+	}
+}
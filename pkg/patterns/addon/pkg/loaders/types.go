@@ -20,11 +20,13 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
 	semver "github.com/blang/semver/v4"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
 	"sigs.k8s.io/yaml"
 )
 
@@ -90,10 +92,10 @@ func matchesSafelist(s string, safelist string) bool {
 
 func (r *FSRepository) LoadChannel(ctx context.Context, name string) (*Channel, error) {
 	if !allowedChannelName(name) {
-		return nil, fmt.Errorf("invalid channel name: %q", name)
+		return nil, declarative.NewTerminalError("InvalidChannel", fmt.Errorf("invalid channel name: %q", name))
 	}
 
-	log := log.Log
+	log := log.FromContext(ctx)
 	log.WithValues("channel", name).WithValues("base", r.basedir).Info("loading channel")
 
 	p := filepath.Join(r.basedir, name)
@@ -113,19 +115,22 @@ func (r *FSRepository) LoadChannel(ctx context.Context, name string) (*Channel,
 
 func (r *FSRepository) LoadManifest(ctx context.Context, packageName string, id string) (map[string]string, error) {
 	if !allowedManifestId(packageName) {
-		return nil, fmt.Errorf("invalid package name: %q", id)
+		return nil, declarative.NewTerminalError("InvalidPackage", fmt.Errorf("invalid package name: %q", packageName))
 	}
 
 	if !allowedManifestId(id) {
-		return nil, fmt.Errorf("invalid manifest id: %q", id)
+		return nil, declarative.NewTerminalError("InvalidVersion", fmt.Errorf("invalid manifest id: %q", id))
 	}
 
-	log := log.Log
+	log := log.FromContext(ctx)
 	log.WithValues("package", packageName).Info("loading package")
 
 	dirPath := filepath.Join(r.basedir, "packages", packageName, id)
 	filesPath, err := ioutil.ReadDir(dirPath)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, declarative.NewTerminalError("VersionNotFound", fmt.Errorf("version %q of %q not found in %s", id, packageName, r.basedir))
+		}
 		return nil, fmt.Errorf("error reading directory %s: %v", dirPath, err)
 	}
 	result := make(map[string]string)
@@ -153,6 +158,38 @@ type Channel struct {
 type Version struct {
 	Package string `json:"name"`
 	Version string `json:"version"`
+	// MinKubernetesVersion is the oldest version of Kubernetes the version of the package can be deployed to,
+	// checked by status.NewKubernetesVersionCheck
+	MinKubernetesVersion string `json:"minKubernetesVersion,omitempty"`
+	// RequiredAPIs are the APIs the version needs the cluster to serve, eg the CRDs of cert-manager, as group/Kind,
+	// or as group to require any kind of the group, checked by status.NewChannelMetadataCheck
+	RequiredAPIs []string `json:"requiredAPIs,omitempty"`
+	// Dependencies are the other addons the version needs to be installed
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	// Deprecated is a note explaining the version is deprecated, eg naming the version to upgrade to, reported in
+	// the status of the objects using the version
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+// Dependency is an addon another addon depends on
+type Dependency struct {
+	Package string `json:"name"`
+	// MinVersion is the oldest version of the package satisfying the dependency, or empty for any version
+	MinVersion string `json:"minVersion,omitempty"`
+}
+
+// Find returns the entry for version of packageName, or nil if the channel doesn't list it
+func (c *Channel) Find(packageName string, version string) *Version {
+	for i := range c.Manifests {
+		v := &c.Manifests[i]
+		if v.Package != "" && v.Package != packageName {
+			continue
+		}
+		if v.Version == version {
+			return v
+		}
+	}
+	return nil
 }
 
 func (c *Channel) Latest(packageName string) (*Version, error) {
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// channelChangeDelay is how long changes to a channels directory must settle before reconciling, so that an editor
+// saving several files triggers a single reconcile
+var channelChangeDelay = 500 * time.Millisecond
+
+// WatchChannelDirectory watches the channels directory dir for changes, and reconciles every addon object of kind gvk
+// when a file changes, so manifests can be edited without restarting the manager.  It is meant for development:
+// filesystem channels are read on every reconcile, so changes are picked up, but production operators shouldn't need
+// to watch their channels.
+func WatchChannelDirectory(ctrl controller.Controller, c client.Client, gvk schema.GroupVersionKind, dir string) error {
+	src := source.Func(func(ctx context.Context, _ handler.EventHandler, queue workqueue.RateLimitingInterface, _ ...predicate.Predicate) error {
+		log := log.FromContext(ctx).WithValues("channels", dir)
+
+		w, err := newDirectoryWatcher(dir)
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer w.Close()
+			w.run(ctx, func() {
+				list := &unstructured.UnstructuredList{}
+				list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+				if err := c.List(ctx, list); err != nil {
+					log.Error(err, "listing objects to reconcile")
+					return
+				}
+				log.WithValues("objects", len(list.Items)).Info("channels changed, reconciling")
+				for _, item := range list.Items {
+					queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: item.GetNamespace(), Name: item.GetName()}})
+				}
+			})
+		}()
+		return nil
+	})
+	if err := ctrl.Watch(src, &handler.EnqueueRequestForObject{}); err != nil {
+		return fmt.Errorf("setting up watch on channels directory %s: %v", dir, err)
+	}
+	return nil
+}
+
+// directoryWatcher watches a directory and its subdirectories, as fsnotify only watches the directories added
+type directoryWatcher struct {
+	*fsnotify.Watcher
+}
+
+func newDirectoryWatcher(dir string) (*directoryWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating watcher: %v", err)
+	}
+	w := &directoryWatcher{Watcher: watcher}
+	if err := w.addTree(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// addTree watches dir and its subdirectories
+func (w *directoryWatcher) addTree(dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if err := w.Add(p); err != nil {
+			return fmt.Errorf("error watching %s: %v", p, err)
+		}
+		return nil
+	})
+}
+
+// run calls changed once the files have stopped changing for channelChangeDelay after each change, until ctx is done
+func (w *directoryWatcher) run(ctx context.Context, changed func()) {
+	log := log.FromContext(ctx)
+
+	timer := time.NewTimer(channelChangeDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			log.V(2).Info("channels file changed", "path", e.Name, "op", e.Op.String())
+			if e.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(e.Name); err == nil && info.IsDir() {
+					if err := w.addTree(e.Name); err != nil {
+						log.Error(err, "watching new directory")
+					}
+				}
+			}
+			timer.Reset(channelChangeDelay)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Error(err, "watching channels")
+		case <-timer.C:
+			changed()
+		}
+	}
+}
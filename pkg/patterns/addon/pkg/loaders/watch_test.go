@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loaders
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirectoryWatcher(t *testing.T) {
+	dir := t.TempDir()
+	defer func(delay time.Duration) { channelChangeDelay = delay }(channelChangeDelay)
+	channelChangeDelay = 50 * time.Millisecond
+
+	w, err := newDirectoryWatcher(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	go w.run(ctx, func() { changes <- struct{}{} })
+
+	expectChange := func() {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected a change to be reported")
+		}
+	}
+
+	// Several files changed at once are reported once
+	packageDir := filepath.Join(dir, "packages", "guestbook", "1.2.3")
+	if err := os.MkdirAll(packageDir, 0755); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "stable"), []byte("manifests: []\n"), 0644); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	expectChange()
+	select {
+	case <-changes:
+		t.Errorf("expected changes to be reported once")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// New subdirectories are watched
+	if err := ioutil.WriteFile(filepath.Join(packageDir, "manifest.yaml"), []byte("kind: Deployment\n"), 0644); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	expectChange()
+}
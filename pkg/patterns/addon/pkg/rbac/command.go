@@ -0,0 +1,50 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbac
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// NewCommand returns a command that prints a ClusterRole with the rules needed to apply, watch and prune the
+// objects of all the manifests of a channels directory, see RulesForChannels
+func NewCommand() *cobra.Command {
+	var channelsDir, name string
+	cmd := &cobra.Command{
+		Use:   "rbac-gen --channels DIR",
+		Short: "Print the ClusterRole needed to manage the objects of the manifests of the channels",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rules, err := RulesForChannels(cmd.Context(), channelsDir)
+			if err != nil {
+				return err
+			}
+			y, err := yaml.Marshal(ClusterRole(name, rules))
+			if err != nil {
+				return fmt.Errorf("error converting ClusterRole to YAML: %v", err)
+			}
+			_, err = cmd.OutOrStdout().Write(y)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&channelsDir, "channels", "channels", "directory of the channels and packages")
+	cmd.Flags().StringVar(&name, "name", "manager-manifests-role", "name of the ClusterRole")
+	return cmd
+}
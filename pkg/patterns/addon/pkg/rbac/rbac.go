@@ -0,0 +1,301 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/loaders"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// Verbs are the verbs the operator needs on each kind of object of its manifests: to apply the objects (get,
+// create, patch and update), to watch them (list and watch) and to prune them (delete)
+var Verbs = []string{"create", "delete", "get", "list", "patch", "update", "watch"}
+
+// RulesForObjects returns the rules needed to apply, watch and prune objects.  The resource of each kind is
+// taken from the CRDs among objects, or guessed from the kind, eg deployments for Deployment.  The rules of the
+// Roles and ClusterRoles among objects are included, as Kubernetes only lets the operator grant permissions it
+// holds; rules with resource names keep them.
+func RulesForObjects(objects []*manifest.Object) ([]rbacv1.PolicyRule, error) {
+	plurals := make(map[schema.GroupKind]string)
+	for _, o := range objects {
+		if o.GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		u := o.UnstructuredObject().Object
+		group, _, _ := unstructured.NestedString(u, "spec", "group")
+		kind, _, _ := unstructured.NestedString(u, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(u, "spec", "names", "plural")
+		if kind != "" && plural != "" {
+			plurals[schema.GroupKind{Group: group, Kind: kind}] = plural
+		}
+	}
+
+	rules := newRuleSet()
+	for _, o := range objects {
+		gvk := o.GroupVersionKind()
+		resource, found := plurals[gvk.GroupKind()]
+		if !found {
+			plural, _ := meta.UnsafeGuessKindToResource(gvk)
+			resource = plural.Resource
+		}
+		rules.add(gvk.Group, resource, Verbs...)
+
+		switch o.GroupKind() {
+		case schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "Role"},
+			schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:
+			role := &rbacv1.ClusterRole{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.UnstructuredObject().Object, role); err != nil {
+				return nil, fmt.Errorf("error parsing %s %s: %v", o.Kind, o.Name, err)
+			}
+			for _, rule := range role.Rules {
+				rules.addRule(rule)
+			}
+		}
+	}
+	return rules.rules(), nil
+}
+
+// RulesForChannels returns the rules needed to apply, watch and prune the objects of every version of every
+// package in the channels directory channelsDir, as read by the filesystem loader.  Only YAML files are read;
+// jsonnet files depend on the custom resource, so their objects must be covered by other means.
+func RulesForChannels(ctx context.Context, channelsDir string) ([]rbacv1.PolicyRule, error) {
+	repo := loaders.NewFSRepository(channelsDir)
+
+	packagesDir := filepath.Join(channelsDir, "packages")
+	packages, err := ioutil.ReadDir(packagesDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s: %v", packagesDir, err)
+	}
+	var objects []*manifest.Object
+	for _, pkg := range packages {
+		if !pkg.IsDir() {
+			continue
+		}
+		versionsDir := filepath.Join(packagesDir, pkg.Name())
+		versions, err := ioutil.ReadDir(versionsDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading directory %s: %v", versionsDir, err)
+		}
+		for _, version := range versions {
+			if !version.IsDir() {
+				continue
+			}
+			files, err := repo.LoadManifest(ctx, pkg.Name(), version.Name())
+			if err != nil {
+				return nil, err
+			}
+			for p, manifestStr := range files {
+				if ext := filepath.Ext(p); ext != ".yaml" && ext != ".yml" {
+					continue
+				}
+				parsed, err := manifest.ParseObjects(ctx, manifestStr)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing %s: %v", p, err)
+				}
+				objects = append(objects, parsed.Items...)
+			}
+		}
+	}
+	return RulesForObjects(objects)
+}
+
+// ClusterRole returns a ClusterRole named name granting rules
+func ClusterRole(name string, rules []rbacv1.PolicyRule) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Rules:      rules,
+	}
+}
+
+// ruleSet merges rules, keeping the verbs needed on each resource, object of a resource and non-resource URL
+type ruleSet struct {
+	resources       map[schema.GroupResource]map[string]bool
+	named           map[namedResource]map[string]bool
+	nonResourceURLs map[string]map[string]bool
+}
+
+// namedResource is an object of a resource, for rules with resource names
+type namedResource struct {
+	schema.GroupResource
+	name string
+}
+
+func newRuleSet() *ruleSet {
+	return &ruleSet{
+		resources:       make(map[schema.GroupResource]map[string]bool),
+		named:           make(map[namedResource]map[string]bool),
+		nonResourceURLs: make(map[string]map[string]bool),
+	}
+}
+
+func (s *ruleSet) add(group string, resource string, verbs ...string) {
+	gr := schema.GroupResource{Group: group, Resource: resource}
+	if s.resources[gr] == nil {
+		s.resources[gr] = make(map[string]bool)
+	}
+	for _, verb := range verbs {
+		s.resources[gr][verb] = true
+	}
+}
+
+// addRule adds the verbs of rule on its resources, or only on the objects named if rule has resource names
+func (s *ruleSet) addRule(rule rbacv1.PolicyRule) {
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			if len(rule.ResourceNames) == 0 {
+				s.add(group, resource, rule.Verbs...)
+				continue
+			}
+			for _, name := range rule.ResourceNames {
+				k := namedResource{GroupResource: schema.GroupResource{Group: group, Resource: resource}, name: name}
+				if s.named[k] == nil {
+					s.named[k] = make(map[string]bool)
+				}
+				for _, verb := range rule.Verbs {
+					s.named[k][verb] = true
+				}
+			}
+		}
+	}
+	for _, url := range rule.NonResourceURLs {
+		if s.nonResourceURLs[url] == nil {
+			s.nonResourceURLs[url] = make(map[string]bool)
+		}
+		for _, verb := range rule.Verbs {
+			s.nonResourceURLs[url][verb] = true
+		}
+	}
+}
+
+// rules returns the rules of s, with a rule for the resources of each group needing the same verbs, sorted
+func (s *ruleSet) rules() []rbacv1.PolicyRule {
+	type key struct {
+		group string
+		verbs string
+	}
+	resources := make(map[key][]string)
+	for gr, verbs := range s.resources {
+		k := key{group: gr.Group, verbs: strings.Join(sortedKeys(verbs), ",")}
+		resources[k] = append(resources[k], gr.Resource)
+	}
+	var keys []key
+	for k := range resources {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].verbs < keys[j].verbs
+	})
+
+	var rules []rbacv1.PolicyRule
+	for _, k := range keys {
+		sort.Strings(resources[k])
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{k.group},
+			Resources: resources[k],
+			Verbs:     strings.Split(k.verbs, ","),
+		})
+	}
+
+	rules = append(rules, s.namedRules()...)
+
+	var urls []string
+	for url := range s.nonResourceURLs {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		rules = append(rules, rbacv1.PolicyRule{
+			NonResourceURLs: []string{url},
+			Verbs:           sortedKeys(s.nonResourceURLs[url]),
+		})
+	}
+	return rules
+}
+
+// namedRules returns the rules of s with resource names, with a rule for the objects of each resource needing the
+// same verbs, sorted.  Verbs granted on all the objects of the resource are left out.
+func (s *ruleSet) namedRules() []rbacv1.PolicyRule {
+	type key struct {
+		schema.GroupResource
+		verbs string
+	}
+	names := make(map[key][]string)
+	for k, verbs := range s.named {
+		var needed []string
+		for _, verb := range sortedKeys(verbs) {
+			if !s.resources[k.GroupResource][verb] {
+				needed = append(needed, verb)
+			}
+		}
+		if len(needed) == 0 {
+			continue
+		}
+		nk := key{GroupResource: k.GroupResource, verbs: strings.Join(needed, ",")}
+		names[nk] = append(names[nk], k.name)
+	}
+	var keys []key
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Group != keys[j].Group {
+			return keys[i].Group < keys[j].Group
+		}
+		if keys[i].Resource != keys[j].Resource {
+			return keys[i].Resource < keys[j].Resource
+		}
+		return keys[i].verbs < keys[j].verbs
+	})
+
+	var rules []rbacv1.PolicyRule
+	for _, k := range keys {
+		sort.Strings(names[k])
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups:     []string{k.Group},
+			Resources:     []string{k.Resource},
+			ResourceNames: names[k],
+			Verbs:         strings.Split(k.verbs, ","),
+		})
+	}
+	return rules
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbac
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestCommand(t *testing.T) {
+	var out bytes.Buffer
+	cmd := NewCommand()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--channels", "testdata/channels", "--name", "example-operator"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  creationTimestamp: null
+  name: example-operator
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - services
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - apiextensions.k8s.io
+  resources:
+  - customresourcedefinitions
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - apps
+  resources:
+  - deployments
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - example.com
+  resources:
+  - widgets
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - rbac.authorization.k8s.io
+  resources:
+  - clusterroles
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - ""
+  resourceNames:
+  - example
+  resources:
+  - pods
+  verbs:
+  - get
+  - list
+- nonResourceURLs:
+  - /metrics
+  verbs:
+  - get
+`
+	if got := out.String(); got != want {
+		t.Errorf("unexpected output, got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRulesMergeVerbs(t *testing.T) {
+	s := newRuleSet()
+	s.add("", "configmaps", "get")
+	s.add("", "secrets", "get")
+	s.add("", "configmaps", "list")
+
+	rules := s.rules()
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %v", rules)
+	}
+	if got := rules[0].Resources; len(got) != 1 || got[0] != "secrets" {
+		t.Errorf("expected first rule for secrets, got %v", rules[0])
+	}
+	if got := rules[1].Resources; len(got) != 1 || got[0] != "configmaps" {
+		t.Errorf("expected second rule for configmaps, got %v", rules[1])
+	}
+	if got := rules[1].Verbs; len(got) != 2 || got[0] != "get" || got[1] != "list" {
+		t.Errorf("expected get and list on configmaps, got %v", rules[1])
+	}
+}
+
+func TestRulesKeepResourceNames(t *testing.T) {
+	s := newRuleSet()
+	s.add("", "configmaps", "get")
+	s.addRule(rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"b", "a"}, Verbs: []string{"get"}})
+	s.addRule(rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"config"}, Verbs: []string{"get", "update"}})
+
+	expected := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"config"}, Verbs: []string{"update"}},
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a", "b"}, Verbs: []string{"get"}},
+	}
+	if rules := s.rules(); !reflect.DeepEqual(rules, expected) {
+		t.Errorf("expected rules %v, got %v", expected, rules)
+	}
+}
@@ -0,0 +1,322 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	addonsv1alpha1 "sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/apis/v1alpha1"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// The outcomes of a reconcile posted by a Webhook
+const (
+	OutcomeApplied = "Applied"
+	OutcomeFailed  = "Failed"
+	OutcomeDryRun  = "DryRun"
+)
+
+// SlackTemplate renders a message for a Slack incoming webhook, or another endpoint taking Slack's payload
+const SlackTemplate = `{"text": {{ json .Summary }}}`
+
+// Event is the outcome of a reconcile, rendered by the template of a Webhook
+type Event struct {
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Generation int64  `json:"generation"`
+	// Version is the version of the DeclarativeObject, from spec.version
+	Version string `json:"version,omitempty"`
+
+	// Outcome is OutcomeApplied, OutcomeFailed or OutcomeDryRun
+	Outcome string `json:"outcome"`
+	// Objects is the number of objects in the manifest
+	Objects int `json:"objects"`
+	// Operations counts the objects by what was done with them, such as created or unchanged
+	Operations map[string]int `json:"operations,omitempty"`
+	// Changes lists the objects created, configured or failed, or that would be in dry-run mode
+	Changes []string `json:"changes,omitempty"`
+	// Error is the error the reconcile failed with
+	Error string `json:"error,omitempty"`
+
+	// Summary describes the event in a few lines of text, for chat messages
+	Summary string `json:"summary"`
+}
+
+// Webhook is a declarative.Sink posting the outcome of each reconcile to an HTTP endpoint, with a body rendered
+// by a template.  It is also notified of failed reconciles and dry-runs.
+type Webhook struct {
+	// URL is the endpoint the events are posted to
+	URL string
+	// Template renders the body posted from an Event; if nil, the Event is posted as JSON
+	Template *template.Template
+	// Headers are added to each request, eg for authentication.  Content-Type defaults to application/json.
+	Headers map[string]string
+	// Client posts the events, http.DefaultClient if nil
+	Client *http.Client
+	// Scheme resolves the kind of typed DeclarativeObjects, client-go's scheme.Scheme if nil.  Set it to the scheme
+	// of the manager, eg mgr.GetScheme(), so that the kinds of the operator are known.
+	Scheme *runtime.Scheme
+
+	// mutex guards failures
+	mutex sync.Mutex
+	// failures is the last failure posted for each DeclarativeObject, so that retries aren't posted again
+	failures map[string]failure
+}
+
+// failure is a failed reconcile of a generation of a DeclarativeObject
+type failure struct {
+	generation int64
+	err        string
+}
+
+var _ declarative.Sink = &Webhook{}
+var _ declarative.FailureSink = &Webhook{}
+var _ declarative.DryRunSink = &Webhook{}
+
+// NewWebhook returns a Webhook posting each Event to url as JSON
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url}
+}
+
+// NewSlackWebhook returns a Webhook posting the summary of each Event to a Slack incoming webhook at url
+func NewSlackWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Template: template.Must(ParseTemplate(SlackTemplate))}
+}
+
+// ParseTemplate parses text as the template of a Webhook.  The template is given an Event, and can use json to
+// quote a value as JSON.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Notify posts an Applied event if the apply changed some objects.  Reconciles leaving every object unchanged, or
+// skipping the apply, aren't posted.
+func (w *Webhook) Notify(ctx context.Context, dest declarative.DeclarativeObject, objs *manifest.Objects) error {
+	event := w.applyEvent(dest, OutcomeApplied, objs, declarative.ApplyResultsFromContext(ctx))
+	w.setFailure(event, nil)
+	if len(event.Changes) == 0 {
+		return nil
+	}
+	return w.post(ctx, event)
+}
+
+// NotifyFailure posts a Failed event, unless the same generation of dest last failed with the same error, so that
+// each retry of a failing reconcile isn't posted again.
+func (w *Webhook) NotifyFailure(ctx context.Context, dest declarative.DeclarativeObject, objs *manifest.Objects, err error) error {
+	event := w.applyEvent(dest, OutcomeFailed, objs, declarative.ApplyResultsFromContext(ctx))
+	event.Error = err.Error()
+	current := failure{generation: event.Generation, err: event.Error}
+	if last, found := w.lastFailure(event); found && last == current {
+		return nil
+	}
+	if err := w.post(ctx, event); err != nil {
+		return err
+	}
+	w.setFailure(event, &current)
+	return nil
+}
+
+// failureKey identifies the DeclarativeObject of event
+func failureKey(event *Event) string {
+	return event.Kind + "/" + event.Namespace + "/" + event.Name
+}
+
+// lastFailure returns the last failure posted for the DeclarativeObject of event, if it hasn't succeeded since
+func (w *Webhook) lastFailure(event *Event) (failure, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	last, found := w.failures[failureKey(event)]
+	return last, found
+}
+
+// setFailure records f as the last failure of the DeclarativeObject of event, or forgets it if f is nil
+func (w *Webhook) setFailure(event *Event, f *failure) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if f == nil {
+		delete(w.failures, failureKey(event))
+		return
+	}
+	if w.failures == nil {
+		w.failures = make(map[string]failure)
+	}
+	w.failures[failureKey(event)] = *f
+}
+
+func (w *Webhook) NotifyDryRun(ctx context.Context, dest declarative.DeclarativeObject, diffs []declarative.ObjectDiff) error {
+	event := w.newEvent(dest, OutcomeDryRun, nil)
+	event.Objects = len(diffs)
+	for _, diff := range diffs {
+		event.count(string(diff.Operation), diff.String())
+	}
+	return w.post(ctx, event)
+}
+
+func (w *Webhook) newEvent(dest declarative.DeclarativeObject, outcome string, objs *manifest.Objects) *Event {
+	event := &Event{
+		Kind:       w.kind(dest),
+		Namespace:  dest.GetNamespace(),
+		Name:       dest.GetName(),
+		Generation: dest.GetGeneration(),
+		Version:    version(dest),
+		Outcome:    outcome,
+		Operations: make(map[string]int),
+	}
+	if objs != nil {
+		event.Objects = len(objs.Items)
+	}
+	return event
+}
+
+// applyEvent returns the event for applying objs, with the outcome of applying each object
+func (w *Webhook) applyEvent(dest declarative.DeclarativeObject, outcome string, objs *manifest.Objects, results []declarative.ApplyResult) *Event {
+	event := w.newEvent(dest, outcome, objs)
+	for _, result := range results {
+		event.count(string(result.Operation), result.String())
+	}
+	return event
+}
+
+// count records an object the operation was done to, listing it in the changes unless it was unchanged
+func (e *Event) count(operation string, object string) {
+	e.Operations[operation]++
+	if operation != string(declarative.ApplyUnchanged) {
+		e.Changes = append(e.Changes, object)
+	}
+}
+
+// summarize sets the summary of the event
+func (e *Event) summarize() {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s/%s", e.Outcome, e.Kind, e.Namespace, e.Name)
+	if e.Version != "" {
+		fmt.Fprintf(&b, " version %s", e.Version)
+	}
+	fmt.Fprintf(&b, ": %d objects", e.Objects)
+
+	var operations []string
+	for operation, n := range e.Operations {
+		operations = append(operations, fmt.Sprintf("%d %s", n, operation))
+	}
+	sort.Strings(operations)
+	if len(operations) != 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(operations, ", "))
+	}
+	for _, change := range e.Changes {
+		fmt.Fprintf(&b, "\n• %s", change)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, "\nError: %s", e.Error)
+	}
+	e.Summary = b.String()
+}
+
+// kind returns the kind of the DeclarativeObject.  Typed objects usually have an empty TypeMeta, so their kind is
+// resolved through the scheme.
+func (w *Webhook) kind(dest declarative.DeclarativeObject) string {
+	if kind := dest.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+	s := w.Scheme
+	if s == nil {
+		s = scheme.Scheme
+	}
+	gvk, err := apiutil.GVKForObject(dest, s)
+	if err != nil {
+		return ""
+	}
+	return gvk.Kind
+}
+
+// version returns the version of the DeclarativeObject, from the CommonSpec of addons or spec.version
+func version(dest declarative.DeclarativeObject) string {
+	if addon, ok := dest.(addonsv1alpha1.CommonObject); ok {
+		return addon.CommonSpec().Version
+	}
+	var obj map[string]interface{}
+	if u, ok := dest.(*unstructured.Unstructured); ok {
+		obj = u.Object
+	} else {
+		var err error
+		if obj, err = runtime.DefaultUnstructuredConverter.ToUnstructured(dest); err != nil {
+			return ""
+		}
+	}
+	v, _, _ := unstructured.NestedString(obj, "spec", "version")
+	return v
+}
+
+// post renders the event with the template and posts it to the webhook
+func (w *Webhook) post(ctx context.Context, event *Event) error {
+	event.summarize()
+
+	var body bytes.Buffer
+	if w.Template != nil {
+		if err := w.Template.Execute(&body, event); err != nil {
+			return fmt.Errorf("error rendering webhook template: %v", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(event); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, string(b))
+	}
+	return nil
+}
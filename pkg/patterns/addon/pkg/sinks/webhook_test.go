@@ -0,0 +1,204 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func newDashboard() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("addons.example.org/v1alpha1")
+	u.SetKind("Dashboard")
+	u.SetNamespace("kube-system")
+	u.SetName("dashboard")
+	u.SetGeneration(2)
+	_ = unstructured.SetNestedField(u.Object, "1.2.0", "spec", "version")
+	return u
+}
+
+// recordWebhook returns a server recording the bodies posted to it, and the recorded bodies
+func recordWebhook(t *testing.T, status int) (*httptest.Server, *[]string) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("unexpected Content-Type %q", got)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("error reading body: %v", err)
+		}
+		bodies = append(bodies, string(b))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &bodies
+}
+
+func TestWebhookApplyEvent(t *testing.T) {
+	server, bodies := recordWebhook(t, http.StatusOK)
+	objects := &manifest.Objects{Items: make([]*manifest.Object, 2)}
+	results := []declarative.ApplyResult{
+		{Kind: "Deployment", Namespace: "kube-system", Name: "dashboard", Operation: declarative.ApplyConfigured},
+		{Kind: "Service", Namespace: "kube-system", Name: "dashboard", Operation: declarative.ApplyUnchanged},
+	}
+
+	// The results are read from the context by Notify
+	webhook := NewWebhook(server.URL)
+	event := webhook.applyEvent(newDashboard(), OutcomeApplied, objects, results)
+	if err := webhook.post(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*bodies) != 1 {
+		t.Fatalf("expected one request, got %d", len(*bodies))
+	}
+	var posted Event
+	if err := json.Unmarshal([]byte((*bodies)[0]), &posted); err != nil {
+		t.Fatalf("error parsing event: %v", err)
+	}
+	want := Event{
+		Kind:       "Dashboard",
+		Namespace:  "kube-system",
+		Name:       "dashboard",
+		Generation: 2,
+		Version:    "1.2.0",
+		Outcome:    OutcomeApplied,
+		Objects:    2,
+		Operations: map[string]int{"configured": 1, "unchanged": 1},
+		Changes:    []string{"Deployment kube-system/dashboard configured"},
+		Summary:    "Applied Dashboard kube-system/dashboard version 1.2.0: 2 objects (1 configured, 1 unchanged)\n• Deployment kube-system/dashboard configured",
+	}
+	if !reflect.DeepEqual(posted, want) {
+		t.Errorf("unexpected event\ngot:  %+v\nwant: %+v", posted, want)
+	}
+}
+
+func TestSlackWebhookNotifyFailure(t *testing.T) {
+	server, bodies := recordWebhook(t, http.StatusOK)
+
+	err := NewSlackWebhook(server.URL).NotifyFailure(context.Background(), newDashboard(), nil, errors.New(`error loading "channel"`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"text": "Failed Dashboard kube-system/dashboard version 1.2.0: 0 objects\nError: error loading \"channel\""}`
+	if len(*bodies) != 1 || (*bodies)[0] != want {
+		t.Errorf("unexpected requests %q, want %q", *bodies, want)
+	}
+}
+
+func TestWebhookNotifyFailureOnce(t *testing.T) {
+	ctx := context.Background()
+	server, bodies := recordWebhook(t, http.StatusOK)
+	webhook := NewWebhook(server.URL)
+	dashboard := newDashboard()
+
+	notify := func(message string, expected int) {
+		t.Helper()
+		if err := webhook.NotifyFailure(ctx, dashboard, nil, errors.New(message)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(*bodies) != expected {
+			t.Errorf("expected %d requests, got %d", expected, len(*bodies))
+		}
+	}
+
+	notify("error applying", 1)
+	// Retries failing the same way aren't posted
+	notify("error applying", 1)
+	notify("error loading", 2)
+
+	dashboard.SetGeneration(3)
+	notify("error loading", 3)
+
+	// Failing again after succeeding is posted
+	if err := webhook.Notify(ctx, dashboard, &manifest.Objects{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	notify("error loading", 4)
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	server, bodies := recordWebhook(t, http.StatusOK)
+	tmpl, err := ParseTemplate(`{"title": {{ json (printf "%s %s" .Outcome .Name) }}, "changes": {{ json .Changes }}}`)
+	if err != nil {
+		t.Fatalf("error parsing template: %v", err)
+	}
+	webhook := &Webhook{URL: server.URL, Template: tmpl}
+
+	diffs := []declarative.ObjectDiff{
+		{Kind: "Deployment", Namespace: "kube-system", Name: "dashboard", Operation: declarative.ApplyCreated},
+	}
+	if err := webhook.NotifyDryRun(context.Background(), newDashboard(), diffs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"title": "DryRun dashboard", "changes": ["Deployment kube-system/dashboard created"]}`
+	if len(*bodies) != 1 || (*bodies)[0] != want {
+		t.Errorf("unexpected requests %q, want %q", *bodies, want)
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	server, _ := recordWebhook(t, http.StatusForbidden)
+
+	err := NewWebhook(server.URL).NotifyFailure(context.Background(), newDashboard(), &manifest.Objects{}, errors.New("error applying manifest"))
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the status to be returned, got %v", err)
+	}
+}
+
+func TestWebhookNotifyUnchanged(t *testing.T) {
+	server, bodies := recordWebhook(t, http.StatusOK)
+
+	// Without apply results, eg when the apply was skipped, nothing changed
+	if err := NewWebhook(server.URL).Notify(context.Background(), newDashboard(), &manifest.Objects{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*bodies) != 0 {
+		t.Errorf("expected nothing to be posted, got %q", *bodies)
+	}
+}
+
+func TestWebhookKindOfTypedObject(t *testing.T) {
+	// Typed objects read from the API server have an empty TypeMeta
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "dashboard"}}
+	if event := NewWebhook("").newEvent(configMap, OutcomeApplied, nil); event.Kind != "ConfigMap" {
+		t.Errorf("expected the kind to be resolved through the scheme, got %q", event.Kind)
+	}
+
+	webhook := &Webhook{Scheme: runtime.NewScheme()}
+	if event := webhook.newEvent(configMap, OutcomeApplied, nil); event.Kind != "" {
+		t.Errorf("expected kinds missing from the scheme to be empty, got %q", event.Kind)
+	}
+}
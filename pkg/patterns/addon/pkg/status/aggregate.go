@@ -45,7 +45,7 @@ type aggregator struct {
 }
 
 func (a *aggregator) Reconciled(ctx context.Context, src declarative.DeclarativeObject, objs *manifest.Objects) error {
-	log := log.Log
+	log := log.FromContext(ctx)
 
 	statusHealthy := true
 	statusErrors := []string{}
@@ -77,6 +77,13 @@ func (a *aggregator) Reconciled(ctx context.Context, src declarative.Declarative
 		}
 	}
 
+	for _, result := range declarative.ApplyResultsFromContext(ctx) {
+		if result.Operation == declarative.ApplyFailed {
+			statusHealthy = false
+			statusErrors = append(statusErrors, fmt.Sprintf("error applying %s", result))
+		}
+	}
+
 	log.WithValues("object", src).WithValues("status", statusHealthy).V(2).Info("built status")
 
 	currentStatus, err := utils.GetCommonStatus(src)
@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/loaders"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/utils"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+)
+
+const (
+	// ConditionDeprecatedVersion is true in the CommonStatus of addons using a version deprecated by its channel
+	ConditionDeprecatedVersion = "DeprecatedVersion"
+	// ReasonVersionDeprecated is the reason for a true ConditionDeprecatedVersion
+	ReasonVersionDeprecated = "VersionDeprecated"
+)
+
+// ChannelMetadata returns the entry of the version of an addon in its channel, or nil if the channel doesn't list
+// it.  loaders.ManifestLoader implements it.
+type ChannelMetadata interface {
+	VersionMetadata(ctx context.Context, object runtime.Object) (*loaders.Version, error)
+}
+
+// DependencyChecker returns an error if the dependency of src isn't installed
+type DependencyChecker interface {
+	CheckDependency(ctx context.Context, src declarative.DeclarativeObject, dependency loaders.Dependency) error
+}
+
+// NewChannelMetadataCheck provides an implementation of declarative.Preflight enforcing the requirements the
+// channel sets on the version of each addon: the cluster must be at least its minKubernetesVersion and serve its
+// requiredAPIs, and each of its dependencies must be installed, as checked by dependencies.  Dependencies are not
+// checked if dependencies is nil.  The deprecation note of the version, if any, is reported in the
+// DeprecatedVersion condition of the CommonStatus.
+func NewChannelMetadataCheck(client client.Client, discovery discovery.DiscoveryInterface, metadata ChannelMetadata, dependencies DependencyChecker) declarative.Preflight {
+	return &channelMetadataCheck{client: client, discovery: discovery, metadata: metadata, dependencies: dependencies}
+}
+
+type channelMetadataCheck struct {
+	client       client.Client
+	discovery    discovery.DiscoveryInterface
+	metadata     ChannelMetadata
+	dependencies DependencyChecker
+}
+
+func (c *channelMetadataCheck) Preflight(ctx context.Context, src declarative.DeclarativeObject) error {
+	version, err := c.metadata.VersionMetadata(ctx, src)
+	if err != nil {
+		return fmt.Errorf("error loading the metadata of the version: %w", err)
+	}
+	if version == nil {
+		return nil
+	}
+
+	c.reportDeprecation(ctx, src, version.Deprecated)
+
+	if version.MinKubernetesVersion != "" {
+		check, err := NewKubernetesVersionCheck(c.discovery, version.MinKubernetesVersion)
+		if err != nil {
+			return declarative.NewTerminalError(declarative.ReasonInvalidSpec, err)
+		}
+		if err := check.Preflight(ctx, src); err != nil {
+			return err
+		}
+	}
+
+	if len(version.RequiredAPIs) != 0 {
+		var required []schema.GroupKind
+		for _, api := range version.RequiredAPIs {
+			required = append(required, parseRequiredAPI(api))
+		}
+		if err := NewRequiredAPIsCheck(c.client, c.discovery, required...).Preflight(ctx, src); err != nil {
+			return err
+		}
+	}
+
+	if c.dependencies != nil {
+		var unmet []string
+		for _, dependency := range version.Dependencies {
+			if err := c.dependencies.CheckDependency(ctx, src, dependency); err != nil {
+				unmet = append(unmet, err.Error())
+			}
+		}
+		if len(unmet) != 0 {
+			return fmt.Errorf("dependencies not met: %s", strings.Join(unmet, ", "))
+		}
+	}
+	return nil
+}
+
+// parseRequiredAPI parses an API of requiredAPIs, group/Kind or group
+func parseRequiredAPI(api string) schema.GroupKind {
+	if i := strings.LastIndex(api, "/"); i != -1 {
+		return schema.GroupKind{Group: api[:i], Kind: api[i+1:]}
+	}
+	return schema.GroupKind{Group: api}
+}
+
+// reportDeprecation sets ConditionDeprecatedVersion in the CommonStatus of src with the deprecation note, or
+// removes it if note is empty.  Objects with no CommonStatus are skipped.
+func (c *channelMetadataCheck) reportDeprecation(ctx context.Context, src declarative.DeclarativeObject, note string) {
+	log := log.FromContext(ctx)
+
+	currentStatus, err := utils.GetCommonStatus(src)
+	if err != nil {
+		log.V(1).Info("not reporting deprecation, object has no CommonStatus", "error", err.Error())
+		return
+	}
+	status := currentStatus
+	status.Conditions = append([]metav1.Condition(nil), currentStatus.Conditions...)
+	if note == "" {
+		if meta.FindStatusCondition(status.Conditions, ConditionDeprecatedVersion) == nil {
+			return
+		}
+		meta.RemoveStatusCondition(&status.Conditions, ConditionDeprecatedVersion)
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               ConditionDeprecatedVersion,
+			Status:             metav1.ConditionTrue,
+			Reason:             ReasonVersionDeprecated,
+			Message:            note,
+			ObservedGeneration: src.GetGeneration(),
+		})
+	}
+	if reflect.DeepEqual(status, currentStatus) {
+		return
+	}
+
+	if note != "" {
+		log.WithValues("deprecation", note).Info("version is deprecated")
+	}
+	if err := utils.SetCommonStatus(src, status); err != nil {
+		log.Error(err, "unable to update status")
+		return
+	}
+	if err := c.client.Status().Update(ctx, src); err != nil {
+		log.Error(err, "updating status with deprecation")
+	}
+}
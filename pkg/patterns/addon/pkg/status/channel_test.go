@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/loaders"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/utils"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+)
+
+type fakeChannelMetadata struct {
+	version *loaders.Version
+}
+
+func (m *fakeChannelMetadata) VersionMetadata(ctx context.Context, object runtime.Object) (*loaders.Version, error) {
+	return m.version, nil
+}
+
+type installedPackages map[string]bool
+
+func (p installedPackages) CheckDependency(ctx context.Context, src declarative.DeclarativeObject, dependency loaders.Dependency) error {
+	if !p[dependency.Package] {
+		return fmt.Errorf("%s is not installed", dependency.Package)
+	}
+	return nil
+}
+
+func TestChannelMetadataCheck(t *testing.T) {
+	server := &fakediscovery.FakeDiscovery{
+		Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+			{GroupVersion: "cert-manager.io/v1", APIResources: []metav1.APIResource{{Name: "certificates", Kind: "Certificate"}}},
+		}},
+		FakedServerVersion: &version.Info{GitVersion: "v1.20.2"},
+	}
+	installed := installedPackages{"cert-manager": true}
+
+	for _, test := range []struct {
+		name           string
+		version        *loaders.Version
+		wantErr        string
+		wantTerminal   bool
+		wantDeprecated string
+	}{
+		{name: "not in channel"},
+		{
+			name: "requirements met",
+			version: &loaders.Version{
+				Version:              "1.2.3",
+				MinKubernetesVersion: "1.20",
+				RequiredAPIs:         []string{"cert-manager.io/Certificate", "cert-manager.io"},
+				Dependencies:         []loaders.Dependency{{Package: "cert-manager"}},
+			},
+		},
+		{
+			name:    "cluster too old",
+			version: &loaders.Version{Version: "1.2.3", MinKubernetesVersion: "1.21"},
+			wantErr: "Kubernetes version too old: the cluster runs Kubernetes v1.20.2, older than the minimum version 1.21.0",
+		},
+		{
+			name:    "missing API",
+			version: &loaders.Version{Version: "1.2.3", RequiredAPIs: []string{"cert-manager.io/Issuer"}},
+			wantErr: "required API Issuer.cert-manager.io is not served by the cluster",
+		},
+		{
+			name:    "missing dependency",
+			version: &loaders.Version{Version: "1.2.3", Dependencies: []loaders.Dependency{{Package: "prometheus"}}},
+			wantErr: "dependencies not met: prometheus is not installed",
+		},
+		{
+			name:           "deprecated",
+			version:        &loaders.Version{Version: "1.2.3", Deprecated: "1.2.3 is no longer supported, upgrade to 1.3.0"},
+			wantDeprecated: "1.2.3 is no longer supported, upgrade to 1.3.0",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			addon := &unstructured.Unstructured{}
+			addon.SetAPIVersion("addons.example.org/v1alpha1")
+			addon.SetKind("Dashboard")
+			addon.SetNamespace("kube-system")
+			addon.SetName("dashboard")
+			c := fake.NewClientBuilder().WithObjects(addon).Build()
+
+			check := NewChannelMetadataCheck(c, server, &fakeChannelMetadata{version: test.version}, installed)
+			err := check.Preflight(ctx, addon)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || err.Error() != test.wantErr {
+				t.Errorf("unexpected error %v, want %s", err, test.wantErr)
+			}
+			var terminal *declarative.TerminalError
+			if errors.As(err, &terminal) != test.wantTerminal {
+				t.Errorf("unexpected terminal error %v", err)
+			}
+
+			status, err := utils.GetCommonStatus(addon)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			condition := meta.FindStatusCondition(status.Conditions, ConditionDeprecatedVersion)
+			if test.wantDeprecated == "" {
+				if condition != nil {
+					t.Errorf("unexpected condition %v", condition)
+				}
+			} else if condition == nil || condition.Message != test.wantDeprecated || condition.Reason != ReasonVersionDeprecated {
+				t.Errorf("unexpected condition %v", condition)
+			}
+		})
+	}
+}
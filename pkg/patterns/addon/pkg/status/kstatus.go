@@ -23,12 +23,12 @@ func NewKstatusAgregator(c client.Client, reconciler *declarative.Reconciler) *k
 
 func (k *kstatusAggregator) Reconciled(ctx context.Context, src declarative.DeclarativeObject,
 	objs *manifest.Objects) error {
-	log := log.Log
+	log := log.FromContext(ctx)
 
 	statusMap := make(map[status.Status]bool)
 	for _, object := range objs.Items {
 
-		unstruct, err := declarative.GetObjectFromCluster(object, k.reconciler)
+		unstruct, err := declarative.GetObjectFromCluster(ctx, object, k.reconciler)
 		if err != nil {
 			log.WithValues("object", object.Kind+"/"+object.Name).Error(err, "Unable to get status of object")
 			return err
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	semver "github.com/blang/semver/v4"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+)
+
+// ErrKubernetesVersionTooOld is wrapped by the error of the preflight check when the cluster is older than the
+// minimum Kubernetes version.  The reconcile is retried with backoff, as the cluster may be upgraded.
+var ErrKubernetesVersionTooOld = errors.New("Kubernetes version too old")
+
+// KubernetesVersionRequirement returns the minimum version of Kubernetes needed to deploy object, or "" if any
+// version will do.  loaders.ManifestLoader implements it with the minKubernetesVersion of the channel.
+type KubernetesVersionRequirement interface {
+	MinKubernetesVersion(ctx context.Context, object runtime.Object) (string, error)
+}
+
+// NewKubernetesVersionCheck provides an implementation of declarative.Preflight that fails the reconcile with
+// ErrKubernetesVersionTooOld when the Kubernetes version of the cluster is older than minVersion, if set, or than the version
+// required by each of requirements.  server is usually the discovery client of the cluster the objects are
+// applied to.
+func NewKubernetesVersionCheck(server discovery.ServerVersionInterface, minVersion string, requirements ...KubernetesVersionRequirement) (declarative.Preflight, error) {
+	check := &kubernetesVersionCheck{server: server, requirements: requirements}
+	if minVersion != "" {
+		v, err := semver.ParseTolerant(minVersion)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse minimum Kubernetes version %q: %v", minVersion, err)
+		}
+		check.minVersion = &v
+	}
+	return check, nil
+}
+
+type kubernetesVersionCheck struct {
+	server       discovery.ServerVersionInterface
+	minVersion   *semver.Version
+	requirements []KubernetesVersionRequirement
+}
+
+func (c *kubernetesVersionCheck) Preflight(ctx context.Context, src declarative.DeclarativeObject) error {
+	minVersion := c.minVersion
+	for _, requirement := range c.requirements {
+		s, err := requirement.MinKubernetesVersion(ctx, src)
+		if err != nil {
+			return fmt.Errorf("error finding the minimum Kubernetes version: %w", err)
+		}
+		if s == "" {
+			continue
+		}
+		v, err := semver.ParseTolerant(s)
+		if err != nil {
+			return declarative.NewTerminalError(declarative.ReasonInvalidSpec, fmt.Errorf("unable to parse minimum Kubernetes version %q: %v", s, err))
+		}
+		if minVersion == nil || v.GT(*minVersion) {
+			minVersion = &v
+		}
+	}
+	if minVersion == nil {
+		return nil
+	}
+
+	info, err := c.server.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("error getting the Kubernetes version of the cluster: %v", err)
+	}
+	serverVersion, err := semver.ParseTolerant(info.GitVersion)
+	if err != nil {
+		return fmt.Errorf("unable to parse the Kubernetes version %q of the cluster: %v", info.GitVersion, err)
+	}
+	// Ignore pre-releases and builds, such as v1.20.2-gke.100, which would otherwise be older than v1.20.2
+	serverVersion = semver.Version{Major: serverVersion.Major, Minor: serverVersion.Minor, Patch: serverVersion.Patch}
+
+	if serverVersion.LT(*minVersion) {
+		return fmt.Errorf("%w: the cluster runs Kubernetes %s, older than the minimum version %s", ErrKubernetesVersionTooOld, info.GitVersion, minVersion)
+	}
+	log.FromContext(ctx).WithValues("kubernetesVersion", info.GitVersion, "minVersion", minVersion.String()).V(2).Info("Kubernetes version is recent enough")
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+)
+
+type channelRequirement string
+
+func (r channelRequirement) MinKubernetesVersion(ctx context.Context, object runtime.Object) (string, error) {
+	return string(r), nil
+}
+
+func TestKubernetesVersionCheck(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		serverVersion string
+		minVersion    string
+		channel       channelRequirement
+		wantTooOld    bool
+	}{
+		{name: "no minimum", serverVersion: "v1.18.0"},
+		{name: "recent enough", serverVersion: "v1.20.2", minVersion: "1.20"},
+		{name: "pre-release of the minimum", serverVersion: "v1.20.0-gke.100", minVersion: "1.20"},
+		{name: "too old", serverVersion: "v1.19.9", minVersion: "1.20", wantTooOld: true},
+		{name: "channel requires more", serverVersion: "v1.20.2", minVersion: "1.19", channel: "1.21", wantTooOld: true},
+		{name: "option requires more", serverVersion: "v1.20.2", minVersion: "v1.21.0", channel: "1.19", wantTooOld: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := &fakediscovery.FakeDiscovery{
+				Fake:               &clienttesting.Fake{},
+				FakedServerVersion: &version.Info{GitVersion: test.serverVersion},
+			}
+			check, err := NewKubernetesVersionCheck(server, test.minVersion, test.channel)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = check.Preflight(context.Background(), &unstructured.Unstructured{})
+			if test.wantTooOld {
+				if !errors.Is(err, ErrKubernetesVersionTooOld) || declarative.IsTerminalError(err) {
+					t.Errorf("expected a retryable %v error, got %v", ErrKubernetesVersionTooOld, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
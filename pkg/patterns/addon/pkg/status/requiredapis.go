@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/utils"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+)
+
+// NewRequiredAPIsCheck provides an implementation of declarative.Preflight that fails the reconcile until the
+// cluster serves each of the required APIs, eg the CRDs of cert-manager.  An API with no Kind requires any version
+// of the Group to be served, eg {Group: "monitoring.coreos.com"}; otherwise the Kind must be served in some version
+// of the Group.  The missing APIs are listed in the errors of the CommonStatus of addons.
+func NewRequiredAPIsCheck(client client.Client, discovery discovery.DiscoveryInterface, required ...schema.GroupKind) declarative.Preflight {
+	return &requiredAPIsCheck{client: client, discovery: discovery, required: required}
+}
+
+type requiredAPIsCheck struct {
+	client    client.Client
+	discovery discovery.DiscoveryInterface
+	required  []schema.GroupKind
+}
+
+func (c *requiredAPIsCheck) Preflight(ctx context.Context, src declarative.DeclarativeObject) error {
+	missing, err := c.missingAPIs()
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var errors []string
+	for _, gk := range missing {
+		errors = append(errors, fmt.Sprintf("required API %s is not served by the cluster", apiName(gk)))
+	}
+	c.reportMissing(ctx, src, errors)
+	return fmt.Errorf("%s", strings.Join(errors, ", "))
+}
+
+// missingAPIs returns the required APIs the cluster doesn't serve
+func (c *requiredAPIsCheck) missingAPIs() ([]schema.GroupKind, error) {
+	groups, err := c.discovery.ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("error discovering API groups: %v", err)
+	}
+	versions := make(map[string][]string)
+	for _, group := range groups.Groups {
+		for _, v := range group.Versions {
+			versions[group.Name] = append(versions[group.Name], v.GroupVersion)
+		}
+	}
+
+	var missing []schema.GroupKind
+	for _, gk := range c.required {
+		served, err := c.served(gk, versions[gk.Group])
+		if err != nil {
+			return nil, err
+		}
+		if !served {
+			missing = append(missing, gk)
+		}
+	}
+	return missing, nil
+}
+
+// served returns whether gk is served in one of the versions of its group
+func (c *requiredAPIsCheck) served(gk schema.GroupKind, groupVersions []string) (bool, error) {
+	if gk.Kind == "" {
+		return len(groupVersions) != 0, nil
+	}
+	for _, gv := range groupVersions {
+		resources, err := c.discovery.ServerResourcesForGroupVersion(gv)
+		if err != nil {
+			return false, fmt.Errorf("error discovering the resources of %s: %v", gv, err)
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Kind == gk.Kind {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// reportMissing lists the missing APIs in the errors of the CommonStatus of src, if it has one
+func (c *requiredAPIsCheck) reportMissing(ctx context.Context, src declarative.DeclarativeObject, errors []string) {
+	log := log.FromContext(ctx)
+
+	currentStatus, err := utils.GetCommonStatus(src)
+	if err != nil {
+		log.V(1).Info("not reporting missing APIs, object has no CommonStatus", "error", err.Error())
+		return
+	}
+	status := currentStatus
+	status.Healthy = false
+	status.Errors = errors
+	if reflect.DeepEqual(status, currentStatus) {
+		return
+	}
+
+	if err := utils.SetCommonStatus(src, status); err != nil {
+		log.Error(err, "unable to update status")
+		return
+	}
+	if err := c.client.Status().Update(ctx, src); err != nil {
+		log.Error(err, "updating status with missing APIs")
+	}
+}
+
+func apiName(gk schema.GroupKind) string {
+	if gk.Kind == "" {
+		return gk.Group
+	}
+	return gk.String()
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRequiredAPIsCheck(t *testing.T) {
+	server := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap"}}},
+		{GroupVersion: "cert-manager.io/v1", APIResources: []metav1.APIResource{{Name: "certificates", Kind: "Certificate"}}},
+	}}}
+
+	for _, test := range []struct {
+		name       string
+		required   []schema.GroupKind
+		wantErrors []string
+	}{
+		{name: "group served", required: []schema.GroupKind{{Group: "cert-manager.io"}}},
+		{name: "kind served", required: []schema.GroupKind{{Group: "cert-manager.io", Kind: "Certificate"}, {Kind: "ConfigMap"}}},
+		{
+			name:     "missing",
+			required: []schema.GroupKind{{Group: "cert-manager.io", Kind: "Issuer"}, {Group: "monitoring.coreos.com"}},
+			wantErrors: []string{
+				"required API Issuer.cert-manager.io is not served by the cluster",
+				"required API monitoring.coreos.com is not served by the cluster",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			addon := &unstructured.Unstructured{}
+			addon.SetAPIVersion("addons.example.org/v1alpha1")
+			addon.SetKind("Dashboard")
+			addon.SetNamespace("kube-system")
+			addon.SetName("dashboard")
+			c := fake.NewClientBuilder().WithObjects(addon).Build()
+
+			err := NewRequiredAPIsCheck(c, server, test.required...).Preflight(ctx, addon)
+			if len(test.wantErrors) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error for the missing APIs")
+			}
+
+			updated := &unstructured.Unstructured{}
+			updated.SetGroupVersionKind(addon.GroupVersionKind())
+			if err := c.Get(ctx, types.NamespacedName{Namespace: "kube-system", Name: "dashboard"}, updated); err != nil {
+				t.Fatalf("error getting addon: %v", err)
+			}
+			errors, _, _ := unstructured.NestedStringSlice(updated.Object, "status", "errors")
+			if !reflect.DeepEqual(errors, test.wantErrors) {
+				t.Errorf("unexpected status errors %v, want %v", errors, test.wantErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrades
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/loaders"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/utils"
+)
+
+// DefaultPollInterval is how often channels are polled, unless another interval is given to NewChannelPoller
+var DefaultPollInterval = 5 * time.Minute
+
+// LatestVersionResolver returns the latest version of the channel of an addon object.
+// loaders.ManifestLoader implements it with LatestVersion.
+type LatestVersionResolver interface {
+	LatestVersion(ctx context.Context, object runtime.Object) (string, error)
+}
+
+// ChannelPoller polls the channels of the addon objects of a kind for new versions.  Objects tracking their
+// channel, with no spec.version, are reconciled as soon as the latest version of the channel changes, so they are
+// upgraded.  Objects pinned to a version get the newer version of their channel in status.availableVersion, so
+// upgrades are visible without being applied.
+type ChannelPoller struct {
+	client   client.Client
+	resolver LatestVersionResolver
+	gvk      schema.GroupVersionKind
+	interval time.Duration
+	events   chan event.GenericEvent
+	// watched is set by Watch, objects are only reconciled once a controller receives the events
+	watched bool
+
+	mu sync.Mutex
+	// latest is the latest version of the channel of each object, when last polled
+	latest map[types.NamespacedName]string
+}
+
+// NewChannelPoller returns a ChannelPoller of the addon objects of kind gvk, polling every interval, or
+// DefaultPollInterval if interval is 0.  Add it to the manager to start polling, and call Watch with the controller
+// of the addon.
+func NewChannelPoller(client client.Client, resolver LatestVersionResolver, gvk schema.GroupVersionKind, interval time.Duration) *ChannelPoller {
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+	return &ChannelPoller{
+		client:   client,
+		resolver: resolver,
+		gvk:      gvk,
+		interval: interval,
+		events:   make(chan event.GenericEvent),
+		latest:   make(map[types.NamespacedName]string),
+	}
+}
+
+// Watch creates a watch on ctrl, reconciling the objects tracking a channel when a new version is published
+func (p *ChannelPoller) Watch(ctrl controller.Controller) error {
+	src := &source.Channel{Source: p.events}
+	// The controller has no concept of shutdown, so the channel is never stopped
+	src.InjectStopChannel(make(chan struct{}))
+	if err := ctrl.Watch(src, &handler.EnqueueRequestForObject{}); err != nil {
+		return fmt.Errorf("setting up watch for channel updates: %v", err)
+	}
+	p.watched = true
+	return nil
+}
+
+// Start polls the channels every interval until ctx is done, implementing manager.Runnable
+func (p *ChannelPoller) Start(ctx context.Context) error {
+	log := log.FromContext(ctx)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Poll(ctx); err != nil {
+			log.Error(err, "polling channels")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll checks the channel of each addon object once, reconciling the objects tracking channels that have a new
+// latest version and updating status.availableVersion of the others
+func (p *ChannelPoller) Poll(ctx context.Context) error {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(p.gvk.GroupVersion().WithKind(p.gvk.Kind + "List"))
+	if err := p.client.List(ctx, list); err != nil {
+		return fmt.Errorf("error listing %s objects: %v", p.gvk.Kind, err)
+	}
+
+	seen := make(map[types.NamespacedName]bool)
+	var errs []error
+	for i := range list.Items {
+		object := &list.Items[i]
+		name := types.NamespacedName{Namespace: object.GetNamespace(), Name: object.GetName()}
+		seen[name] = true
+		if err := p.pollObject(ctx, name, object); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	p.mu.Lock()
+	for name := range p.latest {
+		if !seen[name] {
+			delete(p.latest, name)
+		}
+	}
+	p.mu.Unlock()
+
+	return utilerrors.NewAggregate(errs)
+}
+
+func (p *ChannelPoller) pollObject(ctx context.Context, name types.NamespacedName, object *unstructured.Unstructured) error {
+	log := log.FromContext(ctx).WithValues("object", name.String())
+
+	spec, err := utils.GetCommonSpec(object)
+	if err != nil {
+		return err
+	}
+	latest, err := p.resolver.LatestVersion(ctx, object)
+	if err != nil {
+		return fmt.Errorf("error resolving latest version: %w", err)
+	}
+
+	p.mu.Lock()
+	previous, polled := p.latest[name]
+	p.latest[name] = latest
+	p.mu.Unlock()
+
+	if spec.Version == "" && polled && previous != latest && p.watched {
+		log.WithValues("version", latest).Info("channel has a new version, upgrading")
+		select {
+		case p.events <- event.GenericEvent{Object: object}:
+		case <-ctx.Done():
+			// The next poll reconciles the object
+			p.mu.Lock()
+			p.latest[name] = previous
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+
+	var available string
+	if spec.Version != "" && (&loaders.Version{Version: latest}).Compare(&loaders.Version{Version: spec.Version}) > 0 {
+		available = latest
+	}
+	// Only the field is changed, as the status of the object can have fields other than the CommonStatus
+	current, _, err := unstructured.NestedString(object.Object, "status", "availableVersion")
+	if err != nil {
+		return fmt.Errorf("error reading status.availableVersion: %v", err)
+	}
+	if current == available {
+		return nil
+	}
+	if available != "" {
+		log.WithValues("version", spec.Version).WithValues("available", available).Info("newer version available")
+		if err := unstructured.SetNestedField(object.Object, available, "status", "availableVersion"); err != nil {
+			return err
+		}
+	} else {
+		unstructured.RemoveNestedField(object.Object, "status", "availableVersion")
+	}
+	if err := p.client.Status().Update(ctx, object); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrades
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// fakeChannel always resolves to version
+type fakeChannel struct {
+	version string
+}
+
+func (c *fakeChannel) LatestVersion(ctx context.Context, object runtime.Object) (string, error) {
+	return c.version, nil
+}
+
+func newDashboard(name, version string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("addons.example.org/v1alpha1")
+	u.SetKind("Dashboard")
+	u.SetNamespace("kube-system")
+	u.SetName(name)
+	if version != "" {
+		_ = unstructured.SetNestedField(u.Object, version, "spec", "version")
+	}
+	_ = unstructured.SetNestedField(u.Object, "custom", "status", "custom")
+	return u
+}
+
+func TestChannelPoller(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "addons.example.org", Version: "v1alpha1", Kind: "Dashboard"}
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind("DashboardList"), &unstructured.UnstructuredList{})
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(newDashboard("tracking", ""), newDashboard("pinned", "1.0.0")).Build()
+	channel := &fakeChannel{version: "1.0.0"}
+
+	poller := NewChannelPoller(c, channel, gvk, 0)
+	poller.watched = true
+	poller.events = make(chan event.GenericEvent, 10)
+
+	getStatus := func(name string) map[string]interface{} {
+		t.Helper()
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		if err := c.Get(ctx, types.NamespacedName{Namespace: "kube-system", Name: name}, u); err != nil {
+			t.Fatalf("error getting %s: %v", name, err)
+		}
+		status, _, _ := unstructured.NestedMap(u.Object, "status")
+		return status
+	}
+
+	if err := poller.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(poller.events) != 0 {
+		t.Errorf("unexpected reconcile on first poll")
+	}
+	if status := getStatus("pinned"); status["availableVersion"] != nil {
+		t.Errorf("unexpected available version %v", status["availableVersion"])
+	}
+
+	// A new version reconciles the tracking object, and is available to the pinned object
+	channel.version = "1.1.0"
+	if err := poller.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(poller.events) != 1 {
+		t.Fatalf("expected 1 reconcile, got %d", len(poller.events))
+	}
+	if e := <-poller.events; e.Object.GetName() != "tracking" {
+		t.Errorf("unexpected reconcile of %s", e.Object.GetName())
+	}
+	status := getStatus("pinned")
+	if status["availableVersion"] != "1.1.0" {
+		t.Errorf("unexpected available version %v", status["availableVersion"])
+	}
+	if status["custom"] != "custom" {
+		t.Errorf("expected other status fields to be kept, got %v", status)
+	}
+	if status := getStatus("tracking"); status["availableVersion"] != nil {
+		t.Errorf("unexpected available version %v for tracking object", status["availableVersion"])
+	}
+
+	// Unchanged channels don't reconcile again
+	if err := poller.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(poller.events) != 0 {
+		t.Errorf("unexpected reconcile of unchanged channel")
+	}
+
+	// The available version is removed if the channel goes back
+	channel.version = "1.0.0"
+	if err := poller.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := getStatus("pinned"); status["availableVersion"] != nil {
+		t.Errorf("unexpected available version %v", status["availableVersion"])
+	}
+}
+
+func TestChannelPollerStopsWhenCancelled(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "addons.example.org", Version: "v1alpha1", Kind: "Dashboard"}
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind("DashboardList"), &unstructured.UnstructuredList{})
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(newDashboard("tracking", "")).Build()
+	channel := &fakeChannel{version: "1.0.0"}
+
+	// No controller receives the events
+	poller := NewChannelPoller(c, channel, gvk, 0)
+	poller.watched = true
+	if err := poller.Poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	channel.version = "1.1.0"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan error)
+	go func() { done <- poller.Poll(ctx) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected an error when the context is done")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the poll to stop when the context is done")
+	}
+
+	// The object is reconciled by the next poll
+	poller.events = make(chan event.GenericEvent, 10)
+	if err := poller.Poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(poller.events) != 1 {
+		t.Errorf("expected 1 reconcile, got %d", len(poller.events))
+	}
+}
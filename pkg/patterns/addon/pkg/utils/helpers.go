@@ -39,7 +39,7 @@ func SetCommonStatus(instance runtime.Object, status addonsv1alpha1.CommonStatus
 	case addonsv1alpha1.CommonObject:
 		v.SetCommonStatus(status)
 	case *unstructured.Unstructured:
-		unstructStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+		unstructStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
 		if err != nil {
 			return fmt.Errorf("unable to convert unstructured to addonStatus: %v", err)
 		}
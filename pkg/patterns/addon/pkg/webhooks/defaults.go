@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	addonsv1alpha1 "sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/apis/v1alpha1"
+)
+
+// ResolvedFromChannelAnnotation is set by the defaulting webhook to the channel spec.version was resolved from
+const ResolvedFromChannelAnnotation = "addons.k8s.io/resolved-from-channel"
+
+// DefaultChannel is the channel set by the defaulting webhook when none is given, as used by the manifest loaders
+const DefaultChannel = "stable"
+
+// VersionResolver resolves the version of the manifest of an addon object from its channel.
+// loaders.ManifestLoader implements it with ResolveVersion.
+type VersionResolver interface {
+	ResolveVersion(ctx context.Context, object runtime.Object) (string, error)
+}
+
+// NewDefaultingWebhook returns an admission webhook defaulting the CommonSpec of addon objects of the kind of
+// prototype when they are created or updated.  An empty spec.channel is set to channel, or DefaultChannel if
+// channel is "", and an empty spec.version is set to the current version of the channel, pinning the object to
+// that version so later updates of the channel don't change what is deployed.  The channel the version was
+// resolved from is recorded in the ResolvedFromChannelAnnotation.  To upgrade, set spec.version, or clear it to
+// pin the current version of the channel again.
+func NewDefaultingWebhook(prototype addonsv1alpha1.CommonObject, resolver VersionResolver, channel string) *admission.Webhook {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &admission.Webhook{Handler: &defaulter{prototype: prototype, resolver: resolver, channel: channel}}
+}
+
+type defaulter struct {
+	prototype addonsv1alpha1.CommonObject
+	resolver  VersionResolver
+	channel   string
+}
+
+func (d *defaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	object, err := decodeObject(d.prototype, req.Object.Raw)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	spec := object.CommonSpec()
+	if spec.Channel != "" && spec.Version != "" {
+		return admission.Allowed("")
+	}
+
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("error decoding object: %v", err))
+	}
+	channel := spec.Channel
+	if channel == "" {
+		channel = d.channel
+		if err := unstructured.SetNestedField(u.Object, channel, "spec", "channel"); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+	if spec.Version == "" {
+		// Resolve the version of the defaulted channel
+		raw, err := json.Marshal(u.Object)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		defaulted, err := decodeObject(d.prototype, raw)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		version, err := d.resolver.ResolveVersion(ctx, defaulted)
+		if err != nil {
+			return admission.Denied(fmt.Sprintf("unable to resolve the version of channel %q: %v", channel, err))
+		}
+		if err := unstructured.SetNestedField(u.Object, version, "spec", "version"); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		annotations := u.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[ResolvedFromChannelAnnotation] = channel
+		u.SetAnnotations(annotations)
+		log.FromContext(ctx).WithValues("object", req.Namespace+"/"+req.Name).WithValues("channel", channel).WithValues("version", version).V(1).Info("pinned version of channel")
+	}
+
+	raw, err := json.Marshal(u.Object)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, raw)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonsv1alpha1 "sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/apis/v1alpha1"
+)
+
+func TestDefaultingWebhook(t *testing.T) {
+	webhook := NewDefaultingWebhook(&testAddon{}, newTestLoader(t), "")
+
+	tests := []struct {
+		name    string
+		spec    addonsv1alpha1.CommonSpec
+		patches map[string]interface{}
+		allowed bool
+	}{
+		{
+			name: "empty spec",
+			patches: map[string]interface{}{
+				"/spec/channel": "stable",
+				"/spec/version": "1.3.0",
+				"/metadata/annotations": map[string]interface{}{
+					"addons.k8s.io/resolved-from-channel": "stable",
+				},
+			},
+			allowed: true,
+		},
+		{
+			name: "version set",
+			spec: addonsv1alpha1.CommonSpec{Version: "1.2.3"},
+			patches: map[string]interface{}{
+				"/spec/channel": "stable",
+			},
+			allowed: true,
+		},
+		{
+			name:    "channel and version set",
+			spec:    addonsv1alpha1.CommonSpec{Channel: "stable", Version: "1.2.3"},
+			patches: map[string]interface{}{},
+			allowed: true,
+		},
+		{
+			name:    "missing channel",
+			spec:    addonsv1alpha1.CommonSpec{Channel: "beta"},
+			patches: map[string]interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := &testAddon{
+				TypeMeta: metav1.TypeMeta{APIVersion: "addons.example.org/v1alpha1", Kind: "Guestbook"},
+				Spec:     test.spec,
+			}
+			response := webhook.Handle(context.Background(), admissionRequest(t, admissionv1.Create, object, nil))
+			if response.Allowed != test.allowed {
+				t.Fatalf("expected allowed %v, got %v: %v", test.allowed, response.Allowed, response.Result)
+			}
+			patches := make(map[string]interface{})
+			for _, patch := range response.Patches {
+				patches[patch.Path] = patch.Value
+			}
+			if !reflect.DeepEqual(patches, test.patches) {
+				t.Errorf("unexpected patches %v, expected %v", patches, test.patches)
+			}
+		})
+	}
+}
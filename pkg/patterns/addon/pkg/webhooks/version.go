@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	addonsv1alpha1 "sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/apis/v1alpha1"
+)
+
+// VersionValidator checks the channel and version of an addon object exist.  loaders.ManifestLoader implements
+// it with ValidateVersion.
+type VersionValidator interface {
+	ValidateVersion(ctx context.Context, object runtime.Object) error
+}
+
+// NewVersionValidationWebhook returns an admission webhook rejecting creates and updates of addon objects of the
+// kind of prototype whose channel or version doesn't exist in the manifests of validator, so mistakes are reported
+// to the user immediately rather than by the reconcile.  Updates not changing the channel or version are allowed,
+// so objects of versions since removed can still be updated.  Register it with the webhook server of the manager,
+// eg mgr.GetWebhookServer().Register("/validate-addon-version", webhook).
+func NewVersionValidationWebhook(prototype addonsv1alpha1.CommonObject, validator VersionValidator) *admission.Webhook {
+	return &admission.Webhook{Handler: &versionValidator{prototype: prototype, validator: validator}}
+}
+
+type versionValidator struct {
+	prototype addonsv1alpha1.CommonObject
+	validator VersionValidator
+}
+
+func (v *versionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	object, err := decodeObject(v.prototype, req.Object.Raw)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if req.Operation == admissionv1.Update {
+		old, err := decodeObject(v.prototype, req.OldObject.Raw)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if versionUnchanged(object, old) {
+			return admission.Allowed("")
+		}
+	}
+
+	if err := v.validator.ValidateVersion(ctx, object); err != nil {
+		log.FromContext(ctx).WithValues("object", req.Namespace+"/"+req.Name).V(1).Info("rejecting object", "error", err.Error())
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+// decodeObject decodes raw into a copy of prototype
+func decodeObject(prototype addonsv1alpha1.CommonObject, raw []byte) (addonsv1alpha1.CommonObject, error) {
+	object, ok := prototype.DeepCopyObject().(addonsv1alpha1.CommonObject)
+	if !ok {
+		return nil, fmt.Errorf("prototype %T is not a CommonObject", prototype)
+	}
+	if err := json.Unmarshal(raw, object); err != nil {
+		return nil, fmt.Errorf("error decoding object: %v", err)
+	}
+	return object, nil
+}
+
+// versionUnchanged returns true if object and old have the same channel and version
+func versionUnchanged(object, old addonsv1alpha1.CommonObject) bool {
+	spec, oldSpec := object.CommonSpec(), old.CommonSpec()
+	return spec.Channel == oldSpec.Channel && spec.Version == oldSpec.Version
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	addonsv1alpha1 "sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/apis/v1alpha1"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/loaders"
+)
+
+// testAddon is a minimal addon object
+type testAddon struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              addonsv1alpha1.CommonSpec   `json:"spec,omitempty"`
+	Status            addonsv1alpha1.CommonStatus `json:"status,omitempty"`
+}
+
+func (o *testAddon) ComponentName() string                         { return "guestbook" }
+func (o *testAddon) CommonSpec() addonsv1alpha1.CommonSpec         { return o.Spec }
+func (o *testAddon) GetCommonStatus() addonsv1alpha1.CommonStatus  { return o.Status }
+func (o *testAddon) SetCommonStatus(s addonsv1alpha1.CommonStatus) { o.Status = s }
+func (o *testAddon) DeepCopyObject() runtime.Object {
+	out := *o
+	o.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	o.Status.DeepCopyInto(&out.Status)
+	return &out
+}
+
+// newTestLoader returns a ManifestLoader of a filesystem channel with versions 1.2.3 and 1.3.0 of guestbook in the
+// stable channel
+func newTestLoader(t *testing.T) *loaders.ManifestLoader {
+	baseDir := t.TempDir()
+	files := map[string]string{
+		"stable":                                 "manifests:\n- version: 1.2.3\n- version: 1.3.0\n",
+		"packages/guestbook/1.2.3/manifest.yaml": "kind: Deployment\n",
+		"packages/guestbook/1.3.0/manifest.yaml": "kind: Deployment\n",
+	}
+	for name, contents := range files {
+		p := filepath.Join(baseDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+	loader, err := loaders.NewManifestLoader(baseDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return loader
+}
+
+func admissionRequest(t *testing.T, operation admissionv1.Operation, object, old *testAddon) admission.Request {
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: operation, Name: "test", Namespace: "default"}}
+	var err error
+	if req.Object.Raw, err = json.Marshal(object); err != nil {
+		t.Fatalf("error encoding object: %v", err)
+	}
+	if old != nil {
+		if req.OldObject.Raw, err = json.Marshal(old); err != nil {
+			t.Fatalf("error encoding old object: %v", err)
+		}
+	}
+	return req
+}
+
+func TestVersionValidationWebhook(t *testing.T) {
+	webhook := NewVersionValidationWebhook(&testAddon{}, newTestLoader(t))
+
+	tests := []struct {
+		name      string
+		operation admissionv1.Operation
+		spec      addonsv1alpha1.CommonSpec
+		oldSpec   *addonsv1alpha1.CommonSpec
+		allowed   bool
+	}{
+		{name: "default channel", operation: admissionv1.Create, allowed: true},
+		{name: "existing version", operation: admissionv1.Create, spec: addonsv1alpha1.CommonSpec{Version: "1.2.3"}, allowed: true},
+		{name: "existing channel", operation: admissionv1.Create, spec: addonsv1alpha1.CommonSpec{Channel: "stable"}, allowed: true},
+		{name: "missing version", operation: admissionv1.Create, spec: addonsv1alpha1.CommonSpec{Version: "9.9.9"}},
+		{name: "missing channel", operation: admissionv1.Create, spec: addonsv1alpha1.CommonSpec{Channel: "beta"}},
+		{
+			name:      "update to missing version",
+			operation: admissionv1.Update,
+			spec:      addonsv1alpha1.CommonSpec{Version: "9.9.9"},
+			oldSpec:   &addonsv1alpha1.CommonSpec{Version: "1.2.3"},
+		},
+		{
+			name:      "update of removed version",
+			operation: admissionv1.Update,
+			spec:      addonsv1alpha1.CommonSpec{Version: "1.0.0", Paused: true},
+			oldSpec:   &addonsv1alpha1.CommonSpec{Version: "1.0.0"},
+			allowed:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := &testAddon{Spec: test.spec}
+			var old *testAddon
+			if test.oldSpec != nil {
+				old = &testAddon{Spec: *test.oldSpec}
+			}
+			response := webhook.Handle(context.Background(), admissionRequest(t, test.operation, object, old))
+			if response.Allowed != test.allowed {
+				t.Errorf("expected allowed %v, got %v: %v", test.allowed, response.Allowed, response.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// ConditionWaitingForDependency is true while a DeclarativeObject waits for the addons it depends on to become
+	// ready, with WithAddonDependencies
+	ConditionWaitingForDependency = "WaitingForDependency"
+	// ReasonDependencyNotReady is the reason for a true ConditionWaitingForDependency
+	ReasonDependencyNotReady = "DependencyNotReady"
+)
+
+// dependencyRecheckInterval is how often the dependencies of a waiting DeclarativeObject are checked again, in case
+// they aren't watched
+var dependencyRecheckInterval = 30 * time.Second
+
+// AddonDependency is an addon object that must be ready before a DeclarativeObject is reconciled
+type AddonDependency struct {
+	schema.GroupVersionKind
+	types.NamespacedName
+}
+
+func (d AddonDependency) String() string {
+	if d.Namespace == "" {
+		return d.Kind + " " + d.Name
+	}
+	return d.Kind + " " + d.Namespace + "/" + d.Name
+}
+
+// AddonDependencies returns the addon objects instance depends on
+type AddonDependencies = func(ctx context.Context, instance DeclarativeObject) ([]AddonDependency, error)
+
+// DependsOn returns AddonDependencies always returning dependencies, eg cert-manager for an operator needing
+// certificates
+func DependsOn(dependencies ...AddonDependency) AddonDependencies {
+	return func(ctx context.Context, instance DeclarativeObject) ([]AddonDependency, error) {
+		return dependencies, nil
+	}
+}
+
+// isAddonReady returns true if the Ready condition of the addon object u is true, or, for addons with no
+// conditions, if status.healthy is true
+func isAddonReady(u *unstructured.Unstructured) (bool, error) {
+	conditions, err := conditionsFromMap(u.Object)
+	if err != nil {
+		return false, err
+	}
+	if len(conditions) != 0 {
+		return meta.IsStatusConditionTrue(conditions, ConditionReady), nil
+	}
+	healthy, _, err := unstructured.NestedBool(u.Object, "status", "healthy")
+	if err != nil {
+		return false, fmt.Errorf("error reading status.healthy: %v", err)
+	}
+	return healthy, nil
+}
+
+// notReadyDependencies returns the descriptions of the dependencies of instance that don't exist or aren't ready
+func (r *Reconciler) notReadyDependencies(ctx context.Context, dependencies []AddonDependency) ([]string, error) {
+	var notReady []string
+	for _, dependency := range dependencies {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(dependency.GroupVersionKind)
+		if err := r.client.Get(ctx, dependency.NamespacedName, u); err != nil {
+			if apierrors.IsNotFound(err) {
+				notReady = append(notReady, dependency.String()+" does not exist")
+				continue
+			}
+			return nil, fmt.Errorf("error getting %s: %v", dependency, err)
+		}
+		ready, err := isAddonReady(u)
+		if err != nil {
+			return nil, fmt.Errorf("error checking %s: %v", dependency, err)
+		}
+		if !ready {
+			notReady = append(notReady, dependency.String()+" is not ready")
+		}
+	}
+	return notReady, nil
+}
+
+// checkAddonDependencies returns false if instance must wait for its dependencies, reporting them in
+// ConditionWaitingForDependency
+func (r *Reconciler) checkAddonDependencies(ctx context.Context, instance DeclarativeObject) (bool, error) {
+	log := log.FromContext(ctx)
+	name := types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}
+
+	dependencies, err := r.options.addonDependencies(ctx, instance)
+	if err != nil {
+		return false, fmt.Errorf("error listing dependencies: %w", err)
+	}
+	r.dependencies.set(name, dependencies)
+
+	notReady, err := r.notReadyDependencies(ctx, dependencies)
+	if err != nil {
+		return false, err
+	}
+
+	var changed bool
+	if len(notReady) != 0 {
+		message := "Waiting for " + strings.Join(notReady, ", ")
+		changed, err = setCondition(instance, metav1.Condition{
+			Type:               ConditionWaitingForDependency,
+			Status:             metav1.ConditionTrue,
+			Reason:             ReasonDependencyNotReady,
+			Message:            message,
+			ObservedGeneration: instance.GetGeneration(),
+		})
+		if changed && r.recorder != nil {
+			r.recorder.Event(instance, "Normal", ReasonDependencyNotReady, message)
+		}
+	} else {
+		changed, err = removeCondition(instance, ConditionWaitingForDependency, ReasonDependencyNotReady)
+	}
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return false, fmt.Errorf("error updating status: %v", err)
+		}
+	}
+
+	if len(notReady) != 0 {
+		log.WithValues("dependencies", strings.Join(notReady, ", ")).Info("waiting for dependencies")
+		return false, nil
+	}
+	return true, nil
+}
+
+// dependencyTracker records the addon dependencies of each DeclarativeObject
+type dependencyTracker struct {
+	mu           sync.Mutex
+	dependencies map[types.NamespacedName][]AddonDependency
+}
+
+func newDependencyTracker() *dependencyTracker {
+	return &dependencyTracker{dependencies: make(map[types.NamespacedName][]AddonDependency)}
+}
+
+func (t *dependencyTracker) set(instance types.NamespacedName, dependencies []AddonDependency) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(dependencies) == 0 {
+		delete(t.dependencies, instance)
+		return
+	}
+	t.dependencies[instance] = dependencies
+}
+
+// dependents returns the DeclarativeObjects depending on the named object of kind gk
+func (t *dependencyTracker) dependents(gk schema.GroupKind, name types.NamespacedName) []reconcile.Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var requests []reconcile.Request
+	for instance, dependencies := range t.dependencies {
+		for _, dependency := range dependencies {
+			if dependency.GroupVersionKind.GroupKind() == gk && dependency.NamespacedName == name {
+				requests = append(requests, reconcile.Request{NamespacedName: instance})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// WatchAddonDependencies creates watches on ctrl for the addon objects of kinds, so that DeclarativeObjects
+// waiting for them with WithAddonDependencies are reconciled as soon as they change
+func WatchAddonDependencies(ctrl controller.Controller, r *Reconciler, kinds ...schema.GroupVersionKind) error {
+	for _, gvk := range kinds {
+		gk := gvk.GroupKind()
+		mapFn := handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			return r.dependencies.dependents(gk, types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()})
+		})
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		if err := ctrl.Watch(&source.Kind{Type: u}, mapFn); err != nil {
+			return fmt.Errorf("setting up watch on %s: %v", gvk.Kind, err)
+		}
+	}
+	return nil
+}
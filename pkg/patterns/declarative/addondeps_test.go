@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCheckAddonDependencies(t *testing.T) {
+	ctx := context.Background()
+	certManagerKind := schema.GroupVersionKind{Group: "addons.example.org", Version: "v1alpha1", Kind: "CertManager"}
+	certManager := &unstructured.Unstructured{}
+	certManager.SetGroupVersionKind(certManagerKind)
+	certManager.SetNamespace("kube-system")
+	certManager.SetName("cert-manager")
+	dependency := AddonDependency{
+		GroupVersionKind: certManagerKind,
+		NamespacedName:   types.NamespacedName{Namespace: "kube-system", Name: "cert-manager"},
+	}
+
+	instance := newGuestbook("default", "test", time.Now())
+	c := fake.NewClientBuilder().WithObjects(instance).Build()
+	r := &Reconciler{
+		client:       c,
+		dependencies: newDependencyTracker(),
+		options:      reconcilerParams{addonDependencies: DependsOn(dependency)},
+	}
+
+	expectWaiting := func(message string) {
+		t.Helper()
+		ok, err := r.checkAddonDependencies(ctx, instance)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ok != (message == "") {
+			t.Errorf("unexpected result %v", ok)
+		}
+		conditions, _, err := getConditions(instance)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		condition := meta.FindStatusCondition(conditions, ConditionWaitingForDependency)
+		if message == "" {
+			if condition != nil {
+				t.Errorf("unexpected condition %v", condition)
+			}
+		} else if condition == nil || condition.Reason != ReasonDependencyNotReady || condition.Message != message {
+			t.Errorf("unexpected condition %v, expected message %q", condition, message)
+		}
+	}
+
+	expectWaiting("Waiting for CertManager kube-system/cert-manager does not exist")
+
+	// The dependency is tracked, for watching
+	requests := r.dependencies.dependents(certManagerKind.GroupKind(), dependency.NamespacedName)
+	if len(requests) != 1 || requests[0].Name != "test" {
+		t.Errorf("expected test to be tracked as depending on cert-manager, got %v", requests)
+	}
+
+	if err := c.Create(ctx, certManager); err != nil {
+		t.Fatalf("error creating dependency: %v", err)
+	}
+	expectWaiting("Waiting for CertManager kube-system/cert-manager is not ready")
+
+	// Addons with no conditions are ready when healthy
+	if err := unstructured.SetNestedField(certManager.Object, true, "status", "healthy"); err != nil {
+		t.Fatalf("error setting status: %v", err)
+	}
+	if err := c.Update(ctx, certManager); err != nil {
+		t.Fatalf("error updating dependency: %v", err)
+	}
+	expectWaiting("")
+
+	// The Ready condition takes precedence
+	if err := unstructured.SetNestedSlice(certManager.Object, []interface{}{
+		map[string]interface{}{"type": ConditionReady, "status": "False", "reason": ReasonProgressing, "message": "", "lastTransitionTime": "2021-01-01T00:00:00Z"},
+	}, "status", "conditions"); err != nil {
+		t.Fatalf("error setting status: %v", err)
+	}
+	if err := c.Update(ctx, certManager); err != nil {
+		t.Fatalf("error updating dependency: %v", err)
+	}
+	expectWaiting("Waiting for CertManager kube-system/cert-manager is not ready")
+}
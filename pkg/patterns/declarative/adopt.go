@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// AdoptionPolicy decides whether objects in the manifest which already exist, but aren't managed by the
+// DeclarativeObject, are adopted with WithAdoption
+type AdoptionPolicy string
+
+const (
+	// AdoptNone never adopts existing objects
+	AdoptNone AdoptionPolicy = "None"
+	// AdoptAnnotated adopts existing objects annotated with AdoptAnnotation, or all existing objects if the
+	// DeclarativeObject is annotated with AdoptAnnotation
+	AdoptAnnotated AdoptionPolicy = "Annotated"
+	// AdoptAll adopts all existing objects which aren't controlled by another owner
+	AdoptAll AdoptionPolicy = "All"
+
+	// AdoptAnnotation set to "true" allows existing objects to be adopted with AdoptAnnotated
+	AdoptAnnotation = "addons.k8s.io/adopt"
+	// ManagedByAnnotation is set on the objects applied with WithAdoption, identifying the DeclarativeObject
+	// managing them
+	ManagedByAnnotation = "addons.k8s.io/managed-by"
+
+	// ReasonAdopted is the reason for the event recorded when an existing object is adopted
+	ReasonAdopted = "Adopted"
+)
+
+// annotateManaged sets ManagedByAnnotation on objects, to identify the objects managed by instance
+func (r *Reconciler) annotateManaged(instance DeclarativeObject, objects []*manifest.Object) error {
+	gvk, err := apiutil.GVKForObject(instance, r.client.Scheme())
+	if err != nil {
+		return err
+	}
+	id := instanceID(instance, gvk)
+	for _, o := range objects {
+		annotations := o.UnstructuredObject().GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[ManagedByAnnotation] = id
+		if err := o.SetNestedStringMap(annotations, "metadata", "annotations"); err != nil {
+			return fmt.Errorf("error annotating %s %s: %v", o.Kind, o.Name, err)
+		}
+	}
+	return nil
+}
+
+// isManaged returns true if the object in the cluster is managed by instance: it is annotated as managed by
+// instance, is owned by instance, or has the labels of instance
+func (r *Reconciler) isManaged(ctx context.Context, instance DeclarativeObject, id string, u *unstructured.Unstructured) bool {
+	if u.GetAnnotations()[ManagedByAnnotation] == id {
+		return true
+	}
+	for _, ref := range u.GetOwnerReferences() {
+		if ref.UID == instance.GetUID() {
+			return true
+		}
+	}
+	labels := r.labelsFor(ctx, instance)
+	if len(labels) == 0 {
+		return false
+	}
+	for k, v := range labels {
+		if u.GetLabels()[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// canAdopt returns true if the policy allows the object in the cluster to be adopted by instance
+func (r *Reconciler) canAdopt(instance DeclarativeObject, u *unstructured.Unstructured) bool {
+	if controller := metav1.GetControllerOf(u); controller != nil {
+		// Controlled by something else
+		return false
+	}
+	switch r.options.adoptionPolicy {
+	case AdoptAll:
+		return true
+	case AdoptAnnotated:
+		return instance.GetAnnotations()[AdoptAnnotation] == "true" || u.GetAnnotations()[AdoptAnnotation] == "true"
+	default:
+		return false
+	}
+}
+
+// checkAdoption checks that the existing objects are managed by instance or can be adopted, returning an error
+// listing the objects that can't be adopted.  Objects that are adopted are reported with an event.
+func (r *Reconciler) checkAdoption(ctx context.Context, instance DeclarativeObject, existing []*unstructured.Unstructured) error {
+	log := log.FromContext(ctx)
+
+	gvk, err := apiutil.GVKForObject(instance, r.client.Scheme())
+	if err != nil {
+		return err
+	}
+	id := instanceID(instance, gvk)
+
+	var conflicts []string
+	for _, u := range existing {
+		if r.isManaged(ctx, instance, id, u) {
+			continue
+		}
+		name := fmt.Sprintf("%s %s", u.GetKind(), u.GetName())
+		if u.GetNamespace() != "" {
+			name = fmt.Sprintf("%s %s/%s", u.GetKind(), u.GetNamespace(), u.GetName())
+		}
+		if !r.canAdopt(instance, u) {
+			conflicts = append(conflicts, name)
+			continue
+		}
+		log.WithValues("object", name).Info("adopting existing object")
+		if r.recorder != nil {
+			r.recorder.Eventf(instance, "Normal", ReasonAdopted, "Adopted existing %s", name)
+		}
+	}
+	if len(conflicts) != 0 {
+		return fmt.Errorf("objects already exist and are not managed by %s %s, annotate them with %s=true to adopt them: %s",
+			gvk.Kind, instance.GetName(), AdoptAnnotation, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCheckAdoption(t *testing.T) {
+	ctx := context.Background()
+
+	configMap := func(annotations map[string]string, labels map[string]string, owners ...metav1.OwnerReference) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("ConfigMap")
+		u.SetNamespace("default")
+		u.SetName("config")
+		u.SetAnnotations(annotations)
+		u.SetLabels(labels)
+		u.SetOwnerReferences(owners)
+		return u
+	}
+	controller := true
+	id := instanceID(newGuestbook("default", "test", time.Now()), schema.GroupVersionKind{Group: "addons.example.org", Version: "v1alpha1", Kind: "Guestbook"})
+
+	tests := []struct {
+		name        string
+		policy      AdoptionPolicy
+		adoptAll    bool
+		existing    *unstructured.Unstructured
+		expectError bool
+	}{
+		{name: "managed", policy: AdoptNone, existing: configMap(map[string]string{ManagedByAnnotation: id}, nil)},
+		{name: "owned", policy: AdoptNone, existing: configMap(nil, nil, metav1.OwnerReference{UID: "test-uid"})},
+		{name: "labelled", policy: AdoptNone, existing: configMap(nil, map[string]string{"app": "guestbook"})},
+		{name: "not managed", policy: AdoptNone, existing: configMap(nil, nil), expectError: true},
+		{name: "not annotated", policy: AdoptAnnotated, existing: configMap(nil, nil), expectError: true},
+		{name: "annotated", policy: AdoptAnnotated, existing: configMap(map[string]string{AdoptAnnotation: "true"}, nil)},
+		{name: "instance annotated", policy: AdoptAnnotated, adoptAll: true, existing: configMap(nil, nil)},
+		{name: "adopt all", policy: AdoptAll, existing: configMap(nil, nil)},
+		{name: "controlled by another owner", policy: AdoptAll, existing: configMap(nil, nil, metav1.OwnerReference{UID: "other", Controller: &controller}), expectError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{client: fake.NewClientBuilder().Build()}
+			r.options = WithAdoption(test.policy)(r.options)
+			r.options = WithLabels(func(ctx context.Context, instance DeclarativeObject) map[string]string {
+				return map[string]string{"app": "guestbook"}
+			})(r.options)
+
+			instance := newGuestbook("default", "test", time.Now())
+			instance.SetUID(types.UID("test-uid"))
+			if test.adoptAll {
+				instance.SetAnnotations(map[string]string{AdoptAnnotation: "true"})
+			}
+
+			err := r.checkAdoption(ctx, instance, []*unstructured.Unstructured{test.existing})
+			if test.expectError {
+				if err == nil || !strings.Contains(err.Error(), "ConfigMap default/config") {
+					t.Errorf("expected a conflict for the configmap, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestReconcileChecksAdoptionOfObjectsInApplyNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	// The manifest doesn't set the namespace of the ConfigMap, so it is looked up in the namespace of the instance
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("ConfigMap")
+	existing.SetNamespace("default")
+	existing.SetName("config")
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	applier := &recordingApplier{}
+	r := &Reconciler{
+		kubectl:       applier,
+		client:        fake.NewClientBuilder().Build(),
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing),
+		restMapper:    mapper,
+	}
+	if err := r.applyOptions(
+		WithManifestController(staticManifest{"manifest.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"}),
+		WithAdoption(AdoptNone),
+	); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	instance := newGuestbook("default", "test", time.Now())
+	_, err := r.reconcileExists(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, instance)
+	if err == nil || !strings.Contains(err.Error(), "ConfigMap default/config") {
+		t.Errorf("expected a conflict for the existing configmap, got %v", err)
+	}
+	if len(applier.manifests) != 0 {
+		t.Errorf("expected the manifest not to be applied, got %v", applier.manifests)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// APIVersionRewrite rewrites objects of Kind from the apiVersion From to the apiVersion To
+type APIVersionRewrite struct {
+	Kind string
+	From string
+	To   string
+}
+
+// DefaultAPIVersionRewrites are the rewrites of deprecated API versions to the version replacing them, where
+// the objects have the same fields in both versions, so they are safe to rewrite without changing them.
+// PodDisruptionBudgets aren't rewritten from policy/v1beta1 to policy/v1, as an empty selector selects no pods
+// in policy/v1beta1 but all the pods of the namespace in policy/v1.
+var DefaultAPIVersionRewrites = []APIVersionRewrite{
+	{Kind: "CronJob", From: "batch/v1beta1", To: "batch/v1"},
+	{Kind: "HorizontalPodAutoscaler", From: "autoscaling/v2beta2", To: "autoscaling/v2"},
+	{Kind: "Role", From: "rbac.authorization.k8s.io/v1beta1", To: "rbac.authorization.k8s.io/v1"},
+	{Kind: "RoleBinding", From: "rbac.authorization.k8s.io/v1beta1", To: "rbac.authorization.k8s.io/v1"},
+	{Kind: "ClusterRole", From: "rbac.authorization.k8s.io/v1beta1", To: "rbac.authorization.k8s.io/v1"},
+	{Kind: "ClusterRoleBinding", From: "rbac.authorization.k8s.io/v1beta1", To: "rbac.authorization.k8s.io/v1"},
+	{Kind: "PriorityClass", From: "scheduling.k8s.io/v1beta1", To: "scheduling.k8s.io/v1"},
+	{Kind: "StorageClass", From: "storage.k8s.io/v1beta1", To: "storage.k8s.io/v1"},
+	{Kind: "Lease", From: "coordination.k8s.io/v1beta1", To: "coordination.k8s.io/v1"},
+	{Kind: "RuntimeClass", From: "node.k8s.io/v1beta1", To: "node.k8s.io/v1"},
+}
+
+// APIVersionRewriteTransform returns an ObjectTransform that rewrites the objects using an API version the
+// cluster doesn't serve to a version it serves, using the rewrites given or DefaultAPIVersionRewrites.  mapper
+// discovers the versions served, eg the RESTMapper of the manager.  Objects with no rewrite to a served version
+// are left unchanged, and fail to apply.
+func APIVersionRewriteTransform(mapper meta.RESTMapper, rewrites ...APIVersionRewrite) ObjectTransform {
+	if len(rewrites) == 0 {
+		rewrites = DefaultAPIVersionRewrites
+	}
+	return func(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+		log := log.FromContext(ctx)
+
+		for _, o := range objects.Items {
+			gvk := o.GroupVersionKind()
+			served, err := versionServed(mapper, gvk)
+			if err != nil {
+				return err
+			}
+			if served {
+				continue
+			}
+			for _, rewrite := range rewrites {
+				if rewrite.Kind != gvk.Kind || rewrite.From != gvk.GroupVersion().String() {
+					continue
+				}
+				to, err := schema.ParseGroupVersion(rewrite.To)
+				if err != nil {
+					return fmt.Errorf("error parsing apiVersion %q to rewrite %s to: %v", rewrite.To, gvk.Kind, err)
+				}
+				served, err := versionServed(mapper, to.WithKind(gvk.Kind))
+				if err != nil {
+					return err
+				}
+				if served {
+					log.WithValues("object", o.Kind+" "+o.Name).WithValues("from", rewrite.From).WithValues("to", rewrite.To).Info("rewriting API version not served by the cluster")
+					o.SetAPIVersion(rewrite.To)
+					break
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// versionServed returns whether the cluster serves gvk
+func versionServed(mapper meta.RESTMapper, gvk schema.GroupVersionKind) (bool, error) {
+	_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err == nil {
+		return true, nil
+	}
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("error discovering %s: %v", gvk, err)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestAPIVersionRewriteTransform(t *testing.T) {
+	inputManifest := `---
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: frontend
+spec:
+  minAvailable: 1
+---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  schedule: "@daily"
+---
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: frontend
+`
+	// The cluster serves policy/v1 and batch/v1, but not policy/v1beta1, batch/v1beta1, networking.k8s.io/v1beta1
+	// or its replacement
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{
+		{Group: "policy", Version: "v1", Kind: "PodDisruptionBudget"},
+		{Group: "batch", Version: "v1", Kind: "CronJob"},
+	} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, inputManifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := APIVersionRewriteTransform(mapper)(ctx, nil, objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var apiVersions []string
+	for _, o := range objects.Items {
+		apiVersions = append(apiVersions, o.Kind+" "+o.UnstructuredObject().GetAPIVersion())
+	}
+	// PodDisruptionBudgets aren't rewritten by default, as an empty selector selects all pods in policy/v1
+	expected := "PodDisruptionBudget policy/v1beta1, CronJob batch/v1, Ingress networking.k8s.io/v1beta1"
+	if actual := strings.Join(apiVersions, ", "); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	json, err := objects.Items[1].JSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(json), `"apiVersion":"batch/v1"`) || !strings.Contains(string(json), `"schedule":"@daily"`) {
+		t.Errorf("unexpected rewritten object %s", json)
+	}
+}
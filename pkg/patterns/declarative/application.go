@@ -25,6 +25,7 @@ import (
 	"sort"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
 )
@@ -78,14 +79,12 @@ func uniqueGroupKind(objects *manifest.Objects) []metav1.GroupKind {
 // -  1 Application: (*app, nil)
 // - >1 Application: (nil, err)
 func ExtractApplication(objects *manifest.Objects) (*manifest.Object, error) {
-	var app *manifest.Object
-	for _, o := range objects.Items {
-		if o.Group == "app.k8s.io" && o.Kind == "Application" {
-			if app != nil {
-				return nil, errors.New("multiple app.k8s.io/Application found in manifest")
-			}
-			app = o
-		}
+	apps := objects.FilterByKind(schema.GroupKind{Group: "app.k8s.io", Kind: "Application"})
+	if len(apps) > 1 {
+		return nil, errors.New("multiple app.k8s.io/Application found in manifest")
+	}
+	if len(apps) == 0 {
+		return nil, nil
 	}
-	return app, nil
+	return apps[0], nil
 }
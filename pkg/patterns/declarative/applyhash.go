@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// SyncTokenAnnotation on a DeclarativeObject forces the manifest to be applied again, even with
+// WithSkipUnchangedApply, whenever its value changes
+const SyncTokenAnnotation = "addons.k8s.io/sync-token"
+
+// AppliedHashAnnotation is set on a DeclarativeObject with WithSkipUnchangedApply to a hash of the manifest last
+// applied for it, its SyncTokenAnnotation, and the versions of the objects in the cluster after it was applied
+const AppliedHashAnnotation = "addons.k8s.io/applied-hash"
+
+// appliedDigest returns the value of AppliedHashAnnotation for an apply of the manifest with hash, leaving the
+// objects in the cluster at versions
+func appliedDigest(hash string, syncToken string, versions map[string]string) string {
+	keys := make([]string, 0, len(versions))
+	for k := range versions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", hash, syncToken)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, versions[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// unchangedSinceApply returns true if the manifest with hash was the last applied for instance, with the same sync
+// token, and none of the objects have changed in the cluster since
+func unchangedSinceApply(instance DeclarativeObject, hash string, versions map[string]string) bool {
+	annotations := instance.GetAnnotations()
+	applied, found := annotations[AppliedHashAnnotation]
+	return found && applied == appliedDigest(hash, annotations[SyncTokenAnnotation], versions)
+}
+
+// recordAppliedHash sets AppliedHashAnnotation on instance, so that the apply is skipped until something changes,
+// including after the operator restarts
+func (r *Reconciler) recordAppliedHash(ctx context.Context, instance DeclarativeObject, hash string, versions map[string]string) error {
+	annotations := instance.GetAnnotations()
+	digest := appliedDigest(hash, annotations[SyncTokenAnnotation], versions)
+	if annotations[AppliedHashAnnotation] == digest {
+		return nil
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[AppliedHashAnnotation] = digest
+	instance.SetAnnotations(annotations)
+	if err := r.client.Update(ctx, instance); err != nil {
+		return fmt.Errorf("error recording applied hash: %v", err)
+	}
+	return nil
+}
+
+// applyHash returns a hash of everything passed to kubectl apply
+func (r *Reconciler) applyHash(ns string, manifestStr string, extraArgs []string, pruneArgs []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%v\n%s\n%s\n", ns, r.options.validate, strings.Join(extraArgs, " "), strings.Join(pruneArgs, " "))
+	h.Write([]byte(manifestStr))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clusterVersions returns the versions of the objects in the cluster
+func (r *Reconciler) clusterVersions(ctx context.Context, objects []*manifest.Object) map[string]string {
+	versions := make(map[string]string)
+	for _, o := range objects {
+		u, _ := GetObjectFromCluster(ctx, o, r)
+		versions[objectKey(o)] = objectVersion(u)
+	}
+	return versions
+}
+
+func objectKey(o *manifest.Object) string {
+	return o.GroupKind().String() + "/" + o.Namespace + "/" + o.Name
+}
+
+// objectVersion identifies the version of the spec of an object in the cluster.
+// The generation is used where it is maintained, so that status updates aren't treated as changes.
+func objectVersion(u *unstructured.Unstructured) string {
+	if u == nil {
+		return ""
+	}
+	if generation := u.GetGeneration(); generation != 0 {
+		return fmt.Sprintf("generation=%d", generation)
+	}
+	return "resourceVersion=" + u.GetResourceVersion()
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestUnchangedSinceApply(t *testing.T) {
+	versions := map[string]string{"apps/Deployment/default/app": "generation=1"}
+
+	r := &Reconciler{}
+	hash := r.applyHash("default", "manifest", []string{"--force"}, nil)
+
+	tests := []struct {
+		name      string
+		hash      string
+		syncToken string
+		versions  map[string]string
+		unchanged bool
+	}{
+		{
+			name:      "unchanged",
+			hash:      hash,
+			versions:  map[string]string{"apps/Deployment/default/app": "generation=1"},
+			unchanged: true,
+		},
+		{
+			name:     "manifest changed",
+			hash:     r.applyHash("default", "changed manifest", []string{"--force"}, nil),
+			versions: versions,
+		},
+		{
+			name:     "args changed",
+			hash:     r.applyHash("default", "manifest", []string{"--force", "--prune"}, nil),
+			versions: versions,
+		},
+		{
+			name:      "sync token changed",
+			hash:      hash,
+			syncToken: "2",
+			versions:  versions,
+		},
+		{
+			name:     "object changed in cluster",
+			hash:     hash,
+			versions: map[string]string{"apps/Deployment/default/app": "generation=2"},
+		},
+		{
+			name:     "object deleted from cluster",
+			hash:     hash,
+			versions: map[string]string{"apps/Deployment/default/app": ""},
+		},
+	}
+
+	ctx := context.Background()
+	instance := newGuestbook("default", "test", time.Now())
+	r.client = fake.NewClientBuilder().WithObjects(instance).Build()
+	if unchangedSinceApply(instance, hash, versions) {
+		t.Errorf("expected a DeclarativeObject never applied to be changed")
+	}
+	if err := r.recordAppliedHash(ctx, instance, hash, versions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The hash is kept on the DeclarativeObject, so it survives a restart of the operator
+	stored := newGuestbook("default", "test", time.Now())
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, stored); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instance := stored.DeepCopy()
+			if test.syncToken != "" {
+				annotations := instance.GetAnnotations()
+				annotations[SyncTokenAnnotation] = test.syncToken
+				instance.SetAnnotations(annotations)
+			}
+			if got := unchangedSinceApply(instance, test.hash, test.versions); got != test.unchanged {
+				t.Errorf("expected unchanged=%v, got %v", test.unchanged, got)
+			}
+		})
+	}
+}
+
+func TestGetObjectFromClusterInApplyNamespace(t *testing.T) {
+	objects, err := manifest.ParseObjects(context.Background(), "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n")
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	live := &unstructured.Unstructured{}
+	live.SetAPIVersion("v1")
+	live.SetKind("ConfigMap")
+	live.SetNamespace("apps")
+	live.SetName("config")
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	r := &Reconciler{restMapper: mapper, dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live)}
+
+	if _, err := GetObjectFromCluster(context.Background(), objects.Items[0], r); !apierrors.IsNotFound(err) {
+		t.Errorf("expected not found without an apply namespace, got %v", err)
+	}
+	u, err := GetObjectFromCluster(contextWithApplyNamespace(context.Background(), "apps"), objects.Items[0], r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.GetNamespace() != "apps" {
+		t.Errorf("expected the ConfigMap in the apply namespace, got %s", u.GetNamespace())
+	}
+}
+
+func TestObjectVersion(t *testing.T) {
+	withGeneration := &unstructured.Unstructured{}
+	withGeneration.SetGeneration(3)
+	withGeneration.SetResourceVersion("100")
+
+	withoutGeneration := &unstructured.Unstructured{}
+	withoutGeneration.SetResourceVersion("100")
+
+	if got := objectVersion(nil); got != "" {
+		t.Errorf("expected empty version for missing object, got %q", got)
+	}
+	if got := objectVersion(withGeneration); got != "generation=3" {
+		t.Errorf("expected generation to be used, got %q", got)
+	}
+	if got := objectVersion(withoutGeneration); got != "resourceVersion=100" {
+		t.Errorf("expected resourceVersion to be used, got %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+)
+
+const ApplyWaitSeconds = "apply_wait_seconds"
+
+var applyWaitRegisterOnce sync.Once
+
+var applyWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Subsystem: Declarative,
+	Name:      ApplyWaitSeconds,
+	Help:      "How long applies waited for one of the slots of an ApplyLimiter",
+	Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+})
+
+// ApplyLimiter bounds the number of manifests being applied at once, by all the Reconcilers sharing it with
+// WithApplyLimiter, so that many DeclarativeObjects reconciling together don't exhaust the memory of the operator.
+// Applies beyond the limit wait for a slot, in the order they arrive.
+type ApplyLimiter struct {
+	slots chan struct{}
+}
+
+// NewApplyLimiter returns an ApplyLimiter allowing up to max concurrent applies.  max must be positive, as no apply
+// could ever get a slot otherwise.
+func NewApplyLimiter(max int) (*ApplyLimiter, error) {
+	if max <= 0 {
+		return nil, fmt.Errorf("invalid apply limit %d: must be positive", max)
+	}
+	applyWaitRegisterOnce.Do(func() {
+		// Ignore errors, eg from tests registering it again, as the wait time is only informational
+		_ = metrics.Registry.Register(applyWait)
+	})
+	return &ApplyLimiter{slots: make(chan struct{}, max)}, nil
+}
+
+// acquire waits for a slot, returning a func releasing it, or an error if ctx is done first
+func (l *ApplyLimiter) acquire(ctx context.Context) (func(), error) {
+	start := time.Now()
+	select {
+	case l.slots <- struct{}{}:
+		applyWait.Observe(time.Since(start).Seconds())
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		applyWait.Observe(time.Since(start).Seconds())
+		return nil, fmt.Errorf("waiting to apply: %w", ctx.Err())
+	}
+}
+
+// limitedApplier applies with an applier once the ApplyLimiter has a slot
+type limitedApplier struct {
+	applier kubectlClient
+	limiter *ApplyLimiter
+}
+
+var _ resultsApplier = &limitedApplier{}
+
+func (a *limitedApplier) Apply(ctx context.Context, namespace string, manifest string, validate bool, args ...string) error {
+	_, err := a.ApplyWithResults(ctx, namespace, manifest, validate, args...)
+	return err
+}
+
+func (a *limitedApplier) ApplyWithResults(ctx context.Context, namespace string, manifest string, validate bool, args ...string) (*applier.Results, error) {
+	release, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if ra, ok := a.applier.(resultsApplier); ok {
+		return ra.ApplyWithResults(ctx, namespace, manifest, validate, args...)
+	}
+	return nil, a.applier.Apply(ctx, namespace, manifest, validate, args...)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingApplier records the most applies in flight at once, each taking a while
+type blockingApplier struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (a *blockingApplier) Apply(ctx context.Context, namespace string, manifest string, validate bool, args ...string) error {
+	a.mu.Lock()
+	a.inFlight++
+	if a.inFlight > a.max {
+		a.max = a.inFlight
+	}
+	a.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	a.mu.Lock()
+	a.inFlight--
+	a.mu.Unlock()
+	return nil
+}
+
+func TestLimitedApplier(t *testing.T) {
+	inner := &blockingApplier{}
+	limiter, err := NewApplyLimiter(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a := &limitedApplier{applier: inner, limiter: limiter}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.Apply(context.Background(), "default", "manifest", false); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if inner.max != 2 {
+		t.Errorf("expected at most 2 applies at once, got %d", inner.max)
+	}
+
+	// Waiting for a slot stops when the context is done
+	release, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+	release2, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release2()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.Apply(ctx, "default", "manifest", false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded waiting for a slot, got %v", err)
+	}
+}
+
+func TestNewApplyLimiterRejectsInvalidLimits(t *testing.T) {
+	for _, max := range []int{0, -1} {
+		if _, err := NewApplyLimiter(max); err == nil {
+			t.Errorf("expected error for limit %d", max)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// ApplyOperation is what applying the manifest did with an object
+type ApplyOperation string
+
+const (
+	ApplyCreated    ApplyOperation = "created"
+	ApplyConfigured ApplyOperation = "configured"
+	ApplyUnchanged  ApplyOperation = "unchanged"
+	ApplyFailed     ApplyOperation = "failed"
+	// ApplyServerSideApplied is reported for objects applied with WithServerSideApply
+	ApplyServerSideApplied ApplyOperation = "serverside-applied"
+	// ApplyApplied is reported when the applier doesn't say what it did with the object
+	ApplyApplied ApplyOperation = "applied"
+)
+
+// maxReportedFailures limits the number of failed objects included in the apply error
+const maxReportedFailures = 5
+
+// ApplyResult is the outcome of applying a single object
+type ApplyResult struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+	// Source is where the object is in the manifest, eg "object #12 in manifests/deployment.yaml", if known
+	Source string
+
+	Operation ApplyOperation
+	// Message is the reason the object failed to apply
+	Message string
+	// Conflicts are the fields managed by other field managers which stopped the object from being applied
+	// with WithServerSideApply
+	Conflicts []string
+}
+
+func (a ApplyResult) String() string {
+	s := a.Kind + " " + a.Name
+	if a.Namespace != "" {
+		s = a.Kind + " " + a.Namespace + "/" + a.Name
+	}
+	if a.Source != "" {
+		s = a.Source + " (" + s + ")"
+	}
+	if a.Message != "" {
+		return s + " " + string(a.Operation) + ": " + a.Message
+	}
+	return s + " " + string(a.Operation)
+}
+
+type applyResultsKey struct{}
+
+func contextWithApplyResults(ctx context.Context, results []ApplyResult) context.Context {
+	return context.WithValue(ctx, applyResultsKey{}, results)
+}
+
+// ApplyResultsFromContext returns the outcome of applying each object, when called from a Status or Sink.
+// It returns nil if the manifest was not applied.
+func ApplyResultsFromContext(ctx context.Context) []ApplyResult {
+	results, _ := ctx.Value(applyResultsKey{}).([]ApplyResult)
+	return results
+}
+
+// resultsApplier is implemented by appliers that report what they did with each object
+type resultsApplier interface {
+	ApplyWithResults(ctx context.Context, namespace string, manifest string, validate bool, args ...string) (*applier.Results, error)
+}
+
+// applyWithResults applies the manifest for objects, returning the outcome for each object.
+// If any objects fail to apply, the error lists them.
+// With WithRecreateOnImmutableChange, objects that fail to apply because immutable fields changed are recreated.
+func (r *Reconciler) applyWithResults(ctx context.Context, ns string, manifestStr string, objects []*manifest.Object, args ...string) ([]ApplyResult, error) {
+	results, err := r.applyOnce(ctx, ns, manifestStr, objects, args)
+	if err == nil || !r.options.recreateImmutable {
+		return results, err
+	}
+	recreated, rerr := r.recreateImmutable(ctx, ns, objects, results)
+	if rerr != nil {
+		return results, rerr
+	}
+	if !recreated {
+		return results, err
+	}
+	return r.applyOnce(ctx, ns, manifestStr, objects, args)
+}
+
+func (r *Reconciler) applyOnce(ctx context.Context, ns string, manifestStr string, objects []*manifest.Object, args []string) ([]ApplyResult, error) {
+	if r.usesApplyStrategies(objects) {
+		return r.applyWithStrategies(ctx, ns, objects, args)
+	}
+	return r.applyManifest(ctx, ns, manifestStr, objects, args...)
+}
+
+// applyManifest applies the manifest for objects with the applier, returning the outcome for each object
+func (r *Reconciler) applyManifest(ctx context.Context, ns string, manifestStr string, objects []*manifest.Object, args ...string) ([]ApplyResult, error) {
+	args = append(append(append([]string{}, args...), impersonationArgs(ctx)...), r.kubeconfigArgs()...)
+	ctx = r.rateLimitedContext(ctx)
+	ctx, span := startSpan(ctx, "Apply", attribute.String("namespace", ns), attribute.Int("objects", len(objects)))
+	var reported *applier.Results
+	var err error
+	defer func() { endSpan(span, err) }()
+	if a, ok := r.kubectl.(resultsApplier); ok {
+		reported, err = a.ApplyWithResults(ctx, ns, manifestStr, r.options.validate, args...)
+	} else {
+		err = r.kubectl.Apply(ctx, ns, manifestStr, r.options.validate, args...)
+	}
+
+	results := make([]ApplyResult, 0, len(objects))
+	var failed []string
+	for _, o := range objects {
+		result := ApplyResult{
+			Group:     o.Group,
+			Kind:      o.Kind,
+			Namespace: o.Namespace,
+			Name:      o.Name,
+			Source:    o.Source().String(),
+			Operation: ApplyApplied,
+		}
+		if op, found := reportedOperation(reported, o); found {
+			result.Operation = ApplyOperation(op)
+		} else if err != nil {
+			result.Operation = ApplyFailed
+			result.Message = failureMessage(reported, o, err)
+			if containsArg(args, applier.ServerSideArg) && !containsArg(args, applier.ForceConflictsArg) {
+				conflicts, cerr := r.fieldConflicts(ctx, ns, o)
+				if cerr != nil {
+					log.FromContext(ctx).WithValues("kind", o.Kind).WithValues("name", o.Name).Error(cerr, "checking for field conflicts")
+				}
+				if len(conflicts) != 0 {
+					result.Conflicts = conflicts
+					result.Message = "conflicts with other field managers: " + strings.Join(conflicts, ", ")
+				}
+			}
+			failed = append(failed, result.String())
+		}
+		results = append(results, result)
+	}
+
+	if err != nil {
+		if len(failed) == 0 {
+			return results, err
+		}
+		if len(failed) > maxReportedFailures {
+			failed = append(failed[:maxReportedFailures], fmt.Sprintf("and %d more", len(failed)-maxReportedFailures))
+		}
+		return results, fmt.Errorf("%d of %d objects failed to apply: %s", len(failed), len(objects), strings.Join(failed, "; "))
+	}
+	return results, nil
+}
+
+func reportedOperation(reported *applier.Results, o *manifest.Object) (string, bool) {
+	if reported == nil {
+		return "", false
+	}
+	op, found := reported.Operations[applier.ObjectID(o.Group, o.Kind, o.Name)]
+	return op, found
+}
+
+// failureMessage finds the error reported for the object, falling back to the error for the whole apply
+func failureMessage(reported *applier.Results, o *manifest.Object, err error) string {
+	if reported != nil {
+		quoted := fmt.Sprintf("%q", o.Name)
+		for _, msg := range reported.Errors {
+			if strings.Contains(msg, quoted) {
+				return msg
+			}
+		}
+	}
+	return err.Error()
+}
+
+func containsArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
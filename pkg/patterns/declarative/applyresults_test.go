@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// reportingApplier returns canned results from ApplyWithResults
+type reportingApplier struct {
+	results *applier.Results
+	err     error
+}
+
+func (a *reportingApplier) Apply(ctx context.Context, namespace string, manifest string, validate bool, args ...string) error {
+	_, err := a.ApplyWithResults(ctx, namespace, manifest, validate, args...)
+	return err
+}
+
+func (a *reportingApplier) ApplyWithResults(ctx context.Context, namespace string, manifest string, validate bool, args ...string) (*applier.Results, error) {
+	return a.results, a.err
+}
+
+func TestApplyWithResults(t *testing.T) {
+	objects, err := manifest.ParseObjects(context.Background(), `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: webhook
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		kubectl  kubectlClient
+		expected []ApplyOperation
+		message  string
+		wantErr  string
+	}{
+		{
+			name: "reported operations",
+			kubectl: &reportingApplier{results: &applier.Results{Operations: map[string]string{
+				"deployment.apps/app": "configured",
+				"service/app":         "unchanged",
+				"validatingwebhookconfiguration.admissionregistration.k8s.io/webhook": "created",
+			}}},
+			expected: []ApplyOperation{ApplyConfigured, ApplyUnchanged, ApplyCreated},
+		},
+		{
+			name: "failed object",
+			kubectl: &reportingApplier{
+				results: &applier.Results{
+					Operations: map[string]string{
+						"deployment.apps/app": "configured",
+						"service/app":         "unchanged",
+					},
+					Errors: []string{`Error from server (Invalid): error when creating "STDIN": ValidatingWebhookConfiguration.admissionregistration.k8s.io "webhook" is invalid`},
+				},
+				err: errors.New("exit status 1"),
+			},
+			expected: []ApplyOperation{ApplyConfigured, ApplyUnchanged, ApplyFailed},
+			message:  `"webhook" is invalid`,
+			wantErr:  "1 of 3 objects failed to apply: ValidatingWebhookConfiguration webhook failed",
+		},
+		{
+			name:     "applier without results",
+			kubectl:  &recordingApplier{},
+			expected: []ApplyOperation{ApplyApplied, ApplyApplied, ApplyApplied},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{kubectl: test.kubectl}
+			results, err := r.applyWithResults(context.Background(), "default", "", objects.Items)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var operations []ApplyOperation
+			for _, result := range results {
+				operations = append(operations, result.Operation)
+				if result.Operation == ApplyFailed && !strings.Contains(result.Message, test.message) {
+					t.Errorf("expected failure message containing %q, got %q", test.message, result.Message)
+				}
+			}
+			if !reflect.DeepEqual(operations, test.expected) {
+				t.Errorf("expected operations %v, got %v", test.expected, operations)
+			}
+		})
+	}
+}
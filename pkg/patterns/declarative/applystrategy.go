@@ -0,0 +1,290 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// ApplyStrategy is how objects are applied
+type ApplyStrategy string
+
+const (
+	// ApplyStrategyClientSide applies objects with a client-side three-way merge, the default
+	ApplyStrategyClientSide ApplyStrategy = "ClientSide"
+	// ApplyStrategyServerSide applies objects with server-side apply, the default with WithServerSideApply
+	ApplyStrategyServerSide ApplyStrategy = "ServerSide"
+	// ApplyStrategyReplace replaces objects with their content in the manifest, creating them if they don't exist
+	ApplyStrategyReplace ApplyStrategy = "Replace"
+
+	// applyStrategyOversized groups the objects too large for client-side apply, applied with server-side apply
+	applyStrategyOversized ApplyStrategy = "Oversized"
+)
+
+// lastAppliedSizeLimit is the largest total size of the annotations of an object applied with client-side apply.
+// Client-side apply stores the whole object in the last-applied-configuration annotation, on top of its other
+// annotations, and the annotations of an object can't exceed 256KiB, so larger objects, such as big CRDs, are
+// applied with server-side apply instead.  Some headroom is left for the annotations added to live objects, eg by
+// controllers or kubectl rollout restart.
+var lastAppliedSizeLimit = 256*1024 - 16*1024
+
+// defaultApplyStrategy returns the strategy of the objects of kinds without an ApplyStrategy set with
+// WithApplyStrategy
+func (r *Reconciler) defaultApplyStrategy() ApplyStrategy {
+	if r.options.serverSideApply {
+		return ApplyStrategyServerSide
+	}
+	return ApplyStrategyClientSide
+}
+
+// applyStrategy returns the strategy used to apply objects of kind gk
+func (r *Reconciler) applyStrategy(gk schema.GroupKind) ApplyStrategy {
+	if strategy, ok := r.options.applyStrategies[gk]; ok {
+		return strategy
+	}
+	return r.defaultApplyStrategy()
+}
+
+// objectApplyStrategy returns the strategy used to apply o: the strategy of its kind, except for objects too large
+// to be applied with client-side apply, which are applied with server-side apply
+func (r *Reconciler) objectApplyStrategy(o *manifest.Object) ApplyStrategy {
+	strategy := r.applyStrategy(o.GroupKind())
+	if strategy == ApplyStrategyClientSide && r.options.inventoryApplier == nil && isOversized(o) {
+		return ApplyStrategyServerSide
+	}
+	return strategy
+}
+
+// isOversized returns true if o is too large for its last-applied-configuration annotation, with its other
+// annotations
+func isOversized(o *manifest.Object) bool {
+	b, err := o.JSON()
+	if err != nil {
+		return false
+	}
+	size := len(corev1.LastAppliedConfigAnnotation) + len(b)
+	for k, v := range o.UnstructuredObject().GetAnnotations() {
+		size += len(k) + len(v)
+	}
+	return size > lastAppliedSizeLimit
+}
+
+// usesApplyStrategies returns true if any of objects are applied with another strategy than the default
+func (r *Reconciler) usesApplyStrategies(objects []*manifest.Object) bool {
+	if len(r.options.applyStrategies) != 0 {
+		return true
+	}
+	for _, o := range objects {
+		if r.objectApplyStrategy(o) != r.defaultApplyStrategy() {
+			return true
+		}
+	}
+	return false
+}
+
+// usesServerSideApply returns true if any objects are applied with server-side apply
+func (r *Reconciler) usesServerSideApply() bool {
+	if r.options.serverSideApply {
+		return true
+	}
+	for _, strategy := range r.options.applyStrategies {
+		if strategy == ApplyStrategyServerSide {
+			return true
+		}
+	}
+	return false
+}
+
+// separatelyAppliedKinds returns the kinds applied separately from the rest of the manifest with WithApplyStrategy,
+// which must not be pruned by its apply.  Objects too large for client-side apply are kept from being pruned by
+// dropLastApplied instead, as the other objects of their kinds are still pruned.
+func (r *Reconciler) separatelyAppliedKinds() []schema.GroupKind {
+	var kinds []schema.GroupKind
+	for gk, strategy := range r.options.applyStrategies {
+		if strategy != r.defaultApplyStrategy() {
+			kinds = append(kinds, gk)
+		}
+	}
+	return kinds
+}
+
+// dropLastApplied removes the last-applied-configuration annotation of the live object of o, left by an earlier
+// client-side apply, as kubectl apply --prune deletes the objects with the annotation missing from the manifest it
+// applies.  The object is then only applied with server-side apply, which doesn't set the annotation.
+func (r *Reconciler) dropLastApplied(ctx context.Context, ns string, o *manifest.Object) error {
+	resource, err := r.objectResource(ctx, ns, o)
+	if err != nil {
+		return err
+	}
+	live, err := resource.Get(ctx, o.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting %s %s: %v", o.Kind, o.Name, err)
+	}
+	if _, found := live.GetAnnotations()[corev1.LastAppliedConfigAnnotation]; !found {
+		return nil
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, corev1.LastAppliedConfigAnnotation)
+	if _, err := resource.Patch(ctx, o.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("error removing %s annotation from %s %s: %v", corev1.LastAppliedConfigAnnotation, o.Kind, o.Name, err)
+	}
+	return nil
+}
+
+// applyWithStrategies applies the objects with the strategy of their kinds, or server-side apply for objects too
+// large for client-side apply.  The objects with the default strategy are applied with args; the others are applied
+// separately, without pruning.  Objects too large for client-side apply take over the fields set by earlier
+// client-side applies, forcing conflicts.
+func (r *Reconciler) applyWithStrategies(ctx context.Context, ns string, objects []*manifest.Object, args []string) ([]ApplyResult, error) {
+	log := log.FromContext(ctx)
+
+	byStrategy := make(map[ApplyStrategy][]*manifest.Object)
+	var strategies []ApplyStrategy
+	for _, o := range objects {
+		strategy := r.objectApplyStrategy(o)
+		if strategy != r.applyStrategy(o.GroupKind()) {
+			log.WithValues("kind", o.Kind).WithValues("name", o.Name).Info("object too large for client-side apply, applying with server-side apply")
+			if err := r.dropLastApplied(ctx, ns, o); err != nil {
+				return nil, err
+			}
+			strategy = applyStrategyOversized
+		}
+		if _, found := byStrategy[strategy]; !found {
+			strategies = append(strategies, strategy)
+		}
+		byStrategy[strategy] = append(byStrategy[strategy], o)
+	}
+
+	byObject := make(map[string]ApplyResult)
+	var errs []string
+	for _, strategy := range strategies {
+		group := byStrategy[strategy]
+		var results []ApplyResult
+		var err error
+		switch strategy {
+		case ApplyStrategyReplace:
+			results, err = r.replaceObjects(ctx, ns, group)
+		default:
+			groupArgs := args
+			if strategy == applyStrategyOversized {
+				groupArgs = r.strategyArgs(ApplyStrategyServerSide)
+				if !containsArg(groupArgs, applier.ForceConflictsArg) {
+					groupArgs = append(groupArgs, applier.ForceConflictsArg)
+				}
+			} else if strategy != r.defaultApplyStrategy() {
+				groupArgs = r.strategyArgs(strategy)
+			}
+			var m string
+			m, err = (&manifest.Objects{Items: group}).JSONManifest()
+			if err != nil {
+				return nil, fmt.Errorf("error creating manifest: %v", err)
+			}
+			results, err = r.applyManifest(ctx, ns, m, group, groupArgs...)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for i, result := range results {
+			byObject[objectKey(group[i])] = result
+		}
+	}
+
+	results := make([]ApplyResult, 0, len(objects))
+	for _, o := range objects {
+		results = append(results, byObject[objectKey(o)])
+	}
+	if len(errs) != 0 {
+		return results, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return results, nil
+}
+
+// strategyArgs returns the args applying objects with the client-side or server-side strategy, without pruning
+func (r *Reconciler) strategyArgs(strategy ApplyStrategy) []string {
+	if strategy != ApplyStrategyServerSide {
+		return []string{"--force"}
+	}
+	args := []string{applier.ServerSideArg, applier.FieldManagerArgPrefix + r.fieldManager()}
+	if r.options.forceConflicts {
+		args = append(args, applier.ForceConflictsArg)
+	}
+	return args
+}
+
+// replaceObjects replaces the objects in the cluster with their content in the manifest, creating the objects
+// that don't exist
+func (r *Reconciler) replaceObjects(ctx context.Context, ns string, objects []*manifest.Object) ([]ApplyResult, error) {
+	log := log.FromContext(ctx)
+
+	results := make([]ApplyResult, 0, len(objects))
+	var failed []string
+	for _, o := range objects {
+		result := ApplyResult{Group: o.Group, Kind: o.Kind, Namespace: o.Namespace, Name: o.Name, Source: o.Source().String()}
+		op, err := r.replaceObject(ctx, ns, o)
+		if err != nil {
+			result.Operation = ApplyFailed
+			result.Message = err.Error()
+			failed = append(failed, result.String())
+		} else {
+			result.Operation = op
+			log.WithValues("kind", o.Kind).WithValues("name", o.Name).WithValues("operation", op).V(2).Info("replaced object")
+		}
+		results = append(results, result)
+	}
+	if len(failed) != 0 {
+		return results, fmt.Errorf("%d of %d objects failed to replace: %s", len(failed), len(objects), strings.Join(failed, "; "))
+	}
+	return results, nil
+}
+
+// replaceObject replaces the object o in the cluster, creating it if it doesn't exist
+func (r *Reconciler) replaceObject(ctx context.Context, ns string, o *manifest.Object) (ApplyOperation, error) {
+	resource, err := r.objectResource(ctx, ns, o)
+	if err != nil {
+		return "", err
+	}
+	u := o.UnstructuredObject().DeepCopy()
+
+	live, err := resource.Get(ctx, o.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := resource.Create(ctx, u, metav1.CreateOptions{}); err != nil {
+			return "", fmt.Errorf("error creating %s %s: %v", o.Kind, o.Name, err)
+		}
+		return ApplyCreated, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting %s %s: %v", o.Kind, o.Name, err)
+	}
+	u.SetResourceVersion(live.GetResourceVersion())
+	if _, err := resource.Update(ctx, u, metav1.UpdateOptions{}); err != nil {
+		return "", fmt.Errorf("error replacing %s %s: %v", o.Kind, o.Name, err)
+	}
+	return ApplyConfigured, nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestApplyWithStrategies(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: example.org/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: default
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: created
+  namespace: default
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: replaced
+  namespace: default
+data:
+  key: new
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	existing := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "replaced", "namespace": "default", "resourceVersion": "1"},
+		"data":       map[string]interface{}{"key": "old", "other": "removed"},
+	}}
+	applier := &recordingApplier{}
+	r := &Reconciler{
+		kubectl:       applier,
+		restMapper:    mapper,
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing),
+	}
+	for _, opt := range []reconcilerOption{
+		WithApplyStrategy(schema.GroupKind{Group: "example.org", Kind: "Widget"}, ApplyStrategyServerSide),
+		WithApplyStrategy(schema.GroupKind{Kind: "ConfigMap"}, ApplyStrategyReplace),
+	} {
+		r.options = opt(r.options)
+	}
+
+	results, err := r.applyWithResults(ctx, "default", "", objects.Items, "--force", "--prune")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var operations []ApplyOperation
+	for _, result := range results {
+		operations = append(operations, result.Operation)
+	}
+	expected := []ApplyOperation{ApplyApplied, ApplyApplied, ApplyCreated, ApplyConfigured}
+	if !reflect.DeepEqual(operations, expected) {
+		t.Errorf("expected operations %v, got %v", expected, operations)
+	}
+
+	expectedArgs := [][]string{{"--force", "--prune"}, {"--server-side", "--field-manager=" + DefaultFieldManager}}
+	if !reflect.DeepEqual(applier.args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, applier.args)
+	}
+	if len(applier.manifests) != 2 || !strings.Contains(applier.manifests[0], `"name":"app"`) || !strings.Contains(applier.manifests[1], `"name":"widget"`) {
+		t.Errorf("expected the deployment and widget to be applied separately, got %v", applier.manifests)
+	}
+
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	replaced, err := r.dynamicClient.Resource(configMaps).Namespace("default").Get(ctx, "replaced", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting replaced configmap: %v", err)
+	}
+	if data, _, _ := unstructured.NestedStringMap(replaced.Object, "data"); !reflect.DeepEqual(data, map[string]string{"key": "new"}) {
+		t.Errorf("expected the configmap to be replaced, got data %v", data)
+	}
+}
+
+func TestApplyOversizedWithServerSideApply(t *testing.T) {
+	defer func(limit int) { lastAppliedSizeLimit = limit }(lastAppliedSizeLimit)
+	lastAppliedSizeLimit = 1024
+
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: dashboards
+  namespace: default
+data:
+  dashboard.json: "`+strings.Repeat("x", 2048)+`"
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	// The live configmap was applied with client-side apply before it grew
+	live := &unstructured.Unstructured{}
+	live.SetAPIVersion("v1")
+	live.SetKind("ConfigMap")
+	live.SetNamespace("default")
+	live.SetName("dashboards")
+	live.SetAnnotations(map[string]string{corev1.LastAppliedConfigAnnotation: "{}", "other": "kept"})
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	applier := &recordingApplier{}
+	r := &Reconciler{kubectl: applier, restMapper: mapper, dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live)}
+
+	if _, err := r.applyWithResults(ctx, "default", "", objects.Items, "--force", "--prune"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedArgs := [][]string{{"--force", "--prune"}, {"--server-side", "--field-manager=" + DefaultFieldManager, "--force-conflicts"}}
+	if !reflect.DeepEqual(applier.args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, applier.args)
+	}
+	if len(applier.manifests) != 2 || !strings.Contains(applier.manifests[0], `"name":"app"`) || !strings.Contains(applier.manifests[1], `"name":"dashboards"`) {
+		t.Errorf("expected the large configmap to be applied separately, got %v", applier.manifests)
+	}
+
+	// Only the large configmap is kept from being pruned, by dropping its last-applied-configuration annotation
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	got, err := r.dynamicClient.Resource(configMaps).Namespace("default").Get(ctx, "dashboards", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting configmap: %v", err)
+	}
+	if expected := map[string]string{"other": "kept"}; !reflect.DeepEqual(got.GetAnnotations(), expected) {
+		t.Errorf("expected annotations %v, got %v", expected, got.GetAnnotations())
+	}
+	if args := r.pruneWhitelistArgs(ctx); args != nil {
+		t.Errorf("expected kubectl to prune its default kinds, including configmaps, got %v", args)
+	}
+}
+
+func TestIsOversizedCountsAnnotations(t *testing.T) {
+	defer func(limit int) { lastAppliedSizeLimit = limit }(lastAppliedSizeLimit)
+	lastAppliedSizeLimit = 1024
+
+	objects, err := manifest.ParseObjects(context.Background(), `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  annotations:
+    description: "`+strings.Repeat("x", 500)+`"
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	// The annotation is stored twice: once itself, and once in the last-applied-configuration
+	if !isOversized(objects.Items[0]) {
+		t.Errorf("expected the annotations to count towards the size")
+	}
+}
@@ -0,0 +1,299 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// AuditOutcome is the outcome of an apply recorded in an AuditRecord
+type AuditOutcome string
+
+const (
+	AuditSucceeded       AuditOutcome = "Succeeded"
+	AuditPartiallyFailed AuditOutcome = "PartiallyFailed"
+	AuditFailed          AuditOutcome = "Failed"
+)
+
+// AuditRecord records an apply of the manifest of a DeclarativeObject, for compliance reviews
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+
+	// APIVersion, Kind, Namespace, Name and UID identify the DeclarativeObject
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+	// Generation is the generation of the DeclarativeObject which initiated the apply
+	Generation int64 `json:"generation"`
+
+	// Version is the version of the manifest, resolved by the ManifestController if it implements
+	// ResolveVersion, otherwise spec.version of the DeclarativeObject
+	Version string `json:"version,omitempty"`
+	// ManifestHash identifies the manifest applied, with the arguments of the apply
+	ManifestHash string `json:"manifestHash"`
+	// Objects are the objects applied, with what the apply did with each when the applier reports it
+	Objects []AuditObject `json:"objects"`
+
+	Outcome AuditOutcome `json:"outcome"`
+	// Error is the error of the apply, unless it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// AuditObject is an object of an AuditRecord
+type AuditObject struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Operation string `json:"operation,omitempty"`
+}
+
+// AuditSink records the applies of the reconciler, with WithAuditSink
+type AuditSink interface {
+	RecordApply(ctx context.Context, record AuditRecord) error
+}
+
+// versionResolver is implemented by ManifestControllers resolving the version of the manifest of an object, such as
+// the addon loaders.ManifestLoader
+type versionResolver interface {
+	ResolveVersion(ctx context.Context, object runtime.Object) (string, error)
+}
+
+// auditApply records the apply of objects for instance with the AuditSinks.  version is the version applied, if
+// known, eg by a rollback.  The reconcile doesn't fail when the sinks do, as the objects have been applied.
+func (r *Reconciler) auditApply(ctx context.Context, instance DeclarativeObject, version string, manifestHash string, objects *manifest.Objects, results []ApplyResult, applyErr error) {
+	log := log.FromContext(ctx)
+
+	gvk := instance.GetObjectKind().GroupVersionKind()
+	if gvk.Kind == "" && r.client != nil {
+		gvk, _ = apiutil.GVKForObject(instance, r.client.Scheme())
+	}
+	if version == "" {
+		version = specVersion(instance)
+		if resolver, ok := r.options.manifestController.(versionResolver); ok {
+			if resolved, err := resolver.ResolveVersion(ctx, instance); err == nil {
+				version = resolved
+			}
+		}
+	}
+
+	record := AuditRecord{
+		Time:         time.Now().UTC(),
+		APIVersion:   gvk.GroupVersion().String(),
+		Kind:         gvk.Kind,
+		Namespace:    instance.GetNamespace(),
+		Name:         instance.GetName(),
+		UID:          instance.GetUID(),
+		Generation:   instance.GetGeneration(),
+		Version:      version,
+		ManifestHash: manifestHash,
+		Outcome:      AuditSucceeded,
+	}
+	if len(results) != 0 {
+		for _, result := range results {
+			record.Objects = append(record.Objects, AuditObject{
+				Group:     result.Group,
+				Kind:      result.Kind,
+				Namespace: result.Namespace,
+				Name:      result.Name,
+				Operation: string(result.Operation),
+			})
+		}
+	} else {
+		for _, o := range objects.Items {
+			record.Objects = append(record.Objects, AuditObject{Group: o.Group, Kind: o.Kind, Namespace: o.Namespace, Name: o.Name})
+		}
+	}
+	if applyErr != nil {
+		record.Error = applyErr.Error()
+		record.Outcome = AuditFailed
+		if r.options.partialApply && len(partialApplyFailures(results)) != 0 {
+			record.Outcome = AuditPartiallyFailed
+		}
+	}
+
+	for _, sink := range r.options.auditSinks {
+		if err := sink.RecordApply(ctx, record); err != nil {
+			log.WithValues("sink", fmt.Sprintf("%T", sink)).Error(err, "recording apply in audit sink")
+		}
+	}
+}
+
+// LogAuditSink writes the AuditRecords to the log of the reconcile
+type LogAuditSink struct{}
+
+var _ AuditSink = LogAuditSink{}
+
+func (LogAuditSink) RecordApply(ctx context.Context, record AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error serializing audit record: %v", err)
+	}
+	log.FromContext(ctx).WithName("audit").Info("applied manifest", "record", string(b))
+	return nil
+}
+
+// auditRecordsKey is the key of the ConfigMap of a ConfigMapAuditSink holding the records
+const auditRecordsKey = "records.json"
+
+// auditRecordsSizeLimit is the largest size of the records of a ConfigMapAuditSink, keeping the ConfigMap under the
+// 1MiB limit of the API server with room for its metadata
+var auditRecordsSizeLimit = 1024*1024 - 16*1024
+
+// ConfigMapAuditSink keeps the latest AuditRecords in a ConfigMap, as a JSON list under records.json, oldest first
+type ConfigMapAuditSink struct {
+	client client.Client
+	name   types.NamespacedName
+	size   int
+}
+
+var _ AuditSink = &ConfigMapAuditSink{}
+
+// NewConfigMapAuditSink returns a ConfigMapAuditSink keeping the latest size records in the ConfigMap name, which is
+// created if needed.  Older records are also dropped to keep the ConfigMap under 1MiB, and records may be dropped when
+// reconciles record them at the same time.
+func NewConfigMapAuditSink(c client.Client, name types.NamespacedName, size int) (*ConfigMapAuditSink, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid size %d of audit ConfigMap %s: must be positive", size, name)
+	}
+	return &ConfigMapAuditSink{client: c, name: name, size: size}, nil
+}
+
+func (s *ConfigMapAuditSink) RecordApply(ctx context.Context, record AuditRecord) error {
+	cm := &corev1.ConfigMap{}
+	err := s.client.Get(ctx, s.name, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error getting audit ConfigMap %s: %v", s.name, err)
+	}
+	create := apierrors.IsNotFound(err)
+
+	var records []AuditRecord
+	if data := cm.Data[auditRecordsKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &records); err != nil {
+			return fmt.Errorf("error parsing audit ConfigMap %s: %v", s.name, err)
+		}
+	}
+	records = append(records, record)
+	if len(records) > s.size {
+		records = records[len(records)-s.size:]
+	}
+	b, err := encodeAuditRecords(records, auditRecordsSizeLimit)
+	if err != nil {
+		return fmt.Errorf("error serializing audit records of ConfigMap %s: %v", s.name, err)
+	}
+
+	if create {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.name.Namespace, Name: s.name.Name},
+			Data:       map[string]string{auditRecordsKey: string(b)},
+		}
+		if err := s.client.Create(ctx, cm); err != nil {
+			return fmt.Errorf("error creating audit ConfigMap %s: %v", s.name, err)
+		}
+		return nil
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[auditRecordsKey] = string(b)
+	if err := s.client.Update(ctx, cm); err != nil {
+		return fmt.Errorf("error updating audit ConfigMap %s: %v", s.name, err)
+	}
+	return nil
+}
+
+// encodeAuditRecords encodes the latest records as a JSON list of at most limit bytes, dropping the oldest records
+// which don't fit
+func encodeAuditRecords(records []AuditRecord, limit int) ([]byte, error) {
+	encoded := make([][]byte, len(records))
+	// The brackets of the list
+	size := 2
+	for i, record := range records {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = b
+		size += len(b)
+	}
+	// The commas between the records
+	size += len(records) - 1
+
+	for len(encoded) > 1 && size > limit {
+		size -= len(encoded[0]) + 1
+		encoded = encoded[1:]
+	}
+	if size > limit {
+		return nil, fmt.Errorf("record of %d bytes exceeds the limit of %d bytes", len(encoded[0]), limit)
+	}
+	return append(append([]byte("["), bytes.Join(encoded, []byte(","))...), ']'), nil
+}
+
+// WebhookAuditSink posts each AuditRecord as JSON to a URL
+type WebhookAuditSink struct {
+	url    string
+	client *http.Client
+}
+
+var _ AuditSink = &WebhookAuditSink{}
+
+// NewWebhookAuditSink returns a WebhookAuditSink posting to url with httpClient, or http.DefaultClient if nil.
+// Responses other than 2xx are errors.
+func NewWebhookAuditSink(url string, httpClient *http.Client) *WebhookAuditSink {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &WebhookAuditSink{url: url, client: httpClient}
+}
+
+func (s *WebhookAuditSink) RecordApply(ctx context.Context, record AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error serializing audit record: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error creating audit request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting audit record to %s: %v", s.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error posting audit record to %s: %s", s.url, resp.Status)
+	}
+	return nil
+}
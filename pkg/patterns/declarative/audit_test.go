@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// recordingAuditSink keeps the records of the applies
+type recordingAuditSink struct {
+	records []AuditRecord
+}
+
+func (s *recordingAuditSink) RecordApply(ctx context.Context, record AuditRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestAuditApply(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n")
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	instance := newGuestbook("default", "test", time.Now())
+	instance.SetGeneration(3)
+	if err := unstructured.SetNestedField(instance.Object, "1.2.3", "spec", "version"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sink := &recordingAuditSink{}
+	r := &Reconciler{options: reconcilerParams{auditSinks: []AuditSink{sink}, partialApply: true}}
+	r.auditApply(ctx, instance, "", "hash", objects, nil, nil)
+	results := []ApplyResult{
+		{Kind: "ConfigMap", Name: "config", Operation: ApplyFailed, Message: "invalid"},
+		{Kind: "ConfigMap", Name: "other", Operation: ApplyCreated},
+	}
+	r.auditApply(ctx, instance, "1.2.2", "hash", objects, results, errors.New("1 of 2 objects failed to apply"))
+
+	if len(sink.records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(sink.records))
+	}
+	applied := sink.records[0]
+	if applied.Kind != "Guestbook" || applied.Name != "test" || applied.Generation != 3 || applied.Version != "1.2.3" ||
+		applied.ManifestHash != "hash" || applied.Outcome != AuditSucceeded || applied.Error != "" {
+		t.Errorf("unexpected record %+v", applied)
+	}
+	if expected := []AuditObject{{Kind: "ConfigMap", Name: "config"}}; !reflect.DeepEqual(applied.Objects, expected) {
+		t.Errorf("expected objects %v, got %v", expected, applied.Objects)
+	}
+	failed := sink.records[1]
+	if failed.Version != "1.2.2" || failed.Outcome != AuditPartiallyFailed || len(failed.Objects) != 2 || failed.Objects[0].Operation != "failed" {
+		t.Errorf("unexpected record %+v", failed)
+	}
+}
+
+func TestConfigMapAuditSink(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build()
+	if err := corev1.AddToScheme(c.Scheme()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	name := types.NamespacedName{Namespace: "default", Name: "audit"}
+	if _, err := NewConfigMapAuditSink(c, name, 0); err == nil {
+		t.Errorf("expected an error for a size of 0")
+	}
+	sink, err := NewConfigMapAuditSink(c, name, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, generation := range []int64{1, 2, 3} {
+		if err := sink.RecordApply(ctx, AuditRecord{Name: "test", Generation: generation}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, name, cm); err != nil {
+		t.Fatalf("error getting ConfigMap: %v", err)
+	}
+	var records []AuditRecord
+	if err := json.Unmarshal([]byte(cm.Data[auditRecordsKey]), &records); err != nil {
+		t.Fatalf("error parsing records: %v", err)
+	}
+	if len(records) != 2 || records[0].Generation != 2 || records[1].Generation != 3 {
+		t.Errorf("expected the latest 2 records, got %v", records)
+	}
+}
+
+func TestEncodeAuditRecords(t *testing.T) {
+	records := []AuditRecord{{Name: "first"}, {Name: "second"}, {Name: "third"}}
+	all, err := encodeAuditRecords(records, 1024*1024)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded []AuditRecord
+	if err := json.Unmarshal(all, &decoded); err != nil || !reflect.DeepEqual(decoded, records) {
+		t.Errorf("expected all the records, got %s (%v)", all, err)
+	}
+
+	// Drop the first record only
+	b, err := encodeAuditRecords(records, len(all)-1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decoded = nil
+	if err := json.Unmarshal(b, &decoded); err != nil || !reflect.DeepEqual(decoded, records[1:]) {
+		t.Errorf("expected the latest 2 records, got %s (%v)", b, err)
+	}
+
+	if _, err := encodeAuditRecords(records, 10); err == nil {
+		t.Errorf("expected an error when the latest record doesn't fit")
+	}
+}
+
+func TestWebhookAuditSink(t *testing.T) {
+	var received []AuditRecord
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var record AuditRecord
+		if err := json.NewDecoder(req.Body).Decode(&record); err != nil {
+			t.Errorf("error decoding record: %v", err)
+		}
+		received = append(received, record)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookAuditSink(server.URL, nil)
+	if err := sink.RecordApply(context.Background(), AuditRecord{Name: "test", Outcome: AuditSucceeded}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(received) != 1 || received[0].Name != "test" || received[0].Outcome != AuditSucceeded {
+		t.Errorf("unexpected records received %v", received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.RecordApply(context.Background(), AuditRecord{Name: "test"}); err == nil {
+		t.Errorf("expected an error when the webhook fails")
+	}
+}
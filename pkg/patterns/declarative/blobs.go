@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// BlobPolicy is how the documents of the manifest that can't be parsed as objects, such as a kustomization, are
+// handled.  With WithApplyKustomize, only the documents of the output of kustomize are subject to the policy, as
+// the kustomization files are consumed by kustomize.
+type BlobPolicy string
+
+const (
+	// BlobsDrop logs the documents and leaves them out of the apply, the default
+	BlobsDrop BlobPolicy = "Drop"
+	// BlobsError fails the reconcile if the manifest has documents that aren't objects
+	BlobsError BlobPolicy = "Error"
+	// BlobsPassThrough applies the documents verbatim, after the objects of the manifest.  They are applied without
+	// pruning, and without the labels, owner references and transforms of the objects.
+	BlobsPassThrough BlobPolicy = "PassThrough"
+)
+
+// ReasonInvalidManifest is the reason for a manifest with documents that aren't objects, with BlobsError
+const ReasonInvalidManifest = "InvalidManifest"
+
+// maxBlobSummary is the length of the summary of a document logged or reported in errors
+const maxBlobSummary = 80
+
+// blobPolicy returns how the documents of the manifest that aren't objects are handled
+func (r *Reconciler) blobPolicy() BlobPolicy {
+	if r.options.blobPolicy == "" {
+		return BlobsDrop
+	}
+	return r.options.blobPolicy
+}
+
+// checkBlobs logs the documents of the manifest that aren't objects, and fails with BlobsError if there are any
+func (r *Reconciler) checkBlobs(ctx context.Context, objects *manifest.Objects) error {
+	if len(objects.Blobs) == 0 {
+		return nil
+	}
+	log := log.FromContext(ctx)
+	policy := r.blobPolicy()
+
+	var summaries []string
+	for _, blob := range objects.Blobs {
+		summary := blobSummary(blob)
+		summaries = append(summaries, fmt.Sprintf("%q", summary))
+		log.WithValues("document", summary).WithValues("policy", policy).Info("found document that is not an object in manifest")
+	}
+	if policy == BlobsError {
+		return NewTerminalError(ReasonInvalidManifest, fmt.Errorf("manifest has %d documents that are not objects: %s", len(objects.Blobs), strings.Join(summaries, ", ")))
+	}
+	return nil
+}
+
+// blobSummary returns the first line of blob with content, to identify it in logs and errors
+func blobSummary(blob []byte) string {
+	for _, line := range bytes.Split(blob, []byte("\n")) {
+		l := strings.TrimSpace(string(line))
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if len(l) > maxBlobSummary {
+			l = l[:maxBlobSummary] + "..."
+		}
+		return l
+	}
+	return ""
+}
+
+// applyBlobs applies the documents of the manifest that aren't objects verbatim with BlobsPassThrough
+func (r *Reconciler) applyBlobs(ctx context.Context, ns string, blobs [][]byte, extraArgs []string) error {
+	if r.blobPolicy() != BlobsPassThrough || len(blobs) == 0 {
+		return nil
+	}
+	log.FromContext(ctx).WithValues("documents", len(blobs)).Info("applying documents that are not objects")
+
+	var b bytes.Buffer
+	for i, blob := range blobs {
+		if i != 0 {
+			b.WriteString("\n---\n")
+		}
+		b.Write(blob)
+	}
+	args := append(append(append([]string{}, extraArgs...), impersonationArgs(ctx)...), r.kubeconfigArgs()...)
+	if err := r.kubectl.Apply(r.rateLimitedContext(ctx), ns, b.String(), r.options.validate, args...); err != nil {
+		return fmt.Errorf("error applying documents that are not objects: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const manifestWithBlobs = `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+# settings of the cluster
+settings:
+  replicas: 3
+`
+
+func TestBlobPolicies(t *testing.T) {
+	tests := []struct {
+		policy           BlobPolicy
+		wantErr          string
+		expectedApplied  []string
+		expectedManifest string
+	}{
+		{
+			policy: "",
+		},
+		{
+			policy: BlobsDrop,
+		},
+		{
+			policy:  BlobsError,
+			wantErr: `manifest has 1 documents that are not objects: "settings:"`,
+		},
+		{
+			policy:           BlobsPassThrough,
+			expectedManifest: "# settings of the cluster\nsettings:\n  replicas: 3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			ctx := context.Background()
+			objects, err := manifest.ParseObjects(ctx, manifestWithBlobs)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+			if len(objects.Blobs) != 1 {
+				t.Fatalf("expected the settings to be a blob, got %d blobs", len(objects.Blobs))
+			}
+
+			applier := &recordingApplier{}
+			r := &Reconciler{kubectl: applier}
+			r.options = WithBlobPolicy(test.policy)(r.options)
+
+			err = r.checkBlobs(ctx, objects)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error %q, got %v", test.wantErr, err)
+				}
+				if !IsTerminalError(err) {
+					t.Errorf("expected a terminal error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := r.applyBlobs(ctx, "default", objects.Blobs, []string{"--force"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.expectedManifest == "" {
+				if len(applier.manifests) != 0 {
+					t.Errorf("expected documents not to be applied, got %v", applier.manifests)
+				}
+				return
+			}
+			if len(applier.manifests) != 1 || !strings.HasPrefix(applier.manifests[0], test.expectedManifest) {
+				t.Errorf("expected the documents to be applied verbatim, got %v", applier.manifests)
+			}
+			if !reflect.DeepEqual(applier.args, [][]string{{"--force"}}) {
+				t.Errorf("expected the documents to be applied without pruning, got args %v", applier.args)
+			}
+		})
+	}
+}
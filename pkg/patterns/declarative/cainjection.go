@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// InjectCAFromAnnotation is the annotation asking the cert-manager CA injector to set the caBundle of an object
+// to the CA of the Certificate given as <namespace>/<name>
+const InjectCAFromAnnotation = "cert-manager.io/inject-ca-from"
+
+// CAInjectionTransform returns an ObjectTransform for webhooks whose CA is injected by cert-manager.  The caBundle
+// of ValidatingWebhookConfigurations, MutatingWebhookConfigurations and the conversion webhooks of CRDs is
+// never overwritten, as with WithIgnoredFields, so that reapplying the manifest doesn't remove the injected CA.
+// If certificate is not empty, the objects are annotated to have the CA of that Certificate injected;
+// spec.caInjectFrom of the DeclarativeObject takes precedence over it.  Certificates without a namespace are in
+// the namespace of the DeclarativeObject.
+func CAInjectionTransform(certificate string) ObjectTransform {
+	return func(ctx context.Context, o DeclarativeObject, m *manifest.Objects) error {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+		if err != nil {
+			return fmt.Errorf("error converting object to unstructured: %v", err)
+		}
+		// The transform is shared by the reconciles of every DeclarativeObject, so certificate is left as given
+		cert := certificate
+		if v, found, err := unstructured.NestedString(u, "spec", "caInjectFrom"); err != nil {
+			return fmt.Errorf("error reading spec.caInjectFrom: %v", err)
+		} else if found && v != "" {
+			cert = v
+		}
+		if cert != "" && !strings.Contains(cert, "/") {
+			cert = o.GetNamespace() + "/" + cert
+		}
+
+		return applyCAInjection(ctx, m, cert)
+	}
+}
+
+func applyCAInjection(ctx context.Context, m *manifest.Objects, certificate string) error {
+	log := log.FromContext(ctx)
+	for _, o := range m.Items {
+		path := caBundlePath(o)
+		if path == "" {
+			continue
+		}
+		log.WithValues("kind", o.Kind).WithValues("name", o.Name).WithValues("certificate", certificate).V(1).Info("preserving injected caBundle")
+
+		annotations := o.UnstructuredObject().GetAnnotations()
+		ignored := annotations[IgnoreFieldsAnnotation]
+		if !containsPath(ignored, path) {
+			if ignored != "" {
+				ignored += ","
+			}
+			o.AddAnnotation(IgnoreFieldsAnnotation, ignored+path)
+		}
+		if certificate != "" {
+			o.AddAnnotation(InjectCAFromAnnotation, certificate)
+		}
+	}
+	return nil
+}
+
+// caBundlePath returns the path of the caBundle injected into o, in the format of IgnoredField,
+// or "" if o has no caBundle to inject
+func caBundlePath(o *manifest.Object) string {
+	switch o.GroupKind().String() {
+	case "ValidatingWebhookConfiguration.admissionregistration.k8s.io", "MutatingWebhookConfiguration.admissionregistration.k8s.io":
+		return "webhooks[*].clientConfig.caBundle"
+	case "CustomResourceDefinition.apiextensions.k8s.io":
+		strategy, _, _ := unstructured.NestedString(o.UnstructuredObject().Object, "spec", "conversion", "strategy")
+		if strategy != "Webhook" {
+			return ""
+		}
+		if o.GroupVersionKind().Version == "v1beta1" {
+			return "spec.conversion.webhookClientConfig.caBundle"
+		}
+		return "spec.conversion.webhook.clientConfig.caBundle"
+	}
+	return ""
+}
+
+// containsPath returns true if the comma-separated list of paths includes path
+func containsPath(paths, path string) bool {
+	for _, p := range strings.Split(paths, ",") {
+		if strings.TrimSpace(p) == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestCAInjectionTransform(t *testing.T) {
+	input := `---
+apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: webhook
+webhooks:
+- name: a
+  clientConfig:
+    caBundle: placeholder
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.org
+  annotations:
+    addons.k8s.io/ignore-fields: metadata.labels
+spec:
+  conversion:
+    strategy: Webhook
+    webhook:
+      clientConfig:
+        caBundle: placeholder
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.example.org
+spec:
+  conversion:
+    strategy: None
+`
+	liveCRD := &unstructured.Unstructured{}
+	liveCRD.SetAPIVersion("apiextensions.k8s.io/v1")
+	liveCRD.SetKind("CustomResourceDefinition")
+	liveCRD.SetName("widgets.example.org")
+	if err := unstructured.SetNestedField(liveCRD.Object, "injected", "spec", "conversion", "webhook", "clientConfig", "caBundle"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		certificate string
+		spec        string
+		expected    string
+	}{
+		{name: "no certificate"},
+		{name: "certificate", certificate: "cert-manager/webhook-cert", expected: "cert-manager/webhook-cert"},
+		{name: "certificate in namespace of the object", certificate: "webhook-cert", expected: "default/webhook-cert"},
+		{name: "certificate from spec", certificate: "webhook-cert", spec: "other/serving-cert", expected: "other/serving-cert"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			objects, err := manifest.ParseObjects(ctx, input)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+			instance := newGuestbook("default", "test", time.Now())
+			if test.spec != "" {
+				if err := unstructured.SetNestedField(instance.Object, test.spec, "spec", "caInjectFrom"); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if err := CAInjectionTransform(test.certificate)(ctx, instance, objects); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Transforms run on every reconcile, and mustn't repeat the paths
+			if err := CAInjectionTransform(test.certificate)(ctx, instance, objects); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			webhook, crd, other := objects.Items[0].UnstructuredObject(), objects.Items[1].UnstructuredObject(), objects.Items[2].UnstructuredObject()
+			if v := webhook.GetAnnotations()[IgnoreFieldsAnnotation]; v != "webhooks[*].clientConfig.caBundle" {
+				t.Errorf("unexpected ignored fields of the webhook configuration %q", v)
+			}
+			if v := crd.GetAnnotations()[IgnoreFieldsAnnotation]; v != "metadata.labels,spec.conversion.webhook.clientConfig.caBundle" {
+				t.Errorf("unexpected ignored fields of the CRD %q", v)
+			}
+			if len(other.GetAnnotations()) != 0 {
+				t.Errorf("expected the CRD without conversion webhook to be unchanged, got %v", other.GetAnnotations())
+			}
+			for _, u := range []*unstructured.Unstructured{webhook, crd} {
+				if v := u.GetAnnotations()[InjectCAFromAnnotation]; v != test.expected {
+					t.Errorf("expected %s to have the CA of %q injected, got %q", u.GetName(), test.expected, v)
+				}
+			}
+
+			r := &Reconciler{}
+			if err := r.ignoreFields(objects.Items, map[string]*unstructured.Unstructured{objectKey(objects.Items[1]): liveCRD}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			m, err := objects.JSONManifest()
+			if err != nil {
+				t.Fatalf("error creating manifest: %v", err)
+			}
+			if strings.Contains(m, "placeholder") || !strings.Contains(m, `"caBundle":"injected"`) {
+				t.Errorf("expected the injected caBundle to be preserved, got %s", m)
+			}
+		})
+	}
+}
+
+func TestCAInjectionTransformSharedByObjects(t *testing.T) {
+	ctx := context.Background()
+	transform := CAInjectionTransform("webhook-cert")
+
+	first := newGuestbook("ns1", "test", time.Now())
+	if err := unstructured.SetNestedField(first.Object, "other/serving-cert", "spec", "caInjectFrom"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, test := range []struct {
+		instance *unstructured.Unstructured
+		expected string
+	}{
+		{instance: first, expected: "other/serving-cert"},
+		{instance: newGuestbook("ns2", "test", time.Now()), expected: "ns2/webhook-cert"},
+		{instance: newGuestbook("ns3", "test", time.Now()), expected: "ns3/webhook-cert"},
+	} {
+		objects, err := manifest.ParseObjects(ctx, "apiVersion: admissionregistration.k8s.io/v1\nkind: ValidatingWebhookConfiguration\nmetadata:\n  name: webhook\n")
+		if err != nil {
+			t.Fatalf("error parsing manifest: %v", err)
+		}
+		if err := transform(ctx, test.instance, objects); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v := objects.Items[0].UnstructuredObject().GetAnnotations()[InjectCAFromAnnotation]; v != test.expected {
+			t.Errorf("expected the CA of %q to be injected for %s, got %q", test.expected, test.instance.GetNamespace(), v)
+		}
+	}
+}
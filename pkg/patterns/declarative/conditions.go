@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// ConditionReady is true when the objects for the DeclarativeObject have been applied and are ready
+	ConditionReady = "Ready"
+	// ConditionStalled is set when reconciliation can't make progress without user intervention
+	ConditionStalled = "Stalled"
+	// ConditionReconciling is set while the objects for the DeclarativeObject are still being applied
+	ConditionReconciling = "Reconciling"
+)
+
+// ConditionsObject is implemented by DeclarativeObjects that expose status.conditions,
+// allowing the reconciler to report conditions on typed objects.
+// Unstructured objects, and typed objects with a status.conditions field (such as those
+// embedding the addon CommonStatus), are supported without implementing this interface.
+type ConditionsObject interface {
+	GetConditions() []metav1.Condition
+	SetConditions([]metav1.Condition)
+}
+
+// getConditions returns the conditions of instance, and false if instance doesn't support conditions
+func getConditions(instance DeclarativeObject) ([]metav1.Condition, bool, error) {
+	switch v := instance.(type) {
+	case ConditionsObject:
+		return v.GetConditions(), true, nil
+	case *unstructured.Unstructured:
+		conditions, err := conditionsFromMap(v.Object)
+		return conditions, true, err
+	default:
+		if !hasConditionsField(instance) {
+			return nil, false, nil
+		}
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(instance)
+		if err != nil {
+			return nil, true, fmt.Errorf("error converting object to unstructured: %v", err)
+		}
+		conditions, err := conditionsFromMap(u)
+		return conditions, true, err
+	}
+}
+
+func setConditions(instance DeclarativeObject, conditions []metav1.Condition) error {
+	switch v := instance.(type) {
+	case ConditionsObject:
+		v.SetConditions(conditions)
+	case *unstructured.Unstructured:
+		return setConditionsInMap(v.Object, conditions)
+	default:
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(instance)
+		if err != nil {
+			return fmt.Errorf("error converting object to unstructured: %v", err)
+		}
+		if err := setConditionsInMap(u, conditions); err != nil {
+			return err
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, instance); err != nil {
+			return fmt.Errorf("error converting object from unstructured: %v", err)
+		}
+	}
+	return nil
+}
+
+// hasConditionsField returns true if the typed object keeps status.conditions when converted from unstructured
+func hasConditionsField(instance DeclarativeObject) bool {
+	probe := instance.DeepCopyObject()
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(probe)
+	if err != nil {
+		return false
+	}
+	if err := unstructured.SetNestedSlice(u, []interface{}{map[string]interface{}{"type": ConditionReady}}, "status", "conditions"); err != nil {
+		return false
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, probe); err != nil {
+		return false
+	}
+	u, err = runtime.DefaultUnstructuredConverter.ToUnstructured(probe)
+	if err != nil {
+		return false
+	}
+	_, found, _ := unstructured.NestedSlice(u, "status", "conditions")
+	return found
+}
+
+func conditionsFromMap(obj map[string]interface{}) ([]metav1.Condition, error) {
+	list, _, err := unstructured.NestedSlice(obj, "status", "conditions")
+	if err != nil {
+		return nil, fmt.Errorf("error reading status.conditions: %v", err)
+	}
+	var conditions []metav1.Condition
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("status.conditions[%d] was not an object", i)
+		}
+		var condition metav1.Condition
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &condition); err != nil {
+			return nil, fmt.Errorf("error parsing status.conditions[%d]: %v", i, err)
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+func setConditionsInMap(obj map[string]interface{}, conditions []metav1.Condition) error {
+	list := make([]interface{}, 0, len(conditions))
+	for i := range conditions {
+		m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&conditions[i])
+		if err != nil {
+			return fmt.Errorf("error converting condition: %v", err)
+		}
+		list = append(list, m)
+	}
+	if err := unstructured.SetNestedSlice(obj, list, "status", "conditions"); err != nil {
+		return fmt.Errorf("error setting status.conditions: %v", err)
+	}
+	return nil
+}
+
+// setCondition sets condition on instance, returning true if the conditions changed.
+// Objects that don't support conditions are left unchanged.
+func setCondition(instance DeclarativeObject, condition metav1.Condition) (bool, error) {
+	conditions, supported, err := getConditions(instance)
+	if err != nil || !supported {
+		return false, err
+	}
+
+	existing := meta.FindStatusCondition(conditions, condition.Type)
+	if existing != nil && existing.Status == condition.Status && existing.Reason == condition.Reason &&
+		existing.Message == condition.Message && existing.ObservedGeneration == condition.ObservedGeneration {
+		return false, nil
+	}
+
+	meta.SetStatusCondition(&conditions, condition)
+	return true, setConditions(instance, conditions)
+}
+
+// removeCondition removes the condition of type conditionType if it has the given reason,
+// returning true if the conditions changed
+func removeCondition(instance DeclarativeObject, conditionType string, reason string) (bool, error) {
+	conditions, supported, err := getConditions(instance)
+	if err != nil || !supported {
+		return false, err
+	}
+
+	existing := meta.FindStatusCondition(conditions, conditionType)
+	if existing == nil || existing.Reason != reason {
+		return false, nil
+	}
+
+	meta.RemoveStatusCondition(&conditions, conditionType)
+	return true, setConditions(instance, conditions)
+}
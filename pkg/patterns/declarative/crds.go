@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+var (
+	// crdEstablishedInterval is how often we check whether CRDs are established
+	crdEstablishedInterval = time.Second
+	// crdEstablishedTimeout is how long we wait for CRDs to be established
+	crdEstablishedTimeout = 30 * time.Second
+)
+
+// crdsForCustomResources returns the CustomResourceDefinitions in the manifest that define
+// the kind of another object in the manifest
+func crdsForCustomResources(objects *manifest.Objects) []*manifest.Object {
+	used := make(map[schema.GroupKind]bool)
+	for _, o := range objects.Items {
+		used[o.GroupKind()] = true
+	}
+
+	var crds []*manifest.Object
+	for _, o := range objects.Items {
+		if o.Group != "apiextensions.k8s.io" || o.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		u := o.UnstructuredObject().Object
+		group, _, _ := unstructured.NestedString(u, "spec", "group")
+		kind, _, _ := unstructured.NestedString(u, "spec", "names", "kind")
+		if used[schema.GroupKind{Group: group, Kind: kind}] {
+			crds = append(crds, o)
+		}
+	}
+	return crds
+}
+
+// applyCRDsFirst applies the CRDs for custom resources in the manifest, and waits for them to
+// be established, so that the custom resources can be applied without "no matches for kind" errors
+func (r *Reconciler) applyCRDsFirst(ctx context.Context, ns string, objects *manifest.Objects, extraArgs []string) error {
+	log := log.FromContext(ctx)
+
+	crds := crdsForCustomResources(objects)
+	if len(crds) == 0 {
+		return nil
+	}
+
+	m, err := (&manifest.Objects{Items: crds}).JSONManifest()
+	if err != nil {
+		return fmt.Errorf("error creating CRD manifest: %v", err)
+	}
+	log.WithValues("crds", len(crds)).Info("applying CRDs before custom resources")
+	args := append(append(append([]string{}, extraArgs...), impersonationArgs(ctx)...), r.kubeconfigArgs()...)
+	if err := r.kubectl.Apply(r.rateLimitedContext(ctx), ns, m, r.options.validate, args...); err != nil {
+		return fmt.Errorf("error applying CRDs: %v", err)
+	}
+
+	// Stop waiting if the reconcile is cancelled or times out
+	waitCtx, cancel := context.WithTimeout(ctx, crdEstablishedTimeout)
+	defer cancel()
+	err = wait.PollImmediateUntil(crdEstablishedInterval, func() (bool, error) {
+		for _, crd := range crds {
+			u, err := GetObjectFromCluster(ctx, crd, r)
+			if err != nil {
+				log.WithValues("name", crd.Name).WithValues("error", err).V(1).Info("CRD not yet found")
+				return false, nil
+			}
+			if !crdEstablished(u) {
+				log.WithValues("name", crd.Name).V(1).Info("CRD not yet established")
+				return false, nil
+			}
+		}
+		return true, nil
+	}, waitCtx.Done())
+	if err != nil {
+		return fmt.Errorf("error waiting for CRDs to be established: %v", err)
+	}
+
+	// Discover the new kinds
+	r.resetRESTMapper(ctx)
+	return nil
+}
+
+// crdEstablished returns true if the CRD has the Established condition
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestApplyCRDsFirst(t *testing.T) {
+	inputManifest := `---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.org
+spec:
+  group: example.org
+  names:
+    kind: Widget
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.example.org
+spec:
+  group: example.org
+  names:
+    kind: Gadget
+---
+apiVersion: example.org/v1
+kind: Widget
+metadata:
+  name: widget
+`
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+
+	defer func(interval, timeout time.Duration) {
+		crdEstablishedInterval, crdEstablishedTimeout = interval, timeout
+	}(crdEstablishedInterval, crdEstablishedTimeout)
+	crdEstablishedInterval, crdEstablishedTimeout = 10*time.Millisecond, 50*time.Millisecond
+
+	for _, established := range []bool{true, false} {
+		objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+		if err != nil {
+			t.Fatalf("error parsing manifest: %v", err)
+		}
+
+		crd := objects.Items[0].UnstructuredObject().DeepCopy()
+		if established {
+			unstructured.SetNestedSlice(crd.Object, []interface{}{
+				map[string]interface{}{"type": "Established", "status": "True"},
+			}, "status", "conditions")
+		}
+
+		applier := &recordingApplier{}
+		r := &Reconciler{
+			kubectl:       applier,
+			restMapper:    mapper,
+			dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), crd),
+		}
+
+		err = r.applyCRDsFirst(context.Background(), "", objects, []string{"--force"})
+		if established && err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !established && err == nil {
+			t.Fatalf("expected error waiting for CRD to be established")
+		}
+
+		if len(applier.manifests) != 1 {
+			t.Fatalf("expected CRDs to be applied once, got %d applies", len(applier.manifests))
+		}
+		applied := applier.manifests[0]
+		if !strings.Contains(applied, "widgets.example.org") || strings.Contains(applied, "gadgets.example.org") || strings.Contains(applied, `"name":"widget"`) {
+			t.Errorf("expected only the Widget CRD to be applied, got %s", applied)
+		}
+	}
+}
+
+func TestApplyCRDsFirstStopsWhenCancelled(t *testing.T) {
+	inputManifest := `---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.org
+spec:
+  group: example.org
+  names:
+    kind: Widget
+---
+apiVersion: example.org/v1
+kind: Widget
+metadata:
+  name: widget
+`
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+
+	objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	// The CRD is never established
+	r := &Reconciler{
+		kubectl:       &recordingApplier{},
+		restMapper:    mapper,
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects.Items[0].UnstructuredObject().DeepCopy()),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := r.applyCRDsFirst(ctx, "", objects, nil); err == nil {
+		t.Fatalf("expected error waiting for CRD to be established")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected to stop waiting once the context was done, took %v", elapsed)
+	}
+}
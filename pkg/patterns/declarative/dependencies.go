@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// DependsOnAnnotation lists the objects in the manifest that must be applied before the annotated object,
+// as a comma separated list of Kind/name or group/Kind/name references.
+const DependsOnAnnotation = "addons.k8s.io/depends-on"
+
+// sortByDependencies reorders objects so that each object comes after the objects it depends on.
+// Otherwise the existing order is preserved, so objects without dependencies keep the DefaultObjectOrder.
+func sortByDependencies(objects *manifest.Objects) error {
+	items := objects.Items
+
+	// dependsOn[i] holds the indexes of the objects that items[i] depends on
+	dependsOn := make([][]int, len(items))
+	hasDependencies := false
+	for i, o := range items {
+		refs, found := o.UnstructuredObject().GetAnnotations()[DependsOnAnnotation]
+		if !found {
+			continue
+		}
+		for _, ref := range strings.Split(refs, ",") {
+			ref = strings.TrimSpace(ref)
+			if ref == "" {
+				continue
+			}
+			matches, err := findDependencies(items, ref)
+			if err != nil {
+				return fmt.Errorf("invalid %s annotation on %s %s: %v", DependsOnAnnotation, o.Kind, o.Name, err)
+			}
+			dependsOn[i] = append(dependsOn[i], matches...)
+			hasDependencies = true
+		}
+	}
+	if !hasDependencies {
+		return nil
+	}
+
+	// Depth first, visiting objects in their existing order
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(items))
+	sorted := make([]*manifest.Object, 0, len(items))
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s/%s", strings.Join(path, " -> "), items[i].Kind, items[i].Name)
+		}
+		state[i] = visiting
+		path = append(path, items[i].Kind+"/"+items[i].Name)
+		for _, dep := range dependsOn[i] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		sorted = append(sorted, items[i])
+		return nil
+	}
+
+	for i := range items {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	objects.Items = sorted
+	return nil
+}
+
+// findDependencies returns the indexes of the objects matching ref
+func findDependencies(items []*manifest.Object, ref string) ([]int, error) {
+	var group, kind, name string
+	parts := strings.Split(ref, "/")
+	switch len(parts) {
+	case 2:
+		kind, name = parts[0], parts[1]
+	case 3:
+		group, kind, name = parts[0], parts[1], parts[2]
+	default:
+		return nil, fmt.Errorf("reference %q must be of the form Kind/name or group/Kind/name", ref)
+	}
+
+	var matches []int
+	for i, o := range items {
+		if o.Kind == kind && o.Name == name && (len(parts) == 2 || o.Group == group) {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%q does not match any object in the manifest", ref)
+	}
+	return matches, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestSortByDependencies(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		expected []string
+		wantErr  string
+	}{
+		{
+			name: "no dependencies",
+			manifest: `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: a
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: b
+`,
+			expected: []string{"ConfigMap/a", "ConfigMap/b"},
+		},
+		{
+			name: "dependencies are moved earlier",
+			manifest: `
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: app
+  annotations:
+    addons.k8s.io/depends-on: ConfigMap/config, apps/Deployment/db
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: unrelated
+---
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: db
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: config
+`,
+			expected: []string{"ConfigMap/config", "Deployment/db", "Deployment/app", "ConfigMap/unrelated"},
+		},
+		{
+			name: "cycle",
+			manifest: `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: a
+  annotations:
+    addons.k8s.io/depends-on: ConfigMap/b
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: b
+  annotations:
+    addons.k8s.io/depends-on: ConfigMap/a
+`,
+			wantErr: "dependency cycle: ConfigMap/a -> ConfigMap/b -> ConfigMap/a",
+		},
+		{
+			name: "missing dependency",
+			manifest: `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: a
+  annotations:
+    addons.k8s.io/depends-on: Secret/missing
+`,
+			wantErr: "does not match any object",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := manifest.ParseObjects(context.Background(), test.manifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+
+			err = sortByDependencies(objects)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var actual []string
+			for _, o := range objects.Items {
+				actual = append(actual, o.Kind+"/"+o.Name)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("unexpected order, expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
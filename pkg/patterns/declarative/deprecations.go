@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const (
+	// ConditionDeprecatedAPIs is true when objects of the manifest use deprecated API versions, with WithDeprecatedAPIReport
+	ConditionDeprecatedAPIs = "DeprecatedAPIs"
+	// ReasonDeprecatedAPIsUsed is the reason for a true ConditionDeprecatedAPIs
+	ReasonDeprecatedAPIsUsed = "DeprecatedAPIsUsed"
+)
+
+// DeprecatedAPI is an API version of a kind that is deprecated, and removed in the Kubernetes version RemovedIn
+type DeprecatedAPI struct {
+	Kind       string
+	APIVersion string
+	RemovedIn  string
+	// Replacement is the API version to use instead, if any
+	Replacement string
+}
+
+// DefaultDeprecatedAPIs are the deprecated API versions reported by WithDeprecatedAPIReport unless others are given
+var DefaultDeprecatedAPIs = []DeprecatedAPI{
+	{Kind: "Ingress", APIVersion: "extensions/v1beta1", RemovedIn: "1.22", Replacement: "networking.k8s.io/v1"},
+	{Kind: "Ingress", APIVersion: "networking.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "networking.k8s.io/v1"},
+	{Kind: "IngressClass", APIVersion: "networking.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "networking.k8s.io/v1"},
+	{Kind: "CustomResourceDefinition", APIVersion: "apiextensions.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "apiextensions.k8s.io/v1"},
+	{Kind: "MutatingWebhookConfiguration", APIVersion: "admissionregistration.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "admissionregistration.k8s.io/v1"},
+	{Kind: "ValidatingWebhookConfiguration", APIVersion: "admissionregistration.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "admissionregistration.k8s.io/v1"},
+	{Kind: "APIService", APIVersion: "apiregistration.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "apiregistration.k8s.io/v1"},
+	{Kind: "Role", APIVersion: "rbac.authorization.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "rbac.authorization.k8s.io/v1"},
+	{Kind: "RoleBinding", APIVersion: "rbac.authorization.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "rbac.authorization.k8s.io/v1"},
+	{Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "rbac.authorization.k8s.io/v1"},
+	{Kind: "ClusterRoleBinding", APIVersion: "rbac.authorization.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "rbac.authorization.k8s.io/v1"},
+	{Kind: "PriorityClass", APIVersion: "scheduling.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "scheduling.k8s.io/v1"},
+	{Kind: "StorageClass", APIVersion: "storage.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "storage.k8s.io/v1"},
+	{Kind: "CSIDriver", APIVersion: "storage.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "storage.k8s.io/v1"},
+	{Kind: "Lease", APIVersion: "coordination.k8s.io/v1beta1", RemovedIn: "1.22", Replacement: "coordination.k8s.io/v1"},
+	{Kind: "CronJob", APIVersion: "batch/v1beta1", RemovedIn: "1.25", Replacement: "batch/v1"},
+	{Kind: "PodDisruptionBudget", APIVersion: "policy/v1beta1", RemovedIn: "1.25", Replacement: "policy/v1"},
+	{Kind: "PodSecurityPolicy", APIVersion: "policy/v1beta1", RemovedIn: "1.25"},
+	{Kind: "EndpointSlice", APIVersion: "discovery.k8s.io/v1beta1", RemovedIn: "1.25", Replacement: "discovery.k8s.io/v1"},
+	{Kind: "RuntimeClass", APIVersion: "node.k8s.io/v1beta1", RemovedIn: "1.25", Replacement: "node.k8s.io/v1"},
+	{Kind: "HorizontalPodAutoscaler", APIVersion: "autoscaling/v2beta1", RemovedIn: "1.25", Replacement: "autoscaling/v2"},
+	{Kind: "HorizontalPodAutoscaler", APIVersion: "autoscaling/v2beta2", RemovedIn: "1.26", Replacement: "autoscaling/v2"},
+}
+
+// deprecatedAPIUses returns a line for each object of objects using one of the deprecated APIs
+func deprecatedAPIUses(objects []*manifest.Object, deprecated []DeprecatedAPI) []string {
+	var uses []string
+	for _, o := range objects {
+		apiVersion := o.UnstructuredObject().GetAPIVersion()
+		for _, api := range deprecated {
+			if api.Kind != o.Kind || api.APIVersion != apiVersion {
+				continue
+			}
+			use := fmt.Sprintf("%s %s uses %s, removed in Kubernetes %s", o.Kind, o.Name, apiVersion, api.RemovedIn)
+			if api.Replacement != "" {
+				use += ", use " + api.Replacement
+			}
+			uses = append(uses, use)
+			break
+		}
+	}
+	return uses
+}
+
+// reportDeprecatedAPIs sets ConditionDeprecatedAPIs on instance listing the objects using deprecated APIs, or
+// removes it if none do
+func (r *Reconciler) reportDeprecatedAPIs(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+	uses := deprecatedAPIUses(objects.Items, r.options.deprecatedAPIs)
+
+	var changed bool
+	var err error
+	if len(uses) == 0 {
+		changed, err = removeCondition(instance, ConditionDeprecatedAPIs, ReasonDeprecatedAPIsUsed)
+	} else {
+		changed, err = setCondition(instance, metav1.Condition{
+			Type:               ConditionDeprecatedAPIs,
+			Status:             metav1.ConditionTrue,
+			Reason:             ReasonDeprecatedAPIsUsed,
+			Message:            strings.Join(uses, "; "),
+			ObservedGeneration: instance.GetGeneration(),
+		})
+	}
+	if err != nil || !changed {
+		return err
+	}
+
+	if len(uses) != 0 {
+		log.FromContext(ctx).WithValues("objects", uses).Info("manifest uses deprecated APIs")
+		if r.recorder != nil {
+			r.recorder.Event(instance, "Warning", ReasonDeprecatedAPIsUsed, fmt.Sprintf("%d objects use deprecated APIs", len(uses)))
+		}
+	}
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestReportDeprecatedAPIs(t *testing.T) {
+	ctx := context.Background()
+	instance := newGuestbook("default", "test", time.Now())
+	r := &Reconciler{
+		client:  fake.NewClientBuilder().WithObjects(instance).Build(),
+		options: WithDeprecatedAPIReport()(reconcilerParams{}),
+	}
+
+	deprecated, err := manifest.ParseObjects(ctx, `---
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: frontend
+---
+apiVersion: policy/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: restricted
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.reportDeprecatedAPIs(ctx, instance, deprecated); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	conditions, _, err := getConditions(instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	condition := meta.FindStatusCondition(conditions, ConditionDeprecatedAPIs)
+	expected := "PodDisruptionBudget frontend uses policy/v1beta1, removed in Kubernetes 1.25, use policy/v1; " +
+		"PodSecurityPolicy restricted uses policy/v1beta1, removed in Kubernetes 1.25"
+	if condition == nil || condition.Reason != ReasonDeprecatedAPIsUsed || condition.Message != expected {
+		t.Fatalf("unexpected DeprecatedAPIs condition %v", condition)
+	}
+
+	// The condition is removed once no objects use deprecated APIs
+	if err := r.reportDeprecatedAPIs(ctx, instance, &manifest.Objects{Items: deprecated.Items[2:]}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conditions, _, err = getConditions(instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if condition := meta.FindStatusCondition(conditions, ConditionDeprecatedAPIs); condition != nil {
+		t.Errorf("expected the DeprecatedAPIs condition to be removed, got %v", condition)
+	}
+}
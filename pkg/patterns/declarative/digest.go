@@ -0,0 +1,295 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// DigestResolver resolves an image reference to the digest of its manifest, eg "sha256:..."
+type DigestResolver interface {
+	ResolveDigest(ctx context.Context, image string) (string, error)
+}
+
+// ImageDigestTransform returns an ObjectTransform that pins the container images of all Pods
+// to their digest, so that the applied workloads don't change if a tag is moved.
+// Images that already reference a digest are left alone.
+// If resolver is nil, images are resolved against their registry, caching results for 10 minutes.
+// If failOnError is false, images that can't be resolved are left unpinned.
+func ImageDigestTransform(resolver DigestResolver, failOnError bool) ObjectTransform {
+	if resolver == nil {
+		resolver = NewCachingDigestResolver(&RegistryDigestResolver{}, 10*time.Minute)
+	}
+	return func(ctx context.Context, o DeclarativeObject, m *manifest.Objects) error {
+		return applyImageDigests(ctx, m, resolver, failOnError)
+	}
+}
+
+func applyImageDigests(ctx context.Context, manifest *manifest.Objects, resolver DigestResolver, failOnError bool) error {
+	log := log.FromContext(ctx)
+	for _, manifestItem := range manifest.Items {
+		if manifestItem.HasPodTemplate() {
+			var resolveErr error
+			err := manifestItem.MutatePodSpec(mutatePodSpecImages(func(image string) string {
+				if image == "" || strings.Contains(image, "@") {
+					return image
+				}
+				digest, err := resolver.ResolveDigest(ctx, image)
+				if err != nil {
+					if failOnError && resolveErr == nil {
+						resolveErr = fmt.Errorf("error resolving digest for image %q: %v", image, err)
+					}
+					log.WithValues("image", image).WithValues("error", err).Info("unable to resolve image digest, leaving image unpinned")
+					return image
+				}
+				log.WithValues("image", image).WithValues("digest", digest).V(1).Info("pinning image to digest")
+				return imageName(image) + "@" + digest
+			}))
+			if err != nil {
+				return fmt.Errorf("error pinning image digests: %v", err)
+			}
+			if resolveErr != nil {
+				return resolveErr
+			}
+		}
+	}
+	return nil
+}
+
+// CachingDigestResolver caches the digests returned by another DigestResolver
+type CachingDigestResolver struct {
+	resolver DigestResolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedDigest
+}
+
+type cachedDigest struct {
+	digest  string
+	expires time.Time
+}
+
+// NewCachingDigestResolver returns a DigestResolver that caches the digests from resolver for ttl.
+// Failures are not cached.
+func NewCachingDigestResolver(resolver DigestResolver, ttl time.Duration) *CachingDigestResolver {
+	return &CachingDigestResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]cachedDigest),
+	}
+}
+
+// ResolveDigest implements DigestResolver
+func (c *CachingDigestResolver) ResolveDigest(ctx context.Context, image string) (string, error) {
+	c.mu.Lock()
+	entry, found := c.entries[image]
+	c.mu.Unlock()
+	if found && time.Now().Before(entry.expires) {
+		return entry.digest, nil
+	}
+
+	digest, err := c.resolver.ResolveDigest(ctx, image)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[image] = cachedDigest{digest: digest, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return digest, nil
+}
+
+// RegistryDigestResolver resolves digests using the Docker Registry HTTP API V2,
+// authenticating anonymously when the registry requires a bearer token.
+type RegistryDigestResolver struct {
+	// Client is used for requests to the registry, http.DefaultClient is used if nil
+	Client *http.Client
+	// PlainHTTP uses http instead of https to talk to registries
+	PlainHTTP bool
+}
+
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// ResolveDigest implements DigestResolver
+func (r *RegistryDigestResolver) ResolveDigest(ctx context.Context, image string) (string, error) {
+	registry, repository, tag := splitImage(image)
+
+	scheme := "https"
+	if r.PlainHTTP {
+		scheme = "http"
+	}
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, registry, repository, tag)
+
+	resp, err := r.headManifest(ctx, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := r.fetchToken(ctx, resp.Header.Get("Www-Authenticate"))
+		if err != nil {
+			return "", err
+		}
+		resp, err = r.headManifest(ctx, manifestURL, token)
+		if err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status fetching manifest %s: %s", manifestURL, resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s", manifestURL)
+	}
+	return digest, nil
+}
+
+func (r *RegistryDigestResolver) client() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	return http.DefaultClient
+}
+
+func (r *RegistryDigestResolver) headManifest(ctx context.Context, manifestURL string, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching manifest %s: %v", manifestURL, err)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// fetchToken requests an anonymous token from the realm in a bearer challenge
+func (r *RegistryDigestResolver) fetchToken(ctx context.Context, challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("authentication challenge %q did not include a realm", challenge)
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("error parsing realm %q: %v", realm, err)
+	}
+	q := tokenURL.Query()
+	for _, k := range []string{"service", "scope"} {
+		if v := params[k]; v != "" {
+			q.Set(k, v)
+		}
+	}
+	tokenURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching token from %s: %v", realm, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status fetching token from %s: %s", realm, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error parsing token response: %v", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of a WWW-Authenticate challenge
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end == -1 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if comma := strings.Index(s, ","); comma != -1 {
+			value, s = s[:comma], s[comma:]
+		} else {
+			value, s = s, ""
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// splitImage splits an image reference into the registry host, repository and tag
+func splitImage(image string) (registry, repository, tag string) {
+	name := imageName(image)
+	tag = "latest"
+	if len(image) > len(name) && image[len(name)] == ':' {
+		tag = image[len(name)+1:]
+	}
+
+	parts := strings.SplitN(normalizeImage(name), "/", 2)
+	registry, repository = parts[0], parts[1]
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+	}
+	return registry, repository, tag
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image      string
+		registry   string
+		repository string
+		tag        string
+	}{
+		{image: "nginx", registry: "registry-1.docker.io", repository: "library/nginx", tag: "latest"},
+		{image: "bitnami/redis:6.0", registry: "registry-1.docker.io", repository: "bitnami/redis", tag: "6.0"},
+		{image: "gcr.io/google-samples/gb-frontend:v4", registry: "gcr.io", repository: "google-samples/gb-frontend", tag: "v4"},
+		{image: "localhost:5000/app", registry: "localhost:5000", repository: "app", tag: "latest"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			registry, repository, tag := splitImage(test.image)
+			if registry != test.registry || repository != test.repository || tag != test.tag {
+				t.Errorf("expected (%q, %q, %q), got (%q, %q, %q)", test.registry, test.repository, test.tag, registry, repository, tag)
+			}
+		})
+	}
+}
+
+func TestRegistryDigestResolver(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.URL.Query().Get("scope") != "repository:samples/app:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token": "secret"}`)
+		case r.URL.Path == "/v2/samples/app/manifests/v1":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:samples/app:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", testDigest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	resolver := &RegistryDigestResolver{Client: server.Client(), PlainHTTP: true}
+
+	digest, err := resolver.ResolveDigest(context.Background(), host+"/samples/app:v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if digest != testDigest {
+		t.Errorf("expected digest %q, got %q", testDigest, digest)
+	}
+
+	if _, err := resolver.ResolveDigest(context.Background(), host+"/samples/app:v2"); err == nil {
+		t.Errorf("expected error resolving unknown tag, got none")
+	}
+}
+
+type fakeDigestResolver struct {
+	digests map[string]string
+	calls   int
+}
+
+func (f *fakeDigestResolver) ResolveDigest(ctx context.Context, image string) (string, error) {
+	f.calls++
+	digest, ok := f.digests[image]
+	if !ok {
+		return "", fmt.Errorf("image %q not found", image)
+	}
+	return digest, nil
+}
+
+func TestImageDigestTransform(t *testing.T) {
+	inputManifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: gcr.io/google-samples/gb-frontend:v4
+      - name: sidecar
+        image: gcr.io/google-samples/sidecar:v1
+      - name: pinned
+        image: gcr.io/google-samples/pinned@sha256:abcd
+`
+
+	tests := []struct {
+		name        string
+		digests     map[string]string
+		failOnError bool
+		expected    []string
+		wantErr     bool
+	}{
+		{
+			name: "all images resolved",
+			digests: map[string]string{
+				"gcr.io/google-samples/gb-frontend:v4": testDigest,
+				"gcr.io/google-samples/sidecar:v1":     testDigest,
+			},
+			expected: []string{
+				"gcr.io/google-samples/gb-frontend@" + testDigest,
+				"gcr.io/google-samples/sidecar@" + testDigest,
+				"gcr.io/google-samples/pinned@sha256:abcd",
+			},
+		},
+		{
+			name: "unresolved image left unpinned",
+			digests: map[string]string{
+				"gcr.io/google-samples/gb-frontend:v4": testDigest,
+			},
+			expected: []string{
+				"gcr.io/google-samples/gb-frontend@" + testDigest,
+				"gcr.io/google-samples/sidecar:v1",
+				"gcr.io/google-samples/pinned@sha256:abcd",
+			},
+		},
+		{
+			name: "unresolved image fails",
+			digests: map[string]string{
+				"gcr.io/google-samples/gb-frontend:v4": testDigest,
+			},
+			failOnError: true,
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+
+			transform := ImageDigestTransform(&fakeDigestResolver{digests: test.digests}, test.failOnError)
+			err = transform(context.Background(), &unstructured.Unstructured{}, objects)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			containers, _, _ := unstructured.NestedSlice(objects.Items[0].UnstructuredObject().Object, "spec", "template", "spec", "containers")
+			for i, image := range test.expected {
+				if actual := containers[i].(map[string]interface{})["image"]; actual != image {
+					t.Errorf("unexpected image for container %d, expected %q, got %q", i, image, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestCachingDigestResolver(t *testing.T) {
+	fake := &fakeDigestResolver{digests: map[string]string{"nginx:1.19": testDigest}}
+	resolver := NewCachingDigestResolver(fake, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if _, err := resolver.ResolveDigest(context.Background(), "nginx:1.19"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := resolver.ResolveDigest(context.Background(), "nginx:missing"); err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	}
+	// One call for the cached image, and one for each attempt at the missing one
+	if fake.calls != 4 {
+		t.Errorf("expected 4 calls to the underlying resolver, got %d", fake.calls)
+	}
+}
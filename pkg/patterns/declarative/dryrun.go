@@ -0,0 +1,385 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/kubectl/pkg/cmd/apply"
+	kubectlutil "k8s.io/kubectl/pkg/util"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DryRunAnnotation on a DeclarativeObject, set to "true", previews changes rather than applying them with WithDryRunPreview
+	DryRunAnnotation = "addons.k8s.io/dry-run"
+
+	// ConditionDryRun is true when changes to the objects were previewed rather than applied
+	ConditionDryRun = "DryRun"
+	// ReasonChangesPending is the reason for a true ConditionDryRun when applying the manifest would change some objects
+	ReasonChangesPending = "ChangesPending"
+	// ReasonNoChanges is the reason for a true ConditionDryRun when applying the manifest would change nothing
+	ReasonNoChanges = "NoChanges"
+)
+
+// ObjectDiff is the change applying the manifest would make to an object
+type ObjectDiff struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+
+	// Operation is ApplyCreated, ApplyConfigured or ApplyUnchanged
+	Operation ApplyOperation
+	// Diff is a unified diff between the live object and the result of the dry-run, as YAML
+	Diff string
+}
+
+func (d ObjectDiff) String() string {
+	return ApplyResult{Group: d.Group, Kind: d.Kind, Namespace: d.Namespace, Name: d.Name, Operation: d.Operation}.String()
+}
+
+// DryRunSink is implemented by Sinks that should be notified of the previewed changes in dry-run mode.
+// Sinks are not notified of applied objects in dry-run mode, as nothing is applied.
+type DryRunSink interface {
+	NotifyDryRun(ctx context.Context, dest DeclarativeObject, diffs []ObjectDiff) error
+}
+
+type dryRunDiffsKey struct{}
+
+func contextWithDryRunDiffs(ctx context.Context, diffs []ObjectDiff) context.Context {
+	return context.WithValue(ctx, dryRunDiffsKey{}, diffs)
+}
+
+// DryRunDiffsFromContext returns the previewed changes to each object, when called from a Status.
+// It returns nil unless the changes were previewed rather than applied.
+func DryRunDiffsFromContext(ctx context.Context) []ObjectDiff {
+	diffs, _ := ctx.Value(dryRunDiffsKey{}).([]ObjectDiff)
+	return diffs
+}
+
+// isDryRun returns true if changes for instance should be previewed rather than applied
+func (r *Reconciler) isDryRun(instance DeclarativeObject) bool {
+	if r.options.dryRunAll {
+		return true
+	}
+	return r.options.dryRun && instance.GetAnnotations()[DryRunAnnotation] == "true"
+}
+
+// dryRun previews the changes applying the manifest would make, with a server-side dry-run, and publishes them
+// in the DryRun condition, an event, and the DryRunSink.  Nothing is applied.
+func (r *Reconciler) dryRun(ctx context.Context, instance DeclarativeObject, ns string, objects *manifest.Objects) (context.Context, error) {
+	log := log.FromContext(ctx)
+
+	diffs, err := r.previewChanges(ctx, ns, objects)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = contextWithDryRunDiffs(ctx, diffs)
+
+	condition := changesCondition(ConditionDryRun, instance, diffs)
+	log.WithValues("reason", condition.Reason).Info("previewed changes in dry-run mode, not applying")
+	if err := r.setPreviewCondition(ctx, instance, condition); err != nil {
+		return ctx, err
+	}
+
+	err = r.notifySinks(ctx, func(sink Sink) error {
+		if sink, ok := sink.(DryRunSink); ok {
+			return sink.NotifyDryRun(ctx, instance, diffs)
+		}
+		return nil
+	})
+	if err != nil {
+		return ctx, fmt.Errorf("error notifying sinks of dry-run: %v", err)
+	}
+	return ctx, nil
+}
+
+// previewChanges returns the changes applying objects would make, with a server-side dry-run
+func (r *Reconciler) previewChanges(ctx context.Context, ns string, objects *manifest.Objects) ([]ObjectDiff, error) {
+	var diffs []ObjectDiff
+	for _, o := range objects.Items {
+		diff, err := r.dryRunObject(ctx, ns, o)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// changesCondition returns a true condition of type conditionType, with reason ReasonChangesPending and a summary
+// of the changed objects if diffs changes any objects, or ReasonNoChanges
+func changesCondition(conditionType string, instance DeclarativeObject, diffs []ObjectDiff) metav1.Condition {
+	var changed []string
+	for _, diff := range diffs {
+		if diff.Operation != ApplyUnchanged {
+			changed = append(changed, diff.String())
+		}
+	}
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonNoChanges,
+		Message:            "Applying the manifest would not change any objects",
+		ObservedGeneration: instance.GetGeneration(),
+	}
+	if len(changed) != 0 {
+		summary := changed
+		if len(summary) > maxReportedFailures {
+			summary = append(summary[:maxReportedFailures:maxReportedFailures], fmt.Sprintf("and %d more", len(changed)-maxReportedFailures))
+		}
+		condition.Reason = ReasonChangesPending
+		condition.Message = fmt.Sprintf("Applying the manifest would change %d of %d objects: %s", len(changed), len(diffs), strings.Join(summary, "; "))
+	}
+	return condition
+}
+
+// setPreviewCondition sets condition on instance, recording an event when it changes
+func (r *Reconciler) setPreviewCondition(ctx context.Context, instance DeclarativeObject, condition metav1.Condition) error {
+	updated, err := setCondition(instance, condition)
+	if err != nil || !updated {
+		return err
+	}
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	if r.recorder != nil {
+		r.recorder.Event(instance, "Normal", condition.Reason, condition.Message)
+	}
+	return nil
+}
+
+// dryRunObject applies o with a server-side dry-run, and compares the result with the live object
+func (r *Reconciler) dryRunObject(ctx context.Context, ns string, o *manifest.Object) (ObjectDiff, error) {
+	gvk := o.GroupVersionKind()
+	mapping, err := r.restMapping(ctx, o.GroupKind(), gvk.Version)
+	if err != nil {
+		return ObjectDiff{}, fmt.Errorf("unable to get mapping for %s: %v", o.Kind, err)
+	}
+	u := o.UnstructuredObject()
+	namespace := ""
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace = u.GetNamespace()
+		if namespace == "" {
+			namespace = ns
+		}
+	}
+	resource, err := r.objectResource(ctx, ns, o)
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+
+	live, result, err := r.dryRunApply(ctx, resource, o)
+	if err != nil {
+		return ObjectDiff{}, fmt.Errorf("error in dry-run of %s %s: %v", o.Kind, o.Name, err)
+	}
+
+	operation, diff, err := diffObjects(live, result)
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+	return ObjectDiff{
+		Group:     o.Group,
+		Kind:      o.Kind,
+		Namespace: namespace,
+		Name:      o.Name,
+		Operation: operation,
+		Diff:      diff,
+	}, nil
+}
+
+// dryRunApply applies o to resource with a server-side dry-run, the same way the reconcile applies it: with its
+// ApplyStrategy and the same field manager.  It returns the live object, nil if it doesn't exist, and the object
+// that would be applied.
+func (r *Reconciler) dryRunApply(ctx context.Context, resource dynamic.ResourceInterface, o *manifest.Object) (live, result *unstructured.Unstructured, err error) {
+	live, err = resource.Get(ctx, o.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		live = nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("error getting %s %s: %w", o.Kind, o.Name, err)
+	}
+
+	dryRun := []string{metav1.DryRunAll}
+	switch strategy := r.objectApplyStrategy(o); strategy {
+	case ApplyStrategyServerSide:
+		b, err := o.JSON()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error serializing %s %s: %v", o.Kind, o.Name, err)
+		}
+		// Objects too large for client-side apply take over the fields of earlier applies, as when they are applied
+		force := r.options.forceConflicts || strategy != r.applyStrategy(o.GroupKind())
+		result, err = resource.Patch(ctx, o.Name, types.ApplyPatchType, b, metav1.PatchOptions{
+			DryRun:       dryRun,
+			FieldManager: r.fieldManager(),
+			Force:        &force,
+		})
+		return live, result, err
+
+	case ApplyStrategyReplace:
+		u := o.UnstructuredObject().DeepCopy()
+		if live == nil {
+			result, err = resource.Create(ctx, u, metav1.CreateOptions{DryRun: dryRun})
+			return live, result, err
+		}
+		u.SetResourceVersion(live.GetResourceVersion())
+		result, err = resource.Update(ctx, u, metav1.UpdateOptions{DryRun: dryRun})
+		return live, result, err
+
+	default:
+		result, err = clientSideDryRun(ctx, resource, live, o)
+		return live, result, err
+	}
+}
+
+// clientSideDryRun applies o with a server-side dry-run of the three-way merge of kubectl client-side apply,
+// recording the last-applied-configuration annotation as kubectl does
+func clientSideDryRun(ctx context.Context, resource dynamic.ResourceInterface, live *unstructured.Unstructured, o *manifest.Object) (*unstructured.Unstructured, error) {
+	u := o.UnstructuredObject().DeepCopy()
+	dryRun := []string{metav1.DryRunAll}
+
+	if live == nil {
+		if err := kubectlutil.CreateApplyAnnotation(u, unstructured.UnstructuredJSONScheme); err != nil {
+			return nil, fmt.Errorf("error annotating %s %s: %v", o.Kind, o.Name, err)
+		}
+		return resource.Create(ctx, u, metav1.CreateOptions{DryRun: dryRun, FieldManager: apply.FieldManagerClientSideApply})
+	}
+
+	modified, err := kubectlutil.GetModifiedConfiguration(u, true, unstructured.UnstructuredJSONScheme)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing %s %s: %v", o.Kind, o.Name, err)
+	}
+	original, err := kubectlutil.GetOriginalConfiguration(live)
+	if err != nil {
+		return nil, fmt.Errorf("error reading last applied configuration of %s %s: %v", o.Kind, o.Name, err)
+	}
+	current, err := live.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("error serializing live %s %s: %v", o.Kind, o.Name, err)
+	}
+
+	patchType := types.StrategicMergePatchType
+	var patch []byte
+	versioned, err := scheme.Scheme.New(o.GroupVersionKind())
+	switch {
+	case runtime.IsNotRegisteredError(err):
+		// Use JSON merge patch to handle types w/o schema, as kubectl does
+		patchType = types.MergePatchType
+		patch, err = jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+	case err != nil:
+		return nil, err
+	default:
+		var lookupPatchMeta strategicpatch.LookupPatchMeta
+		lookupPatchMeta, err = strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return nil, err
+		}
+		patch, err = strategicpatch.CreateThreeWayMergePatch(original, modified, current, lookupPatchMeta, true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating patch for %s %s: %v", o.Kind, o.Name, err)
+	}
+	return resource.Patch(ctx, o.Name, patchType, patch, metav1.PatchOptions{DryRun: dryRun, FieldManager: apply.FieldManagerClientSideApply})
+}
+
+// diffObjects compares the live object, nil if it doesn't exist, with the result of the dry-run,
+// ignoring status and the metadata maintained by the server
+func diffObjects(live, dryRun *unstructured.Unstructured) (ApplyOperation, string, error) {
+	before := ""
+	if live != nil {
+		y, err := yaml.Marshal(comparableObject(live))
+		if err != nil {
+			return "", "", fmt.Errorf("error serializing live object: %v", err)
+		}
+		before = string(y)
+	}
+	y, err := yaml.Marshal(comparableObject(dryRun))
+	if err != nil {
+		return "", "", fmt.Errorf("error serializing dry-run object: %v", err)
+	}
+	after := string(y)
+
+	if before == after {
+		return ApplyUnchanged, "", nil
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(before),
+		B:        difflib.SplitLines(after),
+		FromFile: "live",
+		ToFile:   "dry-run",
+		Context:  3,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error computing diff: %v", err)
+	}
+	if live == nil {
+		return ApplyCreated, diff, nil
+	}
+	return ApplyConfigured, diff, nil
+}
+
+func comparableObject(u *unstructured.Unstructured) map[string]interface{} {
+	obj := u.DeepCopy().Object
+	delete(obj, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp", "selfLink"} {
+		unstructured.RemoveNestedField(obj, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj, "metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
+	if annotations, found, _ := unstructured.NestedMap(obj, "metadata", "annotations"); found && len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj, "metadata", "annotations")
+	}
+	return obj
+}
+
+// clearDryRun removes the DryRun condition once changes are applied
+func (r *Reconciler) clearDryRun(ctx context.Context, instance DeclarativeObject) error {
+	return r.clearPreviewCondition(ctx, instance, ConditionDryRun)
+}
+
+// clearPreviewCondition removes the condition of type conditionType set by setPreviewCondition
+func (r *Reconciler) clearPreviewCondition(ctx context.Context, instance DeclarativeObject, conditionType string) error {
+	changed := false
+	for _, reason := range []string{ReasonChangesPending, ReasonNoChanges} {
+		removed, err := removeCondition(instance, conditionType, reason)
+		if err != nil {
+			return err
+		}
+		changed = changed || removed
+	}
+	if !changed {
+		return nil
+	}
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	return nil
+}
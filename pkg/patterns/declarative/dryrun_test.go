@@ -0,0 +1,308 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+	"sigs.k8s.io/yaml"
+)
+
+func TestDiffObjects(t *testing.T) {
+	parse := func(s string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(s), &u.Object); err != nil {
+			t.Fatalf("error parsing object: %v", err)
+		}
+		return u
+	}
+	live := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+  resourceVersion: "12"
+  uid: 1234
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+data:
+  key: old
+`
+
+	tests := []struct {
+		name              string
+		live              string
+		dryRun            string
+		expectedOperation ApplyOperation
+		expectedDiff      []string
+	}{
+		{
+			name: "unchanged apart from server metadata",
+			live: live,
+			dryRun: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+  resourceVersion: "13"
+  uid: 1234
+  managedFields:
+  - manager: kubectl-client-side-apply
+data:
+  key: old
+`,
+			expectedOperation: ApplyUnchanged,
+		},
+		{
+			name: "changed",
+			live: live,
+			dryRun: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+data:
+  key: new
+`,
+			expectedOperation: ApplyConfigured,
+			expectedDiff:      []string{"--- live", "+++ dry-run", "-  key: old", "+  key: new"},
+		},
+		{
+			name: "created",
+			dryRun: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+`,
+			expectedOperation: ApplyCreated,
+			expectedDiff:      []string{"+kind: ConfigMap"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var liveObject *unstructured.Unstructured
+			if test.live != "" {
+				liveObject = parse(test.live)
+			}
+
+			operation, diff, err := diffObjects(liveObject, parse(test.dryRun))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if operation != test.expectedOperation {
+				t.Errorf("expected operation %q, got %q", test.expectedOperation, operation)
+			}
+			if len(test.expectedDiff) == 0 && diff != "" {
+				t.Errorf("expected no diff, got %s", diff)
+			}
+			for _, line := range test.expectedDiff {
+				if !strings.Contains(diff, line+"\n") {
+					t.Errorf("expected diff to contain %q, got %s", line, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestIsDryRun(t *testing.T) {
+	annotated := newGuestbook("default", "annotated", time.Now())
+	annotated.SetAnnotations(map[string]string{DryRunAnnotation: "true"})
+	plain := newGuestbook("default", "plain", time.Now())
+
+	tests := []struct {
+		name      string
+		options   reconcilerParams
+		annotated bool
+		plain     bool
+	}{
+		{name: "disabled"},
+		{name: "annotated objects", options: reconcilerParams{dryRun: true}, annotated: true},
+		{name: "all objects", options: reconcilerParams{dryRun: true, dryRunAll: true}, annotated: true, plain: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{options: test.options}
+			if got := r.isDryRun(annotated); got != test.annotated {
+				t.Errorf("expected dry-run=%v for annotated object, got %v", test.annotated, got)
+			}
+			if got := r.isDryRun(plain); got != test.plain {
+				t.Errorf("expected dry-run=%v for object without annotation, got %v", test.plain, got)
+			}
+		})
+	}
+}
+
+// recordingResource records how objects are written, as the fake dynamic client doesn't record the options
+type recordingResource struct {
+	dynamic.ResourceInterface
+	patchTypes    []types.PatchType
+	fieldManagers []string
+	dryRuns       [][]string
+}
+
+func (r *recordingResource) Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.fieldManagers = append(r.fieldManagers, options.FieldManager)
+	r.dryRuns = append(r.dryRuns, options.DryRun)
+	return r.ResourceInterface.Create(ctx, obj, options, subresources...)
+}
+
+func (r *recordingResource) Update(ctx context.Context, obj *unstructured.Unstructured, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.fieldManagers = append(r.fieldManagers, options.FieldManager)
+	r.dryRuns = append(r.dryRuns, options.DryRun)
+	return r.ResourceInterface.Update(ctx, obj, options, subresources...)
+}
+
+func (r *recordingResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, options metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.patchTypes = append(r.patchTypes, pt)
+	r.fieldManagers = append(r.fieldManagers, options.FieldManager)
+	r.dryRuns = append(r.dryRuns, options.DryRun)
+	if pt == types.ApplyPatchType {
+		// Not supported by the fake client
+		u := &unstructured.Unstructured{}
+		return u, u.UnmarshalJSON(data)
+	}
+	return r.ResourceInterface.Patch(ctx, name, pt, data, options, subresources...)
+}
+
+func TestDryRunApply(t *testing.T) {
+	ctx := context.Background()
+	widgets := schema.GroupVersionResource{Group: "example.org", Version: "v1", Resource: "widgets"}
+	widgetKind := schema.GroupKind{Group: "example.org", Kind: "Widget"}
+
+	live := &unstructured.Unstructured{}
+	live.SetAPIVersion("example.org/v1")
+	live.SetKind("Widget")
+	live.SetNamespace("default")
+	live.SetName("existing")
+	live.SetResourceVersion("7")
+	live.SetAnnotations(map[string]string{corev1.LastAppliedConfigAnnotation: `{"apiVersion":"example.org/v1","kind":"Widget","metadata":{"name":"existing","namespace":"default"},"spec":{"color":"blue","size":1}}`})
+	if err := unstructured.SetNestedMap(live.Object, map[string]interface{}{"color": "blue", "size": int64(1), "owner": "controller"}, "spec"); err != nil {
+		t.Fatalf("error setting spec: %v", err)
+	}
+
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: example.org/v1
+kind: Widget
+metadata:
+  name: existing
+  namespace: default
+spec:
+  color: red
+---
+apiVersion: example.org/v1
+kind: Widget
+metadata:
+  name: new
+  namespace: default
+spec:
+  color: green
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	existing, created := objects.Items[0], objects.Items[1]
+
+	tests := []struct {
+		name              string
+		options           reconcilerParams
+		object            *manifest.Object
+		expectedPatchType types.PatchType
+		expectedManager   string
+		expectedSpec      map[string]interface{}
+	}{
+		{
+			name:              "client-side apply of an existing object",
+			object:            existing,
+			expectedPatchType: types.MergePatchType,
+			expectedManager:   "kubectl-client-side-apply",
+			// Fields removed from the manifest are removed, fields set by others are kept
+			expectedSpec: map[string]interface{}{"color": "red", "owner": "controller"},
+		},
+		{
+			name:            "client-side apply of a new object",
+			object:          created,
+			expectedManager: "kubectl-client-side-apply",
+			expectedSpec:    map[string]interface{}{"color": "green"},
+		},
+		{
+			name:              "server-side apply",
+			options:           reconcilerParams{serverSideApply: true, fieldManager: "addon"},
+			object:            existing,
+			expectedPatchType: types.ApplyPatchType,
+			expectedManager:   "addon",
+			expectedSpec:      map[string]interface{}{"color": "red"},
+		},
+		{
+			name:         "replace",
+			options:      reconcilerParams{applyStrategies: map[schema.GroupKind]ApplyStrategy{widgetKind: ApplyStrategyReplace}},
+			object:       existing,
+			expectedSpec: map[string]interface{}{"color": "red"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live.DeepCopy())
+			resource := &recordingResource{ResourceInterface: client.Resource(widgets).Namespace("default")}
+			r := &Reconciler{options: test.options}
+
+			gotLive, result, err := r.dryRunApply(ctx, resource, test.object)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (gotLive != nil) != (test.object == existing) {
+				t.Errorf("unexpected live object %v", gotLive)
+			}
+
+			var patchType types.PatchType
+			if len(resource.patchTypes) != 0 {
+				patchType = resource.patchTypes[0]
+			}
+			if patchType != test.expectedPatchType {
+				t.Errorf("expected patch type %q, got %q", test.expectedPatchType, patchType)
+			}
+			if len(resource.fieldManagers) != 1 || resource.fieldManagers[0] != test.expectedManager {
+				t.Errorf("expected field manager %q, got %q", test.expectedManager, resource.fieldManagers)
+			}
+			if len(resource.dryRuns) != 1 || !reflect.DeepEqual(resource.dryRuns[0], []string{metav1.DryRunAll}) {
+				t.Errorf("expected a dry-run, got %v", resource.dryRuns)
+			}
+			spec, _, _ := unstructured.NestedMap(result.Object, "spec")
+			if !reflect.DeepEqual(spec, test.expectedSpec) {
+				t.Errorf("expected spec %v, got %v", test.expectedSpec, spec)
+			}
+		})
+	}
+}
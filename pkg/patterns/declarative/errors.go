@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"errors"
+)
+
+// The classes of the errors of a reconcile, by the stage that failed.  The errors returned by the reconciler wrap
+// one of them, so that status builders, metrics and retry policies can tell them apart with errors.Is, eg
+// errors.Is(err, declarative.ErrApply).
+var (
+	// ErrManifestLoad is the class of errors loading the manifest with the ManifestController
+	ErrManifestLoad = errors.New("manifest load failed")
+	// ErrRender is the class of errors rendering the manifest into objects: manifest operations, ytt, kustomize
+	// and parsing
+	ErrRender = errors.New("manifest render failed")
+	// ErrTransform is the class of errors transforming the objects of the manifest
+	ErrTransform = errors.New("object transform failed")
+	// ErrApply is the class of errors applying the objects, including pruning with kubectl apply --prune
+	ErrApply = errors.New("apply failed")
+	// ErrPrune is the class of errors deleting objects removed from the manifest, on rollbacks and migrations
+	ErrPrune = errors.New("prune failed")
+)
+
+// errorClasses are the classes of errors, in the order ErrorClass checks them
+var errorClasses = []error{ErrManifestLoad, ErrRender, ErrTransform, ErrApply, ErrPrune}
+
+// classifiedError is an error of a class, with the message of the error
+type classifiedError struct {
+	class error
+	err   error
+}
+
+// classify wraps err, if not nil, in class, unless it already has a class
+func classify(class error, err error) error {
+	if err == nil || ErrorClass(err) != nil {
+		return err
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.class
+}
+
+// ErrorClass returns the class of err, eg ErrApply, or nil if it has none
+func ErrorClass(err error) error {
+	for _, class := range errorClasses {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+	return nil
+}
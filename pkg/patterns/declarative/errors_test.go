@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+type failingManifest struct {
+	err error
+}
+
+func (m failingManifest) ResolveManifest(ctx context.Context, object runtime.Object) (map[string]string, error) {
+	return nil, m.err
+}
+
+func TestErrorClasses(t *testing.T) {
+	manifests := staticManifest{"manifest.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"}
+	failingTransform := func(ctx context.Context, o DeclarativeObject, objects *manifest.Objects) error {
+		return NewTerminalError(ReasonInvalidSpec, fmt.Errorf("invalid"))
+	}
+	failingOperation := func(ctx context.Context, o DeclarativeObject, s string) (string, error) {
+		return "", fmt.Errorf("invalid template")
+	}
+
+	tests := []struct {
+		name     string
+		options  reconcilerParams
+		expected error
+		terminal bool
+	}{
+		{
+			name:     "manifest load",
+			options:  reconcilerParams{manifestController: failingManifest{err: fmt.Errorf("channel not found")}},
+			expected: ErrManifestLoad,
+		},
+		{
+			name:     "render",
+			options:  reconcilerParams{manifestController: manifests, rawManifestOperations: []ManifestOperation{failingOperation}},
+			expected: ErrRender,
+		},
+		{
+			name:     "transform",
+			options:  reconcilerParams{manifestController: manifests, objectTransformations: []ObjectTransform{failingTransform}},
+			expected: ErrTransform,
+			terminal: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{options: test.options}
+			instance := newGuestbook("default", "test", time.Now())
+			_, err := r.BuildDeploymentObjects(context.Background(), types.NamespacedName{Namespace: "default", Name: "test"}, instance)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if !errors.Is(err, test.expected) {
+				t.Errorf("expected error of class %v, got %v", test.expected, err)
+			}
+			if ErrorClass(err) != test.expected {
+				t.Errorf("expected ErrorClass %v, got %v", test.expected, ErrorClass(err))
+			}
+			if IsTerminalError(err) != test.terminal {
+				t.Errorf("expected terminal %v, got %v", test.terminal, IsTerminalError(err))
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	if classify(ErrApply, nil) != nil {
+		t.Errorf("expected nil errors to stay nil")
+	}
+	err := classify(ErrApply, fmt.Errorf("kubectl failed"))
+	if err.Error() != "kubectl failed" {
+		t.Errorf("expected the message to be kept, got %q", err.Error())
+	}
+	wrapped := fmt.Errorf("error reconciling: %w", err)
+	if !errors.Is(wrapped, ErrApply) || errors.Is(wrapped, ErrPrune) {
+		t.Errorf("expected wrapped error to be of class ErrApply only")
+	}
+	// The first class is kept
+	if ErrorClass(classify(ErrPrune, wrapped)) != ErrApply {
+		t.Errorf("expected the class not to be replaced")
+	}
+	if ErrorClass(fmt.Errorf("other")) != nil {
+		t.Errorf("expected errors without a class to have none")
+	}
+}
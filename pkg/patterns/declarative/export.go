@@ -0,0 +1,263 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// ReasonExported is the reason for the events recording the manifest was exported rather than applied
+const ReasonExported = "Exported"
+
+// ManifestExporter writes the manifest of a DeclarativeObject somewhere other than the cluster, with
+// WithManifestExport, eg to a git repository for a GitOps pipeline to apply
+type ManifestExporter interface {
+	// Export writes the objects of instance, returning a description of where they were written, for events
+	Export(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) (string, error)
+}
+
+// exportManifest exports the objects of instance with the ManifestExporter, rather than applying them
+func (r *Reconciler) exportManifest(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+	if _, ok := r.options.manifestExporter.(ManifestExportRemover); ok {
+		// The exported manifest is removed once instance is deleted
+		if err := r.ensureFinalizer(ctx, instance, ExportFinalizer, true); err != nil {
+			return err
+		}
+	}
+	destination, err := r.options.manifestExporter.Export(ctx, instance, objects)
+	if err != nil {
+		return classify(ErrApply, fmt.Errorf("error exporting manifest: %w", err))
+	}
+	log.FromContext(ctx).WithValues("destination", destination).Info("exported manifest")
+	if r.recorder != nil {
+		r.recorder.Eventf(instance, "Normal", ReasonExported, "Exported manifest to %s", destination)
+	}
+	return nil
+}
+
+// ManifestExportRemover is implemented by ManifestExporters which remove the exported manifest of a
+// DeclarativeObject once it is deleted
+type ManifestExportRemover interface {
+	// RemoveExport removes the objects of instance, returning a description of where they were removed from
+	RemoveExport(ctx context.Context, instance DeclarativeObject) (string, error)
+}
+
+// ExportFinalizer is added to DeclarativeObjects exported with a ManifestExportRemover, and removed once the
+// exported manifest has been removed
+const ExportFinalizer = "addons.k8s.io/exported-manifest"
+
+// removeExport removes the exported manifest of instance, if the ManifestExporter can
+func (r *Reconciler) removeExport(ctx context.Context, instance DeclarativeObject) error {
+	remover, ok := r.options.manifestExporter.(ManifestExportRemover)
+	if !ok {
+		return nil
+	}
+	destination, err := remover.RemoveExport(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("error removing exported manifest: %w", err)
+	}
+	log.FromContext(ctx).WithValues("destination", destination).Info("removed exported manifest")
+	return nil
+}
+
+// GitExporter is a ManifestExporter writing the manifest of each DeclarativeObject to
+// <Path>/<namespace>/<name>.yaml in a clone of a git repository, and committing it, with the git binary.
+// Exports that don't change the manifest make no commit.  The file is removed when the DeclarativeObject is
+// deleted.
+//
+// Secrets are refused unless AllowSecrets is set, as their data would be committed in plain text to the
+// repository and its history, readable by anyone who can read the repository.
+type GitExporter struct {
+	// Dir is the directory of the clone of the repository
+	Dir string
+	// Path is the directory of the manifests, relative to Dir
+	Path string
+	// Push rebases the clone onto the upstream branch before committing, and pushes the commits to it
+	Push bool
+	// AllowSecrets exports manifests with Secrets, committing their data unencrypted
+	AllowSecrets bool
+	// AuthorName and AuthorEmail are the author and committer of the commits
+	AuthorName  string
+	AuthorEmail string
+	// Git is the path of the git binary, git on the PATH if empty
+	Git string
+
+	// mutex serializes exports, as they share the working tree
+	mutex sync.Mutex
+}
+
+var _ ManifestExporter = &GitExporter{}
+var _ ManifestExportRemover = &GitExporter{}
+
+// NewGitExporter returns a GitExporter committing the manifests to path in the clone of a repository in dir
+func NewGitExporter(dir, path string) *GitExporter {
+	return &GitExporter{Dir: dir, Path: path, AuthorName: "declarative-reconciler", AuthorEmail: "declarative-reconciler@localhost"}
+}
+
+func (e *GitExporter) Export(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.AllowSecrets {
+		for _, o := range objects.Items {
+			if o.Group == "" && o.Kind == "Secret" {
+				return "", fmt.Errorf("refusing to export Secret %s, set AllowSecrets to commit Secrets to the repository", o.Name)
+			}
+		}
+	}
+	m, err := objects.YAMLManifest()
+	if err != nil {
+		return "", fmt.Errorf("error serializing manifest: %v", err)
+	}
+
+	if err := e.rebase(ctx); err != nil {
+		return "", err
+	}
+	file := e.file(instance)
+	if err := os.MkdirAll(filepath.Join(e.Dir, filepath.Dir(file)), 0755); err != nil {
+		return "", fmt.Errorf("error creating directory for %s: %v", file, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(e.Dir, file), []byte(m), 0644); err != nil {
+		return "", fmt.Errorf("error writing %s: %v", file, err)
+	}
+	if err := e.git(ctx, "add", "--", file); err != nil {
+		return "", err
+	}
+
+	message := fmt.Sprintf("Update manifest of %s/%s (generation %d)", instance.GetNamespace(), instance.GetName(), instance.GetGeneration())
+	if err := e.commit(ctx, file, message); err != nil {
+		return "", err
+	}
+	return file, e.push(ctx)
+}
+
+// RemoveExport removes the manifest of instance from the repository, and commits its removal
+func (e *GitExporter) RemoveExport(ctx context.Context, instance DeclarativeObject) (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if err := e.rebase(ctx); err != nil {
+		return "", err
+	}
+	file := e.file(instance)
+	if err := os.Remove(filepath.Join(e.Dir, file)); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("error removing %s: %v", file, err)
+	}
+	if err := e.git(ctx, "add", "--all", "--", file); err != nil {
+		return "", err
+	}
+
+	message := fmt.Sprintf("Remove manifest of %s/%s", instance.GetNamespace(), instance.GetName())
+	if err := e.commit(ctx, file, message); err != nil {
+		return "", err
+	}
+	return file, e.push(ctx)
+}
+
+// file returns the path of the manifest of instance, relative to Dir
+func (e *GitExporter) file(instance DeclarativeObject) string {
+	namespace := instance.GetNamespace()
+	if namespace == "" {
+		namespace = "_cluster"
+	}
+	return filepath.Join(e.Path, namespace, instance.GetName()+".yaml")
+}
+
+// commit commits the staged changes of file, if there are any
+func (e *GitExporter) commit(ctx context.Context, file, message string) error {
+	// git diff --quiet exits with 1 if there are changes
+	_, err := e.output(ctx, "diff", "--cached", "--quiet", "--", file)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		// Unchanged since the last export
+		return nil
+	case !errors.As(err, &exitErr) || exitErr.ExitCode() != 1:
+		return err
+	}
+	return e.git(ctx, "commit", "--message", message, "--", file)
+}
+
+// rebase fetches the upstream branch and rebases the commits of the clone onto it, with Push, so that the
+// manifests are committed on top of the changes pushed by others
+func (e *GitExporter) rebase(ctx context.Context) error {
+	if !e.Push {
+		return nil
+	}
+	if err := e.git(ctx, "fetch"); err != nil {
+		return err
+	}
+	if err := e.git(ctx, "rebase", "--autostash", "@{upstream}"); err != nil {
+		if abortErr := e.git(ctx, "rebase", "--abort"); abortErr != nil {
+			log.FromContext(ctx).Error(abortErr, "aborting rebase")
+		}
+		return err
+	}
+	return nil
+}
+
+// push pushes the commits of the clone which aren't in the upstream branch yet, with Push, including those of
+// earlier exports whose push failed
+func (e *GitExporter) push(ctx context.Context) error {
+	if !e.Push {
+		return nil
+	}
+	ahead, err := e.output(ctx, "rev-list", "--count", "@{upstream}..HEAD")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(ahead) == "0" {
+		return nil
+	}
+	return e.git(ctx, "push")
+}
+
+// git runs git with args in the clone
+func (e *GitExporter) git(ctx context.Context, args ...string) error {
+	_, err := e.output(ctx, args...)
+	return err
+}
+
+// output runs git with args in the clone, returning its output
+func (e *GitExporter) output(ctx context.Context, args ...string) (string, error) {
+	path := e.Git
+	if path == "" {
+		path = "git"
+	}
+	identity := []string{"-c", "user.name=" + e.AuthorName, "-c", "user.email=" + e.AuthorEmail}
+	cmd := exec.CommandContext(ctx, path, append(identity, args...)...)
+	cmd.Dir = e.Dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running git %s: %w: %s", args[0], err, stderr.String())
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestGitExporter(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if out, err := exec.Command("git", "init", dir).CombinedOutput(); err != nil {
+		t.Fatalf("error creating repository: %v: %s", err, out)
+	}
+
+	commits := func() []string {
+		t.Helper()
+		out, err := exec.Command("git", "-C", dir, "log", "--format=%s").CombinedOutput()
+		if err != nil {
+			return nil
+		}
+		return strings.Split(strings.TrimSpace(string(out)), "\n")
+	}
+
+	exporter := NewGitExporter(dir, "clusters/dev")
+	instance := newGuestbook("default", "test", time.Now())
+	instance.SetGeneration(1)
+	objects, err := manifest.ParseObjects(ctx, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: default\n")
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	file, err := exporter.Export(ctx, instance, objects)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file != filepath.Join("clusters", "dev", "default", "test.yaml") {
+		t.Errorf("unexpected file %s", file)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		t.Fatalf("error reading exported manifest: %v", err)
+	}
+	if !strings.Contains(string(b), "name: config") {
+		t.Errorf("unexpected manifest %s", b)
+	}
+
+	// Exporting the same manifest again doesn't commit
+	instance.SetGeneration(2)
+	if _, err := exporter.Export(ctx, instance, objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := commits(); len(c) != 1 || c[0] != "Update manifest of default/test (generation 1)" {
+		t.Errorf("expected a single commit, got %v", c)
+	}
+
+	if err := objects.Items[0].SetNestedStringMap(map[string]string{"key": "value"}, "data"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := exporter.Export(ctx, instance, objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := commits(); len(c) != 2 || c[0] != "Update manifest of default/test (generation 2)" {
+		t.Errorf("expected a commit for the change, got %v", c)
+	}
+
+	secrets, err := manifest.ParseObjects(ctx, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: password\n  namespace: default\n")
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	if _, err := exporter.Export(ctx, instance, secrets); err == nil || !strings.Contains(err.Error(), "Secret password") {
+		t.Errorf("expected the Secret to be refused, got %v", err)
+	}
+
+	if _, err := exporter.RemoveExport(ctx, instance); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, file)); !os.IsNotExist(err) {
+		t.Errorf("expected the manifest to be removed, got %v", err)
+	}
+	if c := commits(); len(c) != 3 || c[0] != "Remove manifest of default/test" {
+		t.Errorf("expected a commit for the removal, got %v", c)
+	}
+}
+
+func TestGitExporterPush(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		t.Helper()
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@localhost"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("error running git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	remote := filepath.Join(dir, "remote.git")
+	other := filepath.Join(dir, "other")
+	clone := filepath.Join(dir, "clone")
+	git("init", "--bare", remote)
+	git("clone", remote, other)
+	git("-C", other, "commit", "--allow-empty", "--message", "Initial commit")
+	git("-C", other, "push", "origin", "HEAD")
+	git("clone", remote, clone)
+
+	exporter := NewGitExporter(clone, "clusters/dev")
+	exporter.Push = true
+	instance := newGuestbook("default", "test", time.Now())
+	instance.SetGeneration(1)
+	objects, err := manifest.ParseObjects(ctx, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: default\n")
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	// The push fails after the manifest is committed while the remote rejects pushes
+	hook := filepath.Join(remote, "hooks", "pre-receive")
+	if err := ioutil.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("error writing hook: %v", err)
+	}
+	if _, err := exporter.Export(ctx, instance, objects); err == nil {
+		t.Fatalf("expected an error pushing to the remote")
+	}
+	if err := os.Remove(hook); err != nil {
+		t.Fatalf("error removing hook: %v", err)
+	}
+
+	// Someone else pushes in the meantime
+	git("-C", other, "commit", "--allow-empty", "--message", "Other change")
+	git("-C", other, "push", "origin", "HEAD")
+
+	// Exporting the unchanged manifest rebases onto the other change, and pushes the commit of the failed push
+	if _, err := exporter.Export(ctx, instance, objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log := strings.Split(git("--git-dir", remote, "log", "--format=%s"), "\n")
+	expected := []string{"Update manifest of default/test (generation 1)", "Other change", "Initial commit"}
+	if strings.Join(log, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the remote to have commits %v, got %v", expected, log)
+	}
+}
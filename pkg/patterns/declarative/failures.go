@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReasonRepeatedFailures is the reason for a true ConditionStalled after too many consecutive failed reconciles
+const ReasonRepeatedFailures = "RepeatedFailures"
+
+// failureTracker counts the consecutive failed reconciles of each DeclarativeObject
+type failureTracker struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+func newFailureTracker() *failureTracker {
+	return &failureTracker{failures: make(map[types.NamespacedName]int)}
+}
+
+// failed records a failed reconcile, returning the number of consecutive failures
+func (t *failureTracker) failed(instance types.NamespacedName) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failures[instance]++
+	return t.failures[instance]
+}
+
+func (t *failureTracker) succeeded(instance types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.failures, instance)
+}
+
+// backoffOnFailure records a failed reconcile.  Once the DeclarativeObject has failed to reconcile
+// too many times in a row, it sets the Stalled condition with the error, and retries slowly.
+func (r *Reconciler) backoffOnFailure(ctx context.Context, instance DeclarativeObject, reconcileErr error) (reconcile.Result, error) {
+	log := log.FromContext(ctx)
+	name := types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}
+
+	failures := r.failures.failed(name)
+	if failures < r.options.failureThreshold {
+		return reconcile.Result{}, reconcileErr
+	}
+
+	log.WithValues("failures", failures).Error(reconcileErr, "reconcile keeps failing, retrying slowly")
+
+	changed, err := setCondition(instance, metav1.Condition{
+		Type:               ConditionStalled,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonRepeatedFailures,
+		Message:            fmt.Sprintf("Reconcile failed %d times in a row: %v", failures, reconcileErr),
+		ObservedGeneration: instance.GetGeneration(),
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if changed {
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating status: %v", err)
+		}
+	}
+	if failures == r.options.failureThreshold && r.recorder != nil {
+		r.recorder.Event(instance, "Warning", ReasonRepeatedFailures, reconcileErr.Error())
+	}
+
+	// Returning the error would requeue with the rate limiter's backoff, so requeue explicitly instead
+	return reconcile.Result{RequeueAfter: r.options.failureBackoff}, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBackoffOnFailure(t *testing.T) {
+	ctx := context.Background()
+	instance := newGuestbook("default", "test", time.Now())
+	name := types.NamespacedName{Namespace: "default", Name: "test"}
+	r := &Reconciler{
+		client:   fake.NewClientBuilder().WithObjects(instance).Build(),
+		failures: newFailureTracker(),
+		options:  reconcilerParams{failureThreshold: 3, failureBackoff: 5 * time.Minute},
+	}
+
+	reconcileErr := errors.New("error applying manifest: connection refused")
+	for i := 1; i <= 4; i++ {
+		result, err := r.backoffOnFailure(ctx, instance, reconcileErr)
+		if i < 3 {
+			if err != reconcileErr {
+				t.Errorf("failure %d: expected the error to be returned, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failure %d: unexpected error: %v", i, err)
+		}
+		if result.RequeueAfter != 5*time.Minute {
+			t.Errorf("failure %d: expected slow retry, got %v", i, result)
+		}
+	}
+
+	updated := &unstructured.Unstructured{}
+	updated.SetGroupVersionKind(instance.GroupVersionKind())
+	if err := r.client.Get(ctx, name, updated); err != nil {
+		t.Fatalf("error getting instance: %v", err)
+	}
+	conditions, _, err := getConditions(updated)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stalled := meta.FindStatusCondition(conditions, ConditionStalled)
+	if stalled == nil || stalled.Reason != ReasonRepeatedFailures {
+		t.Fatalf("unexpected Stalled condition %v", stalled)
+	}
+	if !strings.Contains(stalled.Message, "4 times in a row: error applying manifest: connection refused") {
+		t.Errorf("unexpected message %q", stalled.Message)
+	}
+
+	r.failures.succeeded(name)
+	if _, err := r.backoffOnFailure(ctx, instance, reconcileErr); err != reconcileErr {
+		t.Errorf("expected the count to be reset after success, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// HealthCheck aggregates the outcome of the reconciles of the Reconcilers sharing it with WithHealthCheck, for the
+// healthz or readyz checks of the manager, eg mgr.AddHealthzCheck("addons", healthCheck.Check).  It reports the
+// operator as unhealthy when too many DeclarativeObjects are stalled, or when the manifest source can't be reached,
+// so that alerts fire for problems of the whole operator rather than of a single DeclarativeObject.
+type HealthCheck struct {
+	stalledFraction float64
+
+	mu sync.Mutex
+	// stalled records whether each DeclarativeObject reconciled was stalled by its last reconcile
+	stalled map[healthKey]bool
+	// manifestErr is the error of the last manifest load that failed, until a manifest is loaded again
+	manifestErr error
+}
+
+// healthKey identifies a DeclarativeObject across the Reconcilers sharing a HealthCheck
+type healthKey struct {
+	reconciler *Reconciler
+	name       types.NamespacedName
+}
+
+// NewHealthCheck returns a HealthCheck failing once the fraction of the DeclarativeObjects that are stalled reaches
+// stalledFraction, eg 0.5 for half of them, or a manifest can't be loaded.  A stalledFraction of zero or less ignores
+// stalled DeclarativeObjects.
+func NewHealthCheck(stalledFraction float64) *HealthCheck {
+	return &HealthCheck{stalledFraction: stalledFraction, stalled: make(map[healthKey]bool)}
+}
+
+// Check returns an error if the operator is unhealthy, and is a healthz.Checker
+func (h *HealthCheck) Check(_ *http.Request) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.manifestErr != nil {
+		return fmt.Errorf("manifest source is unreachable: %v", h.manifestErr)
+	}
+	if h.stalledFraction <= 0 || len(h.stalled) == 0 {
+		return nil
+	}
+	stalled := 0
+	for _, s := range h.stalled {
+		if s {
+			stalled++
+		}
+	}
+	if float64(stalled)/float64(len(h.stalled)) >= h.stalledFraction {
+		return fmt.Errorf("%d of %d objects are stalled", stalled, len(h.stalled))
+	}
+	return nil
+}
+
+// record records the outcome of a reconcile of the DeclarativeObject name
+func (h *HealthCheck) record(r *Reconciler, name types.NamespacedName, instance DeclarativeObject, reconcileErr error) {
+	terminal := IsTerminalError(reconcileErr)
+	stalled := terminal
+	if conditions, supported, err := getConditions(instance); err == nil && supported {
+		stalled = stalled || meta.IsStatusConditionTrue(conditions, ConditionStalled)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.stalled[healthKey{reconciler: r, name: name}] = stalled
+	switch {
+	case errors.Is(reconcileErr, ErrManifestLoad) && !terminal:
+		// Terminal errors, eg versions missing from the channel, are problems of the DeclarativeObject
+		h.manifestErr = reconcileErr
+	case reconcileErr == nil || ErrorClass(reconcileErr) != nil:
+		// Every other stage runs after the manifest was loaded
+		h.manifestErr = nil
+	}
+}
+
+// forget stops tracking the DeclarativeObject name, once it has been deleted
+func (h *HealthCheck) forget(r *Reconciler, name types.NamespacedName) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.stalled, healthKey{reconciler: r, name: name})
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestHealthCheck(t *testing.T) {
+	h := NewHealthCheck(0.6)
+	r := &Reconciler{}
+	names := []types.NamespacedName{{Namespace: "default", Name: "a"}, {Namespace: "default", Name: "b"}, {Namespace: "default", Name: "c"}}
+
+	for _, name := range names {
+		h.record(r, name, newGuestbook(name.Namespace, name.Name, time.Now()), nil)
+	}
+	if err := h.Check(nil); err != nil {
+		t.Errorf("expected healthy, got %v", err)
+	}
+
+	// One of three stalled, by a terminal error
+	h.record(r, names[0], newGuestbook("default", "a", time.Now()), NewTerminalError(ReasonInvalidSpec, fmt.Errorf("invalid patch")))
+	if err := h.Check(nil); err != nil {
+		t.Errorf("expected healthy, got %v", err)
+	}
+
+	// Two of three stalled, by the Stalled condition
+	stalled := newGuestbook("default", "b", time.Now())
+	if _, err := setCondition(stalled, metav1.Condition{Type: ConditionStalled, Status: metav1.ConditionTrue, Reason: ReasonRepeatedFailures}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h.record(r, names[1], stalled, nil)
+	if err := h.Check(nil); err == nil || err.Error() != "2 of 3 objects are stalled" {
+		t.Errorf("expected unhealthy, got %v", err)
+	}
+
+	h.forget(r, names[1])
+	if err := h.Check(nil); err != nil {
+		t.Errorf("expected healthy once the stalled object is deleted, got %v", err)
+	}
+
+	// The manifest source can't be reached until a manifest is loaded again
+	h.record(r, names[2], newGuestbook("default", "c", time.Now()), classify(ErrManifestLoad, fmt.Errorf("connection refused")))
+	if err := h.Check(nil); err == nil {
+		t.Errorf("expected unhealthy while the manifest source is unreachable")
+	}
+	h.record(r, names[2], newGuestbook("default", "c", time.Now()), fmt.Errorf("error reading object"))
+	if err := h.Check(nil); err == nil {
+		t.Errorf("expected unhealthy until a manifest is loaded")
+	}
+	h.record(r, names[2], newGuestbook("default", "c", time.Now()), classify(ErrApply, fmt.Errorf("apply failed")))
+	if err := h.Check(nil); err != nil {
+		t.Errorf("expected healthy once a manifest is loaded, got %v", err)
+	}
+}
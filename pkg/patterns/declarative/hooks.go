@@ -0,0 +1,331 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+const (
+	// HookAnnotation marks an object in the manifest as a lifecycle hook, with WithLifecycleHooks.
+	// The value is a comma-separated list of the phases the hook runs in.
+	HookAnnotation = "addons.k8s.io/hook"
+	// HookPreApply hooks run before the rest of the manifest is applied
+	HookPreApply = "pre-apply"
+	// HookPostApply hooks run after the rest of the manifest has been applied
+	HookPostApply = "post-apply"
+	// HookPreDelete hooks run when the DeclarativeObject is deleted, before the objects are removed
+	HookPreDelete = "pre-delete"
+
+	// HookFailurePolicyAnnotation on a hook sets what happens when it fails, Abort (the default) or Ignore
+	HookFailurePolicyAnnotation = "addons.k8s.io/hook-failure-policy"
+	// HookFailurePolicyAbort stops the reconcile when the hook fails, setting the Stalled condition
+	HookFailurePolicyAbort = "Abort"
+	// HookFailurePolicyIgnore continues as if the hook had succeeded
+	HookFailurePolicyIgnore = "Ignore"
+
+	// HooksFinalizer is added to DeclarativeObjects with pre-delete hooks or a teardown manifest, and removed once
+	// they have run
+	HooksFinalizer = "addons.k8s.io/pre-delete-hooks"
+
+	// ReasonHookFailed is the reason for a true ConditionStalled when a hook fails
+	ReasonHookFailed = "HookFailed"
+
+	// hookHashAnnotation records the manifest a hook ran for, so it runs again when the manifest changes
+	hookHashAnnotation = "addons.k8s.io/hook-hash"
+)
+
+// hookRecheckInterval is how often we check whether hooks have completed
+var hookRecheckInterval = 10 * time.Second
+
+// hooks are the hook objects of a manifest, by phase
+type hooks map[string][]*manifest.Object
+
+// splitHooks separates the hook objects from the objects applied with the manifest
+func splitHooks(objects []*manifest.Object) (hooks, []*manifest.Object, error) {
+	found := make(hooks)
+	var rest []*manifest.Object
+	for _, o := range objects {
+		annotations := o.UnstructuredObject().GetAnnotations()
+		value, ok := annotations[HookAnnotation]
+		if !ok {
+			rest = append(rest, o)
+			continue
+		}
+		for _, phase := range strings.Split(value, ",") {
+			phase = strings.TrimSpace(phase)
+			switch phase {
+			case HookPreApply, HookPostApply, HookPreDelete:
+				found[phase] = append(found[phase], o)
+			default:
+				return nil, nil, fmt.Errorf("invalid %s annotation %q on %s %s", HookAnnotation, value, o.Kind, o.Name)
+			}
+		}
+		switch policy := annotations[HookFailurePolicyAnnotation]; policy {
+		case "", HookFailurePolicyAbort, HookFailurePolicyIgnore:
+		default:
+			return nil, nil, fmt.Errorf("invalid %s annotation %q on %s %s", HookFailurePolicyAnnotation, policy, o.Kind, o.Name)
+		}
+	}
+	return found, rest, nil
+}
+
+// runHooks applies the hooks for a phase and checks whether they have completed, returning true once they all
+// have.  Hooks that ran for a different hash are deleted and run again.  A hook that fails stops the reconcile
+// with a TerminalError, unless its failure policy is Ignore.
+func (r *Reconciler) runHooks(ctx context.Context, instance DeclarativeObject, ns string, phase string, objects []*manifest.Object, hash string) (bool, error) {
+	log := log.FromContext(ctx)
+
+	done := true
+	pending := &manifest.Objects{}
+	for _, o := range objects {
+		hook, err := r.hookObject(ctx, instance, o, hash)
+		if err != nil {
+			return false, err
+		}
+		resource, err := r.objectResource(ctx, ns, hook)
+		if err != nil {
+			return false, err
+		}
+		u, err := resource.Get(ctx, hook.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			pending.Items = append(pending.Items, hook)
+			done = false
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("error getting hook %s %s: %v", hook.Kind, hook.Name, err)
+		}
+		if u.GetAnnotations()[hookHashAnnotation] != hash {
+			// The hook ran for an earlier manifest, delete it so it can run again
+			log.WithValues("phase", phase).WithValues("kind", hook.Kind).WithValues("name", hook.Name).Info("deleting hook from an earlier manifest")
+			if err := r.deleteObject(ctx, ns, hook); err != nil {
+				return false, err
+			}
+			done = false
+			continue
+		}
+
+		completed, failure := hookStatus(u)
+		if failure != "" {
+			if u.GetAnnotations()[HookFailurePolicyAnnotation] == HookFailurePolicyIgnore {
+				log.WithValues("phase", phase).WithValues("kind", hook.Kind).WithValues("name", hook.Name).Info("ignoring failed hook", "failure", failure)
+				continue
+			}
+			return false, NewTerminalError(ReasonHookFailed, fmt.Errorf("%s hook %s %s failed: %s", phase, hook.Kind, hook.Name, failure))
+		}
+		if !completed {
+			done = false
+		}
+	}
+
+	if len(pending.Items) != 0 {
+		m, err := pending.JSONManifest()
+		if err != nil {
+			return false, fmt.Errorf("error creating manifest: %v", err)
+		}
+		log.WithValues("phase", phase).WithValues("objects", len(pending.Items)).Info("applying hooks")
+		if _, err := r.applyWithResults(ctx, ns, m, pending.Items); err != nil {
+			return false, fmt.Errorf("error applying %s hooks: %v", phase, err)
+		}
+	}
+	return done, nil
+}
+
+// hookObject returns a copy of the hook o to apply for hash.  The labels used to prune the manifest are
+// removed, so that the hook isn't pruned by the apply of the rest of the manifest.
+func (r *Reconciler) hookObject(ctx context.Context, instance DeclarativeObject, o *manifest.Object, hash string) (*manifest.Object, error) {
+	hook := o.DeepCopy()
+	u := hook.UnstructuredObject()
+
+	annotations := u.GetAnnotations()
+	annotations[hookHashAnnotation] = hash
+	if err := hook.SetNestedStringMap(annotations, "metadata", "annotations"); err != nil {
+		return nil, fmt.Errorf("error annotating hook %s %s: %v", o.Kind, o.Name, err)
+	}
+
+	if err := r.removePruneLabels(ctx, instance, hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// hookStatus returns whether the hook in the cluster has completed, or why it failed.  Jobs have completed
+// when they have succeeded; other objects when they are reconciled, according to kstatus.
+func hookStatus(u *unstructured.Unstructured) (bool, string) {
+	if u.GroupVersionKind().GroupKind().String() == "Job.batch" {
+		conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["status"] != "True" {
+				continue
+			}
+			switch condition["type"] {
+			case "Complete":
+				return true, ""
+			case "Failed":
+				message, _ := condition["message"].(string)
+				if message == "" {
+					message, _ = condition["reason"].(string)
+				}
+				return false, message
+			}
+		}
+		return false, ""
+	}
+
+	res, err := status.Compute(u)
+	if err != nil {
+		return false, err.Error()
+	}
+	if res.Status == status.FailedStatus {
+		return false, res.Message
+	}
+	return res.Status == status.CurrentStatus, ""
+}
+
+// ensureHooksFinalizer adds HooksFinalizer to instance if it has pre-delete hooks or a teardown manifest, and
+// removes it otherwise
+func (r *Reconciler) ensureHooksFinalizer(ctx context.Context, instance DeclarativeObject, preDelete bool) error {
+	return r.ensureFinalizer(ctx, instance, HooksFinalizer, preDelete)
+}
+
+// ensureFinalizer adds or removes finalizer from instance
+func (r *Reconciler) ensureFinalizer(ctx context.Context, instance DeclarativeObject, finalizer string, present bool) error {
+	if present == controllerutil.ContainsFinalizer(instance, finalizer) {
+		return nil
+	}
+	if present {
+		controllerutil.AddFinalizer(instance, finalizer)
+	} else {
+		controllerutil.RemoveFinalizer(instance, finalizer)
+	}
+	if err := r.client.Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating finalizers: %v", err)
+	}
+	return nil
+}
+
+// reconcileDeletion runs the pre-delete hooks and the teardown manifest of a DeclarativeObject being deleted,
+// then removes HooksFinalizer so that the deletion can complete.  Objects in a remote cluster are then deleted,
+// and the exported manifest removed.
+func (r *Reconciler) reconcileDeletion(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) (reconcile.Result, error) {
+	log := log.FromContext(ctx)
+
+	if controllerutil.ContainsFinalizer(instance, HooksFinalizer) {
+		done, err := r.runPreDeleteHooks(ctx, name, instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if !done {
+			log.Info("waiting for pre-delete hooks to complete")
+			return reconcile.Result{RequeueAfter: hookRecheckInterval}, nil
+		}
+		if err := r.ensureHooksFinalizer(ctx, instance, false); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if controllerutil.ContainsFinalizer(instance, RemoteClusterFinalizer) {
+		if err := r.deleteRemoteObjects(ctx, name, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.ensureFinalizer(ctx, instance, RemoteClusterFinalizer, false); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if controllerutil.ContainsFinalizer(instance, ExportFinalizer) {
+		if err := r.removeExport(ctx, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.ensureFinalizer(ctx, instance, ExportFinalizer, false); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+// runPreDeleteHooks runs the pre-delete hooks and the teardown manifest, returning true once they have completed
+func (r *Reconciler) runPreDeleteHooks(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) (bool, error) {
+	var preDelete []*manifest.Object
+	if r.options.lifecycleHooks {
+		objects, err := r.buildObjectsForHooks(ctx, name, instance)
+		if err != nil {
+			return false, err
+		}
+		found, _, err := splitHooks(objects.Items)
+		if err != nil {
+			return false, err
+		}
+		preDelete = found[HookPreDelete]
+	}
+	if r.options.teardown {
+		teardown, err := r.buildTeardownObjects(ctx, name, instance)
+		if err != nil {
+			return false, err
+		}
+		preDelete = append(preDelete, teardown...)
+	}
+
+	ns := r.applyNamespace(ctx, name, instance)
+	if r.options.impersonation {
+		user, err := serviceAccountUser(instance, ns)
+		if err != nil {
+			return false, err
+		}
+		ctx = contextWithImpersonation(ctx, user)
+		if r, err = r.impersonating(user); err != nil {
+			return false, err
+		}
+	}
+
+	// Pre-delete hooks run once, when the DeclarativeObject is deleted
+	return r.runHooks(ctx, instance, ns, HookPreDelete, preDelete, string(instance.GetUID()))
+}
+
+// buildObjectsForHooks builds the objects for instance, as they would be applied
+func (r *Reconciler) buildObjectsForHooks(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) (*manifest.Objects, error) {
+	var fs filesys.FileSystem
+	if r.IsKustomizeOptionUsed() {
+		fs = filesys.MakeFsInMemory()
+	}
+	objects, err := r.BuildDeploymentObjectsWithFs(ctx, name, instance, fs)
+	if err != nil {
+		return nil, fmt.Errorf("error building deployment objects: %w", err)
+	}
+	objects, err = parseListKind(objects)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing list kind: %v", err)
+	}
+	if err := r.injectOwnerRef(ctx, instance, objects); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
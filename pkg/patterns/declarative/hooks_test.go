@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestSplitHooks(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    addons.k8s.io/hook: pre-apply, pre-delete
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: smoke-test
+  annotations:
+    addons.k8s.io/hook: post-apply
+    addons.k8s.io/hook-failure-policy: Ignore
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	found, rest, err := splitHooks(objects.Items)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rest) != 1 || rest[0].Name != "config" {
+		t.Errorf("expected only the configmap to be applied, got %v", rest)
+	}
+	for phase, expected := range map[string]string{HookPreApply: "migrate", HookPostApply: "smoke-test", HookPreDelete: "migrate"} {
+		if len(found[phase]) != 1 || found[phase][0].Name != expected {
+			t.Errorf("expected %s hook %s, got %v", phase, expected, found[phase])
+		}
+	}
+
+	objects.Items[2].UnstructuredObject().SetAnnotations(map[string]string{HookAnnotation: "post-install"})
+	if _, _, err := splitHooks(objects.Items); err == nil || !strings.Contains(err.Error(), "post-install") {
+		t.Errorf("expected an error for an invalid phase, got %v", err)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    addons.k8s.io/hook: pre-apply
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, meta.RESTScopeNamespace)
+	jobs := schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+
+	job := func(hash string, condition string, policy string) *unstructured.Unstructured {
+		u := objects.Items[0].UnstructuredObject().DeepCopy()
+		u.SetNamespace("default")
+		annotations := u.GetAnnotations()
+		annotations[hookHashAnnotation] = hash
+		if policy != "" {
+			annotations[HookFailurePolicyAnnotation] = policy
+		}
+		u.SetAnnotations(annotations)
+		if condition != "" {
+			u.Object["status"] = map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"type": condition, "status": "True", "message": "BackoffLimitExceeded"},
+				},
+			}
+		}
+		return u
+	}
+
+	tests := []struct {
+		name          string
+		existing      *unstructured.Unstructured
+		expectDone    bool
+		expectApplied bool
+		expectDeleted bool
+		expectErr     bool
+	}{
+		{name: "not yet run", expectApplied: true},
+		{name: "running", existing: job("hash", "", "")},
+		{name: "completed", existing: job("hash", "Complete", ""), expectDone: true},
+		{name: "failed", existing: job("hash", "Failed", ""), expectErr: true},
+		{name: "failed and ignored", existing: job("hash", "Failed", HookFailurePolicyIgnore), expectDone: true},
+		{name: "ran for an earlier manifest", existing: job("earlier", "Complete", ""), expectDeleted: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var existing []runtime.Object
+			if test.existing != nil {
+				existing = append(existing, test.existing)
+			}
+			applier := &recordingApplier{}
+			r := &Reconciler{
+				kubectl:       applier,
+				restMapper:    mapper,
+				dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing...),
+			}
+
+			instance := newGuestbook("default", "test", time.Now())
+			done, err := r.runHooks(ctx, instance, "default", HookPreApply, objects.Items, "hash")
+			if test.expectErr != IsTerminalError(err) {
+				t.Fatalf("expected terminal error %v, got %v", test.expectErr, err)
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if done != test.expectDone {
+				t.Errorf("expected done %v, got %v", test.expectDone, done)
+			}
+			if applied := len(applier.manifests) != 0; applied != test.expectApplied {
+				t.Errorf("expected applied %v, got %v", test.expectApplied, applied)
+			}
+			if test.expectApplied && !strings.Contains(applier.manifests[0], `"addons.k8s.io/hook-hash":"hash"`) {
+				t.Errorf("expected the hook to be annotated with the hash, got %s", applier.manifests[0])
+			}
+			_, err = r.dynamicClient.Resource(jobs).Namespace("default").Get(ctx, "migrate", metav1.GetOptions{})
+			if deleted := test.existing != nil && apierrors.IsNotFound(err); deleted != test.expectDeleted {
+				t.Errorf("expected deleted %v, got %v", test.expectDeleted, deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// IgnoreFieldsAnnotation on an object in the manifest is a comma-separated list of the paths of fields the
+// reconciler never overwrites, like the Path of IgnoredField
+const IgnoreFieldsAnnotation = "addons.k8s.io/ignore-fields"
+
+// IgnoredField is a field the reconciler never overwrites, such as spec.replicas of a Deployment scaled by a
+// HorizontalPodAutoscaler or the caBundle of a webhook injected by cert-manager
+type IgnoredField struct {
+	// GroupKind is the kind of the objects with the field, or all kinds if empty
+	schema.GroupKind
+	// Path is the dot-separated path of the field, eg spec.replicas.  [*] after a list selects all of its elements,
+	// eg webhooks[*].clientConfig.caBundle
+	Path string
+}
+
+// ignoreFields removes the ignored fields from objects before they are applied.  Unless the objects are applied
+// server-side, fields the live objects have are set to their live values instead, so that the three-way merge or
+// replace doesn't remove them.
+func (r *Reconciler) ignoreFields(objects []*manifest.Object, live map[string]*unstructured.Unstructured) error {
+	for _, o := range objects {
+		var paths []string
+		for _, f := range r.options.ignoredFields {
+			if f.GroupKind.Empty() || f.GroupKind == o.GroupKind() {
+				paths = append(paths, f.Path)
+			}
+		}
+		if value := o.UnstructuredObject().GetAnnotations()[IgnoreFieldsAnnotation]; value != "" {
+			for _, path := range strings.Split(value, ",") {
+				paths = append(paths, strings.TrimSpace(path))
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		var liveObject map[string]interface{}
+		if u := live[objectKey(o)]; u != nil && r.applyStrategy(o.GroupKind()) != ApplyStrategyServerSide {
+			liveObject = u.Object
+		}
+		err := o.MutateObject(func(obj map[string]interface{}) error {
+			for _, path := range paths {
+				ignoreField(obj, liveObject, strings.Split(path, "."))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ignoreField removes the field at path from obj, or sets it to its value in live if live has it
+func ignoreField(obj, live interface{}, path []string) {
+	m, ok := obj.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return
+	}
+	liveMap, _ := live.(map[string]interface{})
+
+	name := path[0]
+	if strings.HasSuffix(name, "[*]") && len(path) > 1 {
+		name = strings.TrimSuffix(name, "[*]")
+		list, _ := m[name].([]interface{})
+		liveList, _ := liveMap[name].([]interface{})
+		for i, item := range list {
+			var liveItem interface{}
+			if i < len(liveList) {
+				liveItem = liveList[i]
+			}
+			ignoreField(item, liveItem, path[1:])
+		}
+		return
+	}
+	name = strings.TrimSuffix(name, "[*]")
+
+	if len(path) > 1 {
+		ignoreField(m[name], liveMap[name], path[1:])
+		return
+	}
+	if value, found := liveMap[name]; found {
+		m[name] = runtime.DeepCopyJSONValue(value)
+	} else {
+		delete(m, name)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestIgnoreFields(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+spec:
+  replicas: 1
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: webhook
+  annotations:
+    addons.k8s.io/ignore-fields: webhooks[*].clientConfig.caBundle
+webhooks:
+- name: a
+  clientConfig:
+    caBundle: placeholder
+- name: b
+  clientConfig:
+    caBundle: placeholder
+`
+	liveDeployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "default"},
+		"spec":       map[string]interface{}{"replicas": int64(5)},
+	}}
+	liveWebhook := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "admissionregistration.k8s.io/v1",
+		"kind":       "ValidatingWebhookConfiguration",
+		"metadata":   map[string]interface{}{"name": "webhook"},
+		"webhooks": []interface{}{
+			map[string]interface{}{"name": "a", "clientConfig": map[string]interface{}{"caBundle": "injected"}},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		live       []*unstructured.Unstructured
+		serverSide bool
+		expected   []string
+		unexpected []string
+	}{
+		{
+			name:       "no live objects",
+			unexpected: []string{`"replicas":`, `"caBundle":`},
+		},
+		{
+			name:       "live values preserved",
+			live:       []*unstructured.Unstructured{liveDeployment, liveWebhook},
+			expected:   []string{`"replicas":5`, `{"caBundle":"injected"}`, `{"clientConfig":{},"name":"b"}`},
+			unexpected: []string{"placeholder"},
+		},
+		{
+			name:       "server-side apply",
+			live:       []*unstructured.Unstructured{liveDeployment, liveWebhook},
+			serverSide: true,
+			unexpected: []string{`"replicas":`, `"caBundle":`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := manifest.ParseObjects(context.Background(), input)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+			live := make(map[string]*unstructured.Unstructured)
+			for _, u := range test.live {
+				gk := u.GroupVersionKind().GroupKind()
+				live[gk.String()+"/"+u.GetNamespace()+"/"+u.GetName()] = u
+			}
+
+			r := &Reconciler{}
+			r.options = WithIgnoredFields(IgnoredField{GroupKind: schema.GroupKind{Group: "apps", Kind: "Deployment"}, Path: "spec.replicas"})(r.options)
+			r.options.serverSideApply = test.serverSide
+			if err := r.ignoreFields(objects.Items, live); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			m, err := objects.JSONManifest()
+			if err != nil {
+				t.Fatalf("error creating manifest: %v", err)
+			}
+			for _, s := range test.expected {
+				if !strings.Contains(m, s) {
+					t.Errorf("expected %s in manifest, got %s", s, m)
+				}
+			}
+			for _, s := range test.unexpected {
+				if strings.Contains(m, s) {
+					t.Errorf("expected no %s in manifest, got %s", s, m)
+				}
+			}
+		})
+	}
+}
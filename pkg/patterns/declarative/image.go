@@ -21,6 +21,7 @@ import (
 	"strings"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
 )
@@ -33,14 +34,12 @@ func ImageRegistryTransform(registry, imagePullSecret string) ObjectTransform {
 }
 
 func applyImageRegistry(ctx context.Context, operatorObject DeclarativeObject, manifest *manifest.Objects, registry, secret string) error {
-	log := log.Log
+	log := log.FromContext(ctx)
 	if registry == "" && secret == "" {
 		return nil
 	}
 	for _, manifestItem := range manifest.Items {
-		if manifestItem.Kind == "Deployment" || manifestItem.Kind == "DaemonSet" ||
-			manifestItem.Kind == "StatefulSet" || manifestItem.Kind == "Job" ||
-			manifestItem.Kind == "CronJob" {
+		if manifestItem.HasPodTemplate() {
 			if registry != "" {
 				log.WithValues("manifest", manifestItem).WithValues("registry", registry).V(1).Info("applying image registory to manifest")
 				if err := manifestItem.MutateContainers(applyPrivateRegistryToContainer(registry)); err != nil {
@@ -84,3 +83,150 @@ func applyPrivateRegistryToImage(registry, image string) string {
 	imageName := parts[len(parts)-1]
 	return registry + "/" + imageName
 }
+
+// ImageMirror rewrites image references starting with From to start with To instead,
+// eg From: "docker.io", To: "mirror.example.com/dockerhub"
+type ImageMirror struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ImageOverride replaces all references to the image Name (without tag or digest) with Image
+type ImageOverride struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// ImageMirrorTransform returns an ObjectTransform that rewrites the container images of all Pods
+// to use the first matching mirror.  Overrides listed in spec.imageOverrides of the
+// DeclarativeObject are applied before the mirrors.
+func ImageMirrorTransform(mirrors ...ImageMirror) ObjectTransform {
+	return func(ctx context.Context, o DeclarativeObject, m *manifest.Objects) error {
+		overrides, err := imageOverridesFromSpec(o)
+		if err != nil {
+			return err
+		}
+		return applyImageMirrors(ctx, m, mirrors, overrides)
+	}
+}
+
+func imageOverridesFromSpec(o DeclarativeObject) ([]ImageOverride, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+	if err != nil {
+		return nil, fmt.Errorf("error converting object to unstructured: %v", err)
+	}
+	list, _, err := unstructured.NestedSlice(u, "spec", "imageOverrides")
+	if err != nil {
+		return nil, fmt.Errorf("error reading spec.imageOverrides: %v", err)
+	}
+
+	var overrides []ImageOverride
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("spec.imageOverrides[%d] was not an object", i)
+		}
+		var override ImageOverride
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &override); err != nil {
+			return nil, fmt.Errorf("error parsing spec.imageOverrides[%d]: %v", i, err)
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+func applyImageMirrors(ctx context.Context, manifest *manifest.Objects, mirrors []ImageMirror, overrides []ImageOverride) error {
+	log := log.FromContext(ctx)
+	if len(mirrors) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	for _, manifestItem := range manifest.Items {
+		if manifestItem.HasPodTemplate() {
+			log.WithValues("manifest", manifestItem).V(1).Info("applying image mirrors to manifest")
+			if err := manifestItem.MutatePodSpec(mutatePodSpecImages(func(image string) string {
+				return mirrorImage(image, mirrors, overrides)
+			})); err != nil {
+				return fmt.Errorf("error applying image mirrors: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// mutatePodSpecImages applies fn to the image of all containers and init containers in a pod spec
+func mutatePodSpecImages(fn func(string) string) func(map[string]interface{}) error {
+	return func(podSpec map[string]interface{}) error {
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _, err := unstructured.NestedSlice(podSpec, field)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", field, err)
+			}
+			if len(containers) == 0 {
+				continue
+			}
+			for _, co := range containers {
+				container, ok := co.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("container was not an object")
+				}
+				image, _, err := unstructured.NestedString(container, "image")
+				if err != nil {
+					return fmt.Errorf("error reading container image: %v", err)
+				}
+				container["image"] = fn(image)
+			}
+			if err := unstructured.SetNestedSlice(podSpec, containers, field); err != nil {
+				return fmt.Errorf("error setting %s: %v", field, err)
+			}
+		}
+		return nil
+	}
+}
+
+// mirrorImage applies the first matching override, and then the first matching mirror, to image
+func mirrorImage(image string, mirrors []ImageMirror, overrides []ImageOverride) string {
+	name := imageName(image)
+	for _, override := range overrides {
+		if override.Name == name || normalizeImage(override.Name) == normalizeImage(name) {
+			image = override.Image
+			break
+		}
+	}
+
+	for _, mirror := range mirrors {
+		from := strings.TrimSuffix(mirror.From, "/") + "/"
+		to := strings.TrimSuffix(mirror.To, "/") + "/"
+		if strings.HasPrefix(image, from) {
+			return to + strings.TrimPrefix(image, from)
+		}
+		if normalized := normalizeImage(image); strings.HasPrefix(normalized, from) {
+			return to + strings.TrimPrefix(normalized, from)
+		}
+	}
+	return image
+}
+
+// imageName strips the tag and digest from an image reference
+func imageName(image string) string {
+	if i := strings.Index(image, "@"); i != -1 {
+		image = image[:i]
+	}
+	// A colon after the last slash is a tag, otherwise it is a registry port
+	if i := strings.LastIndex(image, ":"); i != -1 && i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// normalizeImage expands an image reference to include the registry, as docker does,
+// eg "nginx:1.19" becomes "docker.io/library/nginx:1.19"
+func normalizeImage(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return "docker.io/library/" + image
+	}
+	if !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost" {
+		return "docker.io/" + image
+	}
+	return image
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestMirrorImage(t *testing.T) {
+	mirrors := []ImageMirror{
+		{From: "gcr.io/google-samples", To: "mirror.example.com/samples"},
+		{From: "docker.io", To: "mirror.example.com/dockerhub/"},
+	}
+	overrides := []ImageOverride{
+		{Name: "redis", Image: "docker.io/library/redis:6.0"},
+		{Name: "quay.io/coreos/etcd", Image: "registry.example.com/etcd:v3.4.14"},
+	}
+
+	tests := []struct {
+		image    string
+		expected string
+	}{
+		{image: "gcr.io/google-samples/gb-frontend:v4", expected: "mirror.example.com/samples/gb-frontend:v4"},
+		{image: "nginx:1.19", expected: "mirror.example.com/dockerhub/library/nginx:1.19"},
+		{image: "bitnami/nginx@sha256:abcd", expected: "mirror.example.com/dockerhub/bitnami/nginx@sha256:abcd"},
+		{image: "redis:5.0", expected: "mirror.example.com/dockerhub/library/redis:6.0"},
+		{image: "quay.io/coreos/etcd:v3.3.0", expected: "registry.example.com/etcd:v3.4.14"},
+		{image: "localhost:5000/app:latest", expected: "localhost:5000/app:latest"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			if actual := mirrorImage(test.image, mirrors, overrides); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestImageMirrorTransform(t *testing.T) {
+	inputManifest := `---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+          - name: init
+            image: busybox
+          containers:
+          - name: cleanup
+            image: gcr.io/google-samples/cleanup:v1
+`
+	instance := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "addons.example.org/v1alpha1",
+			"kind":       "Guestbook",
+			"metadata": map[string]interface{}{
+				"name": "test",
+			},
+			"spec": map[string]interface{}{
+				"imageOverrides": []interface{}{
+					map[string]interface{}{"name": "gcr.io/google-samples/cleanup", "image": "gcr.io/google-samples/cleanup:v2"},
+				},
+			},
+		},
+	}
+
+	objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	transform := ImageMirrorTransform(ImageMirror{From: "gcr.io", To: "mirror.example.com/gcr"}, ImageMirror{From: "docker.io", To: "mirror.example.com/dockerhub"})
+	if err := transform(context.Background(), instance, objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	podSpec, _, _ := unstructured.NestedMap(objects.Items[0].UnstructuredObject().Object, "spec", "jobTemplate", "spec", "template", "spec")
+	expected := map[string]string{
+		"initContainers": "mirror.example.com/dockerhub/library/busybox",
+		"containers":     "mirror.example.com/gcr/google-samples/cleanup:v2",
+	}
+	for field, image := range expected {
+		containers, _, _ := unstructured.NestedSlice(podSpec, field)
+		if actual := containers[0].(map[string]interface{})["image"]; actual != image {
+			t.Errorf("unexpected image for %s, expected %q, got %q", field, image, actual)
+		}
+	}
+}
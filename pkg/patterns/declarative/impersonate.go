@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+)
+
+// ReasonMissingServiceAccount is the reason for a true ConditionStalled when WithImpersonation is used and the
+// DeclarativeObject doesn't set spec.serviceAccountName
+const ReasonMissingServiceAccount = "MissingServiceAccount"
+
+type impersonateKey struct{}
+
+// contextWithImpersonation makes the manifest be applied as user
+func contextWithImpersonation(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, impersonateKey{}, user)
+}
+
+// impersonationArgs returns the args applying the manifest as the user impersonated in ctx, if any
+func impersonationArgs(ctx context.Context) []string {
+	user, _ := ctx.Value(impersonateKey{}).(string)
+	if user == "" {
+		return nil
+	}
+	return []string{applier.ImpersonateArgPrefix + user}
+}
+
+// impersonating returns a copy of r whose dynamic client acts as user, so that every object of the manifest the
+// reconciler writes, not only those applied with kubectl, is written with the permissions of user
+func (r *Reconciler) impersonating(user string) (*Reconciler, error) {
+	if r.config == nil {
+		return nil, fmt.Errorf("no client configuration to impersonate %s with", user)
+	}
+	config := rest.CopyConfig(r.config)
+	config.Impersonate = rest.ImpersonationConfig{UserName: user}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client impersonating %s: %v", user, err)
+	}
+
+	target := *r
+	target.operatorDynamicClient = r.dynamicClient
+	target.dynamicClient = dynamicClient
+	return &target, nil
+}
+
+// accessReviewClient returns the dynamic client of the operator, which creates access reviews even when the
+// objects are written as an impersonated ServiceAccount
+func (r *Reconciler) accessReviewClient() dynamic.Interface {
+	if r.operatorDynamicClient != nil {
+		return r.operatorDynamicClient
+	}
+	return r.dynamicClient
+}
+
+// serviceAccountUser returns the user of the ServiceAccount named in spec.serviceAccountName of instance, in the
+// namespace of instance, or ns if instance is cluster-scoped
+func serviceAccountUser(instance DeclarativeObject, ns string) (string, error) {
+	obj, err := objectMap(instance)
+	if err != nil {
+		return "", err
+	}
+	name, _, err := unstructured.NestedString(obj, "spec", "serviceAccountName")
+	if err != nil {
+		return "", fmt.Errorf("error reading spec.serviceAccountName: %v", err)
+	}
+	if name == "" {
+		return "", NewTerminalError(ReasonMissingServiceAccount, fmt.Errorf("spec.serviceAccountName must be set to apply the manifest"))
+	}
+	namespace := instance.GetNamespace()
+	if namespace == "" {
+		namespace = ns
+	}
+	return fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name), nil
+}
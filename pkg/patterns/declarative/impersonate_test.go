@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestServiceAccountUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		namespace      string
+		serviceAccount string
+		expected       string
+		expectErr      bool
+	}{
+		{name: "namespaced", namespace: "tenant", serviceAccount: "addon", expected: "system:serviceaccount:tenant:addon"},
+		{name: "cluster-scoped", serviceAccount: "addon", expected: "system:serviceaccount:kube-system:addon"},
+		{name: "not set", namespace: "tenant", expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instance := newGuestbook(test.namespace, "test", time.Now())
+			if test.serviceAccount != "" {
+				instance.Object["spec"] = map[string]interface{}{"serviceAccountName": test.serviceAccount}
+			}
+			user, err := serviceAccountUser(instance, "kube-system")
+			if test.expectErr != IsTerminalError(err) {
+				t.Fatalf("expected terminal error %v, got %v", test.expectErr, err)
+			}
+			if user != test.expected {
+				t.Errorf("expected user %q, got %q", test.expected, user)
+			}
+		})
+	}
+}
+
+func TestApplyImpersonated(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	applier := &recordingApplier{}
+	r := &Reconciler{kubectl: applier}
+	ctx = contextWithImpersonation(ctx, "system:serviceaccount:tenant:addon")
+	if _, err := r.applyWithResults(ctx, "tenant", "", objects.Items, "--force"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := [][]string{{"--force", "--as=system:serviceaccount:tenant:addon"}}
+	if !reflect.DeepEqual(applier.args, expected) {
+		t.Errorf("expected args %v, got %v", expected, applier.args)
+	}
+}
+
+func TestImpersonating(t *testing.T) {
+	operatorClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	r := &Reconciler{config: &rest.Config{Host: "https://cluster.example.org"}, dynamicClient: operatorClient}
+
+	target, err := r.impersonating("system:serviceaccount:tenant:addon")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.dynamicClient == operatorClient {
+		t.Errorf("expected the objects to be written with an impersonating client")
+	}
+	if target.accessReviewClient() != operatorClient {
+		t.Errorf("expected access reviews to be created by the operator")
+	}
+	if r.dynamicClient != operatorClient || r.config.Impersonate.UserName != "" {
+		t.Errorf("expected the reconciler not to be modified")
+	}
+
+	if _, err := (&Reconciler{dynamicClient: operatorClient}).impersonating("system:serviceaccount:tenant:addon"); err == nil {
+		t.Errorf("expected an error impersonating without a client configuration")
+	}
+}
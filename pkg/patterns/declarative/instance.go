@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const (
+	// InstanceNameLabel is set to the name of the DeclarativeObject in multi-instance mode
+	InstanceNameLabel = "addons.k8s.io/instance-name"
+	// InstanceNamespaceLabel is set to the namespace of the DeclarativeObject in multi-instance mode
+	InstanceNamespaceLabel = "addons.k8s.io/instance-namespace"
+)
+
+// InstanceLabels is a LabelMaker returning labels identifying the DeclarativeObject.
+// It can be used with WatchAll to scope watches when WithMultiInstance is used.
+func InstanceLabels(ctx context.Context, o DeclarativeObject) map[string]string {
+	return map[string]string{
+		InstanceNameLabel:      o.GetName(),
+		InstanceNamespaceLabel: o.GetNamespace(),
+	}
+}
+
+// labelsFor returns the labels added to all objects deployed for instance
+func (r *Reconciler) labelsFor(ctx context.Context, instance DeclarativeObject) map[string]string {
+	labels := make(map[string]string)
+	if r.options.labelMaker != nil {
+		for k, v := range r.options.labelMaker(ctx, instance) {
+			labels[k] = v
+		}
+	}
+	if r.options.multiInstance {
+		for k, v := range InstanceLabels(ctx, instance) {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// applyInstanceNames prefixes the names of all objects with the name of the DeclarativeObject.
+// Cluster-scoped objects are also prefixed with the namespace of a namespaced DeclarativeObject,
+// as instances in different namespaces may have the same name.
+func (r *Reconciler) applyInstanceNames(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+	prefix := instance.GetName() + "-"
+	clusterPrefix := prefix
+	if instance.GetNamespace() != "" {
+		clusterPrefix = instance.GetNamespace() + "-" + prefix
+	}
+
+	manifestScopes := crdScopes(objects)
+	return applyNamePrefixSuffix(ctx, objects, func(o *manifest.Object) (string, string) {
+		if namespaced, err := r.isNamespaced(ctx, o, manifestScopes); err == nil && !namespaced {
+			return clusterPrefix, ""
+		}
+		return prefix, ""
+	})
+}
+
+// instanceSelectorPaths are the paths of the pod selectors and pod template labels of each kind, to which the instance
+// labels are added.  The selectors of Jobs are generated from the labels of their pod template.
+var instanceSelectorPaths = map[schema.GroupKind][][]string{
+	{Group: "apps", Kind: "Deployment"}:            {{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}},
+	{Group: "apps", Kind: "StatefulSet"}:           {{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}},
+	{Group: "apps", Kind: "DaemonSet"}:             {{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}},
+	{Group: "apps", Kind: "ReplicaSet"}:            {{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}},
+	{Group: "batch", Kind: "Job"}:                  {{"spec", "template", "metadata", "labels"}},
+	{Group: "batch", Kind: "CronJob"}:              {{"spec", "jobTemplate", "spec", "template", "metadata", "labels"}},
+	{Kind: "Service"}:                              {{"spec", "selector"}},
+	{Group: "policy", Kind: "PodDisruptionBudget"}: {{"spec", "selector", "matchLabels"}},
+}
+
+// applyInstanceSelectors adds the instance labels to the pod selectors and pod templates of the objects, so that the
+// workloads and Services of instances in the same namespace don't select each other's pods.  Services without a
+// selector are left alone, as their endpoints are managed separately.
+func applyInstanceSelectors(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+	labels := InstanceLabels(ctx, instance)
+	for _, o := range objects.Items {
+		for _, path := range instanceSelectorPaths[o.GroupKind()] {
+			selector, found, err := o.NestedStringMap(path...)
+			if err != nil {
+				return fmt.Errorf("error reading %v of %s %s: %v", path, o.Kind, o.Name, err)
+			}
+			if o.Kind == "Service" && len(selector) == 0 {
+				continue
+			}
+			if !found {
+				selector = make(map[string]string)
+			}
+			for k, v := range labels {
+				selector[k] = v
+			}
+			if err := o.SetNestedStringMap(selector, path...); err != nil {
+				return fmt.Errorf("error setting %v of %s %s: %v", path, o.Kind, o.Name, err)
+			}
+		}
+	}
+	return nil
+}
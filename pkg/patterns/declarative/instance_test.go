@@ -0,0 +1,208 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestMultiInstance(t *testing.T) {
+	inputManifest := `---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: frontend
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: frontend
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: frontend
+  annotations:
+    addons.k8s.io/depends-on: ClusterRole/frontend
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: frontend
+subjects:
+- kind: ServiceAccount
+  name: frontend
+`
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding"}, meta.RESTScopeRoot)
+
+	r := &Reconciler{
+		restMapper: mapper,
+		options: reconcilerParams{
+			multiInstance: true,
+			labelMaker: func(context.Context, DeclarativeObject) map[string]string {
+				return map[string]string{"app": "guestbook"}
+			},
+		},
+	}
+	instance := &unstructured.Unstructured{}
+	instance.SetName("blue")
+	instance.SetNamespace("team-a")
+
+	objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	if err := r.applyInstanceNames(context.Background(), instance, objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.enforceNamespace(context.Background(), objects, r.targetNamespace(context.Background(), instance)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"ServiceAccount":     "team-a/blue-frontend",
+		"ClusterRole":        "/team-a-blue-frontend",
+		"ClusterRoleBinding": "/team-a-blue-frontend",
+	}
+	for _, o := range objects.Items {
+		if actual := o.Namespace + "/" + o.Name; actual != expected[o.Kind] {
+			t.Errorf("unexpected name for %s, expected %q, got %q", o.Kind, expected[o.Kind], actual)
+		}
+	}
+
+	binding := objects.Items[2].UnstructuredObject().Object
+	if roleRef, _, _ := unstructured.NestedString(binding, "roleRef", "name"); roleRef != "team-a-blue-frontend" {
+		t.Errorf("unexpected roleRef name %q", roleRef)
+	}
+	// The dependencies are ordered by the new names
+	if err := sortByDependencies(objects); err != nil {
+		t.Errorf("unexpected error ordering renamed objects: %v", err)
+	}
+
+	expectedLabels := map[string]string{
+		"app":                  "guestbook",
+		InstanceNameLabel:      "blue",
+		InstanceNamespaceLabel: "team-a",
+	}
+	if labels := r.labelsFor(context.Background(), instance); !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("unexpected labels, expected %v, got %v", expectedLabels, labels)
+	}
+}
+
+func TestMultiInstanceSideBySide(t *testing.T) {
+	manifests := staticManifest{"manifest.yaml": `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  selector:
+    matchLabels:
+      app: frontend
+  template:
+    metadata:
+      labels:
+        app: frontend
+    spec:
+      containers:
+      - name: frontend
+        image: frontend
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+spec:
+  selector:
+    app: frontend
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: external
+spec:
+  type: ExternalName
+  externalName: example.org
+`}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, meta.RESTScopeNamespace)
+	r := &Reconciler{restMapper: mapper, options: reconcilerParams{manifestController: manifests, multiInstance: true}}
+
+	// build returns the pod selectors of the Deployment and Service of the instance, and the labels of its pods
+	build := func(name string) (labels.Selector, labels.Selector, labels.Set) {
+		t.Helper()
+		instance := newGuestbook("default", name, time.Now())
+		objects, err := r.BuildDeploymentObjects(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, instance)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var deployment, service labels.Selector
+		var pods labels.Set
+		for _, o := range objects.Items {
+			switch o.Name {
+			case name + "-frontend":
+				if o.Kind == "Deployment" {
+					selector, _, _ := o.NestedStringMap("spec", "selector", "matchLabels")
+					deployment = labels.SelectorFromSet(selector)
+					pods, _, _ = o.NestedStringMap("spec", "template", "metadata", "labels")
+				} else {
+					selector, _, _ := o.NestedStringMap("spec", "selector")
+					service = labels.SelectorFromSet(selector)
+				}
+			case name + "-external":
+				if _, found, _ := o.NestedStringMap("spec", "selector"); found {
+					t.Errorf("expected no selector to be added to a Service without one")
+				}
+			}
+		}
+		return deployment, service, pods
+	}
+
+	blueDeployment, blueService, bluePods := build("blue")
+	greenDeployment, greenService, greenPods := build("green")
+	for _, test := range []struct {
+		name     string
+		selector labels.Selector
+		own      labels.Set
+		other    labels.Set
+	}{
+		{"blue deployment", blueDeployment, bluePods, greenPods},
+		{"blue service", blueService, bluePods, greenPods},
+		{"green deployment", greenDeployment, greenPods, bluePods},
+		{"green service", greenService, greenPods, bluePods},
+	} {
+		if !test.selector.Matches(test.own) {
+			t.Errorf("expected the %s to select its pods", test.name)
+		}
+		if test.selector.Matches(test.other) {
+			t.Errorf("expected the %s not to select the pods of the other instance", test.name)
+		}
+	}
+}
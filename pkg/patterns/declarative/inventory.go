@@ -0,0 +1,185 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const (
+	// InventoryKey is the key in the inventory ConfigMap holding the JSON list of InventoryEntries
+	InventoryKey = "inventory.json"
+	// InventoryLabel is set on inventory ConfigMaps
+	InventoryLabel = "addons.k8s.io/inventory"
+
+	// defaultInventoryNamespace holds the inventories of cluster-scoped DeclarativeObjects, which own them so
+	// that they are garbage collected with the DeclarativeObject
+	defaultInventoryNamespace = "default"
+)
+
+// InventoryEntry identifies an object applied for a DeclarativeObject
+type InventoryEntry struct {
+	Group     string    `json:"group,omitempty"`
+	Version   string    `json:"version"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+}
+
+func (e InventoryEntry) String() string {
+	return strings.Join([]string{e.Group, e.Version, e.Kind, e.Namespace, e.Name}, "/")
+}
+
+// InventoryName returns the name and namespace of the ConfigMap holding the inventory of instance.
+// Inventories of cluster-scoped DeclarativeObjects are kept in the default namespace.
+func InventoryName(instance DeclarativeObject, kind string) types.NamespacedName {
+	ns := instance.GetNamespace()
+	if ns == "" {
+		ns = defaultInventoryNamespace
+	}
+	return types.NamespacedName{
+		Namespace: ns,
+		Name:      strings.ToLower(kind) + "-" + instance.GetName() + "-inventory",
+	}
+}
+
+// instanceID returns an identifier for instance which can be used as a label value, as names may be too long
+func instanceID(instance DeclarativeObject, gvk schema.GroupVersionKind) string {
+	id := sha256.Sum256([]byte(gvk.GroupKind().String() + "/" + instance.GetNamespace() + "/" + instance.GetName()))
+	return hex.EncodeToString(id[:16])
+}
+
+// ReadInventory returns the objects last applied for instance, as recorded by WithInventory.
+// It returns nil if no inventory has been recorded.
+func ReadInventory(ctx context.Context, c client.Client, instance DeclarativeObject) ([]InventoryEntry, error) {
+	gvk, err := apiutil.GVKForObject(instance, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, InventoryName(instance, gvk.Kind), cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading inventory: %v", err)
+	}
+
+	var entries []InventoryEntry
+	if err := json.Unmarshal([]byte(cm.Data[InventoryKey]), &entries); err != nil {
+		return nil, fmt.Errorf("error parsing inventory: %v", err)
+	}
+	return entries, nil
+}
+
+// buildInventory returns the inventory entries for the applied objects, looking up their UIDs.  Namespaced objects
+// without a namespace are recorded in the namespace they are applied to.
+func (r *Reconciler) buildInventory(ctx context.Context, objects []*manifest.Object) []InventoryEntry {
+	var entries []InventoryEntry
+	for _, o := range objects {
+		gvk := o.GroupVersionKind()
+		entry := InventoryEntry{
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Namespace: o.Namespace,
+			Name:      o.Name,
+		}
+		if entry.Namespace == "" {
+			if namespaced, err := r.isNamespaced(ctx, o, nil); err == nil && namespaced {
+				entry.Namespace = applyNamespaceFromContext(ctx)
+			}
+		}
+		if u, err := GetObjectFromCluster(ctx, o, r); err == nil && u != nil {
+			entry.Namespace = u.GetNamespace()
+			entry.UID = u.GetUID()
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].String() < entries[j].String()
+	})
+	return entries
+}
+
+// recordInventory writes the inventory of the applied objects to the inventory ConfigMap of instance
+func (r *Reconciler) recordInventory(ctx context.Context, instance DeclarativeObject, objects []*manifest.Object) error {
+	log := log.FromContext(ctx)
+
+	gvk, err := apiutil.GVKForObject(instance, r.client.Scheme())
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(r.buildInventory(ctx, objects))
+	if err != nil {
+		return fmt.Errorf("error building inventory: %v", err)
+	}
+	name := InventoryName(instance, gvk.Kind)
+
+	cm := &corev1.ConfigMap{}
+	err = r.client.Get(ctx, name, cm)
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name.Name,
+				Namespace: name.Namespace,
+				Labels:    map[string]string{InventoryLabel: "true"},
+				// Clean up the inventory with the DeclarativeObject, which may be cluster-scoped
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(instance, gvk)},
+			},
+			Data: map[string]string{InventoryKey: string(b)},
+		}
+		log.WithValues("inventory", name.String()).Info("creating inventory")
+		if err := r.client.Create(ctx, cm); err != nil {
+			return fmt.Errorf("error creating inventory: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading inventory: %v", err)
+	}
+
+	if cm.Data[InventoryKey] == string(b) {
+		return nil
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[InventoryKey] = string(b)
+	log.WithValues("inventory", name.String()).V(1).Info("updating inventory")
+	if err := r.client.Update(ctx, cm); err != nil {
+		return fmt.Errorf("error updating inventory: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestRecordInventory(t *testing.T) {
+	// The Deployment is recorded in the namespace it is applied to
+	ctx := contextWithApplyNamespace(context.Background(), "default")
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	existing := objects.Items[0].UnstructuredObject().DeepCopy()
+	existing.SetUID("config-uid")
+
+	instance := newGuestbook("default", "test", time.Now())
+	instance.SetUID("instance-uid")
+	r := &Reconciler{
+		client:        fake.NewClientBuilder().Build(),
+		restMapper:    mapper,
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing),
+	}
+
+	if err := r.recordInventory(ctx, instance, objects.Items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	inventory, err := ReadInventory(ctx, r.client, instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []InventoryEntry{
+		{Group: "", Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "config", UID: "config-uid"},
+		{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "app"},
+	}
+	if !reflect.DeepEqual(inventory, expected) {
+		t.Errorf("unexpected inventory, expected %v, got %v", expected, inventory)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := r.client.Get(ctx, InventoryName(instance, "Guestbook"), cm); err != nil {
+		t.Fatalf("error getting inventory: %v", err)
+	}
+	if cm.Name != "guestbook-test-inventory" || len(cm.OwnerReferences) != 1 || cm.OwnerReferences[0].UID != "instance-uid" {
+		t.Errorf("unexpected inventory ConfigMap %v", cm.ObjectMeta)
+	}
+
+	// Removing an object from the manifest updates the inventory
+	if err := r.recordInventory(ctx, instance, objects.Items[:1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inventory, err = ReadInventory(ctx, r.client, instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(inventory, expected[:1]) {
+		t.Errorf("unexpected inventory, expected %v, got %v", expected[:1], inventory)
+	}
+
+	// The inventory of a cluster-scoped DeclarativeObject is owned by it, to be garbage collected with it
+	clusterInstance := newGuestbook("", "cluster", time.Now())
+	clusterInstance.SetUID("cluster-uid")
+	if err := r.recordInventory(ctx, clusterInstance, objects.Items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.client.Get(ctx, InventoryName(clusterInstance, "Guestbook"), cm); err != nil {
+		t.Fatalf("error getting inventory: %v", err)
+	}
+	if cm.Namespace != "default" || len(cm.OwnerReferences) != 1 || cm.OwnerReferences[0].UID != "cluster-uid" {
+		t.Errorf("unexpected inventory ConfigMap %v", cm.ObjectMeta)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/cli-utils/pkg/apply/event"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+)
+
+// ApplyEventsFromContext returns the events of the InventoryApplier, when called from a Status or Sink.
+// It returns nil unless WithInventoryApplier is used and the manifest was applied.
+func ApplyEventsFromContext(ctx context.Context) []event.Event {
+	return applier.EventsFromContext(ctx)
+}
+
+// applierInventory returns the inventory in which the InventoryApplier records the objects of instance,
+// next to the inventory kept by WithInventory
+func applierInventory(instance DeclarativeObject, gvk schema.GroupVersionKind) applier.Inventory {
+	name := InventoryName(instance, gvk.Kind)
+	return applier.Inventory{
+		Namespace: name.Namespace,
+		Name:      name.Name,
+		ID:        instanceID(instance, gvk),
+	}
+}
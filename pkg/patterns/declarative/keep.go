@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// KeepOnDeleteAnnotation set to "true" on an object in the manifest keeps the object when it is removed from the
+// manifest or the DeclarativeObject is deleted, eg for PersistentVolumeClaims and CustomResourceDefinitions
+const KeepOnDeleteAnnotation = applier.KeepOnDeleteAnnotation
+
+// keepOnDelete returns true if o is annotated to be kept when it is no longer managed
+func keepOnDelete(o *manifest.Object) bool {
+	return o.UnstructuredObject().GetAnnotations()[KeepOnDeleteAnnotation] == "true"
+}
+
+// removePruneLabels removes the labels used to prune the manifest from o, so that it isn't selected for pruning
+func (r *Reconciler) removePruneLabels(ctx context.Context, instance DeclarativeObject, o *manifest.Object) error {
+	labels := o.UnstructuredObject().GetLabels()
+	if len(labels) == 0 {
+		return nil
+	}
+	for k := range r.labelsFor(ctx, instance) {
+		delete(labels, k)
+	}
+	if err := o.SetNestedStringMap(labels, "metadata", "labels"); err != nil {
+		return fmt.Errorf("error removing labels from %s %s: %v", o.Kind, o.Name, err)
+	}
+	return nil
+}
+
+// excludeKeptFromPrune removes the prune labels from the objects annotated with KeepOnDeleteAnnotation
+func (r *Reconciler) excludeKeptFromPrune(ctx context.Context, instance DeclarativeObject, objects []*manifest.Object) error {
+	for _, o := range objects {
+		if !keepOnDelete(o) {
+			continue
+		}
+		if err := r.removePruneLabels(ctx, instance, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestExcludeKeptFromPrune(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  labels:
+    app: guestbook
+    tier: storage
+  annotations:
+    addons.k8s.io/keep-on-delete: "true"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  labels:
+    app: guestbook
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	r := &Reconciler{}
+	r.options = WithLabels(func(ctx context.Context, instance DeclarativeObject) map[string]string {
+		return map[string]string{"app": "guestbook"}
+	})(r.options)
+
+	instance := newGuestbook("default", "test", time.Now())
+	if err := r.excludeKeptFromPrune(ctx, instance, objects.Items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []map[string]string{{"tier": "storage"}, {"app": "guestbook"}}
+	for i, o := range objects.Items {
+		if labels := o.UnstructuredObject().GetLabels(); !reflect.DeepEqual(labels, expected[i]) {
+			t.Errorf("expected labels %v on %s, got %v", expected[i], o.Name, labels)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"strings"
+	"time"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+)
+
+// kubectlVerifyTimeout bounds the check of the kubectl binary of WithExecApplier
+const kubectlVerifyTimeout = time.Minute
+
+// kubectlFlags returns the flags of kubectl apply the options pass, beyond applier.RequiredApplyFlags
+func (r *Reconciler) kubectlFlags() []string {
+	flags := []string{"--force"}
+	if r.usesServerSideApply() {
+		flags = append(flags, applier.ServerSideArg, strings.TrimSuffix(applier.FieldManagerArgPrefix, "="), applier.ForceConflictsArg)
+	}
+	return flags
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestKubectlFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []reconcilerOption
+		expected []string
+	}{
+		{
+			name:     "client-side",
+			expected: []string{"--force"},
+		},
+		{
+			name:     "server-side",
+			opts:     []reconcilerOption{WithServerSideApply()},
+			expected: []string{"--force", "--server-side", "--field-manager", "--force-conflicts"},
+		},
+		{
+			name:     "server-side for some kinds",
+			opts:     []reconcilerOption{WithApplyStrategy(schema.GroupKind{Group: "apps", Kind: "Deployment"}, ApplyStrategyServerSide)},
+			expected: []string{"--force", "--server-side", "--field-manager", "--force-conflicts"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{}
+			for _, opt := range test.opts {
+				r.options = opt(r.options)
+			}
+			if flags := r.kubectlFlags(); !reflect.DeepEqual(flags, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, flags)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// contextWithObjectLogger returns ctx with a logger attributing the logs of the reconcile of instance to its
+// namespace, name and generation, so the logs of concurrent reconciles can be told apart, and the logger.
+// The reconciler logs the outcome of each reconcile at the default level, the details of each stage at V(1),
+// and a line per object of the manifest at V(2).
+func contextWithObjectLogger(ctx context.Context, instance DeclarativeObject) (context.Context, logr.Logger) {
+	logger := log.FromContext(ctx).WithValues(
+		"object", instance.GetNamespace()+"/"+instance.GetName(),
+		"generation", instance.GetGeneration(),
+	)
+	return log.IntoContext(ctx, logger), logger
+}
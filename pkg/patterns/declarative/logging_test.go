@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// recordingLogger is a logr.Logger recording the values it was given
+type recordingLogger struct {
+	logr.Logger
+	values []interface{}
+}
+
+func (l *recordingLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return &recordingLogger{Logger: l.Logger, values: append(append([]interface{}{}, l.values...), keysAndValues...)}
+}
+
+func TestContextWithObjectLogger(t *testing.T) {
+	instance := &unstructured.Unstructured{}
+	instance.SetNamespace("ns")
+	instance.SetName("app")
+	instance.SetGeneration(3)
+
+	ctx := log.IntoContext(context.Background(), &recordingLogger{Logger: log.NullLogger{}})
+	ctx, logger := contextWithObjectLogger(ctx, instance)
+
+	want := []interface{}{"object", "ns/app", "generation", int64(3)}
+	if got := logger.(*recordingLogger).values; !reflect.DeepEqual(got, want) {
+		t.Errorf("logger values = %v, want %v", got, want)
+	}
+	if got := log.FromContext(ctx).(*recordingLogger).values; !reflect.DeepEqual(got, want) {
+		t.Errorf("values of the logger of the context = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// Migration moves an addon from one version to another where applying the new manifest isn't enough, eg by
+// renaming objects or moving data.  It is called with the objects of the new manifest before they are applied,
+// and is retried if it fails, so it must be idempotent.
+type Migration func(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error
+
+type versionMigration struct {
+	from      string
+	to        string
+	migration Migration
+}
+
+// matches returns true if the migration is for the change from deployed to requested
+func (m versionMigration) matches(deployed, requested string) bool {
+	return versionMatches(m.from, deployed) && versionMatches(m.to, requested)
+}
+
+// versionMatches returns true if version is pattern, or starts with pattern followed by a dot,
+// so that "1.2" matches "1.2.3" but not "1.20.0".  A leading "v" is ignored.
+func versionMatches(pattern, version string) bool {
+	pattern = strings.TrimPrefix(pattern, "v")
+	version = strings.TrimPrefix(version, "v")
+	if pattern == "" || version == "" {
+		return false
+	}
+	return version == pattern || strings.HasPrefix(version, pattern+".")
+}
+
+// migrate runs the migrations for the change from the deployed version to spec.version.  With
+// WithRevisionHistory, the objects of the latest revision which aren't in objects are deleted first.
+func (r *Reconciler) migrate(ctx context.Context, instance DeclarativeObject, ns string, objects *manifest.Objects) error {
+	log := log.FromContext(ctx)
+
+	deployed, err := r.deployedVersion(ctx, instance)
+	if err != nil {
+		return err
+	}
+	requested := specVersion(instance)
+	if deployed == requested {
+		return nil
+	}
+	var migrations []versionMigration
+	for _, m := range r.options.migrations {
+		if m.matches(deployed, requested) {
+			migrations = append(migrations, m)
+		}
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	if r.options.revisionHistory {
+		revisions, err := r.listRevisions(ctx, instance)
+		if err != nil {
+			return err
+		}
+		if len(revisions) != 0 {
+			if err := r.deleteRemovedObjects(ctx, instance, ns, revisions[len(revisions)-1], objects); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, m := range migrations {
+		log.WithValues("from", deployed).WithValues("to", requested).Info("running migration")
+		if err := m.migration(ctx, instance, objects); err != nil {
+			return fmt.Errorf("error migrating from version %s to %s: %w", deployed, requested, err)
+		}
+	}
+	return nil
+}
+
+// tracksDeployedVersion returns true if status.deployedVersion should be maintained
+func (r *Reconciler) tracksDeployedVersion() bool {
+	return len(r.options.versionPolicies) != 0 || len(r.options.migrations) != 0 || r.options.reconcileStatus
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name      string
+		deployed  string
+		requested string
+		expected  []string
+	}{
+		{name: "first install", requested: "1.2.0"},
+		{name: "unchanged", deployed: "1.2.0", requested: "1.2.0"},
+		{name: "minor upgrade", deployed: "1.2.3", requested: "v1.3.0", expected: []string{"1.2-1.3", "any-1.3"}},
+		{name: "exact versions", deployed: "1.3.0", requested: "1.3.1", expected: []string{"1.3.0-1.3.1", "any-1.3"}},
+		{name: "prefix at a dot only", deployed: "1.20.0", requested: "1.3.0", expected: []string{"any-1.3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			instance := newGuestbook("default", "test", time.Now())
+			if err := unstructured.SetNestedField(instance.Object, test.requested, "spec", "version"); err != nil {
+				t.Fatalf("error setting version: %v", err)
+			}
+			if test.deployed != "" {
+				if err := unstructured.SetNestedField(instance.Object, test.deployed, "status", "deployedVersion"); err != nil {
+					t.Fatalf("error setting deployed version: %v", err)
+				}
+			}
+
+			var ran []string
+			migration := func(name string) Migration {
+				return func(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+					ran = append(ran, name)
+					return nil
+				}
+			}
+			r := &Reconciler{client: fake.NewClientBuilder().Build()}
+			for _, opt := range []reconcilerOption{
+				WithMigration("1.2", "1.3", migration("1.2-1.3")),
+				WithMigration("1.3.0", "1.3.1", migration("1.3.0-1.3.1")),
+				WithMigration("1", "1.3", migration("any-1.3")),
+			} {
+				r.options = opt(r.options)
+			}
+
+			if err := r.migrate(ctx, instance, "default", &manifest.Objects{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ran, test.expected) {
+				t.Errorf("expected migrations %v, got %v", test.expected, ran)
+			}
+		})
+	}
+}
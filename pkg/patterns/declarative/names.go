@@ -0,0 +1,261 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// NameAffixes returns the prefix and suffix to add to the names of the objects deployed for a DeclarativeObject
+type NameAffixes = func(context.Context, DeclarativeObject) (prefix string, suffix string)
+
+// InstanceNamePrefix is a NameAffixes that prefixes object names with the name of the DeclarativeObject,
+// eg the objects for a CR named "blue" are named "blue-frontend"
+func InstanceNamePrefix(ctx context.Context, o DeclarativeObject) (string, string) {
+	return o.GetName() + "-", ""
+}
+
+// kinds whose names have a required format, and so are never renamed
+var fixedNameKinds = map[string]bool{
+	"CustomResourceDefinition": true,
+	"APIService":               true,
+	"Namespace":                true,
+}
+
+// NamePrefixSuffixTransform returns an ObjectTransform that adds a prefix and suffix to the names
+// of all objects, so that multiple instances of an addon can be installed in the same namespace.
+//
+// References between objects in the manifest are updated where they can be found:
+// ConfigMaps, Secrets, PersistentVolumeClaims and ServiceAccounts in pod specs, the serviceName
+// of StatefulSets, the roleRef and subjects of RoleBindings, the backends of Ingresses,
+// environment variables whose value is the name or a hostname of a renamed Service, and the
+// DependsOnAnnotation of all objects.
+func NamePrefixSuffixTransform(affixes NameAffixes) ObjectTransform {
+	return func(ctx context.Context, o DeclarativeObject, m *manifest.Objects) error {
+		prefix, suffix := affixes(ctx, o)
+		if prefix == "" && suffix == "" {
+			return nil
+		}
+		return applyNamePrefixSuffix(ctx, m, func(*manifest.Object) (string, string) {
+			return prefix, suffix
+		})
+	}
+}
+
+// applyNamePrefixSuffix renames all objects using the prefix and suffix returned by affixes,
+// and updates references to the renamed objects
+func applyNamePrefixSuffix(ctx context.Context, objects *manifest.Objects, affixes func(*manifest.Object) (string, string)) error {
+	log := log.FromContext(ctx)
+
+	// renamed maps kind to the old and new names of the renamed objects
+	renamed := make(map[string]map[string]string)
+	for _, o := range objects.Items {
+		if fixedNameKinds[o.Kind] || o.Name == "" {
+			continue
+		}
+		prefix, suffix := affixes(o)
+		if prefix == "" && suffix == "" {
+			continue
+		}
+		newName := prefix + o.Name + suffix
+		if renamed[o.Kind] == nil {
+			renamed[o.Kind] = make(map[string]string)
+		}
+		renamed[o.Kind][o.Name] = newName
+		log.WithValues("kind", o.Kind).WithValues("name", o.Name).WithValues("newName", newName).V(1).Info("renaming object")
+		o.SetName(newName)
+	}
+
+	refs := &nameReferences{renamed: renamed}
+	for _, o := range objects.Items {
+		u := o.UnstructuredObject().Object
+		// References are updated in place, so invalidate any cached json
+		o.SetName(o.Name)
+		switch o.Kind {
+		case "Deployment", "DaemonSet", "StatefulSet", "Job", "CronJob":
+			if o.Kind == "StatefulSet" {
+				refs.rename(u, "Service", "spec", "serviceName")
+			}
+			if err := o.MutatePodSpec(refs.fixPodSpec); err != nil {
+				return fmt.Errorf("error updating references in %s %s: %v", o.Kind, o.Name, err)
+			}
+		case "RoleBinding", "ClusterRoleBinding":
+			if roleRef, ok := u["roleRef"].(map[string]interface{}); ok {
+				if kind, ok := roleRef["kind"].(string); ok {
+					refs.rename(roleRef, kind, "name")
+				}
+			}
+			for _, subject := range refs.list(u, "subjects") {
+				if kind, _ := subject["kind"].(string); kind == "ServiceAccount" {
+					refs.rename(subject, "ServiceAccount", "name")
+				}
+			}
+		case "Ingress":
+			refs.fixIngressBackend(u, "spec", "defaultBackend")
+			refs.fixIngressBackend(u, "spec", "backend")
+			for _, rule := range refs.list(u, "spec", "rules") {
+				for _, path := range refs.list(rule, "http", "paths") {
+					refs.fixIngressBackend(path, "backend")
+				}
+			}
+			for _, tls := range refs.list(u, "spec", "tls") {
+				refs.rename(tls, "Secret", "secretName")
+			}
+		}
+		refs.fixDependsOn(u)
+	}
+	return nil
+}
+
+// nameReferences updates references to renamed objects
+type nameReferences struct {
+	renamed map[string]map[string]string
+}
+
+// rename updates the string at fields in m, if it is the name of a renamed object of kind
+func (n *nameReferences) rename(m map[string]interface{}, kind string, fields ...string) {
+	for _, field := range fields[:len(fields)-1] {
+		child, ok := m[field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = child
+	}
+	last := fields[len(fields)-1]
+	name, ok := m[last].(string)
+	if !ok {
+		return
+	}
+	if newName, found := n.renamed[kind][name]; found {
+		m[last] = newName
+	}
+}
+
+// fixDependsOn updates the references to renamed objects in the DependsOnAnnotation of the object u, so that
+// the objects are still ordered by their dependencies once renamed
+func (n *nameReferences) fixDependsOn(u map[string]interface{}) {
+	metadata, _ := u["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	refs, ok := annotations[DependsOnAnnotation].(string)
+	if !ok {
+		return
+	}
+	var fixed []string
+	for _, ref := range strings.Split(refs, ",") {
+		ref = strings.TrimSpace(ref)
+		// Kind/name or group/Kind/name
+		parts := strings.Split(ref, "/")
+		if len(parts) >= 2 {
+			kind, name := parts[len(parts)-2], parts[len(parts)-1]
+			if newName, found := n.renamed[kind][name]; found {
+				parts[len(parts)-1] = newName
+				ref = strings.Join(parts, "/")
+			}
+		}
+		fixed = append(fixed, ref)
+	}
+	annotations[DependsOnAnnotation] = strings.Join(fixed, ",")
+}
+
+// list returns the objects in the list at fields in m
+func (n *nameReferences) list(m map[string]interface{}, fields ...string) []map[string]interface{} {
+	var v interface{} = m
+	for _, field := range fields {
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = child[field]
+	}
+	items, _ := v.([]interface{})
+	var out []map[string]interface{}
+	for _, item := range items {
+		if itemMap, ok := item.(map[string]interface{}); ok {
+			out = append(out, itemMap)
+		}
+	}
+	return out
+}
+
+func (n *nameReferences) fixPodSpec(podSpec map[string]interface{}) error {
+	n.rename(podSpec, "ServiceAccount", "serviceAccountName")
+	n.rename(podSpec, "ServiceAccount", "serviceAccount")
+	for _, secret := range n.list(podSpec, "imagePullSecrets") {
+		n.rename(secret, "Secret", "name")
+	}
+
+	for _, volume := range n.list(podSpec, "volumes") {
+		n.rename(volume, "ConfigMap", "configMap", "name")
+		n.rename(volume, "Secret", "secret", "secretName")
+		n.rename(volume, "PersistentVolumeClaim", "persistentVolumeClaim", "claimName")
+		for _, source := range n.list(volume, "projected", "sources") {
+			n.rename(source, "ConfigMap", "configMap", "name")
+			n.rename(source, "Secret", "secret", "name")
+		}
+	}
+
+	for _, field := range []string{"initContainers", "containers"} {
+		for _, container := range n.list(podSpec, field) {
+			for _, env := range n.list(container, "env") {
+				n.rename(env, "ConfigMap", "valueFrom", "configMapKeyRef", "name")
+				n.rename(env, "Secret", "valueFrom", "secretKeyRef", "name")
+				if value, ok := env["value"].(string); ok {
+					env["value"] = n.renameServiceHost(value)
+				}
+			}
+			for _, envFrom := range n.list(container, "envFrom") {
+				n.rename(envFrom, "ConfigMap", "configMapRef", "name")
+				n.rename(envFrom, "Secret", "secretRef", "name")
+			}
+		}
+	}
+	return nil
+}
+
+// renameServiceHost rewrites values that are the name of a renamed Service,
+// or a hostname or host:port of one, eg "redis", "redis:6379" or "redis.default.svc"
+func (n *nameReferences) renameServiceHost(value string) string {
+	for oldName, newName := range n.renamed["Service"] {
+		if value == oldName {
+			return newName
+		}
+		for _, sep := range []string{".", ":"} {
+			if strings.HasPrefix(value, oldName+sep) {
+				return newName + strings.TrimPrefix(value, oldName)
+			}
+		}
+	}
+	return value
+}
+
+func (n *nameReferences) fixIngressBackend(m map[string]interface{}, fields ...string) {
+	for _, field := range fields {
+		child, ok := m[field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = child
+	}
+	// networking.k8s.io/v1 and extensions/v1beta1 backends respectively
+	n.rename(m, "Service", "service", "name")
+	n.rename(m, "Service", "serviceName")
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestNamePrefixSuffixTransform(t *testing.T) {
+	inputManifest := `---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: frontend
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: redis
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  annotations:
+    addons.k8s.io/depends-on: ConfigMap/config, apiextensions.k8s.io/CustomResourceDefinition/widgets.example.org
+spec:
+  template:
+    spec:
+      serviceAccountName: frontend
+      volumes:
+      - name: config
+        configMap:
+          name: config
+      - name: external
+        configMap:
+          name: external
+      containers:
+      - name: frontend
+        image: gcr.io/google-samples/gb-frontend:v4
+        env:
+        - name: REDIS_HOST
+          value: redis:6379
+        - name: MODE
+          value: redis-cluster
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: frontend
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: frontend
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: frontend
+subjects:
+- kind: ServiceAccount
+  name: frontend
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.org
+`
+	objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	instance := &unstructured.Unstructured{}
+	instance.SetName("blue")
+
+	transform := NamePrefixSuffixTransform(InstanceNamePrefix)
+	if err := transform(context.Background(), instance, objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Check the serialized form, to verify the cached json was invalidated
+	actual := map[string]interface{}{}
+	for _, o := range objects.Items {
+		b, err := o.JSON()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		u := map[string]interface{}{}
+		if err := json.Unmarshal(b, &u); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		name, _, _ := unstructured.NestedString(u, "metadata", "name")
+		actual[o.Kind+"/name"] = name
+
+		switch o.Kind {
+		case "Deployment":
+			podSpec, _, _ := unstructured.NestedMap(u, "spec", "template", "spec")
+			actual["Deployment/serviceAccountName"] = podSpec["serviceAccountName"]
+			volumes := podSpec["volumes"].([]interface{})
+			actual["Deployment/volumes[0]"], _, _ = unstructured.NestedString(volumes[0].(map[string]interface{}), "configMap", "name")
+			actual["Deployment/volumes[1]"], _, _ = unstructured.NestedString(volumes[1].(map[string]interface{}), "configMap", "name")
+			containers := podSpec["containers"].([]interface{})
+			env := containers[0].(map[string]interface{})["env"].([]interface{})
+			actual["Deployment/env[0]"] = env[0].(map[string]interface{})["value"]
+			actual["Deployment/env[1]"] = env[1].(map[string]interface{})["value"]
+			actual["Deployment/depends-on"], _, _ = unstructured.NestedString(u, "metadata", "annotations", DependsOnAnnotation)
+		case "RoleBinding":
+			actual["RoleBinding/roleRef"], _, _ = unstructured.NestedString(u, "roleRef", "name")
+			subjects, _, _ := unstructured.NestedSlice(u, "subjects")
+			actual["RoleBinding/subjects[0]"] = subjects[0].(map[string]interface{})["name"]
+		}
+	}
+
+	expected := map[string]interface{}{
+		"ServiceAccount/name":           "blue-frontend",
+		"ConfigMap/name":                "blue-config",
+		"Service/name":                  "blue-redis",
+		"Deployment/name":               "blue-frontend",
+		"Deployment/serviceAccountName": "blue-frontend",
+		"Deployment/volumes[0]":         "blue-config",
+		"Deployment/volumes[1]":         "external",
+		"Deployment/env[0]":             "blue-redis:6379",
+		"Deployment/env[1]":             "redis-cluster",
+		"Deployment/depends-on":         "ConfigMap/blue-config,apiextensions.k8s.io/CustomResourceDefinition/widgets.example.org",
+		"Role/name":                     "blue-frontend",
+		"RoleBinding/name":              "blue-frontend",
+		"RoleBinding/roleRef":           "blue-frontend",
+		"RoleBinding/subjects[0]":       "blue-frontend",
+		"CustomResourceDefinition/name": "widgets.example.org",
+	}
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Errorf("unexpected value for %s, expected %v, got %v", k, v, actual[k])
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// TargetNamespace returns the namespace the objects for a DeclarativeObject are deployed to
+type TargetNamespace = func(context.Context, DeclarativeObject) string
+
+// namespaceOptions configures the namespace created by WithCreateNamespace
+type namespaceOptions struct {
+	labels      map[string]string
+	annotations map[string]string
+}
+
+// targetNamespace returns the namespace objects are enforced into, or "" if namespaces aren't enforced
+func (r *Reconciler) targetNamespace(ctx context.Context, instance DeclarativeObject) string {
+	if r.options.targetNamespace == nil {
+		if r.options.multiInstance {
+			return instance.GetNamespace()
+		}
+		return ""
+	}
+	return r.options.targetNamespace(ctx, instance)
+}
+
+type applyNamespaceKey struct{}
+
+// contextWithApplyNamespace returns a context with the namespace objects without a namespace are applied to
+func contextWithApplyNamespace(ctx context.Context, ns string) context.Context {
+	return context.WithValue(ctx, applyNamespaceKey{}, ns)
+}
+
+// applyNamespaceFromContext returns the namespace objects without a namespace are applied to in the reconcile of ctx
+func applyNamespaceFromContext(ctx context.Context) string {
+	ns, _ := ctx.Value(applyNamespaceKey{}).(string)
+	return ns
+}
+
+// applyNamespace returns the namespace objects without a namespace are applied to
+func (r *Reconciler) applyNamespace(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) string {
+	ns := ""
+	if !r.options.preserveNamespace {
+		ns = name.Namespace
+	}
+	if targetNamespace := r.targetNamespace(ctx, instance); targetNamespace != "" {
+		ns = targetNamespace
+	}
+	return ns
+}
+
+// enforceNamespace sets metadata.namespace of all namespaced objects to namespace.
+// Objects whose scope can't be determined, eg custom resources whose CRD isn't installed yet,
+// are left alone unless the CRD is part of the manifest.
+func (r *Reconciler) enforceNamespace(ctx context.Context, objects *manifest.Objects, namespace string) error {
+	log := log.FromContext(ctx)
+	if namespace == "" {
+		return nil
+	}
+
+	manifestScopes := crdScopes(objects)
+	for _, o := range objects.Items {
+		namespaced, err := r.isNamespaced(ctx, o, manifestScopes)
+		if err != nil {
+			log.WithValues("kind", o.Kind).WithValues("name", o.Name).WithValues("error", err).Info("unable to determine scope of object, not enforcing namespace")
+			continue
+		}
+		if !namespaced {
+			continue
+		}
+		if o.Namespace != namespace {
+			log.WithValues("kind", o.Kind).WithValues("name", o.Name).WithValues("namespace", namespace).V(1).Info("enforcing namespace on object")
+			o.SetNamespace(namespace)
+		}
+	}
+	return nil
+}
+
+func (r *Reconciler) isNamespaced(ctx context.Context, o *manifest.Object, manifestScopes map[schema.GroupKind]bool) (bool, error) {
+	if namespaced, found := manifestScopes[o.GroupKind()]; found {
+		return namespaced, nil
+	}
+	if r.restMapper == nil {
+		return false, fmt.Errorf("no RESTMapper available")
+	}
+	mapping, err := r.restMapping(ctx, o.GroupKind(), o.GroupVersionKind().Version)
+	if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// crdScopes returns the scope of the kinds defined by CustomResourceDefinitions in the manifest
+func crdScopes(objects *manifest.Objects) map[schema.GroupKind]bool {
+	scopes := make(map[schema.GroupKind]bool)
+	for _, o := range objects.Items {
+		if o.Group != "apiextensions.k8s.io" || o.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		u := o.UnstructuredObject().Object
+		group, _, _ := unstructured.NestedString(u, "spec", "group")
+		kind, _, _ := unstructured.NestedString(u, "spec", "names", "kind")
+		scope, _, _ := unstructured.NestedString(u, "spec", "scope")
+		if kind == "" {
+			continue
+		}
+		scopes[schema.GroupKind{Group: group, Kind: kind}] = scope != "Cluster"
+	}
+	return scopes
+}
+
+// namespacesResource is the resource of Namespaces
+var namespacesResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// ensureNamespace creates the namespace if it does not already exist.  It is created with the dynamic client, so in
+// the cluster the manifest is applied to, as the ServiceAccount impersonated with WithImpersonation.
+func (r *Reconciler) ensureNamespace(ctx context.Context, namespace string) error {
+	log := log.FromContext(ctx)
+	if namespace == "" || r.options.createNamespace == nil {
+		return nil
+	}
+
+	namespaces := r.dynamicClient.Resource(namespacesResource)
+	_, err := namespaces.Get(ctx, namespace, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error getting namespace %q: %v", namespace, err)
+	}
+
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName(namespace)
+	ns.SetLabels(r.options.createNamespace.labels)
+	ns.SetAnnotations(r.options.createNamespace.annotations)
+	log.WithValues("namespace", namespace).Info("creating namespace")
+	if _, err := namespaces.Create(ctx, ns, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("error creating namespace %q: %v", namespace, err)
+	}
+	return nil
+}
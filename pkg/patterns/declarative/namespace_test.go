@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestEnforceNamespace(t *testing.T) {
+	inputManifest := `---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.org
+spec:
+  group: example.org
+  scope: Namespaced
+  names:
+    kind: Widget
+---
+apiVersion: example.org/v1
+kind: Widget
+metadata:
+  name: widget
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  namespace: other
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: frontend
+---
+apiVersion: example.org/v1
+kind: Unknown
+metadata:
+  name: unknown
+`
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+
+	objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	r := &Reconciler{restMapper: mapper}
+	if err := r.enforceNamespace(context.Background(), objects, "addons"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"CustomResourceDefinition": "",
+		"Widget":                   "addons",
+		"Deployment":               "addons",
+		"ClusterRole":              "",
+		"Unknown":                  "",
+	}
+	for _, o := range objects.Items {
+		if actual := o.UnstructuredObject().GetNamespace(); actual != expected[o.Kind] {
+			t.Errorf("unexpected namespace for %s, expected %q, got %q", o.Kind, expected[o.Kind], actual)
+		}
+		if o.Namespace != expected[o.Kind] {
+			t.Errorf("unexpected Namespace field for %s, expected %q, got %q", o.Kind, expected[o.Kind], o.Namespace)
+		}
+	}
+}
+
+func TestEnsureNamespace(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("Namespace")
+	existing.SetName("existing")
+	existing.SetLabels(map[string]string{"team": "a"})
+	r := &Reconciler{
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing),
+		options: reconcilerParams{
+			createNamespace: &namespaceOptions{
+				labels:      map[string]string{"team": "b"},
+				annotations: map[string]string{"owner": "addons"},
+			},
+		},
+	}
+
+	for _, name := range []string{"existing", "created"} {
+		if err := r.ensureNamespace(context.Background(), name); err != nil {
+			t.Fatalf("unexpected error ensuring namespace %q: %v", name, err)
+		}
+	}
+
+	namespaces := r.dynamicClient.Resource(namespacesResource)
+	ns, err := namespaces.Get(context.Background(), "created", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected namespace to be created: %v", err)
+	}
+	if ns.GetLabels()["team"] != "b" || ns.GetAnnotations()["owner"] != "addons" {
+		t.Errorf("unexpected metadata on created namespace: %v", ns.Object["metadata"])
+	}
+
+	ns, err = namespaces.Get(context.Background(), "existing", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ns.GetLabels()["team"] != "a" {
+		t.Errorf("existing namespace should not be modified, got labels %v", ns.GetLabels())
+	}
+}
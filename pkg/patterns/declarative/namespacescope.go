@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// ReasonOutOfNamespaceScope is the reason for a true ConditionStalled when WithNamespaceScope is used and the
+// manifest contains cluster-scoped objects or objects in other namespaces
+const ReasonOutOfNamespaceScope = "OutOfNamespaceScope"
+
+// inNamespaceScope returns true if the reconciler may manage objects in namespace
+func (r *Reconciler) inNamespaceScope(namespace string) bool {
+	if len(r.options.namespaces) == 0 {
+		return true
+	}
+	for _, ns := range r.options.namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNamespaceScope returns a TerminalError listing the objects which are cluster-scoped or in namespaces
+// outside of the namespaces of WithNamespaceScope, as they can't be managed with namespace-scoped RBAC
+func (r *Reconciler) checkNamespaceScope(ctx context.Context, name types.NamespacedName, instance DeclarativeObject, objects *manifest.Objects) error {
+	if len(r.options.namespaces) == 0 {
+		return nil
+	}
+
+	ns := r.applyNamespace(ctx, name, instance)
+	manifestScopes := crdScopes(objects)
+	var outOfScope []string
+	for _, o := range objects.Items {
+		namespaced, err := r.isNamespaced(ctx, o, manifestScopes)
+		if err != nil {
+			return fmt.Errorf("error finding scope of %s %s: %v", o.Kind, o.Name, err)
+		}
+		if !namespaced {
+			outOfScope = append(outOfScope, fmt.Sprintf("%s %s", o.Kind, o.Name))
+			continue
+		}
+		namespace := o.Namespace
+		if namespace == "" {
+			namespace = ns
+		}
+		if !r.inNamespaceScope(namespace) {
+			outOfScope = append(outOfScope, fmt.Sprintf("%s %s/%s", o.Kind, namespace, o.Name))
+		}
+	}
+	if len(outOfScope) != 0 {
+		return NewTerminalError(ReasonOutOfNamespaceScope, fmt.Errorf("objects are outside of namespaces %s: %s",
+			strings.Join(r.options.namespaces, ", "), strings.Join(outOfScope, ", ")))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestCheckNamespaceScope(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+`
+	tests := []struct {
+		name       string
+		namespaces []string
+		manifest   string
+		outOfScope []string
+	}{
+		{
+			name:     "no scope",
+			manifest: deployment + "---\napiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: frontend\n",
+		},
+		{
+			name:       "in scope",
+			namespaces: []string{"team-a"},
+			manifest:   deployment,
+		},
+		{
+			name:       "cluster-scoped",
+			namespaces: []string{"team-a"},
+			manifest:   deployment + "---\napiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: frontend\n",
+			outOfScope: []string{"ClusterRole frontend"},
+		},
+		{
+			name:       "other namespace",
+			namespaces: []string{"team-a"},
+			manifest:   deployment + "  namespace: team-b\n",
+			outOfScope: []string{"Deployment team-b/frontend"},
+		},
+		{
+			name:       "other namespace in scope",
+			namespaces: []string{"team-a", "team-b"},
+			manifest:   deployment + "  namespace: team-b\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := manifest.ParseObjects(context.Background(), test.manifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+			r := &Reconciler{restMapper: mapper}
+			r.options = WithNamespaceScope(test.namespaces...)(r.options)
+
+			instance := newGuestbook("team-a", "test", time.Now())
+			err = r.checkNamespaceScope(context.Background(), types.NamespacedName{Namespace: "team-a", Name: "test"}, instance, objects)
+			if len(test.outOfScope) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var terminal *TerminalError
+			if !errors.As(err, &terminal) || terminal.Reason != ReasonOutOfNamespaceScope {
+				t.Fatalf("expected terminal error with reason %s, got %v", ReasonOutOfNamespaceScope, err)
+			}
+			for _, name := range test.outOfScope {
+				if !strings.Contains(err.Error(), name) {
+					t.Errorf("expected error to list %s, got %v", name, err)
+				}
+			}
+		})
+	}
+}
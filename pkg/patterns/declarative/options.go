@@ -18,9 +18,14 @@ package declarative
 
 import (
 	"context"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
 	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
 )
 
@@ -42,16 +47,113 @@ type reconcilerParams struct {
 	objectTransformations []ObjectTransform
 	manifestController    ManifestController
 
-	prune             bool
-	preserveNamespace bool
-	kustomize         bool
-	validate          bool
-	metrics           bool
+	objectOrder       func(o *manifest.Object) int
+	objectSortLast    []schema.GroupKind
+	prerequisiteKinds []schema.GroupKind
+
+	webhookCertificate *WebhookCertificate
+
+	prune              bool
+	preserveNamespace  bool
+	kustomize          bool
+	validate           bool
+	metrics            bool
+	valuesFrom         bool
+	multiInstance      bool
+	singleton          bool
+	applyWaves         bool
+	waitForWaves       bool
+	prerequisitesFirst bool
+	waitForReady       bool
+	skipUnchangedApply bool
+	partialApply       bool
+	statusConditions   bool
+	reconcileStatus    bool
+	inventory          bool
+	revisionHistory    bool
+	dryRun             bool
+	dryRunAll          bool
+	lifecycleHooks     bool
+	teardown           bool
+
+	sink            Sink
+	sinks           []Sink
+	sinkErrorPolicy SinkErrorPolicy
+
+	auditSinks []AuditSink
+
+	manifestExporter ManifestExporter
+
+	blobPolicy BlobPolicy
 
-	sink       Sink
 	ownerFn    OwnerSelector
 	labelMaker LabelMaker
 	status     Status
+	yttValues  YttValues
+
+	inventoryApplier *applier.InventoryApplier
+
+	versionPolicies []VersionPolicy
+	migrations      []versionMigration
+
+	adoptionPolicy AdoptionPolicy
+
+	ignoredFields []IgnoredField
+
+	deprecatedAPIs []DeprecatedAPI
+
+	serverSideValidation bool
+
+	permissionCheck bool
+
+	serverSideApply bool
+	fieldManager    string
+	forceConflicts  bool
+
+	applyStrategies map[schema.GroupKind]ApplyStrategy
+
+	recreateImmutable bool
+
+	impersonation bool
+
+	remoteClusters bool
+
+	shard *Shard
+
+	namespaces []string
+
+	pause bool
+
+	reconcileTimeout time.Duration
+
+	applyLimiter *ApplyLimiter
+
+	healthCheck *HealthCheck
+
+	clientRateLimits *applier.RateLimits
+	rateLimiter      ratelimiter.RateLimiter
+
+	execApplier *applier.ExecKubectl
+	applier     applier.Applier
+
+	protectedKinds    []schema.GroupKind
+	protectedKindsSet bool
+
+	targetNamespace TargetNamespace
+	createNamespace *namespaceOptions
+
+	singletonAllowed []types.NamespacedName
+	readyTimeout     time.Duration
+	resyncPeriod     time.Duration
+	resyncJitter     float64
+	renderCacheSize  int
+	renderCacheTTL   time.Duration
+	failureThreshold int
+	failureBackoff   time.Duration
+
+	revisionHistoryLimit int
+
+	addonDependencies AddonDependencies
 }
 
 type ManifestController interface {
@@ -104,7 +206,7 @@ func WithManifestController(mc ManifestController) reconcilerOption {
 // objects that exist in the API server that are not deployed by the current version of the manifest
 // which match a label specific to the addon instance.
 //
-// This option requires WithLabels to be used
+// This option requires WithLabels to be used, unless WithInventoryApplier tracks the objects in an inventory
 func WithApplyPrune() reconcilerOption {
 	return func(p reconcilerParams) reconcilerParams {
 		p.prune = true
@@ -112,6 +214,255 @@ func WithApplyPrune() reconcilerOption {
 	}
 }
 
+// WithIgnoredFields sets fields the reconciler never overwrites, removing them from the objects before they are
+// applied
+func WithIgnoredFields(fields ...IgnoredField) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.ignoredFields = append(p.ignoredFields, fields...)
+		return p
+	}
+}
+
+// WithServerSideApply applies the manifest with server-side apply, rather than a client-side three-way merge.
+// Objects that fail to apply because other field managers own some of their fields report the conflicting fields
+// in their ApplyResult.
+func WithServerSideApply() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.serverSideApply = true
+		return p
+	}
+}
+
+// WithFieldManager sets the field manager used with WithServerSideApply, DefaultFieldManager by default
+func WithFieldManager(name string) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.fieldManager = name
+		return p
+	}
+}
+
+// WithForceConflicts makes WithServerSideApply take over the fields owned by other field managers, rather than
+// failing to apply the objects
+func WithForceConflicts(force bool) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.forceConflicts = force
+		return p
+	}
+}
+
+// WithSink adds sinks that will be notified for all deployments, in addition to those added with AddSink and
+// SetSink.
+// Sinks implementing FailureSink are also notified when the reconcile fails.
+func WithSink(sinks ...Sink) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.sinks = append(p.sinks, sinks...)
+		return p
+	}
+}
+
+// WithAuditSink records every apply, with the DeclarativeObject and its generation, the version and hash of the
+// manifest, the objects and the outcome, in the sinks, such as a LogAuditSink, ConfigMapAuditSink or
+// WebhookAuditSink.  The errors of the sinks are logged without failing the reconcile.
+func WithAuditSink(sinks ...AuditSink) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.auditSinks = append(p.auditSinks, sinks...)
+		return p
+	}
+}
+
+// WithSinkErrorPolicy sets how the errors of the sinks are handled, by default SinkErrorsAggregate
+func WithSinkErrorPolicy(policy SinkErrorPolicy) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.sinkErrorPolicy = policy
+		return p
+	}
+}
+
+// WithBlobPolicy sets how the documents of the manifest that can't be parsed as objects are handled, by default
+// BlobsDrop
+func WithBlobPolicy(policy BlobPolicy) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.blobPolicy = policy
+		return p
+	}
+}
+
+// WithDeprecatedAPIReport reports the objects of the manifest using deprecated API versions in the DeprecatedAPIs
+// condition of the DeclarativeObject, so upgrades of the cluster removing them can be planned.  The APIs in
+// DefaultDeprecatedAPIs are reported unless others are given.
+func WithDeprecatedAPIReport(apis ...DeprecatedAPI) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		if len(apis) == 0 {
+			apis = DefaultDeprecatedAPIs
+		}
+		p.deprecatedAPIs = apis
+		return p
+	}
+}
+
+// WithServerSideValidation validates every object of the manifest with a server-side dry-run before applying
+// any, failing the reconcile with a ValidationError listing all the invalid objects.  Objects of kinds and in
+// namespaces created by the manifest are validated once those exist.
+func WithServerSideValidation() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.serverSideValidation = true
+		return p
+	}
+}
+
+// WithPermissionCheck checks the operator may create, update, patch and delete every resource of the manifest
+// before applying, with a SelfSubjectAccessReview of each, or a SubjectAccessReview of the ServiceAccount with
+// WithImpersonation.  Missing permissions are listed in the MissingPermissions condition of the DeclarativeObject
+// and fail the reconcile with a PermissionError, rather than the apply failing part-way.
+func WithPermissionCheck() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.permissionCheck = true
+		return p
+	}
+}
+
+// WithApplyStrategy applies the objects of kind gk with strategy, rather than the default client-side three-way
+// merge, or server-side apply with WithServerSideApply.  Objects applied with other strategies than the default are
+// applied separately from the rest of the manifest, and are not pruned.
+func WithApplyStrategy(gk schema.GroupKind, strategy ApplyStrategy) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		if p.applyStrategies == nil {
+			p.applyStrategies = make(map[schema.GroupKind]ApplyStrategy)
+		}
+		p.applyStrategies[gk] = strategy
+		return p
+	}
+}
+
+// WithRecreateOnImmutableChange deletes and recreates objects that fail to apply because immutable fields changed,
+// such as the selector of a Deployment.  Objects of the protected kinds, StatefulSets and objects kept on delete are
+// never recreated.
+func WithRecreateOnImmutableChange() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.recreateImmutable = true
+		return p
+	}
+}
+
+// WithImpersonation applies the manifest as the ServiceAccount named in spec.serviceAccountName of the
+// DeclarativeObject, in its namespace, so that what each DeclarativeObject can create is bounded by the RBAC of its
+// ServiceAccount.  Every write to the objects of the manifest is made as the ServiceAccount.  The operator must be
+// allowed to impersonate the ServiceAccounts.
+func WithImpersonation() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.impersonation = true
+		return p
+	}
+}
+
+// WithRemoteClusters applies the manifest of DeclarativeObjects which set spec.kubeconfigSecretRef or
+// spec.clusterName to the remote cluster of the kubeconfig in the Secret, or of the Cluster API Cluster.
+// The DeclarativeObject is still watched and its status updated in the cluster of the operator.
+func WithRemoteClusters() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.remoteClusters = true
+		return p
+	}
+}
+
+// WithSharding only reconciles the DeclarativeObjects of shard, so that they can be shared between replicas of the
+// operator, each running with a different shard.  Use shard.Predicate() when watching the DeclarativeObjects to
+// ignore the events of the other shards.
+func WithSharding(shard Shard) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.shard = &shard
+		return p
+	}
+}
+
+// WithNamespaceScope restricts the reconciler to namespaces, so that the operator can run with RBAC scoped to them:
+// DeclarativeObjects in other namespaces are ignored, manifests with cluster-scoped objects or objects in other
+// namespaces aren't applied, and only namespaced kinds are pruned.  Use WatchAllNamespaced to watch the objects in
+// their namespaces only.
+func WithNamespaceScope(namespaces ...string) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.namespaces = namespaces
+		return p
+	}
+}
+
+// WithPause stops applying the manifest of DeclarativeObjects with spec.paused set to true, or annotated with
+// PausedAnnotation, until they are resumed.  The drift of their objects from the manifest is reported in the Paused
+// condition, and their status is still updated.
+func WithPause() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.pause = true
+		return p
+	}
+}
+
+// WithReconcileTimeout cancels each reconcile that takes longer than timeout, such as one stuck downloading the
+// manifest or waiting on kubectl, so that it doesn't block the worker.  Timed-out reconciles fail, and are requeued
+// with backoff.
+func WithReconcileTimeout(timeout time.Duration) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.reconcileTimeout = timeout
+		return p
+	}
+}
+
+// WithApplyLimiter makes the reconciler wait for a slot of limiter before applying a manifest.  Share limiter
+// between the reconcilers of an operator to bound the applies of the whole operator.
+func WithApplyLimiter(limiter *ApplyLimiter) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.applyLimiter = limiter
+		return p
+	}
+}
+
+// WithHealthCheck records the outcome of each reconcile in healthCheck, which can be shared between the
+// reconcilers of an operator and registered as a healthz or readyz check of the manager.
+func WithHealthCheck(healthCheck *HealthCheck) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.healthCheck = healthCheck
+		return p
+	}
+}
+
+// WithClientRateLimits sets the QPS and burst of the clients of the reconciler and of the in-process appliers,
+// rather than the client-go defaults, which throttle operators managing many objects.  Zero keeps the default.
+// RESTConfig returns the config with these limits, for the dynamic watches of WatchAll.
+func WithClientRateLimits(qps float32, burst int) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.clientRateLimits = &applier.RateLimits{QPS: qps, Burst: burst}
+		return p
+	}
+}
+
+// WithRateLimiter sets the rate limiter of the workqueue of the controller of the reconciler, created with
+// NewController.
+func WithRateLimiter(rateLimiter ratelimiter.RateLimiter) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.rateLimiter = rateLimiter
+		return p
+	}
+}
+
+// WithAdoption checks whether objects in the manifest which already exist are managed by the DeclarativeObject,
+// and only applies the manifest if the existing objects that aren't can be adopted according to policy.  Applied
+// objects are annotated with ManagedByAnnotation to identify the DeclarativeObject managing them.
+func WithAdoption(policy AdoptionPolicy) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.adoptionPolicy = policy
+		return p
+	}
+}
+
+// WithProtectedKinds sets the kinds that are never pruned, even when they are removed from the manifest,
+// replacing DefaultProtectedKinds.  WithProtectedKinds() with no kinds turns off the protection.
+func WithProtectedKinds(kinds ...schema.GroupKind) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.protectedKinds = kinds
+		p.protectedKindsSet = true
+		return p
+	}
+}
+
 // WithOwner sets an owner ref on each deployed object by the OwnerSelector
 func WithOwner(ownerFn OwnerSelector) reconcilerOption {
 	return func(p reconcilerParams) reconcilerParams {
@@ -129,6 +480,16 @@ func WithLabels(labelMaker LabelMaker) reconcilerOption {
 	}
 }
 
+// WithAddonDependencies waits for the addon objects returned by dependencies to be ready before reconciling,
+// reporting them in the WaitingForDependency condition.  Use WatchAddonDependencies to reconcile as soon as they
+// become ready.
+func WithAddonDependencies(dependencies AddonDependencies) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.addonDependencies = dependencies
+		return p
+	}
+}
+
 // WithStatus provides a Status interface that will be used during Reconcile
 func WithStatus(status Status) reconcilerOption {
 	return func(p reconcilerParams) reconcilerParams {
@@ -146,6 +507,307 @@ func WithPreserveNamespace() reconcilerOption {
 	}
 }
 
+// WithEnforceNamespace sets metadata.namespace of all namespaced objects in the manifest
+// to the namespace returned by namespace, which is also used when applying.
+// If namespace is nil, the namespace of the DeclarativeObject is used.
+func WithEnforceNamespace(namespace TargetNamespace) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		if namespace == nil {
+			namespace = func(ctx context.Context, o DeclarativeObject) string {
+				return o.GetNamespace()
+			}
+		}
+		p.targetNamespace = namespace
+		return p
+	}
+}
+
+// WithCreateNamespace creates the namespace objects are applied to, with the given labels and annotations,
+// if it does not already exist.  Existing namespaces are not modified.
+func WithCreateNamespace(labels, annotations map[string]string) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.createNamespace = &namespaceOptions{labels: labels, annotations: annotations}
+		return p
+	}
+}
+
+// WithMultiInstance allows multiple DeclarativeObjects of the same kind to coexist.
+// Object names are prefixed with the name of the DeclarativeObject, namespaced objects are
+// deployed to its namespace (unless WithEnforceNamespace selects another namespace), and
+// InstanceLabels are added to all objects, so that pruning only affects this instance.  They are also added to the
+// pod selectors and pod templates, so that instances in the same namespace don't select each other's pods.
+func WithMultiInstance() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.multiInstance = true
+		return p
+	}
+}
+
+// WithSingleton only reconciles a single DeclarativeObject of the prototype kind, preventing
+// several instances from fighting over cluster-scoped objects.  If allowed names are given,
+// objects must match one of them, empty fields matching any namespace or name.  If several
+// objects exist, only the oldest is reconciled.  Objects that aren't reconciled get a
+// Stalled condition, if they support conditions, and are checked again periodically.
+func WithSingleton(allowed ...types.NamespacedName) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.singleton = true
+		p.singletonAllowed = allowed
+		return p
+	}
+}
+
+// WithObjectOrder orders the objects of the manifest by the score order returns for them, lowest first, rather
+// than by DefaultObjectOrder, eg with RecommendedObjectOrder
+func WithObjectOrder(order func(o *manifest.Object) int) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.objectOrder = order
+		return p
+	}
+}
+
+// WithObjectSortLast orders the objects of kinds after all other objects, in the order of kinds, eg for custom
+// resources served by a Deployment in the manifest
+func WithObjectSortLast(kinds ...schema.GroupKind) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.objectSortLast = append(p.objectSortLast, kinds...)
+		return p
+	}
+}
+
+// WithApplyWaves applies objects in waves, ordered by the addons.k8s.io/apply-wave annotation.
+// If waitForReady is true, each wave must be ready before the next wave is applied;
+// the reconciler requeues until it is, so a sink such as WatchAll helps to respond promptly.
+func WithApplyWaves(waitForReady bool) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.applyWaves = true
+		p.waitForWaves = waitForReady
+		return p
+	}
+}
+
+// WithPrerequisitesFirst applies the manifest in two phases: first the objects of the given kinds,
+// DefaultPrerequisiteKinds if none are given, waiting until they exist and are ready, then the whole manifest.
+func WithPrerequisitesFirst(kinds ...schema.GroupKind) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		if len(kinds) == 0 {
+			kinds = DefaultPrerequisiteKinds
+		}
+		p.prerequisitesFirst = true
+		p.prerequisiteKinds = kinds
+		return p
+	}
+}
+
+// WithWebhookCertificate issues a serving certificate for the webhooks of the manifest, in a kubernetes.io/tls Secret
+// applied with the manifest, and sets the caBundle of the webhooks calling the Service to its CA.  The certificate
+// is renewed before it expires; the reconciler requeues to renew it.
+func WithWebhookCertificate(certificate WebhookCertificate) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.webhookCertificate = &certificate
+		return p
+	}
+}
+
+// WithWaitForReady requeues after applying the manifest until all objects are ready, according to kstatus,
+// reporting progress in the Ready condition of the DeclarativeObject.  If timeout is positive and the
+// objects aren't ready within timeout, the reconcile fails.
+func WithWaitForReady(timeout time.Duration) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.waitForReady = true
+		p.readyTimeout = timeout
+		return p
+	}
+}
+
+// WithResyncPeriod requeues DeclarativeObjects after each successful reconcile, so that the manifest is
+// re-applied every period even without watch events.  A random delay of up to jitter times period is
+// added, to spread out the reconciles of many objects.
+func WithResyncPeriod(period time.Duration, jitter float64) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.resyncPeriod = period
+		p.resyncJitter = jitter
+		return p
+	}
+}
+
+// WithSkipUnchangedApply skips kubectl apply when the manifest is the same as the last manifest applied
+// for the DeclarativeObject, and none of the objects have changed in the cluster since.
+// The last apply is recorded in the addons.k8s.io/applied-hash annotation of the DeclarativeObject, so it is
+// remembered across restarts of the operator.
+func WithSkipUnchangedApply() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.skipUnchangedApply = true
+		return p
+	}
+}
+
+// WithInventory records the objects applied for each DeclarativeObject, with their UIDs, in an inventory
+// ConfigMap after each complete apply.  The inventory can be read with ReadInventory.
+func WithInventory() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.inventory = true
+		return p
+	}
+}
+
+// WithDryRunPreview previews the changes applying the manifest would make, with a server-side dry-run, rather
+// than applying it, for DeclarativeObjects annotated addons.k8s.io/dry-run=true, or for all DeclarativeObjects if all
+// is true.  The changes are summarized in the DryRun condition and an event, and the diff against the live objects
+// is passed to a Sink implementing DryRunSink and to the Status through DryRunDiffsFromContext.
+func WithDryRunPreview(all bool) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.dryRun = true
+		p.dryRunAll = all
+		return p
+	}
+}
+
+// WithManifestExport exports the manifest with exporter, such as a GitExporter committing it to a git repository,
+// rather than applying it, so that the manifests can be applied by an existing GitOps pipeline.  The objects are
+// rendered and transformed as usual, and the DeclarativeObject is reconciled again when it changes.
+func WithManifestExport(exporter ManifestExporter) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.manifestExporter = exporter
+		return p
+	}
+}
+
+// WithInventoryApplier applies manifests with a, which records the applied objects in an inventory, rather than
+// with plain kubectl apply.  The objects of each DeclarativeObject are tracked in an inventory ConfigMap, so
+// WithApplyPrune deletes the objects removed from the manifest without relying on labels.
+// The applier events are available to the Status and Sink through ApplyEventsFromContext.
+func WithInventoryApplier(a *applier.InventoryApplier) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.inventoryApplier = a
+		return p
+	}
+}
+
+// WithExecApplier applies manifests by running kubectl with a, which can be configured with the kubectl binary to
+// run and its environment.  Init fails if a can't run kubectl, or if kubectl apply doesn't support the flags the
+// reconciler passes.
+func WithExecApplier(a *applier.ExecKubectl) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.execApplier = a
+		return p
+	}
+}
+
+// WithApplier applies manifests with a rather than the default applier, eg a mocks.FakeApplier in unit tests
+func WithApplier(a applier.Applier) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.applier = a
+		return p
+	}
+}
+
+// WithRevisionHistory records each manifest applied for a DeclarativeObject as a revision in a Secret, keeping the
+// latest limit revisions, or all revisions if limit is not positive.  A revision is recorded after each complete
+// apply of a changed manifest, and can be read with ListRevisions and GetRevision.
+func WithRevisionHistory(limit int) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.revisionHistory = true
+		p.revisionHistoryLimit = limit
+		return p
+	}
+}
+
+// WithVersionPolicies checks each change of spec.version against the policies before building the manifest,
+// such as BlockDowngrades and BlockSkippedMinorVersions.  A change a policy refuses stalls the DeclarativeObject
+// rather than being applied.  The version applied is recorded in status.deployedVersion.
+func WithVersionPolicies(policies ...VersionPolicy) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.versionPolicies = append(p.versionPolicies, policies...)
+		return p
+	}
+}
+
+// WithMigration runs migration when the deployed version changes from one matching from to spec.version matching
+// to, eg WithMigration("1.2", "1.3", fn) for any upgrade from 1.2.x to 1.3.x.  Migrations run after objects removed
+// from the manifest are deleted (with WithRevisionHistory) and before the new manifest is applied.  The version
+// applied is recorded in status.deployedVersion.
+func WithMigration(from, to string, migration Migration) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.migrations = append(p.migrations, versionMigration{from: from, to: to, migration: migration})
+		return p
+	}
+}
+
+// WithLifecycleHooks runs objects in the manifest annotated with HookAnnotation as hooks rather than applying them
+// with the rest of the manifest: pre-apply hooks before the manifest is applied, post-apply hooks after it has
+// been applied, and pre-delete hooks when the DeclarativeObject is deleted, using HooksFinalizer.  Each phase
+// waits for its hooks to complete, and hooks run again when the manifest changes.
+func WithLifecycleHooks() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.lifecycleHooks = true
+		return p
+	}
+}
+
+// WithTeardownManifest applies the teardown manifest of the ManifestController, which must implement
+// TeardownManifestController, when a DeclarativeObject is deleted.  The objects are run like pre-delete hooks
+// (see WithLifecycleHooks), before the objects of the manifest are removed.
+func WithTeardownManifest() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.teardown = true
+		return p
+	}
+}
+
+// WithStatusConditions maintains the Ready, Reconciling and Stalled conditions in status.conditions of the
+// DeclarativeObject, following the Kubernetes API conventions, with reasons and messages from the reconcile.
+// DeclarativeObjects embedding the addon CommonStatus, or implementing ConditionsObject, support conditions.
+func WithStatusConditions() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.statusConditions = true
+		return p
+	}
+}
+
+// WithFailureBackoff sets the Stalled condition with the last error once a DeclarativeObject has failed
+// to reconcile threshold times in a row, and from then on retries every backoff rather than at the
+// rate limiter's interval.  The condition is removed when a reconcile succeeds.
+func WithFailureBackoff(threshold int, backoff time.Duration) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.failureThreshold = threshold
+		p.failureBackoff = backoff
+		return p
+	}
+}
+
+// WithReconcileStatus maintains status.lastReconcileTime, status.lastSuccessfulApplyTime, status.lastError,
+// status.consecutiveFailureCount and status.deployedVersion of the DeclarativeObject, which the addon
+// CommonStatus has fields for.  lastReconcileTime is refreshed at most once a minute when nothing else in
+// the status changes, so that writing it doesn't keep triggering reconciles.
+func WithReconcileStatus() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.reconcileStatus = true
+		return p
+	}
+}
+
+// WithPartialApply tolerates some objects failing to apply: the other objects are still applied,
+// the failed objects are reported in the Ready condition, and the reconcile is retried later
+// rather than failing.  Pruning is skipped until all objects apply successfully.
+func WithPartialApply() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.partialApply = true
+		return p
+	}
+}
+
+// WithRenderCache caches the objects built for up to size DeclarativeObjects, for at most ttl, so that
+// reconciles of an unchanged DeclarativeObject with an unchanged manifest skip parsing, transforming and
+// running kustomize.  The cache is keyed by the raw manifest, spec, labels, annotations and resolved values,
+// so it should only be used when the manifest operations and object transforms depend on nothing else.
+func WithRenderCache(size int, ttl time.Duration) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.renderCacheSize = size
+		p.renderCacheTTL = ttl
+		return p
+	}
+}
+
 // WithApplyKustomize run kustomize build to create final manifest
 func WithApplyKustomize() reconcilerOption {
 	return func(p reconcilerParams) reconcilerParams {
@@ -154,6 +816,21 @@ func WithApplyKustomize() reconcilerOption {
 	}
 }
 
+// WithYttRendering renders the loaded manifest with ytt before any other manifest operations,
+// so that channels can contain ytt templates and overlays.
+// The data values are provided by values, or are the spec of the DeclarativeObject if values is nil.
+//
+// This option requires the ytt binary to be available on the path
+func WithYttRendering(values YttValues) reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		if values == nil {
+			values = SpecAsYttValues
+		}
+		p.yttValues = values
+		return p
+	}
+}
+
 // WithManagedApplication is a transform that will modify the Application object
 // in the deployment to match the configuration of the rest of the deployment.
 func WithManagedApplication(labelMaker LabelMaker) reconcilerOption {
@@ -165,6 +842,27 @@ func WithManagedApplication(labelMaker LabelMaker) reconcilerOption {
 	}
 }
 
+// WithSpecPatches applies the strategic-merge and JSON6902 patches listed in
+// spec.patches of the DeclarativeObject to the manifest
+func WithSpecPatches() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.objectTransformations = append(p.objectTransformations, ApplySpecPatches)
+		return p
+	}
+}
+
+// WithValuesFrom reads values from the ConfigMaps and Secrets referenced in spec.valuesFrom
+// of the DeclarativeObject.  The merged values are available to ManifestOperations and
+// ObjectTransforms through ValuesFromContext, and to TemplateManifest as .values
+//
+// WatchValuesFrom should be used to reconcile when the referenced objects change
+func WithValuesFrom() reconcilerOption {
+	return func(p reconcilerParams) reconcilerParams {
+		p.valuesFrom = true
+		return p
+	}
+}
+
 // WithApplyValidation enables validation with kubectl apply
 func WithApplyValidation() reconcilerOption {
 	return func(p reconcilerParams) reconcilerParams {
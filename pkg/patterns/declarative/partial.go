@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReasonApplyFailed is the reason for a false ConditionReady when some objects failed to apply
+const ReasonApplyFailed = "ApplyFailed"
+
+// partialApplyRecheckInterval is how soon we retry after some objects failed to apply
+var partialApplyRecheckInterval = 30 * time.Second
+
+// partialApplyFailures returns the objects that failed to apply, if only some of them did.
+// If every object failed, the problem is likely not with the objects, so nil is returned.
+func partialApplyFailures(results []ApplyResult) []ApplyResult {
+	var failed []ApplyResult
+	for _, result := range results {
+		if result.Operation == ApplyFailed {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) == len(results) {
+		return nil
+	}
+	return failed
+}
+
+// recordApplyFailures reports the objects that failed to apply in the Ready condition, and requeues
+// so that they are retried
+func (r *Reconciler) recordApplyFailures(ctx context.Context, instance DeclarativeObject, failed []ApplyResult, total int) (reconcile.Result, error) {
+	var failures []string
+	for _, result := range failed {
+		failures = append(failures, result.String())
+	}
+
+	changed, err := setCondition(instance, metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonApplyFailed,
+		Message:            fmt.Sprintf("%d of %d objects failed to apply: %s", len(failed), total, strings.Join(failures, "; ")),
+		ObservedGeneration: instance.GetGeneration(),
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if changed {
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating status: %v", err)
+		}
+	}
+	if r.recorder != nil {
+		r.recorder.Event(instance, "Warning", ReasonApplyFailed, fmt.Sprintf("%d of %d objects failed to apply", len(failed), total))
+	}
+
+	return reconcile.Result{RequeueAfter: partialApplyRecheckInterval}, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	toolsrecord "k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPartialApplyFailures(t *testing.T) {
+	configured := ApplyResult{Kind: "Deployment", Name: "app", Operation: ApplyConfigured}
+	failed := ApplyResult{Kind: "ValidatingWebhookConfiguration", Name: "webhook", Operation: ApplyFailed, Message: "invalid"}
+
+	tests := []struct {
+		name     string
+		results  []ApplyResult
+		expected int
+	}{
+		{
+			name:     "no failures",
+			results:  []ApplyResult{configured},
+			expected: 0,
+		},
+		{
+			name:     "some failures",
+			results:  []ApplyResult{configured, failed},
+			expected: 1,
+		},
+		{
+			name:     "all failed",
+			results:  []ApplyResult{failed, failed},
+			expected: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := partialApplyFailures(test.results); len(got) != test.expected {
+				t.Errorf("expected %d failures, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecordApplyFailures(t *testing.T) {
+	instance := newGuestbook("default", "test", time.Now())
+	recorder := toolsrecord.NewFakeRecorder(10)
+	r := &Reconciler{
+		client:   fake.NewClientBuilder().WithObjects(instance).Build(),
+		recorder: recorder,
+	}
+
+	failed := []ApplyResult{{Kind: "ValidatingWebhookConfiguration", Name: "webhook", Operation: ApplyFailed, Message: "invalid"}}
+	result, err := r.recordApplyFailures(context.Background(), instance, failed, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("expected requeue, got %v", result)
+	}
+
+	updated := &unstructured.Unstructured{}
+	updated.SetGroupVersionKind(instance.GroupVersionKind())
+	if err := r.client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "test"}, updated); err != nil {
+		t.Fatalf("error getting instance: %v", err)
+	}
+	conditions, _, err := getConditions(updated)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ready := meta.FindStatusCondition(conditions, ConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse || ready.Reason != ReasonApplyFailed {
+		t.Fatalf("unexpected Ready condition %v", ready)
+	}
+	if !strings.Contains(ready.Message, "1 of 3 objects failed to apply: ValidatingWebhookConfiguration webhook failed: invalid") {
+		t.Errorf("unexpected message %q", ready.Message)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected a warning event to be recorded")
+	}
+}
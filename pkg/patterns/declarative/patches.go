@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// PatchTarget selects the objects a JSON6902 patch applies to. Empty fields match all objects.
+type PatchTarget struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Matches returns true if the object is selected by the PatchTarget
+func (t *PatchTarget) Matches(o *manifest.Object) bool {
+	gvk := o.GroupVersionKind()
+	if t.Group != "" && t.Group != gvk.Group {
+		return false
+	}
+	if t.Version != "" && t.Version != gvk.Version {
+		return false
+	}
+	if t.Kind != "" && t.Kind != gvk.Kind {
+		return false
+	}
+	if t.Name != "" && t.Name != o.Name {
+		return false
+	}
+	if t.Namespace != "" && t.Namespace != o.Namespace {
+		return false
+	}
+	return true
+}
+
+// ApplySpecPatches is an ObjectTransform that applies the patches in spec.patches of the DeclarativeObject.
+//
+// Each patch is either a strategic-merge patch, which is a partial object identified by
+// apiVersion, kind and metadata.name, or a JSON6902 patch of the form:
+//
+//	target:
+//	  kind: Deployment
+//	  name: foo
+//	patch: |
+//	  - op: replace
+//	    path: /spec/replicas
+//	    value: 2
+func ApplySpecPatches(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+	log := log.FromContext(ctx)
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(instance)
+	if err != nil {
+		return fmt.Errorf("error converting object to unstructured: %v", err)
+	}
+	patches, _, err := unstructured.NestedSlice(u, "spec", "patches")
+	if err != nil {
+		return fmt.Errorf("error reading spec.patches: %v", err)
+	}
+
+	var strategicPatches []*unstructured.Unstructured
+	for i, p := range patches {
+		m, ok := p.(map[string]interface{})
+		if !ok {
+			return NewTerminalError(ReasonInvalidSpec, fmt.Errorf("spec.patches[%d] was not an object", i))
+		}
+
+		if _, isJSONPatch := m["target"]; isJSONPatch {
+			if err := applyJSONPatch(objects, m); err != nil {
+				return NewTerminalError(ReasonInvalidSpec, fmt.Errorf("error applying spec.patches[%d]: %v", i, err))
+			}
+			continue
+		}
+
+		strategicPatches = append(strategicPatches, &unstructured.Unstructured{Object: m})
+	}
+
+	log.WithValues("patches", len(patches)).V(1).Info("applying spec patches")
+
+	if len(strategicPatches) == 0 {
+		return nil
+	}
+	if err := objects.Patch(strategicPatches); err != nil {
+		return NewTerminalError(ReasonInvalidSpec, fmt.Errorf("error applying spec.patches: %v", err))
+	}
+	return nil
+}
+
+var _ ObjectTransform = ApplySpecPatches
+
+func applyJSONPatch(objects *manifest.Objects, p map[string]interface{}) error {
+	t, ok := p["target"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("target was not an object")
+	}
+	var target PatchTarget
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(t, &target); err != nil {
+		return fmt.Errorf("error parsing target: %v", err)
+	}
+
+	var patch []byte
+	switch v := p["patch"].(type) {
+	case string:
+		patch = []byte(v)
+	case []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("error parsing patch: %v", err)
+		}
+		patch = b
+	default:
+		return fmt.Errorf("patch must be a string or a list of operations, was %T", v)
+	}
+
+	for _, o := range objects.Items {
+		if !target.Matches(o) {
+			continue
+		}
+		if err := o.ApplyJSONPatch(patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+	"sigs.k8s.io/yaml"
+)
+
+func TestApplySpecPatches(t *testing.T) {
+	inputManifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: php-redis
+        image: gcr.io/google-samples/gb-frontend:v4
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+spec:
+  type: ClusterIP
+`
+
+	tests := []struct {
+		name     string
+		patches  string
+		expected map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name: "strategic merge patch",
+			patches: `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: frontend
+  spec:
+    template:
+      spec:
+        containers:
+        - name: php-redis
+          image: example.com/frontend:v5
+`,
+			expected: map[string]interface{}{
+				"Deployment/spec.template.spec.containers[0].image": "example.com/frontend:v5",
+				"Deployment/spec.replicas":                          int64(1),
+			},
+		},
+		{
+			name: "json6902 patch as string",
+			patches: `
+- target:
+    kind: Deployment
+    name: frontend
+  patch: |
+    - op: replace
+      path: /spec/replicas
+      value: 3
+`,
+			expected: map[string]interface{}{
+				"Deployment/spec.replicas": int64(3),
+				"Service/spec.type":        "ClusterIP",
+			},
+		},
+		{
+			name: "json6902 patch as list",
+			patches: `
+- target:
+    kind: Service
+  patch:
+  - op: replace
+    path: /spec/type
+    value: LoadBalancer
+`,
+			expected: map[string]interface{}{
+				"Deployment/spec.replicas": int64(1),
+				"Service/spec.type":        "LoadBalancer",
+			},
+		},
+		{
+			name: "invalid json6902 patch",
+			patches: `
+- target:
+    kind: Service
+  patch:
+  - op: replace
+    path: /spec/doesnotexist/type
+    value: LoadBalancer
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var patches []interface{}
+			if err := yaml.Unmarshal([]byte(test.patches), &patches); err != nil {
+				t.Fatalf("error parsing patches: %v", err)
+			}
+			instance := &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "addons.example.org/v1alpha1",
+					"kind":       "Guestbook",
+					"metadata": map[string]interface{}{
+						"name":      "test",
+						"namespace": "default",
+					},
+					"spec": map[string]interface{}{
+						"patches": patches,
+					},
+				},
+			}
+
+			objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+
+			err = ApplySpecPatches(context.Background(), instance, objects)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			actual := map[string]interface{}{}
+			for _, o := range objects.Items {
+				u := o.UnstructuredObject().Object
+				switch o.Kind {
+				case "Deployment":
+					replicas, _, _ := unstructured.NestedFieldNoCopy(u, "spec", "replicas")
+					actual["Deployment/spec.replicas"] = replicas
+					containers, _, _ := unstructured.NestedSlice(u, "spec", "template", "spec", "containers")
+					actual["Deployment/spec.template.spec.containers[0].image"] = containers[0].(map[string]interface{})["image"]
+				case "Service":
+					svcType, _, _ := unstructured.NestedString(u, "spec", "type")
+					actual["Service/spec.type"] = svcType
+				}
+			}
+			for k, v := range test.expected {
+				if actual[k] != v {
+					t.Errorf("unexpected value for %s, expected %v (%T), got %v (%T)", k, v, v, actual[k], actual[k])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const (
+	// PausedAnnotation on a DeclarativeObject, set to "true", stops its manifest being applied with WithPause
+	PausedAnnotation = "addons.k8s.io/paused"
+
+	// ConditionPaused is true while a DeclarativeObject is paused.  Its reason is ReasonChangesPending when the
+	// objects have drifted from the manifest, or ReasonNoChanges.
+	ConditionPaused = "Paused"
+)
+
+// isPaused returns true if instance has spec.paused set, or is annotated with PausedAnnotation
+func (r *Reconciler) isPaused(instance DeclarativeObject) (bool, error) {
+	if instance.GetAnnotations()[PausedAnnotation] == "true" {
+		return true, nil
+	}
+	obj, err := objectMap(instance)
+	if err != nil {
+		return false, err
+	}
+	paused, _, _ := unstructured.NestedBool(obj, "spec", "paused")
+	return paused, nil
+}
+
+// pause reports the drift of the objects from the manifest in the Paused condition, without applying anything
+func (r *Reconciler) pause(ctx context.Context, instance DeclarativeObject, ns string, objects *manifest.Objects) (context.Context, error) {
+	log := log.FromContext(ctx)
+
+	diffs, err := r.previewChanges(ctx, ns, objects)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = contextWithDryRunDiffs(ctx, diffs)
+
+	condition := changesCondition(ConditionPaused, instance, diffs)
+	log.WithValues("reason", condition.Reason).Info("paused, not applying")
+	if err := r.setPreviewCondition(ctx, instance, condition); err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIsPaused(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		spec        map[string]interface{}
+		expected    bool
+	}{
+		{name: "not paused"},
+		{name: "annotated", annotations: map[string]string{PausedAnnotation: "true"}, expected: true},
+		{name: "annotated false", annotations: map[string]string{PausedAnnotation: "false"}},
+		{name: "spec.paused", spec: map[string]interface{}{"paused": true}, expected: true},
+		{name: "spec.paused false", spec: map[string]interface{}{"paused": false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instance := newGuestbook("default", "test", time.Now())
+			instance.SetAnnotations(test.annotations)
+			if test.spec != nil {
+				if err := unstructured.SetNestedMap(instance.Object, test.spec, "spec"); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			r := &Reconciler{}
+			paused, err := r.isPaused(instance)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if paused != test.expected {
+				t.Errorf("expected paused=%v, got %v", test.expected, paused)
+			}
+		})
+	}
+}
+
+func TestChangesCondition(t *testing.T) {
+	instance := newGuestbook("default", "test", time.Now())
+	unchanged := ObjectDiff{Kind: "ConfigMap", Name: "unchanged", Operation: ApplyUnchanged}
+	configured := ObjectDiff{Group: "apps", Kind: "Deployment", Name: "frontend", Operation: ApplyConfigured}
+
+	condition := changesCondition(ConditionPaused, instance, []ObjectDiff{unchanged})
+	if condition.Type != ConditionPaused || condition.Reason != ReasonNoChanges {
+		t.Errorf("expected %s condition with reason %s, got %v", ConditionPaused, ReasonNoChanges, condition)
+	}
+
+	condition = changesCondition(ConditionPaused, instance, []ObjectDiff{unchanged, configured})
+	if condition.Reason != ReasonChangesPending {
+		t.Errorf("expected reason %s, got %v", ReasonChangesPending, condition)
+	}
+	if expected := "Applying the manifest would change 1 of 2 objects: " + configured.String(); condition.Message != expected {
+		t.Errorf("expected message %q, got %q", expected, condition.Message)
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const (
+	// ConditionMissingPermissions is true when WithPermissionCheck finds the operator can't manage some objects of
+	// the manifest
+	ConditionMissingPermissions = "MissingPermissions"
+	// ReasonForbidden is the reason for a true ConditionMissingPermissions
+	ReasonForbidden = "Forbidden"
+)
+
+// permissionVerbs are the verbs checked by WithPermissionCheck on each resource of the manifest
+var permissionVerbs = []string{"create", "update", "patch", "delete"}
+
+var (
+	selfSubjectAccessReviews = schema.GroupVersionResource{Group: "authorization.k8s.io", Version: "v1", Resource: "selfsubjectaccessreviews"}
+	subjectAccessReviews     = schema.GroupVersionResource{Group: "authorization.k8s.io", Version: "v1", Resource: "subjectaccessreviews"}
+)
+
+// MissingPermission is a verb on a resource the objects of the manifest need, but which isn't allowed
+type MissingPermission struct {
+	Verb      string
+	Resource  schema.GroupResource
+	Namespace string
+}
+
+func (p MissingPermission) String() string {
+	if p.Namespace == "" {
+		return p.Verb + " " + p.Resource.String()
+	}
+	return p.Verb + " " + p.Resource.String() + " in namespace " + p.Namespace
+}
+
+// PermissionError is returned with WithPermissionCheck when the operator is missing permissions needed to apply
+// the manifest, listing all of them
+type PermissionError struct {
+	User    string
+	Missing []MissingPermission
+}
+
+func (e *PermissionError) Error() string {
+	var missing []string
+	for _, p := range e.Missing {
+		missing = append(missing, p.String())
+	}
+	return fmt.Sprintf("%s is not allowed to %s", e.User, strings.Join(missing, ", "))
+}
+
+// checkPermissions checks the operator may create, update, patch and delete each resource of objects in its
+// namespace, with an access review of each, as the impersonated ServiceAccount with WithImpersonation.  The
+// missing permissions are reported in ConditionMissingPermissions of instance, and returned as a PermissionError.
+// Objects of kinds not yet known, eg those defined by CRDs of the manifest, are skipped.
+func (r *Reconciler) checkPermissions(ctx context.Context, instance DeclarativeObject, ns string, objects *manifest.Objects) error {
+	log := log.FromContext(ctx)
+
+	type access struct {
+		resource  schema.GroupResource
+		namespace string
+	}
+	seen := make(map[access]bool)
+	var accesses []access
+	for _, o := range objects.Items {
+		mapping, err := r.restMapping(ctx, o.GroupKind(), o.GroupVersionKind().Version)
+		if meta.IsNoMatchError(err) {
+			log.WithValues("kind", o.GroupKind().String()).V(2).Info("not checking permissions for unknown kind")
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to get mapping for %s: %v", o.Kind, err)
+		}
+		a := access{resource: mapping.Resource.GroupResource()}
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			a.namespace = o.Namespace
+			if a.namespace == "" {
+				a.namespace = ns
+			}
+		}
+		if !seen[a] {
+			seen[a] = true
+			accesses = append(accesses, a)
+		}
+	}
+	sort.Slice(accesses, func(i, j int) bool {
+		if accesses[i].resource != accesses[j].resource {
+			return accesses[i].resource.String() < accesses[j].resource.String()
+		}
+		return accesses[i].namespace < accesses[j].namespace
+	})
+
+	user, _ := ctx.Value(impersonateKey{}).(string)
+	var missing []MissingPermission
+	for _, a := range accesses {
+		for _, verb := range permissionVerbs {
+			attributes := authorizationv1.ResourceAttributes{
+				Namespace: a.namespace,
+				Verb:      verb,
+				Group:     a.resource.Group,
+				Resource:  a.resource.Resource,
+			}
+			allowed, err := r.accessAllowed(ctx, user, attributes)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				missing = append(missing, MissingPermission{Verb: verb, Resource: a.resource, Namespace: a.namespace})
+			}
+		}
+	}
+
+	var permissionErr *PermissionError
+	if len(missing) != 0 {
+		if user == "" {
+			user = "the operator"
+		}
+		permissionErr = &PermissionError{User: user, Missing: missing}
+	}
+	if err := r.reportMissingPermissions(ctx, instance, permissionErr); err != nil {
+		return err
+	}
+	if permissionErr != nil {
+		return permissionErr
+	}
+	return nil
+}
+
+// accessAllowed returns whether the operator, or user if set, is allowed the access described by attributes
+func (r *Reconciler) accessAllowed(ctx context.Context, user string, attributes authorizationv1.ResourceAttributes) (bool, error) {
+	var review runtime.Object
+	var resource schema.GroupVersionResource
+	if user == "" {
+		resource = selfSubjectAccessReviews
+		review = &authorizationv1.SelfSubjectAccessReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "authorization.k8s.io/v1", Kind: "SelfSubjectAccessReview"},
+			Spec:     authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+		}
+	} else {
+		resource = subjectAccessReviews
+		review = &authorizationv1.SubjectAccessReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "authorization.k8s.io/v1", Kind: "SubjectAccessReview"},
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &attributes,
+				User:               user,
+				Groups:             serviceAccountGroups(user),
+			},
+		}
+	}
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(review)
+	if err != nil {
+		return false, err
+	}
+	result, err := r.accessReviewClient().Resource(resource).Create(ctx, &unstructured.Unstructured{Object: u}, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("error reviewing access to %s %s: %v", attributes.Verb, attributes.Resource, err)
+	}
+	allowed, _, err := unstructured.NestedBool(result.Object, "status", "allowed")
+	if err != nil {
+		return false, fmt.Errorf("error reading access review: %v", err)
+	}
+	return allowed, nil
+}
+
+// serviceAccountGroups returns the groups of the ServiceAccount user, as set by the authenticator
+func serviceAccountGroups(user string) []string {
+	parts := strings.Split(user, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return nil
+	}
+	return []string{"system:serviceaccounts", "system:serviceaccounts:" + parts[2], "system:authenticated"}
+}
+
+// reportMissingPermissions sets ConditionMissingPermissions on instance with the message of permissionErr, or
+// removes it if permissionErr is nil
+func (r *Reconciler) reportMissingPermissions(ctx context.Context, instance DeclarativeObject, permissionErr *PermissionError) error {
+	var changed bool
+	var err error
+	if permissionErr == nil {
+		changed, err = removeCondition(instance, ConditionMissingPermissions, ReasonForbidden)
+	} else {
+		changed, err = setCondition(instance, metav1.Condition{
+			Type:               ConditionMissingPermissions,
+			Status:             metav1.ConditionTrue,
+			Reason:             ReasonForbidden,
+			Message:            permissionErr.Error(),
+			ObservedGeneration: instance.GetGeneration(),
+		})
+	}
+	if err != nil || !changed {
+		return err
+	}
+
+	if permissionErr != nil && r.recorder != nil {
+		r.recorder.Event(instance, "Warning", ReasonForbidden, permissionErr.Error())
+	}
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	return nil
+}
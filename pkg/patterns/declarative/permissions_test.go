@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: defined-by-manifest
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	// Deployments can't be deleted, and nothing can be done by the ServiceAccount
+	deploymentDeleteAllowed := false
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	reviewed := make(map[string]int)
+	reactor := func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		reviewed[action.GetResource().Resource]++
+		attributes, _, _ := unstructured.NestedStringMap(review.Object, "spec", "resourceAttributes")
+		user, _, _ := unstructured.NestedString(review.Object, "spec", "user")
+		allowed := user == "" && attributes["namespace"] == "default" &&
+			!(attributes["resource"] == "deployments" && attributes["verb"] == "delete" && !deploymentDeleteAllowed)
+		_ = unstructured.SetNestedField(review.Object, allowed, "status", "allowed")
+		return true, review, nil
+	}
+	client.PrependReactor("create", "selfsubjectaccessreviews", reactor)
+	client.PrependReactor("create", "subjectaccessreviews", reactor)
+
+	instance := newGuestbook("default", "test", time.Now())
+	r := &Reconciler{
+		client:        fake.NewClientBuilder().WithObjects(instance).Build(),
+		restMapper:    mapper,
+		dynamicClient: client,
+	}
+
+	err = r.checkPermissions(ctx, instance, "default", objects)
+	var permissionErr *PermissionError
+	if !errors.As(err, &permissionErr) {
+		t.Fatalf("expected a PermissionError, got %v", err)
+	}
+	expected := "the operator is not allowed to delete deployments.apps in namespace default"
+	if err.Error() != expected {
+		t.Errorf("unexpected error %q, expected %q", err.Error(), expected)
+	}
+	if reviewed["selfsubjectaccessreviews"] != 8 {
+		t.Errorf("expected 8 access reviews, got %d", reviewed["selfsubjectaccessreviews"])
+	}
+	conditions, _, err := getConditions(instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	condition := meta.FindStatusCondition(conditions, ConditionMissingPermissions)
+	if condition == nil || condition.Reason != ReasonForbidden || condition.Message != expected {
+		t.Fatalf("unexpected MissingPermissions condition %v", condition)
+	}
+
+	// The ServiceAccount impersonated is reviewed instead of the operator
+	impersonated := contextWithImpersonation(ctx, "system:serviceaccount:default:deployer")
+	err = r.checkPermissions(impersonated, instance, "default", objects)
+	if !errors.As(err, &permissionErr) || len(permissionErr.Missing) != 8 || permissionErr.User != "system:serviceaccount:default:deployer" {
+		t.Errorf("expected all permissions to be missing for the ServiceAccount, got %v", err)
+	}
+
+	// The condition is removed once all permissions are granted
+	deploymentDeleteAllowed = true
+	if err := r.checkPermissions(ctx, instance, "default", objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conditions, _, err = getConditions(instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if condition := meta.FindStatusCondition(conditions, ConditionMissingPermissions); condition != nil {
+		t.Errorf("expected the MissingPermissions condition to be removed, got %v", condition)
+	}
+}
@@ -2,20 +2,27 @@ package applier
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/kubectl/pkg/cmd/apply"
-	cmdDelete "k8s.io/kubectl/pkg/cmd/delete"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 )
 
-type DirectApplier struct {
-	a apply.ApplyOptions
-}
+// DirectApplier applies manifests in-process, with the apply and prune code of k8s.io/kubectl, so no kubectl binary
+// is needed.  It takes the same args as kubectl apply: --prune, --selector and --prune-whitelist prune the objects no
+// longer in the manifest, and the server-side apply, --as and --kubeconfig args are honoured.  The results are
+// recorded from the objects kubectl applies and prunes, rather than parsed from its output.
+type DirectApplier struct{}
 
 func NewDirectApplier() *DirectApplier {
 	return &DirectApplier{}
@@ -27,32 +34,106 @@ func (d *DirectApplier) Apply(ctx context.Context,
 	validate bool,
 	extraArgs ...string,
 ) error {
+	_, err := d.ApplyWithResults(ctx, namespace, manifest, validate, extraArgs...)
+	return err
+}
+
+// ApplyWithResults applies the manifest like Apply, also returning what was done with each object.
+// The results are returned even if the apply fails, as some objects may still have been applied.
+func (d *DirectApplier) ApplyWithResults(ctx context.Context,
+	namespace string,
+	manifest string,
+	validate bool,
+	extraArgs ...string,
+) (*Results, error) {
 	ioStreams := genericclioptions.IOStreams{
 		In:     os.Stdin,
 		Out:    os.Stdout,
 		ErrOut: os.Stderr,
 	}
-	restClient := genericclioptions.NewConfigFlags(true).WithDeprecatedPasswordFlag()
+	restClient := clientGetter(ctx, extraArgs)
 	ioReader := strings.NewReader(manifest)
 
 	b := resource.NewBuilder(restClient)
 	res := b.Unstructured().Stream(ioReader, "manifestString").Do()
 	infos, err := res.Infos()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	applyOpts := apply.NewApplyOptions(ioStreams)
+	applyOpts, err := applyOptions(cmdutil.NewFactory(restClient), ioStreams, validate, extraArgs)
+	if err != nil {
+		return nil, err
+	}
 	applyOpts.Namespace = namespace
 	applyOpts.SetObjects(infos)
+
+	results := &Results{Operations: make(map[string]string)}
 	applyOpts.ToPrinter = func(operation string) (printers.ResourcePrinter, error) {
 		applyOpts.PrintFlags.NamePrintFlags.Operation = operation
 		cmdutil.PrintFlagsWithDryRunStrategy(applyOpts.PrintFlags, applyOpts.DryRunStrategy)
-		return applyOpts.PrintFlags.ToPrinter()
+		printer, err := applyOpts.PrintFlags.ToPrinter()
+		if err != nil {
+			return nil, err
+		}
+		return &recordingPrinter{printer: printer, operation: operation, results: results}, nil
 	}
-	applyOpts.DeleteOptions = &cmdDelete.DeleteOptions{
-		IOStreams: ioStreams,
+
+	err = applyOpts.Run()
+
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		for _, err := range agg.Errors() {
+			results.Errors = append(results.Errors, err.Error())
+		}
+	} else if err != nil {
+		results.Errors = append(results.Errors, err.Error())
 	}
+	return results, err
+}
 
-	return applyOpts.Run()
+// applyOptions returns the options of kubectl apply with args, completed by f the same way kubectl does, so
+// that the objects are printed and pruned after they are all applied
+func applyOptions(f cmdutil.Factory, ioStreams genericclioptions.IOStreams, validate bool, args []string) (*apply.ApplyOptions, error) {
+	cmd := apply.NewCmdApply("kubectl", f, ioStreams)
+	// The args for the client, eg --as and --kubeconfig, are not flags of apply but are handled by clientGetter
+	cmd.Flags().ParseErrorsWhitelist.UnknownFlags = true
+	if err := cmd.Flags().Parse(args); err != nil {
+		return nil, fmt.Errorf("error parsing kubectl apply args %v: %v", args, err)
+	}
+	if err := cmd.Flags().Set("validate", strconv.FormatBool(validate)); err != nil {
+		return nil, err
+	}
+	// The objects are set directly, but kubectl requires them to be read from somewhere
+	if err := cmd.Flags().Set("filename", "-"); err != nil {
+		return nil, err
+	}
+
+	o := apply.NewApplyOptions(ioStreams)
+	o.Prune = cmdutil.GetFlagBool(cmd, "prune")
+	o.Selector = cmdutil.GetFlagString(cmd, "selector")
+	o.PruneWhitelist = cmdutil.GetFlagStringArray(cmd, "prune-whitelist")
+	if o.Prune && o.Selector == "" {
+		return nil, fmt.Errorf("--prune requires --selector, so as not to prune every object")
+	}
+	if err := o.Complete(f, cmd); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// recordingPrinter records the operation on each object printed by kubectl apply in the results, before printing it
+type recordingPrinter struct {
+	printer   printers.ResourcePrinter
+	operation string
+	results   *Results
+}
+
+func (p *recordingPrinter) PrintObj(obj runtime.Object, w io.Writer) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	p.results.Operations[ObjectID(gvk.Group, gvk.Kind, accessor.GetName())] = p.operation
+	return p.printer.PrintObj(obj, w)
 }
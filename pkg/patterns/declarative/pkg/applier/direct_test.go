@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestRecordingPrinter(t *testing.T) {
+	deployment := &unstructured.Unstructured{}
+	deployment.SetAPIVersion("apps/v1")
+	deployment.SetKind("Deployment")
+	deployment.SetName("app")
+	configMap := &unstructured.Unstructured{}
+	configMap.SetAPIVersion("v1")
+	configMap.SetKind("ConfigMap")
+	configMap.SetName("old")
+
+	results := &Results{Operations: make(map[string]string)}
+	var out bytes.Buffer
+	for _, p := range []struct {
+		operation string
+		obj       *unstructured.Unstructured
+	}{
+		{operation: "configured", obj: deployment},
+		{operation: "pruned", obj: configMap},
+	} {
+		printFlags := genericclioptions.NewPrintFlags(p.operation)
+		printer, err := printFlags.ToPrinter()
+		if err != nil {
+			t.Fatalf("error creating printer: %v", err)
+		}
+		recording := &recordingPrinter{printer: printer, operation: p.operation, results: results}
+		if err := recording.PrintObj(p.obj, &out); err != nil {
+			t.Fatalf("error printing %s: %v", p.obj.GetName(), err)
+		}
+	}
+
+	expected := map[string]string{
+		"deployment.apps/app": "configured",
+		"configmap/old":       "pruned",
+	}
+	if !reflect.DeepEqual(results.Operations, expected) {
+		t.Errorf("expected operations %v, got %v", expected, results.Operations)
+	}
+	if out.String() != "deployment.apps/app configured\nconfigmap/old pruned\n" {
+		t.Errorf("expected the objects to be printed like kubectl, got %q", out.String())
+	}
+}
@@ -20,21 +20,85 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 
+	semver "github.com/blang/semver/v4"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// RequiredApplyFlags are the flags of kubectl apply the reconciler relies on
+var RequiredApplyFlags = []string{"--validate", "--prune", "--prune-whitelist", "--selector"}
+
 // New creates a Client that runs kubectl avaliable on the path with default authentication
 func NewExec() *ExecKubectl {
-	return &ExecKubectl{cmdSite: &console{}}
+	return NewExecWithBinary("kubectl")
+}
+
+// NewExecWithBinary creates a Client that runs the kubectl binary at path, with env (as KEY=value) added to its
+// environment
+func NewExecWithBinary(path string, env ...string) *ExecKubectl {
+	return &ExecKubectl{cmdSite: &console{}, path: path, env: env}
 }
 
-// ExecKubectl provides an interface to kubectl
+// ExecKubectl provides an interface to kubectl.  The version of kubectl is detected before the first apply, and the
+// flags passed to kubectl are adapted to it, so that kubectl can be upgraded without breaking pruning or validation.
 type ExecKubectl struct {
 	cmdSite commandSite
+	path    string
+	env     []string
+
+	// mutex guards version, which is nil if it couldn't be detected
+	mutex           sync.Mutex
+	version         *semver.Version
+	versionDetected bool
+}
+
+// command returns the command running kubectl with args, killed if ctx is cancelled
+func (c *ExecKubectl) command(ctx context.Context, args ...string) *exec.Cmd {
+	path := c.path
+	if path == "" {
+		path = "kubectl"
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	if len(c.env) != 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	return cmd
+}
+
+// Verify checks that kubectl can be run, and that kubectl apply supports RequiredApplyFlags and flags, so that
+// a missing or outdated kubectl is reported before anything is applied
+func (c *ExecKubectl) Verify(ctx context.Context, flags ...string) error {
+	cmd := c.command(ctx, "apply", "--help")
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := c.cmdSite.Run(cmd); err != nil {
+		return fmt.Errorf("error running %s: %v: %s", cmd.Path, err, stderr.String())
+	}
+
+	var missing []string
+	for _, flag := range append(append([]string{}, RequiredApplyFlags...), flags...) {
+		if strings.Contains(stdout.String(), flag+"=") {
+			continue
+		}
+		if renamed, ok := renamedFlags[flag]; ok && strings.Contains(stdout.String(), renamed.name+"=") {
+			continue
+		}
+		missing = append(missing, flag)
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("%s apply doesn't support %s, upgrade kubectl", cmd.Path, strings.Join(missing, ", "))
+	}
+
+	// Detect the version now, so the flags are adapted from the first apply
+	c.clientVersion(ctx)
+	return nil
 }
 
 // commandSite allows for tests to mock cmd.Run() events
@@ -51,9 +115,17 @@ func (console) Run(c *exec.Cmd) error {
 // Apply runs the kubectl apply with the provided manifest argument
 func (c *ExecKubectl) Apply(ctx context.Context, namespace string, manifest string, validate bool,
 	extraArgs ...string) error {
-	log := log.Log
+	_, err := c.ApplyWithResults(ctx, namespace, manifest, validate, extraArgs...)
+	return err
+}
+
+// ApplyWithResults runs kubectl apply like Apply, also returning what kubectl reported for each object.
+// The results are returned even if kubectl fails, as some objects may still have been applied.
+func (c *ExecKubectl) ApplyWithResults(ctx context.Context, namespace string, manifest string, validate bool,
+	extraArgs ...string) (*Results, error) {
+	log := log.FromContext(ctx)
 
-	log.Info("applying manifest")
+	log.V(1).Info("applying manifest")
 
 	args := []string{"apply"}
 	if namespace != "" {
@@ -66,8 +138,10 @@ func (c *ExecKubectl) Apply(ctx context.Context, namespace string, manifest stri
 
 	args = append(args, extraArgs...)
 	args = append(args, "-f", "-")
+	args = compatibleArgs(c.clientVersion(ctx), args)
 
-	cmd := exec.Command("kubectl", args...)
+	// kubectl is killed if ctx is cancelled, eg by a reconcile timeout or the operator shutting down
+	cmd := c.command(ctx, args...)
 	cmd.Stdin = strings.NewReader(manifest)
 
 	var stdout bytes.Buffer
@@ -75,16 +149,25 @@ func (c *ExecKubectl) Apply(ctx context.Context, namespace string, manifest stri
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	log.WithValues("command", "kubectl").WithValues("args", args).Info("executing kubectl")
+	log.WithValues("command", "kubectl").WithValues("args", args).V(1).Info("executing kubectl")
 
 	err := c.cmdSite.Run(cmd)
+
+	results := &Results{}
+	results.parseApplyOutput(stdout.String())
+	results.parseErrorOutput(stderr.String())
+
+	if err != nil && ctx.Err() != nil {
+		log.WithValues("stdout", stdout.String()).WithValues("stderr", stderr.String()).Error(err, "kubectl apply interrupted")
+		return results, fmt.Errorf("kubectl apply interrupted: %w", ctx.Err())
+	}
 	if err != nil {
 		log.WithValues("stdout", stdout.String()).WithValues("stderr", stderr.String()).Error(err, "error from running kubectl apply")
 		log.Info(fmt.Sprintf("manifest:\n%v", manifest))
-		return fmt.Errorf("error from running kubectl apply: %v", err)
+		return results, fmt.Errorf("error from running kubectl apply: %v", err)
 	}
 
 	log.WithValues("stdout", stdout.String()).WithValues("stderr", stderr.String()).V(2).Info("ran kubectl apply")
 
-	return nil
+	return results, nil
 }
@@ -19,7 +19,11 @@ package applier
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"io/ioutil"
 	"reflect"
@@ -84,7 +88,8 @@ func TestKubectlApply(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			cs := collector{Error: test.err}
-			kubectl := &ExecKubectl{cmdSite: &cs}
+			// The version of kubectl is unknown, so the args are passed unchanged
+			kubectl := &ExecKubectl{cmdSite: &cs, versionDetected: true}
 			err := kubectl.Apply(context.Background(), test.namespace, test.manifest, test.validate, test.args...)
 
 			if test.err != nil && err == nil {
@@ -110,3 +115,85 @@ func TestKubectlApply(t *testing.T) {
 	}
 
 }
+
+func TestKubectlApplyCancelled(t *testing.T) {
+	// A kubectl that never finishes
+	dir, err := ioutil.TempDir("", "kubectl")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatalf("error writing kubectl: %v", err)
+	}
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = NewExec().Apply(ctx, "", "foo", false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("expected kubectl to be killed, took %v", elapsed)
+	}
+}
+
+// helpSite is a commandSite printing the help of kubectl apply
+type helpSite struct {
+	help string
+	err  error
+}
+
+func (s *helpSite) Run(c *exec.Cmd) error {
+	c.Stdout.Write([]byte(s.help))
+	return s.err
+}
+
+func TestKubectlVerify(t *testing.T) {
+	help120 := `Options:
+      --all=false: Select all resources in the namespace of the specified resource types.
+      --field-manager='kubectl-client-side-apply': Name of the manager used to track field ownership.
+      --force-conflicts=false: If true, server-side apply will force the changes against conflicts.
+      --prune=false: Automatically delete resource objects, including the uninitialized ones.
+      --prune-whitelist=[]: Overwrite the default whitelist with <group/version/kind> for --prune
+  -l, --selector='': Selector (label query) to filter on
+      --server-side=false: If true, apply runs in the server instead of the client.
+      --validate=true: If true, use a schema to validate the input before sending it
+`
+	tests := []struct {
+		name    string
+		help    string
+		err     error
+		flags   []string
+		wantErr bool
+	}{
+		{name: "supported", help: help120},
+		{name: "server-side supported", help: help120, flags: []string{"--server-side", "--force-conflicts"}},
+		{
+			name: "renamed flag",
+			help: strings.Replace(help120, "--prune-whitelist", "--prune-allowlist", 1),
+		},
+		{
+			name:    "unsupported",
+			help:    strings.Replace(help120, "--server-side=false", "", 1),
+			flags:   []string{"--server-side"},
+			wantErr: true,
+		},
+		{name: "not runnable", err: errors.New("exec: not found"), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kubectl := NewExecWithBinary("/usr/local/bin/kubectl")
+			kubectl.cmdSite = &helpSite{help: test.help, err: test.err}
+			err := kubectl.Verify(context.Background(), test.flags...)
+			if test.wantErr != (err != nil) {
+				t.Errorf("expected error=%v, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
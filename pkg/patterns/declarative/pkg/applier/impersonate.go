@@ -0,0 +1,46 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"strings"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// ImpersonateArgPrefix prefixes the user to impersonate when applying, like kubectl --as
+const ImpersonateArgPrefix = "--as="
+
+// KubeconfigArgPrefix prefixes the kubeconfig of the cluster to apply to, like kubectl --kubeconfig
+const KubeconfigArgPrefix = "--kubeconfig="
+
+// configFlags returns the kubectl config flags for applying with args, impersonating the user of the --as arg and
+// connecting to the cluster of the --kubeconfig arg
+func configFlags(args []string) *genericclioptions.ConfigFlags {
+	flags := genericclioptions.NewConfigFlags(true).WithDeprecatedPasswordFlag()
+	for _, arg := range args {
+		if strings.HasPrefix(arg, ImpersonateArgPrefix) {
+			user := strings.TrimPrefix(arg, ImpersonateArgPrefix)
+			flags.Impersonate = &user
+		}
+		if strings.HasPrefix(arg, KubeconfigArgPrefix) {
+			kubeconfig := strings.TrimPrefix(arg, KubeconfigArgPrefix)
+			flags.KubeConfig = &kubeconfig
+		}
+	}
+	return flags
+}
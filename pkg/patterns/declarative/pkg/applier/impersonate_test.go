@@ -0,0 +1,35 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"testing"
+)
+
+func TestConfigFlags(t *testing.T) {
+	if flags := configFlags([]string{"--force"}); flags.Impersonate != nil && *flags.Impersonate != "" {
+		t.Errorf("expected no impersonation, got %q", *flags.Impersonate)
+	}
+	flags := configFlags([]string{"--force", "--as=system:serviceaccount:tenant:addon"})
+	if flags.Impersonate == nil || *flags.Impersonate != "system:serviceaccount:tenant:addon" {
+		t.Errorf("expected impersonation of the service account, got %v", flags.Impersonate)
+	}
+	flags = configFlags([]string{"--kubeconfig=/tmp/remote/kubeconfig"})
+	if flags.KubeConfig == nil || *flags.KubeConfig != "/tmp/remote/kubeconfig" {
+		t.Errorf("expected the kubeconfig of the remote cluster, got %v", flags.KubeConfig)
+	}
+}
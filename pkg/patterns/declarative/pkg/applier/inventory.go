@@ -0,0 +1,548 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/kubectl/pkg/cmd/apply"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/scheme"
+	"sigs.k8s.io/cli-utils/pkg/apply/event"
+	"sigs.k8s.io/cli-utils/pkg/apply/poller"
+	"sigs.k8s.io/cli-utils/pkg/apply/taskrunner"
+	"sigs.k8s.io/cli-utils/pkg/common"
+	"sigs.k8s.io/cli-utils/pkg/inventory"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// KeepOnDeleteAnnotation set to "true" on an object stops it from being pruned, like the cli-utils
+// on-remove=keep annotation
+const KeepOnDeleteAnnotation = "addons.k8s.io/keep-on-delete"
+
+// Inventory identifies the inventory ConfigMaps in which the InventoryApplier records the applied objects
+type Inventory struct {
+	Namespace string
+	// Name is the prefix of the inventory ConfigMap names, which are suffixed with a hash of their contents
+	Name string
+	// ID is the value of the cli-utils inventory label, which must be unique to the set of objects
+	ID string
+}
+
+type inventoryKey struct{}
+
+// ContextWithInventory returns a context telling the InventoryApplier which inventory to use
+func ContextWithInventory(ctx context.Context, inventory Inventory) context.Context {
+	return context.WithValue(ctx, inventoryKey{}, inventory)
+}
+
+// InventoryFromContext returns the inventory set by ContextWithInventory
+func InventoryFromContext(ctx context.Context) (Inventory, bool) {
+	inventory, ok := ctx.Value(inventoryKey{}).(Inventory)
+	return inventory, ok
+}
+
+type protectedKindsKey struct{}
+
+// ContextWithProtectedKinds returns a context telling the InventoryApplier not to prune objects of the given kinds
+func ContextWithProtectedKinds(ctx context.Context, kinds []schema.GroupKind) context.Context {
+	return context.WithValue(ctx, protectedKindsKey{}, kinds)
+}
+
+// protectedKindsFromContext returns the kinds set by ContextWithProtectedKinds
+func protectedKindsFromContext(ctx context.Context) []schema.GroupKind {
+	kinds, _ := ctx.Value(protectedKindsKey{}).([]schema.GroupKind)
+	return kinds
+}
+
+type eventsKey struct{}
+
+// ContextWithEvents returns a context in which the InventoryApplier records its events, to be read with EventsFromContext
+func ContextWithEvents(ctx context.Context) context.Context {
+	return context.WithValue(ctx, eventsKey{}, &[]event.Event{})
+}
+
+// EventsFromContext returns the events recorded by the InventoryApplier in a context from ContextWithEvents
+func EventsFromContext(ctx context.Context) []event.Event {
+	events, _ := ctx.Value(eventsKey{}).(*[]event.Event)
+	if events == nil {
+		return nil
+	}
+	return *events
+}
+
+// InventoryApplier applies manifests with the cli-utils task runner, recording the applied objects in an inventory
+// ConfigMap of cli-utils, set with ContextWithInventory.  The objects and the inventory are applied with kubectl
+// apply, the applier waits for them to become current with the cli-utils StatusPoller if ReconcileTimeout is set,
+// then, when --prune is passed, deletes the objects of the previous inventories which are no longer applied, rather
+// than objects matching a label selector.  Without --prune, the previous inventories are kept, so that their objects
+// are pruned by a later apply.
+type InventoryApplier struct {
+	// ReconcileTimeout, if positive, waits up to ReconcileTimeout for the applied objects to become current
+	ReconcileTimeout time.Duration
+	// PollInterval is how often the status of the objects is polled while waiting, defaulting to 2s
+	PollInterval time.Duration
+	// OnEvent, if set, is called with each apply, prune, status and error event
+	OnEvent func(ctx context.Context, e event.Event)
+}
+
+func NewInventoryApplier() *InventoryApplier {
+	return &InventoryApplier{}
+}
+
+func (c *InventoryApplier) Apply(ctx context.Context,
+	namespace string,
+	manifest string,
+	validate bool,
+	extraArgs ...string,
+) error {
+	_, err := c.ApplyWithResults(ctx, namespace, manifest, validate, extraArgs...)
+	return err
+}
+
+// ApplyWithResults applies the manifest like Apply, also returning what was done with each object.
+// The results are returned even if the apply fails, as some objects may still have been applied.
+func (c *InventoryApplier) ApplyWithResults(ctx context.Context,
+	namespace string,
+	manifest string,
+	validate bool,
+	extraArgs ...string,
+) (*Results, error) {
+	inv, ok := InventoryFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no inventory was provided for the inventory applier")
+	}
+
+	factory := cmdutil.NewFactory(clientGetter(ctx, extraArgs))
+	inventoryTemplate, err := inventoryManifest(inv)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := factory.NewBuilder().
+		Unstructured().
+		NamespaceParam(namespace).DefaultNamespace().
+		Stream(strings.NewReader(manifest+"\n---\n"+inventoryTemplate), "manifestString").
+		Do().Infos()
+	if err != nil {
+		return nil, err
+	}
+	template, _ := inventory.FindInventoryObj(infos)
+	var resources []*resource.Info
+	for _, info := range infos {
+		if info != template {
+			resources = append(resources, info)
+		}
+	}
+	current, err := inventory.CreateInventoryObj(inventory.WrapInventoryObj(template), resources)
+	if err != nil {
+		return nil, fmt.Errorf("error building inventory: %v", err)
+	}
+	objects := append([]*resource.Info{current}, resources...)
+
+	ioStreams := genericclioptions.IOStreams{
+		In:     os.Stdin,
+		Out:    os.Stdout,
+		ErrOut: os.Stderr,
+	}
+	applyOpts, err := applyOptions(factory, ioStreams, validate, withoutPruneArgs(extraArgs))
+	if err != nil {
+		return nil, err
+	}
+	applyOpts.Namespace = namespace
+	// The objects are pruned by the prune task, from the inventory
+	applyOpts.PostProcessorFn = nil
+
+	tasks := make(chan taskrunner.Task, 3)
+	tasks <- &applyTask{options: applyOpts, objects: objects}
+	ids := object.InfosToObjMetas(objects)
+	if c.ReconcileTimeout > 0 {
+		tasks <- taskrunner.NewWaitTask(ids, taskrunner.AllCurrent, c.ReconcileTimeout)
+	}
+	if hasArg(extraArgs, "--prune") {
+		invClient, err := inventory.NewInventoryClient(factory)
+		if err != nil {
+			return nil, err
+		}
+		dynamicClient, err := factory.DynamicClient()
+		if err != nil {
+			return nil, err
+		}
+		mapper, err := factory.ToRESTMapper()
+		if err != nil {
+			return nil, err
+		}
+		tasks <- &pruneTask{
+			ctx:       ctx,
+			invClient: invClient,
+			client:    dynamicClient,
+			mapper:    mapper,
+			current:   current,
+			applied:   applyOpts.VisitedUids,
+		}
+	}
+
+	results := &Results{Operations: make(map[string]string)}
+	var errs []error
+	recorded, _ := ctx.Value(eventsKey{}).(*[]event.Event)
+	emit := func(e event.Event) {
+		if recorded != nil {
+			*recorded = append(*recorded, e)
+		}
+		if c.OnEvent != nil {
+			c.OnEvent(ctx, e)
+		}
+		if e.Type == event.ErrorType {
+			errs = append(errs, e.ErrorEvent.Err)
+		}
+		results.recordEvent(e)
+	}
+
+	events := make(chan event.Event)
+	done := make(chan error, 1)
+	go func() {
+		defer close(events)
+		if c.ReconcileTimeout <= 0 {
+			done <- taskrunner.NewTaskRunner().Run(ctx, tasks, events)
+			return
+		}
+		poller, err := statusPoller(factory)
+		if err != nil {
+			done <- err
+			return
+		}
+		pollInterval := c.PollInterval
+		if pollInterval == 0 {
+			pollInterval = 2 * time.Second
+		}
+		done <- taskrunner.NewTaskStatusRunner(ids, poller).Run(ctx, tasks, events, taskrunner.Options{
+			PollInterval:     pollInterval,
+			UseCache:         true,
+			EmitStatusEvents: true,
+		})
+	}()
+	for e := range events {
+		emit(e)
+	}
+	if err := <-done; err != nil {
+		if agg, ok := err.(utilerrors.Aggregate); ok {
+			for _, err := range agg.Errors() {
+				emit(errorEvent(err))
+			}
+		} else {
+			emit(errorEvent(err))
+		}
+	}
+	return results, utilerrors.NewAggregate(errs)
+}
+
+// statusPoller returns the cli-utils StatusPoller computing the kstatus of the objects
+func statusPoller(factory cmdutil.Factory) (poller.Poller, error) {
+	config, err := factory.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := factory.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := client.New(config, client.Options{Scheme: scheme.Scheme, Mapper: mapper})
+	if err != nil {
+		return nil, err
+	}
+	return polling.NewStatusPoller(reader, mapper), nil
+}
+
+// withoutPruneArgs returns args without the kubectl prune args, as the objects are pruned from the inventory
+func withoutPruneArgs(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--prune":
+		case arg == "--selector" || arg == "-l" || arg == "--prune-whitelist":
+			// The value is the next arg
+			i++
+		case strings.HasPrefix(arg, "--selector=") || strings.HasPrefix(arg, "--prune-whitelist="):
+		default:
+			out = append(out, arg)
+		}
+	}
+	return out
+}
+
+// applyTask applies the objects with kubectl apply, like the cli-utils ApplyTask, emitting an apply event for each
+type applyTask struct {
+	options *apply.ApplyOptions
+	objects []*resource.Info
+}
+
+var _ taskrunner.Task = &applyTask{}
+
+func (t *applyTask) Start(taskContext *taskrunner.TaskContext) {
+	go func() {
+		t.options.SetObjects(t.objects)
+		t.options.ToPrinter = func(operation string) (printers.ResourcePrinter, error) {
+			return printers.ResourcePrinterFunc(func(obj runtime.Object, _ io.Writer) error {
+				taskContext.EventChannel() <- event.Event{
+					Type: event.ApplyType,
+					ApplyEvent: event.ApplyEvent{
+						Type:      event.ApplyEventResourceUpdate,
+						Operation: applyOperation(operation),
+						Object:    obj,
+					},
+				}
+				return nil
+			}), nil
+		}
+		err := t.options.Run()
+		if err == nil {
+			// The wait task compares the generation of the objects with the one observed in their status
+			for _, info := range t.objects {
+				if accessor, err := meta.Accessor(info.Object); err == nil {
+					taskContext.ResourceApplied(object.InfoToObjMeta(info), accessor.GetGeneration())
+				}
+			}
+		}
+		taskContext.TaskChannel() <- taskrunner.TaskResult{Err: err}
+	}()
+}
+
+func (t *applyTask) ClearTimeout() {}
+
+// pruneTask deletes the objects of the previous inventories which weren't applied, then the previous inventories,
+// like the cli-utils PruneTask, whose prune package doesn't build against the client-go of this module.  Objects
+// annotated to be kept or of a protected kind are skipped.  The previous inventories are only deleted if all their
+// objects were pruned, so that the objects which failed are pruned by a later apply.
+type pruneTask struct {
+	ctx       context.Context
+	invClient inventory.InventoryClient
+	client    dynamic.Interface
+	mapper    meta.RESTMapper
+	// current is the inventory applied
+	current *resource.Info
+	// applied are the UIDs of the objects applied
+	applied sets.String
+}
+
+var _ taskrunner.Task = &pruneTask{}
+
+func (t *pruneTask) Start(taskContext *taskrunner.TaskContext) {
+	go func() {
+		taskContext.TaskChannel() <- taskrunner.TaskResult{Err: t.prune(taskContext.EventChannel())}
+	}()
+}
+
+func (t *pruneTask) ClearTimeout() {}
+
+func (t *pruneTask) prune(events chan<- event.Event) error {
+	ids, err := t.invClient.GetStoredObjRefs(t.current)
+	if err != nil {
+		return fmt.Errorf("error reading inventory: %v", err)
+	}
+
+	var errs []error
+	for _, id := range ids {
+		mapping, err := t.mapper.RESTMapping(id.GroupKind)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error pruning %s: %v", id.String(), err))
+			continue
+		}
+		var resourceClient dynamic.ResourceInterface = t.client.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			resourceClient = t.client.Resource(mapping.Resource).Namespace(id.Namespace)
+		}
+
+		obj, err := resourceClient.Get(t.ctx, id.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error pruning %s: %v", id.String(), err))
+			continue
+		}
+		if t.applied.Has(string(obj.GetUID())) {
+			continue
+		}
+
+		operation := event.Pruned
+		annotations := obj.GetAnnotations()
+		if annotations[common.OnRemoveAnnotation] == common.OnRemoveKeep || annotations[KeepOnDeleteAnnotation] == "true" ||
+			isProtectedKind(t.ctx, id.GroupKind) {
+			operation = event.PruneSkipped
+		} else {
+			propagation := metav1.DeletePropagationBackground
+			err := resourceClient.Delete(t.ctx, id.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("error pruning %s: %v", id.String(), err))
+				continue
+			}
+		}
+		events <- pruneEvent(obj, operation)
+	}
+	if len(errs) != 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	previous, err := t.invClient.GetPreviousInventoryObjects(t.current)
+	if err != nil {
+		return fmt.Errorf("error reading inventory: %v", err)
+	}
+	for _, info := range previous {
+		err := t.client.Resource(info.Mapping.Resource).Namespace(info.Namespace).Delete(t.ctx, info.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting previous inventory %s: %v", info.Name, err)
+		}
+		events <- pruneEvent(info.Object, event.Pruned)
+	}
+	return nil
+}
+
+// isProtectedKind returns true if objects of kind gk must not be pruned
+func isProtectedKind(ctx context.Context, gk schema.GroupKind) bool {
+	for _, k := range protectedKindsFromContext(ctx) {
+		if k == gk {
+			return true
+		}
+	}
+	return false
+}
+
+func pruneEvent(obj runtime.Object, operation event.PruneEventOperation) event.Event {
+	return event.Event{
+		Type: event.PruneType,
+		PruneEvent: event.PruneEvent{
+			Type:      event.PruneEventResourceUpdate,
+			Operation: operation,
+			Object:    obj,
+		},
+	}
+}
+
+// inventoryManifest returns the template of the inventory ConfigMaps
+func inventoryManifest(inv Inventory) (string, error) {
+	b, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      inv.Name,
+			"namespace": inv.Namespace,
+			"labels": map[string]interface{}{
+				common.InventoryLabel: inv.ID,
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error building inventory: %v", err)
+	}
+	return string(b), nil
+}
+
+func applyOperation(operation string) event.ApplyEventOperation {
+	switch operation {
+	case "created":
+		return event.Created
+	case "unchanged":
+		return event.Unchanged
+	case "serverside-applied":
+		return event.ServersideApplied
+	default:
+		return event.Configured
+	}
+}
+
+func errorEvent(err error) event.Event {
+	return event.Event{
+		Type:       event.ErrorType,
+		ErrorEvent: event.ErrorEvent{Err: err},
+	}
+}
+
+// recordEvent records the outcome of an apply, prune or error event, ignoring the inventory and status events
+func (r *Results) recordEvent(e event.Event) {
+	var obj runtime.Object
+	var operation string
+	switch e.Type {
+	case event.ErrorType:
+		r.Errors = append(r.Errors, e.ErrorEvent.Err.Error())
+		return
+	case event.ApplyType:
+		if e.ApplyEvent.Type != event.ApplyEventResourceUpdate {
+			return
+		}
+		obj = e.ApplyEvent.Object
+		switch e.ApplyEvent.Operation {
+		case event.Created:
+			operation = "created"
+		case event.Configured:
+			operation = "configured"
+		case event.Unchanged:
+			operation = "unchanged"
+		case event.ServersideApplied:
+			operation = "serverside-applied"
+		}
+	case event.PruneType:
+		if e.PruneEvent.Type != event.PruneEventResourceUpdate {
+			return
+		}
+		obj = e.PruneEvent.Object
+		switch e.PruneEvent.Operation {
+		case event.Pruned:
+			operation = "pruned"
+		case event.PruneSkipped:
+			operation = "prune-skipped"
+		}
+	default:
+		return
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil || operation == "" || inventory.IsInventoryObject(obj) {
+		return
+	}
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if r.Operations == nil {
+		r.Operations = make(map[string]string)
+	}
+	r.Operations[ObjectID(gvk.Group, gvk.Kind, accessor.GetName())] = operation
+}
+
+func hasArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
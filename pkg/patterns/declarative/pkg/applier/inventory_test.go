@@ -0,0 +1,166 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/cli-runtime/pkg/resource"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/cli-utils/pkg/apply/event"
+	"sigs.k8s.io/cli-utils/pkg/common"
+	"sigs.k8s.io/cli-utils/pkg/inventory"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+func newObject(group, kind, name string, labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(schema.GroupVersionKind{Group: group, Version: "v1", Kind: kind})
+	u.SetName(name)
+	u.SetLabels(labels)
+	return u
+}
+
+func TestRecordEvent(t *testing.T) {
+	events := []event.Event{
+		{Type: event.ApplyType, ApplyEvent: event.ApplyEvent{Operation: event.Created, Object: newObject("", "ConfigMap", "inventory-1234", map[string]string{common.InventoryLabel: "id"})}},
+		{Type: event.ApplyType, ApplyEvent: event.ApplyEvent{Operation: event.Configured, Object: newObject("apps", "Deployment", "app", nil)}},
+		{Type: event.ApplyType, ApplyEvent: event.ApplyEvent{Operation: event.Unchanged, Object: newObject("", "Service", "app", nil)}},
+		{Type: event.ApplyType, ApplyEvent: event.ApplyEvent{Type: event.ApplyEventCompleted}},
+		{Type: event.PruneType, PruneEvent: event.PruneEvent{Operation: event.Pruned, Object: newObject("", "ConfigMap", "old", nil)}},
+		{Type: event.PruneType, PruneEvent: event.PruneEvent{Operation: event.PruneSkipped, Object: newObject("", "Secret", "kept", nil)}},
+		{Type: event.ErrorType, ErrorEvent: event.ErrorEvent{Err: errors.New("error pruning configmap/other")}},
+	}
+
+	results := &Results{}
+	for _, e := range events {
+		results.recordEvent(e)
+	}
+
+	expected := &Results{
+		Operations: map[string]string{
+			"deployment.apps/app": "configured",
+			"service/app":         "unchanged",
+			"configmap/old":       "pruned",
+			"secret/kept":         "prune-skipped",
+		},
+		Errors: []string{"error pruning configmap/other"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %+v, got %+v", expected, results)
+	}
+}
+
+func TestPruneTask(t *testing.T) {
+	ctx := ContextWithProtectedKinds(context.Background(), []schema.GroupKind{{Kind: "PersistentVolumeClaim"}})
+	namespaced := func(kind, name string, annotations map[string]string) *unstructured.Unstructured {
+		u := newObject("", kind, name, nil)
+		u.SetNamespace("default")
+		u.SetUID(types.UID(name + "-uid"))
+		u.SetAnnotations(annotations)
+		return u
+	}
+	objects := []runtime.Object{
+		namespaced("ConfigMap", "applied", nil),
+		namespaced("ConfigMap", "removed", nil),
+		namespaced("Secret", "kept", map[string]string{KeepOnDeleteAnnotation: "true"}),
+		namespaced("PersistentVolumeClaim", "data", nil),
+	}
+	var ids []object.ObjMetadata
+	for _, o := range objects {
+		u := o.(*unstructured.Unstructured)
+		ids = append(ids, object.ObjMetadata{Namespace: "default", Name: u.GetName(), GroupKind: u.GroupVersionKind().GroupKind()})
+	}
+	// The object removed from the manifest of the previous inventory is already gone
+	ids = append(ids, object.ObjMetadata{Namespace: "default", Name: "gone", GroupKind: schema.GroupKind{Kind: "ConfigMap"}})
+
+	configMaps := &meta.RESTMapping{Resource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, Scope: meta.RESTScopeNamespace}
+	template := namespaced("ConfigMap", "inventory", nil)
+	template.SetLabels(map[string]string{common.InventoryLabel: "id"})
+	previous, err := inventory.CreateInventoryObj(inventory.WrapInventoryObj(&resource.Info{Object: template, Name: "inventory", Namespace: "default", Mapping: configMaps}), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	previousInventory := inventory.WrapInventoryObj(previous)
+	if err := previousInventory.Store(ids); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if previous, err = previousInventory.GetObject(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	objects = append(objects, previous.Object)
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	for _, kind := range []string{"ConfigMap", "Secret", "PersistentVolumeClaim"} {
+		mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: kind}, meta.RESTScopeNamespace)
+	}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	task := &pruneTask{
+		ctx:       ctx,
+		invClient: inventory.NewFakeInventoryClient([]*resource.Info{previous}),
+		client:    client,
+		mapper:    mapper,
+		applied:   sets.NewString("applied-uid"),
+	}
+
+	events := make(chan event.Event, 10)
+	if err := task.prune(events); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(events)
+	results := &Results{}
+	for e := range events {
+		results.recordEvent(e)
+	}
+	expected := map[string]string{
+		"configmap/removed":          "pruned",
+		"secret/kept":                "prune-skipped",
+		"persistentvolumeclaim/data": "prune-skipped",
+	}
+	if !reflect.DeepEqual(results.Operations, expected) {
+		t.Errorf("expected %v, got %v", expected, results.Operations)
+	}
+
+	for _, o := range objects {
+		u := o.(*unstructured.Unstructured)
+		resource := schema.GroupVersionResource{Version: "v1", Resource: strings.ToLower(u.GetKind()) + "s"}
+		_, err := client.Resource(resource).Namespace("default").Get(ctx, u.GetName(), metav1.GetOptions{})
+		deleted := apierrors.IsNotFound(err)
+		if expected := u.GetName() == "removed" || u.GetName() == previous.Name; deleted != expected {
+			t.Errorf("expected %s %s deleted %v, got error %v", u.GetKind(), u.GetName(), expected, err)
+		}
+	}
+}
+
+func TestWithoutPruneArgs(t *testing.T) {
+	args := []string{"--force", "--prune", "--selector", "app=test", "--prune-whitelist=core/v1/ConfigMap", "--server-side"}
+	if expected, got := []string{"--force", "--server-side"}, withoutPruneArgs(args); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
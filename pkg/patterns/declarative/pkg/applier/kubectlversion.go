@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	semver "github.com/blang/semver/v4"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// renamedFlag is the new name of a flag of kubectl apply, and the version of kubectl renaming it.  Later versions
+// still accept the old name, but hide it from the help and warn that it is deprecated.
+type renamedFlag struct {
+	name    string
+	version semver.Version
+}
+
+// renamedFlags are the flags of kubectl apply the reconciler passes that were renamed, by their old name
+var renamedFlags = map[string]renamedFlag{
+	"--prune-whitelist": {name: "--prune-allowlist", version: semver.Version{Major: 1, Minor: 26}},
+}
+
+// validationDirectiveVersion is the version of kubectl from which --validate takes strict, warn or ignore,
+// rather than true or false
+var validationDirectiveVersion = semver.Version{Major: 1, Minor: 25}
+
+// clientVersion returns the version of kubectl, detected the first time it is needed.  It returns nil if the version
+// can't be detected, in which case args are passed to kubectl unchanged.
+func (c *ExecKubectl) clientVersion(ctx context.Context) *semver.Version {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.versionDetected {
+		return c.version
+	}
+	v, err := c.detectVersion(ctx)
+	if err != nil {
+		log.FromContext(ctx).WithValues("kubectl", c.path).Error(err, "detecting kubectl version, passing flags unchanged")
+		if ctx.Err() != nil {
+			// Detect the version again next time, rather than giving up because this apply was cancelled
+			return nil
+		}
+	} else {
+		log.FromContext(ctx).WithValues("kubectl", c.path).WithValues("version", v.String()).V(2).Info("detected kubectl version")
+	}
+	c.version = v
+	c.versionDetected = true
+	return c.version
+}
+
+// detectVersion runs kubectl version to find the version of the kubectl client
+func (c *ExecKubectl) detectVersion(ctx context.Context) (*semver.Version, error) {
+	cmd := c.command(ctx, "version", "--client", "-o", "json")
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := c.cmdSite.Run(cmd); err != nil {
+		return nil, fmt.Errorf("error running %s version: %v: %s", cmd.Path, err, stderr.String())
+	}
+
+	var info struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return nil, fmt.Errorf("error parsing kubectl version %q: %v", stdout.String(), err)
+	}
+	v, err := semver.ParseTolerant(info.ClientVersion.GitVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing kubectl version %q: %v", info.ClientVersion.GitVersion, err)
+	}
+	return &v, nil
+}
+
+// atLeast returns whether v is at least the minor version min, ignoring patch versions and pre-releases such as
+// v1.26.0-rc.1 or v1.26.0-gke.100
+func atLeast(v *semver.Version, min semver.Version) bool {
+	return semver.Version{Major: v.Major, Minor: v.Minor}.GTE(min)
+}
+
+// compatibleArgs adapts args to the flags of version v of kubectl, so the same args can be passed to any version.
+// Renamed flags take their new name, and --validate takes strict or ignore rather than true or false.
+func compatibleArgs(v *semver.Version, args []string) []string {
+	if v == nil {
+		return args
+	}
+	compatible := make([]string, 0, len(args))
+	for _, arg := range args {
+		for old, renamed := range renamedFlags {
+			if !atLeast(v, renamed.version) {
+				continue
+			}
+			if arg == old || strings.HasPrefix(arg, old+"=") {
+				arg = renamed.name + strings.TrimPrefix(arg, old)
+			}
+		}
+		if atLeast(v, validationDirectiveVersion) {
+			switch arg {
+			case "--validate=true":
+				arg = "--validate=strict"
+			case "--validate=false":
+				arg = "--validate=ignore"
+			}
+		}
+		compatible = append(compatible, arg)
+	}
+	return compatible
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	semver "github.com/blang/semver/v4"
+)
+
+func TestCompatibleArgs(t *testing.T) {
+	args := []string{"apply", "--validate=true", "--prune", "--selector", "app=foo", "--prune-whitelist=core/v1/ConfigMap", "-f", "-"}
+	tests := []struct {
+		name     string
+		version  string
+		expected []string
+	}{
+		{name: "unknown version", expected: args},
+		{name: "1.20", version: "v1.20.1", expected: args},
+		{
+			name:     "1.25",
+			version:  "v1.25.4",
+			expected: []string{"apply", "--validate=strict", "--prune", "--selector", "app=foo", "--prune-whitelist=core/v1/ConfigMap", "-f", "-"},
+		},
+		{
+			name:     "1.26 pre-release",
+			version:  "v1.26.0-gke.100",
+			expected: []string{"apply", "--validate=strict", "--prune", "--selector", "app=foo", "--prune-allowlist=core/v1/ConfigMap", "-f", "-"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var v *semver.Version
+			if test.version != "" {
+				parsed := semver.MustParse(test.version[1:])
+				v = &parsed
+			}
+			if compatible := compatibleArgs(v, args); !reflect.DeepEqual(compatible, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, compatible)
+			}
+		})
+	}
+}
+
+func TestKubectlApplyDetectsVersion(t *testing.T) {
+	site := &helpSite{help: `{"clientVersion":{"major":"1","minor":"27","gitVersion":"v1.27.3"}}`}
+	kubectl := NewExec()
+	kubectl.cmdSite = site
+	if v := kubectl.clientVersion(context.Background()); v == nil || v.String() != "1.27.3" {
+		t.Fatalf("expected version 1.27.3, got %v", v)
+	}
+
+	// The version is only detected once
+	site.help = "not json"
+	if v := kubectl.clientVersion(context.Background()); v == nil || v.String() != "1.27.3" {
+		t.Errorf("expected the detected version to be kept, got %v", v)
+	}
+
+	kubectl = NewExec()
+	kubectl.cmdSite = site
+	if v := kubectl.clientVersion(context.Background()); v != nil {
+		t.Errorf("expected no version from unparseable output, got %v", v)
+	}
+}
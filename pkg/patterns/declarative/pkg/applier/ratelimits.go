@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"context"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+)
+
+// RateLimits are the client-side rate limits of the requests made to apply a manifest
+type RateLimits struct {
+	// QPS is the sustained rate of requests, if positive
+	QPS float32
+	// Burst is the number of requests allowed above QPS for a short time, if positive
+	Burst int
+}
+
+// Apply sets the limits on config, keeping the QPS or burst of config where the limit isn't positive
+func (l RateLimits) Apply(config *rest.Config) {
+	if l.QPS > 0 {
+		config.QPS = l.QPS
+	}
+	if l.Burst > 0 {
+		config.Burst = l.Burst
+	}
+}
+
+type rateLimitsKey struct{}
+
+// ContextWithRateLimits returns a context in which the DirectApplier and InventoryApplier make requests with limits,
+// rather than the defaults of client-go.  kubectl run by ExecKubectl keeps its own limits.
+func ContextWithRateLimits(ctx context.Context, limits RateLimits) context.Context {
+	return context.WithValue(ctx, rateLimitsKey{}, limits)
+}
+
+// clientGetter returns the getter of the clients for applying with args, rate limited as set by
+// ContextWithRateLimits
+func clientGetter(ctx context.Context, args []string) genericclioptions.RESTClientGetter {
+	flags := configFlags(args)
+	limits, ok := ctx.Value(rateLimitsKey{}).(RateLimits)
+	if !ok {
+		return flags
+	}
+	return &rateLimitedConfigFlags{ConfigFlags: flags, limits: limits}
+}
+
+// rateLimitedConfigFlags are ConfigFlags whose REST config has the QPS and burst of limits
+type rateLimitedConfigFlags struct {
+	*genericclioptions.ConfigFlags
+	limits RateLimits
+}
+
+func (f *rateLimitedConfigFlags) ToRESTConfig() (*rest.Config, error) {
+	config, err := f.ConfigFlags.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	f.limits.Apply(config)
+	return config, nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestClientGetterRateLimits(t *testing.T) {
+	kubeconfig, err := ioutil.TempFile("", "kubeconfig-")
+	if err != nil {
+		t.Fatalf("error creating kubeconfig: %v", err)
+	}
+	defer os.Remove(kubeconfig.Name())
+	if _, err := kubeconfig.WriteString(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: test
+  user:
+    token: test
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+`); err != nil {
+		t.Fatalf("error writing kubeconfig: %v", err)
+	}
+	kubeconfig.Close()
+	args := []string{KubeconfigArgPrefix + kubeconfig.Name()}
+
+	config, err := clientGetter(context.Background(), args).ToRESTConfig()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	if config.QPS != 0 || config.Burst != 0 {
+		t.Errorf("expected the client-go defaults, got QPS %v, burst %v", config.QPS, config.Burst)
+	}
+
+	ctx := ContextWithRateLimits(context.Background(), RateLimits{QPS: 50, Burst: 100})
+	config, err = clientGetter(ctx, args).ToRESTConfig()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	if config.QPS != 50 || config.Burst != 100 {
+		t.Errorf("expected QPS 50, burst 100, got QPS %v, burst %v", config.QPS, config.Burst)
+	}
+}
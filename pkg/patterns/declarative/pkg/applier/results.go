@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"strings"
+)
+
+// Results reports what kubectl apply did with each object
+type Results struct {
+	// Operations maps each object, identified by ObjectID, to the operation reported by kubectl,
+	// eg created, configured, unchanged or pruned
+	Operations map[string]string
+	// Errors holds the errors reported by kubectl
+	Errors []string
+}
+
+// ObjectID identifies an object the same way kubectl does in its output, eg deployment.apps/foo
+func ObjectID(group, kind, name string) string {
+	if group == "" {
+		return strings.ToLower(kind) + "/" + name
+	}
+	return strings.ToLower(kind) + "." + group + "/" + name
+}
+
+// parseApplyOutput records the operations printed by kubectl apply, one object per line,
+// eg "deployment.apps/foo created"
+func (r *Results) parseApplyOutput(out string) {
+	if r.Operations == nil {
+		r.Operations = make(map[string]string)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.Contains(fields[0], "/") {
+			continue
+		}
+		r.Operations[fields[0]] = fields[1]
+	}
+}
+
+// parseErrorOutput records the errors printed by kubectl, ignoring warnings
+func (r *Results) parseErrorOutput(out string) {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(strings.ToLower(line), "error") {
+			r.Errors = append(r.Errors, line)
+		}
+	}
+}
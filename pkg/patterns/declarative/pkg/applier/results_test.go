@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOutput(t *testing.T) {
+	stdout := `deployment.apps/app configured
+service/app unchanged
+configmap/config created
+configmap/old pruned
+`
+	stderr := `Warning: admissionregistration.k8s.io/v1beta1 ValidatingWebhookConfiguration is deprecated
+Error from server (Invalid): error when creating "STDIN": ValidatingWebhookConfiguration.admissionregistration.k8s.io "webhook" is invalid
+`
+
+	results := &Results{}
+	results.parseApplyOutput(stdout)
+	results.parseErrorOutput(stderr)
+
+	expected := &Results{
+		Operations: map[string]string{
+			"deployment.apps/app": "configured",
+			"service/app":         "unchanged",
+			"configmap/config":    "created",
+			"configmap/old":       "pruned",
+		},
+		Errors: []string{`Error from server (Invalid): error when creating "STDIN": ValidatingWebhookConfiguration.admissionregistration.k8s.io "webhook" is invalid`},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %+v, got %+v", expected, results)
+	}
+
+	if id := ObjectID("apps", "Deployment", "app"); id != "deployment.apps/app" {
+		t.Errorf("unexpected object id %q", id)
+	}
+	if id := ObjectID("", "Service", "app"); id != "service/app" {
+		t.Errorf("unexpected object id %q", id)
+	}
+}
@@ -0,0 +1,26 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applier
+
+const (
+	// ServerSideArg turns on server-side apply
+	ServerSideArg = "--server-side"
+	// ForceConflictsArg makes server-side apply take over fields managed by other field managers
+	ForceConflictsArg = "--force-conflicts"
+	// FieldManagerArgPrefix prefixes the name of the field manager used by server-side apply
+	FieldManagerArgPrefix = "--field-manager="
+)
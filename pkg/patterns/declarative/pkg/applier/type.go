@@ -4,6 +4,8 @@ import (
 	"context"
 )
 
+// Applier applies a manifest to a namespace, as kubectl apply does.  The reconciler uses it with
+// declarative.WithApplier.
 type Applier interface {
-	Applyx(ctx context.Context, namespace string, manifest string, validate bool, extraArgs ...string) error
+	Apply(ctx context.Context, namespace string, manifest string, validate bool, extraArgs ...string) error
 }
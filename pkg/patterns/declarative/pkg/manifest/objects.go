@@ -17,9 +17,11 @@ limitations under the License.
 package manifest
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 
@@ -27,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
 )
 
 // Objects holds a collection of objects, so that we can filter / sequence them
@@ -45,8 +48,52 @@ type Object struct {
 	Namespace string
 
 	json []byte
+
+	source Source
+}
+
+// Source is where an object was parsed from, to locate it in error messages
+type Source struct {
+	// Path is the path of the file of the manifest
+	Path string
+	// Index is the position of the object among the documents of the file, from 1
+	Index int
 }
 
+// String returns the location of the object, eg "object #12 in manifests/deployment.yaml", or "" if the file
+// isn't known, as the documents of a concatenated manifest are hard to count
+func (s Source) String() string {
+	if s.Path == "" || s.Index == 0 {
+		return ""
+	}
+	return fmt.Sprintf("object #%d in %s", s.Index, s.Path)
+}
+
+// Source returns where the object was parsed from
+func (o *Object) Source() Source {
+	return o.source
+}
+
+// SetSource records where the object was parsed from, eg when replacing an object with a patched copy
+func (o *Object) SetSource(source Source) {
+	o.source = source
+}
+
+// Describe returns a description of the object for error messages, with its location when it is known, eg
+// "object #12 in manifests/deployment.yaml (Deployment foo/bar)"
+func (o *Object) Describe() string {
+	s := o.Kind + " " + o.Name
+	if o.Namespace != "" {
+		s = o.Kind + " " + o.Namespace + "/" + o.Name
+	}
+	if location := o.source.String(); location != "" {
+		return location + " (" + s + ")"
+	}
+	return s
+}
+
+// ParseJSONToObject parses json into an Object.  The json isn't kept: JSON() encodes the object again, with sorted
+// keys, so that the output doesn't depend on the formatting of the input.
 func ParseJSONToObject(json []byte) (*Object, error) {
 	o, gvk, err := unstructured.UnstructuredJSONScheme.Decode(json, nil, nil)
 	if err != nil {
@@ -64,7 +111,6 @@ func ParseJSONToObject(json []byte) (*Object, error) {
 		Kind:      gvk.Kind,
 		Name:      u.GetName(),
 		Namespace: u.GetNamespace(),
-		json:      json,
 	}, nil
 }
 
@@ -83,6 +129,30 @@ func (o *Object) AddLabels(labels map[string]string) {
 	o.json = nil
 }
 
+// SetName sets metadata.name of the object
+func (o *Object) SetName(name string) {
+	o.object.SetName(name)
+	o.Name = name
+	// Invalidate cached json
+	o.json = nil
+}
+
+// SetAPIVersion sets the apiVersion of the object, eg to apply it with another version of its kind
+func (o *Object) SetAPIVersion(apiVersion string) {
+	o.object.SetAPIVersion(apiVersion)
+	o.Group = o.object.GroupVersionKind().Group
+	// Invalidate cached json
+	o.json = nil
+}
+
+// SetNamespace sets metadata.namespace of the object
+func (o *Object) SetNamespace(namespace string) {
+	o.object.SetNamespace(namespace)
+	o.Namespace = namespace
+	// Invalidate cached json
+	o.json = nil
+}
+
 func (o *Object) SetNestedStringMap(value map[string]string, fields ...string) error {
 	if o.object.Object == nil {
 		o.object.Object = make(map[string]interface{})
@@ -109,12 +179,20 @@ func nestedFieldNoCopy(obj map[string]interface{}, fields ...string) (interface{
 	return val, true, nil
 }
 
+// podSpecPath returns the path to the pod spec in the pod template of the object
+func (o *Object) podSpecPath() []string {
+	if o.Kind == "CronJob" {
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	return []string{"spec", "template", "spec"}
+}
+
 func (o *Object) MutateContainers(fn func(map[string]interface{}) error) error {
 	if o.object.Object == nil {
 		o.object.Object = make(map[string]interface{})
 	}
 
-	containers, found, err := nestedFieldNoCopy(o.object.Object, "spec", "template", "spec", "containers")
+	containers, found, err := nestedFieldNoCopy(o.object.Object, append(o.podSpecPath(), "containers")...)
 	if err != nil {
 		return fmt.Errorf("error reading containers: %v", err)
 	}
@@ -149,7 +227,7 @@ func (o *Object) MutatePodSpec(fn func(map[string]interface{}) error) error {
 		o.object.Object = make(map[string]interface{})
 	}
 
-	sp, found, err := nestedFieldNoCopy(o.object.Object, "spec", "template", "spec")
+	sp, found, err := nestedFieldNoCopy(o.object.Object, o.podSpecPath()...)
 	if err != nil {
 		return fmt.Errorf("error reading containers: %v", err)
 	}
@@ -171,6 +249,18 @@ func (o *Object) MutatePodSpec(fn func(map[string]interface{}) error) error {
 	return err
 }
 
+// MutateObject calls fn with the content of the object, to modify it in place
+func (o *Object) MutateObject(fn func(map[string]interface{}) error) error {
+	if o.object.Object == nil {
+		o.object.Object = make(map[string]interface{})
+	}
+	err := fn(o.object.Object)
+
+	// Invalidate cached json
+	o.json = nil
+	return err
+}
+
 func (o *Object) NestedStringMap(fields ...string) (map[string]string, bool, error) {
 	if o.object.Object == nil {
 		o.object.Object = make(map[string]interface{})
@@ -242,6 +332,19 @@ func (o *Object) JSON() ([]byte, error) {
 	return b, nil
 }
 
+// DeepCopy returns a copy of the object that can be mutated independently
+func (o *Object) DeepCopy() *Object {
+	return &Object{
+		object:    o.object.DeepCopy(),
+		Group:     o.Group,
+		Kind:      o.Kind,
+		Name:      o.Name,
+		Namespace: o.Namespace,
+		json:      o.json,
+		source:    o.source,
+	}
+}
+
 // UnstructuredContent exposes the raw object, primarily for testing
 func (o *Object) UnstructuredObject() *unstructured.Unstructured {
 	return o.object
@@ -255,6 +358,27 @@ func (o *Object) GroupVersionKind() schema.GroupVersionKind {
 	return o.object.GroupVersionKind()
 }
 
+// SetSourcePath records that the objects were parsed from the file at path
+func (o *Objects) SetSourcePath(path string) {
+	for _, item := range o.Items {
+		item.source.Path = path
+	}
+}
+
+// DeepCopy returns a copy of the objects that can be mutated independently
+func (o *Objects) DeepCopy() *Objects {
+	out := &Objects{Path: o.Path}
+	for _, item := range o.Items {
+		out.Items = append(out.Items, item.DeepCopy())
+	}
+	for _, blob := range o.Blobs {
+		out.Blobs = append(out.Blobs, append([]byte(nil), blob...))
+	}
+	return out
+}
+
+// JSONManifest returns the objects as JSON documents, in the order of Items.  The keys of each object are sorted, so
+// the same objects always give the same manifest.
 func (o *Objects) JSONManifest() (string, error) {
 	var b bytes.Buffer
 
@@ -274,69 +398,84 @@ func (o *Objects) JSONManifest() (string, error) {
 	return b.String(), nil
 }
 
-// Sort will order the items in Objects in order of score, group, kind, name.  The intent is to
+// YAMLManifest returns the objects as YAML documents separated by ---, in the order of Items, with sorted keys
+func (o *Objects) YAMLManifest() (string, error) {
+	var b bytes.Buffer
+
+	for i, item := range o.Items {
+		if i != 0 {
+			b.WriteString("\n---\n\n")
+		}
+		y, err := yaml.Marshal(item.object.Object)
+		if err != nil {
+			return "", fmt.Errorf("error building yaml: %v", err)
+		}
+		b.Write(y)
+	}
+
+	return b.String(), nil
+}
+
+// Sort will order the items in Objects in order of score, group, kind, namespace, name.  The intent is to
 // have a deterministic ordering in which Objects are applied.
 func (o *Objects) Sort(score func(o *Object) int) {
-	sort.Slice(o.Items, func(i, j int) bool {
-		iScore := score(o.Items[i])
-		jScore := score(o.Items[j])
-		return iScore < jScore ||
-			(iScore == jScore &&
-				o.Items[i].Group < o.Items[j].Group) ||
-			(iScore == jScore &&
-				o.Items[i].Group == o.Items[j].Group &&
-				o.Items[i].Kind < o.Items[j].Kind) ||
-			(iScore == jScore &&
-				o.Items[i].Group == o.Items[j].Group &&
-				o.Items[i].Kind == o.Items[j].Kind &&
-				o.Items[i].Name < o.Items[j].Name)
+	sort.SliceStable(o.Items, func(i, j int) bool {
+		a, b := o.Items[i], o.Items[j]
+		if aScore, bScore := score(a), score(b); aScore != bScore {
+			return aScore < bScore
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
 	})
 }
 
+// ParseObjects parses the objects of manifest.  Documents that can't be parsed as objects, eg a kustomization, are
+// kept as Blobs.
 func ParseObjects(ctx context.Context, manifest string) (*Objects, error) {
-	log := log.Log
-
-	var b bytes.Buffer
+	return ParseObjectsFromReader(ctx, strings.NewReader(manifest))
+}
 
-	var yamls []string
-	for _, line := range strings.Split(manifest, "\n") {
-		if line == "---" {
-			// yaml separator
-			yamls = append(yamls, b.String())
-			b.Reset()
-		} else {
-			b.WriteString(line)
-			b.WriteString("\n")
-		}
-	}
-	yamls = append(yamls, b.String())
+// ParseObjectsFromReader parses the objects of the manifest read from r, as ParseObjects.  The manifest is read one
+// document at a time, rather than split into a copy of every document up front.  Manifests are still loaded,
+// cached and rendered as strings before they are parsed, so this doesn't stream a manifest from its source.
+func ParseObjectsFromReader(ctx context.Context, r io.Reader) (*Objects, error) {
+	log := log.FromContext(ctx)
 
 	objects := &Objects{}
 
-	for _, yaml := range yamls {
-		// We need this so we don't error on a file that is commented out
-		// TODO: How does apimachinery avoid this problem?
-		hasContent := false
-		for _, line := range strings.Split(yaml, "\n") {
-			l := strings.TrimSpace(line)
-			if l != "" && !strings.HasPrefix(l, "#") {
-				hasContent = true
-				break
-			}
+	reader := &documentReader{reader: bufio.NewReader(r)}
+	index := 0
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading manifest: %v", err)
 		}
 
-		if !hasContent {
+		// We need this so we don't error on a file that is commented out
+		// TODO: How does apimachinery avoid this problem?
+		if !hasContent(doc) {
 			continue
 		}
+		index++
 
-		r := bytes.NewReader([]byte(yaml))
-		decoder := k8syaml.NewYAMLOrJSONDecoder(r, 1024)
+		decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(doc), 1024)
 
 		out := &unstructured.Unstructured{}
-		err := decoder.Decode(out)
-		if err != nil {
-			log.WithValues("error", err).WithValues("yaml", yaml).V(2).Info("Unable to parse into Unstructured, storing as blob")
-			objects.Blobs = append(objects.Blobs, []byte(yaml))
+		if err := decoder.Decode(out); err != nil {
+			log.WithValues("error", err).WithValues("yaml", string(doc)).V(2).Info("Unable to parse into Unstructured, storing as blob")
+			// Each document is read into a new buffer, so it can be kept without copying
+			objects.Blobs = append(objects.Blobs, doc)
 		} else {
 			// We don't reuse the manifest because it's probably yaml, and we want to use json
 			// json = yaml
@@ -344,14 +483,64 @@ func ParseObjects(ctx context.Context, manifest string) (*Objects, error) {
 			if err != nil {
 				return nil, err
 			}
+			o.source.Index = index
 			objects.Items = append(objects.Items, o)
 		}
-
 	}
 
 	return objects, nil
 }
 
+// documentReader reads the documents of a manifest, separated by --- lines
+type documentReader struct {
+	reader *bufio.Reader
+	done   bool
+}
+
+// Read returns the next document, with every line ending in a newline, or io.EOF after the last document
+func (d *documentReader) Read() ([]byte, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	var b bytes.Buffer
+	for {
+		line, err := d.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if err == io.EOF {
+			d.done = true
+		}
+		if string(line) == "---" {
+			// yaml separator
+			return b.Bytes(), nil
+		}
+		b.Write(line)
+		b.WriteString("\n")
+		if d.done {
+			return b.Bytes(), nil
+		}
+	}
+}
+
+// hasContent returns true if doc has a line that isn't blank or a comment
+func hasContent(doc []byte) bool {
+	for len(doc) != 0 {
+		line := doc
+		if i := bytes.IndexByte(doc, '\n'); i >= 0 {
+			line, doc = doc[:i], doc[i+1:]
+		} else {
+			doc = nil
+		}
+		l := bytes.TrimSpace(line)
+		if len(l) != 0 && l[0] != '#' {
+			return true
+		}
+	}
+	return false
+}
+
 func newObject(u *unstructured.Unstructured, json []byte) (*Object, error) {
 	o := &Object{
 		object: u,
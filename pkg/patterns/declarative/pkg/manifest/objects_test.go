@@ -2,6 +2,8 @@ package manifest
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -151,3 +153,168 @@ configMapGenerator:
 		})
 	}
 }
+
+func TestDeterministicManifest(t *testing.T) {
+	ctx := context.Background()
+
+	// The same objects, in a different order and with keys in a different order
+	a, err := ParseObjects(ctx, `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  namespace: b
+  name: config
+data:
+  z: "1"
+  a: "2"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: a
+`)
+	if err != nil {
+		t.Fatalf("error parsing objects: %v", err)
+	}
+	first, err := ParseJSONToObject([]byte(`{"metadata": {"namespace": "a", "name": "config"}, "kind": "ConfigMap", "apiVersion": "v1"}`))
+	if err != nil {
+		t.Fatalf("error parsing object: %v", err)
+	}
+	second, err := ParseJSONToObject([]byte(`{"apiVersion": "v1", "data": {"a": "2", "z": "1"}, "kind": "ConfigMap", "metadata": {"name": "config", "namespace": "b"}}`))
+	if err != nil {
+		t.Fatalf("error parsing object: %v", err)
+	}
+	b := &Objects{Items: []*Object{first, second}}
+
+	a.Sort(func(*Object) int { return 0 })
+	b.Sort(func(*Object) int { return 0 })
+
+	aJSON, err := a.JSONManifest()
+	if err != nil {
+		t.Fatalf("error building json manifest: %v", err)
+	}
+	bJSON, err := b.JSONManifest()
+	if err != nil {
+		t.Fatalf("error building json manifest: %v", err)
+	}
+	if aJSON != bJSON {
+		t.Errorf("expected the same json manifest; got\n%s\nand\n%s", aJSON, bJSON)
+	}
+
+	aYAML, err := a.YAMLManifest()
+	if err != nil {
+		t.Fatalf("error building yaml manifest: %v", err)
+	}
+	bYAML, err := b.YAMLManifest()
+	if err != nil {
+		t.Fatalf("error building yaml manifest: %v", err)
+	}
+	expected := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: a
+
+---
+
+apiVersion: v1
+data:
+  a: "2"
+  z: "1"
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: b
+`
+	if aYAML != expected || bYAML != expected {
+		t.Errorf("unexpected yaml manifest; got\n%s\nand\n%s\nwant\n%s", aYAML, bYAML, expected)
+	}
+}
+
+func TestParseObjectsFromReader(t *testing.T) {
+	ctx := context.Background()
+
+	var b strings.Builder
+	b.WriteString("# a commented out document\n---\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config-%d\ndata:\n  value: %q\n---\n", i, strings.Repeat("x", 10000))
+	}
+	b.WriteString("resources:\n\t- deployment.yaml")
+	manifest := b.String()
+
+	objects, err := ParseObjectsFromReader(ctx, strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("error parsing objects: %v", err)
+	}
+	if len(objects.Items) != 100 {
+		t.Fatalf("expected 100 objects, got %d", len(objects.Items))
+	}
+	if objects.Items[99].Name != "config-99" {
+		t.Errorf("expected last object to be config-99, got %s", objects.Items[99].Name)
+	}
+	if len(objects.Blobs) != 1 || string(objects.Blobs[0]) != "resources:\n\t- deployment.yaml\n" {
+		t.Errorf("unexpected blobs %q", objects.Blobs)
+	}
+
+	expected, err := ParseObjects(ctx, manifest)
+	if err != nil {
+		t.Fatalf("error parsing objects: %v", err)
+	}
+	expectedJSON, err := expected.JSONManifest()
+	if err != nil {
+		t.Fatalf("error building json manifest: %v", err)
+	}
+	actualJSON, err := objects.JSONManifest()
+	if err != nil {
+		t.Fatalf("error building json manifest: %v", err)
+	}
+	if actualJSON != expectedJSON {
+		t.Errorf("expected the same objects as ParseObjects")
+	}
+}
+
+func TestObjectSource(t *testing.T) {
+	objects, err := ParseObjects(context.Background(), `# the service account
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: foo-operator
+  namespace: kube-system
+---
+resources:
+- deployment.yaml
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo-operator
+  namespace: kube-system
+`)
+	if err != nil {
+		t.Fatalf("error parsing objects: %v", err)
+	}
+	deployment := objects.Items[1]
+	if deployment.Describe() != "Deployment kube-system/foo-operator" {
+		t.Errorf("unexpected description without a path %q", deployment.Describe())
+	}
+
+	objects.SetSourcePath("manifests/operator.yaml")
+	if source := objects.Items[0].Source(); source != (Source{Path: "manifests/operator.yaml", Index: 1}) {
+		t.Errorf("unexpected source %v", source)
+	}
+	expected := "object #3 in manifests/operator.yaml (Deployment kube-system/foo-operator)"
+	if deployment.Describe() != expected {
+		t.Errorf("expected description %q, got %q", expected, deployment.Describe())
+	}
+	if copied := deployment.DeepCopy(); copied.Describe() != expected {
+		t.Errorf("expected copies to keep the source, got %q", copied.Describe())
+	}
+	if err := deployment.ApplyJSONPatch([]byte(`[{"op": "add", "path": "/spec", "value": {}}]`)); err != nil {
+		t.Fatalf("error patching: %v", err)
+	}
+	if deployment.Describe() != expected {
+		t.Errorf("expected patched objects to keep the source, got %q", deployment.Describe())
+	}
+}
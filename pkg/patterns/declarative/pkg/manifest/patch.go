@@ -17,25 +17,28 @@ limitations under the License.
 package manifest
 
 import (
+	"encoding/json"
 	"fmt"
 
 	jsonpatch "github.com/evanphx/json-patch/v5"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
 )
 
 func (objects *Objects) Patch(patches []*unstructured.Unstructured) error {
 	log := log.Log
 
 	for i, o := range objects.Items {
-		log.WithValues("object", o).Info("applying patches")
+		log.WithValues("object", o).V(2).Info("applying patches")
 
 		patched, err := apply(o.UnstructuredObject(), patches)
 		if err != nil {
-			return fmt.Errorf("applying patch to object (%v): %e", o.UnstructuredObject().GetName(), err)
+			return fmt.Errorf("applying patch to %s: %v", o.Describe(), err)
 		}
 
 		log.WithValues("patched", patched).V(2).Info("applying patches")
@@ -44,6 +47,7 @@ func (objects *Objects) Patch(patches []*unstructured.Unstructured) error {
 		if err != nil {
 			return err
 		}
+		patchedObject.source = o.source
 		objects.Items[i] = patchedObject
 	}
 
@@ -63,46 +67,110 @@ func apply(base *unstructured.Unstructured, patches []*unstructured.Unstructured
 			continue
 		}
 
-		versionedObj, err := scheme.Scheme.New(base.GetObjectKind().GroupVersionKind())
-		switch {
-		case runtime.IsNotRegisteredError(err):
-			// Use JSON merge patch to handle types w/o schema
-			baseBytes, err := merged.MarshalJSON()
-			if err != nil {
-				return nil, err
-			}
-			patchBytes, err := p.MarshalJSON()
-			if err != nil {
-				return nil, err
-			}
-			mergedBytes, err := jsonpatch.MergePatch(baseBytes, patchBytes)
-			if err != nil {
-				return nil, err
-			}
-			err = merged.UnmarshalJSON(mergedBytes)
-			if err != nil {
-				return nil, err
-			}
-		case err != nil:
+		patched, err := strategicMergePatch(merged.Object, p.Object, base.GetObjectKind().GroupVersionKind())
+		if err != nil {
 			return nil, err
-		default:
-			// Use Strategic-Merge-Patch to handle types w/ schema
-			// TODO: Change this to use the new Merge package.
-			// Store the name of the base object, because this name may have been munged.
-			// Apply this name to the patched object.
-			lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versionedObj)
-			if err != nil {
-				return nil, err
-			}
-			merged.Object, err = strategicpatch.StrategicMergeMapPatchUsingLookupPatchMeta(
-				merged.Object,
-				p.Object,
-				lookupPatchMeta)
-			if err != nil {
-				return nil, err
-			}
 		}
+		merged.Object = patched
 	}
 
 	return merged, nil
 }
+
+// strategicMergePatch applies patch to base with a strategic merge patch, using the schema of the type gvk, or with
+// a JSON merge patch if gvk has no schema, eg for custom resources
+func strategicMergePatch(base, patch map[string]interface{}, gvk schema.GroupVersionKind) (map[string]interface{}, error) {
+	versionedObj, err := scheme.Scheme.New(gvk)
+	switch {
+	case runtime.IsNotRegisteredError(err):
+		// Use JSON merge patch to handle types w/o schema
+		baseBytes, err := json.Marshal(base)
+		if err != nil {
+			return nil, err
+		}
+		patchBytes, err := json.Marshal(patch)
+		if err != nil {
+			return nil, err
+		}
+		mergedBytes, err := jsonpatch.MergePatch(baseBytes, patchBytes)
+		if err != nil {
+			return nil, err
+		}
+		merged := make(map[string]interface{})
+		if err := json.Unmarshal(mergedBytes, &merged); err != nil {
+			return nil, err
+		}
+		return merged, nil
+	case err != nil:
+		return nil, err
+	default:
+		// Use Strategic-Merge-Patch to handle types w/ schema
+		// TODO: Change this to use the new Merge package.
+		lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versionedObj)
+		if err != nil {
+			return nil, err
+		}
+		return strategicpatch.StrategicMergeMapPatchUsingLookupPatchMeta(base, patch, lookupPatchMeta)
+	}
+}
+
+// ApplyJSONPatch applies the JSON patch (RFC 6902) patch, in JSON or YAML, to the object, eg
+// [{"op": "replace", "path": "/spec/replicas", "value": 3}]
+func (o *Object) ApplyJSONPatch(patch []byte) error {
+	patchJSON, err := yaml.YAMLToJSON(patch)
+	if err != nil {
+		return fmt.Errorf("error parsing patch: %v", err)
+	}
+	decoded, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return fmt.Errorf("error parsing patch: %v", err)
+	}
+	base, err := o.JSON()
+	if err != nil {
+		return fmt.Errorf("error building json: %v", err)
+	}
+	patched, err := decoded.Apply(base)
+	if err != nil {
+		return fmt.Errorf("error applying patch to %s: %v", o.Describe(), err)
+	}
+	return o.replaceContent(patched)
+}
+
+// ApplyStrategicMergePatch applies the strategic merge patch patch, in JSON or YAML, to the object, merging lists
+// using the schema of the built-in type gvk, usually the kind of the object.  A JSON merge patch (RFC 7386) is
+// applied instead if gvk isn't a built-in type.
+func (o *Object) ApplyStrategicMergePatch(patch []byte, gvk schema.GroupVersionKind) error {
+	patchMap := make(map[string]interface{})
+	if err := yaml.Unmarshal(patch, &patchMap); err != nil {
+		return fmt.Errorf("error parsing patch: %v", err)
+	}
+	if o.object.Object == nil {
+		o.object.Object = make(map[string]interface{})
+	}
+	patched, err := strategicMergePatch(o.object.Object, patchMap, gvk)
+	if err != nil {
+		return fmt.Errorf("error applying patch to %s: %v", o.Describe(), err)
+	}
+	b, err := json.Marshal(patched)
+	if err != nil {
+		return fmt.Errorf("error building json: %v", err)
+	}
+	return o.replaceContent(b)
+}
+
+// replaceContent replaces the content of the object with the json j
+func (o *Object) replaceContent(j []byte) error {
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(j); err != nil {
+		return fmt.Errorf("error parsing patched object: %v", err)
+	}
+	o.object = u
+	gvk := u.GroupVersionKind()
+	o.Group = gvk.Group
+	o.Kind = gvk.Kind
+	o.Name = u.GetName()
+	o.Namespace = u.GetNamespace()
+	// Invalidate cached json
+	o.json = nil
+	return nil
+}
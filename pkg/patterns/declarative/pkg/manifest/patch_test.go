@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
 )
 
@@ -218,3 +219,140 @@ spec:
 	}
 
 }
+
+func Test_ObjectPatches(t *testing.T) {
+	deploymentGVK := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	base := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: php-redis
+        image: gcr.io/google-samples/gb-frontend:v4
+      - name: sidecar
+        image: sidecar:v1
+`
+	var testcases = []struct {
+		name     string
+		patch    func(o *manifest.Object) error
+		expected string
+	}{
+		{
+			name: "json patch",
+			patch: func(o *manifest.Object) error {
+				return o.ApplyJSONPatch([]byte(`
+- op: replace
+  path: /spec/replicas
+  value: 3
+- op: remove
+  path: /spec/template/spec/containers/1
+- op: replace
+  path: /metadata/name
+  value: frontend-v2
+`))
+			},
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend-v2
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: php-redis
+        image: gcr.io/google-samples/gb-frontend:v4
+`,
+		},
+		{
+			name: "strategic merge patch merges containers by name",
+			patch: func(o *manifest.Object) error {
+				return o.ApplyStrategicMergePatch([]byte(`{"spec": {"template": {"spec": {"containers": [{"name": "sidecar", "image": "sidecar:v2"}]}}}}`), deploymentGVK)
+			},
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: php-redis
+        image: gcr.io/google-samples/gb-frontend:v4
+      - name: sidecar
+        image: sidecar:v2
+`,
+		},
+		{
+			name: "merge patch for types without schema replaces lists",
+			patch: func(o *manifest.Object) error {
+				return o.ApplyStrategicMergePatch([]byte(`
+spec:
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: sidecar:v2
+`), schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Frontend"})
+			},
+			expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: sidecar:v2
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			objects, err := manifest.ParseObjects(ctx, base)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			expected, err := manifest.ParseObjects(ctx, tc.expected)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			o := objects.Items[0]
+			// Cache the json, to check it is invalidated
+			if _, err := o.JSON(); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if err := tc.patch(o); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			actualBytes, err := o.JSON()
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			expectedBytes, err := expected.Items[0].JSON()
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if string(expectedBytes) != string(actualBytes) {
+				t.Fatalf("unexpected result, expected ========\n%s\n\nactual ========\n%s\n", expectedBytes, actualBytes)
+			}
+			if o.Name != expected.Items[0].Name {
+				t.Errorf("expected name %q, got %q", expected.Items[0].Name, o.Name)
+			}
+		})
+	}
+}
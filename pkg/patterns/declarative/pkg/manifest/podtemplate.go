@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"fmt"
+)
+
+// HasPodTemplate returns true if the object is a workload with a pod template: a Deployment, DaemonSet,
+// StatefulSet, Job or CronJob
+func (o *Object) HasPodTemplate() bool {
+	switch o.Kind {
+	case "Deployment", "DaemonSet", "StatefulSet", "Job", "CronJob":
+		return true
+	}
+	return false
+}
+
+// podTemplatePath returns the path to the pod template of the object
+func (o *Object) podTemplatePath() []string {
+	if o.Kind == "CronJob" {
+		return []string{"spec", "jobTemplate", "spec", "template"}
+	}
+	return []string{"spec", "template"}
+}
+
+// mutateContainer calls fn with the container or init container of the pod template named container
+func (o *Object) mutateContainer(container string, fn func(map[string]interface{}) error) error {
+	if !o.HasPodTemplate() {
+		return fmt.Errorf("%s has no pod template", o.Describe())
+	}
+	found := false
+	err := o.MutatePodSpec(func(podSpec map[string]interface{}) error {
+		for _, field := range []string{"containers", "initContainers"} {
+			containers, ok := podSpec[field].([]interface{})
+			if !ok {
+				continue
+			}
+			for _, c := range containers {
+				m, ok := c.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("container was not an object")
+				}
+				if m["name"] != container {
+					continue
+				}
+				found = true
+				return fn(m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("container %q not found in %s", container, o.Describe())
+	}
+	return nil
+}
+
+// SetImage sets the image of the container named container in the pod template
+func (o *Object) SetImage(container string, image string) error {
+	return o.mutateContainer(container, func(c map[string]interface{}) error {
+		c["image"] = image
+		return nil
+	})
+}
+
+// SetEnvVar sets the environment variable name of the container named container in the pod template to value,
+// replacing any existing value, including one from valueFrom
+func (o *Object) SetEnvVar(container string, name string, value string) error {
+	return o.mutateContainer(container, func(c map[string]interface{}) error {
+		env, _ := c["env"].([]interface{})
+		for _, e := range env {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("env var was not an object")
+			}
+			if m["name"] == name {
+				delete(m, "valueFrom")
+				m["value"] = value
+				return nil
+			}
+		}
+		c["env"] = append(env, map[string]interface{}{"name": name, "value": value})
+		return nil
+	})
+}
+
+// AddVolume adds volume, eg {"name": "config", "configMap": {"name": "config"}}, to the pod template, replacing
+// any volume of the same name
+func (o *Object) AddVolume(volume map[string]interface{}) error {
+	name, ok := volume["name"].(string)
+	if !ok || name == "" {
+		return fmt.Errorf("volume must have a name")
+	}
+	if !o.HasPodTemplate() {
+		return fmt.Errorf("%s has no pod template", o.Describe())
+	}
+	return o.MutatePodSpec(func(podSpec map[string]interface{}) error {
+		volumes, _ := podSpec["volumes"].([]interface{})
+		for i, v := range volumes {
+			if m, ok := v.(map[string]interface{}); ok && m["name"] == name {
+				volumes[i] = volume
+				return nil
+			}
+		}
+		podSpec["volumes"] = append(volumes, volume)
+		return nil
+	})
+}
+
+// AddVolumeMount mounts the volume named volume at mountPath in the container named container in the pod template,
+// replacing any mount at the same path
+func (o *Object) AddVolumeMount(container string, volume string, mountPath string) error {
+	return o.mutateContainer(container, func(c map[string]interface{}) error {
+		mount := map[string]interface{}{"name": volume, "mountPath": mountPath}
+		mounts, _ := c["volumeMounts"].([]interface{})
+		for i, m := range mounts {
+			if m, ok := m.(map[string]interface{}); ok && m["mountPath"] == mountPath {
+				mounts[i] = mount
+				return nil
+			}
+		}
+		c["volumeMounts"] = append(mounts, mount)
+		return nil
+	})
+}
+
+// AddAnnotation sets the annotation key of the object to value
+func (o *Object) AddAnnotation(key string, value string) {
+	annotations := o.object.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[key] = value
+	o.object.SetAnnotations(annotations)
+	// Invalidate cached json
+	o.json = nil
+}
+
+// AddPodAnnotation sets the annotation key of the pod template to value, eg to roll the pods when a config changes
+func (o *Object) AddPodAnnotation(key string, value string) error {
+	if !o.HasPodTemplate() {
+		return fmt.Errorf("%s has no pod template", o.Describe())
+	}
+	fields := append(o.podTemplatePath(), "metadata", "annotations")
+	annotations, _, err := o.NestedStringMap(fields...)
+	if err != nil {
+		return fmt.Errorf("error reading pod annotations: %v", err)
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[key] = value
+	return o.SetNestedStringMap(annotations, fields...)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestPodTemplateMutations(t *testing.T) {
+	objects, err := ParseObjects(context.Background(), `
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+          - name: init
+            image: busybox
+          containers:
+          - name: backup
+            image: backup:v1
+            env:
+            - name: TARGET
+              valueFrom:
+                secretKeyRef:
+                  name: target
+                  key: url
+          volumes:
+          - name: data
+            emptyDir: {}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`)
+	if err != nil {
+		t.Fatalf("error parsing objects: %v", err)
+	}
+	cronJob, configMap := objects.Items[0], objects.Items[1]
+
+	if !cronJob.HasPodTemplate() {
+		t.Errorf("expected CronJob to have a pod template")
+	}
+	if configMap.HasPodTemplate() {
+		t.Errorf("expected ConfigMap not to have a pod template")
+	}
+
+	// Cache the json, to check it is invalidated
+	if _, err := cronJob.JSON(); err != nil {
+		t.Fatalf("error building json: %v", err)
+	}
+
+	if err := cronJob.SetImage("backup", "backup:v2"); err != nil {
+		t.Fatalf("SetImage failed: %v", err)
+	}
+	if err := cronJob.SetImage("init", "busybox:1.33"); err != nil {
+		t.Fatalf("SetImage failed: %v", err)
+	}
+	if err := cronJob.SetEnvVar("backup", "TARGET", "s3://backups"); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+	if err := cronJob.SetEnvVar("backup", "VERBOSE", "true"); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+	if err := cronJob.AddVolume(map[string]interface{}{"name": "config", "configMap": map[string]interface{}{"name": "config"}}); err != nil {
+		t.Fatalf("AddVolume failed: %v", err)
+	}
+	if err := cronJob.AddVolumeMount("backup", "config", "/etc/backup"); err != nil {
+		t.Fatalf("AddVolumeMount failed: %v", err)
+	}
+	if err := cronJob.AddPodAnnotation("checksum/config", "abc"); err != nil {
+		t.Fatalf("AddPodAnnotation failed: %v", err)
+	}
+	cronJob.AddAnnotation("owner", "platform")
+
+	if err := cronJob.SetImage("missing", "foo"); err == nil {
+		t.Errorf("expected error setting the image of a missing container")
+	}
+	if err := configMap.SetEnvVar("backup", "FOO", "bar"); err == nil {
+		t.Errorf("expected error setting an env var of a ConfigMap")
+	}
+	if err := configMap.AddPodAnnotation("foo", "bar"); err == nil {
+		t.Errorf("expected error annotating the pods of a ConfigMap")
+	}
+
+	j, err := cronJob.JSON()
+	if err != nil {
+		t.Fatalf("error building json: %v", err)
+	}
+	actual, err := yaml.JSONToYAML(j)
+	if err != nil {
+		t.Fatalf("error converting to yaml: %v", err)
+	}
+
+	expected := `
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  annotations:
+    owner: platform
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          annotations:
+            checksum/config: abc
+        spec:
+          containers:
+          - env:
+            - name: TARGET
+              value: s3://backups
+            - name: VERBOSE
+              value: "true"
+            image: backup:v2
+            name: backup
+            volumeMounts:
+            - mountPath: /etc/backup
+              name: config
+          initContainers:
+          - image: busybox:1.33
+            name: init
+          volumes:
+          - emptyDir: {}
+            name: data
+          - configMap:
+              name: config
+            name: config
+`
+	if strings.TrimSpace(string(actual)) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected result; got\n%s\nwant\n%s", actual, expected)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// FindByGVKN returns the object of kind gvk with the given namespace and name, or nil if there is none.  The
+// version of the object is only compared if gvk has a version.
+func (o *Objects) FindByGVKN(gvk schema.GroupVersionKind, namespace string, name string) *Object {
+	for _, item := range o.Items {
+		if item.Group != gvk.Group || item.Kind != gvk.Kind || item.Namespace != namespace || item.Name != name {
+			continue
+		}
+		if gvk.Version != "" && item.GroupVersionKind().Version != gvk.Version {
+			continue
+		}
+		return item
+	}
+	return nil
+}
+
+// Filter returns the objects for which predicate is true, in order.  The objects are not copied.
+func (o *Objects) Filter(predicate func(*Object) bool) []*Object {
+	var matches []*Object
+	for _, item := range o.Items {
+		if predicate(item) {
+			matches = append(matches, item)
+		}
+	}
+	return matches
+}
+
+// FilterByKind returns the objects of kind gk, in order
+func (o *Objects) FilterByKind(gk schema.GroupKind) []*Object {
+	return o.Filter(func(item *Object) bool {
+		return item.Group == gk.Group && item.Kind == gk.Kind
+	})
+}
+
+// GroupByNamespace returns the objects by namespace, in order.  Cluster-scoped objects, and namespaced objects
+// with no namespace, are under "".
+func (o *Objects) GroupByNamespace() map[string][]*Object {
+	groups := make(map[string][]*Object)
+	for _, item := range o.Items {
+		groups[item.Namespace] = append(groups[item.Namespace], item)
+	}
+	return groups
+}
+
+// Remove removes the objects for which predicate is true, keeping the order of the others, and returns the
+// removed objects
+func (o *Objects) Remove(predicate func(*Object) bool) []*Object {
+	var kept, removed []*Object
+	for _, item := range o.Items {
+		if predicate(item) {
+			removed = append(removed, item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	o.Items = kept
+	return removed
+}
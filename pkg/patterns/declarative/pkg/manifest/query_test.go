@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func names(objects []*Object) []string {
+	var out []string
+	for _, o := range objects {
+		out = append(out, o.Kind+"/"+o.Name)
+	}
+	return out
+}
+
+func TestObjectsQueries(t *testing.T) {
+	objects, err := ParseObjects(context.Background(), `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: guestbook
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  namespace: guestbook
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  namespace: guestbook
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: redis
+  namespace: cache
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+	if found := objects.FindByGVKN(deployment, "guestbook", "frontend"); found == nil || found.Kind != "Deployment" {
+		t.Errorf("expected to find the frontend Deployment, got %v", found)
+	}
+	if found := objects.FindByGVKN(schema.GroupVersionKind{Group: "apps", Kind: "Deployment"}, "cache", "redis"); found == nil {
+		t.Errorf("expected to find the redis Deployment without a version")
+	}
+	if found := objects.FindByGVKN(schema.GroupVersionKind{Group: "apps", Version: "v1beta1", Kind: "Deployment"}, "cache", "redis"); found != nil {
+		t.Errorf("unexpected object of another version %v", found)
+	}
+	if found := objects.FindByGVKN(deployment, "default", "frontend"); found != nil {
+		t.Errorf("unexpected object in another namespace %v", found)
+	}
+
+	if got := names(objects.FilterByKind(deployment.GroupKind())); !reflect.DeepEqual(got, []string{"Deployment/frontend", "Deployment/redis"}) {
+		t.Errorf("unexpected Deployments %v", got)
+	}
+
+	groups := objects.GroupByNamespace()
+	if got := names(groups["guestbook"]); !reflect.DeepEqual(got, []string{"Deployment/frontend", "Service/frontend"}) {
+		t.Errorf("unexpected objects in guestbook %v", got)
+	}
+	if got := names(groups[""]); !reflect.DeepEqual(got, []string{"Namespace/guestbook"}) {
+		t.Errorf("unexpected cluster-scoped objects %v", got)
+	}
+
+	removed := objects.Remove(func(o *Object) bool { return o.Name == "frontend" })
+	if got := names(removed); !reflect.DeepEqual(got, []string{"Deployment/frontend", "Service/frontend"}) {
+		t.Errorf("unexpected removed objects %v", got)
+	}
+	if got := names(objects.Items); !reflect.DeepEqual(got, []string{"Namespace/guestbook", "Deployment/redis"}) {
+		t.Errorf("unexpected remaining objects %v", got)
+	}
+}
@@ -19,6 +19,7 @@ package watch
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -56,23 +57,54 @@ func NewDynamicWatch(config rest.Config) (*dynamicWatch, chan event.GenericEvent
 }
 
 type dynamicWatch struct {
-	config     rest.Config
-	client     dynamic.Interface
+	config rest.Config
+	client dynamic.Interface
+	events chan event.GenericEvent
+
+	// mutex protects restMapper, which is replaced when new API types are discovered
+	mutex      sync.Mutex
 	restMapper meta.RESTMapper
-	events     chan event.GenericEvent
 }
 
-func (dw *dynamicWatch) newDynamicClient(gvk schema.GroupVersionKind) (dynamic.ResourceInterface, error) {
-	mapping, err := dw.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+// newDynamicClient returns a client for gvk, in namespace if it is set and gvk is namespaced
+func (dw *dynamicWatch) newDynamicClient(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := dw.restMapping(gvk)
 	if err != nil {
 		return nil, err
 	}
+	if namespace != "" && mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return dw.client.Resource(mapping.Resource).Namespace(namespace), nil
+	}
 	return dw.client.Resource(mapping.Resource), nil
 }
 
+// restMapping maps gvk to a resource, rediscovering the API types if gvk is not known,
+// as it may have been added by a CRD or APIService since the mapper was created
+func (dw *dynamicWatch) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+
+	mapping, err := dw.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err == nil || !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+
+	restMapper, discoveryErr := apiutil.NewDiscoveryRESTMapper(&dw.config)
+	if discoveryErr != nil {
+		return nil, fmt.Errorf("refreshing discovery after %v: %v", err, discoveryErr)
+	}
+	dw.restMapper = restMapper
+	return dw.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
 // Add registers a watch for changes to 'trigger' filtered by 'options' to raise an event on 'target'
 func (dw *dynamicWatch) Add(trigger schema.GroupVersionKind, options metav1.ListOptions, target metav1.ObjectMeta) error {
-	client, err := dw.newDynamicClient(trigger)
+	return dw.AddNamespaced(trigger, options, "", target)
+}
+
+// AddNamespaced is Add, but if 'filterNamespace' is set, namespaced kinds are only watched in that namespace
+func (dw *dynamicWatch) AddNamespaced(trigger schema.GroupVersionKind, options metav1.ListOptions, filterNamespace string, target metav1.ObjectMeta) error {
+	client, err := dw.newDynamicClient(trigger, filterNamespace)
 	if err != nil {
 		return fmt.Errorf("creating client for (%s): %v", trigger.String(), err)
 	}
@@ -112,17 +144,17 @@ func (dw *dynamicWatch) watchUntilClosed(client dynamic.ResourceInterface, trigg
 		return
 	}
 
-	log.WithValues("kind", trigger.String()).WithValues("namespace", target.Namespace).WithValues("labels", options.LabelSelector).Info("watch began")
+	log.WithValues("kind", trigger.String()).WithValues("namespace", target.Namespace).WithValues("labels", options.LabelSelector).V(1).Info("watch began")
 
 	// Always clean up watchers
 	defer events.Stop()
 
 	for clientEvent := range events.ResultChan() {
-		log.WithValues("type", clientEvent.Type).WithValues("kind", trigger.String()).Info("broadcasting event")
+		log.WithValues("type", clientEvent.Type).WithValues("kind", trigger.String()).V(2).Info("broadcasting event")
 		dw.events <- event.GenericEvent{Object: clientObject{Object: clientEvent.Object, ObjectMeta: &target}}
 	}
 
-	log.WithValues("kind", trigger.String()).WithValues("namespace", target.Namespace).WithValues("labels", options.LabelSelector).Info("watch closed")
+	log.WithValues("kind", trigger.String()).WithValues("namespace", target.Namespace).WithValues("labels", options.LabelSelector).V(1).Info("watch closed")
 
 	return
 }
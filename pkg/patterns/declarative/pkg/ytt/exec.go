@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ytt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// valuesFileName is the name of the generated data values file passed to ytt
+const valuesFileName = "zz-declarative-values.yaml"
+
+// NewExec creates a Renderer that runs ytt available on the path
+func NewExec() *ExecYtt {
+	return &ExecYtt{cmdSite: &console{}}
+}
+
+// ExecYtt renders ytt templates and overlays by running the ytt binary
+type ExecYtt struct {
+	cmdSite commandSite
+}
+
+// commandSite allows for tests to mock cmd.Run() events
+type commandSite interface {
+	Run(*exec.Cmd) error
+}
+type console struct {
+}
+
+func (console) Run(c *exec.Cmd) error {
+	return c.Run()
+}
+
+// Render runs ytt over all the files, with values provided as data values.
+// The files are keyed by path, and are rendered together so that overlays apply across files.
+// The result is a single yaml stream.
+func (c *ExecYtt) Render(ctx context.Context, files map[string]string, values map[string]interface{}) (string, error) {
+	log := log.FromContext(ctx)
+
+	dir, err := ioutil.TempDir("", "ytt")
+	if err != nil {
+		return "", fmt.Errorf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	args := []string{}
+	for i, p := range paths {
+		// Prefix with the index so files with the same base name don't collide
+		dest := filepath.Join(dir, fmt.Sprintf("%03d-%s", i, filepath.Base(p)))
+		if err := ioutil.WriteFile(dest, []byte(files[p]), 0644); err != nil {
+			return "", fmt.Errorf("error writing file %s: %v", dest, err)
+		}
+		args = append(args, "-f", dest)
+	}
+
+	if values != nil {
+		b, err := yaml.Marshal(values)
+		if err != nil {
+			return "", fmt.Errorf("error building data values: %v", err)
+		}
+		dest := filepath.Join(dir, valuesFileName)
+		// The values overlay the data values the templates declare, and may add keys they don't declare, such as
+		// fields of a spec the templates don't use
+		valuesFile := "#@data/values\n#@overlay/match-child-defaults missing_ok=True\n---\n" + string(b)
+		if err := ioutil.WriteFile(dest, []byte(valuesFile), 0644); err != nil {
+			return "", fmt.Errorf("error writing data values: %v", err)
+		}
+		args = append(args, "-f", dest)
+	}
+
+	cmd := exec.CommandContext(ctx, "ytt", args...)
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.WithValues("command", "ytt").WithValues("args", args).V(1).Info("executing ytt")
+
+	if err := c.cmdSite.Run(cmd); err != nil {
+		log.WithValues("stderr", stderr.String()).Error(err, "error from running ytt")
+		return "", fmt.Errorf("error from running ytt: %v: %s", err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ytt
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// collector is a commandSite implementation that stubs cmd.Run() calls for tests,
+// capturing the contents of the files passed to ytt
+type collector struct {
+	Error  error
+	Output string
+	Cmds   []*exec.Cmd
+	Files  map[string]string
+}
+
+func (s *collector) Run(c *exec.Cmd) error {
+	s.Cmds = append(s.Cmds, c)
+	s.Files = map[string]string{}
+	for i := 1; i+1 < len(c.Args); i += 2 {
+		if c.Args[i] != "-f" {
+			continue
+		}
+		b, err := ioutil.ReadFile(c.Args[i+1])
+		if err != nil {
+			return err
+		}
+		s.Files[filepath.Base(c.Args[i+1])] = string(b)
+	}
+	c.Stdout.Write([]byte(s.Output))
+	return s.Error
+}
+
+func TestYttRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		values      map[string]interface{}
+		err         error
+		expectFiles map[string]string
+	}{
+		{
+			name: "files without values",
+			files: map[string]string{
+				"/channels/packages/foo/1.0.0/b.yaml": "b",
+				"/channels/packages/foo/1.0.0/a.yaml": "a",
+			},
+			expectFiles: map[string]string{
+				"000-a.yaml": "a",
+				"001-b.yaml": "b",
+			},
+		},
+		{
+			name: "files with values",
+			files: map[string]string{
+				"/channels/packages/foo/1.0.0/manifest.yaml": "manifest",
+			},
+			values: map[string]interface{}{"replicas": 2},
+			expectFiles: map[string]string{
+				"000-manifest.yaml":          "manifest",
+				"zz-declarative-values.yaml": "#@data/values\n#@overlay/match-child-defaults missing_ok=True\n---\nreplicas: 2\n",
+			},
+		},
+		{
+			name: "values overlaying declared defaults",
+			files: map[string]string{
+				"/channels/packages/foo/1.0.0/values.yaml":   "#@data/values\n---\nreplicas: 1\n",
+				"/channels/packages/foo/1.0.0/manifest.yaml": "manifest",
+			},
+			values: map[string]interface{}{"replicas": 2, "version": "1.0.0"},
+			expectFiles: map[string]string{
+				"000-manifest.yaml":          "manifest",
+				"001-values.yaml":            "#@data/values\n---\nreplicas: 1\n",
+				"zz-declarative-values.yaml": "#@data/values\n#@overlay/match-child-defaults missing_ok=True\n---\nreplicas: 2\nversion: 1.0.0\n",
+			},
+		},
+		{
+			name: "error propagation",
+			files: map[string]string{
+				"manifest.yaml": "manifest",
+			},
+			err: errors.New("error"),
+			expectFiles: map[string]string{
+				"000-manifest.yaml": "manifest",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cs := collector{Error: test.err, Output: "rendered"}
+			ytt := &ExecYtt{cmdSite: &cs}
+			out, err := ytt.Render(context.Background(), test.files, test.values)
+
+			if test.err != nil {
+				if err == nil {
+					t.Error("expected error to occur")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if out != "rendered" {
+					t.Errorf("unexpected output: %q", out)
+				}
+			}
+
+			if len(cs.Cmds) != 1 {
+				t.Fatalf("expected 1 command to be invoked, got: %d", len(cs.Cmds))
+			}
+			if cs.Cmds[0].Args[0] != "ytt" {
+				t.Errorf("expected ytt to be invoked, got: %v", cs.Cmds[0].Args)
+			}
+			if len(cs.Files) != len(test.expectFiles) {
+				t.Errorf("expected files %v, got: %v", test.expectFiles, cs.Files)
+			}
+			for k, v := range test.expectFiles {
+				if cs.Files[k] != v {
+					t.Errorf("file %s mismatch, expected: %q, got: %q", k, v, cs.Files[k])
+				}
+			}
+		})
+	}
+}
+
+func TestYttRenderWithDeclaredDefaults(t *testing.T) {
+	if _, err := exec.LookPath("ytt"); err != nil {
+		t.Skip("ytt not found on the path")
+	}
+
+	files := map[string]string{
+		"values.yaml":   "#@data/values\n---\nreplicas: 1\nimage: nginx\n",
+		"manifest.yaml": "#@ load(\"@ytt:data\", \"data\")\n---\nreplicas: #@ data.values.replicas\nimage: #@ data.values.image\n",
+	}
+	// The spec holds fields the package doesn't declare
+	values := map[string]interface{}{"replicas": 2, "version": "1.0.0"}
+
+	out, err := NewExec().Render(context.Background(), files, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "replicas: 2\nimage: nginx\n"; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// DefaultPrerequisiteKinds are the kinds applied before the rest of the manifest by WithPrerequisitesFirst,
+// when no kinds are given: the cluster configuration the workloads rely on being in place
+var DefaultPrerequisiteKinds = []schema.GroupKind{
+	{Kind: "Namespace"},
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+	{Kind: "ServiceAccount"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+}
+
+var (
+	// prerequisitesReadyInterval is how often we check whether the prerequisites are ready
+	prerequisitesReadyInterval = time.Second
+	// prerequisitesReadyTimeout is how long we wait for the prerequisites to be ready
+	prerequisitesReadyTimeout = 30 * time.Second
+)
+
+// prerequisiteObjects returns the objects of the given kinds, or nil if there are no other objects to apply after them
+func prerequisiteObjects(objects []*manifest.Object, kinds []schema.GroupKind) []*manifest.Object {
+	isPrerequisite := make(map[schema.GroupKind]bool)
+	for _, gk := range kinds {
+		isPrerequisite[gk] = true
+	}
+
+	var prerequisites []*manifest.Object
+	for _, o := range objects {
+		if isPrerequisite[o.GroupKind()] {
+			prerequisites = append(prerequisites, o)
+		}
+	}
+	if len(prerequisites) == len(objects) {
+		return nil
+	}
+	return prerequisites
+}
+
+// applyPrerequisites applies the prerequisites in the manifest, and waits for them to exist and be ready,
+// according to kstatus, so that the rest of the manifest is applied in a second phase once they are in place
+func (r *Reconciler) applyPrerequisites(ctx context.Context, ns string, objects *manifest.Objects, extraArgs []string) error {
+	log := log.FromContext(ctx)
+
+	prerequisites := prerequisiteObjects(objects.Items, r.options.prerequisiteKinds)
+	if len(prerequisites) == 0 {
+		return nil
+	}
+
+	m, err := (&manifest.Objects{Items: prerequisites}).JSONManifest()
+	if err != nil {
+		return fmt.Errorf("error creating prerequisites manifest: %v", err)
+	}
+	log.WithValues("objects", len(prerequisites)).Info("applying prerequisites before the rest of the manifest")
+	args := append(append(append([]string{}, extraArgs...), impersonationArgs(ctx)...), r.kubeconfigArgs()...)
+	if err := r.kubectl.Apply(r.rateLimitedContext(ctx), ns, m, r.options.validate, args...); err != nil {
+		return fmt.Errorf("error applying prerequisites: %v", err)
+	}
+
+	var notReady []*manifest.Object
+	err = wait.PollImmediate(prerequisitesReadyInterval, prerequisitesReadyTimeout, func() (bool, error) {
+		notReady, err = r.notReadyObjects(ctx, prerequisites)
+		if err != nil {
+			return false, err
+		}
+		return len(notReady) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout && len(notReady) != 0 {
+		return fmt.Errorf("error waiting for prerequisites to be ready: %s %s is not ready", notReady[0].Kind, notReady[0].Name)
+	} else if err != nil {
+		return fmt.Errorf("error waiting for prerequisites to be ready: %v", err)
+	}
+
+	if definesAPITypes(prerequisites) {
+		// Discover the new kinds
+		r.resetRESTMapper(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestApplyPrerequisites(t *testing.T) {
+	inputManifest := `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: widgets
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: widget-reader
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: widget-controller
+  namespace: widgets
+`
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}, {Group: "rbac.authorization.k8s.io", Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	defer func(interval, timeout time.Duration) {
+		prerequisitesReadyInterval, prerequisitesReadyTimeout = interval, timeout
+	}(prerequisitesReadyInterval, prerequisitesReadyTimeout)
+	prerequisitesReadyInterval, prerequisitesReadyTimeout = 10*time.Millisecond, 50*time.Millisecond
+
+	for _, created := range []bool{true, false} {
+		objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+		if err != nil {
+			t.Fatalf("error parsing manifest: %v", err)
+		}
+
+		var existing []runtime.Object
+		if created {
+			existing = append(existing, objects.Items[0].UnstructuredObject().DeepCopy(), objects.Items[1].UnstructuredObject().DeepCopy())
+		}
+
+		applier := &recordingApplier{}
+		r := &Reconciler{
+			kubectl:       applier,
+			restMapper:    mapper,
+			dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing...),
+		}
+		r.options = WithPrerequisitesFirst()(r.options)
+
+		err = r.applyPrerequisites(context.Background(), "", objects, []string{"--force"})
+		if created && err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !created && (err == nil || !strings.Contains(err.Error(), "Namespace widgets is not ready")) {
+			t.Fatalf("expected error waiting for the Namespace to be ready, got %v", err)
+		}
+
+		if len(applier.manifests) != 1 {
+			t.Fatalf("expected prerequisites to be applied once, got %d applies", len(applier.manifests))
+		}
+		applied := applier.manifests[0]
+		if !strings.Contains(applied, `"name":"widgets"`) || !strings.Contains(applied, "widget-reader") || strings.Contains(applied, "widget-controller") {
+			t.Errorf("expected only the Namespace and ClusterRole to be applied, got %s", applied)
+		}
+	}
+}
+
+func TestPrerequisiteObjects(t *testing.T) {
+	objects, err := manifest.ParseObjects(context.Background(), "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: widgets\n")
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+	if prerequisites := prerequisiteObjects(objects.Items, DefaultPrerequisiteKinds); prerequisites != nil {
+		t.Errorf("expected no separate phase for a manifest of only prerequisites, got %v", prerequisites)
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const PrunedObjectsTotal = "pruned_objects_total"
+
+// ReasonPruned is the reason for the events recording objects deleted because they were removed from the manifest
+const ReasonPruned = "Pruned"
+
+var prunedObjectsRegisterOnce sync.Once
+
+var prunedObjects = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "declarative",
+	Name:      PrunedObjectsTotal,
+	Help:      "How many objects have been deleted because they were removed from the manifest",
+}, []string{"group_version_kind"})
+
+// DefaultProtectedKinds are the kinds that are never pruned unless WithProtectedKinds is used, as deleting them
+// loses data or everything in them
+var DefaultProtectedKinds = []schema.GroupKind{
+	{Kind: "PersistentVolumeClaim"},
+	{Kind: "Namespace"},
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+}
+
+// kubectlPruneKinds are the kinds kubectl prunes by default
+var kubectlPruneKinds = []schema.GroupKind{
+	{Kind: "ConfigMap"},
+	{Kind: "Endpoints"},
+	{Kind: "Namespace"},
+	{Kind: "PersistentVolumeClaim"},
+	{Kind: "PersistentVolume"},
+	{Kind: "Pod"},
+	{Kind: "ReplicationController"},
+	{Kind: "Secret"},
+	{Kind: "Service"},
+	{Group: "batch", Kind: "Job"},
+	{Group: "batch", Kind: "CronJob"},
+	{Group: "networking.k8s.io", Kind: "Ingress"},
+	{Group: "apps", Kind: "DaemonSet"},
+	{Group: "apps", Kind: "Deployment"},
+	{Group: "apps", Kind: "ReplicaSet"},
+	{Group: "apps", Kind: "StatefulSet"},
+}
+
+// protectedKinds returns the kinds that are never pruned
+func (r *Reconciler) protectedKinds() []schema.GroupKind {
+	if r.options.protectedKindsSet {
+		return r.options.protectedKinds
+	}
+	return DefaultProtectedKinds
+}
+
+// isProtected returns true if o is of a kind that is never pruned
+func (r *Reconciler) isProtected(o *manifest.Object) bool {
+	return containsGroupKind(r.protectedKinds(), o.GroupKind())
+}
+
+// pruneWhitelistArgs returns the --prune-whitelist args limiting kubectl to pruning the kinds of pruneMappings, or
+// nil if kubectl prunes those kinds by default
+func (r *Reconciler) pruneWhitelistArgs(ctx context.Context) []string {
+	protected := append(append([]schema.GroupKind{}, r.protectedKinds()...), r.separatelyAppliedKinds()...)
+	if len(protected) == 0 && len(r.options.namespaces) == 0 {
+		return nil
+	}
+
+	var args []string
+	for _, mapping := range r.pruneMappings(ctx) {
+		gvk := mapping.GroupVersionKind
+		group := gvk.Group
+		if group == "" {
+			group = "core"
+		}
+		args = append(args, fmt.Sprintf("--prune-whitelist=%s/%s/%s", group, gvk.Version, gvk.Kind))
+	}
+	return args
+}
+
+// pruneMappings returns the mappings of the kinds pruned: the kinds kubectl prunes by default, less the protected
+// kinds and the kinds applied separately with WithApplyStrategy.  Kinds the cluster doesn't serve are left out, as
+// are cluster-scoped kinds with WithNamespaceScope.
+func (r *Reconciler) pruneMappings(ctx context.Context) []*meta.RESTMapping {
+	protected := append(append([]schema.GroupKind{}, r.protectedKinds()...), r.separatelyAppliedKinds()...)
+
+	var mappings []*meta.RESTMapping
+	for _, gk := range kubectlPruneKinds {
+		if containsGroupKind(protected, gk) {
+			continue
+		}
+		mapping, err := r.restMapper.RESTMapping(gk)
+		if err != nil {
+			log.FromContext(ctx).WithValues("kind", gk.String()).V(2).Info("kind not served, not pruning it")
+			continue
+		}
+		if len(r.options.namespaces) != 0 && mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			continue
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings
+}
+
+// objectsToPrune returns the objects kubectl apply --prune will delete: the objects of the kinds pruned, with the
+// labels of instance and applied by kubectl, which aren't in objects.  Namespaced objects are looked for in ns and
+// in the namespaces of objects, as kubectl does.
+func (r *Reconciler) objectsToPrune(ctx context.Context, instance DeclarativeObject, ns string, objects []*manifest.Object) ([]*unstructured.Unstructured, error) {
+	selector := labels.SelectorFromSet(r.labelsFor(ctx, instance)).String()
+	keep := make(map[string]bool)
+	namespaces := map[string]bool{ns: true}
+	for _, o := range objects {
+		keep[objectKey(o)] = true
+		if o.Namespace == "" {
+			keep[o.GroupKind().String()+"/"+ns+"/"+o.Name] = true
+		} else {
+			namespaces[o.Namespace] = true
+		}
+	}
+
+	var pruned []*unstructured.Unstructured
+	for _, mapping := range r.pruneMappings(ctx) {
+		var lists []dynamic.ResourceInterface
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			for namespace := range namespaces {
+				lists = append(lists, r.dynamicClient.Resource(mapping.Resource).Namespace(namespace))
+			}
+		} else {
+			lists = append(lists, r.dynamicClient.Resource(mapping.Resource))
+		}
+		for _, resource := range lists {
+			list, err := resource.List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, fmt.Errorf("error listing %s: %v", mapping.Resource.Resource, err)
+			}
+			for i := range list.Items {
+				u := &list.Items[i]
+				if keep[prunedKey(u)] || u.GetDeletionTimestamp() != nil {
+					continue
+				}
+				if _, found := u.GetAnnotations()[corev1.LastAppliedConfigAnnotation]; !found {
+					// kubectl only prunes the objects it applied
+					continue
+				}
+				pruned = append(pruned, u)
+			}
+		}
+	}
+	sort.Slice(pruned, func(i, j int) bool {
+		return prunedKey(pruned[i]) < prunedKey(pruned[j])
+	})
+	return pruned, nil
+}
+
+type pruneSetKey struct{}
+
+// pruneSet holds the objects the apply of a reconcile prunes, listed just before the apply that prunes them
+type pruneSet struct {
+	instance DeclarativeObject
+	objects  []*unstructured.Unstructured
+}
+
+// contextWithPruneSet records the objects pruned by the apply of instance in ctx, for prunedFromContext
+func contextWithPruneSet(ctx context.Context, instance DeclarativeObject) context.Context {
+	return context.WithValue(ctx, pruneSetKey{}, &pruneSet{instance: instance})
+}
+
+// listPruned lists the objects the apply of objects with the prune args is about to prune, if ctx records them.  It
+// is called just before that apply, so that nothing is listed when nothing is pruned.  Errors are only logged, as
+// the list is only informational.
+func (r *Reconciler) listPruned(ctx context.Context, ns string, objects []*manifest.Object) {
+	log := log.FromContext(ctx)
+
+	set, ok := ctx.Value(pruneSetKey{}).(*pruneSet)
+	if !ok {
+		return
+	}
+	pruned, err := r.objectsToPrune(ctx, set.instance, ns, objects)
+	if err != nil {
+		log.Error(err, "finding objects to prune")
+		return
+	}
+	for _, u := range pruned {
+		log.WithValues("kind", u.GetKind()).WithValues("namespace", u.GetNamespace()).WithValues("name", u.GetName()).Info("object removed from the manifest will be pruned")
+	}
+	set.objects = pruned
+}
+
+// prunedFromContext returns the objects listed by listPruned during the reconcile of ctx
+func prunedFromContext(ctx context.Context) []*unstructured.Unstructured {
+	if set, ok := ctx.Value(pruneSetKey{}).(*pruneSet); ok {
+		return set.objects
+	}
+	return nil
+}
+
+// prunedKey identifies a live object like objectKey identifies an object of the manifest
+func prunedKey(u *unstructured.Unstructured) string {
+	return u.GroupVersionKind().GroupKind().String() + "/" + u.GetNamespace() + "/" + u.GetName()
+}
+
+// recordPruned reports an object deleted because it was removed from the manifest of instance, in the log, with an
+// event and in the pruned objects metric
+func (r *Reconciler) recordPruned(ctx context.Context, instance DeclarativeObject, gvk schema.GroupVersionKind, namespace, name string) {
+	prunedObjectsRegisterOnce.Do(func() {
+		// Ignore errors, eg from tests registering it again, as the count is only informational
+		_ = metrics.Registry.Register(prunedObjects)
+	})
+	prunedObjects.WithLabelValues(gvkString(gvk)).Inc()
+
+	object := gvk.Kind + " " + name
+	if namespace != "" {
+		object = gvk.Kind + " " + namespace + "/" + name
+	}
+	log.FromContext(ctx).WithValues("object", object).Info("pruned object removed from the manifest")
+	if r.recorder != nil {
+		r.recorder.Eventf(instance, "Normal", ReasonPruned, "Pruned %s", object)
+	}
+}
+
+func containsGroupKind(kinds []schema.GroupKind, gk schema.GroupKind) bool {
+	for _, k := range kinds {
+		if k == gk {
+			return true
+		}
+	}
+	return false
+}
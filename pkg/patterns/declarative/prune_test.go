@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	toolsrecord "k8s.io/client-go/tools/record"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestPruneWhitelistArgs(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}, {Group: "apps", Version: "v1"}})
+	for _, gvk := range []schema.GroupVersionKind{
+		{Version: "v1", Kind: "ConfigMap"},
+		{Version: "v1", Kind: "PersistentVolumeClaim"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+	} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolume"}, meta.RESTScopeRoot)
+
+	tests := []struct {
+		name     string
+		opts     []reconcilerOption
+		expected []string
+	}{
+		{
+			name: "default protection",
+			expected: []string{"--prune-whitelist=core/v1/ConfigMap", "--prune-whitelist=core/v1/PersistentVolume",
+				"--prune-whitelist=apps/v1/Deployment"},
+		},
+		{
+			name: "custom protection",
+			opts: []reconcilerOption{WithProtectedKinds(schema.GroupKind{Group: "apps", Kind: "Deployment"})},
+			expected: []string{"--prune-whitelist=core/v1/ConfigMap", "--prune-whitelist=core/v1/Namespace",
+				"--prune-whitelist=core/v1/PersistentVolumeClaim", "--prune-whitelist=core/v1/PersistentVolume"},
+		},
+		{
+			name: "protection turned off",
+			opts: []reconcilerOption{WithProtectedKinds()},
+		},
+		{
+			name: "kind applied separately",
+			opts: []reconcilerOption{
+				WithProtectedKinds(),
+				WithApplyStrategy(schema.GroupKind{Group: "apps", Kind: "Deployment"}, ApplyStrategyReplace),
+			},
+			expected: []string{"--prune-whitelist=core/v1/ConfigMap", "--prune-whitelist=core/v1/Namespace",
+				"--prune-whitelist=core/v1/PersistentVolumeClaim", "--prune-whitelist=core/v1/PersistentVolume"},
+		},
+		{
+			name: "namespace scope",
+			opts: []reconcilerOption{WithProtectedKinds(), WithNamespaceScope("team-a")},
+			expected: []string{"--prune-whitelist=core/v1/ConfigMap", "--prune-whitelist=core/v1/PersistentVolumeClaim",
+				"--prune-whitelist=apps/v1/Deployment"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{restMapper: mapper}
+			for _, opt := range test.opts {
+				r.options = opt(r.options)
+			}
+			if args := r.pruneWhitelistArgs(context.Background()); !reflect.DeepEqual(args, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, args)
+			}
+		})
+	}
+}
+
+func TestObjectsToPrune(t *testing.T) {
+	ctx := context.Background()
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}, {Group: "apps", Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	objects, err := manifest.ParseObjects(ctx, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kept
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	live := func(kind, namespace, name string, labels map[string]string, applied bool) runtime.Object {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		if kind == "Deployment" {
+			u.SetAPIVersion("apps/v1")
+		}
+		u.SetKind(kind)
+		u.SetNamespace(namespace)
+		u.SetName(name)
+		u.SetLabels(labels)
+		if applied {
+			u.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"})
+		}
+		return u
+	}
+	owned := map[string]string{"app": "guestbook"}
+	existing := []runtime.Object{
+		live("ConfigMap", "default", "kept", owned, true),
+		live("ConfigMap", "default", "removed", owned, true),
+		live("ConfigMap", "default", "not-applied", owned, false),
+		live("ConfigMap", "default", "other", map[string]string{"app": "other"}, true),
+		live("ConfigMap", "other", "elsewhere", owned, true),
+		live("Deployment", "default", "removed", owned, true),
+	}
+
+	recorder := toolsrecord.NewFakeRecorder(10)
+	r := &Reconciler{
+		restMapper: mapper,
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			{Version: "v1", Resource: "configmaps"}:                 "ConfigMapList",
+			{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+		}, existing...),
+		recorder: recorder,
+	}
+	r.options = WithLabels(func(context.Context, DeclarativeObject) map[string]string { return owned })(r.options)
+	instance := newGuestbook("default", "test", time.Now())
+
+	pruned, err := r.objectsToPrune(ctx, instance, "default", objects.Items)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, u := range pruned {
+		names = append(names, prunedKey(u))
+	}
+	expected := []string{"ConfigMap/default/removed", "Deployment.apps/default/removed"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v to be pruned, got %v", expected, names)
+	}
+
+	r.recordPruned(ctx, instance, pruned[1].GroupVersionKind(), "default", "removed")
+	if event := <-recorder.Events; event != "Normal Pruned Pruned Deployment default/removed" {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	// Nothing is listed unless the reconcile records the pruned objects
+	r.listPruned(ctx, "default", objects.Items)
+	if pruned := prunedFromContext(ctx); len(pruned) != 0 {
+		t.Errorf("expected nothing to be listed, got %v", pruned)
+	}
+	pruneCtx := contextWithPruneSet(ctx, instance)
+	r.listPruned(pruneCtx, "default", objects.Items)
+	if pruned := prunedFromContext(pruneCtx); len(pruned) != 2 {
+		t.Errorf("expected the pruned objects to be listed, got %v", pruned)
+	}
+
+	// List failures don't stop the apply
+	r.dynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("forbidden")
+	})
+	pruneCtx = contextWithPruneSet(ctx, instance)
+	r.listPruned(pruneCtx, "default", objects.Items)
+	if pruned := prunedFromContext(pruneCtx); len(pruned) != 0 {
+		t.Errorf("expected nothing to be listed after a list failure, got %v", pruned)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+)
+
+// RESTConfig returns the config of the clients of the reconciler, with the QPS and burst of WithClientRateLimits.
+// Pass it to WatchAll so that the dynamic watches are rate limited the same way.
+func (r *Reconciler) RESTConfig() *rest.Config {
+	return r.config
+}
+
+// RateLimiter returns the workqueue rate limiter set by WithRateLimiter, which NewController passes to the
+// controller of the reconciler.  It returns nil without WithRateLimiter, for the controller-runtime default.
+func (r *Reconciler) RateLimiter() ratelimiter.RateLimiter {
+	return r.options.rateLimiter
+}
+
+// NewController creates the controller named name of the reconciler in mgr, once Init has been called.  The
+// controller reconciles with options.Reconciler, or r if it is nil, and its workqueue is rate limited by
+// options.RateLimiter, or else the rate limiter of WithRateLimiter.
+func (r *Reconciler) NewController(name string, mgr manager.Manager, options controller.Options) (controller.Controller, error) {
+	return controller.New(name, mgr, r.controllerOptions(options))
+}
+
+// controllerOptions returns options with the defaults of the reconciler
+func (r *Reconciler) controllerOptions(options controller.Options) controller.Options {
+	if options.Reconciler == nil {
+		options.Reconciler = r
+	}
+	if options.RateLimiter == nil {
+		options.RateLimiter = r.options.rateLimiter
+	}
+	return options
+}
+
+// rateLimitedConfig returns a copy of config with the QPS and burst of WithClientRateLimits, or config without it
+func (r *Reconciler) rateLimitedConfig(config *rest.Config) *rest.Config {
+	if r.options.clientRateLimits == nil {
+		return config
+	}
+	config = rest.CopyConfig(config)
+	r.options.clientRateLimits.Apply(config)
+	return config
+}
+
+// rateLimitedContext returns ctx for applying with the QPS and burst of WithClientRateLimits
+func (r *Reconciler) rateLimitedContext(ctx context.Context) context.Context {
+	if r.options.clientRateLimits == nil {
+		return ctx
+	}
+	return applier.ContextWithRateLimits(ctx, *r.options.clientRateLimits)
+}
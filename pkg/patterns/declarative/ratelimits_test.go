@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+)
+
+func TestRateLimitedConfig(t *testing.T) {
+	config := &rest.Config{Host: "https://127.0.0.1:6443", QPS: 20, Burst: 30}
+
+	r := &Reconciler{}
+	if got := r.rateLimitedConfig(config); got != config {
+		t.Errorf("expected the config to be used as is without WithClientRateLimits")
+	}
+
+	r.options = WithClientRateLimits(100, 0)(r.options)
+	got := r.rateLimitedConfig(config)
+	if got.QPS != 100 || got.Burst != 30 {
+		t.Errorf("expected QPS 100 and the burst of the config, got QPS %v, burst %v", got.QPS, got.Burst)
+	}
+	if got.Host != config.Host {
+		t.Errorf("expected the config to be copied, got host %q", got.Host)
+	}
+	if config.QPS != 20 {
+		t.Errorf("expected the config of the manager to be left unchanged, got QPS %v", config.QPS)
+	}
+}
+
+func TestControllerOptions(t *testing.T) {
+	r := &Reconciler{}
+	if options := r.controllerOptions(controller.Options{}); options.Reconciler != r || options.RateLimiter != nil {
+		t.Errorf("expected the reconciler and the default rate limiter, got %+v", options)
+	}
+
+	limiter := workqueue.NewItemExponentialFailureRateLimiter(time.Second, time.Minute)
+	r.options = WithRateLimiter(limiter)(r.options)
+	if options := r.controllerOptions(controller.Options{}); options.RateLimiter != limiter {
+		t.Errorf("expected the rate limiter of WithRateLimiter, got %v", options.RateLimiter)
+	}
+
+	other := workqueue.NewItemFastSlowRateLimiter(time.Second, time.Minute, 3)
+	if options := r.controllerOptions(controller.Options{RateLimiter: other}); options.RateLimiter != other {
+		t.Errorf("expected the rate limiter of the options to be kept, got %v", options.RateLimiter)
+	}
+}
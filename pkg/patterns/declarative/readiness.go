@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const (
+	// ReasonProgressing is the reason for a false ConditionReady while waiting for objects to become ready
+	ReasonProgressing = "Progressing"
+	// ReasonReadinessTimeout is the reason for a false ConditionReady when objects weren't ready in time
+	ReasonReadinessTimeout = "ReadinessTimeout"
+	// ReasonReady is the reason for a true ConditionReady
+	ReasonReady = "Ready"
+)
+
+// readyRecheckInterval is how often we check whether objects are ready, when waiting for them
+var readyRecheckInterval = 10 * time.Second
+
+// readinessTracker records when each DeclarativeObject was first seen with objects that weren't ready, in its
+// current generation
+type readinessTracker struct {
+	mu    sync.Mutex
+	since map[types.NamespacedName]notReadySince
+}
+
+// notReadySince is when objects were first seen not ready in a generation of a DeclarativeObject
+type notReadySince struct {
+	generation int64
+	time       time.Time
+}
+
+func newReadinessTracker() *readinessTracker {
+	return &readinessTracker{since: make(map[types.NamespacedName]notReadySince)}
+}
+
+// notReady returns how long instance has not been ready in generation, starting the clock if needed.  The clock
+// restarts when the generation changes, as the objects are then applied with the new spec.
+func (t *readinessTracker) notReady(instance types.NamespacedName, generation int64, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since, found := t.since[instance]
+	if !found || since.generation != generation {
+		t.since[instance] = notReadySince{generation: generation, time: now}
+		return 0
+	}
+	return now.Sub(since.time)
+}
+
+// forget stops the clock of instance, once its objects are ready or it is deleted
+func (t *readinessTracker) forget(instance types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.since, instance)
+}
+
+// waitForReady checks whether the applied objects are ready, reporting progress in the Ready
+// condition, and requeues until they are.  An error is returned if they aren't ready in time.
+func (r *Reconciler) waitForReady(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) (reconcile.Result, error) {
+	log := log.FromContext(ctx)
+	name := types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}
+
+	notReady, err := r.notReadyObjects(ctx, objects.Items)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	condition := metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonReady,
+		Message:            "All objects are ready",
+		ObservedGeneration: instance.GetGeneration(),
+	}
+	var result reconcile.Result
+	var timeoutErr error
+	if len(notReady) == 0 {
+		r.readiness.forget(name)
+	} else {
+		var names []string
+		for _, o := range notReady {
+			names = append(names, o.Kind+"/"+o.Name)
+		}
+		waiting := r.readiness.notReady(name, instance.GetGeneration(), time.Now())
+
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = ReasonProgressing
+		condition.Message = fmt.Sprintf("Waiting for %d of %d objects to become ready: %s", len(notReady), len(objects.Items), strings.Join(names, ", "))
+		result = reconcile.Result{RequeueAfter: readyRecheckInterval}
+
+		if r.options.readyTimeout > 0 && waiting > r.options.readyTimeout {
+			condition.Reason = ReasonReadinessTimeout
+			condition.Message = fmt.Sprintf("Objects not ready after %v: %s", r.options.readyTimeout, strings.Join(names, ", "))
+			timeoutErr = fmt.Errorf("objects not ready after %v: %s", r.options.readyTimeout, strings.Join(names, ", "))
+		}
+		log.WithValues("notReady", len(notReady)).Info("waiting for objects to become ready")
+	}
+
+	changed, err := setCondition(instance, condition)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if changed {
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating status: %v", err)
+		}
+	}
+
+	if timeoutErr != nil {
+		return reconcile.Result{}, timeoutErr
+	}
+	return result, nil
+}
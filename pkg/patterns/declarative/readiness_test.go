@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestWaitForReady(t *testing.T) {
+	inputManifest := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+  namespace: default
+`
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+
+	tests := []struct {
+		name           string
+		existing       []string
+		waitingFor     time.Duration
+		expectedStatus string
+		expectedReason string
+		wantRequeue    bool
+		wantErr        bool
+	}{
+		{
+			name:           "all objects ready",
+			existing:       []string{"config", "credentials"},
+			expectedStatus: "True",
+			expectedReason: ReasonReady,
+		},
+		{
+			name:           "waiting for an object",
+			existing:       []string{"config"},
+			expectedStatus: "False",
+			expectedReason: ReasonProgressing,
+			wantRequeue:    true,
+		},
+		{
+			name:           "timed out waiting for an object",
+			existing:       []string{"config"},
+			waitingFor:     2 * time.Minute,
+			expectedStatus: "False",
+			expectedReason: ReasonReadinessTimeout,
+			wantErr:        true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+			var existing []runtime.Object
+			for _, o := range objects.Items {
+				for _, name := range test.existing {
+					if o.Name == name {
+						existing = append(existing, o.UnstructuredObject().DeepCopy())
+					}
+				}
+			}
+
+			instance := newGuestbook("default", "test", time.Now())
+			r := &Reconciler{
+				client:        fake.NewClientBuilder().WithObjects(instance).Build(),
+				restMapper:    mapper,
+				dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing...),
+				readiness:     newReadinessTracker(),
+				options:       reconcilerParams{waitForReady: true, readyTimeout: time.Minute},
+			}
+			if test.waitingFor != 0 {
+				r.readiness.notReady(types.NamespacedName{Namespace: "default", Name: "test"}, instance.GetGeneration(), time.Now().Add(-test.waitingFor))
+			}
+
+			result, err := r.waitForReady(context.Background(), instance, objects)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("expected error=%v, got %v", test.wantErr, err)
+			}
+			if test.wantRequeue != (result.RequeueAfter != 0) {
+				t.Errorf("expected requeue=%v, got %v", test.wantRequeue, result)
+			}
+
+			updated := &unstructured.Unstructured{}
+			updated.SetGroupVersionKind(instance.GroupVersionKind())
+			if err := r.client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "test"}, updated); err != nil {
+				t.Fatalf("error getting instance: %v", err)
+			}
+			conditions, _, err := getConditions(updated)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ready := meta.FindStatusCondition(conditions, ConditionReady)
+			if ready == nil {
+				t.Fatalf("expected Ready condition, got %v", conditions)
+			}
+			if string(ready.Status) != test.expectedStatus || ready.Reason != test.expectedReason {
+				t.Errorf("unexpected Ready condition %v", ready)
+			}
+		})
+	}
+}
+
+func TestReadinessTracker(t *testing.T) {
+	tracker := newReadinessTracker()
+	name := types.NamespacedName{Namespace: "default", Name: "test"}
+	start := time.Now()
+
+	if waiting := tracker.notReady(name, 1, start); waiting != 0 {
+		t.Errorf("expected clock to start, got %v", waiting)
+	}
+	if waiting := tracker.notReady(name, 1, start.Add(time.Minute)); waiting != time.Minute {
+		t.Errorf("expected to be waiting for a minute, got %v", waiting)
+	}
+
+	// A new generation is applied, so the clock restarts
+	if waiting := tracker.notReady(name, 2, start.Add(2*time.Minute)); waiting != 0 {
+		t.Errorf("expected clock to restart for a new generation, got %v", waiting)
+	}
+	if waiting := tracker.notReady(name, 2, start.Add(3*time.Minute)); waiting != time.Minute {
+		t.Errorf("expected to be waiting for a minute in the new generation, got %v", waiting)
+	}
+
+	// Deleted objects are forgotten
+	tracker.forget(name)
+	if len(tracker.since) != 0 {
+		t.Errorf("expected deleted object to be forgotten, got %v", tracker.since)
+	}
+	if waiting := tracker.notReady(name, 2, start.Add(4*time.Minute)); waiting != 0 {
+		t.Errorf("expected clock to restart once forgotten, got %v", waiting)
+	}
+}
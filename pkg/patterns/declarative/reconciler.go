@@ -21,12 +21,15 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
+	"go.opentelemetry.io/otel/attribute"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -55,6 +58,9 @@ type Reconciler struct {
 
 	metrics reconcileMetrics
 	mgr     manager.Manager
+	// apiReader reads from the API server rather than the cache of the manager, for objects which shouldn't all be
+	// cached, such as Secrets
+	apiReader client.Reader
 
 	// recorder is the EventRecorder for creating k8s events
 	recorder      recorder.EventRecorder
@@ -62,6 +68,23 @@ type Reconciler struct {
 
 	restMapper meta.RESTMapper
 	options    reconcilerParams
+
+	// valuesRefs tracks the objects referenced by spec.valuesFrom, for watching
+	valuesRefs *valuesTracker
+	// readiness tracks how long objects have been waiting to become ready, for WithWaitForReady
+	readiness *readinessTracker
+	// renderCache holds recently built objects, for WithRenderCache
+	renderCache *renderCache
+	// failures counts consecutive failed reconciles, for WithFailureBackoff
+	failures *failureTracker
+	// remoteClusters caches the clients of remote clusters, for WithRemoteClusters
+	remoteClusters *remoteClusters
+	// dependencies tracks the addon dependencies of each DeclarativeObject, for WithAddonDependencies
+	dependencies *dependencyTracker
+	// operatorDynamicClient is the dynamic client of the operator, when dynamicClient impersonates a ServiceAccount
+	operatorDynamicClient dynamic.Interface
+	// kubeconfig is the kubeconfig file of the remote cluster this copy of the reconciler applies to
+	kubeconfig string
 }
 
 type kubectlClient interface {
@@ -85,19 +108,26 @@ func (r *Reconciler) Init(mgr manager.Manager, prototype DeclarativeObject, opts
 	r.recorder = mgr.GetEventRecorderFor(controllerName)
 
 	r.client = mgr.GetClient()
-	r.config = mgr.GetConfig()
+	r.apiReader = mgr.GetAPIReader()
 	r.mgr = mgr
+	r.valuesRefs = newValuesTracker()
+	r.readiness = newReadinessTracker()
+	r.failures = newFailureTracker()
+	r.remoteClusters = newRemoteClusters()
+	r.dependencies = newDependencyTracker()
 	globalObjectTracker.mgr = mgr
 
+	if err := r.applyOptions(opts...); err != nil {
+		return err
+	}
+
+	r.config = r.rateLimitedConfig(mgr.GetConfig())
 	d, err := dynamic.NewForConfig(r.config)
 	if err != nil {
 		return err
 	}
 	r.dynamicClient = d
-
-	r.restMapper = mgr.GetRESTMapper()
-
-	if err = r.applyOptions(opts...); err != nil {
+	if r.restMapper, err = newDiscoveryRESTMapper(r.config); err != nil {
 		return err
 	}
 
@@ -105,6 +135,28 @@ func (r *Reconciler) Init(mgr manager.Manager, prototype DeclarativeObject, opts
 		return err
 	}
 
+	if r.options.inventoryApplier != nil {
+		r.kubectl = r.options.inventoryApplier
+	}
+	if r.options.execApplier != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), kubectlVerifyTimeout)
+		defer cancel()
+		if err := r.options.execApplier.Verify(ctx, r.kubectlFlags()...); err != nil {
+			return fmt.Errorf("error verifying kubectl: %v", err)
+		}
+		r.kubectl = r.options.execApplier
+	}
+	if r.options.applier != nil {
+		r.kubectl = r.options.applier
+	}
+	if r.options.applyLimiter != nil {
+		r.kubectl = &limitedApplier{applier: r.kubectl, limiter: r.options.applyLimiter}
+	}
+
+	if r.options.renderCacheSize > 0 {
+		r.renderCache = newRenderCache(r.options.renderCacheSize, r.options.renderCacheTTL)
+	}
+
 	if r.CollectMetrics() {
 		if gvk, err := apiutil.GVKForObject(prototype, r.mgr.GetScheme()); err != nil {
 			return err
@@ -118,45 +170,205 @@ func (r *Reconciler) Init(mgr manager.Manager, prototype DeclarativeObject, opts
 
 // +rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 func (r *Reconciler) Reconcile(ctx context.Context, request reconcile.Request) (result reconcile.Result, err error) {
-	log := log.Log
+	log := log.FromContext(ctx)
 	defer r.collectMetrics(request, result, err)
 
+	ctx, span := startSpan(ctx, "Reconcile", attribute.String("namespace", request.Namespace), attribute.String("name", request.Name))
+	defer func() { endSpan(span, err) }()
+
 	// Fetch the object
 	instance := r.prototype.DeepCopyObject().(DeclarativeObject)
 	if err = r.client.Get(ctx, request.NamespacedName, instance); err != nil {
 		if apierrors.IsNotFound(err) {
 			// Object not found, return.  Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
+			if r.options.healthCheck != nil {
+				r.options.healthCheck.forget(r, request.NamespacedName)
+			}
+			if r.readiness != nil {
+				r.readiness.forget(request.NamespacedName)
+			}
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
-		log.Error(err, "error reading object")
+		log.WithValues("object", request.NamespacedName.String()).Error(err, "error reading object")
 		return reconcile.Result{}, err
 	}
+	ctx, log = contextWithObjectLogger(ctx, instance)
+	ctx = contextWithDiscoveryRefresh(ctx)
 
-	if r.options.status != nil {
-		if err := r.options.status.Preflight(ctx, instance); err != nil {
-			log.Error(err, "preflight check failed, not reconciling")
+	if r.options.shard != nil && !r.options.shard.Owns(instance) {
+		log.V(2).Info("not reconciling, object belongs to another shard")
+		return reconcile.Result{}, nil
+	}
+
+	if !r.inNamespaceScope(instance.GetNamespace()) {
+		log.V(2).Info("not reconciling, object is outside of the namespace scope")
+		return reconcile.Result{}, nil
+	}
+
+	if r.options.reconcileStatus {
+		ctx = contextWithReconcileOutcome(ctx)
+	}
+
+	// The status is still updated with ctx once reconcileCtx times out
+	reconcileCtx, cancel := r.reconcileContext(ctx)
+	defer cancel()
+
+	target := r
+	if r.options.remoteClusters {
+		target, err = r.forTargetCluster(reconcileCtx, instance)
+		if err != nil {
+			log.Error(err, "finding target cluster")
+			target = r
+		}
+		defer func() {
+			if err := target.removeKubeconfig(); err != nil {
+				log.Error(err, "removing kubeconfig of target cluster")
+			}
+		}()
+	}
+
+	if (r.usesPreDeleteFinalizer() || r.options.remoteClusters || r.options.manifestExporter != nil) && instance.GetDeletionTimestamp() != nil {
+		if errors.Is(err, errKubeconfigNotFound) {
+			err = r.forgetRemoteCluster(reconcileCtx, instance)
+		}
+		if err != nil {
 			return reconcile.Result{}, err
 		}
+		result, err = target.reconcileDeletion(reconcileCtx, request.NamespacedName, instance)
+		return result, r.checkTimeout(reconcileCtx, err)
+	}
+
+	if r.options.status != nil && err == nil {
+		if err = r.options.status.Preflight(reconcileCtx, instance); err != nil {
+			log.Error(err, "preflight check failed, not reconciling")
+			r.notifySinksOfFailure(reconcileCtx, instance, nil, err)
+		}
+	}
+
+	if err == nil {
+		result, err = target.reconcileExists(reconcileCtx, request.NamespacedName, instance)
+	}
+	err = r.checkTimeout(reconcileCtx, err)
+	reconcileErr := err
+
+	terminal := IsTerminalError(err)
+	switch {
+	case terminal:
+		result, err = r.stallOnTerminalError(ctx, instance, err)
+	case err != nil && r.options.failureThreshold > 0:
+		result, err = r.backoffOnFailure(ctx, instance, err)
+	case err == nil:
+		if r.options.failureThreshold > 0 {
+			r.failures.succeeded(request.NamespacedName)
+		}
+		err = r.clearStalled(ctx, instance)
+	}
+
+	if r.options.statusConditions {
+		condCtx, condSpan := startSpan(ctx, "UpdateStatusConditions")
+		condErr := r.updateConditions(condCtx, instance, result, err)
+		endSpan(condSpan, condErr)
+		if condErr != nil {
+			log.Error(condErr, "error updating status conditions")
+			if err == nil {
+				err = condErr
+			}
+		}
 	}
 
-	return r.reconcileExists(ctx, request.NamespacedName, instance)
+	if r.options.reconcileStatus {
+		if statusErr := r.updateReconcileStatus(ctx, instance, reconcileErr, time.Now()); statusErr != nil {
+			log.Error(statusErr, "error updating reconcile status")
+			if err == nil {
+				err = statusErr
+			}
+		}
+	}
+
+	if r.options.healthCheck != nil {
+		r.options.healthCheck.record(r, request.NamespacedName, instance, reconcileErr)
+	}
+
+	if err != nil || terminal {
+		// Objects with terminal errors aren't reconciled again until they change
+		return result, err
+	}
+	return r.withResync(result), nil
 }
 
-func (r *Reconciler) reconcileExists(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) (reconcile.Result, error) {
-	log := log.Log
-	log.WithValues("object", name.String()).Info("reconciling")
+func (r *Reconciler) reconcileExists(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) (result reconcile.Result, err error) {
+	log := log.FromContext(ctx)
+	log.Info("reconciling")
+
+	var objects *manifest.Objects
+	// notified is set once the sinks have been told the outcome of the apply, so they aren't told again of the
+	// errors after it
+	notified := false
+	defer func() {
+		if err != nil && !notified {
+			r.notifySinksOfFailure(ctx, instance, objects, err)
+		}
+	}()
+
+	if r.options.remoteClusters {
+		if err := r.ensureFinalizer(ctx, instance, RemoteClusterFinalizer, r.kubeconfig != ""); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if r.options.singleton {
+		ok, err := r.enforceSingleton(ctx, instance)
+		if err != nil {
+			log.Error(err, "checking singleton")
+			return reconcile.Result{}, err
+		}
+		if !ok {
+			log.Info("not reconciling, another instance of the singleton exists")
+			// Check again later, in case the other instance has been removed
+			return reconcile.Result{RequeueAfter: singletonRecheckInterval}, nil
+		}
+	}
+
+	if r.options.addonDependencies != nil {
+		ok, err := r.checkAddonDependencies(ctx, instance)
+		if err != nil {
+			log.Error(err, "checking dependencies")
+			return reconcile.Result{}, err
+		}
+		if !ok {
+			return reconcile.Result{RequeueAfter: dependencyRecheckInterval}, nil
+		}
+	}
 
 	var fs filesys.FileSystem
 	if r.IsKustomizeOptionUsed() {
 		fs = filesys.MakeFsInMemory()
 	}
 
-	objects, err := r.BuildDeploymentObjectsWithFs(ctx, name, instance, fs)
+	rollback, err := r.rollbackRevision(ctx, instance)
+	if err != nil {
+		log.Error(err, "loading rollback revision")
+		return reconcile.Result{}, err
+	}
+
+	if rollback == nil && len(r.options.versionPolicies) != 0 {
+		if err := r.checkVersionPolicies(ctx, instance); err != nil {
+			log.Error(err, "checking version change")
+			return reconcile.Result{}, err
+		}
+	}
+
+	if rollback != nil {
+		log.WithValues("revision", rollback.Number).Info("rolling back")
+		objects, err = rollbackObjects(ctx, rollback)
+	} else {
+		objects, err = r.BuildDeploymentObjectsWithFs(ctx, name, instance, fs)
+	}
 	if err != nil {
 		log.Error(err, "building deployment objects")
-		return reconcile.Result{}, fmt.Errorf("error building deployment objects: %v", err)
+		return reconcile.Result{}, fmt.Errorf("error building deployment objects: %w", err)
 	}
 	log.WithValues("objects", fmt.Sprintf("%d", len(objects.Items))).Info("built deployment objects")
 
@@ -179,9 +391,12 @@ func (r *Reconciler) reconcileExists(ctx context.Context, name types.NamespacedN
 
 	defer func() {
 		if r.options.status != nil {
-			if err := r.options.status.Reconciled(ctx, instance, objects); err != nil {
+			ctx, span := startSpan(ctx, "UpdateStatus")
+			err := r.options.status.Reconciled(ctx, instance, objects)
+			if err != nil {
 				log.Error(err, "failed to reconcile status")
 			}
+			endSpan(span, err)
 		}
 	}()
 
@@ -192,18 +407,53 @@ func (r *Reconciler) reconcileExists(ctx context.Context, name types.NamespacedN
 		return reconcile.Result{}, fmt.Errorf("error parsing list kind: %v", err)
 	}
 
+	// Objects without a namespace are looked up in the namespace they are applied to, by every step below
+	ns := r.applyNamespace(ctx, name, instance)
+	ctx = contextWithApplyNamespace(ctx, ns)
+
+	if err := r.checkNamespaceScope(ctx, name, instance, objects); err != nil {
+		log.Error(err, "checking namespace scope")
+		return reconcile.Result{}, err
+	}
+
+	if len(r.options.deprecatedAPIs) != 0 {
+		if err := r.reportDeprecatedAPIs(ctx, instance, objects); err != nil {
+			log.Error(err, "reporting deprecated APIs")
+			return reconcile.Result{}, err
+		}
+	}
+
+	if r.options.webhookCertificate != nil && r.options.manifestExporter == nil {
+		var renewAt time.Time
+		renewAt, err = r.injectWebhookCertificate(ctx, name, instance, objects)
+		if err != nil {
+			log.Error(err, "injecting webhook certificate")
+			return reconcile.Result{}, err
+		}
+		defer func() {
+			// Reconcile again to renew the certificate
+			if renewIn := time.Until(renewAt); err == nil && !result.Requeue && (result.RequeueAfter == 0 || renewIn < result.RequeueAfter) {
+				result.RequeueAfter = renewIn
+			}
+		}()
+	}
+
 	err = r.injectOwnerRef(ctx, instance, objects)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
 	var newItems []*manifest.Object
+	var existing []*unstructured.Unstructured
+	live := make(map[string]*unstructured.Unstructured)
+	clusterVersions := make(map[string]string)
 	for _, obj := range objects.Items {
 
-		unstruct, err := GetObjectFromCluster(obj, r)
+		unstruct, err := GetObjectFromCluster(ctx, obj, r)
 		if err != nil && !apierrors.IsNotFound(err) {
 			log.WithValues("name", obj.Name).Error(err, "Unable to get resource")
 		}
+		clusterVersions[objectKey(obj)] = objectVersion(unstruct)
 		if unstruct != nil {
 			annotations := unstruct.GetAnnotations()
 			if _, ok := annotations["addons.k8s.io/ignore"]; ok {
@@ -211,11 +461,47 @@ func (r *Reconciler) reconcileExists(ctx context.Context, name types.NamespacedN
 					"skipping object")
 				continue
 			}
+			existing = append(existing, unstruct)
+			live[objectKey(obj)] = unstruct
 		}
 		newItems = append(newItems, obj)
 	}
 	objects.Items = newItems
 
+	if r.options.adoptionPolicy != "" {
+		if err := r.checkAdoption(ctx, instance, existing); err != nil {
+			log.Error(err, "checking existing objects")
+			return reconcile.Result{}, err
+		}
+		if err := r.annotateManaged(instance, objects.Items); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if err := r.ignoreFields(objects.Items, live); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var found hooks
+	if r.options.lifecycleHooks {
+		found, objects.Items, err = splitHooks(objects.Items)
+		if err != nil {
+			log.Error(err, "finding hooks")
+			return reconcile.Result{}, err
+		}
+	}
+	if r.usesPreDeleteFinalizer() {
+		if err := r.ensureHooksFinalizer(ctx, instance, len(found[HookPreDelete]) != 0 || r.options.teardown); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if r.options.prune {
+		if err := r.excludeKeptFromPrune(ctx, instance, objects.Items); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
 	var manifestStr string
 
 	m, err := objects.JSONManifest()
@@ -225,20 +511,72 @@ func (r *Reconciler) reconcileExists(ctx context.Context, name types.NamespacedN
 	}
 	manifestStr = m
 
-	extraArgs := []string{"--force"}
+	extraArgs := r.applyArgs()
 
+	var pruneArgs []string
 	if r.options.prune {
 		var labels []string
-		for k, v := range r.options.labelMaker(ctx, instance) {
+		for k, v := range r.labelsFor(ctx, instance) {
 			labels = append(labels, fmt.Sprintf("%s=%s", k, v))
 		}
 
-		extraArgs = append(extraArgs, "--prune", "--selector", strings.Join(labels, ","))
+		pruneArgs = []string{"--prune", "--selector", strings.Join(labels, ",")}
+		if r.options.inventoryApplier == nil {
+			pruneArgs = append(pruneArgs, r.pruneWhitelistArgs(ctx)...)
+		}
 	}
 
-	ns := ""
-	if !r.options.preserveNamespace {
-		ns = name.Namespace
+	if r.options.impersonation {
+		user, err := serviceAccountUser(instance, ns)
+		if err != nil {
+			log.Error(err, "finding service account")
+			return reconcile.Result{}, err
+		}
+		ctx = contextWithImpersonation(ctx, user)
+		// The objects are written as the ServiceAccount from now on
+		if r, err = r.impersonating(user); err != nil {
+			log.Error(err, "impersonating service account")
+			return reconcile.Result{}, err
+		}
+	}
+
+	if r.options.pause {
+		paused, err := r.isPaused(instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if paused {
+			ctx, err = r.pause(ctx, instance, ns, objects)
+			return reconcile.Result{}, err
+		}
+		if err := r.clearPreviewCondition(ctx, instance, ConditionPaused); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if r.options.dryRun {
+		if r.isDryRun(instance) {
+			ctx, err = r.dryRun(ctx, instance, ns, objects)
+			return reconcile.Result{}, err
+		}
+		if err := r.clearDryRun(ctx, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if r.options.manifestExporter != nil {
+		if err := r.exportManifest(ctx, instance, objects); err != nil {
+			log.Error(err, "exporting manifest")
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if rollback == nil && len(r.options.migrations) != 0 {
+		if err := r.migrate(ctx, instance, ns, objects); err != nil {
+			log.Error(err, "migrating")
+			return reconcile.Result{}, err
+		}
 	}
 
 	if r.CollectMetrics() {
@@ -256,20 +594,187 @@ func (r *Reconciler) reconcileExists(ctx context.Context, name types.NamespacedN
 		}
 	}
 
-	if err := r.kubectl.Apply(ctx, ns, manifestStr, r.options.validate, extraArgs...); err != nil {
-		log.Error(err, "applying manifest")
-		return reconcile.Result{}, fmt.Errorf("error applying manifest: %v", err)
+	complete := true
+	var failed []ApplyResult
+	applyHash := r.applyHash(ns, manifestStr, extraArgs, pruneArgs)
+	if r.options.skipUnchangedApply && unchangedSinceApply(instance, applyHash, clusterVersions) {
+		log.Info("manifest and cluster objects unchanged since last apply, skipping apply")
+	} else {
+		if r.options.serverSideValidation {
+			if err := r.validateObjects(ctx, ns, objects); err != nil {
+				log.Error(err, "validating objects")
+				return reconcile.Result{}, err
+			}
+		}
+		if r.options.permissionCheck {
+			if err := r.checkPermissions(ctx, instance, ns, objects); err != nil {
+				log.Error(err, "checking permissions")
+				return reconcile.Result{}, err
+			}
+		}
+		if r.options.inventoryApplier != nil {
+			gvk, err := apiutil.GVKForObject(instance, r.client.Scheme())
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			ctx = applier.ContextWithEvents(applier.ContextWithInventory(ctx, applierInventory(instance, gvk)))
+			ctx = applier.ContextWithProtectedKinds(ctx, r.protectedKinds())
+		}
+		if r.options.lifecycleHooks {
+			done, err := r.runHooks(ctx, instance, ns, HookPreApply, found[HookPreApply], applyHash)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			if !done {
+				log.Info("waiting for pre-apply hooks to complete")
+				return reconcile.Result{RequeueAfter: hookRecheckInterval}, nil
+			}
+		}
+		if r.options.prune && r.options.inventoryApplier == nil {
+			ctx = contextWithPruneSet(ctx, instance)
+		}
+		var results []ApplyResult
+		results, complete, err = r.applyObjects(ctx, ns, manifestStr, objects, extraArgs, pruneArgs)
+		if len(r.options.auditSinks) != 0 {
+			version := ""
+			if rollback != nil {
+				version = rollback.Version
+			}
+			r.auditApply(ctx, instance, version, applyHash, objects, results, err)
+		}
+		// Make the outcome for each object available to the status and sink
+		ctx = contextWithApplyResults(ctx, results)
+		if err != nil {
+			failed = partialApplyFailures(results)
+			if !r.options.partialApply || len(failed) == 0 {
+				return reconcile.Result{}, err
+			}
+			log.WithValues("failed", len(failed)).Info("some objects failed to apply, continuing with the objects that were applied")
+		}
+		if complete && len(failed) == 0 && r.options.lifecycleHooks {
+			done, err := r.runHooks(ctx, instance, ns, HookPostApply, found[HookPostApply], applyHash)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			if !done {
+				log.Info("waiting for post-apply hooks to complete")
+				return reconcile.Result{RequeueAfter: hookRecheckInterval}, nil
+			}
+		}
+		if complete && len(failed) == 0 {
+			recordApplied(ctx)
+			for _, u := range prunedFromContext(ctx) {
+				r.recordPruned(ctx, instance, u.GroupVersionKind(), u.GetNamespace(), u.GetName())
+			}
+			if r.options.skipUnchangedApply {
+				if err := r.recordAppliedHash(ctx, instance, applyHash, r.clusterVersions(ctx, objects.Items)); err != nil {
+					log.Error(err, "recording applied hash")
+					return reconcile.Result{}, err
+				}
+			}
+			if r.options.inventory {
+				if err := r.recordInventory(ctx, instance, objects.Items); err != nil {
+					log.Error(err, "recording inventory")
+					return reconcile.Result{}, err
+				}
+			}
+			if rollback != nil {
+				// Keep the history as it was, so the rollback can be undone
+				if err := r.pruneSinceRevision(ctx, instance, ns, rollback, objects); err != nil {
+					log.Error(err, "pruning objects since rolled back revision")
+					return reconcile.Result{}, err
+				}
+			} else if r.options.revisionHistory {
+				if _, err := r.recordRevision(ctx, instance, manifestStr); err != nil {
+					log.Error(err, "recording revision")
+					return reconcile.Result{}, err
+				}
+				if err := r.clearRollback(ctx, instance); err != nil {
+					return reconcile.Result{}, err
+				}
+			}
+			if r.tracksDeployedVersion() {
+				version := specVersion(instance)
+				if rollback != nil {
+					version = rollback.Version
+				}
+				if err := r.recordDeployedVersion(ctx, instance, version); err != nil {
+					log.Error(err, "recording deployed version")
+					return reconcile.Result{}, err
+				}
+			}
+		}
 	}
 
-	if r.options.sink != nil {
-		if err := r.options.sink.Notify(ctx, instance, objects); err != nil {
-			log.Error(err, "notifying sink")
-			return reconcile.Result{}, err
-		}
+	notified = true
+	if len(failed) != 0 {
+		r.notifySinksOfFailure(ctx, instance, objects, fmt.Errorf("%d of %d objects failed to apply", len(failed), len(objects.Items)))
+		return r.recordApplyFailures(ctx, instance, failed, len(objects.Items))
+	}
+	if err := r.notifySinksOfSuccess(ctx, instance, objects); err != nil {
+		log.Error(err, "notifying sinks")
+		return reconcile.Result{}, err
+	}
+	if !complete {
+		// Apply the remaining waves once the current wave is ready
+		return reconcile.Result{RequeueAfter: waveRecheckInterval}, nil
+	}
+	if r.options.waitForReady {
+		return r.waitForReady(ctx, instance, objects)
 	}
 	return reconcile.Result{}, nil
 }
 
+// applyObjects applies the manifest, returning the outcome for each object applied,
+// and false if some apply waves are still to be applied
+func (r *Reconciler) applyObjects(ctx context.Context, ns string, manifestStr string, objects *manifest.Objects, extraArgs []string, pruneArgs []string) ([]ApplyResult, bool, error) {
+	log := log.FromContext(ctx)
+
+	if err := r.ensureNamespace(ctx, ns); err != nil {
+		log.Error(err, "creating namespace")
+		return nil, false, classify(ErrApply, err)
+	}
+
+	if r.options.prerequisitesFirst {
+		if err := r.applyPrerequisites(ctx, ns, objects, extraArgs); err != nil {
+			log.Error(err, "applying prerequisites")
+			return nil, false, classify(ErrApply, err)
+		}
+	}
+
+	if err := r.applyCRDsFirst(ctx, ns, objects, extraArgs); err != nil {
+		log.Error(err, "applying CRDs")
+		return nil, false, classify(ErrApply, err)
+	}
+
+	var results []ApplyResult
+	var err error
+	complete := true
+	if r.options.applyWaves {
+		results, complete, err = r.applyInWaves(ctx, ns, objects, extraArgs, pruneArgs)
+	} else {
+		if len(pruneArgs) != 0 {
+			r.listPruned(ctx, ns, objects.Items)
+		}
+		results, err = r.applyWithResults(ctx, ns, manifestStr, objects.Items, append(extraArgs, pruneArgs...)...)
+	}
+	if err != nil {
+		log.Error(err, "applying manifest")
+		return results, false, classify(ErrApply, fmt.Errorf("error applying manifest: %v", err))
+	}
+
+	if err := r.applyBlobs(ctx, ns, objects.Blobs, extraArgs); err != nil {
+		log.Error(err, "applying manifest")
+		return results, false, classify(ErrApply, err)
+	}
+
+	if definesAPITypes(objects.Items) {
+		// Discover any new kinds before we look up the applied objects
+		r.resetRESTMapper(ctx)
+	}
+	return results, complete, nil
+}
+
 // BuildDeploymentObjects performs all manifest operations to build a final set of objects for deployment
 func (r *Reconciler) BuildDeploymentObjects(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) (*manifest.Objects, error) {
 	return r.BuildDeploymentObjectsWithFs(ctx, name, instance, nil)
@@ -278,7 +783,16 @@ func (r *Reconciler) BuildDeploymentObjects(ctx context.Context, name types.Name
 // BuildDeploymentObjectsWithFs is the implementation of BuildDeploymentObjects, supporting saving to a filesystem for kustomize
 // If fs is provided, the transformed manifests will be saved to that filesystem
 func (r *Reconciler) BuildDeploymentObjectsWithFs(ctx context.Context, name types.NamespacedName, instance DeclarativeObject, fs filesys.FileSystem) (*manifest.Objects, error) {
-	log := log.Log
+	log := log.FromContext(ctx)
+
+	if r.options.valuesFrom {
+		values, err := r.resolveValues(ctx, instance)
+		if err != nil {
+			log.Error(err, "error resolving valuesFrom")
+			return nil, err
+		}
+		ctx = contextWithValues(ctx, values)
+	}
 
 	// 1. Load the manifest
 	manifestFiles, err := r.loadRawManifest(ctx, instance)
@@ -286,16 +800,43 @@ func (r *Reconciler) BuildDeploymentObjectsWithFs(ctx context.Context, name type
 		log.Error(err, "error loading raw manifest")
 		return nil, err
 	}
+
+	var renderKey string
+	if r.renderCache != nil {
+		renderKey, err = renderCacheKey(ctx, instance, manifestFiles)
+		if err != nil {
+			log.Error(err, "error computing render cache key")
+			return nil, err
+		}
+		if objects, found := r.renderCache.get(renderKey); found {
+			log.V(2).Info("using cached objects for unchanged manifest")
+			return objects, nil
+		}
+	}
+
+	if r.options.yttValues != nil {
+		manifestFiles, err = r.renderYtt(ctx, instance, manifestFiles)
+		if err != nil {
+			log.Error(err, "error rendering ytt")
+			return nil, classify(ErrRender, err)
+		}
+	}
+
+	// Files are handled in order of path, so that the objects are always in the same order
+	var manifestPaths []string
+	for manifestPath := range manifestFiles {
+		manifestPaths = append(manifestPaths, manifestPath)
+	}
+	sort.Strings(manifestPaths)
+
 	manifestObjects := &manifest.Objects{}
 	// 2. Perform raw string operations
-	for manifestPath, manifestStr := range manifestFiles {
-		for _, t := range r.options.rawManifestOperations {
-			transformed, err := t(ctx, instance, manifestStr)
-			if err != nil {
-				log.Error(err, "error performing raw manifest operations")
-				return nil, err
-			}
-			manifestStr = transformed
+	for _, manifestPath := range manifestPaths {
+		manifestStr := manifestFiles[manifestPath]
+		manifestStr, err = r.rawManifestOperations(ctx, instance, manifestPath, manifestStr)
+		if err != nil {
+			log.Error(err, "error performing raw manifest operations")
+			return nil, err
 		}
 
 		// 3. Parse manifest into objects
@@ -304,6 +845,7 @@ func (r *Reconciler) BuildDeploymentObjectsWithFs(ctx context.Context, name type
 			log.Error(err, "error parsing manifest")
 			return nil, err
 		}
+		objects.SetSourcePath(manifestPath)
 
 		// 4. Perform object transformations
 		// (unless kustomize is in use, in which case we transform after running kustomize)
@@ -337,21 +879,13 @@ func (r *Reconciler) BuildDeploymentObjectsWithFs(ctx context.Context, name type
 	// Here, the manifest is built using Kustomize and then replaces the Object items with the created manifest
 	if r.IsKustomizeOptionUsed() {
 		// run kustomize to create final manifest
-		opts := krusty.MakeDefaultOptions()
-		k := krusty.MakeKustomizer(fs, opts)
-		m, err := k.Run(manifestObjects.Path)
+		manifestYaml, err := runKustomize(ctx, fs, manifestObjects.Path)
 		if err != nil {
 			log.Error(err, "running kustomize to create final manifest")
-			return nil, fmt.Errorf("error running kustomize: %v", err)
-		}
-
-		manifestYaml, err := m.AsYaml()
-		if err != nil {
-			log.Error(err, "creating final manifest yaml")
-			return nil, fmt.Errorf("error converting kustomize output to yaml: %v", err)
+			return nil, err
 		}
 
-		objects, err := r.parseManifest(ctx, instance, string(manifestYaml))
+		objects, err := r.parseManifest(ctx, instance, manifestYaml)
 		if err != nil {
 			log.Error(err, "creating final manifest yaml")
 			return nil, err
@@ -362,48 +896,127 @@ func (r *Reconciler) BuildDeploymentObjectsWithFs(ctx context.Context, name type
 			return nil, err
 		}
 		manifestObjects.Items = objects.Items
+		// The kustomization files are consumed by kustomize, only the documents it outputs are left
+		manifestObjects.Blobs = objects.Blobs
+	}
+
+	if err := r.checkBlobs(ctx, manifestObjects); err != nil {
+		log.Error(err, "error checking manifest documents")
+		return nil, classify(ErrRender, err)
+	}
+
+	if r.options.multiInstance {
+		if err := r.applyInstanceNames(ctx, instance, manifestObjects); err != nil {
+			log.Error(err, "error renaming objects for instance")
+			return nil, classify(ErrTransform, err)
+		}
+		if err := applyInstanceSelectors(ctx, instance, manifestObjects); err != nil {
+			log.Error(err, "error adding instance labels to selectors")
+			return nil, classify(ErrTransform, err)
+		}
+	}
+
+	if err := r.enforceNamespace(ctx, manifestObjects, r.targetNamespace(ctx, instance)); err != nil {
+		log.Error(err, "error enforcing namespace")
+		return nil, classify(ErrTransform, err)
 	}
 
 	// 6. Sort objects to work around dependent objects in the same manifest (eg: service-account, deployment)
-	manifestObjects.Sort(DefaultObjectOrder(ctx))
+	manifestObjects.Sort(r.objectOrder(ctx))
+
+	// 7. Apply objects after the objects they depend on
+	if err := sortByDependencies(manifestObjects); err != nil {
+		log.Error(err, "error ordering objects by dependencies")
+		return nil, classify(ErrTransform, err)
+	}
+
+	if r.renderCache != nil {
+		r.renderCache.add(renderKey, manifestObjects)
+	}
 
 	return manifestObjects, nil
 }
 
+// rawManifestOperations runs the raw manifest operations on the manifest of the file at path
+func (r *Reconciler) rawManifestOperations(ctx context.Context, instance DeclarativeObject, path string, manifestStr string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "RawManifestOperations", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
+	for _, t := range r.options.rawManifestOperations {
+		manifestStr, err = t(ctx, instance, manifestStr)
+		if err != nil {
+			return "", classify(ErrRender, err)
+		}
+	}
+	return manifestStr, nil
+}
+
 // parseManifest parses the manifest into objects
-func (r *Reconciler) parseManifest(ctx context.Context, instance DeclarativeObject, manifestStr string) (*manifest.Objects, error) {
-	log := log.Log
+func (r *Reconciler) parseManifest(ctx context.Context, instance DeclarativeObject, manifestStr string) (_ *manifest.Objects, err error) {
+	log := log.FromContext(ctx)
+
+	ctx, span := startSpan(ctx, "ParseManifest")
+	defer func() { endSpan(span, err) }()
 
 	objects, err := manifest.ParseObjects(ctx, manifestStr)
 	if err != nil {
 		log.Error(err, "error parsing manifest")
-		return nil, err
+		return nil, classify(ErrRender, err)
 	}
+	span.SetAttributes(attribute.Int("objects", len(objects.Items)))
 
 	return objects, nil
 }
 
+// runKustomize builds the kustomization at path in fs, returning the resulting manifest
+func runKustomize(ctx context.Context, fs filesys.FileSystem, path string) (_ string, err error) {
+	_, span := startSpan(ctx, "Kustomize", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
+	k := krusty.MakeKustomizer(fs, krusty.MakeDefaultOptions())
+	m, err := k.Run(path)
+	if err != nil {
+		return "", classify(ErrRender, fmt.Errorf("error running kustomize: %v", err))
+	}
+
+	manifestYaml, err := m.AsYaml()
+	if err != nil {
+		return "", classify(ErrRender, fmt.Errorf("error converting kustomize output to yaml: %v", err))
+	}
+	return string(manifestYaml), nil
+}
+
 // transformManifest runs any transformations as required
-func (r *Reconciler) transformManifest(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+func (r *Reconciler) transformManifest(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) (err error) {
+	ctx, span := startSpan(ctx, "TransformManifest", attribute.Int("objects", len(objects.Items)))
+	defer func() { endSpan(span, err) }()
+
 	transforms := r.options.objectTransformations
-	if r.options.labelMaker != nil {
-		transforms = append(transforms, AddLabels(r.options.labelMaker(ctx, instance)))
+	if labels := r.labelsFor(ctx, instance); len(labels) != 0 {
+		transforms = append(transforms, AddLabels(labels))
 	}
 	// TODO(jrjohnson): apply namespace here
 	for _, t := range transforms {
 		err := t(ctx, instance, objects)
 		if err != nil {
-			return err
+			return classify(ErrTransform, err)
 		}
 	}
 	return nil
 }
 
 // loadRawManifest loads the raw manifest YAML from the repository
-func (r *Reconciler) loadRawManifest(ctx context.Context, o DeclarativeObject) (map[string]string, error) {
+func (r *Reconciler) loadRawManifest(ctx context.Context, o DeclarativeObject) (_ map[string]string, err error) {
+	ctx, span := startSpan(ctx, "LoadManifest", attribute.Bool("teardown", isTeardown(ctx)))
+	defer func() { endSpan(span, err) }()
+
+	if isTeardown(ctx) {
+		s, err := r.options.manifestController.(TeardownManifestController).ResolveTeardownManifest(ctx, o)
+		return s, classify(ErrManifestLoad, err)
+	}
 	s, err := r.options.manifestController.ResolveManifest(ctx, o)
 	if err != nil {
-		return nil, err
+		return nil, classify(ErrManifestLoad, err)
 	}
 
 	return s, nil
@@ -436,14 +1049,65 @@ func (r *Reconciler) applyOptions(opts ...reconcilerOption) error {
 func (r *Reconciler) validateOptions() error {
 	var errs []string
 
-	if r.options.prune && r.options.labelMaker == nil {
-		errs = append(errs, "WithApplyPrune must be used with the WithLabels option")
+	if r.options.prune && r.options.labelMaker == nil && !r.options.multiInstance && r.options.inventoryApplier == nil {
+		errs = append(errs, "WithApplyPrune must be used with the WithLabels, WithMultiInstance or WithInventoryApplier option")
 	}
 
 	if r.options.manifestController == nil {
 		errs = append(errs, "ManifestController must be set either by configuring DefaultManifestLoader or specifying the WithManifestController option")
 	}
 
+	if _, ok := r.options.manifestController.(TeardownManifestController); r.options.teardown && !ok {
+		errs = append(errs, "WithTeardownManifest must be used with a ManifestController implementing TeardownManifestController")
+	}
+
+	if r.options.shard != nil {
+		if err := r.options.shard.validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("WithSharding: %v", err))
+		}
+	}
+
+	if len(r.options.namespaces) != 0 && r.options.createNamespace != nil {
+		errs = append(errs, "WithCreateNamespace can't be used with the WithNamespaceScope option")
+	}
+	if len(r.options.namespaces) != 0 && r.options.remoteClusters {
+		errs = append(errs, "WithRemoteClusters can't be used with the WithNamespaceScope option")
+	}
+
+	if r.options.applyLimiter != nil && cap(r.options.applyLimiter.slots) <= 0 {
+		errs = append(errs, "WithApplyLimiter must be given an ApplyLimiter allowing at least one apply")
+	}
+
+	if r.options.execApplier != nil && r.options.inventoryApplier != nil {
+		errs = append(errs, "WithExecApplier can't be used with the WithInventoryApplier option")
+	}
+	if r.options.applier != nil && (r.options.execApplier != nil || r.options.inventoryApplier != nil) {
+		errs = append(errs, "WithApplier can't be used with the WithExecApplier or WithInventoryApplier options")
+	}
+	if r.options.applier != nil && r.options.impersonation {
+		errs = append(errs, "WithApplier can't be used with the WithImpersonation option, as the applier may not impersonate")
+	}
+
+	switch r.options.sinkErrorPolicy {
+	case "", SinkErrorsAggregate, SinkErrorsFailFast, SinkErrorsIgnore:
+	default:
+		errs = append(errs, fmt.Sprintf("WithSinkErrorPolicy: unknown policy %q", r.options.sinkErrorPolicy))
+	}
+
+	switch r.options.blobPolicy {
+	case "", BlobsDrop, BlobsError, BlobsPassThrough:
+	default:
+		errs = append(errs, fmt.Sprintf("WithBlobPolicy: unknown policy %q", r.options.blobPolicy))
+	}
+
+	if len(r.options.applyStrategies) != 0 && r.options.inventoryApplier != nil {
+		errs = append(errs, "WithApplyStrategy can't be used with the WithInventoryApplier option")
+	}
+
+	if (r.options.fieldManager != "" || r.options.forceConflicts) && !r.usesServerSideApply() {
+		errs = append(errs, "WithFieldManager and WithForceConflicts must be used with the WithServerSideApply option or a server-side WithApplyStrategy")
+	}
+
 	if len(errs) != 0 {
 		return fmt.Errorf(strings.Join(errs, ","))
 	}
@@ -456,10 +1120,14 @@ func (r *Reconciler) injectOwnerRef(ctx context.Context, instance DeclarativeObj
 		return nil
 	}
 
-	log := log.Log
-	log.WithValues("object", fmt.Sprintf("%s/%s", instance.GetName(), instance.GetNamespace())).Info("injecting owner references")
+	log := log.FromContext(ctx)
+	log.V(1).Info("injecting owner references")
 
 	for _, o := range objects.Items {
+		if keepOnDelete(o) {
+			log.WithValues("object", o).V(2).Info("not injecting owner reference into object kept on delete")
+			continue
+		}
 		owner, err := r.options.ownerFn(ctx, instance, *o, *objects)
 		if err != nil {
 			log.WithValues("object", o).Error(err, "resolving owner ref", o)
@@ -520,7 +1188,8 @@ func (r *Reconciler) IsKustomizeOptionUsed() bool {
 	return false
 }
 
-// SetSink provides a Sink that will be notified for all deployments
+// SetSink provides a Sink that will be notified for all deployments, replacing the one set before.  Use AddSink
+// to add sinks without replacing any.
 func (r *Reconciler) SetSink(sink Sink) {
 	r.options.sink = sink
 }
@@ -564,20 +1233,16 @@ func (r *Reconciler) CollectMetrics() bool {
 	return r.options.metrics
 }
 
-func GetObjectFromCluster(obj *manifest.Object, r *Reconciler) (*unstructured.
-	Unstructured, error) {
-	getOptions := metav1.GetOptions{}
-	gvk := obj.GroupVersionKind()
-
-	mapping, err := r.restMapper.RESTMapping(obj.GroupKind(), gvk.Version)
+// GetObjectFromCluster gets the live object of obj, with the context of the reconcile so it is cancelled with it.
+// Namespaced objects without a namespace are looked up in the namespace the reconcile applies them to.
+func GetObjectFromCluster(ctx context.Context, obj *manifest.Object, r *Reconciler) (*unstructured.Unstructured, error) {
+	resource, err := r.objectResource(ctx, applyNamespaceFromContext(ctx), obj)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get resource: %v", err)
+		return nil, err
 	}
-	ns := obj.UnstructuredObject().GetNamespace()
-	unstruct, err := r.dynamicClient.Resource(mapping.Resource).Namespace(ns).Get(context.Background(),
-		obj.Name, getOptions)
+	unstruct, err := resource.Get(ctx, obj.Name, metav1.GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("unable to get mapping for resource: %v", err)
+		return nil, fmt.Errorf("unable to get resource: %w", err)
 	}
 	return unstruct, nil
 }
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// reconcileTimeRefreshInterval is how often status.lastReconcileTime is refreshed when nothing else in the
+// status changes.  Every status update triggers a reconcile, so refreshing it on every reconcile would never stop.
+const reconcileTimeRefreshInterval = time.Minute
+
+type reconcileOutcomeKey struct{}
+
+// reconcileOutcome is what a reconcile did, for WithReconcileStatus
+type reconcileOutcome struct {
+	applied bool
+}
+
+func contextWithReconcileOutcome(ctx context.Context) context.Context {
+	return context.WithValue(ctx, reconcileOutcomeKey{}, &reconcileOutcome{})
+}
+
+// recordApplied records that the manifest was applied without errors during the reconcile of ctx
+func recordApplied(ctx context.Context) {
+	if outcome, ok := ctx.Value(reconcileOutcomeKey{}).(*reconcileOutcome); ok {
+		outcome.applied = true
+	}
+}
+
+// updateReconcileStatus records when instance was reconciled, and with which error, in its status.
+// reconcileErr is the error of the reconcile, before WithFailureBackoff or terminal errors replace it.
+func (r *Reconciler) updateReconcileStatus(ctx context.Context, instance DeclarativeObject, reconcileErr error, now time.Time) error {
+	obj, err := objectMap(instance)
+	if err != nil {
+		return err
+	}
+	status, _, err := unstructured.NestedMap(obj, "status")
+	if err != nil {
+		return fmt.Errorf("error reading status: %v", err)
+	}
+	if status == nil {
+		status = make(map[string]interface{})
+	}
+	updated := runtime.DeepCopyJSON(status)
+
+	timestamp := now.UTC().Format(time.RFC3339)
+	if reconcileErr != nil {
+		failures, _, _ := unstructured.NestedInt64(status, "consecutiveFailureCount")
+		updated["consecutiveFailureCount"] = failures + 1
+		updated["lastError"] = reconcileErr.Error()
+	} else {
+		delete(updated, "consecutiveFailureCount")
+		delete(updated, "lastError")
+	}
+	if outcome, ok := ctx.Value(reconcileOutcomeKey{}).(*reconcileOutcome); ok && outcome.applied && reconcileErr == nil {
+		updated["lastSuccessfulApplyTime"] = timestamp
+	}
+
+	last, _, _ := unstructured.NestedString(status, "lastReconcileTime")
+	lastTime, err := time.Parse(time.RFC3339, last)
+	if reflect.DeepEqual(status, updated) && err == nil && now.Sub(lastTime) < reconcileTimeRefreshInterval {
+		return nil
+	}
+	updated["lastReconcileTime"] = timestamp
+
+	if err := unstructured.SetNestedMap(obj, updated, "status"); err != nil {
+		return fmt.Errorf("error setting status: %v", err)
+	}
+	if _, ok := instance.(*unstructured.Unstructured); !ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, instance); err != nil {
+			return fmt.Errorf("error converting object from unstructured: %v", err)
+		}
+	}
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	return nil
+}
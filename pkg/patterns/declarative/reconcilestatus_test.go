@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUpdateReconcileStatus(t *testing.T) {
+	instance := newGuestbook("default", "test", time.Now())
+	r := &Reconciler{client: fake.NewClientBuilder().WithObjects(instance).Build()}
+	name := types.NamespacedName{Namespace: "default", Name: "test"}
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	get := func() map[string]interface{} {
+		t.Helper()
+		updated := &unstructured.Unstructured{}
+		updated.SetGroupVersionKind(instance.GroupVersionKind())
+		if err := r.client.Get(context.Background(), name, updated); err != nil {
+			t.Fatalf("error getting instance: %v", err)
+		}
+		status, _, _ := unstructured.NestedMap(updated.Object, "status")
+		return status
+	}
+
+	// Two failed reconciles
+	for i := 0; i < 2; i++ {
+		if err := r.updateReconcileStatus(context.Background(), instance, errors.New("apply failed"), start); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	status := get()
+	if status["consecutiveFailureCount"] != int64(2) || status["lastError"] != "apply failed" {
+		t.Errorf("expected two failures to be recorded, got %v", status)
+	}
+	if status["lastReconcileTime"] != "2021-06-01T12:00:00Z" || status["lastSuccessfulApplyTime"] != nil {
+		t.Errorf("unexpected times %v", status)
+	}
+
+	// A successful apply resets the failures
+	ctx := contextWithReconcileOutcome(context.Background())
+	recordApplied(ctx)
+	if err := r.updateReconcileStatus(ctx, instance, nil, start.Add(time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	status = get()
+	if _, found := status["consecutiveFailureCount"]; found {
+		t.Errorf("expected failures to be reset, got %v", status)
+	}
+	if _, found := status["lastError"]; found {
+		t.Errorf("expected error to be cleared, got %v", status)
+	}
+	if status["lastSuccessfulApplyTime"] != "2021-06-01T12:00:01Z" || status["lastReconcileTime"] != "2021-06-01T12:00:01Z" {
+		t.Errorf("unexpected times %v", status)
+	}
+
+	// lastReconcileTime alone is only refreshed after reconcileTimeRefreshInterval
+	if err := r.updateReconcileStatus(context.Background(), instance, nil, start.Add(30*time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := get(); status["lastReconcileTime"] != "2021-06-01T12:00:01Z" {
+		t.Errorf("expected lastReconcileTime not to be refreshed, got %v", status["lastReconcileTime"])
+	}
+	if err := r.updateReconcileStatus(context.Background(), instance, nil, start.Add(2*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := get(); status["lastReconcileTime"] != "2021-06-01T12:02:00Z" || status["lastSuccessfulApplyTime"] != "2021-06-01T12:00:01Z" {
+		t.Errorf("expected only lastReconcileTime to be refreshed, got %v", status)
+	}
+}
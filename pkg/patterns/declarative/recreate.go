@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// immutableFieldErrors are found in the errors of the API server for changes to immutable fields
+var immutableFieldErrors = []string{
+	"field is immutable",
+	"may not change once set",
+	"Forbidden: updates to",
+}
+
+// statefulKinds are never recreated by WithRecreateOnImmutableChange, besides the protected kinds
+var statefulKinds = []schema.GroupKind{
+	{Group: "apps", Kind: "StatefulSet"},
+}
+
+// isImmutableFieldError returns true if message reports a change to an immutable field
+func isImmutableFieldError(message string) bool {
+	for _, s := range immutableFieldErrors {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// immutableFieldChanged returns true if message reports a change to an immutable field of o itself, such as
+// `The Deployment "app" is invalid: spec.selector: ... field is immutable`.  The message may be the error of the
+// whole apply, reporting the errors of other objects, which must not be recreated for them.
+func immutableFieldChanged(o *manifest.Object, message string) bool {
+	quoted := fmt.Sprintf("%q", o.Name)
+	for _, line := range strings.Split(message, "\n") {
+		if strings.Contains(line, o.Kind) && strings.Contains(line, quoted) && isImmutableFieldError(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// canRecreate returns true if o may be deleted and recreated with WithRecreateOnImmutableChange
+func (r *Reconciler) canRecreate(o *manifest.Object) bool {
+	return !r.isProtected(o) && !keepOnDelete(o) && !containsGroupKind(statefulKinds, o.GroupKind())
+}
+
+// recreateImmutable deletes the objects that failed to apply because immutable fields changed, so that they are
+// recreated by applying them again.  It returns true if any objects were deleted.
+func (r *Reconciler) recreateImmutable(ctx context.Context, ns string, objects []*manifest.Object, results []ApplyResult) (bool, error) {
+	log := log.FromContext(ctx)
+
+	deleted := false
+	for i, result := range results {
+		o := objects[i]
+		if result.Operation != ApplyFailed || !immutableFieldChanged(o, result.Message) {
+			continue
+		}
+		if !r.canRecreate(o) {
+			log.WithValues("kind", o.Kind).WithValues("name", o.Name).Info("immutable fields changed, but not recreating object of a stateful kind")
+			continue
+		}
+		log.WithValues("kind", o.Kind).WithValues("name", o.Name).Info("immutable fields changed, recreating object")
+		if err := r.deleteObject(ctx, ns, o); err != nil {
+			return deleted, err
+		}
+		deleted = true
+	}
+	return deleted, nil
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// immutableApplier fails the first apply with an immutable field error for the object named failing
+type immutableApplier struct {
+	kind    string
+	failing string
+	applies int
+}
+
+func (a *immutableApplier) Apply(ctx context.Context, namespace string, manifest string, validate bool, args ...string) error {
+	_, err := a.ApplyWithResults(ctx, namespace, manifest, validate, args...)
+	return err
+}
+
+func (a *immutableApplier) ApplyWithResults(ctx context.Context, namespace string, manifest string, validate bool, args ...string) (*applier.Results, error) {
+	a.applies++
+	if a.applies > 1 {
+		return &applier.Results{}, nil
+	}
+	return &applier.Results{Errors: []string{
+		fmt.Sprintf(`The %s %q is invalid: spec.selector: Invalid value: {}: field is immutable`, a.kind, a.failing),
+	}}, errors.New("exit status 1")
+}
+
+func TestRecreateOnImmutableChange(t *testing.T) {
+	tests := []struct {
+		name          string
+		kind          string
+		group         string
+		resource      string
+		expectDeleted bool
+	}{
+		{name: "deployment", kind: "Deployment", group: "apps", resource: "deployments", expectDeleted: true},
+		{name: "statefulset", kind: "StatefulSet", group: "apps", resource: "statefulsets"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			objects, err := manifest.ParseObjects(ctx, fmt.Sprintf(`
+apiVersion: %s/v1
+kind: %s
+metadata:
+  name: app
+  namespace: default
+`, test.group, test.kind))
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+
+			gvk := schema.GroupVersionKind{Group: test.group, Version: "v1", Kind: test.kind}
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(gvk, meta.RESTScopeNamespace)
+			existing := &unstructured.Unstructured{}
+			existing.SetGroupVersionKind(gvk)
+			existing.SetNamespace("default")
+			existing.SetName("app")
+
+			kubectl := &immutableApplier{kind: test.kind, failing: "app"}
+			r := &Reconciler{
+				kubectl:       kubectl,
+				restMapper:    mapper,
+				dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing),
+			}
+			r.options = WithRecreateOnImmutableChange()(r.options)
+
+			_, err = r.applyWithResults(ctx, "default", "", objects.Items)
+			if test.expectDeleted != (err == nil) {
+				t.Errorf("expected recreated %v, got error %v", test.expectDeleted, err)
+			}
+
+			gvr := schema.GroupVersionResource{Group: test.group, Version: "v1", Resource: test.resource}
+			_, err = r.dynamicClient.Resource(gvr).Namespace("default").Get(ctx, "app", metav1.GetOptions{})
+			if deleted := apierrors.IsNotFound(err); deleted != test.expectDeleted {
+				t.Errorf("expected deleted %v, got %v", test.expectDeleted, deleted)
+			}
+			if test.expectDeleted && kubectl.applies != 2 {
+				t.Errorf("expected the manifest to be applied again, got %d applies", kubectl.applies)
+			}
+		})
+	}
+}
+
+// aggregatedErrorApplier fails the first apply with an error for the whole apply, reporting an immutable field
+// error for the object named failing only
+type aggregatedErrorApplier struct {
+	failing string
+	applies int
+}
+
+func (a *aggregatedErrorApplier) Apply(ctx context.Context, namespace string, manifest string, validate bool, args ...string) error {
+	a.applies++
+	if a.applies > 1 {
+		return nil
+	}
+	return fmt.Errorf("error from apply: The Deployment %q is invalid: spec.selector: Invalid value: {}: field is immutable\nexit status 1", a.failing)
+}
+
+func TestRecreateOnlyObjectsWithImmutableChange(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: other
+  namespace: default
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+	var existing []runtime.Object
+	for _, name := range []string{"app", "other"} {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		u.SetNamespace("default")
+		u.SetName(name)
+		existing = append(existing, u)
+	}
+
+	r := &Reconciler{
+		kubectl:       &aggregatedErrorApplier{failing: "app"},
+		restMapper:    mapper,
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing...),
+	}
+	r.options = WithRecreateOnImmutableChange()(r.options)
+
+	if _, err := r.applyWithResults(ctx, "default", "", objects.Items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	for name, expectDeleted := range map[string]bool{"app": true, "other": false} {
+		_, err := r.dynamicClient.Resource(gvr).Namespace("default").Get(ctx, name, metav1.GetOptions{})
+		if deleted := apierrors.IsNotFound(err); deleted != expectDeleted {
+			t.Errorf("expected %s deleted %v, got %v", name, expectDeleted, deleted)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+)
+
+const (
+	// KubeconfigArgPrefix prefixes the kubeconfig of the cluster the manifest is applied to, like kubectl --kubeconfig
+	KubeconfigArgPrefix = applier.KubeconfigArgPrefix
+
+	// DefaultKubeconfigKey is the key of the kubeconfig in the Secret, unless spec.kubeconfigSecretRef.key is set.
+	// It is the key used by Cluster API.
+	DefaultKubeconfigKey = "value"
+
+	// RemoteClusterFinalizer is added to DeclarativeObjects applied to a remote cluster, and removed once their
+	// objects have been deleted from the remote cluster
+	RemoteClusterFinalizer = "addons.k8s.io/remote-cluster"
+
+	// ReasonInvalidCluster is the reason for a true ConditionStalled when the cluster targeted by a
+	// DeclarativeObject can't be found
+	ReasonInvalidCluster = "InvalidCluster"
+)
+
+// errKubeconfigNotFound is returned by forTargetCluster when the kubeconfig Secret of the remote cluster doesn't exist
+var errKubeconfigNotFound = errors.New("kubeconfig secret not found")
+
+// remoteCluster holds the clients of a cluster targeted by DeclarativeObjects with WithRemoteClusters
+type remoteCluster struct {
+	resourceVersion string
+	kubeconfig      []byte
+	config          *rest.Config
+	dynamicClient   dynamic.Interface
+	restMapper      meta.RESTMapper
+}
+
+// remoteClusters caches the clients of remote clusters by kubeconfig Secret, until the Secret changes
+type remoteClusters struct {
+	mutex    sync.Mutex
+	clusters map[types.NamespacedName]*remoteCluster
+}
+
+func newRemoteClusters() *remoteClusters {
+	return &remoteClusters{clusters: make(map[types.NamespacedName]*remoteCluster)}
+}
+
+// get returns the clients of the cluster of the kubeconfig in secret
+func (c *remoteClusters) get(secret *corev1.Secret, key string) (*remoteCluster, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	name := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+	if cluster, ok := c.clusters[name]; ok {
+		if cluster.resourceVersion == secret.ResourceVersion {
+			return cluster, nil
+		}
+		delete(c.clusters, name)
+	}
+
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no key %q", name, key)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig from secret %s: %v", name, err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &remoteCluster{
+		resourceVersion: secret.ResourceVersion,
+		kubeconfig:      data,
+		config:          config,
+		dynamicClient:   dynamicClient,
+		restMapper:      restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+	}
+	c.clusters[name] = cluster
+	return cluster, nil
+}
+
+// kubeconfigSecret returns the name of the Secret with the kubeconfig of the cluster targeted by instance, and its
+// key: spec.kubeconfigSecretRef, or the <name>-kubeconfig Secret of the Cluster API Cluster named in
+// spec.clusterName.  It returns false if instance targets the cluster of the operator.
+func kubeconfigSecret(instance DeclarativeObject) (types.NamespacedName, string, bool, error) {
+	obj, err := objectMap(instance)
+	if err != nil {
+		return types.NamespacedName{}, "", false, err
+	}
+	name, _, _ := unstructured.NestedString(obj, "spec", "kubeconfigSecretRef", "name")
+	key, _, _ := unstructured.NestedString(obj, "spec", "kubeconfigSecretRef", "key")
+	cluster, _, _ := unstructured.NestedString(obj, "spec", "clusterName")
+	switch {
+	case name != "" && cluster != "":
+		return types.NamespacedName{}, "", false, NewTerminalError(ReasonInvalidCluster,
+			fmt.Errorf("only one of spec.kubeconfigSecretRef and spec.clusterName can be set"))
+	case cluster != "":
+		name = cluster + "-kubeconfig"
+	case name == "":
+		return types.NamespacedName{}, "", false, nil
+	}
+	if key == "" {
+		key = DefaultKubeconfigKey
+	}
+	return types.NamespacedName{Namespace: instance.GetNamespace(), Name: name}, key, true, nil
+}
+
+// forTargetCluster returns the reconciler applying the manifest of instance to the cluster it targets: r for the
+// cluster of the operator, or a copy of r using the clients of a remote cluster.  The DeclarativeObject and its
+// status are still read and updated in the cluster of the operator.  The kubeconfig of a remote cluster is
+// written to a file for kubectl, which must be removed with removeKubeconfig once the reconcile is done.
+func (r *Reconciler) forTargetCluster(ctx context.Context, instance DeclarativeObject) (*Reconciler, error) {
+	secretName, key, remote, err := kubeconfigSecret(instance)
+	if err != nil || !remote {
+		return r, err
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.client.Get(ctx, secretName, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("error getting kubeconfig secret %s: %w", secretName, errKubeconfigNotFound)
+		}
+		return nil, fmt.Errorf("error getting kubeconfig secret %s: %v", secretName, err)
+	}
+	cluster, err := r.remoteClusters.get(secret, key)
+	if err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).WithValues("kubeconfig", secretName.String()).V(2).Info("reconciling remote cluster")
+
+	target := *r
+	// Owner references to the DeclarativeObject would get the objects garbage collected by the remote cluster
+	target.options.ownerFn = nil
+	target.config = cluster.config
+	target.dynamicClient = cluster.dynamicClient
+	target.restMapper = cluster.restMapper
+
+	f, err := ioutil.TempFile("", "kubeconfig-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubeconfig file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(cluster.kubeconfig); err != nil {
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("error writing kubeconfig file: %v", err)
+	}
+	target.kubeconfig = f.Name()
+	return &target, nil
+}
+
+// forgetRemoteCluster removes the finalizers of a DeclarativeObject being deleted whose kubeconfig Secret is gone, as
+// when Cluster API deletes it along with the Cluster.  The objects are assumed to be gone with the cluster, and the
+// pre-delete hooks, which run in the remote cluster, are skipped.
+func (r *Reconciler) forgetRemoteCluster(ctx context.Context, instance DeclarativeObject) error {
+	log.FromContext(ctx).Info("kubeconfig secret of the remote cluster is gone, not deleting the remote objects")
+	for _, finalizer := range []string{HooksFinalizer, RemoteClusterFinalizer} {
+		if err := r.ensureFinalizer(ctx, instance, finalizer, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeKubeconfig removes the kubeconfig file written by forTargetCluster, if r targets a remote cluster
+func (r *Reconciler) removeKubeconfig() error {
+	if r.kubeconfig == "" {
+		return nil
+	}
+	if err := os.Remove(r.kubeconfig); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing kubeconfig file: %v", err)
+	}
+	return nil
+}
+
+// kubeconfigArgs returns the args applying the manifest to the cluster targeted by r
+func (r *Reconciler) kubeconfigArgs() []string {
+	if r.kubeconfig == "" {
+		return nil
+	}
+	return []string{KubeconfigArgPrefix + r.kubeconfig}
+}
+
+// deleteRemoteObjects deletes the objects of instance from the remote cluster, as they aren't garbage collected
+// with the DeclarativeObject.  Objects kept on delete and of the protected kinds are kept.
+func (r *Reconciler) deleteRemoteObjects(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) error {
+	if r.kubeconfig == "" {
+		// The DeclarativeObject no longer targets a remote cluster
+		return nil
+	}
+	objects, err := r.buildObjectsForHooks(ctx, name, instance)
+	if err != nil {
+		return err
+	}
+	ns := r.applyNamespace(ctx, name, instance)
+	for _, o := range objects.Items {
+		if keepOnDelete(o) || r.isProtected(o) {
+			continue
+		}
+		if err := r.deleteObject(ctx, ns, o); err != nil {
+			return err
+		}
+	}
+	log.FromContext(ctx).WithValues("objects", len(objects.Items)).Info("deleted objects from remote cluster")
+	return nil
+}
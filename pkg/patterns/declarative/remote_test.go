@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: https://remote.example.org
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+current-context: remote
+users:
+- name: remote
+  user:
+    token: secret
+`
+
+func TestKubeconfigSecret(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      map[string]interface{}
+		expected  types.NamespacedName
+		key       string
+		remote    bool
+		expectErr bool
+	}{
+		{name: "local"},
+		{
+			name:     "secret",
+			spec:     map[string]interface{}{"kubeconfigSecretRef": map[string]interface{}{"name": "fleet", "key": "config"}},
+			expected: types.NamespacedName{Namespace: "default", Name: "fleet"},
+			key:      "config",
+			remote:   true,
+		},
+		{
+			name:     "cluster api cluster",
+			spec:     map[string]interface{}{"clusterName": "workload"},
+			expected: types.NamespacedName{Namespace: "default", Name: "workload-kubeconfig"},
+			key:      DefaultKubeconfigKey,
+			remote:   true,
+		},
+		{
+			name: "both",
+			spec: map[string]interface{}{
+				"clusterName":         "workload",
+				"kubeconfigSecretRef": map[string]interface{}{"name": "fleet"},
+			},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instance := newGuestbook("default", "test", time.Now())
+			if test.spec != nil {
+				instance.Object["spec"] = test.spec
+			}
+			name, key, remote, err := kubeconfigSecret(instance)
+			if test.expectErr != IsTerminalError(err) {
+				t.Fatalf("expected terminal error %v, got %v", test.expectErr, err)
+			}
+			if name != test.expected || key != test.key || remote != test.remote {
+				t.Errorf("expected %v, %q, %v, got %v, %q, %v", test.expected, test.key, test.remote, name, key, remote)
+			}
+		})
+	}
+}
+
+func TestForTargetCluster(t *testing.T) {
+	ctx := context.Background()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "workload-kubeconfig", ResourceVersion: "1"},
+		Data:       map[string][]byte{DefaultKubeconfigKey: []byte(testKubeconfig)},
+	}
+	r := &Reconciler{
+		client:         fake.NewClientBuilder().WithObjects(secret).Build(),
+		remoteClusters: newRemoteClusters(),
+	}
+	r.options = WithOwner(func(ctx context.Context, instance DeclarativeObject, o manifest.Object, objects manifest.Objects) (DeclarativeObject, error) {
+		return instance, nil
+	})(r.options)
+
+	instance := newGuestbook("default", "test", time.Now())
+	instance.Object["spec"] = map[string]interface{}{"clusterName": "workload"}
+	target, err := r.forTargetCluster(ctx, instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target == r || target.options.ownerFn != nil || r.options.ownerFn == nil {
+		t.Errorf("expected a copy of the reconciler without owner references")
+	}
+	args := target.kubeconfigArgs()
+	if len(args) != 1 {
+		t.Fatalf("expected a kubeconfig arg, got %v", args)
+	}
+	b, err := ioutil.ReadFile(target.kubeconfig)
+	if err != nil || string(b) != testKubeconfig {
+		t.Errorf("expected the kubeconfig to be written, got %q, %v", b, err)
+	}
+
+	if err := target.removeKubeconfig(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(target.kubeconfig); !os.IsNotExist(err) {
+		t.Errorf("expected the kubeconfig to be removed, got %v", err)
+	}
+
+	again, err := r.forTargetCluster(ctx, instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer again.removeKubeconfig()
+	if again.dynamicClient != target.dynamicClient {
+		t.Errorf("expected the cached cluster to be reused")
+	}
+
+	local, err := r.forTargetCluster(ctx, newGuestbook("default", "local", time.Now()))
+	if err != nil || local != r {
+		t.Errorf("expected the reconciler for a local object, got %v", err)
+	}
+	if err := local.removeKubeconfig(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestForgetRemoteCluster(t *testing.T) {
+	ctx := context.Background()
+	instance := deleting(newGuestbook("default", "test", time.Now()))
+	instance.Object["spec"] = map[string]interface{}{"clusterName": "deleted"}
+	instance.SetFinalizers([]string{HooksFinalizer, RemoteClusterFinalizer, ExportFinalizer})
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scheme.AddKnownTypeWithName(instance.GroupVersionKind(), &unstructured.Unstructured{})
+	r := &Reconciler{
+		client:         fake.NewClientBuilder().WithScheme(scheme).WithObjects(instance).Build(),
+		remoteClusters: newRemoteClusters(),
+	}
+
+	// Cluster API deletes the kubeconfig Secret along with the Cluster
+	_, err := r.forTargetCluster(ctx, instance)
+	if !errors.Is(err, errKubeconfigNotFound) {
+		t.Fatalf("expected the kubeconfig secret not to be found, got %v", err)
+	}
+	if err := r.forgetRemoteCluster(ctx, instance); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := &unstructured.Unstructured{}
+	got.SetGroupVersionKind(instance.GroupVersionKind())
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{ExportFinalizer}; !reflect.DeepEqual(got.GetFinalizers(), expected) {
+		t.Errorf("expected finalizers %v, got %v", expected, got.GetFinalizers())
+	}
+}
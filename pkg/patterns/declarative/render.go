@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/yaml"
+)
+
+// NewRenderCommand returns a command that prints the manifest r would apply for a DeclarativeObject read from a
+// YAML file, after all manifest operations, object transforms and kustomize, without connecting to a cluster.
+// r is configured with prototype and opts, as Init would; options that read from the cluster aren't supported.
+func NewRenderCommand(r *Reconciler, prototype DeclarativeObject, opts ...reconcilerOption) *cobra.Command {
+	var filename string
+	cmd := &cobra.Command{
+		Use:   "render -f FILENAME",
+		Short: "Print the manifest that would be applied for a custom resource",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := r.initForRender(prototype, opts...); err != nil {
+				return err
+			}
+			instance, err := readDeclarativeObject(prototype, filename, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			return r.Render(cmd.Context(), cmd.OutOrStdout(), instance)
+		},
+	}
+	cmd.Flags().StringVarP(&filename, "filename", "f", "", "file containing the custom resource, or - to read it from stdin")
+	_ = cmd.MarkFlagRequired("filename")
+	return cmd
+}
+
+// Render writes the objects that would be applied for instance to w, as a multi-document YAML manifest
+func (r *Reconciler) Render(ctx context.Context, w io.Writer, instance DeclarativeObject) error {
+	var fs filesys.FileSystem
+	if r.IsKustomizeOptionUsed() {
+		fs = filesys.MakeFsInMemory()
+	}
+	name := types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}
+	objects, err := r.BuildDeploymentObjectsWithFs(ctx, name, instance, fs)
+	if err != nil {
+		return fmt.Errorf("error building deployment objects: %w", err)
+	}
+
+	for _, o := range objects.Items {
+		j, err := o.JSON()
+		if err != nil {
+			return fmt.Errorf("error serializing %s %s: %v", o.Kind, o.Name, err)
+		}
+		y, err := yaml.JSONToYAML(j)
+		if err != nil {
+			return fmt.Errorf("error converting %s %s to YAML: %v", o.Kind, o.Name, err)
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initForRender configures r with the options, without a manager
+func (r *Reconciler) initForRender(prototype DeclarativeObject, opts ...reconcilerOption) error {
+	r.prototype = prototype
+	if err := r.applyOptions(opts...); err != nil {
+		return err
+	}
+	if r.options.manifestController == nil {
+		return fmt.Errorf("ManifestController must be set either by configuring DefaultManifestLoader or specifying the WithManifestController option")
+	}
+	if r.options.valuesFrom {
+		return fmt.Errorf("WithValuesFrom reads values from the cluster, so can't be used when rendering")
+	}
+	return nil
+}
+
+// readDeclarativeObject reads a DeclarativeObject of the kind of prototype from a YAML file, or stdin if filename is -
+func readDeclarativeObject(prototype DeclarativeObject, filename string, stdin io.Reader) (DeclarativeObject, error) {
+	var b []byte
+	var err error
+	if filename == "-" {
+		b, err = ioutil.ReadAll(stdin)
+	} else {
+		b, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+
+	instance, ok := prototype.DeepCopyObject().(DeclarativeObject)
+	if !ok {
+		return nil, fmt.Errorf("prototype %T is not a DeclarativeObject", prototype)
+	}
+	if err := yaml.Unmarshal(b, instance); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	return instance, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestRenderCommand(t *testing.T) {
+	cr := `apiVersion: addons.example.org/v1alpha1
+kind: Guestbook
+metadata:
+  name: test
+  namespace: default
+spec:
+  channel: stable
+`
+	filename := filepath.Join(t.TempDir(), "guestbook.yaml")
+	if err := ioutil.WriteFile(filename, []byte(cr), 0644); err != nil {
+		t.Fatalf("error writing custom resource: %v", err)
+	}
+
+	manifests := staticManifest{"manifest.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"}
+	addChannel := func(ctx context.Context, instance DeclarativeObject, objects *manifest.Objects) error {
+		channel, _, _ := unstructured.NestedString(instance.(*unstructured.Unstructured).Object, "spec", "channel")
+		for _, o := range objects.Items {
+			o.AddLabels(map[string]string{"channel": channel})
+		}
+		return nil
+	}
+
+	prototype := &unstructured.Unstructured{}
+	prototype.SetAPIVersion("addons.example.org/v1alpha1")
+	prototype.SetKind("Guestbook")
+
+	cmd := NewRenderCommand(&Reconciler{}, prototype, WithManifestController(manifests), WithObjectTransform(addChannel))
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"-f", filename})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    channel: stable
+  name: config
+`
+	if out.String() != expected {
+		t.Errorf("expected output\n%s\ngot\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// renderCache holds the objects built for recent combinations of raw manifest and DeclarativeObject
+type renderCache struct {
+	cache *cache.LRUExpireCache
+	ttl   time.Duration
+}
+
+func newRenderCache(size int, ttl time.Duration) *renderCache {
+	return &renderCache{
+		cache: cache.NewLRUExpireCache(size),
+		ttl:   ttl,
+	}
+}
+
+// get returns a copy of the cached objects, which the caller is free to mutate
+func (c *renderCache) get(key string) (*manifest.Objects, bool) {
+	v, found := c.cache.Get(key)
+	if !found {
+		return nil, false
+	}
+	return v.(*manifest.Objects).DeepCopy(), true
+}
+
+func (c *renderCache) add(key string, objects *manifest.Objects) {
+	c.cache.Add(key, objects.DeepCopy(), c.ttl)
+}
+
+// renderCacheKey hashes everything the built objects are derived from: the raw manifest
+// (which identifies the channel version), the spec and identity of the DeclarativeObject,
+// and any values resolved by WithValuesFrom.
+func renderCacheKey(ctx context.Context, instance DeclarativeObject, manifestFiles map[string]string) (string, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(instance)
+	if err != nil {
+		return "", fmt.Errorf("error converting object to unstructured: %v", err)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"apiVersion":  u["apiVersion"],
+		"kind":        u["kind"],
+		"name":        instance.GetName(),
+		"namespace":   instance.GetNamespace(),
+		"labels":      instance.GetLabels(),
+		"annotations": instance.GetAnnotations(),
+		"spec":        u["spec"],
+		"values":      ValuesFromContext(ctx),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error building render cache key: %v", err)
+	}
+
+	h := sha256.New()
+	h.Write(b)
+
+	var paths []string
+	for path := range manifestFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(h, "\n%s\n%d\n", path, len(manifestFiles[path]))
+		h.Write([]byte(manifestFiles[path]))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+type staticManifest map[string]string
+
+func (m staticManifest) ResolveManifest(ctx context.Context, object runtime.Object) (map[string]string, error) {
+	return m, nil
+}
+
+func TestRenderCache(t *testing.T) {
+	ctx := context.Background()
+
+	transforms := 0
+	countTransforms := func(ctx context.Context, o DeclarativeObject, objects *manifest.Objects) error {
+		transforms++
+		return nil
+	}
+
+	manifests := staticManifest{"manifest.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"}
+	r := &Reconciler{
+		options: reconcilerParams{
+			manifestController:    manifests,
+			objectTransformations: []ObjectTransform{countTransforms},
+		},
+		renderCache: newRenderCache(10, time.Hour),
+	}
+
+	instance := newGuestbook("default", "test", time.Now())
+	name := types.NamespacedName{Namespace: "default", Name: "test"}
+
+	build := func() *manifest.Objects {
+		objects, err := r.BuildDeploymentObjects(ctx, name, instance)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return objects
+	}
+
+	first := build()
+	// Mutations by the caller must not leak into the cache
+	first.Items[0].SetName("mutated")
+
+	second := build()
+	if transforms != 1 {
+		t.Errorf("expected cached objects to be used, but objects were transformed %d times", transforms)
+	}
+	if second.Items[0].Name != "config" {
+		t.Errorf("expected cached object to be unaffected by mutation, got name %q", second.Items[0].Name)
+	}
+
+	instance.Object["spec"] = map[string]interface{}{"version": "v2"}
+	build()
+	if transforms != 2 {
+		t.Errorf("expected objects to be rebuilt after spec change, transformed %d times", transforms)
+	}
+
+	manifests["manifest.yaml"] = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config2\n"
+	if objects := build(); objects.Items[0].Name != "config2" {
+		t.Errorf("expected objects to be rebuilt after manifest change, got %q", objects.Items[0].Name)
+	}
+	if transforms != 3 {
+		t.Errorf("expected objects to be rebuilt after manifest change, transformed %d times", transforms)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// newDiscoveryRESTMapper returns a RESTMapper caching discovery in memory until it is reset.  The RESTMapper of a
+// controller-runtime v0.8 manager can't be reset, so kinds added by the CRDs and APIServices we apply would not
+// be found until it reloads discovery on its own.
+func newDiscoveryRESTMapper(config *rest.Config) (meta.RESTMapper, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)), nil
+}
+
+type discoveryRefreshKey struct{}
+
+// discoveryRefresh records whether discovery was refreshed during a reconcile
+type discoveryRefresh struct {
+	mutex     sync.Mutex
+	refreshed bool
+}
+
+// contextWithDiscoveryRefresh limits the discovery refreshes for unknown kinds to one during the reconcile of ctx
+func contextWithDiscoveryRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, discoveryRefreshKey{}, &discoveryRefresh{})
+}
+
+// restMapping maps gk to a resource.  If gk is not known, discovery is refreshed and the mapping retried once, as
+// gk may have just been created by a CRD or APIService we applied.  Discovery is refreshed at most once per
+// reconcile, so objects of a kind that isn't served don't each reload it.  applyCRDsFirst waits for CRDs to be
+// established before their custom resources are mapped, so there is nothing to wait for here.
+func (r *Reconciler) restMapping(ctx context.Context, gk schema.GroupKind, version string) (*meta.RESTMapping, error) {
+	mapping, err := r.restMapper.RESTMapping(gk, version)
+	if err == nil || !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+
+	if refresh, ok := ctx.Value(discoveryRefreshKey{}).(*discoveryRefresh); ok {
+		refresh.mutex.Lock()
+		refreshed := refresh.refreshed
+		refresh.mutex.Unlock()
+		if refreshed {
+			return nil, err
+		}
+	}
+
+	log.FromContext(ctx).WithValues("kind", gk.String()).V(1).Info("kind not found, refreshing discovery")
+	r.resetRESTMapper(ctx)
+	return r.restMapper.RESTMapping(gk, version)
+}
+
+// resetRESTMapper invalidates any cached discovery information in the RESTMapper, if it can be reset.  Kinds that
+// are still unknown afterwards aren't looked up again during the reconcile of ctx.
+func (r *Reconciler) resetRESTMapper(ctx context.Context) {
+	if resettable, ok := r.restMapper.(interface{ Reset() }); ok {
+		resettable.Reset()
+	}
+	if refresh, ok := ctx.Value(discoveryRefreshKey{}).(*discoveryRefresh); ok {
+		refresh.mutex.Lock()
+		refresh.refreshed = true
+		refresh.mutex.Unlock()
+	}
+}
+
+// definesAPITypes returns true if objects include CRDs or APIServices, which add new kinds to the cluster
+func definesAPITypes(objects []*manifest.Object) bool {
+	for _, o := range objects {
+		if (o.Group == "apiextensions.k8s.io" && o.Kind == "CustomResourceDefinition") ||
+			(o.Group == "apiregistration.k8s.io" && o.Kind == "APIService") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resettableMapper only knows about its kinds after it has been reset
+type resettableMapper struct {
+	meta.RESTMapper
+	resets int
+}
+
+func (m *resettableMapper) Reset() {
+	m.resets++
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Widget"}, meta.RESTScopeNamespace)
+	m.RESTMapper = mapper
+}
+
+func TestRESTMappingRefreshesDiscovery(t *testing.T) {
+	mapper := &resettableMapper{RESTMapper: meta.NewDefaultRESTMapper(nil)}
+	r := &Reconciler{restMapper: mapper}
+	ctx := context.Background()
+
+	mapping, err := r.restMapping(ctx, schema.GroupKind{Group: "example.org", Kind: "Widget"}, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mapping.Resource.Resource != "widgets" {
+		t.Errorf("unexpected resource %v", mapping.Resource)
+	}
+	if mapper.resets != 1 {
+		t.Errorf("expected mapper to be reset once, was reset %d times", mapper.resets)
+	}
+
+	// Unknown kinds are looked up again once, without waiting
+	start := time.Now()
+	_, err = r.restMapping(ctx, schema.GroupKind{Group: "example.org", Kind: "Unknown"}, "v1")
+	if !meta.IsNoMatchError(err) {
+		t.Errorf("expected no match error for unknown kind, got %v", err)
+	}
+	if mapper.resets != 2 {
+		t.Errorf("expected mapper to be reset once more, was reset %d times", mapper.resets)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected unknown kinds not to be retried with a backoff, took %v", elapsed)
+	}
+}
+
+func TestRESTMappingRefreshesDiscoveryOncePerReconcile(t *testing.T) {
+	mapper := &resettableMapper{RESTMapper: meta.NewDefaultRESTMapper(nil)}
+	r := &Reconciler{restMapper: mapper}
+	ctx := contextWithDiscoveryRefresh(context.Background())
+
+	for i := 0; i < 3; i++ {
+		_, err := r.restMapping(ctx, schema.GroupKind{Group: "example.org", Kind: "Unknown"}, "v1")
+		if !meta.IsNoMatchError(err) {
+			t.Errorf("expected no match error for unknown kind, got %v", err)
+		}
+	}
+	if mapper.resets != 1 {
+		t.Errorf("expected mapper to be reset once during the reconcile, was reset %d times", mapper.resets)
+	}
+
+	// Kinds found by the refresh are still mapped
+	if _, err := r.restMapping(ctx, schema.GroupKind{Group: "example.org", Kind: "Widget"}, "v1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// The next reconcile refreshes discovery again
+	ctx = contextWithDiscoveryRefresh(context.Background())
+	_, _ = r.restMapping(ctx, schema.GroupKind{Group: "example.org", Kind: "Unknown"}, "v1")
+	if mapper.resets != 2 {
+		t.Errorf("expected mapper to be reset again in the next reconcile, was reset %d times", mapper.resets)
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// withResync adds the periodic resync from WithResyncPeriod to the result of a successful reconcile,
+// unless the result already requeues sooner
+func (r *Reconciler) withResync(result reconcile.Result) reconcile.Result {
+	if r.options.resyncPeriod <= 0 || result.Requeue {
+		return result
+	}
+
+	resync := r.options.resyncPeriod
+	if r.options.resyncJitter > 0 {
+		resync = wait.Jitter(resync, r.options.resyncJitter)
+	}
+	if result.RequeueAfter == 0 || resync < result.RequeueAfter {
+		result.RequeueAfter = resync
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestWithResync(t *testing.T) {
+	tests := []struct {
+		name   string
+		period time.Duration
+		jitter float64
+		result reconcile.Result
+		min    time.Duration
+		max    time.Duration
+	}{
+		{
+			name:   "no resync",
+			result: reconcile.Result{},
+		},
+		{
+			name:   "resync without jitter",
+			period: time.Hour,
+			min:    time.Hour,
+			max:    time.Hour,
+		},
+		{
+			name:   "resync with jitter",
+			period: time.Hour,
+			jitter: 0.5,
+			min:    time.Hour,
+			max:    90 * time.Minute,
+		},
+		{
+			name:   "sooner requeue is kept",
+			period: time.Hour,
+			result: reconcile.Result{RequeueAfter: 10 * time.Second},
+			min:    10 * time.Second,
+			max:    10 * time.Second,
+		},
+		{
+			name:   "later requeue is replaced",
+			period: time.Minute,
+			result: reconcile.Result{RequeueAfter: time.Hour},
+			min:    time.Minute,
+			max:    time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{options: reconcilerParams{resyncPeriod: test.period, resyncJitter: test.jitter}}
+			for i := 0; i < 10; i++ {
+				result := r.withResync(test.result)
+				if result.RequeueAfter < test.min || result.RequeueAfter > test.max {
+					t.Errorf("expected RequeueAfter between %v and %v, got %v", test.min, test.max, result.RequeueAfter)
+				}
+			}
+		})
+	}
+}
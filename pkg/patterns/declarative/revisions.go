@@ -0,0 +1,287 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// RevisionOfLabel is set on revision Secrets, identifying the DeclarativeObject they belong to
+	RevisionOfLabel = "addons.k8s.io/revision-of"
+	// RevisionLabel is set on revision Secrets to the revision number
+	RevisionLabel = "addons.k8s.io/revision"
+	// RevisionSecretType is the type of revision Secrets
+	RevisionSecretType corev1.SecretType = "addons.k8s.io/revision"
+
+	// revisionManifestKey holds the gzipped manifest in revision Secrets
+	revisionManifestKey = "manifest.gz"
+	// revisionHashAnnotation is the hash of the manifest in a revision Secret
+	revisionHashAnnotation = "addons.k8s.io/manifest-hash"
+	// revisionVersionAnnotation is spec.version of the DeclarativeObject when the revision was applied
+	revisionVersionAnnotation = "addons.k8s.io/version"
+	// revisionGenerationAnnotation is the generation of the DeclarativeObject when the revision was applied
+	revisionGenerationAnnotation = "addons.k8s.io/generation"
+)
+
+// Revision is a manifest applied for a DeclarativeObject, recorded by WithRevisionHistory
+type Revision struct {
+	// Number is 1 for the first manifest applied, and increases with each change to the manifest
+	Number int
+	// Manifest is the rendered manifest that was applied
+	Manifest string
+	// Applied is when the revision was first applied
+	Applied time.Time
+	// Version is spec.version of the DeclarativeObject, if it has one
+	Version string
+	// Generation is the generation of the DeclarativeObject
+	Generation int64
+}
+
+// RevisionName returns the name of the Secret holding the given revision of the manifest of instance.
+// Revisions of cluster-scoped DeclarativeObjects are kept in the default namespace.
+func RevisionName(instance DeclarativeObject, kind string, number int) client.ObjectKey {
+	name := InventoryName(instance, kind)
+	return client.ObjectKey{
+		Namespace: name.Namespace,
+		Name:      fmt.Sprintf("%s-%s-rev-%d", strings.ToLower(kind), instance.GetName(), number),
+	}
+}
+
+// ListRevisions returns the recorded revisions of the manifest of instance, oldest first.  The Secrets are best
+// listed with an uncached client, as listing them with the client of the manager caches every Secret of the cluster.
+func ListRevisions(ctx context.Context, c client.Client, instance DeclarativeObject) ([]Revision, error) {
+	gvk, err := apiutil.GVKForObject(instance, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := listRevisionSecrets(ctx, c, gvk, instance)
+	if err != nil {
+		return nil, err
+	}
+	return parseRevisions(secrets)
+}
+
+// GetRevision returns the given revision of the manifest of instance, and false if it isn't recorded
+func GetRevision(ctx context.Context, c client.Client, instance DeclarativeObject, number int) (Revision, bool, error) {
+	revisions, err := ListRevisions(ctx, c, instance)
+	if err != nil {
+		return Revision{}, false, err
+	}
+	return findRevision(revisions, number)
+}
+
+// listRevisions returns the recorded revisions of the manifest of instance, read from the API server rather than
+// the cache of the manager
+func (r *Reconciler) listRevisions(ctx context.Context, instance DeclarativeObject) ([]Revision, error) {
+	gvk, err := apiutil.GVKForObject(instance, r.client.Scheme())
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := listRevisionSecrets(ctx, r.secretReader(), gvk, instance)
+	if err != nil {
+		return nil, err
+	}
+	return parseRevisions(secrets)
+}
+
+// getRevision returns the given revision of the manifest of instance, and false if it isn't recorded
+func (r *Reconciler) getRevision(ctx context.Context, instance DeclarativeObject, number int) (Revision, bool, error) {
+	revisions, err := r.listRevisions(ctx, instance)
+	if err != nil {
+		return Revision{}, false, err
+	}
+	return findRevision(revisions, number)
+}
+
+// secretReader returns the reader of revision Secrets: the API server, so that the manager doesn't cache every
+// Secret of the cluster, or the client if the Reconciler wasn't initialized with a manager
+func (r *Reconciler) secretReader() client.Reader {
+	if r.apiReader != nil {
+		return r.apiReader
+	}
+	return r.client
+}
+
+func findRevision(revisions []Revision, number int) (Revision, bool, error) {
+	for _, revision := range revisions {
+		if revision.Number == number {
+			return revision, true, nil
+		}
+	}
+	return Revision{}, false, nil
+}
+
+func parseRevisions(secrets []corev1.Secret) ([]Revision, error) {
+	var revisions []Revision
+	for i := range secrets {
+		revision, err := parseRevision(&secrets[i])
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// listRevisionSecrets returns the revision Secrets of instance, sorted by revision number.  Only the Secrets with
+// the label of instance are listed.
+func listRevisionSecrets(ctx context.Context, c client.Reader, gvk schema.GroupVersionKind, instance DeclarativeObject) ([]corev1.Secret, error) {
+	secrets := &corev1.SecretList{}
+	err := c.List(ctx, secrets,
+		client.InNamespace(InventoryName(instance, gvk.Kind).Namespace),
+		client.MatchingLabels{RevisionOfLabel: instanceID(instance, gvk)})
+	if err != nil {
+		return nil, fmt.Errorf("error listing revisions: %v", err)
+	}
+	items := secrets.Items
+	sort.Slice(items, func(i, j int) bool {
+		return revisionNumber(&items[i]) < revisionNumber(&items[j])
+	})
+	return items, nil
+}
+
+func revisionNumber(secret *corev1.Secret) int {
+	n, _ := strconv.Atoi(secret.Labels[RevisionLabel])
+	return n
+}
+
+func parseRevision(secret *corev1.Secret) (Revision, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(secret.Data[revisionManifestKey]))
+	if err != nil {
+		return Revision{}, fmt.Errorf("error reading revision %s: %v", secret.Name, err)
+	}
+	manifest, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return Revision{}, fmt.Errorf("error reading revision %s: %v", secret.Name, err)
+	}
+	generation, _ := strconv.ParseInt(secret.Annotations[revisionGenerationAnnotation], 10, 64)
+	return Revision{
+		Number:     revisionNumber(secret),
+		Manifest:   string(manifest),
+		Applied:    secret.CreationTimestamp.Time,
+		Version:    secret.Annotations[revisionVersionAnnotation],
+		Generation: generation,
+	}, nil
+}
+
+// recordRevision records manifestStr as a new revision of the manifest of instance, unless it is the same as the
+// latest revision, and deletes the oldest revisions beyond the history limit.  It returns the current revision number.
+func (r *Reconciler) recordRevision(ctx context.Context, instance DeclarativeObject, manifestStr string) (int, error) {
+	log := log.FromContext(ctx)
+
+	gvk, err := apiutil.GVKForObject(instance, r.client.Scheme())
+	if err != nil {
+		return 0, err
+	}
+	secrets, err := listRevisionSecrets(ctx, r.secretReader(), gvk, instance)
+	if err != nil {
+		return 0, err
+	}
+
+	sum := sha256.Sum256([]byte(manifestStr))
+	hash := hex.EncodeToString(sum[:])
+	number := 1
+	if len(secrets) != 0 {
+		latest := &secrets[len(secrets)-1]
+		if latest.Annotations[revisionHashAnnotation] == hash {
+			return revisionNumber(latest), nil
+		}
+		number = revisionNumber(latest) + 1
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write([]byte(manifestStr)); err != nil {
+		return 0, fmt.Errorf("error compressing manifest: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("error compressing manifest: %v", err)
+	}
+
+	name := RevisionName(instance, gvk.Kind, number)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.Name,
+			Namespace: name.Namespace,
+			Labels: map[string]string{
+				RevisionOfLabel: instanceID(instance, gvk),
+				RevisionLabel:   strconv.Itoa(number),
+			},
+			Annotations: map[string]string{
+				revisionHashAnnotation:       hash,
+				revisionVersionAnnotation:    specVersion(instance),
+				revisionGenerationAnnotation: strconv.FormatInt(instance.GetGeneration(), 10),
+			},
+		},
+		Type: RevisionSecretType,
+		Data: map[string][]byte{revisionManifestKey: compressed.Bytes()},
+	}
+	// Clean up the history with the DeclarativeObject, which may be cluster-scoped
+	secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(instance, gvk)}
+	log.WithValues("revision", name.String()).Info("recording revision")
+	if err := r.client.Create(ctx, secret); err != nil {
+		return 0, fmt.Errorf("error recording revision: %v", err)
+	}
+
+	if r.options.revisionHistoryLimit <= 0 {
+		return number, nil
+	}
+	// Keep the latest revisions, including the new one
+	for i := 0; i < len(secrets)+1-r.options.revisionHistoryLimit && i < len(secrets); i++ {
+		log.WithValues("revision", secrets[i].Name).V(1).Info("deleting old revision")
+		if err := r.client.Delete(ctx, &secrets[i]); err != nil && !apierrors.IsNotFound(err) {
+			return number, fmt.Errorf("error deleting old revision: %v", err)
+		}
+	}
+	return number, nil
+}
+
+// specVersion returns spec.version of instance, or "" if it doesn't have one
+func specVersion(instance DeclarativeObject) string {
+	var obj map[string]interface{}
+	if u, ok := instance.(*unstructured.Unstructured); ok {
+		obj = u.Object
+	} else {
+		var err error
+		if obj, err = runtime.DefaultUnstructuredConverter.ToUnstructured(instance); err != nil {
+			return ""
+		}
+	}
+	version, _, _ := unstructured.NestedString(obj, "spec", "version")
+	return version
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRecordRevision(t *testing.T) {
+	ctx := context.Background()
+
+	instance := newGuestbook("default", "test", time.Now())
+	instance.SetUID("instance-uid")
+	if err := unstructured.SetNestedField(instance.Object, "1.2.0", "spec", "version"); err != nil {
+		t.Fatalf("error setting version: %v", err)
+	}
+	r := &Reconciler{
+		client:  fake.NewClientBuilder().Build(),
+		options: reconcilerParams{revisionHistory: true, revisionHistoryLimit: 2},
+	}
+
+	steps := []struct {
+		manifest         string
+		expectedRevision int
+		expectedHistory  []int
+	}{
+		{manifest: "first", expectedRevision: 1, expectedHistory: []int{1}},
+		{manifest: "first", expectedRevision: 1, expectedHistory: []int{1}},
+		{manifest: "second", expectedRevision: 2, expectedHistory: []int{1, 2}},
+		{manifest: "third", expectedRevision: 3, expectedHistory: []int{2, 3}},
+		{manifest: "first", expectedRevision: 4, expectedHistory: []int{3, 4}},
+	}
+	for i, step := range steps {
+		revision, err := r.recordRevision(ctx, instance, step.manifest)
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+		if revision != step.expectedRevision {
+			t.Errorf("step %d: expected revision %d, got %d", i, step.expectedRevision, revision)
+		}
+
+		revisions, err := ListRevisions(ctx, r.client, instance)
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+		var history []int
+		for _, revision := range revisions {
+			history = append(history, revision.Number)
+		}
+		if !reflect.DeepEqual(history, step.expectedHistory) {
+			t.Errorf("step %d: expected history %v, got %v", i, step.expectedHistory, history)
+		}
+	}
+
+	revision, found, err := GetRevision(ctx, r.client, instance, 3)
+	if err != nil || !found {
+		t.Fatalf("expected revision 3, got found=%v, err=%v", found, err)
+	}
+	if revision.Manifest != "third" || revision.Version != "1.2.0" {
+		t.Errorf("unexpected revision %+v", revision)
+	}
+	if _, found, _ := GetRevision(ctx, r.client, instance, 1); found {
+		t.Errorf("expected revision 1 to have been deleted")
+	}
+
+	// Revisions are owned by the DeclarativeObject, to be garbage collected with it, even if it is cluster-scoped
+	for _, owner := range []*unstructured.Unstructured{instance, newGuestbook("", "cluster", time.Now())} {
+		owner.SetUID(types.UID(owner.GetName() + "-uid"))
+		if _, err := r.recordRevision(ctx, owner, "owned"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		secrets, err := listRevisionSecrets(ctx, r.client, owner.GroupVersionKind(), owner)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		latest := secrets[len(secrets)-1]
+		if len(latest.OwnerReferences) != 1 || latest.OwnerReferences[0].UID != owner.GetUID() {
+			t.Errorf("expected revision %s to be owned by %s, got %v", latest.Name, owner.GetName(), latest.OwnerReferences)
+		}
+	}
+}
+
+func TestRevisionsReadFromAPIServer(t *testing.T) {
+	ctx := context.Background()
+
+	instance := newGuestbook("default", "test", time.Now())
+	apiServer := fake.NewClientBuilder().Build()
+	writer := &Reconciler{client: apiServer, options: reconcilerParams{revisionHistory: true}}
+	if _, err := writer.recordRevision(ctx, instance, "first"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The cache of the manager doesn't hold the revision Secrets
+	r := &Reconciler{
+		client:    fake.NewClientBuilder().Build(),
+		apiReader: apiServer,
+		options:   reconcilerParams{revisionHistory: true},
+	}
+	revision, found, err := r.getRevision(ctx, instance, 1)
+	if err != nil || !found || revision.Manifest != "first" {
+		t.Errorf("expected revision 1 from the API server, got %+v, found=%v, err=%v", revision, found, err)
+	}
+}
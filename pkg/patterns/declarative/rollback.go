@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const (
+	// RollbackAnnotation on a DeclarativeObject, set to a revision number, applies that revision of the manifest
+	// rather than the manifest for the current spec, with WithRevisionHistory
+	RollbackAnnotation = "addons.k8s.io/rollback-to"
+
+	// ConditionRolledBack is true while the DeclarativeObject is rolled back to a previous revision
+	ConditionRolledBack = "RolledBack"
+	// ReasonRollback is the reason for a true ConditionRolledBack
+	ReasonRollback = "Rollback"
+	// ReasonInvalidRollback is the reason for a TerminalError when the rollback revision is invalid or not recorded
+	ReasonInvalidRollback = "InvalidRollback"
+)
+
+// RollbackTo annotates instance to be rolled back to the given revision, which must have been recorded by
+// WithRevisionHistory.  The instance must then be updated.  Removing the annotation resumes applying the
+// manifest for the current spec.
+func RollbackTo(instance DeclarativeObject, revision int) {
+	annotations := instance.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[RollbackAnnotation] = strconv.Itoa(revision)
+	instance.SetAnnotations(annotations)
+}
+
+// rollbackRevision returns the revision instance should be rolled back to, or nil if it shouldn't be rolled back
+func (r *Reconciler) rollbackRevision(ctx context.Context, instance DeclarativeObject) (*Revision, error) {
+	value, found := instance.GetAnnotations()[RollbackAnnotation]
+	if !found || !r.options.revisionHistory {
+		return nil, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, NewTerminalError(ReasonInvalidRollback, fmt.Errorf("invalid revision %q in %s annotation", value, RollbackAnnotation))
+	}
+	revision, found, err := r.getRevision(ctx, instance, number)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, NewTerminalError(ReasonInvalidRollback, fmt.Errorf("revision %d is not recorded, cannot roll back", number))
+	}
+	return &revision, nil
+}
+
+// rollbackObjects returns the objects of the revision
+func rollbackObjects(ctx context.Context, revision *Revision) (*manifest.Objects, error) {
+	objects, err := manifest.ParseObjects(ctx, revision.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing revision %d: %v", revision.Number, err)
+	}
+	return objects, nil
+}
+
+// pruneSinceRevision deletes the objects in the latest revision which aren't in the rolled back objects,
+// and reports the rollback in the RolledBack condition
+func (r *Reconciler) pruneSinceRevision(ctx context.Context, instance DeclarativeObject, ns string, revision *Revision, objects *manifest.Objects) error {
+	revisions, err := r.listRevisions(ctx, instance)
+	if err != nil {
+		return err
+	}
+	if len(revisions) != 0 && revisions[len(revisions)-1].Number != revision.Number {
+		if err := r.deleteRemovedObjects(ctx, instance, ns, revisions[len(revisions)-1], objects); err != nil {
+			return err
+		}
+	}
+
+	message := fmt.Sprintf("Rolled back to revision %d", revision.Number)
+	if revision.Version != "" {
+		message = fmt.Sprintf("Rolled back to revision %d, version %s", revision.Number, revision.Version)
+	}
+	changed, err := setCondition(instance, metav1.Condition{
+		Type:               ConditionRolledBack,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonRollback,
+		Message:            message,
+		ObservedGeneration: instance.GetGeneration(),
+	})
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return fmt.Errorf("error updating status: %v", err)
+		}
+		if r.recorder != nil {
+			r.recorder.Event(instance, "Normal", ReasonRollback, message)
+		}
+	}
+	return nil
+}
+
+// clearRollback removes the RolledBack condition once the manifest for the current spec is applied
+func (r *Reconciler) clearRollback(ctx context.Context, instance DeclarativeObject) error {
+	changed, err := removeCondition(instance, ConditionRolledBack, ReasonRollback)
+	if err != nil || !changed {
+		return err
+	}
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	return nil
+}
+
+// deleteRemovedObjects deletes the objects in the manifest of revision which aren't in objects
+func (r *Reconciler) deleteRemovedObjects(ctx context.Context, instance DeclarativeObject, ns string, revision Revision, objects *manifest.Objects) error {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues("revision", revision.Number))
+
+	previous, err := manifest.ParseObjects(ctx, revision.Manifest)
+	if err != nil {
+		return classify(ErrPrune, fmt.Errorf("error parsing revision %d: %v", revision.Number, err))
+	}
+	keep := make(map[string]bool)
+	for _, o := range objects.Items {
+		keep[objectKey(o)] = true
+	}
+	for _, o := range previous.Items {
+		if keep[objectKey(o)] || keepOnDelete(o) || r.isProtected(o) {
+			continue
+		}
+		if err := r.deleteObject(ctx, ns, o); err != nil {
+			return classify(ErrPrune, err)
+		}
+		r.recordPruned(ctx, instance, o.GroupVersionKind(), o.Namespace, o.Name)
+	}
+	return nil
+}
+
+// deleteObject deletes o from the cluster, in namespace ns if o is namespaced and doesn't specify a namespace
+func (r *Reconciler) deleteObject(ctx context.Context, ns string, o *manifest.Object) error {
+	resource, err := r.objectResource(ctx, ns, o)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = resource.Delete(ctx, o.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting %s %s: %v", o.Kind, o.Name, err)
+	}
+	return nil
+}
+
+// objectResource returns the dynamic client for o, in namespace ns if o is namespaced and doesn't specify a namespace
+func (r *Reconciler) objectResource(ctx context.Context, ns string, o *manifest.Object) (dynamic.ResourceInterface, error) {
+	mapping, err := r.restMapping(ctx, o.GroupKind(), o.GroupVersionKind().Version)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get mapping for %s: %w", o.Kind, err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return r.dynamicClient.Resource(mapping.Resource), nil
+	}
+	namespace := o.Namespace
+	if namespace == "" {
+		namespace = ns
+	}
+	return r.dynamicClient.Resource(mapping.Resource).Namespace(namespace), nil
+}
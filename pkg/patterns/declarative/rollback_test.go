@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	first := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+`
+	second := first + `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+`
+	live, err := manifest.ParseObjects(ctx, second)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	instance := newGuestbook("default", "test", time.Now())
+	instance.SetUID("instance-uid")
+	r := &Reconciler{
+		client:     fake.NewClientBuilder().WithObjects(instance).Build(),
+		restMapper: mapper,
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+			live.Items[0].UnstructuredObject(), live.Items[1].UnstructuredObject()),
+		options: reconcilerParams{revisionHistory: true},
+	}
+	for _, m := range []string{first, second} {
+		if _, err := r.recordRevision(ctx, instance, m); err != nil {
+			t.Fatalf("error recording revision: %v", err)
+		}
+	}
+
+	if revision, err := r.rollbackRevision(ctx, instance); revision != nil || err != nil {
+		t.Fatalf("expected no rollback without the annotation, got %v, %v", revision, err)
+	}
+	RollbackTo(instance, 3)
+	if _, err := r.rollbackRevision(ctx, instance); !IsTerminalError(err) {
+		t.Errorf("expected a terminal error for an unrecorded revision, got %v", err)
+	}
+
+	RollbackTo(instance, 1)
+	revision, err := r.rollbackRevision(ctx, instance)
+	if err != nil || revision == nil || revision.Number != 1 {
+		t.Fatalf("expected revision 1, got %v, %v", revision, err)
+	}
+	objects, err := rollbackObjects(ctx, revision)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.pruneSinceRevision(ctx, instance, "default", revision, objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	if _, err := r.dynamicClient.Resource(deployments).Namespace("default").Get(ctx, "app", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the deployment added since revision 1 to be deleted, got %v", err)
+	}
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if _, err := r.dynamicClient.Resource(configMaps).Namespace("default").Get(ctx, "config", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the configmap to be kept, got %v", err)
+	}
+
+	conditions, _, err := getConditions(instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rolledBack := meta.FindStatusCondition(conditions, ConditionRolledBack)
+	if rolledBack == nil || rolledBack.Status != metav1.ConditionTrue || rolledBack.Message != "Rolled back to revision 1" {
+		t.Errorf("unexpected RolledBack condition %v", rolledBack)
+	}
+
+	if err := r.clearRollback(ctx, instance); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conditions, _, _ = getConditions(instance)
+	if meta.FindStatusCondition(conditions, ConditionRolledBack) != nil {
+		t.Errorf("expected the RolledBack condition to be removed")
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// PodClassTransform returns an ObjectTransform that sets priorityClassName and runtimeClassName
+// on the pod spec of all workloads.  spec.priorityClassName and spec.runtimeClassName of the
+// DeclarativeObject take precedence over the values passed in.  Empty values are not set.
+func PodClassTransform(priorityClassName, runtimeClassName string) ObjectTransform {
+	return func(ctx context.Context, o DeclarativeObject, m *manifest.Objects) error {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+		if err != nil {
+			return fmt.Errorf("error converting object to unstructured: %v", err)
+		}
+
+		priority, runtimeClass := priorityClassName, runtimeClassName
+		if v, found, err := unstructured.NestedString(u, "spec", "priorityClassName"); err != nil {
+			return fmt.Errorf("error reading spec.priorityClassName: %v", err)
+		} else if found && v != "" {
+			priority = v
+		}
+		if v, found, err := unstructured.NestedString(u, "spec", "runtimeClassName"); err != nil {
+			return fmt.Errorf("error reading spec.runtimeClassName: %v", err)
+		} else if found && v != "" {
+			runtimeClass = v
+		}
+
+		return applyPodClasses(ctx, m, priority, runtimeClass)
+	}
+}
+
+func applyPodClasses(ctx context.Context, manifest *manifest.Objects, priorityClassName, runtimeClassName string) error {
+	log := log.FromContext(ctx)
+	if priorityClassName == "" && runtimeClassName == "" {
+		return nil
+	}
+	for _, manifestItem := range manifest.Items {
+		if manifestItem.HasPodTemplate() {
+			log.WithValues("manifest", manifestItem).WithValues("priorityClassName", priorityClassName).WithValues("runtimeClassName", runtimeClassName).V(1).Info("applying pod classes to manifest")
+			if err := manifestItem.MutatePodSpec(func(podSpec map[string]interface{}) error {
+				if priorityClassName != "" {
+					podSpec["priorityClassName"] = priorityClassName
+					// priority is resolved from the class, and rejected by admission if it doesn't match
+					delete(podSpec, "priority")
+				}
+				if runtimeClassName != "" {
+					podSpec["runtimeClassName"] = runtimeClassName
+				}
+				return nil
+			}); err != nil {
+				return fmt.Errorf("error applying pod classes: %v", err)
+			}
+		}
+	}
+	return nil
+}
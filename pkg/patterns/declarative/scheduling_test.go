@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestPodClassTransform(t *testing.T) {
+	inputManifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      priority: 1000
+      containers:
+      - name: frontend
+        image: gcr.io/google-samples/gb-frontend:v4
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`
+
+	tests := []struct {
+		name             string
+		priorityClass    string
+		runtimeClass     string
+		spec             map[string]interface{}
+		expectedPriority string
+		expectedRuntime  string
+	}{
+		{
+			name:             "reconciler defaults",
+			priorityClass:    "system-cluster-critical",
+			runtimeClass:     "gvisor",
+			expectedPriority: "system-cluster-critical",
+			expectedRuntime:  "gvisor",
+		},
+		{
+			name:          "overridden by CR",
+			priorityClass: "system-cluster-critical",
+			spec: map[string]interface{}{
+				"priorityClassName": "high-priority",
+				"runtimeClassName":  "kata",
+			},
+			expectedPriority: "high-priority",
+			expectedRuntime:  "kata",
+		},
+		{
+			name: "unset",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+			instance := &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "addons.example.org/v1alpha1",
+					"kind":       "Guestbook",
+					"metadata":   map[string]interface{}{"name": "test"},
+					"spec":       test.spec,
+				},
+			}
+
+			transform := PodClassTransform(test.priorityClass, test.runtimeClass)
+			if err := transform(context.Background(), instance, objects); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			podSpec, _, _ := unstructured.NestedMap(objects.Items[0].UnstructuredObject().Object, "spec", "template", "spec")
+			priority, _, _ := unstructured.NestedString(podSpec, "priorityClassName")
+			runtimeClass, _, _ := unstructured.NestedString(podSpec, "runtimeClassName")
+			if priority != test.expectedPriority {
+				t.Errorf("expected priorityClassName %q, got %q", test.expectedPriority, priority)
+			}
+			if runtimeClass != test.expectedRuntime {
+				t.Errorf("expected runtimeClassName %q, got %q", test.expectedRuntime, runtimeClass)
+			}
+			if _, found := podSpec["priority"]; found == (test.expectedPriority != "") {
+				t.Errorf("expected priority to be removed only when priorityClassName is set, found=%v", found)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// DefaultFieldManager is the field manager of the objects applied with WithServerSideApply, unless
+// WithFieldManager is used
+const DefaultFieldManager = "declarative-reconciler"
+
+// fieldManager returns the field manager used for server-side apply
+func (r *Reconciler) fieldManager() string {
+	if r.options.fieldManager != "" {
+		return r.options.fieldManager
+	}
+	return DefaultFieldManager
+}
+
+// applyArgs returns the args applying the manifest, besides the prune args
+func (r *Reconciler) applyArgs() []string {
+	return r.strategyArgs(r.defaultApplyStrategy())
+}
+
+// fieldConflicts returns the fields of o managed by other field managers which stop o from being applied with
+// server-side apply, found with a server-side dry-run.  It returns nil if there are no conflicts.
+func (r *Reconciler) fieldConflicts(ctx context.Context, ns string, o *manifest.Object) ([]string, error) {
+	resource, err := r.objectResource(ctx, ns, o)
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.JSON()
+	if err != nil {
+		return nil, fmt.Errorf("error serializing %s %s: %v", o.Kind, o.Name, err)
+	}
+	force := false
+	_, err = resource.Patch(ctx, o.Name, types.ApplyPatchType, b, metav1.PatchOptions{
+		DryRun:       []string{metav1.DryRunAll},
+		FieldManager: r.fieldManager(),
+		Force:        &force,
+	})
+	if err == nil || !apierrors.IsConflict(err) {
+		return nil, nil
+	}
+
+	var conflicts []string
+	if status, ok := err.(apierrors.APIStatus); ok && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			if cause.Type != metav1.CauseTypeFieldManagerConflict {
+				continue
+			}
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s)", cause.Field, cause.Message))
+		}
+	}
+	if len(conflicts) == 0 {
+		conflicts = append(conflicts, err.Error())
+	}
+	return conflicts, nil
+}
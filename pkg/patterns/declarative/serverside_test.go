@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestApplyArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []reconcilerOption
+		expected []string
+	}{
+		{name: "client-side", expected: []string{"--force"}},
+		{
+			name:     "server-side",
+			options:  []reconcilerOption{WithServerSideApply()},
+			expected: []string{"--server-side", "--field-manager=" + DefaultFieldManager},
+		},
+		{
+			name:     "field manager and force",
+			options:  []reconcilerOption{WithServerSideApply(), WithFieldManager("addon"), WithForceConflicts(true)},
+			expected: []string{"--server-side", "--field-manager=addon", "--force-conflicts"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{}
+			for _, opt := range test.options {
+				r.options = opt(r.options)
+			}
+			if args := r.applyArgs(); !reflect.DeepEqual(args, test.expected) {
+				t.Errorf("expected args %v, got %v", test.expected, args)
+			}
+		})
+	}
+}
+
+func TestApplyWithResultsConflicts(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+spec:
+  replicas: 1
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	dynamicClient.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		err := apierrors.NewApplyConflict([]metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "hpa" using apps/v1`,
+			Field:   ".spec.replicas",
+		}}, "Apply failed with 1 conflict")
+		return true, nil, err
+	})
+
+	r := &Reconciler{
+		kubectl:       &reportingApplier{results: &applier.Results{}, err: errors.New("exit status 1")},
+		restMapper:    mapper,
+		dynamicClient: dynamicClient,
+	}
+	r.options = WithServerSideApply()(r.options)
+
+	results, err := r.applyWithResults(ctx, "default", "", objects.Items, r.applyArgs()...)
+	if err == nil || !strings.Contains(err.Error(), ".spec.replicas") {
+		t.Errorf("expected the error to report the conflict, got %v", err)
+	}
+	expected := []string{`.spec.replicas (conflict with "hpa" using apps/v1)`}
+	if len(results) != 1 || !reflect.DeepEqual(results[0].Conflicts, expected) {
+		t.Errorf("expected conflicts %v, got %v", expected, results)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ShardLabel on a DeclarativeObject assigns it to the shard with that index, instead of its hash
+const ShardLabel = "addons.k8s.io/shard"
+
+// Shard is the share of the DeclarativeObjects reconciled by one replica of the operator, with WithSharding.
+// Each DeclarativeObject belongs to exactly one of Count shards.
+type Shard struct {
+	// Index is the shard of this replica, from 0 to Count-1
+	Index int
+	// Count is the number of shards, and replicas
+	Count int
+}
+
+// ShardFromHostname returns the shard of a replica of a StatefulSet, from the ordinal at the end of its hostname,
+// eg addon-operator-2
+func ShardFromHostname(hostname string, count int) (Shard, error) {
+	i := strings.LastIndex(hostname, "-")
+	index, err := strconv.Atoi(hostname[i+1:])
+	if i < 0 || err != nil {
+		return Shard{}, fmt.Errorf("hostname %q doesn't end with an ordinal", hostname)
+	}
+	shard := Shard{Index: index, Count: count}
+	return shard, shard.validate()
+}
+
+func (s Shard) validate() error {
+	if s.Count <= 0 || s.Index < 0 || s.Index >= s.Count {
+		return fmt.Errorf("invalid shard %d of %d", s.Index, s.Count)
+	}
+	return nil
+}
+
+// Owns returns true if obj belongs to the shard: its ShardLabel is the index of the shard, or, without the label,
+// the hash of its namespace and name is
+func (s Shard) Owns(obj metav1.Object) bool {
+	if value, ok := obj.GetLabels()[ShardLabel]; ok {
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 || index >= s.Count {
+			// Invalid assignments fall back to the hash, so the object is still reconciled
+			return s.hashIndex(obj) == s.Index
+		}
+		return index == s.Index
+	}
+	return s.hashIndex(obj) == s.Index
+}
+
+func (s Shard) hashIndex(obj metav1.Object) int {
+	h := fnv.New32a()
+	h.Write([]byte(obj.GetNamespace() + "/" + obj.GetName()))
+	return int(h.Sum32() % uint32(s.Count))
+}
+
+// Predicate filters the events for DeclarativeObjects to those of the shard, for watching them
+func (s Shard) Predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return s.Owns(obj)
+	})
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestShardFromHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		count    int
+		expected Shard
+		wantErr  bool
+	}{
+		{hostname: "addon-operator-0", count: 3, expected: Shard{Index: 0, Count: 3}},
+		{hostname: "addon-operator-2", count: 3, expected: Shard{Index: 2, Count: 3}},
+		{hostname: "addon-operator-3", count: 3, wantErr: true},
+		{hostname: "addon-operator", count: 3, wantErr: true},
+		{hostname: "0", count: 1, wantErr: true},
+		{hostname: "addon-operator-0", count: 0, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.hostname, func(t *testing.T) {
+			shard, err := ShardFromHostname(test.hostname, test.count)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got shard %v", shard)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if shard != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, shard)
+			}
+		})
+	}
+}
+
+func TestShardOwns(t *testing.T) {
+	const count = 3
+	for i := 0; i < 30; i++ {
+		obj := newGuestbook("default", fmt.Sprintf("guestbook-%d", i), time.Now())
+		owners := 0
+		for index := 0; index < count; index++ {
+			if (Shard{Index: index, Count: count}).Owns(obj) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Errorf("expected %s to belong to one shard, belongs to %d", obj.GetName(), owners)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		label string
+		index int
+	}{
+		{name: "assigned", label: "2", index: 2},
+		{name: "assigned to first", label: "0", index: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			obj := newGuestbook("default", "guestbook", time.Now())
+			obj.SetLabels(map[string]string{ShardLabel: test.label})
+			for index := 0; index < count; index++ {
+				if owns := (Shard{Index: index, Count: count}).Owns(obj); owns != (index == test.index) {
+					t.Errorf("shard %d: expected owns %v, got %v", index, index == test.index, owns)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// ReasonSingletonViolation is the reason for ConditionStalled when WithSingleton prevents reconciliation
+const ReasonSingletonViolation = "SingletonViolation"
+
+// singletonRecheckInterval is how often an instance blocked by WithSingleton is checked again
+var singletonRecheckInterval = time.Minute
+
+// checkSingleton returns a message describing why instance may not be reconciled, or "" if it may.
+// If allowed names are configured, instance must match one of them.  If several objects of the
+// prototype kind exist, only the oldest is reconciled, ignoring objects that aren't allowed or
+// are being deleted, which would otherwise block the others forever.
+func (r *Reconciler) checkSingleton(ctx context.Context, instance DeclarativeObject) (string, error) {
+	if !r.singletonAllowed(instance) {
+		return fmt.Sprintf("%s is not an allowed name for this singleton", types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}), nil
+	}
+
+	gvk, err := apiutil.GVKForObject(r.prototype, r.client.Scheme())
+	if err != nil {
+		return "", fmt.Errorf("error getting kind of prototype: %v", err)
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := r.client.List(ctx, list); err != nil {
+		return "", fmt.Errorf("error listing %s objects: %v", gvk.Kind, err)
+	}
+
+	var items []unstructured.Unstructured
+	for _, item := range list.Items {
+		if item.GetDeletionTimestamp() != nil || !r.singletonAllowed(&item) {
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return "", nil
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		ti, tj := items[i].GetCreationTimestamp(), items[j].GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		if items[i].GetNamespace() != items[j].GetNamespace() {
+			return items[i].GetNamespace() < items[j].GetNamespace()
+		}
+		return items[i].GetName() < items[j].GetName()
+	})
+	oldest := items[0]
+	if oldest.GetNamespace() == instance.GetNamespace() && oldest.GetName() == instance.GetName() {
+		return "", nil
+	}
+
+	var names []string
+	for _, item := range items {
+		names = append(names, types.NamespacedName{Namespace: item.GetNamespace(), Name: item.GetName()}.String())
+	}
+	return fmt.Sprintf("only one %s may exist, found %s; only %s is reconciled", gvk.Kind, strings.Join(names, ", "),
+		types.NamespacedName{Namespace: oldest.GetNamespace(), Name: oldest.GetName()}), nil
+}
+
+// singletonAllowed returns true if o matches one of the allowed names, or if no names are configured
+func (r *Reconciler) singletonAllowed(o metav1.Object) bool {
+	if len(r.options.singletonAllowed) == 0 {
+		return true
+	}
+	for _, name := range r.options.singletonAllowed {
+		if (name.Namespace == "" || name.Namespace == o.GetNamespace()) &&
+			(name.Name == "" || name.Name == o.GetName()) {
+			return true
+		}
+	}
+	return false
+}
+
+// enforceSingleton returns false if instance should not be reconciled,
+// and reports the reason as a condition on instance
+func (r *Reconciler) enforceSingleton(ctx context.Context, instance DeclarativeObject) (bool, error) {
+	violation, err := r.checkSingleton(ctx, instance)
+	if err != nil {
+		return false, err
+	}
+
+	var changed bool
+	if violation != "" {
+		changed, err = setCondition(instance, metav1.Condition{
+			Type:               ConditionStalled,
+			Status:             metav1.ConditionTrue,
+			Reason:             ReasonSingletonViolation,
+			Message:            violation,
+			ObservedGeneration: instance.GetGeneration(),
+		})
+	} else {
+		changed, err = removeCondition(instance, ConditionStalled, ReasonSingletonViolation)
+	}
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return false, fmt.Errorf("error updating status: %v", err)
+		}
+	}
+
+	if violation != "" {
+		if r.recorder != nil {
+			r.recorder.Event(instance, "Warning", ReasonSingletonViolation, violation)
+		}
+		return false, nil
+	}
+	return true, nil
+}
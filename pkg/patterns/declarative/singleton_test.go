@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newGuestbook(namespace, name string, created time.Time) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("addons.example.org/v1alpha1")
+	u.SetKind("Guestbook")
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	u.SetCreationTimestamp(metav1.NewTime(created))
+	return u
+}
+
+// deleting marks u as being deleted
+func deleting(u *unstructured.Unstructured) *unstructured.Unstructured {
+	now := metav1.Now()
+	u.SetDeletionTimestamp(&now)
+	u.SetFinalizers([]string{"example.org/finalizer"})
+	return u
+}
+
+func TestEnforceSingleton(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		existing []*unstructured.Unstructured
+		allowed  []types.NamespacedName
+		instance types.NamespacedName
+		expected bool
+	}{
+		{
+			name:     "single instance",
+			existing: []*unstructured.Unstructured{newGuestbook("default", "a", now)},
+			instance: types.NamespacedName{Namespace: "default", Name: "a"},
+			expected: true,
+		},
+		{
+			name: "oldest instance is reconciled",
+			existing: []*unstructured.Unstructured{
+				newGuestbook("default", "a", now),
+				newGuestbook("other", "b", now.Add(-time.Hour)),
+			},
+			instance: types.NamespacedName{Namespace: "other", Name: "b"},
+			expected: true,
+		},
+		{
+			name: "newer instance is not reconciled",
+			existing: []*unstructured.Unstructured{
+				newGuestbook("default", "a", now),
+				newGuestbook("other", "b", now.Add(-time.Hour)),
+			},
+			instance: types.NamespacedName{Namespace: "default", Name: "a"},
+			expected: false,
+		},
+		{
+			name: "older instance outside allowed names is ignored",
+			existing: []*unstructured.Unstructured{
+				newGuestbook("kube-system", "a", now),
+				newGuestbook("default", "b", now.Add(-time.Hour)),
+			},
+			allowed:  []types.NamespacedName{{Namespace: "kube-system"}},
+			instance: types.NamespacedName{Namespace: "kube-system", Name: "a"},
+			expected: true,
+		},
+		{
+			name: "older instance being deleted is ignored",
+			existing: []*unstructured.Unstructured{
+				newGuestbook("default", "a", now),
+				deleting(newGuestbook("other", "b", now.Add(-time.Hour))),
+			},
+			instance: types.NamespacedName{Namespace: "default", Name: "a"},
+			expected: true,
+		},
+		{
+			name:     "instance in allowed namespace",
+			existing: []*unstructured.Unstructured{newGuestbook("kube-system", "a", now)},
+			allowed:  []types.NamespacedName{{Namespace: "kube-system"}},
+			instance: types.NamespacedName{Namespace: "kube-system", Name: "a"},
+			expected: true,
+		},
+		{
+			name:     "instance outside allowed names",
+			existing: []*unstructured.Unstructured{newGuestbook("default", "a", now)},
+			allowed:  []types.NamespacedName{{Namespace: "kube-system", Name: "guestbook"}},
+			instance: types.NamespacedName{Namespace: "default", Name: "a"},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			gv := schema.GroupVersion{Group: "addons.example.org", Version: "v1alpha1"}
+			scheme.AddKnownTypeWithName(gv.WithKind("Guestbook"), &unstructured.Unstructured{})
+			scheme.AddKnownTypeWithName(gv.WithKind("GuestbookList"), &unstructured.UnstructuredList{})
+
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			for _, o := range test.existing {
+				builder = builder.WithObjects(o)
+			}
+			r := &Reconciler{
+				prototype: newGuestbook("", "", now),
+				client:    builder.Build(),
+				options:   reconcilerParams{singleton: true, singletonAllowed: test.allowed},
+			}
+
+			instance := &unstructured.Unstructured{}
+			instance.SetGroupVersionKind(r.prototype.GetObjectKind().GroupVersionKind())
+			if err := r.client.Get(context.Background(), test.instance, instance); err != nil {
+				t.Fatalf("error getting instance: %v", err)
+			}
+
+			ok, err := r.enforceSingleton(context.Background(), instance)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, ok)
+			}
+
+			updated := &unstructured.Unstructured{}
+			updated.SetGroupVersionKind(instance.GroupVersionKind())
+			if err := r.client.Get(context.Background(), client.ObjectKeyFromObject(instance), updated); err != nil {
+				t.Fatalf("error getting instance: %v", err)
+			}
+			conditions, _, err := getConditions(updated)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			stalled := meta.IsStatusConditionTrue(conditions, ConditionStalled)
+			if stalled == test.expected {
+				t.Errorf("expected Stalled condition to be %v, got conditions %v", !test.expected, conditions)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// SinkErrorPolicy is how the errors of the sinks are handled when a reconcile notifies them
+type SinkErrorPolicy string
+
+const (
+	// SinkErrorsAggregate notifies every sink, and fails the reconcile with the errors of all the sinks that failed,
+	// the default
+	SinkErrorsAggregate SinkErrorPolicy = "Aggregate"
+	// SinkErrorsFailFast stops notifying at the first sink that fails, and fails the reconcile with its error
+	SinkErrorsFailFast SinkErrorPolicy = "FailFast"
+	// SinkErrorsIgnore notifies every sink, and logs their errors without failing the reconcile
+	SinkErrorsIgnore SinkErrorPolicy = "Ignore"
+)
+
+// FailureSink is implemented by Sinks that should also be notified when a reconcile fails, or some objects fail
+// to apply.  objs are the objects of the manifest, or nil if the reconcile failed before they were built.
+// The reconcile fails whatever FailureSinks return, so their errors are only logged.
+type FailureSink interface {
+	NotifyFailure(ctx context.Context, dest DeclarativeObject, objs *manifest.Objects, err error) error
+}
+
+// AddSink adds a Sink that will be notified for all deployments, after the sinks of WithSink and those already added
+func (r *Reconciler) AddSink(sink Sink) {
+	r.options.sinks = append(r.options.sinks, sink)
+}
+
+// allSinks returns the sinks of WithSink and AddSink, followed by the one of SetSink
+func (r *Reconciler) allSinks() []Sink {
+	sinks := r.options.sinks
+	if r.options.sink != nil {
+		sinks = append(append([]Sink{}, sinks...), r.options.sink)
+	}
+	return sinks
+}
+
+// sinkErrorPolicy returns how the errors of the sinks are handled
+func (r *Reconciler) sinkErrorPolicy() SinkErrorPolicy {
+	if r.options.sinkErrorPolicy == "" {
+		return SinkErrorsAggregate
+	}
+	return r.options.sinkErrorPolicy
+}
+
+// notifySinks calls notify with each sink in turn, handling their errors with the SinkErrorPolicy
+func (r *Reconciler) notifySinks(ctx context.Context, notify func(Sink) error) error {
+	policy := r.sinkErrorPolicy()
+	var errs []error
+	for _, sink := range r.allSinks() {
+		err := notify(sink)
+		if err == nil {
+			continue
+		}
+		switch policy {
+		case SinkErrorsFailFast:
+			return err
+		case SinkErrorsIgnore:
+			log.FromContext(ctx).WithValues("sink", fmt.Sprintf("%T", sink)).Error(err, "notifying sink, ignoring error")
+		default:
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// notifySinksOfSuccess tells the sinks that objs have been applied
+func (r *Reconciler) notifySinksOfSuccess(ctx context.Context, instance DeclarativeObject, objs *manifest.Objects) error {
+	return r.notifySinks(ctx, func(sink Sink) error {
+		return sink.Notify(ctx, instance, objs)
+	})
+}
+
+// notifySinksOfFailure tells the FailureSinks that the reconcile of instance failed with reconcileErr
+func (r *Reconciler) notifySinksOfFailure(ctx context.Context, instance DeclarativeObject, objs *manifest.Objects, reconcileErr error) {
+	err := r.notifySinks(ctx, func(sink Sink) error {
+		if sink, ok := sink.(FailureSink); ok {
+			return sink.NotifyFailure(ctx, instance, objs, reconcileErr)
+		}
+		return nil
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "notifying sinks of failure")
+	}
+}
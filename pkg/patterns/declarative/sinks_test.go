@@ -0,0 +1,162 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// recordingSink records the notifications it gets, failing them with err
+type recordingSink struct {
+	err      error
+	notified int
+	failures []error
+}
+
+func (s *recordingSink) Notify(ctx context.Context, dest DeclarativeObject, objs *manifest.Objects) error {
+	s.notified++
+	return s.err
+}
+
+func (s *recordingSink) NotifyFailure(ctx context.Context, dest DeclarativeObject, objs *manifest.Objects, err error) error {
+	s.failures = append(s.failures, err)
+	return s.err
+}
+
+func TestNotifySinksOfSuccess(t *testing.T) {
+	failing := errors.New("sink unavailable")
+	for _, test := range []struct {
+		name     string
+		policy   SinkErrorPolicy
+		wantErr  bool
+		notified []int
+	}{
+		{name: "default aggregates", notified: []int{1, 1, 1}, wantErr: true},
+		{name: "aggregate", policy: SinkErrorsAggregate, notified: []int{1, 1, 1}, wantErr: true},
+		{name: "fail fast", policy: SinkErrorsFailFast, notified: []int{1, 1, 0}, wantErr: true},
+		{name: "ignore", policy: SinkErrorsIgnore, notified: []int{1, 1, 1}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sinks := []*recordingSink{{}, {err: failing}, {}}
+			r := &Reconciler{options: WithSink(sinks[0], sinks[1])(reconcilerParams{sinkErrorPolicy: test.policy})}
+			r.AddSink(sinks[2])
+
+			instance := newGuestbook("default", "test", time.Now())
+			err := r.notifySinksOfSuccess(context.Background(), instance, &manifest.Objects{})
+			if test.wantErr && !errors.Is(err, failing) {
+				t.Errorf("expected the error of the sink, got %v", err)
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			for i, sink := range sinks {
+				if sink.notified != test.notified[i] {
+					t.Errorf("sink %d notified %d times, want %d", i, sink.notified, test.notified[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNotifySinksOfFailure(t *testing.T) {
+	failureSink := &recordingSink{err: errors.New("sink unavailable")}
+	r := &Reconciler{options: WithSink(failureSink, &watchAllSink{})(reconcilerParams{})}
+
+	reconcileErr := errors.New("error applying manifest")
+	r.notifySinksOfFailure(context.Background(), newGuestbook("default", "test", time.Now()), nil, reconcileErr)
+
+	if len(failureSink.failures) != 1 || failureSink.failures[0] != reconcileErr {
+		t.Errorf("expected the FailureSink to be notified of %v, got %v", reconcileErr, failureSink.failures)
+	}
+	if failureSink.notified != 0 {
+		t.Errorf("expected Notify not to be called on failure")
+	}
+}
+
+func TestSetSinkReplaces(t *testing.T) {
+	added, first, second := &recordingSink{}, &recordingSink{}, &recordingSink{}
+	r := &Reconciler{}
+	r.AddSink(added)
+	r.SetSink(first)
+	r.SetSink(second)
+
+	if err := r.notifySinksOfSuccess(context.Background(), newGuestbook("default", "test", time.Now()), &manifest.Objects{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if added.notified != 1 || first.notified != 0 || second.notified != 1 {
+		t.Errorf("expected the added sink and the last set sink to be notified, got %d, %d and %d", added.notified, first.notified, second.notified)
+	}
+}
+
+func TestReconcileNotifiesSinksOnce(t *testing.T) {
+	manifests := staticManifest{"manifest.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	for _, test := range []struct {
+		name     string
+		applier  *reportingApplier
+		sinkErr  error
+		notified int
+		failures int
+	}{
+		{
+			name:     "partial apply",
+			applier:  &reportingApplier{results: &applier.Results{Operations: map[string]string{"configmap/a": "created"}}, err: errors.New("exit status 1")},
+			failures: 1,
+		},
+		{
+			name:     "failing sink",
+			applier:  &reportingApplier{},
+			sinkErr:  errors.New("sink unavailable"),
+			notified: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &recordingSink{err: test.sinkErr}
+			r := &Reconciler{
+				kubectl:       test.applier,
+				client:        fake.NewClientBuilder().Build(),
+				dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+				restMapper:    mapper,
+			}
+			if err := r.applyOptions(WithManifestController(manifests), WithPartialApply(), WithSink(sink)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			instance := newGuestbook("default", "test", time.Now())
+			if _, err := r.reconcileExists(context.Background(), types.NamespacedName{Namespace: "default", Name: "test"}, instance); err == nil {
+				t.Errorf("expected an error")
+			}
+			if sink.notified != test.notified || len(sink.failures) != test.failures {
+				t.Errorf("expected %d notifications and %d failures, got %d and %v", test.notified, test.failures, sink.notified, sink.failures)
+			}
+		})
+	}
+}
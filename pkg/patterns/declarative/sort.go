@@ -26,8 +26,9 @@ import (
 // This will likely become a topological sort in the future, for owner refs.
 // For now, we implement a simple kind-based heuristic for the sort.
 
+// DefaultObjectOrder is the order objects are applied in, unless another order is set with WithObjectOrder
 func DefaultObjectOrder(ctx context.Context) func(o *manifest.Object) int {
-	log := log.Log
+	log := log.FromContext(ctx)
 
 	return func(o *manifest.Object) int {
 		gk := o.Group + "/" + o.Kind
@@ -67,3 +68,86 @@ func DefaultObjectOrder(ctx context.Context) func(o *manifest.Object) int {
 		}
 	}
 }
+
+// RecommendedObjectOrder orders objects so that each object is applied after the objects it usually needs: Namespaces
+// first, then CRDs, RBAC, configuration, workloads and Services.  Webhook configurations and APIServices are applied
+// last, once the Services and workloads serving them are created, as registering them earlier can block the other
+// objects or break discovery.
+func RecommendedObjectOrder(ctx context.Context) func(o *manifest.Object) int {
+	log := log.FromContext(ctx)
+
+	return func(o *manifest.Object) int {
+		switch o.Group + "/" + o.Kind {
+		// Namespaces need to be created before any other resources
+		case "/Namespace":
+			return -2000
+
+		// Create CRDs asap - both because they are slow and because we will likely create instances of them soon
+		case "apiextensions.k8s.io/CustomResourceDefinition":
+			return -1000
+
+		// Policies constrain the objects created in a namespace
+		case "/ResourceQuota", "/LimitRange", "scheduling.k8s.io/PriorityClass", "storage.k8s.io/StorageClass":
+			return -500
+
+		// We need to create ServiceAccounts, Roles before we bind them with a RoleBinding
+		case "/ServiceAccount", "rbac.authorization.k8s.io/ClusterRole", "rbac.authorization.k8s.io/Role":
+			return 1
+		case "rbac.authorization.k8s.io/ClusterRoleBinding", "rbac.authorization.k8s.io/RoleBinding":
+			return 2
+
+		// Pods might need configmap or secrets - avoid backoff by creating them first
+		case "/ConfigMap", "/Secret":
+			return 100
+		case "/PersistentVolumeClaim":
+			return 200
+
+		// Create the pods after we've created other things they might be waiting for
+		case "apps/Deployment", "extensions/Deployment", "apps/DaemonSet", "extensions/DaemonSet", "apps/StatefulSet",
+			"apps/ReplicaSet", "batch/Job", "batch/CronJob":
+			return 1000
+
+		// Autoscalers and disruption budgets act on workloads
+		case "autoscaling/HorizontalPodAutoscaler", "policy/PodDisruptionBudget":
+			return 1001
+
+		// Create services late - after pods have been started
+		case "/Service":
+			return 10000
+
+		// Register webhooks and aggregated APIs once the services serving them exist
+		case "admissionregistration.k8s.io/MutatingWebhookConfiguration",
+			"admissionregistration.k8s.io/ValidatingWebhookConfiguration",
+			"apiregistration.k8s.io/APIService":
+			return 20000
+
+		default:
+			log.WithValues("group", o.Group).WithValues("kind", o.Kind).V(2).Info("unknown group / kind")
+			return 1000
+		}
+	}
+}
+
+// sortLastScore is the score of the objects of the kinds of WithObjectSortLast, above the scores of other objects
+const sortLastScore = 1 << 30
+
+// objectOrder returns the order of the objects of the manifest, set with WithObjectOrder and WithObjectSortLast
+func (r *Reconciler) objectOrder(ctx context.Context) func(o *manifest.Object) int {
+	order := r.options.objectOrder
+	if order == nil {
+		order = DefaultObjectOrder(ctx)
+	}
+	if len(r.options.objectSortLast) == 0 {
+		return order
+	}
+	last := r.options.objectSortLast
+	return func(o *manifest.Object) int {
+		gk := o.GroupKind()
+		for i, k := range last {
+			if k == gk {
+				return sortLastScore + i
+			}
+		}
+		return order(o)
+	}
+}
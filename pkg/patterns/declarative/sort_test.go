@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+const unorderedManifest = `
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: widgets
+---
+apiVersion: example.org/v1
+kind: Widget
+metadata:
+  name: widget
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: webhook
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: webhook
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.org
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: certs
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: widgets
+`
+
+func TestObjectOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []reconcilerOption
+		expected []string
+	}{
+		{
+			name:     "default order",
+			expected: []string{"CustomResourceDefinition", "Namespace", "Secret", "ValidatingWebhookConfiguration", "Deployment", "Widget", "Service"},
+		},
+		{
+			name:     "recommended order",
+			options:  []reconcilerOption{WithObjectOrder(RecommendedObjectOrder(context.Background()))},
+			expected: []string{"Namespace", "CustomResourceDefinition", "Secret", "Deployment", "Widget", "Service", "ValidatingWebhookConfiguration"},
+		},
+		{
+			name: "sort last",
+			options: []reconcilerOption{
+				WithObjectOrder(RecommendedObjectOrder(context.Background())),
+				WithObjectSortLast(schema.GroupKind{Group: "example.org", Kind: "Widget"}),
+			},
+			expected: []string{"Namespace", "CustomResourceDefinition", "Secret", "Deployment", "Service", "ValidatingWebhookConfiguration", "Widget"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			objects, err := manifest.ParseObjects(ctx, unorderedManifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+			r := &Reconciler{}
+			for _, opt := range test.options {
+				r.options = opt(r.options)
+			}
+			objects.Sort(r.objectOrder(ctx))
+
+			var kinds []string
+			for _, o := range objects.Items {
+				kinds = append(kinds, o.Kind)
+			}
+			if !reflect.DeepEqual(kinds, test.expected) {
+				t.Errorf("expected order %v, got %v", test.expected, kinds)
+			}
+		})
+	}
+}
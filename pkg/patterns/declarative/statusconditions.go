@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// ReasonReconcileFailed is the reason for a false ConditionReady and a true ConditionReconciling after a failed reconcile
+	ReasonReconcileFailed = "ReconcileFailed"
+	// ReasonApplied is the reason for a true ConditionReady once all objects have been applied
+	ReasonApplied = "Applied"
+)
+
+// updateConditions sets the Ready, Reconciling and Stalled conditions to reflect the outcome of a reconcile,
+// following the Kubernetes API conventions: Ready is always present, while Reconciling and Stalled are
+// only present while they are true.  result is the result before any resync period is added.
+func (r *Reconciler) updateConditions(ctx context.Context, instance DeclarativeObject, result reconcile.Result, reconcileErr error) error {
+	conditions, supported, err := getConditions(instance)
+	if err != nil || !supported {
+		return err
+	}
+	generation := instance.GetGeneration()
+	ready := meta.FindStatusCondition(conditions, ConditionReady)
+	stalled := meta.FindStatusCondition(conditions, ConditionStalled)
+	dryRun := meta.FindStatusCondition(conditions, ConditionDryRun)
+	if dryRun == nil {
+		// Paused DeclarativeObjects are reported like dry-runs: the drift is previewed, nothing is applied
+		dryRun = meta.FindStatusCondition(conditions, ConditionPaused)
+	}
+
+	switch {
+	case stalled != nil && stalled.Status == metav1.ConditionTrue:
+		// Nothing is in progress until the DeclarativeObject changes
+		meta.RemoveStatusCondition(&conditions, ConditionReconciling)
+		meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:               ConditionReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             stalled.Reason,
+			Message:            stalled.Message,
+			ObservedGeneration: generation,
+		})
+
+	case dryRun != nil && dryRun.Reason == ReasonChangesPending && reconcileErr == nil:
+		// The previewed changes haven't been applied
+		meta.RemoveStatusCondition(&conditions, ConditionReconciling)
+		meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:               ConditionReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonChangesPending,
+			Message:            dryRun.Message,
+			ObservedGeneration: generation,
+		})
+
+	case dryRun != nil && reconcileErr == nil:
+		// Nothing to apply, Ready is unchanged
+		meta.RemoveStatusCondition(&conditions, ConditionReconciling)
+
+	case reconcileErr != nil:
+		meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:               ConditionReconciling,
+			Status:             metav1.ConditionTrue,
+			Reason:             ReasonReconcileFailed,
+			Message:            "Retrying after error",
+			ObservedGeneration: generation,
+		})
+		meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:               ConditionReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonReconcileFailed,
+			Message:            reconcileErr.Error(),
+			ObservedGeneration: generation,
+		})
+
+	case result.Requeue || result.RequeueAfter != 0:
+		// Waiting for apply waves, readiness, or retrying objects that failed to apply
+		reason, message := ReasonProgressing, "Applying objects"
+		if ready != nil && ready.Status == metav1.ConditionFalse && ready.ObservedGeneration == generation {
+			// Keep the more specific reason set while reconciling, eg by WithWaitForReady
+			reason, message = ready.Reason, ready.Message
+		} else {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               ConditionReady,
+				Status:             metav1.ConditionFalse,
+				Reason:             reason,
+				Message:            message,
+				ObservedGeneration: generation,
+			})
+		}
+		meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:               ConditionReconciling,
+			Status:             metav1.ConditionTrue,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: generation,
+		})
+
+	default:
+		meta.RemoveStatusCondition(&conditions, ConditionReconciling)
+		if ready == nil || ready.Status != metav1.ConditionTrue || ready.ObservedGeneration != generation {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               ConditionReady,
+				Status:             metav1.ConditionTrue,
+				Reason:             ReasonApplied,
+				Message:            "All objects have been applied",
+				ObservedGeneration: generation,
+			})
+		}
+	}
+
+	existing, _, err := getConditions(instance)
+	if err != nil {
+		return err
+	}
+	if conditionsEqual(existing, conditions) {
+		return nil
+	}
+	if err := setConditions(instance, conditions); err != nil {
+		return err
+	}
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	return nil
+}
+
+// conditionsEqual compares conditions, ignoring the order and transition times
+func conditionsEqual(a, b []metav1.Condition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, c := range a {
+		other := meta.FindStatusCondition(b, c.Type)
+		if other == nil || other.Status != c.Status || other.Reason != c.Reason ||
+			other.Message != c.Message || other.ObservedGeneration != c.ObservedGeneration {
+			return false
+		}
+	}
+	return true
+}
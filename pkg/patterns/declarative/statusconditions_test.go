@@ -0,0 +1,185 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestUpdateConditions(t *testing.T) {
+	tests := []struct {
+		name              string
+		existing          []metav1.Condition
+		result            reconcile.Result
+		err               error
+		expectedReady     metav1.ConditionStatus
+		expectedReason    string
+		expectReconciling bool
+	}{
+		{
+			name:           "applied",
+			existing:       []metav1.Condition{{Type: ConditionReconciling, Status: metav1.ConditionTrue, Reason: ReasonProgressing}},
+			expectedReady:  metav1.ConditionTrue,
+			expectedReason: ReasonApplied,
+		},
+		{
+			name:              "failed",
+			err:               errors.New("error applying manifest"),
+			expectedReady:     metav1.ConditionFalse,
+			expectedReason:    ReasonReconcileFailed,
+			expectReconciling: true,
+		},
+		{
+			name:              "waiting",
+			result:            reconcile.Result{RequeueAfter: time.Second},
+			expectedReady:     metav1.ConditionFalse,
+			expectedReason:    ReasonProgressing,
+			expectReconciling: true,
+		},
+		{
+			name:              "waiting with reason from the reconcile",
+			existing:          []metav1.Condition{{Type: ConditionReady, Status: metav1.ConditionFalse, Reason: ReasonApplyFailed, Message: "1 of 3 objects failed to apply"}},
+			result:            reconcile.Result{RequeueAfter: time.Second},
+			expectedReady:     metav1.ConditionFalse,
+			expectedReason:    ReasonApplyFailed,
+			expectReconciling: true,
+		},
+		{
+			name: "stalled",
+			existing: []metav1.Condition{
+				{Type: ConditionStalled, Status: metav1.ConditionTrue, Reason: ReasonInvalidSpec, Message: "invalid patch"},
+				{Type: ConditionReconciling, Status: metav1.ConditionTrue, Reason: ReasonReconcileFailed},
+			},
+			expectedReady:  metav1.ConditionFalse,
+			expectedReason: ReasonInvalidSpec,
+		},
+		{
+			name: "paused with drift",
+			existing: []metav1.Condition{
+				{Type: ConditionPaused, Status: metav1.ConditionTrue, Reason: ReasonChangesPending, Message: "Applying the manifest would change 1 of 3 objects"},
+				{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: ReasonApplied},
+			},
+			expectedReady:  metav1.ConditionFalse,
+			expectedReason: ReasonChangesPending,
+		},
+		{
+			name: "paused without drift",
+			existing: []metav1.Condition{
+				{Type: ConditionPaused, Status: metav1.ConditionTrue, Reason: ReasonNoChanges},
+				{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: ReasonApplied},
+			},
+			expectedReady:  metav1.ConditionTrue,
+			expectedReason: ReasonApplied,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			instance := newGuestbook("default", "test", time.Now())
+			if err := setConditions(instance, test.existing); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			r := &Reconciler{client: fake.NewClientBuilder().WithObjects(instance).Build()}
+
+			if err := r.updateConditions(ctx, instance, test.result, test.err); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			updated := &unstructured.Unstructured{}
+			updated.SetGroupVersionKind(instance.GroupVersionKind())
+			if err := r.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, updated); err != nil {
+				t.Fatalf("error getting instance: %v", err)
+			}
+			conditions, _, err := getConditions(updated)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ready := meta.FindStatusCondition(conditions, ConditionReady)
+			if ready == nil || ready.Status != test.expectedReady || ready.Reason != test.expectedReason {
+				t.Errorf("unexpected Ready condition %v", ready)
+			}
+			if reconciling := meta.IsStatusConditionTrue(conditions, ConditionReconciling); reconciling != test.expectReconciling {
+				t.Errorf("expected Reconciling=%v, got %v", test.expectReconciling, conditions)
+			}
+		})
+	}
+}
+
+// typedObject is a typed DeclarativeObject with status.conditions, like an addon embedding CommonStatus
+type typedObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status struct {
+		Healthy    bool               `json:"healthy"`
+		Conditions []metav1.Condition `json:"conditions,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+func (o *typedObject) DeepCopyObject() runtime.Object {
+	out := *o
+	o.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Status.Conditions = append([]metav1.Condition(nil), o.Status.Conditions...)
+	return &out
+}
+
+// typedObjectWithoutConditions is a typed DeclarativeObject without status.conditions
+type typedObjectWithoutConditions struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+}
+
+func (o *typedObjectWithoutConditions) DeepCopyObject() runtime.Object {
+	out := *o
+	o.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func TestTypedConditions(t *testing.T) {
+	o := &typedObject{}
+	o.Status.Healthy = true
+	changed, err := setCondition(o, metav1.Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: ReasonApplied})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || !meta.IsStatusConditionTrue(o.Status.Conditions, ConditionReady) {
+		t.Errorf("expected Ready condition to be set, got %v", o.Status.Conditions)
+	}
+	if !o.Status.Healthy {
+		t.Errorf("expected other status fields to be preserved")
+	}
+
+	without := &typedObjectWithoutConditions{}
+	if _, supported, err := getConditions(without); err != nil || supported {
+		t.Errorf("expected conditions to be unsupported, got supported=%v err=%v", supported, err)
+	}
+	if changed, err := setCondition(without, metav1.Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: ReasonApplied}); err != nil || changed {
+		t.Errorf("expected no change, got changed=%v err=%v", changed, err)
+	}
+}
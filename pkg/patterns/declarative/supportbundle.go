@@ -0,0 +1,287 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+	"sigs.k8s.io/yaml"
+)
+
+// redacted replaces the values of Secrets in support bundles
+const redacted = "REDACTED"
+
+// SupportBundleOptions are what WriteSupportBundle collects besides the DeclarativeObject and its objects
+type SupportBundleOptions struct {
+	// EventsSince is how far back events are collected, one hour if zero
+	EventsSince time.Duration
+	// Logs are the logs of the operator, eg from a file or `kubectl logs`, of which the lines of the reconciles of
+	// the DeclarativeObject are collected.  Logs are left out if nil.
+	Logs io.Reader
+}
+
+// WriteSupportBundle writes a tar.gz archive to w with what is needed to debug the DeclarativeObject name:
+//
+//   object.yaml               the DeclarativeObject, with its spec and status
+//   manifest.yaml             the objects rendered for the DeclarativeObject
+//   live/<kind>/<name>.yaml   the objects in the cluster, by kind and namespace/name
+//   events.yaml               the recent events of the DeclarativeObject and its objects
+//   logs.txt                  the lines of opts.Logs of the reconciles of the DeclarativeObject
+//   errors.txt                what couldn't be collected, and why
+//
+// The data of Secrets is redacted.  What can't be collected is listed in errors.txt rather than failing, so that
+// the bundle of a broken DeclarativeObject, eg one whose manifest doesn't render, still has the rest.
+func (r *Reconciler) WriteSupportBundle(ctx context.Context, name types.NamespacedName, w io.Writer, opts SupportBundleOptions) error {
+	instance := r.prototype.DeepCopyObject().(DeclarativeObject)
+	if err := r.client.Get(ctx, name, instance); err != nil {
+		return fmt.Errorf("error getting %s: %v", name, err)
+	}
+
+	bundle := &supportBundle{files: make(map[string][]byte)}
+	bundle.addYAML("object.yaml", instance)
+
+	objects, err := r.BuildDeploymentObjects(ctx, name, instance)
+	if err != nil {
+		bundle.addError("rendering manifest", err)
+	} else {
+		m, err := redactedManifest(objects)
+		if err != nil {
+			bundle.addError("serializing manifest", err)
+		}
+		bundle.add("manifest.yaml", []byte(m))
+		r.collectLiveObjects(ctx, bundle, r.applyNamespace(ctx, name, instance), objects)
+	}
+
+	since := opts.EventsSince
+	if since == 0 {
+		since = time.Hour
+	}
+	r.collectEvents(ctx, bundle, instance, objects, time.Now().Add(-since))
+
+	if opts.Logs != nil {
+		bundle.collectLogs(opts.Logs, instance)
+	}
+
+	return bundle.write(w)
+}
+
+// supportBundle holds the files of a support bundle, in the order they are added
+type supportBundle struct {
+	names  []string
+	files  map[string][]byte
+	errors []string
+}
+
+func (b *supportBundle) add(name string, data []byte) {
+	if _, found := b.files[name]; !found {
+		b.names = append(b.names, name)
+	}
+	b.files[name] = data
+}
+
+func (b *supportBundle) addYAML(name string, obj interface{}) {
+	y, err := yaml.Marshal(obj)
+	if err != nil {
+		b.addError("serializing "+name, err)
+		return
+	}
+	b.add(name, y)
+}
+
+func (b *supportBundle) addError(what string, err error) {
+	b.errors = append(b.errors, fmt.Sprintf("%s: %v", what, err))
+}
+
+// collectLiveObjects adds the objects in the cluster, in namespace ns if namespaced and not specifying one
+func (r *Reconciler) collectLiveObjects(ctx context.Context, b *supportBundle, ns string, objects *manifest.Objects) {
+	for _, o := range objects.Items {
+		resource, err := r.objectResource(ctx, ns, o)
+		if err != nil {
+			b.addError(fmt.Sprintf("getting %s %s", o.Kind, o.Name), err)
+			continue
+		}
+		live, err := resource.Get(ctx, o.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			b.addError(fmt.Sprintf("getting %s %s", o.Kind, o.Name), fmt.Errorf("not found"))
+			continue
+		} else if err != nil {
+			b.addError(fmt.Sprintf("getting %s %s", o.Kind, o.Name), err)
+			continue
+		}
+		redactSecret(live.Object)
+		kind := o.Kind
+		if o.Group != "" {
+			kind = o.Kind + "." + o.Group
+		}
+		file := live.GetName()
+		if live.GetNamespace() != "" {
+			file = live.GetNamespace() + "/" + live.GetName()
+		}
+		b.addYAML("live/"+kind+"/"+file+".yaml", live.Object)
+	}
+}
+
+// collectEvents adds the events since the given time involving instance or its objects
+func (r *Reconciler) collectEvents(ctx context.Context, b *supportBundle, instance DeclarativeObject, objects *manifest.Objects, since time.Time) {
+	involved := make(map[string]bool)
+	namespaces := map[string]bool{instance.GetNamespace(): true}
+	if objects != nil {
+		for _, o := range objects.Items {
+			involved[eventKey(o.Kind, o.Namespace, o.Name)] = true
+			if o.Namespace != "" {
+				namespaces[o.Namespace] = true
+			}
+		}
+	}
+	kind := instance.GetObjectKind().GroupVersionKind().Kind
+
+	events := &corev1.EventList{}
+	for namespace := range namespaces {
+		list := &corev1.EventList{}
+		if err := r.client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			b.addError("listing events in namespace "+namespace, err)
+			continue
+		}
+		for _, event := range list.Items {
+			object := event.InvolvedObject
+			isInstance := object.Name == instance.GetName() && object.Namespace == instance.GetNamespace() && (kind == "" || object.Kind == kind)
+			if !isInstance && !involved[eventKey(object.Kind, object.Namespace, object.Name)] {
+				continue
+			}
+			if last := eventTime(event); !last.IsZero() && last.Before(since) {
+				continue
+			}
+			events.Items = append(events.Items, event)
+		}
+	}
+	b.addYAML("events.yaml", events)
+}
+
+func eventKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// eventTime returns when event last happened, or the zero time if it doesn't say
+func eventTime(event corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
+
+// collectLogs adds the lines of logs of the reconciles of instance, which are logged with its namespace/name
+func (b *supportBundle) collectLogs(logs io.Reader, instance DeclarativeObject) {
+	object := `"` + instance.GetNamespace() + "/" + instance.GetName() + `"`
+	var filtered bytes.Buffer
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), object) {
+			filtered.WriteString(scanner.Text())
+			filtered.WriteString("\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		b.addError("reading logs", err)
+	}
+	b.add("logs.txt", filtered.Bytes())
+}
+
+func (b *supportBundle) write(w io.Writer) error {
+	if len(b.errors) != 0 {
+		b.add("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n"))
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range b.names {
+		data := b.files[name]
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing %s: %v", name, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return fmt.Errorf("error writing %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// redactedManifest returns the YAML of objects with the data of Secrets redacted
+func redactedManifest(objects *manifest.Objects) (string, error) {
+	redactedObjects := &manifest.Objects{}
+	for _, o := range objects.Items {
+		u := o.UnstructuredObject()
+		if u.GetKind() == "Secret" && u.GroupVersionKind().Group == "" {
+			copied := runtime.DeepCopyJSON(u.Object)
+			redactSecret(copied)
+			redactedObject, err := manifest.NewObject(&unstructured.Unstructured{Object: copied})
+			if err != nil {
+				return "", err
+			}
+			o = redactedObject
+		}
+		redactedObjects.Items = append(redactedObjects.Items, o)
+	}
+	return redactedObjects.YAMLManifest()
+}
+
+// redactSecret replaces the values of data and stringData of obj, if it is a Secret
+func redactSecret(obj map[string]interface{}) {
+	if obj["kind"] != "Secret" || obj["apiVersion"] != "v1" {
+		return
+	}
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := obj[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k := range values {
+			values[k] = redacted
+		}
+	}
+	// The last applied configuration includes the data
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			if _, found := annotations[corev1.LastAppliedConfigAnnotation]; found {
+				annotations[corev1.LastAppliedConfigAnnotation] = redacted
+			}
+		}
+	}
+}
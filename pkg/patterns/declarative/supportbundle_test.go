@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestWriteSupportBundle(t *testing.T) {
+	ctx := context.Background()
+	instance := newGuestbook("default", "test", time.Now())
+	if err := unstructured.SetNestedField(instance.Object, "1.2.3", "spec", "version"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	secret := &unstructured.Unstructured{}
+	secret.SetAPIVersion("v1")
+	secret.SetKind("Secret")
+	secret.SetNamespace("default")
+	secret.SetName("credentials")
+	if err := unstructured.SetNestedStringMap(secret.Object, map[string]string{"password": "c2VjcmV0"}, "data"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now := metav1.Now()
+	events := []runtime.Object{
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "instance-event"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Guestbook", Namespace: "default", Name: "test"},
+			Message:        "Pruned ConfigMap default/old",
+			LastTimestamp:  now,
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "secret-event"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Secret", Namespace: "default", Name: "credentials"},
+			Message:        "Secret updated",
+			LastTimestamp:  now,
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "old-event"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Guestbook", Namespace: "default", Name: "test"},
+			Message:        "Long ago",
+			LastTimestamp:  metav1.NewTime(now.Add(-2 * time.Hour)),
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "other-event"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Guestbook", Namespace: "default", Name: "other"},
+			Message:        "Other object",
+			LastTimestamp:  now,
+		},
+	}
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	r := &Reconciler{
+		prototype:     &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "addons.example.org/v1alpha1", "kind": "Guestbook"}},
+		client:        fake.NewClientBuilder().WithObjects(instance).WithRuntimeObjects(events...).Build(),
+		restMapper:    mapper,
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), secret),
+		options: reconcilerParams{
+			manifestController: staticManifest{"manifest.yaml": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+  namespace: default
+data:
+  password: c2VjcmV0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: missing
+  namespace: default
+`},
+		},
+	}
+
+	logs := strings.Join([]string{
+		`{"level":"info","msg":"reconciling","object":"default/test","generation":1}`,
+		`{"level":"info","msg":"reconciling","object":"default/test2","generation":1}`,
+		`{"level":"info","msg":"starting manager"}`,
+	}, "\n")
+
+	var b bytes.Buffer
+	if err := r.WriteSupportBundle(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, &b, SupportBundleOptions{Logs: strings.NewReader(logs)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files := readTarGz(t, &b)
+	for _, name := range []string{"object.yaml", "manifest.yaml", "live/Secret/default/credentials.yaml", "events.yaml", "logs.txt", "errors.txt"} {
+		if _, found := files[name]; !found {
+			t.Errorf("expected %s in the bundle, got %v", name, files)
+		}
+	}
+	if !strings.Contains(files["object.yaml"], "version: 1.2.3") {
+		t.Errorf("expected the spec in object.yaml, got %s", files["object.yaml"])
+	}
+	for _, name := range []string{"manifest.yaml", "live/Secret/default/credentials.yaml"} {
+		if strings.Contains(files[name], "c2VjcmV0") || !strings.Contains(files[name], "password: REDACTED") {
+			t.Errorf("expected the secret to be redacted in %s, got %s", name, files[name])
+		}
+	}
+	if !strings.Contains(files["events.yaml"], "Pruned ConfigMap default/old") || !strings.Contains(files["events.yaml"], "Secret updated") ||
+		strings.Contains(files["events.yaml"], "Long ago") || strings.Contains(files["events.yaml"], "Other object") {
+		t.Errorf("unexpected events %s", files["events.yaml"])
+	}
+	if expected := `{"level":"info","msg":"reconciling","object":"default/test","generation":1}` + "\n"; files["logs.txt"] != expected {
+		t.Errorf("expected logs %q, got %q", expected, files["logs.txt"])
+	}
+	if !strings.Contains(files["errors.txt"], "getting ConfigMap missing: not found") {
+		t.Errorf("expected the missing ConfigMap to be reported, got %s", files["errors.txt"])
+	}
+}
+
+// readTarGz returns the contents of the files of a tar.gz archive, by name
+func readTarGz(t *testing.T, r io.Reader) map[string]string {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("error reading archive: %v", err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("error reading archive: %v", err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("error reading %s: %v", header.Name, err)
+		}
+		files[header.Name] = string(b)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// TeardownManifestController is implemented by ManifestControllers that provide a teardown manifest for a
+// DeclarativeObject, applied with WithTeardownManifest when the DeclarativeObject is deleted
+type TeardownManifestController interface {
+	// ResolveTeardownManifest returns the raw teardown manifest for a given CR object
+	ResolveTeardownManifest(ctx context.Context, object runtime.Object) (map[string]string, error)
+}
+
+type teardownKey struct{}
+
+// contextWithTeardown makes loadRawManifest load the teardown manifest
+func contextWithTeardown(ctx context.Context) context.Context {
+	return context.WithValue(ctx, teardownKey{}, true)
+}
+
+// isTeardown returns true if ctx is for building the teardown manifest
+func isTeardown(ctx context.Context) bool {
+	teardown, _ := ctx.Value(teardownKey{}).(bool)
+	return teardown
+}
+
+// buildTeardownObjects builds the objects of the teardown manifest of instance, with the same manifest operations
+// and object transforms as the manifest
+func (r *Reconciler) buildTeardownObjects(ctx context.Context, name types.NamespacedName, instance DeclarativeObject) ([]*manifest.Object, error) {
+	objects, err := r.buildObjectsForHooks(contextWithTeardown(ctx), name, instance)
+	if err != nil {
+		return nil, err
+	}
+	return objects.Items, nil
+}
+
+// usesPreDeleteFinalizer returns true if deleting a DeclarativeObject may need to run pre-delete hooks or the
+// teardown manifest
+func (r *Reconciler) usesPreDeleteFinalizer() bool {
+	return r.options.lifecycleHooks || r.options.teardown
+}
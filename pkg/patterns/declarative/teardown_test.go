@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type teardownManifest struct {
+	staticManifest
+	teardown map[string]string
+}
+
+func (m teardownManifest) ResolveTeardownManifest(ctx context.Context, object runtime.Object) (map[string]string, error) {
+	return m.teardown, nil
+}
+
+func TestBuildTeardownObjects(t *testing.T) {
+	manifests := teardownManifest{
+		staticManifest: staticManifest{"manifest.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"},
+		teardown:       map[string]string{"teardown.yaml": "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: deregister\n"},
+	}
+
+	r := &Reconciler{}
+	if err := r.applyOptions(WithManifestController(manifests.staticManifest), WithTeardownManifest()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.validateOptions(); err == nil {
+		t.Errorf("expected an error for a ManifestController without a teardown manifest")
+	}
+
+	if err := r.applyOptions(WithManifestController(manifests), WithTeardownManifest()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.validateOptions(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	instance := newGuestbook("default", "test", time.Now())
+	name := types.NamespacedName{Namespace: "default", Name: "test"}
+	objects, err := r.buildTeardownObjects(context.Background(), name, instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Kind != "Job" || objects[0].Name != "deregister" {
+		t.Errorf("expected the teardown job, got %v", objects)
+	}
+
+	built, err := r.BuildDeploymentObjects(context.Background(), name, instance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(built.Items) != 1 || built.Items[0].Kind != "ConfigMap" {
+		t.Errorf("expected the manifest to be unaffected, got %v", built.Items)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// TemplateManifest returns a ManifestOperation that renders the manifest as a text/template.
+//
+// The template is executed with the DeclarativeObject converted to its unstructured form,
+// so fields are referenced as they appear in YAML, eg {{ .spec.version }}.
+// When WithValuesFrom is used, the resolved values are available as .values.
+// The helpers from TemplateFuncs are available, along with any funcs passed in,
+// which take precedence over the built-in helpers.
+// Referencing a field which isn't set fails the render, rather than writing "<no value>" into the manifest;
+// optional fields are read with index, which returns nil for missing keys, eg {{ index .spec "image" | default "nginx" }}.
+func TemplateManifest(funcs template.FuncMap) ManifestOperation {
+	return func(ctx context.Context, o DeclarativeObject, manifest string) (string, error) {
+		return renderTemplate(ctx, o, manifest, funcs)
+	}
+}
+
+func renderTemplate(ctx context.Context, o DeclarativeObject, manifest string, funcs template.FuncMap) (string, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+	if err != nil {
+		return "", fmt.Errorf("error converting object to unstructured: %v", err)
+	}
+
+	// Copy so we don't add values to the object itself
+	data := make(map[string]interface{}, len(u)+1)
+	for k, v := range u {
+		data[k] = v
+	}
+	if values := ValuesFromContext(ctx); values != nil {
+		data["values"] = values
+	}
+
+	t := template.New("manifest").Option("missingkey=error").Funcs(TemplateFuncs())
+	if funcs != nil {
+		t = t.Funcs(funcs)
+	}
+	t, err = t.Parse(manifest)
+	if err != nil {
+		return "", fmt.Errorf("error parsing manifest template: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error executing manifest template: %v", err)
+	}
+	return b.String(), nil
+}
+
+// TemplateFuncs returns the helper functions available to TemplateManifest
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"default": templateDefault,
+		"quote":   templateQuote,
+		"toYaml":  templateToYAML,
+		"indent":  templateIndent,
+		"lower":   strings.ToLower,
+		"upper":   strings.ToUpper,
+		"trim":    strings.TrimSpace,
+	}
+}
+
+// templateDefault returns value, unless it is nil or the zero value, in which case def is returned
+func templateDefault(def interface{}, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return def
+	case string:
+		if v == "" {
+			return def
+		}
+	case bool:
+		if !v {
+			return def
+		}
+	case int64:
+		if v == 0 {
+			return def
+		}
+	case float64:
+		if v == 0 {
+			return def
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return def
+		}
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return def
+		}
+	}
+	return value
+}
+
+func templateQuote(value interface{}) string {
+	if value == nil {
+		return `""`
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(value))
+}
+
+func templateToYAML(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+func templateIndent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
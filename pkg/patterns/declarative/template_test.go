@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTemplateManifest(t *testing.T) {
+	instance := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "addons.example.org/v1alpha1",
+			"kind":       "Guestbook",
+			"metadata": map[string]interface{}{
+				"name":      "test",
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(3),
+				"labels": map[string]interface{}{
+					"tier": "frontend",
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		funcs    template.FuncMap
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "no template",
+			manifest: "kind: Deployment\n",
+			want:     "kind: Deployment\n",
+		},
+		{
+			name:     "spec field",
+			manifest: "replicas: {{ .spec.replicas }}\nname: {{ .metadata.name }}",
+			want:     "replicas: 3\nname: test",
+		},
+		{
+			name:     "default helper",
+			manifest: `image: {{ index .spec "image" | default "nginx" }}`,
+			want:     "image: nginx",
+		},
+		{
+			name:     "default helper with a set field",
+			manifest: `replicas: {{ index .spec "replicas" | default 1 }}`,
+			want:     "replicas: 3",
+		},
+		{
+			name:     "missing field",
+			manifest: "image: {{ .spec.image }}",
+			wantErr:  true,
+		},
+		{
+			name:     "quote helper",
+			manifest: `name: {{ .metadata.name | quote }}`,
+			want:     `name: "test"`,
+		},
+		{
+			name:     "toYaml and indent helpers",
+			manifest: "labels:\n{{ .spec.labels | toYaml | indent 2 }}",
+			want:     "labels:\n  tier: frontend",
+		},
+		{
+			name:     "custom funcs",
+			manifest: `name: {{ suffix .metadata.name }}`,
+			funcs: template.FuncMap{
+				"suffix": func(s string) string { return s + "-custom" },
+			},
+			want: "name: test-custom",
+		},
+		{
+			name:     "invalid template",
+			manifest: "name: {{ .metadata.name ",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := TemplateManifest(test.funcs)(context.Background(), instance, test.manifest)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.TrimSpace(got) != strings.TrimSpace(test.want) {
+				t.Errorf("unexpected output, want:\n%s\ngot:\n%s", test.want, got)
+			}
+		})
+	}
+}
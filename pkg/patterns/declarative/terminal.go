@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// ReasonTerminalError is the reason for a true ConditionStalled when a TerminalError has no reason
+	ReasonTerminalError = "TerminalError"
+	// ReasonInvalidSpec is the reason for TerminalErrors caused by an invalid spec, eg an invalid patch
+	ReasonInvalidSpec = "InvalidSpec"
+)
+
+// TerminalError is an error that retrying won't fix, such as an invalid spec or an unknown version.
+// Manifest controllers, manifest operations, object transforms and preflight checks can return a
+// TerminalError (wrapped with %w if wrapped at all) to stop the reconciler from requeueing the
+// DeclarativeObject.  Instead, the Stalled condition is set, and the DeclarativeObject is
+// reconciled again when it changes.
+type TerminalError struct {
+	// Reason is the CamelCase reason for the Stalled condition
+	Reason string
+	Err    error
+}
+
+// NewTerminalError wraps err in a TerminalError
+func NewTerminalError(reason string, err error) error {
+	return &TerminalError{Reason: reason, Err: err}
+}
+
+func (e *TerminalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TerminalError) Unwrap() error {
+	return e.Err
+}
+
+// IsTerminalError returns true if err is or wraps a TerminalError
+func IsTerminalError(err error) bool {
+	var terminal *TerminalError
+	return errors.As(err, &terminal)
+}
+
+// stallOnTerminalError sets the Stalled condition for a TerminalError, and stops requeueing
+func (r *Reconciler) stallOnTerminalError(ctx context.Context, instance DeclarativeObject, err error) (reconcile.Result, error) {
+	log := log.FromContext(ctx)
+
+	var terminal *TerminalError
+	errors.As(err, &terminal)
+	reason := terminal.Reason
+	if reason == "" {
+		reason = ReasonTerminalError
+	}
+
+	log.WithValues("reason", reason).Error(err, "reconcile failed with a terminal error, not requeueing")
+
+	changed, condErr := setCondition(instance, metav1.Condition{
+		Type:               ConditionStalled,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            err.Error(),
+		ObservedGeneration: instance.GetGeneration(),
+	})
+	if condErr != nil {
+		return reconcile.Result{}, condErr
+	}
+	if changed {
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating status: %v", err)
+		}
+	}
+	if r.recorder != nil {
+		r.recorder.Event(instance, "Warning", reason, err.Error())
+	}
+	return reconcile.Result{}, nil
+}
+
+// clearStalled removes the Stalled condition set for a TerminalError or repeated failures, once reconciling succeeds
+func (r *Reconciler) clearStalled(ctx context.Context, instance DeclarativeObject) error {
+	conditions, _, err := getConditions(instance)
+	if err != nil {
+		return err
+	}
+	stalled := meta.FindStatusCondition(conditions, ConditionStalled)
+	if stalled == nil || stalled.Reason == ReasonSingletonViolation {
+		return nil
+	}
+
+	changed, err := removeCondition(instance, ConditionStalled, stalled.Reason)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return fmt.Errorf("error updating status: %v", err)
+		}
+	}
+	return nil
+}
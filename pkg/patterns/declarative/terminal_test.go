@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestIsTerminalError(t *testing.T) {
+	terminal := NewTerminalError(ReasonInvalidSpec, errors.New("invalid patch"))
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil", err: nil, expected: false},
+		{name: "plain error", err: errors.New("connection refused"), expected: false},
+		{name: "terminal error", err: terminal, expected: true},
+		{name: "wrapped terminal error", err: fmt.Errorf("error building deployment objects: %w", terminal), expected: true},
+		{name: "terminal error wrapped with %v", err: fmt.Errorf("error building deployment objects: %v", terminal), expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsTerminalError(test.err); got != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestStallOnTerminalError(t *testing.T) {
+	ctx := context.Background()
+	instance := newGuestbook("default", "test", time.Now())
+	r := &Reconciler{
+		client: fake.NewClientBuilder().WithObjects(instance).Build(),
+	}
+
+	getStalled := func() *metav1.Condition {
+		updated := &unstructured.Unstructured{}
+		updated.SetGroupVersionKind(instance.GroupVersionKind())
+		if err := r.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, updated); err != nil {
+			t.Fatalf("error getting instance: %v", err)
+		}
+		conditions, _, err := getConditions(updated)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return meta.FindStatusCondition(conditions, ConditionStalled)
+	}
+
+	err := fmt.Errorf("error building deployment objects: %w", NewTerminalError(ReasonInvalidSpec, errors.New("invalid patch")))
+	result, err := r.stallOnTerminalError(ctx, instance, err)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Requeue || result.RequeueAfter != 0 {
+		t.Errorf("expected no requeue, got %v", result)
+	}
+
+	stalled := getStalled()
+	if stalled == nil || stalled.Status != metav1.ConditionTrue || stalled.Reason != ReasonInvalidSpec {
+		t.Fatalf("unexpected Stalled condition %v", stalled)
+	}
+	if stalled.Message != "error building deployment objects: invalid patch" {
+		t.Errorf("unexpected message %q", stalled.Message)
+	}
+
+	if err := r.clearStalled(ctx, instance); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stalled := getStalled(); stalled != nil {
+		t.Errorf("expected Stalled condition to be removed, got %v", stalled)
+	}
+}
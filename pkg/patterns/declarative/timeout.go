@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+)
+
+// reconcileContext returns the context for a reconcile, cancelled after the timeout of WithReconcileTimeout
+func (r *Reconciler) reconcileContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.options.reconcileTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.options.reconcileTimeout)
+}
+
+// checkTimeout reports err as a timeout if the reconcile ran out of time, as the error returned by whatever was
+// interrupted, such as a killed kubectl, may not say so
+func (r *Reconciler) checkTimeout(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	return fmt.Errorf("reconcile timed out after %v: %w", r.options.reconcileTimeout, err)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTimeout(t *testing.T) {
+	applyErr := errors.New("error applying manifest: signal: killed")
+
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		err      error
+		timedOut bool
+	}{
+		{name: "no timeout", err: applyErr},
+		{name: "succeeded within timeout", timeout: time.Hour},
+		{name: "failed within timeout", timeout: time.Hour, err: applyErr},
+		{name: "timed out", timeout: time.Nanosecond, err: applyErr, timedOut: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{}
+			r.options = WithReconcileTimeout(test.timeout)(r.options)
+			ctx, cancel := r.reconcileContext(context.Background())
+			defer cancel()
+			if test.timedOut {
+				<-ctx.Done()
+			}
+
+			err := r.checkTimeout(ctx, test.err)
+			if !errors.Is(err, test.err) {
+				t.Errorf("expected error wrapping %v, got %v", test.err, err)
+			}
+			if timedOut := err != nil && strings.Contains(err.Error(), "timed out"); timedOut != test.timedOut {
+				t.Errorf("expected timed out=%v, got %v", test.timedOut, err)
+			}
+		})
+	}
+}
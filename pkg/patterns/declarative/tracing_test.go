@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestBuildDeploymentObjectsTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(provider)
+
+	transformErr := errors.New("transform failed")
+	failing := func(ctx context.Context, o DeclarativeObject, objects *manifest.Objects) error {
+		return transformErr
+	}
+	r := &Reconciler{
+		options: reconcilerParams{
+			manifestController:    staticManifest{"manifest.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"},
+			objectTransformations: []ObjectTransform{failing},
+		},
+	}
+	instance := newGuestbook("default", "test", time.Now())
+	name := types.NamespacedName{Namespace: "default", Name: "test"}
+	if _, err := r.BuildDeploymentObjects(context.Background(), name, instance); !errors.Is(err, transformErr) {
+		t.Fatalf("expected the transform error, got %v", err)
+	}
+
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+		if span.Name == "TransformManifest" && span.StatusCode != codes.Error {
+			t.Errorf("expected the transform span to be marked as failed, got %v", span.StatusCode)
+		}
+	}
+	expected := []string{"LoadManifest", "RawManifestOperations", "ParseManifest", "TransformManifest"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected spans %v, got %v", expected, names)
+	}
+}
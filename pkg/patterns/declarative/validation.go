@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// InvalidObject is an object of the manifest that failed server-side validation
+type InvalidObject struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Message   string
+}
+
+func (o InvalidObject) String() string {
+	if o.Namespace != "" {
+		return o.Kind + " " + o.Namespace + "/" + o.Name + ": " + o.Message
+	}
+	return o.Kind + " " + o.Name + ": " + o.Message
+}
+
+// ValidationError is returned with WithServerSideValidation when objects of the manifest are invalid, listing
+// all of them rather than only the first
+type ValidationError struct {
+	Objects []InvalidObject
+	Total   int
+}
+
+func (e *ValidationError) Error() string {
+	var invalid []string
+	for _, o := range e.Objects {
+		invalid = append(invalid, o.String())
+	}
+	return fmt.Sprintf("%d of %d objects failed validation: %s", len(e.Objects), e.Total, strings.Join(invalid, "; "))
+}
+
+// validateObjects validates each object with a server-side dry-run, so the objects are checked against the schema
+// of the cluster before any is applied.  Objects of kinds not yet known, and objects in namespaces not yet created,
+// can't be validated until the CRDs and namespaces of the manifest are applied, so they are skipped.
+func (r *Reconciler) validateObjects(ctx context.Context, ns string, objects *manifest.Objects) error {
+	log := log.FromContext(ctx)
+
+	var invalid []InvalidObject
+	for _, o := range objects.Items {
+		mapping, err := r.restMapping(ctx, o.GroupKind(), o.GroupVersionKind().Version)
+		if meta.IsNoMatchError(err) {
+			log.WithValues("kind", o.GroupKind().String()).V(2).Info("not validating object of unknown kind")
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to get mapping for %s: %v", o.Kind, err)
+		}
+		namespace := o.Namespace
+		if namespace == "" && mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			namespace = ns
+		}
+		resource, err := r.objectResource(ctx, ns, o)
+		if err != nil {
+			return err
+		}
+		_, _, err = r.dryRunApply(ctx, resource, o)
+		if apierrors.IsNotFound(err) {
+			// The namespace of the object doesn't exist yet
+			log.WithValues("object", o.Kind+" "+o.Name).V(2).Info("not validating object, its namespace was not found")
+			continue
+		}
+		if apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+			invalid = append(invalid, InvalidObject{Kind: o.Kind, Namespace: namespace, Name: o.Name, Message: err.Error()})
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error validating %s %s: %v", o.Kind, o.Name, err)
+		}
+	}
+	if len(invalid) != 0 {
+		return &ValidationError{Objects: invalid, Total: len(objects.Items)}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestValidateObjects(t *testing.T) {
+	ctx := context.Background()
+	objects, err := manifest.ParseObjects(ctx, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: valid
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: bad-data
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: new-namespace
+  namespace: created-by-manifest
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: bad-name
+  namespace: other
+`)
+	if err != nil {
+		t.Fatalf("error parsing manifest: %v", err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	configMaps := schema.GroupKind{Kind: "ConfigMap"}
+	// The objects don't exist yet, so they are created by the dry-run of client-side apply
+	client.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		switch action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured).GetName() {
+		case "bad-data":
+			return true, nil, apierrors.NewInvalid(configMaps, "bad-data", field.ErrorList{field.Invalid(field.NewPath("data"), 1, "must be a string")})
+		case "new-namespace":
+			return true, nil, apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "created-by-manifest")
+		case "bad-name":
+			return true, nil, apierrors.NewBadRequest("invalid name")
+		}
+		return true, nil, nil
+	})
+	r := &Reconciler{restMapper: mapper, dynamicClient: client}
+
+	err = r.validateObjects(ctx, "default", objects)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	var invalid []string
+	for _, o := range validationErr.Objects {
+		invalid = append(invalid, o.Kind+" "+o.Namespace+"/"+o.Name)
+	}
+	expected := []string{"ConfigMap default/bad-data", "ConfigMap other/bad-name"}
+	if !reflect.DeepEqual(invalid, expected) || validationErr.Total != 4 {
+		t.Errorf("unexpected invalid objects %v of %d, expected %v of 4", invalid, validationErr.Total, expected)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/yaml"
+)
+
+// ValuesReference is an entry of spec.valuesFrom, referencing a ConfigMap or Secret
+// in the namespace of the DeclarativeObject
+type ValuesReference struct {
+	// Kind is either ConfigMap or Secret
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Key selects a single key holding a YAML document of values.
+	// If Key is not set, each key of the data is used as a value.
+	Key string `json:"key,omitempty"`
+	// Optional references don't fail reconciliation if they don't exist
+	Optional bool `json:"optional,omitempty"`
+}
+
+type valuesContextKey struct{}
+
+// ValuesFromContext returns the values resolved from spec.valuesFrom, when WithValuesFrom is used.
+// ManifestOperations and ObjectTransforms can use this to access the values.
+func ValuesFromContext(ctx context.Context) map[string]interface{} {
+	values, _ := ctx.Value(valuesContextKey{}).(map[string]interface{})
+	return values
+}
+
+func contextWithValues(ctx context.Context, values map[string]interface{}) context.Context {
+	return context.WithValue(ctx, valuesContextKey{}, values)
+}
+
+// resolveValues reads and merges the values from the references in spec.valuesFrom.
+// Later references override earlier ones.
+func (r *Reconciler) resolveValues(ctx context.Context, instance DeclarativeObject) (map[string]interface{}, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(instance)
+	if err != nil {
+		return nil, fmt.Errorf("error converting object to unstructured: %v", err)
+	}
+	refs, _, err := unstructured.NestedSlice(u, "spec", "valuesFrom")
+	if err != nil {
+		return nil, fmt.Errorf("error reading spec.valuesFrom: %v", err)
+	}
+
+	var valuesRefs []ValuesReference
+	for i, ref := range refs {
+		m, ok := ref.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("spec.valuesFrom[%d] was not an object", i)
+		}
+		var valuesRef ValuesReference
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &valuesRef); err != nil {
+			return nil, fmt.Errorf("error parsing spec.valuesFrom[%d]: %v", i, err)
+		}
+		valuesRefs = append(valuesRefs, valuesRef)
+	}
+
+	// Watch the references before reading them, so the instance is reconciled once a missing one is created
+	instanceName := types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}
+	var watched []types.NamespacedName
+	for _, valuesRef := range valuesRefs {
+		watched = append(watched, types.NamespacedName{Namespace: instance.GetNamespace(), Name: valuesRef.Name})
+	}
+	r.valuesRefs.set(instanceName, watched)
+
+	values := map[string]interface{}{}
+	for i, valuesRef := range valuesRefs {
+		key := watched[i]
+		data, err := r.readValuesReference(ctx, key, valuesRef)
+		if err != nil {
+			if apierrors.IsNotFound(err) && valuesRef.Optional {
+				continue
+			}
+			return nil, err
+		}
+
+		if valuesRef.Key != "" {
+			s, ok := data[valuesRef.Key]
+			if !ok {
+				if valuesRef.Optional {
+					continue
+				}
+				return nil, fmt.Errorf("key %q not found in %s %s", valuesRef.Key, valuesRef.Kind, key)
+			}
+			parsed := map[string]interface{}{}
+			if err := yaml.Unmarshal([]byte(s), &parsed); err != nil {
+				return nil, fmt.Errorf("error parsing key %q of %s %s: %v", valuesRef.Key, valuesRef.Kind, key, err)
+			}
+			mergeValues(values, parsed)
+		} else {
+			for k, v := range data {
+				values[k] = v
+			}
+		}
+	}
+
+	return values, nil
+}
+
+func (r *Reconciler) readValuesReference(ctx context.Context, key types.NamespacedName, ref ValuesReference) (map[string]string, error) {
+	switch ref.Kind {
+	case "ConfigMap":
+		cm := &corev1.ConfigMap{}
+		if err := r.client.Get(ctx, key, cm); err != nil {
+			return nil, err
+		}
+		return cm.Data, nil
+	case "Secret":
+		secret := &corev1.Secret{}
+		if err := r.client.Get(ctx, key, secret); err != nil {
+			return nil, err
+		}
+		data := make(map[string]string)
+		for k, v := range secret.Data {
+			data[k] = string(v)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported valuesFrom kind %q, must be ConfigMap or Secret", ref.Kind)
+	}
+}
+
+// mergeValues deep merges src into dst, with src taking precedence
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// valuesTracker records which ConfigMaps and Secrets are referenced by each DeclarativeObject
+type valuesTracker struct {
+	mu   sync.Mutex
+	refs map[types.NamespacedName][]types.NamespacedName
+}
+
+func newValuesTracker() *valuesTracker {
+	return &valuesTracker{refs: make(map[types.NamespacedName][]types.NamespacedName)}
+}
+
+func (t *valuesTracker) set(instance types.NamespacedName, refs []types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(refs) == 0 {
+		delete(t.refs, instance)
+		return
+	}
+	t.refs[instance] = refs
+}
+
+// referencedBy returns the DeclarativeObjects that reference the named object
+func (t *valuesTracker) referencedBy(name types.NamespacedName) []reconcile.Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var requests []reconcile.Request
+	for instance, refs := range t.refs {
+		for _, ref := range refs {
+			if ref == name {
+				requests = append(requests, reconcile.Request{NamespacedName: instance})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// WatchValuesFrom creates watches on ctrl for the ConfigMaps and Secrets referenced
+// in spec.valuesFrom, so that changes to them trigger a reconcile of the referencing objects
+func WatchValuesFrom(ctrl controller.Controller, r *Reconciler) error {
+	mapFn := handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+		return r.valuesRefs.referencedBy(types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()})
+	})
+
+	if err := ctrl.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, mapFn); err != nil {
+		return fmt.Errorf("setting up watch on ConfigMaps: %v", err)
+	}
+	if err := ctrl.Watch(&source.Kind{Type: &corev1.Secret{}}, mapFn); err != nil {
+		return fmt.Errorf("setting up watch on Secrets: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolveValues(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "values", Namespace: "default"},
+		Data: map[string]string{
+			"values.yaml": "image:\n  tag: v1\n  repository: example.com/app\nreplicas: 1\n",
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret-values", Namespace: "default"},
+		Data: map[string][]byte{
+			"password": []byte("hunter2"),
+		},
+	}
+	override := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "override", Namespace: "default"},
+		Data: map[string]string{
+			"values.yaml": "image:\n  tag: v2\n",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		valuesFrom []interface{}
+		expected   map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			name: "merged configmap and secret",
+			valuesFrom: []interface{}{
+				map[string]interface{}{"kind": "ConfigMap", "name": "values", "key": "values.yaml"},
+				map[string]interface{}{"kind": "Secret", "name": "secret-values"},
+				map[string]interface{}{"kind": "ConfigMap", "name": "override", "key": "values.yaml"},
+			},
+			expected: map[string]interface{}{
+				"image": map[string]interface{}{
+					"tag":        "v2",
+					"repository": "example.com/app",
+				},
+				"replicas": float64(1),
+				"password": "hunter2",
+			},
+		},
+		{
+			name: "optional reference not found",
+			valuesFrom: []interface{}{
+				map[string]interface{}{"kind": "ConfigMap", "name": "missing", "optional": true},
+			},
+			expected: map[string]interface{}{},
+		},
+		{
+			name: "required reference not found",
+			valuesFrom: []interface{}{
+				map[string]interface{}{"kind": "ConfigMap", "name": "missing"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported kind",
+			valuesFrom: []interface{}{
+				map[string]interface{}{"kind": "Pod", "name": "values"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Reconciler{
+				client:     fake.NewClientBuilder().WithObjects(cm, secret, override).Build(),
+				valuesRefs: newValuesTracker(),
+			}
+			instance := &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "addons.example.org/v1alpha1",
+					"kind":       "Guestbook",
+					"metadata": map[string]interface{}{
+						"name":      "test",
+						"namespace": "default",
+					},
+					"spec": map[string]interface{}{
+						"valuesFrom": test.valuesFrom,
+					},
+				},
+			}
+
+			values, err := r.resolveValues(context.Background(), instance)
+
+			// References are watched even if they can't be read, so that creating them triggers a reconcile
+			for _, ref := range test.valuesFrom {
+				name := ref.(map[string]interface{})["name"].(string)
+				requests := r.valuesRefs.referencedBy(types.NamespacedName{Namespace: "default", Name: name})
+				if len(requests) != 1 || requests[0].Name != "test" {
+					t.Errorf("expected %s to be tracked as referenced by test, got %v", name, requests)
+				}
+			}
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, test.expected) {
+				t.Errorf("unexpected values, expected %v, got %v", test.expected, values)
+			}
+		})
+	}
+}
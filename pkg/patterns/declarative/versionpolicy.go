@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+
+	semver "github.com/blang/semver/v4"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// ReasonUnsupportedVersionChange is the reason for a true ConditionStalled when a VersionPolicy blocks
+	// the change from the deployed version to spec.version
+	ReasonUnsupportedVersionChange = "UnsupportedVersionChange"
+)
+
+// VersionPolicy decides whether the deployed version of a DeclarativeObject can be changed to the requested
+// spec.version, returning an error explaining why not if it can't.  It is only called when both versions are
+// known and differ.
+type VersionPolicy func(ctx context.Context, instance DeclarativeObject, deployed, requested string) error
+
+// BlockDowngrades is a VersionPolicy that refuses to change to a lower semantic version
+func BlockDowngrades(ctx context.Context, instance DeclarativeObject, deployed, requested string) error {
+	from, to, ok := parseVersions(deployed, requested)
+	if ok && to.LT(from) {
+		return fmt.Errorf("downgrade from version %s to %s is not supported", deployed, requested)
+	}
+	return nil
+}
+
+// BlockSkippedMinorVersions is a VersionPolicy that refuses to upgrade by more than one minor version at a
+// time, or to a different major version
+func BlockSkippedMinorVersions(ctx context.Context, instance DeclarativeObject, deployed, requested string) error {
+	from, to, ok := parseVersions(deployed, requested)
+	if !ok || to.LTE(from) {
+		return nil
+	}
+	if to.Major != from.Major {
+		return fmt.Errorf("upgrade from version %s to %s changes the major version, which is not supported", deployed, requested)
+	}
+	if to.Minor > from.Minor+1 {
+		return fmt.Errorf("upgrade from version %s to %s skips minor versions, upgrade to %d.%d first", deployed, requested, from.Major, from.Minor+1)
+	}
+	return nil
+}
+
+// parseVersions parses both versions as semantic versions, returning false if either isn't one
+func parseVersions(deployed, requested string) (semver.Version, semver.Version, bool) {
+	from, err := semver.ParseTolerant(deployed)
+	if err != nil {
+		return semver.Version{}, semver.Version{}, false
+	}
+	to, err := semver.ParseTolerant(requested)
+	if err != nil {
+		return semver.Version{}, semver.Version{}, false
+	}
+	return from, to, true
+}
+
+// checkVersionPolicies runs the version policies against the change from the deployed version to spec.version,
+// returning a TerminalError if the change isn't allowed
+func (r *Reconciler) checkVersionPolicies(ctx context.Context, instance DeclarativeObject) error {
+	deployed, err := r.deployedVersion(ctx, instance)
+	if err != nil {
+		return err
+	}
+	requested := specVersion(instance)
+	if deployed == "" || requested == "" || deployed == requested {
+		return nil
+	}
+	for _, policy := range r.options.versionPolicies {
+		if err := policy(ctx, instance, deployed, requested); err != nil {
+			return NewTerminalError(ReasonUnsupportedVersionChange, err)
+		}
+	}
+	return nil
+}
+
+// deployedVersion returns status.deployedVersion of instance, falling back to the version of the latest
+// revision with WithRevisionHistory
+func (r *Reconciler) deployedVersion(ctx context.Context, instance DeclarativeObject) (string, error) {
+	obj, err := objectMap(instance)
+	if err != nil {
+		return "", err
+	}
+	if version, _, _ := unstructured.NestedString(obj, "status", "deployedVersion"); version != "" {
+		return version, nil
+	}
+	if !r.options.revisionHistory {
+		return "", nil
+	}
+	revisions, err := r.listRevisions(ctx, instance)
+	if err != nil || len(revisions) == 0 {
+		return "", err
+	}
+	return revisions[len(revisions)-1].Version, nil
+}
+
+// recordDeployedVersion sets status.deployedVersion of instance to version once it has been applied.  Typed objects
+// must have a status.deployedVersion field, or an error is returned.
+func (r *Reconciler) recordDeployedVersion(ctx context.Context, instance DeclarativeObject, version string) error {
+	obj, err := objectMap(instance)
+	if err != nil {
+		return err
+	}
+	if current, _, _ := unstructured.NestedString(obj, "status", "deployedVersion"); current == version || version == "" {
+		return nil
+	}
+	if err := unstructured.SetNestedField(obj, version, "status", "deployedVersion"); err != nil {
+		return fmt.Errorf("error setting status.deployedVersion: %v", err)
+	}
+	if _, ok := instance.(*unstructured.Unstructured); !ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, instance); err != nil {
+			return fmt.Errorf("error converting object from unstructured: %v", err)
+		}
+		// The conversion drops the fields the type doesn't have
+		converted, err := objectMap(instance)
+		if err != nil {
+			return err
+		}
+		if recorded, _, _ := unstructured.NestedString(converted, "status", "deployedVersion"); recorded != version {
+			return fmt.Errorf("error recording deployed version: %T has no status.deployedVersion field", instance)
+		}
+	}
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("error updating status: %v", err)
+	}
+	return nil
+}
+
+// objectMap returns the fields of instance as an unstructured map, shared with instance if it is unstructured
+func objectMap(instance DeclarativeObject) (map[string]interface{}, error) {
+	if u, ok := instance.(*unstructured.Unstructured); ok {
+		return u.Object, nil
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(instance)
+	if err != nil {
+		return nil, fmt.Errorf("error converting object to unstructured: %v", err)
+	}
+	return obj, nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestVersionPolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		deployed  string
+		requested string
+		expectErr bool
+	}{
+		{name: "first install", requested: "1.0.0"},
+		{name: "unchanged", deployed: "1.2.0", requested: "1.2.0"},
+		{name: "patch upgrade", deployed: "1.2.0", requested: "1.2.3"},
+		{name: "minor upgrade", deployed: "v1.2.3", requested: "v1.3.0"},
+		{name: "skipped minor version", deployed: "1.2.0", requested: "1.4.0", expectErr: true},
+		{name: "major upgrade", deployed: "1.2.0", requested: "2.0.0", expectErr: true},
+		{name: "downgrade", deployed: "1.2.0", requested: "1.1.0", expectErr: true},
+		{name: "not semver", deployed: "stable-1", requested: "stable-2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			instance := newGuestbook("default", "test", time.Now())
+			if err := unstructured.SetNestedField(instance.Object, test.requested, "spec", "version"); err != nil {
+				t.Fatalf("error setting version: %v", err)
+			}
+			if test.deployed != "" {
+				if err := unstructured.SetNestedField(instance.Object, test.deployed, "status", "deployedVersion"); err != nil {
+					t.Fatalf("error setting deployed version: %v", err)
+				}
+			}
+			r := &Reconciler{
+				client:  fake.NewClientBuilder().Build(),
+				options: reconcilerParams{versionPolicies: []VersionPolicy{BlockDowngrades, BlockSkippedMinorVersions}},
+			}
+
+			err := r.checkVersionPolicies(ctx, instance)
+			if test.expectErr && !IsTerminalError(err) {
+				t.Errorf("expected a terminal error, got %v", err)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRecordDeployedVersion(t *testing.T) {
+	ctx := context.Background()
+	instance := newGuestbook("default", "test", time.Now())
+	r := &Reconciler{client: fake.NewClientBuilder().WithObjects(instance).Build()}
+
+	if err := r.recordDeployedVersion(ctx, instance, "1.2.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployed, err := r.deployedVersion(ctx, instance)
+	if err != nil || deployed != "1.2.0" {
+		t.Errorf("expected deployed version 1.2.0, got %q, %v", deployed, err)
+	}
+}
+
+func TestRecordDeployedVersionWithoutStatusField(t *testing.T) {
+	ctx := context.Background()
+	// ConfigMaps have no status, like typed objects without a status.deployedVersion field
+	instance := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	r := &Reconciler{client: fake.NewClientBuilder().WithObjects(instance).Build()}
+
+	err := r.recordDeployedVersion(ctx, instance, "1.2.0")
+	if err == nil || !strings.Contains(err.Error(), "has no status.deployedVersion field") {
+		t.Errorf("expected an error for the missing field, got %v", err)
+	}
+}
@@ -43,8 +43,25 @@ type DynamicWatch interface {
 	Add(trigger schema.GroupVersionKind, options metav1.ListOptions, target metav1.ObjectMeta) error
 }
 
+// NamespacedDynamicWatch is implemented by DynamicWatches that can watch namespaced kinds in a single namespace,
+// for WatchAllNamespaced.  Other DynamicWatches watch all namespaces.
+type NamespacedDynamicWatch interface {
+	// AddNamespaced is Add, but namespaced kinds are only watched in 'filterNamespace', if it is set
+	AddNamespaced(trigger schema.GroupVersionKind, options metav1.ListOptions, filterNamespace string, target metav1.ObjectMeta) error
+}
+
 // WatchAll creates a Watch on ctrl for all objects reconciled by recnl
 func WatchAll(config *rest.Config, ctrl controller.Controller, recnl Source, labelMaker LabelMaker) (chan struct{}, error) {
+	return watchAll(config, ctrl, recnl, labelMaker, false)
+}
+
+// WatchAllNamespaced is WatchAll, but watches namespaced kinds only in the namespaces of the objects reconciled,
+// rather than in all namespaces, so that the operator only needs RBAC in those namespaces (see WithNamespaceScope)
+func WatchAllNamespaced(config *rest.Config, ctrl controller.Controller, recnl Source, labelMaker LabelMaker) (chan struct{}, error) {
+	return watchAll(config, ctrl, recnl, labelMaker, true)
+}
+
+func watchAll(config *rest.Config, ctrl controller.Controller, recnl Source, labelMaker LabelMaker, namespaced bool) (chan struct{}, error) {
 	if labelMaker == nil {
 		return nil, fmt.Errorf("labelMaker is required to scope watches")
 	}
@@ -61,18 +78,20 @@ func WatchAll(config *rest.Config, ctrl controller.Controller, recnl Source, lab
 	if err := ctrl.Watch(src, &handler.EnqueueRequestForObject{}); err != nil {
 		return nil, fmt.Errorf("setting up dynamic watch on the controller: %v", err)
 	}
-	recnl.SetSink(&watchAll{dw, labelMaker, make(map[string]struct{})})
+	recnl.SetSink(&watchAllSink{dw, labelMaker, namespaced, make(map[string]struct{})})
 	return stopCh, nil
 }
 
-type watchAll struct {
+type watchAllSink struct {
 	dw         DynamicWatch
 	labelMaker LabelMaker
+	// namespaced watches namespaced kinds only in the namespaces of the objects
+	namespaced bool
 	registered map[string]struct{}
 }
 
-func (w *watchAll) Notify(ctx context.Context, dest DeclarativeObject, objs *manifest.Objects) error {
-	log := log.Log
+func (w *watchAllSink) Notify(ctx context.Context, dest DeclarativeObject, objs *manifest.Objects) error {
+	log := log.FromContext(ctx)
 
 	labelSelector := strings.Builder{}
 	for k, v := range w.labelMaker(ctx, dest) {
@@ -85,21 +104,58 @@ func (w *watchAll) Notify(ctx context.Context, dest DeclarativeObject, objs *man
 	notify := metav1.ObjectMeta{Name: dest.GetName(), Namespace: dest.GetNamespace()}
 	filter := metav1.ListOptions{LabelSelector: labelSelector.String()}
 
+	namespacedWatch, namespaced := w.dw.(NamespacedDynamicWatch)
+	namespaced = namespaced && w.namespaced
+
 	for _, gvk := range uniqueGroupVersionKind(objs) {
-		key := fmt.Sprintf("%s,%s,%s", gvk.String(), labelSelector.String(), dest.GetNamespace())
-		if _, ok := w.registered[key]; ok {
-			continue
+		namespaces := []string{""}
+		if namespaced {
+			namespaces = objectNamespaces(objs, gvk, dest.GetNamespace())
+		}
+		for _, ns := range namespaces {
+			key := fmt.Sprintf("%s,%s,%s,%s", gvk.String(), labelSelector.String(), dest.GetNamespace(), ns)
+			if _, ok := w.registered[key]; ok {
+				continue
+			}
+
+			var err error
+			if namespaced {
+				err = namespacedWatch.AddNamespaced(gvk, filter, ns, notify)
+			} else {
+				err = w.dw.Add(gvk, filter, notify)
+			}
+			if err != nil {
+				log.WithValues("GroupVersionKind", gvk.String()).Error(err, "adding watch")
+				continue
+			}
+
+			w.registered[key] = struct{}{}
 		}
+	}
+	return nil
+}
 
-		err := w.dw.Add(gvk, filter, notify)
-		if err != nil {
-			log.WithValues("GroupVersionKind", gvk.String()).Error(err, "adding watch")
+// objectNamespaces returns the unique namespaces of the objects of kind gvk, with defaultNamespace for the objects
+// without a namespace
+func objectNamespaces(objects *manifest.Objects, gvk schema.GroupVersionKind, defaultNamespace string) []string {
+	seen := map[string]struct{}{}
+	var namespaces []string
+	for _, o := range objects.Items {
+		if o.GroupVersionKind() != gvk {
 			continue
 		}
-
-		w.registered[key] = struct{}{}
+		ns := o.Namespace
+		if ns == "" {
+			ns = defaultNamespace
+		}
+		if _, ok := seen[ns]; ok {
+			continue
+		}
+		seen[ns] = struct{}{}
+		namespaces = append(namespaces, ns)
 	}
-	return nil
+	sort.Strings(namespaces)
+	return namespaces
 }
 
 // uniqueGroupVersionKind returns all unique GroupVersionKind defined in objects
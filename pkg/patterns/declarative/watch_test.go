@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+type recordingWatch struct {
+	added []string
+}
+
+func (w *recordingWatch) Add(trigger schema.GroupVersionKind, options metav1.ListOptions, target metav1.ObjectMeta) error {
+	w.added = append(w.added, fmt.Sprintf("%s in all namespaces", trigger.Kind))
+	return nil
+}
+
+// recordingNamespacedWatch also records the watches added in a single namespace
+type recordingNamespacedWatch struct {
+	recordingWatch
+}
+
+func (w *recordingNamespacedWatch) AddNamespaced(trigger schema.GroupVersionKind, options metav1.ListOptions, filterNamespace string, target metav1.ObjectMeta) error {
+	w.added = append(w.added, fmt.Sprintf("%s in %q", trigger.Kind, filterNamespace))
+	return nil
+}
+
+func TestWatchAllNotify(t *testing.T) {
+	inputManifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  namespace: team-b
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+`
+	tests := []struct {
+		name       string
+		dw         DynamicWatch
+		namespaced bool
+		expected   []string
+	}{
+		{
+			name:     "all namespaces",
+			dw:       &recordingNamespacedWatch{},
+			expected: []string{"Service in all namespaces", "Deployment in all namespaces"},
+		},
+		{
+			name:       "namespaced",
+			dw:         &recordingNamespacedWatch{},
+			namespaced: true,
+			expected:   []string{`Service in "team-a"`, `Deployment in "team-a"`, `Deployment in "team-b"`},
+		},
+		{
+			name:       "namespaced without NamespacedDynamicWatch",
+			dw:         &recordingWatch{},
+			namespaced: true,
+			expected:   []string{"Service in all namespaces", "Deployment in all namespaces"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+			labels := func(context.Context, DeclarativeObject) map[string]string {
+				return map[string]string{"app": "guestbook"}
+			}
+			sink := &watchAllSink{test.dw, labels, test.namespaced, make(map[string]struct{})}
+			instance := newGuestbook("team-a", "test", time.Now())
+			for i := 0; i < 2; i++ {
+				if err := sink.Notify(context.Background(), instance, objects); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			var added []string
+			switch dw := test.dw.(type) {
+			case *recordingWatch:
+				added = dw.added
+			case *recordingNamespacedWatch:
+				added = dw.added
+			}
+			if !reflect.DeepEqual(added, test.expected) {
+				t.Errorf("expected watches %v, got %v", test.expected, added)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// ApplyWaveAnnotation sets the wave an object is applied in, when WithApplyWaves is used.
+// Waves are applied in increasing order; objects without the annotation are in wave 0.
+const ApplyWaveAnnotation = "addons.k8s.io/apply-wave"
+
+// waveRecheckInterval is how often we check whether a wave is ready, when waiting for waves
+var waveRecheckInterval = 10 * time.Second
+
+// applyWaves groups objects by their apply wave, in increasing order of wave.
+// The order of objects within a wave is preserved.
+func applyWaves(objects []*manifest.Object) ([][]*manifest.Object, error) {
+	byWave := make(map[int][]*manifest.Object)
+	for _, o := range objects {
+		wave := 0
+		if v, found := o.UnstructuredObject().GetAnnotations()[ApplyWaveAnnotation]; found {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s annotation %q on %s %s: %v", ApplyWaveAnnotation, v, o.Kind, o.Name, err)
+			}
+			wave = i
+		}
+		byWave[wave] = append(byWave[wave], o)
+	}
+
+	var keys []int
+	for k := range byWave {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	var waves [][]*manifest.Object
+	for _, k := range keys {
+		waves = append(waves, byWave[k])
+	}
+	return waves, nil
+}
+
+// applyInWaves applies the objects one wave at a time.  Each apply includes the objects of
+// the earlier waves, so pruning is only done by the final apply, which includes all objects.
+// If WithApplyWaves is waiting for waves, it returns false when a wave is not yet ready,
+// and the remaining waves should be applied in a later reconcile.
+// The results are those of the last apply, which includes all the objects applied so far.
+func (r *Reconciler) applyInWaves(ctx context.Context, ns string, objects *manifest.Objects, extraArgs []string, pruneArgs []string) ([]ApplyResult, bool, error) {
+	log := log.FromContext(ctx)
+
+	waves, err := applyWaves(objects.Items)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var results []ApplyResult
+	applied := &manifest.Objects{}
+	for i, wave := range waves {
+		applied.Items = append(applied.Items, wave...)
+		m, err := applied.JSONManifest()
+		if err != nil {
+			return nil, false, fmt.Errorf("error creating manifest: %v", err)
+		}
+
+		args := extraArgs
+		last := i == len(waves)-1
+		if last && len(pruneArgs) != 0 {
+			args = append(append([]string{}, extraArgs...), pruneArgs...)
+			r.listPruned(ctx, ns, applied.Items)
+		}
+
+		log.WithValues("wave", i).WithValues("objects", len(wave)).Info("applying wave")
+		results, err = r.applyWithResults(ctx, ns, m, applied.Items, args...)
+		if err != nil {
+			return results, false, err
+		}
+
+		if r.options.waitForWaves && !last {
+			ready, err := r.objectsReady(ctx, wave)
+			if err != nil {
+				return results, false, err
+			}
+			if !ready {
+				log.WithValues("wave", i).Info("wave is not yet ready, waiting before applying later waves")
+				return results, false, nil
+			}
+		}
+	}
+	return results, true, nil
+}
+
+// objectsReady returns true if all the objects exist in the cluster and are reconciled, according to kstatus
+func (r *Reconciler) objectsReady(ctx context.Context, objects []*manifest.Object) (bool, error) {
+	notReady, err := r.notReadyObjects(ctx, objects)
+	if err != nil {
+		return false, err
+	}
+	return len(notReady) == 0, nil
+}
+
+// notReadyObjects returns the objects that don't exist in the cluster or aren't reconciled, according to kstatus
+func (r *Reconciler) notReadyObjects(ctx context.Context, objects []*manifest.Object) ([]*manifest.Object, error) {
+	log := log.FromContext(ctx)
+	var notReady []*manifest.Object
+	for _, o := range objects {
+		u, err := GetObjectFromCluster(ctx, o, r)
+		if err != nil {
+			log.WithValues("kind", o.Kind).WithValues("name", o.Name).WithValues("error", err).V(1).Info("object is not ready")
+			notReady = append(notReady, o)
+			continue
+		}
+		res, err := status.Compute(u)
+		if err != nil {
+			return nil, fmt.Errorf("error computing status of %s %s: %v", o.Kind, o.Name, err)
+		}
+		if res.Status != status.CurrentStatus {
+			log.WithValues("kind", o.Kind).WithValues("name", o.Name).WithValues("status", res.Status).V(1).Info("object is not ready")
+			notReady = append(notReady, o)
+		}
+	}
+	return notReady, nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// recordingApplier records the manifests and args passed to Apply
+type recordingApplier struct {
+	manifests []string
+	args      [][]string
+}
+
+func (a *recordingApplier) Apply(ctx context.Context, namespace string, manifest string, validate bool, args ...string) error {
+	a.manifests = append(a.manifests, manifest)
+	a.args = append(a.args, args)
+	return nil
+}
+
+func TestApplyInWaves(t *testing.T) {
+	inputManifest := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: late
+  namespace: default
+  annotations:
+    addons.k8s.io/apply-wave: "2"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: early
+  namespace: default
+  annotations:
+    addons.k8s.io/apply-wave: "-1"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: default
+  namespace: default
+`
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	tests := []struct {
+		name         string
+		waitForWaves bool
+		existing     []string
+		expected     [][]string
+		complete     bool
+	}{
+		{
+			name: "without waiting",
+			expected: [][]string{
+				{"early"},
+				{"early", "default"},
+				{"early", "default", "late"},
+			},
+			complete: true,
+		},
+		{
+			name:         "waiting for a wave that is not ready",
+			waitForWaves: true,
+			existing:     []string{"early"},
+			expected: [][]string{
+				{"early"},
+				{"early", "default"},
+			},
+			complete: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := manifest.ParseObjects(context.Background(), inputManifest)
+			if err != nil {
+				t.Fatalf("error parsing manifest: %v", err)
+			}
+
+			var existing []runtime.Object
+			for _, o := range objects.Items {
+				for _, name := range test.existing {
+					if o.Name == name {
+						existing = append(existing, o.UnstructuredObject().DeepCopy())
+					}
+				}
+			}
+
+			applier := &recordingApplier{}
+			r := &Reconciler{
+				kubectl:       applier,
+				restMapper:    mapper,
+				dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing...),
+				options:       reconcilerParams{applyWaves: true, waitForWaves: test.waitForWaves},
+			}
+
+			_, complete, err := r.applyInWaves(context.Background(), "default", objects, []string{"--force"}, []string{"--prune"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if complete != test.complete {
+				t.Errorf("expected complete=%v, got %v", test.complete, complete)
+			}
+
+			var applied [][]string
+			for _, m := range applier.manifests {
+				var names []string
+				for _, o := range objects.Items {
+					if strings.Contains(m, `"name":"`+o.Name+`"`) {
+						names = append(names, o.Name)
+					}
+				}
+				applied = append(applied, names)
+			}
+			// Objects of each wave keep their relative order
+			for i := range applied {
+				applied[i] = orderBy(applied[i], []string{"early", "default", "late"})
+			}
+			if !reflect.DeepEqual(applied, test.expected) {
+				t.Errorf("unexpected applies, expected %v, got %v", test.expected, applied)
+			}
+
+			for i, args := range applier.args {
+				prune := len(args) == 2 && args[1] == "--prune"
+				if prune != (test.complete && i == len(applier.args)-1) {
+					t.Errorf("unexpected args for apply %d: %v", i, args)
+				}
+			}
+		})
+	}
+}
+
+func orderBy(names []string, order []string) []string {
+	var out []string
+	for _, o := range order {
+		for _, n := range names {
+			if n == o {
+				out = append(out, n)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// ReasonWebhookCertificateIssued is the reason for the events recording a new webhook serving certificate
+const ReasonWebhookCertificateIssued = "WebhookCertificateIssued"
+
+const (
+	// defaultWebhookCertificateValidity is how long webhook serving certificates are valid by default
+	defaultWebhookCertificateValidity = 365 * 24 * time.Hour
+	// webhookCertificateClockSkew backdates certificates, so that they are valid on servers whose clock is behind
+	webhookCertificateClockSkew = 5 * time.Minute
+)
+
+// WebhookCertificate is the serving certificate of the webhooks of the manifest, managed by WithWebhookCertificate
+type WebhookCertificate struct {
+	// ServiceName is the name of the Service of the webhooks, whose configurations are given the CA of the certificate
+	ServiceName string
+	// SecretName is the name of the kubernetes.io/tls Secret with the certificate, to be mounted by the webhook server
+	SecretName string
+	// Namespace is the namespace of the Service and the Secret, the namespace the manifest is applied in if empty
+	Namespace string
+	// Validity is how long certificates are valid, a year if zero
+	Validity time.Duration
+	// RenewBefore is how long before it expires a certificate is renewed, a third of Validity if zero
+	RenewBefore time.Duration
+}
+
+// secretsResource is the resource of Secrets
+var secretsResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// injectWebhookCertificate adds the Secret of the webhook serving certificate to objects, issuing a new certificate
+// if the Secret in the cluster has none or it is due for renewal, and sets the caBundle of the webhooks of the Service.
+// It returns when the certificate is to be renewed.
+func (r *Reconciler) injectWebhookCertificate(ctx context.Context, name types.NamespacedName, instance DeclarativeObject, objects *manifest.Objects) (time.Time, error) {
+	log := log.FromContext(ctx)
+	c := r.options.webhookCertificate
+
+	ns := c.Namespace
+	if ns == "" {
+		ns = r.applyNamespace(ctx, name, instance)
+	}
+	if ns == "" {
+		return time.Time{}, fmt.Errorf("no namespace for webhook certificate Secret %s", c.SecretName)
+	}
+	validity := c.Validity
+	if validity <= 0 {
+		validity = defaultWebhookCertificateValidity
+	}
+	renewBefore := c.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = validity / 3
+	}
+
+	// The Secret is read from the cluster it is applied to, without a cache of every Secret
+	var existing map[string][]byte
+	live, err := r.dynamicClient.Resource(secretsResource).Namespace(ns).Get(ctx, c.SecretName, metav1.GetOptions{})
+	if err == nil {
+		secret := &corev1.Secret{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(live.Object, secret); err != nil {
+			return time.Time{}, fmt.Errorf("error parsing webhook certificate Secret %s/%s: %v", ns, c.SecretName, err)
+		}
+		existing = secret.Data
+	} else if !apierrors.IsNotFound(err) {
+		return time.Time{}, fmt.Errorf("error getting webhook certificate Secret %s/%s: %v", ns, c.SecretName, err)
+	}
+
+	now := time.Now()
+	dnsNames := serviceDNSNames(c.ServiceName, ns)
+	data := existing
+	renewAt, ok := certificateRenewal(existing, dnsNames, renewBefore)
+	if !ok || !now.Before(renewAt) {
+		var err error
+		data, err = issueWebhookCertificate(dnsNames, existing[corev1.ServiceAccountRootCAKey], now, validity)
+		if err != nil {
+			return time.Time{}, err
+		}
+		renewAt = now.Add(validity - renewBefore)
+		log.WithValues("secret", ns+"/"+c.SecretName).WithValues("renewAt", renewAt).Info("issued webhook serving certificate")
+		if r.recorder != nil {
+			r.recorder.Eventf(instance, "Normal", ReasonWebhookCertificateIssued, "Issued webhook serving certificate in Secret %s/%s", ns, c.SecretName)
+		}
+	}
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": c.SecretName, "namespace": ns},
+		"type":       string(corev1.SecretTypeTLS),
+		"data": map[string]interface{}{
+			corev1.TLSCertKey:              base64.StdEncoding.EncodeToString(data[corev1.TLSCertKey]),
+			corev1.TLSPrivateKeyKey:        base64.StdEncoding.EncodeToString(data[corev1.TLSPrivateKeyKey]),
+			corev1.ServiceAccountRootCAKey: base64.StdEncoding.EncodeToString(data[corev1.ServiceAccountRootCAKey]),
+		},
+	}}
+	u.SetLabels(r.labelsFor(ctx, instance))
+	secretObject, err := manifest.NewObject(u)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error creating webhook certificate Secret: %v", err)
+	}
+	// The Secret replaces any placeholder of the manifest
+	objects.Remove(func(o *manifest.Object) bool {
+		return o.GroupKind() == secretObject.GroupKind() && o.Name == c.SecretName && (o.Namespace == ns || o.Namespace == "")
+	})
+	objects.Items = append(objects.Items, secretObject)
+
+	caBundle := base64.StdEncoding.EncodeToString(data[corev1.ServiceAccountRootCAKey])
+	for _, o := range objects.Items {
+		if err := injectServiceCABundle(o, c.ServiceName, ns, caBundle); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return renewAt, nil
+}
+
+// serviceDNSNames returns the names a Service is reached by inside the cluster
+func serviceDNSNames(service, namespace string) []string {
+	return []string{
+		service,
+		service + "." + namespace,
+		service + "." + namespace + ".svc",
+		service + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+// certificateRenewal returns when the serving certificate in the data of a Secret is to be renewed,
+// or false if there is no certificate for all of dnsNames
+func certificateRenewal(data map[string][]byte, dnsNames []string, renewBefore time.Duration) (time.Time, bool) {
+	if len(data[corev1.TLSPrivateKeyKey]) == 0 || len(data[corev1.ServiceAccountRootCAKey]) == 0 {
+		return time.Time{}, false
+	}
+	certs := parseCertificates(data[corev1.TLSCertKey])
+	if len(certs) == 0 {
+		return time.Time{}, false
+	}
+	names := make(map[string]bool)
+	for _, n := range certs[0].DNSNames {
+		names[n] = true
+	}
+	for _, n := range dnsNames {
+		if !names[n] {
+			return time.Time{}, false
+		}
+	}
+	return certs[0].NotAfter.Add(-renewBefore), true
+}
+
+// issueWebhookCertificate returns the data of a Secret with a new CA and a serving certificate for dnsNames signed
+// by it.  The CA of the previous certificate, if still valid, stays in ca.crt, so that webhook servers still
+// using the previous certificate are trusted until they load the new one.
+func issueWebhookCertificate(dnsNames []string, previousCA []byte, now time.Time, validity time.Duration) (map[string][]byte, error) {
+	notBefore, notAfter := now.Add(-webhookCertificateClockSkew), now.Add(validity)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          randomSerialNumber(),
+		Subject:               pkix.Name{CommonName: dnsNames[0] + "-ca"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating CA certificate: %v", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CA certificate: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating serving key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: randomSerialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[len(dnsNames)-2]},
+		DNSNames:     dnsNames,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating serving certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding serving key: %v", err)
+	}
+
+	var caBundle bytes.Buffer
+	caBundle.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+	if previous := parseCertificates(previousCA); len(previous) != 0 && now.Before(previous[0].NotAfter) {
+		caBundle.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: previous[0].Raw}))
+	}
+	return map[string][]byte{
+		corev1.TLSCertKey:              pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		corev1.TLSPrivateKeyKey:        pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		corev1.ServiceAccountRootCAKey: caBundle.Bytes(),
+	}, nil
+}
+
+// parseCertificates returns the certificates of PEM data, skipping what can't be parsed
+func parseCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+func randomSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		// Serial numbers only need to be unique per CA, and each CA signs one certificate
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+// injectServiceCABundle sets the caBundle of the webhooks of o calling the Service namespace/service
+func injectServiceCABundle(o *manifest.Object, service, namespace, caBundle string) error {
+	return o.MutateObject(func(obj map[string]interface{}) error {
+		for _, clientConfig := range webhookClientConfigs(o.GroupVersionKind(), obj) {
+			name, _, _ := unstructured.NestedString(clientConfig, "service", "name")
+			ns, _, _ := unstructured.NestedString(clientConfig, "service", "namespace")
+			if name == service && (ns == "" || ns == namespace) {
+				clientConfig["caBundle"] = caBundle
+			}
+		}
+		return nil
+	})
+}
+
+// webhookClientConfigs returns the clientConfigs of the webhooks of obj, to be modified in place
+func webhookClientConfigs(gvk schema.GroupVersionKind, obj map[string]interface{}) []map[string]interface{} {
+	var clientConfigs []map[string]interface{}
+	switch gvk.GroupKind().String() {
+	case "ValidatingWebhookConfiguration.admissionregistration.k8s.io", "MutatingWebhookConfiguration.admissionregistration.k8s.io":
+		webhooks, _ := obj["webhooks"].([]interface{})
+		for _, webhook := range webhooks {
+			if clientConfig, ok := nestedMapNoCopy(webhook, "clientConfig"); ok {
+				clientConfigs = append(clientConfigs, clientConfig)
+			}
+		}
+	case "CustomResourceDefinition.apiextensions.k8s.io":
+		path := []string{"spec", "conversion", "webhook", "clientConfig"}
+		if gvk.Version == "v1beta1" {
+			path = []string{"spec", "conversion", "webhookClientConfig"}
+		}
+		if clientConfig, ok := nestedMapNoCopy(obj, path...); ok {
+			clientConfigs = append(clientConfigs, clientConfig)
+		}
+	}
+	return clientConfigs
+}
+
+// nestedMapNoCopy returns the map at the path of fields in obj, without copying it
+func nestedMapNoCopy(obj interface{}, fields ...string) (map[string]interface{}, bool) {
+	m, ok := obj.(map[string]interface{})
+	for _, field := range fields {
+		if !ok {
+			return nil, false
+		}
+		m, ok = m[field].(map[string]interface{})
+	}
+	return m, ok
+}
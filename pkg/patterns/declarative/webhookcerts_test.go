@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+func TestInjectWebhookCertificate(t *testing.T) {
+	input := `---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: webhook
+webhooks:
+- name: a
+  clientConfig:
+    service:
+      name: webhook-service
+      namespace: system
+- name: b
+  clientConfig:
+    service:
+      name: other-service
+      namespace: system
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.org
+spec:
+  conversion:
+    strategy: Webhook
+    webhook:
+      clientConfig:
+        service:
+          name: webhook-service
+          namespace: system
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: webhook-cert
+  namespace: system
+`
+	ctx := context.Background()
+	secrets := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	instance := newGuestbook("default", "test", time.Now())
+	// The Secret is read from the cluster it is applied to, not with the client of the operator
+	r := &Reconciler{client: fake.NewClientBuilder().Build(), dynamicClient: secrets}
+	r.options = WithWebhookCertificate(WebhookCertificate{ServiceName: "webhook-service", SecretName: "webhook-cert", Namespace: "system"})(r.options)
+
+	// inject injects the certificate into the manifest, and stores the Secret as if it were applied
+	inject := func() (map[string][]byte, *manifest.Objects, time.Time) {
+		t.Helper()
+		objects, err := manifest.ParseObjects(ctx, input)
+		if err != nil {
+			t.Fatalf("error parsing manifest: %v", err)
+		}
+		renewAt, err := r.injectWebhookCertificate(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, instance, objects)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(objects.Items) != 3 {
+			t.Fatalf("expected the Secret to replace the placeholder, got %d objects", len(objects.Items))
+		}
+		u := objects.Items[2].UnstructuredObject()
+		if u.GetKind() != "Secret" || u.Object["type"] != "kubernetes.io/tls" {
+			t.Fatalf("unexpected Secret %v", u)
+		}
+		encoded, _, _ := unstructured.NestedStringMap(u.Object, "data")
+		data := make(map[string][]byte)
+		for k, v := range encoded {
+			if data[k], err = base64.StdEncoding.DecodeString(v); err != nil {
+				t.Fatalf("error decoding %s: %v", k, err)
+			}
+		}
+
+		resource := secrets.Resource(secretsResource).Namespace("system")
+		if _, err := resource.Get(ctx, "webhook-cert", metav1.GetOptions{}); err == nil {
+			_, err = resource.Update(ctx, u, metav1.UpdateOptions{})
+		} else {
+			_, err = resource.Create(ctx, u, metav1.CreateOptions{})
+		}
+		if err != nil {
+			t.Fatalf("error storing Secret: %v", err)
+		}
+		return data, objects, renewAt
+	}
+
+	data, objects, renewAt := inject()
+	if expected := time.Now().Add(defaultWebhookCertificateValidity * 2 / 3); renewAt.Before(expected.Add(-time.Minute)) || renewAt.After(expected) {
+		t.Errorf("expected renewal at %v, got %v", expected, renewAt)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(data[corev1.ServiceAccountRootCAKey])
+	if _, err := parseCertificates(data[corev1.TLSCertKey])[0].Verify(x509.VerifyOptions{DNSName: "webhook-service.system.svc", Roots: roots}); err != nil {
+		t.Errorf("expected a serving certificate for the Service: %v", err)
+	}
+
+	caBundle := base64.StdEncoding.EncodeToString(data[corev1.ServiceAccountRootCAKey])
+	webhooks, _, _ := unstructured.NestedSlice(objects.Items[0].UnstructuredObject().Object, "webhooks")
+	if v, _, _ := unstructured.NestedString(webhooks[0].(map[string]interface{}), "clientConfig", "caBundle"); v != caBundle {
+		t.Errorf("expected the caBundle of the webhook of the Service to be set, got %q", v)
+	}
+	if _, found, _ := unstructured.NestedString(webhooks[1].(map[string]interface{}), "clientConfig", "caBundle"); found {
+		t.Errorf("expected the caBundle of the webhook of another Service not to be set")
+	}
+	if v, _, _ := unstructured.NestedString(objects.Items[1].UnstructuredObject().Object, "spec", "conversion", "webhook", "clientConfig", "caBundle"); v != caBundle {
+		t.Errorf("expected the caBundle of the conversion webhook to be set, got %q", v)
+	}
+
+	// The certificate is kept across reconciles
+	if reused, _, _ := inject(); !bytes.Equal(reused[corev1.TLSCertKey], data[corev1.TLSCertKey]) {
+		t.Errorf("expected the certificate to be reused")
+	}
+
+	// A certificate due for renewal is replaced, keeping its CA until the webhook server loads the new one
+	r.options.webhookCertificate.RenewBefore = 2 * defaultWebhookCertificateValidity
+	renewed, _, _ := inject()
+	if bytes.Equal(renewed[corev1.TLSCertKey], data[corev1.TLSCertKey]) {
+		t.Errorf("expected the certificate to be renewed")
+	}
+	if !bytes.HasSuffix(renewed[corev1.ServiceAccountRootCAKey], data[corev1.ServiceAccountRootCAKey]) || len(parseCertificates(renewed[corev1.ServiceAccountRootCAKey])) != 2 {
+		t.Errorf("expected the new and previous CAs in ca.crt, got %s", renewed[corev1.ServiceAccountRootCAKey])
+	}
+}
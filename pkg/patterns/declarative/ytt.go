@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package declarative
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/ytt"
+)
+
+// YttValues returns the data values used to render ytt templates for a DeclarativeObject
+type YttValues = func(context.Context, DeclarativeObject) (map[string]interface{}, error)
+
+type yttRenderer interface {
+	Render(ctx context.Context, files map[string]string, values map[string]interface{}) (string, error)
+}
+
+// For mocking
+var yttExec yttRenderer = ytt.NewExec()
+
+// SpecAsYttValues is a YttValues that uses the spec of the DeclarativeObject as the data values
+func SpecAsYttValues(ctx context.Context, o DeclarativeObject) (map[string]interface{}, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+	if err != nil {
+		return nil, fmt.Errorf("error converting object to unstructured: %v", err)
+	}
+	spec, _, err := unstructured.NestedMap(u, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("error reading spec: %v", err)
+	}
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	return spec, nil
+}
+
+var _ YttValues = SpecAsYttValues
+
+// renderYtt renders all the manifest files together with ytt, returning a single manifest
+func (r *Reconciler) renderYtt(ctx context.Context, instance DeclarativeObject, manifestFiles map[string]string) (map[string]string, error) {
+	if len(manifestFiles) == 0 {
+		return manifestFiles, nil
+	}
+
+	values, err := r.options.yttValues(ctx, instance)
+	if err != nil {
+		return nil, fmt.Errorf("error building ytt data values: %v", err)
+	}
+
+	rendered, err := yttExec.Render(ctx, manifestFiles, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for p := range manifestFiles {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	// Keep the output in the same directory, so kustomize can still find it
+	p := filepath.Join(filepath.Dir(paths[0]), "ytt.yaml")
+	return map[string]string{p: rendered}, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golden
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+// UpdateFlag is the name of the flag rewriting the golden files, eg go test ./... -update.  This package doesn't
+// register it, so as not to clash with the flags of the tests using it; define it in the test package with
+// flag.Bool(golden.UpdateFlag, false, "update the golden files"), and it is looked up when comparing.
+const UpdateFlag = "update"
+
+// updating returns true if golden files should be rewritten rather than compared: if update is set, if the test
+// binary defines the UpdateFlag and it is set, or if HACK_AUTOFIX_EXPECTED_OUTPUT is set
+func updating(update bool) bool {
+	if update || os.Getenv("HACK_AUTOFIX_EXPECTED_OUTPUT") != "" {
+		return true
+	}
+	f := flag.Lookup(UpdateFlag)
+	if f == nil {
+		return false
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	set, _ := getter.Get().(bool)
+	return set
+}
+
+// Render returns the YAML of the manifest r builds for cr, with all manifest operations and object transforms
+// applied.  The objects are sorted by group, kind, namespace and name, so that golden files don't change when the
+// order of the manifest does.
+func Render(ctx context.Context, r *declarative.Reconciler, cr declarative.DeclarativeObject) (string, error) {
+	var fs filesys.FileSystem
+	if r.IsKustomizeOptionUsed() {
+		fs = filesys.MakeFsInMemory()
+	}
+	name := types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()}
+	objects, err := r.BuildDeploymentObjectsWithFs(ctx, name, cr, fs)
+	if err != nil {
+		return "", fmt.Errorf("error building deployment objects: %v", err)
+	}
+	sortObjects(objects)
+	return objects.YAMLManifest()
+}
+
+// sortObjects sorts objects by group, kind, namespace and name
+func sortObjects(objects *manifest.Objects) {
+	objects.Sort(func(*manifest.Object) int { return 0 })
+}
+
+// CompareFile compares actual to the golden file at path, failing t with a diff if they differ.  With the -update
+// flag (see UpdateFlag), or HACK_AUTOFIX_EXPECTED_OUTPUT set, the golden file is written instead.
+func CompareFile(t *testing.T, path string, actual string) {
+	t.Helper()
+	compareFile(t, path, actual, false)
+}
+
+// compareFile is CompareFile, writing the golden file if update is set
+func compareFile(t *testing.T, path string, actual string, update bool) {
+	t.Helper()
+
+	if updating(update) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating directory for %s: %v", path, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatalf("error writing expected output to %s: %v", path, err)
+		}
+		t.Logf("updated golden file %s", path)
+		return
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("error reading file %s: %v", path, err)
+		t.Logf("To generate the golden file, rerun this test with -update")
+		return
+	}
+	expected := string(b)
+	if actual == expected {
+		return
+	}
+
+	if err := diffFiles(t, path, actual); err != nil {
+		t.Logf("failed to run system diff, falling back to string diff: %v", err)
+		t.Logf("diff: %s", diff.StringDiff(actual, expected))
+	}
+
+	t.Errorf("unexpected diff between actual and expected YAML. See previous output for details.")
+	t.Logf("To regenerate the output based on this result, rerun this test with -update")
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golden
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientScheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/test/mocks"
+)
+
+type staticManifest string
+
+func (m staticManifest) ResolveManifest(ctx context.Context, object runtime.Object) (map[string]string, error) {
+	return map[string]string{"manifest.yaml": string(m)}, nil
+}
+
+func TestRender(t *testing.T) {
+	ctx := context.Background()
+	mgr := mocks.NewManager(mocks.NewClient(clientScheme.Scheme))
+	mgr.Scheme = clientScheme.Scheme
+
+	cr := &unstructured.Unstructured{}
+	cr.SetAPIVersion("addons.example.org/v1alpha1")
+	cr.SetKind("Guestbook")
+	cr.SetNamespace("default")
+	cr.SetName("test")
+
+	r := &declarative.Reconciler{}
+	err := r.Init(mgr, cr, declarative.WithManifestController(staticManifest(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  b: "2"
+  a: "1"
+`)))
+	if err != nil {
+		t.Fatalf("error creating reconciler: %v", err)
+	}
+
+	actual, err := Render(ctx, r, cr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `apiVersion: v1
+data:
+  a: "1"
+  b: "2"
+kind: ConfigMap
+metadata:
+  name: settings
+
+---
+
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+
+---
+
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+`
+	if actual != expected {
+		t.Errorf("unexpected manifest:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	// With -update, the golden file is written, and compared afterwards
+	goldenPath := filepath.Join(t.TempDir(), "testdata", "guestbook.out.yaml")
+	compareFile(t, goldenPath, actual, true)
+	b, err := ioutil.ReadFile(goldenPath)
+	if err != nil || string(b) != actual {
+		t.Errorf("expected golden file to be written, got %q, %v", string(b), err)
+	}
+	CompareFile(t, goldenPath, actual)
+}
+
+func TestUpdateFlag(t *testing.T) {
+	if updating(false) {
+		t.Fatalf("expected golden files to be compared without the flag")
+	}
+
+	// The flag is defined by the test package using golden, if at all
+	flags := flag.CommandLine
+	defer func() { flag.CommandLine = flags }()
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	flag.Bool(UpdateFlag, false, "update the golden files")
+	if updating(false) {
+		t.Errorf("expected golden files to be compared with the flag unset")
+	}
+	if err := flag.Set(UpdateFlag, "true"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !updating(false) {
+		t.Errorf("expected golden files to be updated with the flag set")
+	}
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package golden
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -31,7 +30,6 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/diff"
 	clientScheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/scheme"
 	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon"
@@ -42,8 +40,9 @@ import (
 	"sigs.k8s.io/kustomize/api/filesys"
 )
 
-func NewValidator(t *testing.T, b *scheme.Builder) *validator {
-	v := &validator{T: t, scheme: runtime.NewScheme()}
+// NewValidator returns a Validator decoding objects with the types of b
+func NewValidator(t *testing.T, b *scheme.Builder) *Validator {
+	v := &Validator{T: t, scheme: runtime.NewScheme()}
 	if err := b.AddToScheme(v.scheme); err != nil {
 		t.Fatalf("error from AddToScheme: %v", err)
 	}
@@ -57,15 +56,18 @@ func NewValidator(t *testing.T, b *scheme.Builder) *validator {
 	return v
 }
 
-type validator struct {
+// Validator checks the manifests rendered by a reconciler for the objects of a tests directory against golden files
+type Validator struct {
 	T       *testing.T
 	scheme  *runtime.Scheme
 	TestDir string
-	mgr     mocks.Manager
+	// Update rewrites the golden files rather than comparing them, as with the -update flag (see UpdateFlag)
+	Update bool
+	mgr    mocks.Manager
 }
 
 // findChannelsPath will search for a channels directory, which is helpful when running under bazel
-func (v *validator) findChannelsPath() {
+func (v *Validator) findChannelsPath() {
 	t := v.T
 	// Remove this call from the test error stack frame, it is useless for
 	// figuring out what test failed.
@@ -128,19 +130,16 @@ func (v *validator) findChannelsPath() {
 	t.Logf("flagChannel = %s", loaders.FlagChannel)
 }
 
-func (v *validator) Manager() *mocks.Manager {
+func (v *Validator) Manager() *mocks.Manager {
 	return &v.mgr
 }
 
-func (v *validator) Validate(r declarative.Reconciler) {
+// Validate renders the manifest for each <name>.in.yaml object of the tests directory, and compares it to the golden
+// file <name>.out.yaml.  The objects are rendered in the order of the manifest.
+func (v *Validator) Validate(r declarative.Reconciler) {
 	t := v.T
 	t.Helper()
 
-	serializer := json.NewSerializerWithOptions(json.DefaultMetaFactory, v.scheme, v.scheme, json.SerializerOptions{Yaml: false, Pretty: false, Strict: false})
-	yamlizer := json.NewSerializerWithOptions(json.DefaultMetaFactory, v.scheme, v.scheme, json.SerializerOptions{Yaml: true, Pretty: false, Strict: false})
-
-	metadataAccessor := meta.NewAccessor()
-
 	basedir := "tests"
 	if v.TestDir != "" {
 		basedir = v.TestDir
@@ -151,8 +150,6 @@ func (v *validator) Validate(r declarative.Reconciler) {
 		t.Fatalf("error reading dir %s: %v", basedir, err)
 	}
 
-	ctx := context.TODO()
-
 	for _, f := range files {
 		p := filepath.Join(basedir, f.Name())
 		t.Logf("Filepath: %s", p)
@@ -175,105 +172,88 @@ func (v *validator) Validate(r declarative.Reconciler) {
 			continue
 		}
 
-		b, err := ioutil.ReadFile(p)
+		actualYAML, err := v.renderFile(&r, p, false)
 		if err != nil {
-			t.Errorf("error reading file %s: %v", p, err)
+			t.Errorf("%v", err)
 			continue
 		}
 
-		objs, err := manifest.ParseObjects(ctx, string(b))
-		if err != nil {
-			t.Errorf("error parsing file %s: %v", p, err)
-			continue
-		}
+		expectedPath := strings.Replace(p, ".in.yaml", ".out.yaml", -1)
+		compareFile(t, expectedPath, actualYAML, v.Update)
+	}
+}
 
-		if len(objs.Items) != 1 {
-			t.Errorf("expected exactly one item in %s", p)
-			continue
-		}
+// RenderFile returns the manifest rendered by r for the object in the YAML file at path, with the objects in a
+// normalized order, as by Render
+func (v *Validator) RenderFile(r *declarative.Reconciler, path string) (string, error) {
+	return v.renderFile(r, path, true)
+}
 
-		crJSON, err := objs.Items[0].JSON()
-		if err != nil {
-			t.Errorf("error converting CR to json in %s: %v", p, err)
-			continue
-		}
+// ValidateFile renders the manifest for the object in the YAML file at path with RenderFile, and compares it to
+// the golden file at goldenPath
+func (v *Validator) ValidateFile(r *declarative.Reconciler, path string, goldenPath string) {
+	v.T.Helper()
 
-		cr, _, err := serializer.Decode(crJSON, nil, nil)
-		if err != nil {
-			t.Errorf("error parsing CR in %s: %v", p, err)
-			continue
-		}
+	actual, err := v.RenderFile(r, path)
+	if err != nil {
+		v.T.Fatalf("%v", err)
+	}
+	compareFile(v.T, goldenPath, actual, v.Update)
+}
 
-		namespace, err := metadataAccessor.Namespace(cr)
-		if err != nil {
-			t.Errorf("error getting namespace in %s: %v", p, err)
-			continue
-		}
+func (v *Validator) renderFile(r *declarative.Reconciler, p string, sorted bool) (string, error) {
+	ctx := context.TODO()
+	serializer := json.NewSerializerWithOptions(json.DefaultMetaFactory, v.scheme, v.scheme, json.SerializerOptions{Yaml: false, Pretty: false, Strict: false})
+	metadataAccessor := meta.NewAccessor()
 
-		name, err := metadataAccessor.Name(cr)
-		if err != nil {
-			t.Errorf("error getting name in %s: %v", p, err)
-			continue
-		}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", fmt.Errorf("error reading file %s: %v", p, err)
+	}
 
-		nsn := types.NamespacedName{Namespace: namespace, Name: name}
+	objs, err := manifest.ParseObjects(ctx, string(b))
+	if err != nil {
+		return "", fmt.Errorf("error parsing file %s: %v", p, err)
+	}
 
-		var fs filesys.FileSystem
-		if r.IsKustomizeOptionUsed() {
-			fs = filesys.MakeFsInMemory()
-		}
-		objects, err := r.BuildDeploymentObjectsWithFs(ctx, nsn, cr.(declarative.DeclarativeObject), fs)
-		if err != nil {
-			t.Errorf("error building deployment objects: %v", err)
-			continue
-		}
+	if len(objs.Items) != 1 {
+		return "", fmt.Errorf("expected exactly one item in %s", p)
+	}
 
-		var actualYAML string
-		{
-			var b bytes.Buffer
-
-			for i, o := range objects.Items {
-				if i != 0 {
-					b.WriteString("\n---\n\n")
-				}
-				u := o.UnstructuredObject()
-				if err := yamlizer.Encode(u, &b); err != nil {
-					t.Fatalf("error encoding to yaml: %v", err)
-				}
-			}
-			actualYAML = b.String()
-		}
+	crJSON, err := objs.Items[0].JSON()
+	if err != nil {
+		return "", fmt.Errorf("error converting CR to json in %s: %v", p, err)
+	}
 
-		expectedPath := strings.Replace(p, ".in.yaml", ".out.yaml", -1)
-		var expectedYAML string
-		{
-			b, err := ioutil.ReadFile(expectedPath)
-			if err != nil {
-				t.Errorf("error reading file %s: %v", expectedPath, err)
-				continue
-			}
-			expectedYAML = string(b)
-		}
+	cr, _, err := serializer.Decode(crJSON, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("error parsing CR in %s: %v", p, err)
+	}
 
-		if actualYAML != expectedYAML {
-			if os.Getenv("HACK_AUTOFIX_EXPECTED_OUTPUT") != "" {
-				t.Logf("HACK_AUTOFIX_EXPECTED_OUTPUT is set; replacing expected output in %s", expectedPath)
-				if err := ioutil.WriteFile(expectedPath, []byte(actualYAML), 0644); err != nil {
-					t.Fatalf("error writing expected output to %s: %v", expectedPath, err)
-				}
-				continue
-			}
+	namespace, err := metadataAccessor.Namespace(cr)
+	if err != nil {
+		return "", fmt.Errorf("error getting namespace in %s: %v", p, err)
+	}
 
-			if err := diffFiles(t, expectedPath, actualYAML); err != nil {
-				t.Logf("failed to run system diff, falling back to string diff: %v", err)
-				t.Logf("diff: %s", diff.StringDiff(actualYAML, expectedYAML))
-			}
+	name, err := metadataAccessor.Name(cr)
+	if err != nil {
+		return "", fmt.Errorf("error getting name in %s: %v", p, err)
+	}
 
-			t.Errorf("unexpected diff between actual and expected YAML. See previous output for details.")
-			t.Logf(`To regenerate the output based on this result, rerun this test with HACK_AUTOFIX_EXPECTED_OUTPUT="true"`)
-		}
+	nsn := types.NamespacedName{Namespace: namespace, Name: name}
 
+	var fs filesys.FileSystem
+	if r.IsKustomizeOptionUsed() {
+		fs = filesys.MakeFsInMemory()
+	}
+	objects, err := r.BuildDeploymentObjectsWithFs(ctx, nsn, cr.(declarative.DeclarativeObject), fs)
+	if err != nil {
+		return "", fmt.Errorf("error building deployment objects: %v", err)
+	}
+	if sorted {
+		sortObjects(objects)
 	}
+	return objects.YAMLManifest()
 }
 
 func diffFiles(t *testing.T, expectedPath, actual string) error {
@@ -0,0 +1,305 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package harness
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// DefaultTimeout is how long the assertions of a Harness wait, unless Options.Timeout is set
+var DefaultTimeout = 30 * time.Second
+
+// pollInterval is how often the assertions of a Harness check the cluster
+var pollInterval = 250 * time.Millisecond
+
+// Options configures a Harness
+type Options struct {
+	// CRDDirectoryPaths are the directories or files of the CRDs of the operator, installed before it starts
+	CRDDirectoryPaths []string
+	// Scheme has the types of the operator, the client-go scheme if nil
+	Scheme *runtime.Scheme
+	// Timeout is how long assertions wait, DefaultTimeout if 0
+	Timeout time.Duration
+}
+
+// Harness is a local control plane started with envtest, with a manager to run the reconcilers of an operator.
+// The control plane needs the envtest binaries, in KUBEBUILDER_ASSETS or /usr/local/kubebuilder/bin.
+type Harness struct {
+	T       *testing.T
+	Config  *rest.Config
+	Client  client.Client
+	Manager manager.Manager
+
+	env     *envtest.Environment
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+// defaultAssetsPath is where envtest looks for its binaries if KUBEBUILDER_ASSETS isn't set
+const defaultAssetsPath = "/usr/local/kubebuilder/bin"
+
+// SkipIfUnavailable skips the test if the envtest binaries aren't installed, so tests using a Harness don't fail
+// where they can't run
+func SkipIfUnavailable(t *testing.T) {
+	t.Helper()
+	if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+		return
+	}
+	dir := os.Getenv("KUBEBUILDER_ASSETS")
+	if dir == "" {
+		dir = defaultAssetsPath
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Skipf("envtest binaries not found in %s, set KUBEBUILDER_ASSETS to run this test", dir)
+	}
+}
+
+// New starts a control plane, installs the CRDs and creates a manager.  Add the reconcilers of the operator to
+// Manager, then call Start.  Everything is stopped when the test ends.
+func New(t *testing.T, options Options) *Harness {
+	t.Helper()
+
+	scheme := options.Scheme
+	if scheme == nil {
+		scheme = clientgoscheme.Scheme
+	}
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     options.CRDDirectoryPaths,
+		ErrorIfCRDPathMissing: true,
+	}
+	config, err := env.Start()
+	if err != nil {
+		t.Fatalf("error starting control plane: %v", err)
+	}
+	h := &Harness{T: t, Config: config, env: env, timeout: timeout}
+	t.Cleanup(h.stop)
+
+	h.Manager, err = manager.New(config, manager.Options{Scheme: scheme, MetricsBindAddress: "0"})
+	if err != nil {
+		t.Fatalf("error creating manager: %v", err)
+	}
+	// The client reads from the API server rather than the cache of the manager, so assertions see every change
+	h.Client, err = client.New(config, client.Options{Scheme: scheme, Mapper: h.Manager.GetRESTMapper()})
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	return h
+}
+
+// Start runs the manager, and with it the reconcilers added to it, until the test ends
+func (h *Harness) Start() {
+	h.T.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go func() {
+		if err := h.Manager.Start(ctx); err != nil {
+			h.T.Errorf("error running manager: %v", err)
+		}
+	}()
+}
+
+func (h *Harness) stop() {
+	if h.cancel != nil {
+		h.cancel()
+	}
+	if err := h.env.Stop(); err != nil {
+		h.T.Errorf("error stopping control plane: %v", err)
+	}
+}
+
+// Create creates objects, failing the test on error
+func (h *Harness) Create(objects ...client.Object) {
+	h.T.Helper()
+	for _, o := range objects {
+		if err := h.Client.Create(context.Background(), o); err != nil {
+			h.T.Fatalf("error creating %s %s: %v", o.GetObjectKind().GroupVersionKind().Kind, o.GetName(), err)
+		}
+	}
+}
+
+// eventually polls condition until it returns true or the timeout expires, failing the test with the last message
+// returned by condition
+func (h *Harness) eventually(condition func() (bool, string, error)) {
+	h.T.Helper()
+
+	var message string
+	err := wait.PollImmediate(pollInterval, h.timeout, func() (bool, error) {
+		ok, m, err := condition()
+		message = m
+		return ok, err
+	})
+	if err != nil {
+		if err == wait.ErrWaitTimeout {
+			h.T.Fatalf("timed out after %v: %s", h.timeout, message)
+		}
+		h.T.Fatalf("%v", err)
+	}
+}
+
+// get returns the object of kind gvk named name, or nil if it doesn't exist
+func (h *Harness) get(gvk schema.GroupVersionKind, name types.NamespacedName) (*unstructured.Unstructured, error) {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	if err := h.Client.Get(context.Background(), name, u); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting %s %s: %v", gvk.Kind, name, err)
+	}
+	return u, nil
+}
+
+// WaitForObject waits for the object of kind gvk named name to exist, and returns it
+func (h *Harness) WaitForObject(gvk schema.GroupVersionKind, name types.NamespacedName) *unstructured.Unstructured {
+	h.T.Helper()
+
+	var found *unstructured.Unstructured
+	h.eventually(func() (bool, string, error) {
+		u, err := h.get(gvk, name)
+		found = u
+		return u != nil, fmt.Sprintf("%s %s does not exist", gvk.Kind, name), err
+	})
+	return found
+}
+
+// WaitForDeletion waits for the object of kind gvk named name not to exist, eg once pruned
+func (h *Harness) WaitForDeletion(gvk schema.GroupVersionKind, name types.NamespacedName) {
+	h.T.Helper()
+
+	h.eventually(func() (bool, string, error) {
+		u, err := h.get(gvk, name)
+		return u == nil, fmt.Sprintf("%s %s still exists", gvk.Kind, name), err
+	})
+}
+
+// ExpectOwnedBy waits for the object of kind gvk named name to exist with an owner reference to owner
+func (h *Harness) ExpectOwnedBy(gvk schema.GroupVersionKind, name types.NamespacedName, owner client.Object) {
+	h.T.Helper()
+
+	h.eventually(func() (bool, string, error) {
+		u, err := h.get(gvk, name)
+		if err != nil || u == nil {
+			return false, fmt.Sprintf("%s %s does not exist", gvk.Kind, name), err
+		}
+		if !IsOwnedBy(u, owner) {
+			return false, fmt.Sprintf("%s %s is not owned by %s, owners are %v", gvk.Kind, name, owner.GetName(), u.GetOwnerReferences()), nil
+		}
+		return true, "", nil
+	})
+}
+
+// ExpectCondition waits for the condition conditionType of object to have status, reading object again from the
+// cluster until it does
+func (h *Harness) ExpectCondition(object client.Object, conditionType string, status metav1.ConditionStatus) {
+	h.T.Helper()
+
+	gvk, err := h.gvkFor(object)
+	if err != nil {
+		h.T.Fatalf("%v", err)
+	}
+	name := types.NamespacedName{Namespace: object.GetNamespace(), Name: object.GetName()}
+	h.eventually(func() (bool, string, error) {
+		u, err := h.get(gvk, name)
+		if err != nil || u == nil {
+			return false, fmt.Sprintf("%s %s does not exist", gvk.Kind, name), err
+		}
+		condition, err := FindCondition(u, conditionType)
+		if err != nil {
+			return false, "", err
+		}
+		if condition == nil {
+			return false, fmt.Sprintf("%s %s has no %s condition", gvk.Kind, name, conditionType), nil
+		}
+		if condition.Status != status {
+			return false, fmt.Sprintf("%s condition of %s %s is %s, not %s: %s: %s", conditionType, gvk.Kind, name, condition.Status, status, condition.Reason, condition.Message), nil
+		}
+		return true, "", nil
+	})
+}
+
+// ExpectReady waits for the Ready condition of object to be true
+func (h *Harness) ExpectReady(object client.Object) {
+	h.T.Helper()
+	h.ExpectCondition(object, "Ready", metav1.ConditionTrue)
+}
+
+func (h *Harness) gvkFor(object client.Object) (schema.GroupVersionKind, error) {
+	gvk := object.GetObjectKind().GroupVersionKind()
+	if !gvk.Empty() {
+		return gvk, nil
+	}
+	gvks, _, err := h.Manager.GetScheme().ObjectKinds(object)
+	if err != nil || len(gvks) == 0 {
+		return schema.GroupVersionKind{}, fmt.Errorf("error getting kind of %T: %v", object, err)
+	}
+	return gvks[0], nil
+}
+
+// IsOwnedBy returns true if object has an owner reference to owner
+func IsOwnedBy(object metav1.Object, owner metav1.Object) bool {
+	for _, ref := range object.GetOwnerReferences() {
+		if ref.UID == owner.GetUID() && ref.Name == owner.GetName() {
+			return true
+		}
+	}
+	return false
+}
+
+// FindCondition returns the condition conditionType in status.conditions of u, or nil if it has none
+func FindCondition(u *unstructured.Unstructured, conditionType string) (*metav1.Condition, error) {
+	items, _, err := unstructured.NestedSlice(u.Object, "status", "conditions")
+	if err != nil {
+		return nil, fmt.Errorf("error reading status.conditions: %v", err)
+	}
+	var conditions []metav1.Condition
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var condition metav1.Condition
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &condition); err != nil {
+			return nil, fmt.Errorf("error reading condition: %v", err)
+		}
+		conditions = append(conditions, condition)
+	}
+	return meta.FindStatusCondition(conditions, conditionType), nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package harness
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestIsOwnedBy(t *testing.T) {
+	owner := &unstructured.Unstructured{}
+	owner.SetName("guestbook")
+	owner.SetUID(types.UID("1234"))
+
+	object := &unstructured.Unstructured{}
+	if IsOwnedBy(object, owner) {
+		t.Errorf("unexpected owner of object without owner references")
+	}
+	object.SetOwnerReferences([]metav1.OwnerReference{{Name: "guestbook", UID: types.UID("5678")}})
+	if IsOwnedBy(object, owner) {
+		t.Errorf("unexpected owner with another UID")
+	}
+	object.SetOwnerReferences([]metav1.OwnerReference{{Name: "guestbook", UID: types.UID("1234")}})
+	if !IsOwnedBy(object, owner) {
+		t.Errorf("expected object to be owned")
+	}
+}
+
+func TestFindCondition(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if condition, err := FindCondition(u, "Ready"); err != nil || condition != nil {
+		t.Errorf("unexpected condition %v, %v", condition, err)
+	}
+
+	if err := unstructured.SetNestedSlice(u.Object, []interface{}{
+		map[string]interface{}{"type": "Reconciling", "status": "False", "reason": "Done"},
+		map[string]interface{}{"type": "Ready", "status": "True", "reason": "Ready", "message": "All objects are ready"},
+	}, "status", "conditions"); err != nil {
+		t.Fatalf("error setting conditions: %v", err)
+	}
+	condition, err := FindCondition(u, "Ready")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Message != "All objects are ready" {
+		t.Errorf("unexpected condition %v", condition)
+	}
+}
+
+func TestHarness(t *testing.T) {
+	SkipIfUnavailable(t)
+
+	h := New(t, Options{})
+	h.Start()
+
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "owner"}}
+	h.Create(owner)
+	owned := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "owned",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: owner.Name, UID: owner.UID}},
+	}}
+	h.Create(owned)
+
+	gvk := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	h.WaitForObject(gvk, types.NamespacedName{Namespace: "default", Name: "owned"})
+	h.ExpectOwnedBy(gvk, types.NamespacedName{Namespace: "default", Name: "owned"}, owner)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"context"
+	"sync"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/applier"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// ApplyCall records a call of FakeApplier.Apply
+type ApplyCall struct {
+	Namespace string
+	Manifest  string
+	Validate  bool
+	Args      []string
+}
+
+// Objects parses the manifest applied by the call
+func (c ApplyCall) Objects(ctx context.Context) (*manifest.Objects, error) {
+	return manifest.ParseObjects(ctx, c.Manifest)
+}
+
+// FakeApplier is an applier.Applier for unit tests, passed to the reconciler with declarative.WithApplier.  It
+// records each call, and returns the errors queued with FailNext, or the result of Delegate.
+type FakeApplier struct {
+	// Delegate is called for each call that doesn't fail, if set, eg to apply with a real applier while recording
+	Delegate applier.Applier
+
+	mutex  sync.Mutex
+	calls  []ApplyCall
+	errors []error
+}
+
+var _ applier.Applier = &FakeApplier{}
+
+// NewFakeApplier returns a FakeApplier that succeeds without applying anything
+func NewFakeApplier() *FakeApplier {
+	return &FakeApplier{}
+}
+
+// Apply records the call, and returns the next queued error
+func (a *FakeApplier) Apply(ctx context.Context, namespace string, manifest string, validate bool, args ...string) error {
+	a.mutex.Lock()
+	a.calls = append(a.calls, ApplyCall{
+		Namespace: namespace,
+		Manifest:  manifest,
+		Validate:  validate,
+		Args:      append([]string(nil), args...),
+	})
+	var err error
+	if len(a.errors) != 0 {
+		err, a.errors = a.errors[0], a.errors[1:]
+	}
+	a.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if a.Delegate != nil {
+		return a.Delegate.Apply(ctx, namespace, manifest, validate, args...)
+	}
+	return nil
+}
+
+// FailNext queues errs to be returned by the next calls, one per call.  A nil error lets its call succeed.
+func (a *FakeApplier) FailNext(errs ...error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.errors = append(a.errors, errs...)
+}
+
+// Calls returns the calls recorded so far
+func (a *FakeApplier) Calls() []ApplyCall {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return append([]ApplyCall(nil), a.calls...)
+}
+
+// LastCall returns the latest call, and false if there were no calls
+func (a *FakeApplier) LastCall() (ApplyCall, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.calls) == 0 {
+		return ApplyCall{}, false
+	}
+	return a.calls[len(a.calls)-1], true
+}
+
+// Reset forgets the recorded calls and queued errors
+func (a *FakeApplier) Reset() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.calls = nil
+	a.errors = nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFakeApplier(t *testing.T) {
+	ctx := context.Background()
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n"
+
+	delegate := NewFakeApplier()
+	a := &FakeApplier{Delegate: delegate}
+	if _, found := a.LastCall(); found {
+		t.Errorf("unexpected call before applying")
+	}
+
+	failure := errors.New("connection refused")
+	a.FailNext(failure, nil)
+	if err := a.Apply(ctx, "default", manifest, true, "--prune"); err != failure {
+		t.Errorf("expected the queued error, got %v", err)
+	}
+	if err := a.Apply(ctx, "default", manifest, false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := a.Apply(ctx, "kube-system", manifest, false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	calls := a.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 calls, got %d", len(calls))
+	}
+	if expected := (ApplyCall{Namespace: "default", Manifest: manifest, Validate: true, Args: []string{"--prune"}}); !reflect.DeepEqual(calls[0], expected) {
+		t.Errorf("unexpected call %+v, expected %+v", calls[0], expected)
+	}
+	if len(delegate.Calls()) != 2 {
+		t.Errorf("expected the calls that didn't fail to be delegated, got %d", len(delegate.Calls()))
+	}
+
+	last, found := a.LastCall()
+	if !found || last.Namespace != "kube-system" {
+		t.Errorf("unexpected last call %+v", last)
+	}
+	objects, err := last.Objects(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objects.Items) != 1 || objects.Items[0].Kind != "ConfigMap" || objects.Items[0].Name != "settings" {
+		t.Errorf("unexpected objects %v", objects.Items)
+	}
+
+	a.Reset()
+	if len(a.Calls()) != 0 {
+		t.Errorf("expected no calls after Reset")
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChannelServer serves a channels directory over HTTP from the test process, so loaders and reconcilers using
+// http(s) channels can be tested without network access.  The latency, authentication and failures of the server
+// can be configured while it runs.
+type ChannelServer struct {
+	*httptest.Server
+
+	dir string
+
+	mutex    sync.Mutex
+	latency  time.Duration
+	token    string
+	failures map[string][]int
+	requests []string
+}
+
+// NewChannelServer starts serving the channels directory dir over HTTP.  Close it when the test ends.
+func NewChannelServer(dir string) *ChannelServer {
+	s := &ChannelServer{dir: dir, failures: make(map[string][]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// NewTLSChannelServer starts serving the channels directory dir over HTTPS.  Requests must be made with the
+// Client of the server, which trusts its certificate.
+func NewTLSChannelServer(dir string) *ChannelServer {
+	s := &ChannelServer{dir: dir, failures: make(map[string][]int)}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetLatency delays every response by latency
+func (s *ChannelServer) SetLatency(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.latency = latency
+}
+
+// RequireToken rejects requests without the header "Authorization: Bearer <token>", or accepts all requests
+// again if token is ""
+func (s *ChannelServer) RequireToken(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.token = token
+}
+
+// FailNext makes the next requests for the file at p, relative to the channels directory (eg "stable" or
+// "packages/guestbook/1.2.3/manifest.yaml"), fail with the status codes, one per request
+func (s *ChannelServer) FailNext(p string, statusCodes ...int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p = path.Clean(strings.TrimPrefix(p, "/"))
+	s.failures[p] = append(s.failures[p], statusCodes...)
+}
+
+// Requests returns the paths requested so far, relative to the channels directory
+func (s *ChannelServer) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *ChannelServer) serve(w http.ResponseWriter, req *http.Request) {
+	p := path.Clean(strings.TrimPrefix(req.URL.Path, "/"))
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, p)
+	latency := s.latency
+	token := s.token
+	status := http.StatusOK
+	if failures := s.failures[p]; len(failures) != 0 {
+		status, s.failures[p] = failures[0], failures[1:]
+	}
+	s.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if token != "" && req.Header.Get("Authorization") != "Bearer "+token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(p)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, req)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mocks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/loaders"
+)
+
+// tokenTransport authenticates requests with a bearer token
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+func TestChannelServer(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"stable":                                 "manifests:\n- version: 1.2.3\n",
+		"packages/guestbook/1.2.3/manifest.yaml": "kind: Deployment\n",
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	server := NewTLSChannelServer(dir)
+	defer server.Close()
+	ctx := context.Background()
+	repo := loaders.NewHTTPRepository(server.URL)
+	repo.Client = server.Client()
+
+	channel, err := repo.LoadChannel(ctx, "stable")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(channel.Manifests) != 1 || channel.Manifests[0].Version != "1.2.3" {
+		t.Errorf("unexpected channel %v", channel)
+	}
+
+	// Failures are injected once per status code
+	server.FailNext("packages/guestbook/1.2.3/manifest.yaml", http.StatusServiceUnavailable)
+	if _, err := repo.LoadManifest(ctx, "guestbook", "1.2.3"); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected a 503 error, got %v", err)
+	}
+	manifest, err := repo.LoadManifest(ctx, "guestbook", "1.2.3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if manifest[server.URL+"/packages/guestbook/1.2.3/manifest.yaml"] != "kind: Deployment\n" {
+		t.Errorf("unexpected manifest %v", manifest)
+	}
+
+	// Requests must be authenticated once a token is required
+	server.RequireToken("secret")
+	if _, err := repo.LoadChannel(ctx, "stable"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected a 401 error, got %v", err)
+	}
+	repo.Client = &http.Client{Transport: &tokenTransport{token: "secret", base: server.Client().Transport}}
+	if _, err := repo.LoadChannel(ctx, "stable"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Slow servers time out with the context
+	server.SetLatency(5 * time.Second)
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := repo.LoadChannel(timeout, "stable"); err == nil {
+		t.Errorf("expected a timeout")
+	}
+	server.SetLatency(0)
+
+	if _, err := repo.LoadChannel(ctx, "beta"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+
+	expected := []string{"stable", "packages/guestbook/1.2.3/manifest.yaml", "packages/guestbook/1.2.3/manifest.yaml", "stable", "stable", "stable", "beta"}
+	if requests := server.Requests(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("unexpected requests %v, expected %v", requests, expected)
+	}
+}
@@ -98,8 +98,8 @@ func (m Manager) GetRESTMapper() meta.RESTMapper {
 	return m.mapper
 }
 
-func (Manager) GetAPIReader() client.Reader {
-	panic("implement me")
+func (m Manager) GetAPIReader() client.Reader {
+	return m.GetClient()
 }
 
 func (m Manager) GetEventRecorderFor(name string) record.EventRecorder {
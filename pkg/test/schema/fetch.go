@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultSchemaURL is the URL of the OpenAPI schema of a Kubernetes release in the Kubernetes repository, formatted
+// with the release tag, eg v1.20.0
+const DefaultSchemaURL = "https://raw.githubusercontent.com/kubernetes/kubernetes/%s/api/openapi-spec/swagger.json"
+
+// Fetcher downloads the OpenAPI schemas of Kubernetes releases, and caches them in the layout read by LoadSchemas,
+// so that only the first test run needs network access.
+type Fetcher struct {
+	// CacheDir holds the downloaded schemas, kubebuilder-declarative-pattern/schemas in the user cache directory
+	// if empty
+	CacheDir string
+
+	// URL is formatted with the release tag to give the URL of its schema, DefaultSchemaURL if empty
+	URL string
+
+	// Client makes the requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// FetchSchemas returns a Validator with the schemas of the Kubernetes releases, eg v1.20.0, downloading them
+// into the user cache directory if they haven't been already
+func FetchSchemas(ctx context.Context, kubernetesVersions ...string) (*Validator, error) {
+	return (&Fetcher{}).Fetch(ctx, kubernetesVersions...)
+}
+
+// Fetch returns a Validator with the schemas of the Kubernetes releases, eg v1.20.0, downloading those not yet
+// in the cache directory
+func (f *Fetcher) Fetch(ctx context.Context, kubernetesVersions ...string) (*Validator, error) {
+	if len(kubernetesVersions) == 0 {
+		return nil, fmt.Errorf("no Kubernetes versions given")
+	}
+	dir := f.CacheDir
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("error finding cache directory: %v", err)
+		}
+		dir = filepath.Join(userCacheDir, "kubebuilder-declarative-pattern", "schemas")
+	}
+
+	v := NewValidator()
+	for _, version := range kubernetesVersions {
+		if version == "" || version == "." || version == ".." || filepath.Base(version) != version {
+			return nil, fmt.Errorf("invalid Kubernetes version %q", version)
+		}
+		p := filepath.Join(dir, version, SchemaFile)
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			b, err = f.download(ctx, version, p)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading schema %s: %v", p, err)
+		}
+		if err := v.AddSchema(version, b); err != nil {
+			return nil, fmt.Errorf("error loading schema %s: %v", p, err)
+		}
+	}
+	return v, nil
+}
+
+// download fetches the schema of version and writes it to p
+func (f *Fetcher) download(ctx context.Context, version string, p string) ([]byte, error) {
+	format := f.URL
+	if format == "" {
+		format = DefaultSchemaURL
+	}
+	url := fmt.Sprintf(format, version)
+	log.FromContext(ctx).WithValues("url", url).Info("downloading schema")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %q: %v", url, err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response for %q: %v", url, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response code %q fetching %q", response.Status, url)
+	}
+
+	// Write to a temporary file first, so a concurrent test never reads a partial schema
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %v", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), SchemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cache file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("error writing cache file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("error writing cache file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return nil, fmt.Errorf("error writing cache file: %v", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFetchSchemas(t *testing.T) {
+	ctx := context.Background()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		// Serve the test schemas by release, eg /v1.20.0/swagger.json
+		version := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")[0]
+		http.ServeFile(w, req, filepath.Join("testdata", "schemas", strings.TrimSuffix(version, ".0"), SchemaFile))
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "schemas")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	fetcher := &Fetcher{CacheDir: cacheDir, URL: server.URL + "/%s/swagger.json", Client: server.Client()}
+	v, err := fetcher.Fetch(ctx, "v1.18.0", "v1.20.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := v.KubernetesVersions(), []string{"v1.18.0", "v1.20.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected versions, got %v want %v", got, want)
+	}
+	if err := v.ValidateManifest(ctx, "v1.18.0", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\nimmutable: true\n"); err == nil {
+		t.Errorf("expected unknown field error validating against v1.18.0")
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 schemas to be downloaded, got %d requests", requests)
+	}
+
+	// The cached schemas are used, and can be read with LoadSchemas
+	if _, err := fetcher.Fetch(ctx, "v1.20.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected cached schema to be used, got %d requests", requests)
+	}
+	if _, err := LoadSchemas(cacheDir); err != nil {
+		t.Errorf("error loading cached schemas: %v", err)
+	}
+
+	// Unknown releases aren't cached
+	if _, err := fetcher.Fetch(ctx, "v1.99.0"); err == nil {
+		t.Errorf("expected error fetching unknown release")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "v1.99.0", SchemaFile)); !os.IsNotExist(err) {
+		t.Errorf("expected unknown release not to be cached, got %v", err)
+	}
+
+	if _, err := fetcher.Fetch(ctx, "../v1.20.0"); err == nil {
+		t.Errorf("expected error for invalid version")
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	openapi_v2 "github.com/googleapis/gnostic/openapiv2"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kube-openapi/pkg/util/proto/validation"
+	"k8s.io/kubectl/pkg/util/openapi"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/addon/pkg/loaders"
+	"sigs.k8s.io/kubebuilder-declarative-pattern/pkg/patterns/declarative/pkg/manifest"
+)
+
+// SchemaFile is the name of the OpenAPI schema of each Kubernetes version in the directory read by LoadSchemas
+const SchemaFile = "swagger.json"
+
+// Validator validates objects against the OpenAPI schemas of one or more Kubernetes versions
+type Validator struct {
+	// IgnoreMissingSchemas skips objects of kinds with no schema, eg custom resources, instead of failing them
+	IgnoreMissingSchemas bool
+
+	schemas map[string]openapi.Resources
+}
+
+// NewValidator returns a Validator with no schemas, see AddSchema
+func NewValidator() *Validator {
+	return &Validator{schemas: make(map[string]openapi.Resources)}
+}
+
+// LoadSchemas returns a Validator with the schemas bundled in dir, which has a directory for each Kubernetes
+// version holding the OpenAPI v2 schema of the version, eg dir/v1.20/swagger.json.  The schema of a cluster is
+// served at /openapi/v2, and the schema of each release is api/openapi-spec/swagger.json in the Kubernetes
+// repository.
+func LoadSchemas(dir string) (*Validator, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s: %v", dir, err)
+	}
+	v := NewValidator()
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		p := filepath.Join(dir, f.Name(), SchemaFile)
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("error reading schema %s: %v", p, err)
+		}
+		if err := v.AddSchema(f.Name(), b); err != nil {
+			return nil, fmt.Errorf("error loading schema %s: %v", p, err)
+		}
+	}
+	if len(v.schemas) == 0 {
+		return nil, fmt.Errorf("no schemas found in %s", dir)
+	}
+	return v, nil
+}
+
+// AddSchema adds the OpenAPI v2 schema of kubernetesVersion, in JSON or YAML
+func (v *Validator) AddSchema(kubernetesVersion string, schema []byte) error {
+	doc, err := openapi_v2.ParseDocument(schema)
+	if err != nil {
+		return fmt.Errorf("error parsing OpenAPI schema of %s: %v", kubernetesVersion, err)
+	}
+	resources, err := openapi.NewOpenAPIData(doc)
+	if err != nil {
+		return fmt.Errorf("error reading OpenAPI schema of %s: %v", kubernetesVersion, err)
+	}
+	v.schemas[kubernetesVersion] = resources
+	return nil
+}
+
+// KubernetesVersions returns the versions of Kubernetes with a schema, sorted
+func (v *Validator) KubernetesVersions() []string {
+	var versions []string
+	for version := range v.schemas {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// Validate validates each of objects against the schema of kubernetesVersion, returning an error listing all
+// the problems found
+func (v *Validator) Validate(kubernetesVersion string, objects *manifest.Objects) error {
+	resources, found := v.schemas[kubernetesVersion]
+	if !found {
+		return fmt.Errorf("no schema for Kubernetes %s, have %s", kubernetesVersion, strings.Join(v.KubernetesVersions(), ", "))
+	}
+
+	var errs []error
+	for _, o := range objects.Items {
+		name := o.Kind + " " + o.Name
+		if o.Namespace != "" {
+			name = o.Kind + " " + o.Namespace + "/" + o.Name
+		}
+		schema := resources.LookupResource(o.GroupVersionKind())
+		if schema == nil {
+			if !v.IgnoreMissingSchemas {
+				errs = append(errs, fmt.Errorf("%s: no schema for %s in Kubernetes %s", name, o.GroupVersionKind(), kubernetesVersion))
+			}
+			continue
+		}
+		for _, err := range validation.ValidateModel(o.UnstructuredObject().Object, schema, o.Kind) {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// ValidateManifest parses manifestStr and validates its objects against the schema of kubernetesVersion
+func (v *Validator) ValidateManifest(ctx context.Context, kubernetesVersion string, manifestStr string) error {
+	objects, err := manifest.ParseObjects(ctx, manifestStr)
+	if err != nil {
+		return fmt.Errorf("error parsing manifest: %v", err)
+	}
+	return v.Validate(kubernetesVersion, objects)
+}
+
+// ValidatePackage validates the YAML manifests of each version of packageName in the channels directory
+// channelsDir, as read by the filesystem loader, against the schema of kubernetesVersion
+func (v *Validator) ValidatePackage(ctx context.Context, kubernetesVersion string, channelsDir string, packageName string) error {
+	dir := filepath.Join(channelsDir, "packages", packageName)
+	versions, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading directory %s: %v", dir, err)
+	}
+
+	repo := loaders.NewFSRepository(channelsDir)
+	var errs []error
+	for _, version := range versions {
+		if !version.IsDir() {
+			continue
+		}
+		files, err := repo.LoadManifest(ctx, packageName, version.Name())
+		if err != nil {
+			return err
+		}
+		for p, manifestStr := range files {
+			if ext := filepath.Ext(p); ext != ".yaml" && ext != ".yml" {
+				continue
+			}
+			if err := v.ValidateManifest(ctx, kubernetesVersion, manifestStr); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", p, err))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
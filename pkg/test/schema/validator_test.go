@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateManifest(t *testing.T) {
+	v, err := LoadSchemas("testdata/schemas")
+	if err != nil {
+		t.Fatalf("error loading schemas: %v", err)
+	}
+	if got, want := v.KubernetesVersions(), []string{"v1.18", "v1.20"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected versions, got %v want %v", got, want)
+	}
+
+	tests := []struct {
+		name      string
+		version   string
+		manifest  string
+		ignore    bool
+		wantError string
+	}{
+		{
+			name:     "valid",
+			version:  "v1.20",
+			manifest: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\ndata:\n  foo: bar\nimmutable: true\n",
+		},
+		{
+			name:      "field unknown in the version",
+			version:   "v1.18",
+			manifest:  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\nimmutable: true\n",
+			wantError: `ConfigMap test: ValidationError(ConfigMap): unknown field "immutable" in io.k8s.api.core.v1.ConfigMap`,
+		},
+		{
+			name:      "invalid type",
+			version:   "v1.20",
+			manifest:  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\n  namespace: default\nimmutable: \"yes\"\n",
+			wantError: "ConfigMap default/test: ValidationError(ConfigMap.immutable): invalid type for io.k8s.api.core.v1.ConfigMap.immutable: got \"string\", expected \"boolean\"",
+		},
+		{
+			name:      "no schema",
+			version:   "v1.20",
+			manifest:  "apiVersion: example.com/v1\nkind: Example\nmetadata:\n  name: test\n",
+			wantError: "Example test: no schema for example.com/v1, Kind=Example in Kubernetes v1.20",
+		},
+		{
+			name:     "no schema ignored",
+			version:  "v1.20",
+			manifest: "apiVersion: example.com/v1\nkind: Example\nmetadata:\n  name: test\n",
+			ignore:   true,
+		},
+		{
+			name:      "unknown version",
+			version:   "v1.21",
+			manifest:  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\n",
+			wantError: "no schema for Kubernetes v1.21, have v1.18, v1.20",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v.IgnoreMissingSchemas = test.ignore
+			err := v.ValidateManifest(context.Background(), test.version, test.manifest)
+			if test.wantError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.wantError {
+				t.Fatalf("unexpected error, got %v want %s", err, test.wantError)
+			}
+		})
+	}
+}
+
+func TestValidatePackage(t *testing.T) {
+	ctx := context.Background()
+
+	v, err := LoadSchemas("testdata/schemas")
+	if err != nil {
+		t.Fatalf("error loading schemas: %v", err)
+	}
+	if err := v.ValidatePackage(ctx, "v1.20", "testdata/channels", "hello"); err != nil {
+		t.Errorf("unexpected error validating against v1.20: %v", err)
+	}
+	err = v.ValidatePackage(ctx, "v1.18", "testdata/channels", "hello")
+	if err == nil || !strings.Contains(err.Error(), `unknown field "immutable"`) {
+		t.Errorf("expected unknown field error validating against v1.18, got %v", err)
+	}
+}